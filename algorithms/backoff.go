@@ -0,0 +1,302 @@
+package algorithms
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// BackoffConfig configures a Backoff limiter.
+type BackoffConfig struct {
+	// BaseRetryAfter is the RetryAfter of the first denial when the wrapped
+	// limiter reports a shorter one. Default: 1 second
+	BaseRetryAfter time.Duration
+
+	// Multiplier multiplies the RetryAfter of each consecutive denial.
+	// Default: 2
+	Multiplier float64
+
+	// MaxRetryAfter caps the RetryAfter of a denial, and so how long a key
+	// is blocked. Default: 1 hour
+	MaxRetryAfter time.Duration
+
+	// CleanPeriod is how long a key must go without denials for its
+	// violations to be forgotten. Default: 1 minute
+	CleanPeriod time.Duration
+
+	// PenaltyCost shrinks the rate of a key with violations: its requests
+	// cost PenaltyCost times more, up to the capacity of the wrapped limiter.
+	// Default: 0 (requests keep their cost)
+	PenaltyCost int
+}
+
+// backoffState is the state of a key of a Backoff limiter.
+type backoffState struct {
+	Violations    int       // Consecutive denials not yet forgiven
+	LastViolation time.Time // Time of the last denial
+	BlockedUntil  time.Time // Requests are denied until then
+}
+
+// Size reports the memory held by the state, for store.Sizer: its size on
+// 64-bit platforms.
+func (s *backoffState) Size() int {
+	return 56
+}
+
+const stateTypeBackoff byte = 'B'
+
+func init() {
+	// LimiterState fields of store.ProtobufCodec, see state_codec.go
+	store.RegisterProtobufFields(
+		store.ProtobufField{Name: "violations", Number: 13, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "last_violation", Number: 14, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "blocked_until", Number: 15, Kind: store.ProtobufSint64},
+	)
+}
+
+// backoffStateJSON is the JSON representation of backoffState.
+type backoffStateJSON struct {
+	Version       int    `json:"v"`
+	Type          string `json:"type"`
+	Violations    int64  `json:"violations"`
+	LastViolation int64  `json:"last_violation,omitempty"`
+	BlockedUntil  int64  `json:"blocked_until,omitempty"`
+}
+
+// MarshalBinary encodes the state in the versioned binary format.
+func (s *backoffState) MarshalBinary() ([]byte, error) {
+	b := make([]byte, stateHeaderSize+3*8)
+	b[0] = stateTypeBackoff
+	b[1] = stateVersion1
+	binary.BigEndian.PutUint64(b[2:], uint64(s.Violations))
+	binary.BigEndian.PutUint64(b[10:], uint64(toUnixNano(s.LastViolation)))
+	binary.BigEndian.PutUint64(b[18:], uint64(toUnixNano(s.BlockedUntil)))
+	return b, nil
+}
+
+// UnmarshalBinary decodes the state from the versioned binary format.
+func (s *backoffState) UnmarshalBinary(b []byte) error {
+	if len(b) < stateHeaderSize || b[0] != stateTypeBackoff {
+		return ErrInvalidState
+	}
+	if b[1] != stateVersion1 {
+		return ErrUnsupportedStateVersion
+	}
+	if len(b) < stateHeaderSize+3*8 {
+		return ErrInvalidState
+	}
+	s.Violations = int(int64(binary.BigEndian.Uint64(b[2:])))
+	s.LastViolation = fromUnixNano(int64(binary.BigEndian.Uint64(b[10:])))
+	s.BlockedUntil = fromUnixNano(int64(binary.BigEndian.Uint64(b[18:])))
+	return nil
+}
+
+// MarshalJSON encodes the state as versioned JSON.
+func (s *backoffState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(backoffStateJSON{
+		Version:       int(stateVersion1),
+		Type:          "backoff",
+		Violations:    int64(s.Violations),
+		LastViolation: toUnixNano(s.LastViolation),
+		BlockedUntil:  toUnixNano(s.BlockedUntil),
+	})
+}
+
+// UnmarshalJSON decodes the state from versioned JSON.
+func (s *backoffState) UnmarshalJSON(b []byte) error {
+	var j backoffStateJSON
+	if err := json.Unmarshal(b, &j); err != nil || j.Type != "backoff" {
+		return ErrInvalidState
+	}
+	if j.Version != int(stateVersion1) {
+		return ErrUnsupportedStateVersion
+	}
+	s.Violations = int(j.Violations)
+	s.LastViolation = fromUnixNano(j.LastViolation)
+	s.BlockedUntil = fromUnixNano(j.BlockedUntil)
+	return nil
+}
+
+// Backoff wraps a limiter to punish keys that keep retrying while limited:
+// each consecutive denial multiplies the RetryAfter of the key, up to
+// MaxRetryAfter, and the key is blocked for that long. Retrying while
+// blocked is another denial. Violations are forgiven once the key goes
+// CleanPeriod without denials. Occasional overage is barely affected, while
+// tight retry loops are quickly slowed down to MaxRetryAfter.
+//
+// The state of keys is kept in s under "bo:<key>", next to the state of the
+// wrapped limiter.
+type Backoff struct {
+	limiter  ratelimiter.LimiterWithDetails
+	store    store.Store
+	config   BackoffConfig
+	capacity int // Largest penalized cost, 0 if unknown
+	mu       [shardCount]sync.Mutex
+	seed     maphash.Seed
+	now      func() time.Time
+}
+
+// NewBackoff wraps limiter with an exponential backoff penalty whose state
+// is kept in s.
+func NewBackoff(limiter ratelimiter.Limiter, s store.Store, config BackoffConfig) *Backoff {
+	if config.BaseRetryAfter <= 0 {
+		config.BaseRetryAfter = time.Second
+	}
+	if config.Multiplier < 1 {
+		config.Multiplier = 2
+	}
+	if config.MaxRetryAfter <= 0 {
+		config.MaxRetryAfter = time.Hour
+	}
+	if config.MaxRetryAfter < config.BaseRetryAfter {
+		config.MaxRetryAfter = config.BaseRetryAfter
+	}
+	if config.CleanPeriod <= 0 {
+		config.CleanPeriod = time.Minute
+	}
+
+	b := &Backoff{
+		limiter: ratelimiter.WithDetails(limiter),
+		store:   s,
+		config:  config,
+		seed:    maphash.MakeSeed(),
+		now:     time.Now,
+	}
+	if d, ok := limiter.(ratelimiter.DescribableLimiter); ok {
+		c := d.Config()
+		b.capacity = max(c.BurstSize, c.Rate)
+		if c.MaxCost > 0 {
+			b.capacity = min(b.capacity, c.MaxCost)
+		}
+	}
+	return b
+}
+
+// Allow checks if a single request is allowed.
+func (b *Backoff) Allow(key string) (bool, error) {
+	return b.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed.
+func (b *Backoff) AllowN(key string, n int) (bool, error) {
+	result, err := b.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n requests are allowed. Denials carry the
+// backed-off RetryAfter.
+func (b *Backoff) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	mu := b.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := b.now()
+	state := b.load(key)
+	if state.Violations > 0 && now.Sub(state.LastViolation) >= b.config.CleanPeriod {
+		state = &backoffState{}
+	}
+
+	if now.Before(state.BlockedUntil) {
+		// Retrying while blocked
+		result := ratelimiter.Result{ResetAt: state.BlockedUntil}
+		err := b.violate(key, state, &result, now)
+		return result, err
+	}
+
+	cost := n
+	if state.Violations > 0 && b.config.PenaltyCost > 1 && n > 0 {
+		cost = n * b.config.PenaltyCost
+		if b.capacity > 0 {
+			cost = min(cost, max(b.capacity, n))
+		}
+	}
+
+	result, err := b.limiter.AllowNWithDetails(key, cost)
+	if err != nil || result.Allowed {
+		return result, err
+	}
+	err = b.violate(key, state, &result, now)
+	return result, err
+}
+
+// violate counts a denial of key and sets the backed-off RetryAfter of
+// result, blocking the key for as long. The denial stands if the state
+// cannot be saved, and the error is returned.
+func (b *Backoff) violate(key string, state *backoffState, result *ratelimiter.Result, now time.Time) error {
+	state.Violations++
+	state.LastViolation = now
+
+	wait := max(result.RetryAfter, b.config.BaseRetryAfter)
+	factor := math.Pow(b.config.Multiplier, float64(state.Violations-1))
+	if backedOff := float64(wait) * factor; backedOff < float64(b.config.MaxRetryAfter) {
+		wait = time.Duration(backedOff)
+	} else {
+		wait = b.config.MaxRetryAfter
+	}
+
+	result.Allowed = false
+	result.RetryAfter = wait
+	state.BlockedUntil = now.Add(wait)
+	return b.store.Set(b.storeKey(key), state, wait+b.config.CleanPeriod)
+}
+
+// Violations returns the number of consecutive denials of key not yet
+// forgiven.
+func (b *Backoff) Violations(key string) int {
+	mu := b.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	state := b.load(key)
+	if b.now().Sub(state.LastViolation) >= b.config.CleanPeriod {
+		return 0
+	}
+	return state.Violations
+}
+
+// Reset clears the violations of key and the state of the wrapped limiter.
+func (b *Backoff) Reset(key string) error {
+	mu := b.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := b.store.Delete(b.storeKey(key)); err != nil {
+		return err
+	}
+	return b.limiter.Reset(key)
+}
+
+// load returns a copy of the state of key, or a fresh state.
+func (b *Backoff) load(key string) *backoffState {
+	val, ok := b.store.Get(b.storeKey(key))
+	if !ok {
+		return &backoffState{}
+	}
+	switch v := val.(type) {
+	case *backoffState:
+		// Copy: the store may hand out the stored pointer
+		state := *v
+		return &state
+	case []byte:
+		state := &backoffState{}
+		if err := decodeState(v, state); err == nil {
+			return state
+		}
+	}
+	return &backoffState{}
+}
+
+func (b *Backoff) storeKey(key string) string {
+	return "bo:" + key
+}
+
+// lock returns the mutex for key.
+func (b *Backoff) lock(key string) *sync.Mutex {
+	return &b.mu[maphash.String(b.seed, key)%shardCount]
+}
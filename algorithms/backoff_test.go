@@ -0,0 +1,129 @@
+package algorithms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func newTestBackoff(t *testing.T, config BackoffConfig) (*Backoff, *fakeClock) {
+	t.Helper()
+	s, clock := newTestEnv(t)
+	b := NewBackoff(newTestTokenBucket(t, s, clock, 1, time.Second), s, config)
+	b.now = clock.Now
+	return b, clock
+}
+
+func TestBackoff_RetryAfterGrows(t *testing.T) {
+	b, clock := newTestBackoff(t, BackoffConfig{MaxRetryAfter: 10 * time.Second, CleanPeriod: time.Minute})
+
+	if r, _ := b.AllowNWithDetails("k", 1); !r.Allowed {
+		t.Fatal("first request should be allowed")
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		r, err := b.AllowNWithDetails("k", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Allowed {
+			t.Fatalf("retry %d should be denied", i)
+		}
+		if r.RetryAfter != w {
+			t.Errorf("retry %d: RetryAfter = %v, want %v", i, r.RetryAfter, w)
+		}
+	}
+	if got := b.Violations("k"); got != len(want) {
+		t.Errorf("Violations = %d, want %d", got, len(want))
+	}
+
+	// Still blocked before the last RetryAfter elapses, even though the
+	// bucket has refilled.
+	clock.Advance(5 * time.Second)
+	if ok, _ := b.Allow("k"); ok {
+		t.Error("request while blocked should be denied")
+	}
+}
+
+func TestBackoff_CleanPeriod(t *testing.T) {
+	b, clock := newTestBackoff(t, BackoffConfig{MaxRetryAfter: time.Second, CleanPeriod: 10 * time.Second})
+
+	b.Allow("k")
+	b.Allow("k")
+	if got := b.Violations("k"); got != 1 {
+		t.Fatalf("Violations = %d, want 1", got)
+	}
+
+	clock.Advance(10 * time.Second)
+	if got := b.Violations("k"); got != 0 {
+		t.Errorf("Violations after clean period = %d, want 0", got)
+	}
+	if ok, _ := b.Allow("k"); !ok {
+		t.Error("request after clean period should be allowed")
+	}
+	r, _ := b.AllowNWithDetails("k", 1)
+	if r.RetryAfter != time.Second {
+		t.Errorf("RetryAfter after clean period = %v, want 1s", r.RetryAfter)
+	}
+}
+
+func TestBackoff_PenaltyCost(t *testing.T) {
+	s, clock := newTestEnv(t)
+	b := NewBackoff(newTestTokenBucket(t, s, clock, 4, 4*time.Second), s, BackoffConfig{BaseRetryAfter: time.Second, MaxRetryAfter: time.Second, PenaltyCost: 2})
+	b.now = clock.Now
+
+	for range 4 {
+		b.Allow("k")
+	}
+	if ok, _ := b.Allow("k"); ok {
+		t.Fatal("fifth request should be denied")
+	}
+
+	// Refill 4 tokens: penalized requests cost 2, so only 2 get through.
+	clock.Advance(4 * time.Second)
+	allowed := 0
+	for range 4 {
+		if ok, _ := b.Allow("k"); ok {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("allowed %d penalized requests, want 2", allowed)
+	}
+}
+
+func TestBackoff_Reset(t *testing.T) {
+	b, _ := newTestBackoff(t, BackoffConfig{})
+
+	b.Allow("k")
+	b.Allow("k")
+	if err := b.Reset("k"); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Violations("k"); got != 0 {
+		t.Errorf("Violations after Reset = %d, want 0", got)
+	}
+	if ok, _ := b.Allow("k"); !ok {
+		t.Error("request after Reset should be allowed")
+	}
+}
+
+func TestBackoffState_Codec(t *testing.T) {
+	now := time.Unix(1700000000, 123)
+	in := &backoffState{Violations: 3, LastViolation: now, BlockedUntil: now.Add(time.Minute)}
+
+	for _, codec := range []store.Codec{store.BinaryCodec, store.JSONCodec} {
+		b, err := codec.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out backoffState
+		if err := decodeState(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Violations != in.Violations || !out.LastViolation.Equal(in.LastViolation) || !out.BlockedUntil.Equal(in.BlockedUntil) {
+			t.Errorf("decoded %+v, want %+v", out, in)
+		}
+	}
+}
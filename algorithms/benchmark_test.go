@@ -95,3 +95,84 @@ func BenchmarkSlidingWindow_MultipleKeys(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkTokenBucket_AllowNWithDetails(b *testing.B) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, _ := NewTokenBucket(ratelimiter.Config{
+		Rate:      1000000,
+		Window:    time.Second,
+		BurstSize: 1000000,
+	}, s)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tb.AllowNWithDetails("benchmark", 1)
+		}
+	})
+}
+
+func BenchmarkSlidingWindow_AllowNWithDetails(b *testing.B) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	sw, _ := NewSlidingWindow(ratelimiter.Config{
+		Rate:   1000000,
+		Window: time.Second,
+	}, s)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sw.AllowNWithDetails("benchmark", 1)
+		}
+	})
+}
+
+// TestMemoryStoreFastPath_NoAllocs guards the MemoryStore fast path: once a
+// key's state exists, checking it allocates nothing.
+func TestMemoryStoreFastPath_NoAllocs(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	config := ratelimiter.Config{Rate: 1000000, Window: time.Second}
+	tb, _ := NewTokenBucket(config, s)
+	sw, _ := NewSlidingWindow(config, s)
+
+	for name, l := range map[string]ratelimiter.LimiterWithDetails{"token bucket": tb, "sliding window": sw} {
+		l.Allow("key")
+		checks := map[string]func(){
+			"Allow":             func() { l.Allow("key") },
+			"AllowN":            func() { l.AllowN("key", 2) },
+			"AllowNWithDetails": func() { l.AllowNWithDetails("key", 1) },
+			"Remaining":         func() { l.(interface{ Remaining(string) int }).Remaining("key") },
+		}
+		for op, fn := range checks {
+			if allocs := testing.AllocsPerRun(100, fn); allocs != 0 {
+				t.Errorf("%s %s: expected no allocations, got %v", name, op, allocs)
+			}
+		}
+	}
+}
+
+// BenchmarkTokenBucket_RemainingParallel polls a single key from many
+// goroutines, as a dashboard would.
+func BenchmarkTokenBucket_RemainingParallel(b *testing.B) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, _ := NewTokenBucket(ratelimiter.Config{Rate: 1000, Window: time.Second}, s)
+	tb.Allow("benchmark")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tb.Remaining("benchmark")
+		}
+	})
+}
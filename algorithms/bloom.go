@@ -0,0 +1,199 @@
+package algorithms
+
+import (
+	"hash/maphash"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// BloomConfig configures a BloomFront.
+type BloomConfig struct {
+	// ExpectedKeys is the number of distinct keys expected per window. The
+	// false positive rate rises past it. Default: 100000
+	ExpectedKeys int
+
+	// FalsePositiveRate is the rate at which never-seen keys are taken for
+	// seen ones, at ExpectedKeys. Default: 0.01
+	FalsePositiveRate float64
+
+	// Window is how long keys are remembered, from one to two windows.
+	// Default: the window of the wrapped limiter, or 1 minute
+	Window time.Duration
+}
+
+// bloomFilter is a bloom filter safe for concurrent use.
+type bloomFilter struct {
+	bits []atomic.Uint64
+	m, k uint64
+}
+
+func newBloomFilter(m, k uint64) *bloomFilter {
+	return &bloomFilter{bits: make([]atomic.Uint64, (m+63)/64), m: m, k: k}
+}
+
+// add sets the bits of hash h.
+func (f *bloomFilter) add(h uint64) {
+	h1, h2 := h&0xffffffff, h>>32|1
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64].Or(1 << (bit % 64))
+	}
+}
+
+// has reports whether the bits of hash h are all set.
+func (f *bloomFilter) has(h uint64) bool {
+	h1, h2 := h&0xffffffff, h>>32|1
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) clear() {
+	for i := range f.bits {
+		f.bits[i].Store(0)
+	}
+}
+
+// bloomGeneration holds the keys of one window.
+type bloomGeneration struct {
+	seen     *bloomFilter // Keys whose first request was skipped
+	credited *bloomFilter // Keys whose skipped request was counted
+}
+
+// BloomFront saves the store writes of one-hit keys, common on public
+// endpoints: the first single request of a key is allowed without
+// consulting the wrapped limiter, and only remembered in a bloom filter. The
+// next request of the key is checked with the skipped request added to its
+// cost, so keys still get no more than their limit.
+//
+// The filters are renewed every window. A never-seen key taken for a seen
+// one (see FalsePositiveRate) is simply checked by the limiter; a key taken
+// for a credited one gets one request more than its limit.
+type BloomFront struct {
+	limiter ratelimiter.LimiterWithDetails
+	config  BloomConfig
+	result  ratelimiter.Result // Base result of skipped requests
+	seed    maphash.Seed
+	now     func() time.Time
+
+	mu      sync.RWMutex
+	renewed time.Time
+	curr    bloomGeneration
+	prev    bloomGeneration
+}
+
+// NewBloomFront wraps limiter with a bloom filter front for never-seen keys.
+func NewBloomFront(limiter ratelimiter.Limiter, config BloomConfig) *BloomFront {
+	if config.ExpectedKeys <= 0 {
+		config.ExpectedKeys = 100000
+	}
+	if config.FalsePositiveRate <= 0 || config.FalsePositiveRate >= 1 {
+		config.FalsePositiveRate = 0.01
+	}
+	b := &BloomFront{
+		limiter: ratelimiter.WithDetails(limiter),
+		result:  ratelimiter.Result{Allowed: true},
+		seed:    maphash.MakeSeed(),
+		now:     time.Now,
+	}
+	if d, ok := limiter.(ratelimiter.DescribableLimiter); ok {
+		c := d.Config()
+		b.result.Limit, b.result.Burst, b.result.Window = c.Rate, max(c.BurstSize, c.Rate), c.Window
+		if config.Window <= 0 {
+			config.Window = c.Window
+		}
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	b.config = config
+
+	// Optimal size for ExpectedKeys at FalsePositiveRate
+	n := float64(config.ExpectedKeys)
+	m := math.Ceil(-n * math.Log(config.FalsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := max(math.Round(m/n*math.Ln2), 1)
+	for _, g := range []*bloomGeneration{&b.curr, &b.prev} {
+		g.seen = newBloomFilter(uint64(m), uint64(k))
+		g.credited = newBloomFilter(uint64(m), uint64(k))
+	}
+	return b
+}
+
+// Allow checks if a single request is allowed.
+func (b *BloomFront) Allow(key string) (bool, error) {
+	return b.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed.
+func (b *BloomFront) AllowN(key string, n int) (bool, error) {
+	result, err := b.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n requests are allowed. Only single requests
+// of never-seen keys skip the wrapped limiter.
+func (b *BloomFront) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	h := maphash.String(b.seed, key)
+
+	b.mu.RLock()
+	if !b.now().Before(b.renewed.Add(b.config.Window)) {
+		b.mu.RUnlock()
+		b.renew()
+		b.mu.RLock()
+	}
+	defer b.mu.RUnlock()
+
+	if b.curr.credited.has(h) || b.prev.credited.has(h) {
+		b.curr.credited.add(h)
+		return b.limiter.AllowNWithDetails(key, n)
+	}
+	if b.curr.seen.has(h) || b.prev.seen.has(h) {
+		// Count the skipped first request with this one
+		result, err := b.limiter.AllowNWithDetails(key, n+1)
+		if err == nil && result.Allowed {
+			b.curr.credited.add(h)
+		}
+		return result, err
+	}
+	if n != 1 {
+		return b.limiter.AllowNWithDetails(key, n)
+	}
+
+	b.curr.seen.add(h)
+	result := b.result
+	result.Used = 1
+	result.Remaining = max(result.Burst-1, 0)
+	return result, nil
+}
+
+// renew starts a new window, forgetting the keys of the one before last.
+func (b *BloomFront) renew() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if now.Before(b.renewed.Add(b.config.Window)) {
+		return // Renewed by another goroutine
+	}
+	b.prev, b.curr = b.curr, b.prev
+	b.curr.seen.clear()
+	b.curr.credited.clear()
+	if now.Sub(b.renewed) >= 2*b.config.Window {
+		b.prev.seen.clear()
+		b.prev.credited.clear()
+	}
+	b.renewed = now
+}
+
+// Reset clears the state of key in the wrapped limiter.
+func (b *BloomFront) Reset(key string) error {
+	return b.limiter.Reset(key)
+}
@@ -0,0 +1,113 @@
+package algorithms
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// countingStore counts the writes to a MemoryStore.
+type countingStore struct {
+	*store.MemoryStore
+	sets int
+}
+
+func (s *countingStore) Set(key string, value interface{}, ttl time.Duration) error {
+	s.sets++
+	return s.MemoryStore.Set(key, value, ttl)
+}
+
+func newTestBloomFront(t *testing.T, rate int) (*BloomFront, *countingStore, *fakeClock) {
+	t.Helper()
+	ms, clock := newTestEnv(t)
+	s := &countingStore{MemoryStore: ms}
+	// Hide the MemoryStore optimizations so that every check writes.
+	tb := newTestTokenBucket(t, struct{ store.Store }{s}, clock, rate, time.Minute)
+	b := NewBloomFront(tb, BloomConfig{ExpectedKeys: 1000})
+	b.now = clock.Now
+	return b, s, clock
+}
+
+func TestBloomFront_SkipsOneHitKeys(t *testing.T) {
+	b, s, _ := newTestBloomFront(t, 5)
+
+	for i := 0; i < 100; i++ {
+		r, err := b.AllowNWithDetails(fmt.Sprintf("key%d", i), 1)
+		if err != nil || !r.Allowed {
+			t.Fatalf("first request of key%d should be allowed: %v", i, err)
+		}
+		if r.Limit != 5 || r.Remaining != 4 {
+			t.Errorf("skipped request: Limit %d, Remaining %d, want 5, 4", r.Limit, r.Remaining)
+		}
+	}
+	if s.sets != 0 {
+		t.Errorf("one-hit keys wrote %d times to the store, want 0", s.sets)
+	}
+}
+
+func TestBloomFront_CountsSkippedRequest(t *testing.T) {
+	b, _, clock := newTestBloomFront(t, 5)
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := b.Allow("k"); ok {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("allowed %d requests, want 5", allowed)
+	}
+
+	// Credited keys are checked normally in the next window too.
+	clock.Advance(time.Minute)
+	allowed = 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := b.Allow("k"); ok {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("allowed %d requests in the next window, want 5", allowed)
+	}
+}
+
+func TestBloomFront_Forgets(t *testing.T) {
+	b, s, clock := newTestBloomFront(t, 5)
+
+	b.Allow("k")
+	clock.Advance(2 * time.Minute)
+	b.Allow("k")
+	if s.sets != 0 {
+		t.Errorf("forgotten key wrote %d times to the store, want 0", s.sets)
+	}
+}
+
+func TestBloomFront_Batches(t *testing.T) {
+	b, s, _ := newTestBloomFront(t, 5)
+
+	if ok, _ := b.AllowN("k", 6); ok {
+		t.Error("requests over the capacity should be checked by the limiter")
+	}
+	if ok, _ := b.AllowN("k", 3); !ok || s.sets == 0 {
+		t.Error("batches should be checked by the limiter")
+	}
+}
+
+func TestBloomFilter_FalsePositiveRate(t *testing.T) {
+	b := NewBloomFront(nil, BloomConfig{ExpectedKeys: 10000, FalsePositiveRate: 0.01})
+	f := b.curr.seen
+	for i := 0; i < 10000; i++ {
+		f.add(uint64(i) * 0x9e3779b97f4a7c15)
+	}
+	fp := 0
+	for i := 10000; i < 20000; i++ {
+		if f.has(uint64(i) * 0x9e3779b97f4a7c15) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / 10000; rate > 0.02 {
+		t.Errorf("false positive rate %.3f, want about 0.01", rate)
+	}
+}
@@ -0,0 +1,102 @@
+package algorithms
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// ErrCheckPanicked is returned to checks coalesced with one that panicked
+// (see ratelimiter.Config.CoalesceWindow).
+var ErrCheckPanicked = errors.New("ratelimiter: coalesced check panicked")
+
+// batchFunc evaluates a batch of coalesced requests for a single key.
+// It is called with the key lock held and must fill results[i] for each ns[i].
+type batchFunc func(key string, ns []int, results []ratelimiter.Result) error
+
+// flight is a batch of requests for the same key that share one store round trip.
+type flight struct {
+	ns      []int
+	results []ratelimiter.Result
+	err     error
+	done    chan struct{}
+}
+
+// coalescer groups concurrent checks for the same key so that a single
+// goroutine (the leader) loads and persists the state once for the whole batch.
+// Followers that arrive while the leader is waiting for the key lock (or during
+// the optional collection window) are served from the leader's result.
+type coalescer struct {
+	mu      sync.Mutex
+	window  time.Duration
+	flights map[string]*flight
+}
+
+// newCoalescer creates a coalescer. A positive window makes the leader wait
+// that long before sealing the batch, trading latency for fewer round trips.
+func newCoalescer(window time.Duration) *coalescer {
+	return &coalescer{
+		window:  window,
+		flights: make(map[string]*flight),
+	}
+}
+
+// do joins the in-flight batch for key or starts a new one.
+// lock is the per-key lock of the algorithm; exec runs once per batch while holding it.
+func (c *coalescer) do(key string, n int, lock sync.Locker, exec batchFunc) (ratelimiter.Result, error) {
+	c.mu.Lock()
+	if f, ok := c.flights[key]; ok {
+		idx := len(f.ns)
+		f.ns = append(f.ns, n)
+		c.mu.Unlock()
+
+		<-f.done
+		if f.err != nil {
+			return ratelimiter.Result{}, f.err
+		}
+		return f.results[idx], nil
+	}
+
+	f := &flight{
+		ns:   []int{n},
+		done: make(chan struct{}),
+	}
+	c.flights[key] = f
+	c.mu.Unlock()
+
+	// Release the followers even if exec panics: they fail with
+	// ErrCheckPanicked while the panic propagates in the leader.
+	f.err = ErrCheckPanicked
+	defer func() {
+		c.mu.Lock()
+		if c.flights[key] == f {
+			delete(c.flights, key)
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}()
+
+	if c.window > 0 {
+		time.Sleep(c.window)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Seal the batch: requests arriving from now on start a new flight,
+	// which will be processed after this one releases the key lock.
+	c.mu.Lock()
+	delete(c.flights, key)
+	ns := f.ns
+	c.mu.Unlock()
+
+	f.results = make([]ratelimiter.Result, len(ns))
+	f.err = exec(key, ns, f.results)
+
+	if f.err != nil {
+		return ratelimiter.Result{}, f.err
+	}
+	return f.results[0], nil
+}
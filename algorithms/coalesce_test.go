@@ -0,0 +1,185 @@
+package algorithms
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// slowStore is a minimal Store that simulates a remote backend with latency
+// and counts round trips.
+type slowStore struct {
+	mu      sync.Mutex
+	data    map[string]interface{}
+	latency time.Duration
+	gets    atomic.Int64
+	sets    atomic.Int64
+}
+
+func newSlowStore(latency time.Duration) *slowStore {
+	return &slowStore{data: make(map[string]interface{}), latency: latency}
+}
+
+func (s *slowStore) Get(key string) (interface{}, bool) {
+	s.gets.Add(1)
+	time.Sleep(s.latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func (s *slowStore) Set(key string, value interface{}, ttl time.Duration) error {
+	s.sets.Add(1)
+	time.Sleep(s.latency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+func (s *slowStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *slowStore) Close() error { return nil }
+
+func TestTokenBucket_Coalescing(t *testing.T) {
+	s := newSlowStore(5 * time.Millisecond)
+
+	tb, err := NewTokenBucket(ratelimiter.Config{
+		Rate:           50,
+		Window:         time.Hour,
+		CoalesceWindow: 2 * time.Millisecond,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	const n = 100
+	var wg sync.WaitGroup
+	var allowed atomic.Int64
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := tb.Allow("hot")
+			if err != nil {
+				t.Errorf("Allow returned error: %v", err)
+				return
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 50 {
+		t.Errorf("Expected exactly 50 allowed, got %d", got)
+	}
+	if gets := s.gets.Load(); gets >= n {
+		t.Errorf("Expected coalescing to reduce store reads below %d, got %d", n, gets)
+	}
+}
+
+func TestSlidingWindow_Coalescing(t *testing.T) {
+	s := newSlowStore(5 * time.Millisecond)
+
+	sw, err := NewSlidingWindow(ratelimiter.Config{
+		Rate:           30,
+		Window:         time.Hour,
+		CoalesceWindow: 2 * time.Millisecond,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create SlidingWindow: %v", err)
+	}
+
+	const n = 60
+	var wg sync.WaitGroup
+	var allowed atomic.Int64
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := sw.Allow("hot")
+			if err != nil {
+				t.Errorf("Allow returned error: %v", err)
+				return
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 30 {
+		t.Errorf("Expected exactly 30 allowed, got %d", got)
+	}
+	if sets := s.sets.Load(); sets >= 30 {
+		t.Errorf("Expected coalescing to reduce store writes below 30, got %d", sets)
+	}
+}
+
+func TestCoalescing_InvalidWindow(t *testing.T) {
+	_, err := NewTokenBucket(ratelimiter.Config{
+		Rate:           10,
+		Window:         time.Second,
+		CoalesceWindow: -time.Millisecond,
+	}, newSlowStore(0))
+	if err != ratelimiter.ErrInvalidCoalesceWindow {
+		t.Errorf("Expected ErrInvalidCoalesceWindow, got %v", err)
+	}
+}
+
+func TestCoalescer_LeaderPanic(t *testing.T) {
+	c := newCoalescer(20 * time.Millisecond)
+	var lock sync.Mutex
+
+	leaderDone := make(chan interface{})
+	go func() {
+		defer func() { leaderDone <- recover() }()
+		c.do("k", 1, &lock, func(key string, ns []int, results []ratelimiter.Result) error {
+			panic("boom")
+		})
+	}()
+
+	// Join the leader's flight during its collection window
+	time.Sleep(5 * time.Millisecond)
+	followerErr := make(chan error)
+	go func() {
+		_, err := c.do("k", 1, &lock, func(key string, ns []int, results []ratelimiter.Result) error {
+			return nil
+		})
+		followerErr <- err
+	}()
+
+	if r := <-leaderDone; r != "boom" {
+		t.Fatalf("Expected the leader to panic, got %v", r)
+	}
+	select {
+	case err := <-followerErr:
+		if !errors.Is(err, ErrCheckPanicked) {
+			t.Errorf("Expected ErrCheckPanicked, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Follower blocked after the leader panicked")
+	}
+
+	// The key lock and the flight were released
+	result, err := c.do("k", 1, &lock, func(key string, ns []int, results []ratelimiter.Result) error {
+		results[0].Allowed = true
+		return nil
+	})
+	if err != nil || !result.Allowed {
+		t.Errorf("Expected the next check to run, got %v, %v", result, err)
+	}
+}
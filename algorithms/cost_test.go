@@ -0,0 +1,64 @@
+package algorithms
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestAllowN_CostExceedsCapacity(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, _ := NewTokenBucket(ratelimiter.Config{Rate: 10, Window: time.Second, BurstSize: 5, MaxDebt: 2}, s)
+	sw, _ := NewSlidingWindow(ratelimiter.Config{Rate: 10, Window: time.Second}, s)
+
+	tests := []struct {
+		name    string
+		limiter ratelimiter.LimiterWithDetails
+		n       int
+		wantErr error
+	}{
+		{"token bucket within burst+debt", tb, 7, nil},
+		{"token bucket above burst+debt", tb, 8, ratelimiter.ErrCostExceedsCapacity},
+		{"sliding window within rate", sw, 10, nil},
+		{"sliding window above rate", sw, 11, ratelimiter.ErrCostExceedsCapacity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.limiter.AllowNWithDetails(tt.name, tt.n)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && result.Allowed {
+				t.Error("Expected Allowed=false with error")
+			}
+		})
+	}
+}
+
+func TestAllowN_MaxCost(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, err := NewTokenBucket(ratelimiter.Config{Rate: 100, Window: time.Second, MaxCost: 5}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	if ok, err := tb.AllowN("test", 5); !ok || err != nil {
+		t.Errorf("Expected cost 5 to be allowed, got %v, %v", ok, err)
+	}
+	if _, err := tb.AllowN("test", 6); !errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+
+	sw, _ := NewSlidingWindow(ratelimiter.Config{Rate: 100, Window: time.Second, MaxCost: 3}, s)
+	if _, err := sw.AllowN("test", 4); !errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package algorithms
+
+import (
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// CountMinName is the name reported by CountMin.Algorithm.
+const CountMinName = "count_min"
+
+// Default accuracy of CountMin sketches, about 1 MB per limiter.
+const (
+	defaultSketchEpsilon = 0.0001
+	defaultSketchDelta   = 0.01
+)
+
+// WithSketchError sets the accuracy of a CountMin limiter: with probability
+// 1-delta, the count of a key is overestimated by at most epsilon times the
+// requests allowed across all keys in a window. Memory grows with
+// ln(1/delta)/epsilon. Other limiters ignore it.
+// Default: epsilon 0.0001, delta 0.01
+func WithSketchError(epsilon, delta float64) Option {
+	return func(o *options) {
+		o.sketchEpsilon, o.sketchDelta = epsilon, delta
+	}
+}
+
+// CountMin is an approximate sliding window limiter whose memory does not
+// depend on the number of keys: counts are kept in count-min sketches, one
+// for the current window and one for the previous, instead of per-key state
+// in a store. It suits very high cardinality keys, e.g. per IP on a large
+// public site, where an attack rotating addresses would otherwise grow the
+// store without bound.
+//
+// Counts are never underestimated, so no key gets more than its rate. Keys
+// may be limited early when they share sketch cells with busy keys: see
+// WithSketchError for the error bound, and Memory for the resulting size.
+// State is local to the process and lost on restart.
+type CountMin struct {
+	config    ratelimiter.Config
+	now       func() time.Time
+	metrics   Metrics
+	seed      maphash.Seed
+	invWindow float64
+	maxCost   int
+	width     uint64
+	depth     int
+
+	mu          sync.Mutex
+	windowStart time.Time
+	curr        []uint32 // depth rows of width counters, current window
+	prev        []uint32 // depth rows of width counters, previous window
+}
+
+// NewCountMin creates a new approximate sliding window limiter.
+func NewCountMin(config ratelimiter.Config, opts ...Option) (*CountMin, error) {
+	o := newOptions(&config, opts)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	epsilon, delta := o.sketchEpsilon, o.sketchDelta
+	if epsilon <= 0 || epsilon >= 1 {
+		epsilon = defaultSketchEpsilon
+	}
+	if delta <= 0 || delta >= 1 {
+		delta = defaultSketchDelta
+	}
+
+	cm := &CountMin{
+		config:    config,
+		now:       o.now,
+		metrics:   o.metrics,
+		seed:      maphash.MakeSeed(),
+		invWindow: 1.0 / float64(config.Window),
+		maxCost:   config.Rate,
+		width:     uint64(math.Ceil(math.E / epsilon)),
+		depth:     int(math.Ceil(math.Log(1 / delta))),
+	}
+	if config.MaxCost > 0 && config.MaxCost < cm.maxCost {
+		cm.maxCost = config.MaxCost
+	}
+	cm.curr = make([]uint32, cm.depth*int(cm.width))
+	cm.prev = make([]uint32, cm.depth*int(cm.width))
+	return cm, nil
+}
+
+// Allow checks if a single request is allowed.
+func (cm *CountMin) Allow(key string) (bool, error) {
+	return cm.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed.
+func (cm *CountMin) AllowN(key string, n int) (bool, error) {
+	result, err := cm.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n requests are allowed and returns detailed result.
+func (cm *CountMin) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	if cm.metrics == nil {
+		return cm.allowN(key, n)
+	}
+	start := time.Now()
+	result, err := cm.allowN(key, n)
+	cm.metrics.ObserveCheck(CountMinName, result, time.Since(start), err)
+	return result, err
+}
+
+// allowN checks if n requests are allowed.
+func (cm *CountMin) allowN(key string, n int) (ratelimiter.Result, error) {
+	result := ratelimiter.Result{
+		Limit:  cm.config.Rate,
+		Burst:  cm.config.Rate,
+		Window: cm.config.Window,
+	}
+	if n <= 0 {
+		result.Allowed = true
+		result.Remaining = cm.config.Rate
+		return result, nil
+	}
+	if n > cm.maxCost {
+		return result, ratelimiter.ErrCostExceedsCapacity
+	}
+
+	var cells [16]uint64
+	idx := cm.cells(key, cells[:0])
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	now := cm.now()
+	cm.advance(now)
+	curr := cm.estimate(cm.curr, idx)
+	weighted := cm.weighted(curr, cm.estimate(cm.prev, idx), now)
+	result.ResetAt = cm.windowStart.Add(cm.config.Window)
+
+	if weighted+float64(n) > float64(cm.config.Rate) {
+		result.RetryAfter = cm.config.Window - now.Sub(cm.windowStart)
+		result.RetryAfter = ratelimiter.AddJitter(result.RetryAfter, cm.config.RetryAfterJitter)
+		result.Remaining = max(int(float64(cm.config.Rate)-weighted), 0)
+		result.Used = int(weighted)
+		return result, nil
+	}
+
+	// Conservative update: only raise the cells below the new estimate,
+	// which keeps the overestimation of other keys sharing them low.
+	count := uint32(min(uint64(curr)+uint64(n), math.MaxUint32))
+	for _, i := range idx {
+		if cm.curr[i] < count {
+			cm.curr[i] = count
+		}
+	}
+
+	result.Allowed = true
+	result.Used = int(weighted) + n
+	result.Remaining = max(int(float64(cm.config.Rate)-weighted-float64(n)), 0)
+	return result, nil
+}
+
+// Remaining returns an estimate of remaining requests for the given key.
+func (cm *CountMin) Remaining(key string) int {
+	var cells [16]uint64
+	idx := cm.cells(key, cells[:0])
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	now := cm.now()
+	cm.advance(now)
+	weighted := cm.weighted(cm.estimate(cm.curr, idx), cm.estimate(cm.prev, idx), now)
+	return max(int(float64(cm.config.Rate)-weighted), 0)
+}
+
+// Reset is not supported: the counts of a key cannot be told apart from
+// those of the keys sharing its cells. It returns ratelimiter.ErrNotSupported.
+func (cm *CountMin) Reset(key string) error {
+	return ratelimiter.ErrNotSupported
+}
+
+// Config returns the configuration of the limiter.
+func (cm *CountMin) Config() ratelimiter.Config {
+	return cm.config
+}
+
+// Algorithm returns the name of the algorithm.
+func (cm *CountMin) Algorithm() string {
+	return CountMinName
+}
+
+// Memory returns the size of the sketches in bytes, which is constant.
+func (cm *CountMin) Memory() int {
+	return 2 * 4 * cm.depth * int(cm.width)
+}
+
+// cells appends the index of the cell of key in each row to dst, using
+// double hashing to derive the row hashes from a single hash.
+func (cm *CountMin) cells(key string, dst []uint64) []uint64 {
+	h := maphash.String(cm.seed, key)
+	h1, h2 := h&0xffffffff, h>>32|1
+	for row := 0; row < cm.depth; row++ {
+		dst = append(dst, uint64(row)*cm.width+(h1+uint64(row)*h2)%cm.width)
+	}
+	return dst
+}
+
+// estimate returns the smallest of the cells of a key in sketch.
+func (cm *CountMin) estimate(sketch []uint32, idx []uint64) uint32 {
+	count := uint32(math.MaxUint32)
+	for _, i := range idx {
+		count = min(count, sketch[i])
+	}
+	return count
+}
+
+// weighted returns the sliding window count from the counts of the current
+// and previous windows.
+func (cm *CountMin) weighted(curr, prev uint32, now time.Time) float64 {
+	progress := min(float64(now.Sub(cm.windowStart))*cm.invWindow, 1)
+	return float64(prev)*(1-progress) + float64(curr)
+}
+
+// advance slides the windows to now. The caller must hold cm.mu.
+func (cm *CountMin) advance(now time.Time) {
+	elapsed := now.Sub(cm.windowStart)
+	switch {
+	case elapsed >= 2*cm.config.Window:
+		clear(cm.curr)
+		clear(cm.prev)
+		cm.windowStart = now
+	case elapsed >= cm.config.Window:
+		cm.prev, cm.curr = cm.curr, cm.prev
+		clear(cm.curr)
+		cm.windowStart = cm.windowStart.Add(cm.config.Window)
+	}
+}
@@ -0,0 +1,95 @@
+package algorithms
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+func TestCountMin_Limit(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cm, err := NewCountMin(ratelimiter.Config{Rate: 5, Window: time.Minute}, WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if ok, _ := cm.Allow("k"); !ok {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	r, _ := cm.AllowNWithDetails("k", 1)
+	if r.Allowed {
+		t.Fatal("sixth request should be denied")
+	}
+	if r.RetryAfter != time.Minute {
+		t.Errorf("RetryAfter = %v, want 1m", r.RetryAfter)
+	}
+	if ok, _ := cm.Allow("other"); !ok {
+		t.Error("other keys should have their own limit")
+	}
+
+	// Halfway through the next window, half of the previous count remains.
+	clock.Advance(90 * time.Second)
+	if got := cm.Remaining("k"); got != 2 {
+		t.Errorf("Remaining = %d, want 2", got)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if got := cm.Remaining("k"); got != 5 {
+		t.Errorf("Remaining after two windows = %d, want 5", got)
+	}
+}
+
+func TestCountMin_NeverUnderestimates(t *testing.T) {
+	// A tiny sketch forces collisions between keys.
+	cm, err := NewCountMin(ratelimiter.Config{Rate: 10, Window: time.Minute}, WithSketchError(0.5, 0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		allowed := 0
+		for j := 0; j < 20; j++ {
+			if ok, _ := cm.Allow(key); ok {
+				allowed++
+			}
+		}
+		if allowed > 10 {
+			t.Fatalf("%s: allowed %d requests, limit is 10", key, allowed)
+		}
+	}
+}
+
+func TestCountMin_Memory(t *testing.T) {
+	cm, err := NewCountMin(ratelimiter.Config{Rate: 10, Window: time.Minute}, WithSketchError(0.001, 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// width ceil(e/0.001) = 2719, depth ceil(ln(100)) = 5
+	if got, want := cm.Memory(), 2*4*5*2719; got != want {
+		t.Errorf("Memory = %d, want %d", got, want)
+	}
+
+	before := cm.Memory()
+	for i := 0; i < 10000; i++ {
+		cm.Allow(fmt.Sprintf("key%d", i))
+	}
+	if cm.Memory() != before {
+		t.Error("memory should not depend on the number of keys")
+	}
+}
+
+func TestCountMin_Reset(t *testing.T) {
+	cm, err := NewCountMin(ratelimiter.Config{Rate: 10, Window: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.Reset("k"); !errors.Is(err, ratelimiter.ErrNotSupported) {
+		t.Errorf("Reset error = %v, want ErrNotSupported", err)
+	}
+}
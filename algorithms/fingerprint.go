@@ -0,0 +1,64 @@
+package algorithms
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// MismatchPolicy is what a limiter does with the state of a key written by
+// a limiter with a different config, e.g. when two limiters with different
+// rates share a store without distinct namespaces (see WithNamespace).
+// Such state is detected by the config fingerprint stored with it.
+type MismatchPolicy int
+
+const (
+	// MismatchReset discards the state and starts the key over.
+	MismatchReset MismatchPolicy = iota
+
+	// MismatchError fails checks of the key with ratelimiter.ErrConfigMismatch,
+	// leaving the state untouched.
+	MismatchError
+
+	// MismatchAdopt keeps the state and reads it with the limiter's config:
+	// a token bucket keeps its tokens (capped to its burst size), a sliding
+	// window its counts. Scheduled uses it to change configs without
+	// starting keys over.
+	MismatchAdopt
+)
+
+// WithMismatchPolicy sets what the limiter does with state written by a
+// limiter with a different config. Default: MismatchReset
+func WithMismatchPolicy(p MismatchPolicy) Option {
+	return func(o *options) {
+		o.mismatch = p
+	}
+}
+
+// configFingerprint returns the fingerprint of the parts of config that
+// give the state of an algorithm its meaning. It is never 0, the
+// fingerprint of state written before fingerprints existed.
+func configFingerprint(algorithm string, config ratelimiter.Config) uint32 {
+	h := fnv.New32a()
+	var buf []byte
+	buf = append(buf, algorithm...)
+	buf = strconv.AppendInt(append(buf, '|'), int64(config.Rate), 10)
+	buf = strconv.AppendInt(append(buf, '|'), int64(config.Window), 10)
+	if algorithm == TokenBucketName {
+		buf = strconv.AppendInt(append(buf, '|'), int64(config.BurstSize), 10)
+		buf = strconv.AppendInt(append(buf, '|'), int64(config.RefillInterval), 10)
+	}
+	h.Write(buf)
+	if sum := h.Sum32(); sum != 0 {
+		return sum
+	}
+	return 1
+}
+
+// fingerprintMatches reports whether state with fingerprint fp can be used
+// by a limiter whose fingerprint is want. State without a fingerprint is
+// adopted.
+func fingerprintMatches(fp, want uint32) bool {
+	return fp == 0 || fp == want
+}
@@ -0,0 +1,105 @@
+package algorithms
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestConfigFingerprint(t *testing.T) {
+	base := ratelimiter.Config{Rate: 10, Window: time.Minute, BurstSize: 10}
+	fp := configFingerprint(TokenBucketName, base)
+	if fp == 0 {
+		t.Fatal("Expected a non-zero fingerprint")
+	}
+	if fp != configFingerprint(TokenBucketName, base) {
+		t.Error("Expected fingerprints to be deterministic")
+	}
+
+	other := base
+	other.StateTTL = time.Hour
+	if configFingerprint(TokenBucketName, other) != fp {
+		t.Error("Expected settings that do not change the state's meaning to keep the fingerprint")
+	}
+
+	for _, c := range []ratelimiter.Config{
+		{Rate: 20, Window: time.Minute, BurstSize: 10},
+		{Rate: 10, Window: time.Hour, BurstSize: 10},
+		{Rate: 10, Window: time.Minute, BurstSize: 20},
+	} {
+		if configFingerprint(TokenBucketName, c) == fp {
+			t.Errorf("Expected %+v to change the fingerprint", c)
+		}
+	}
+	if configFingerprint(SlidingWindowName, base) == fp {
+		t.Error("Expected the algorithm to change the fingerprint")
+	}
+}
+
+func TestMismatchPolicy(t *testing.T) {
+	strict := ratelimiter.Config{Rate: 1, Window: time.Minute}
+	loose := ratelimiter.Config{Rate: 5, Window: time.Minute}
+
+	for _, tc := range []struct {
+		name string
+		new  func(ratelimiter.Config, store.Store, ...Option) (ratelimiter.LimiterWithDetails, error)
+	}{
+		{"token bucket", func(c ratelimiter.Config, s store.Store, opts ...Option) (ratelimiter.LimiterWithDetails, error) {
+			return NewTokenBucket(c, s, opts...)
+		}},
+		{"sliding window", func(c ratelimiter.Config, s store.Store, opts ...Option) (ratelimiter.LimiterWithDetails, error) {
+			return NewSlidingWindow(c, s, opts...)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			defer s.Close()
+
+			a, _ := tc.new(strict, s)
+			b, _ := tc.new(loose, s)
+			c, _ := tc.new(loose, s, WithMismatchPolicy(MismatchError))
+
+			a.Allow("k")
+			if ok, _ := a.Allow("k"); ok {
+				t.Fatal("Expected the strict limit to be reached")
+			}
+
+			// The loose limiter does not count against the strict limit's state
+			result, err := b.AllowNWithDetails("k", 1)
+			if err != nil || !result.Allowed || result.Remaining != 4 {
+				t.Errorf("Expected the mismatched state to be reset, got %+v (err %v)", result, err)
+			}
+
+			// The state is now the loose limiter's
+			if _, err := a.AllowNWithDetails("k", 1); err != nil {
+				t.Errorf("Expected the default policy to reset, got %v", err)
+			}
+			if _, err := c.AllowNWithDetails("k", 1); !errors.Is(err, ratelimiter.ErrConfigMismatch) {
+				t.Errorf("Expected ErrConfigMismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMismatchPolicy_LegacyState(t *testing.T) {
+	s := newEncodingStore(store.BinaryCodec)
+	config := ratelimiter.Config{Rate: 2, Window: time.Minute}
+
+	// State written before fingerprints existed is adopted, not reset
+	legacy := &tokenBucketState{Tokens: 0, LastRefill: time.Now()}
+	data, _ := legacy.MarshalBinary()
+	s.data["tb:k"] = data
+
+	tb, _ := NewTokenBucket(config, s, WithMismatchPolicy(MismatchError))
+	if ok, err := tb.Allow("k"); ok || err != nil {
+		t.Errorf("Expected the legacy state to be used, got allowed=%v err=%v", ok, err)
+	}
+
+	var stored tokenBucketState
+	if err := decodeState(s.data["tb:k"], &stored); err != nil || stored.Fingerprint != tb.fingerprint {
+		t.Errorf("Expected the adopted state to be stamped with the fingerprint, got %x (err %v)", stored.Fingerprint, err)
+	}
+}
@@ -0,0 +1,112 @@
+package algorithms
+
+import (
+	"math"
+	"time"
+)
+
+// Grants give a key temporary capacity on top of its limit, e.g. a one-off
+// boost for a customer during an incident. A grant is stored with the state
+// of the key and is only drawn on once the regular limit is exhausted, so it
+// is not consumed by traffic the limit allows anyway. Granted requests left
+// at the expiry are lost.
+
+// GrantN gives key n extra requests usable until expiry, on top of its
+// bucket. Granted requests are not capped by BurstSize and do not refill,
+// but a single check still cannot cost more than BurstSize + MaxDebt (or
+// MaxCost). A grant added to an active one sums the requests and keeps the
+// later expiry. Grants with n <= 0 or an expiry in the past are ignored.
+func (tb *TokenBucket) GrantN(key string, n int, expiry time.Time) error {
+	var storeKey string
+	useNS := tb.nsStore != nil
+	if !useNS {
+		storeKey = tb.storeKey(key)
+	}
+
+	mu := tb.getLock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := tb.now()
+	if n <= 0 || !expiry.After(now) {
+		return nil
+	}
+	state, err := tb.getState(key, storeKey, useNS, now)
+	if err != nil {
+		return err
+	}
+	state.Grant, state.GrantExpiry = addGrant(state.Grant, state.GrantExpiry, n, expiry, now)
+	state.LastSave = now
+	return tb.saveState(key, storeKey, useNS, state, now)
+}
+
+// GrantN gives key n extra requests usable until expiry, on top of its
+// window. Granted requests are not counted in the window, but a single check
+// still cannot cost more than Rate (or MaxCost). A grant added to an active
+// one sums the requests and keeps the later expiry. Grants with n <= 0 or an
+// expiry in the past are ignored.
+func (sw *SlidingWindow) GrantN(key string, n int, expiry time.Time) error {
+	var storeKey string
+	useNS := sw.nsStore != nil
+	if !useNS {
+		storeKey = sw.storeKey(key)
+	}
+
+	mu := sw.getLock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := sw.now()
+	if n <= 0 || !expiry.After(now) {
+		return nil
+	}
+	state, err := sw.getState(key, storeKey, useNS, now)
+	if err != nil {
+		return err
+	}
+	state.Grant, state.GrantExpiry = addGrant(state.Grant, state.GrantExpiry, n, expiry, now)
+	state.LastSave = now
+	return sw.saveState(key, storeKey, useNS, state, now)
+}
+
+// activeGrant returns the granted requests left at now.
+func activeGrant(grant int, expiry, now time.Time) int {
+	if grant <= 0 || !expiry.After(now) {
+		return 0
+	}
+	return grant
+}
+
+// addGrant adds n requests until expiry to a grant.
+func addGrant(grant int, grantExpiry time.Time, n int, expiry, now time.Time) (int, time.Time) {
+	grant = activeGrant(grant, grantExpiry, now)
+	if grant > 0 && grantExpiry.After(expiry) {
+		expiry = grantExpiry
+	}
+	if grant > math.MaxInt-n {
+		return math.MaxInt, expiry
+	}
+	return grant + n, expiry
+}
+
+// fromGrant returns the part of n requests to draw from a grant when the
+// regular limit is short of deficit requests, and whether the grant covers
+// it.
+func fromGrant(n int, deficit float64, grant int) (int, bool) {
+	if deficit <= 0 {
+		return 0, true
+	}
+	need := n
+	if deficit < float64(n) {
+		need = int(math.Ceil(deficit))
+	}
+	return need, need <= grant
+}
+
+// grantTTL extends the TTL of state to keep an active grant until its expiry.
+func grantTTL(ttl time.Duration, grant int, expiry, now time.Time) time.Duration {
+	if activeGrant(grant, expiry, now) > 0 {
+		return max(ttl, expiry.Sub(now))
+	}
+	return ttl
+}
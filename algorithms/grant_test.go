@@ -0,0 +1,85 @@
+package algorithms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// grantLimiter is a limiter supporting grants, as TokenBucket and
+// SlidingWindow do.
+type grantLimiter interface {
+	ratelimiter.LimiterWithDetails
+	ratelimiter.Granter
+	Remaining(key string) int
+}
+
+func TestGrantN(t *testing.T) {
+	config := ratelimiter.Config{Rate: 2, Window: time.Hour}
+	for _, codec := range []store.Codec{nil, store.BinaryCodec, store.JSONCodec} {
+		var s store.Store = store.NewMemoryStore()
+		if codec != nil {
+			s = newEncodingStore(codec)
+		}
+		clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+		tb, _ := NewTokenBucket(config, s, WithClock(clock.Now))
+		sw, _ := NewSlidingWindow(config, s, WithClock(clock.Now))
+
+		for _, l := range []grantLimiter{tb, sw} {
+			name := l.(ratelimiter.DescribableLimiter).Algorithm()
+			if err := l.GrantN("acme", 3, clock.Now().Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if got := l.Remaining("acme"); got != 5 {
+				t.Errorf("%s: Remaining = %d, want the limit of 2 plus 3 granted", name, got)
+			}
+
+			// The limit is used first, then the grant
+			for i := 0; i < 5; i++ {
+				result, _ := l.AllowNWithDetails("acme", 1)
+				if !result.Allowed || result.Remaining != 4-i {
+					t.Errorf("%s: request %d = %+v, want allowed with %d remaining", name, i, result, 4-i)
+				}
+			}
+			if allowed, _ := l.Allow("acme"); allowed {
+				t.Errorf("%s: request past the grant should be denied", name)
+			}
+
+			// Requests partly covered by the grant draw only the excess
+			l.GrantN("other", 1, clock.Now().Add(time.Minute))
+			l.Allow("other")
+			if result, _ := l.AllowNWithDetails("other", 2); !result.Allowed || result.Remaining != 0 {
+				t.Errorf("%s: AllowN(2) = %+v, want allowed using the grant", name, result)
+			}
+
+			// Expired grants are lost
+			l.GrantN("late", 5, clock.Now().Add(time.Minute))
+			l.AllowN("late", 2)
+			clock.Advance(2 * time.Minute)
+			if allowed, _ := l.Allow("late"); allowed {
+				t.Errorf("%s: expired grant should not allow requests", name)
+			}
+			clock.Advance(-2 * time.Minute)
+		}
+	}
+}
+
+func TestGrantN_Accumulates(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tb, _ := NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Hour}, s, WithClock(clock.Now))
+
+	tb.GrantN("acme", 2, clock.Now().Add(time.Hour))
+	tb.GrantN("acme", 2, clock.Now().Add(time.Minute))
+	tb.GrantN("acme", 0, clock.Now().Add(time.Hour))
+	tb.GrantN("acme", 9, clock.Now().Add(-time.Minute))
+	clock.Advance(30 * time.Minute)
+
+	// 4 granted requests kept until the later expiry, plus the refilled bucket
+	if got := tb.Remaining("acme"); got != 5 {
+		t.Errorf("Remaining = %d, want 5", got)
+	}
+}
@@ -0,0 +1,242 @@
+package algorithms
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// GreylistConfig configures a Greylist limiter.
+type GreylistConfig struct {
+	// Period is how long a new key stays on the provisional limit.
+	// Default: 10 minutes
+	Period time.Duration
+
+	// Memory is how long a key is remembered after its last request. Keys
+	// idle for longer are new again. Default: 24 hours
+	Memory time.Duration
+}
+
+// greylistState is the state of a key of a Greylist limiter.
+type greylistState struct {
+	FirstSeen time.Time // Time of the first request
+	LastSeen  time.Time // Time of the last request recorded in the store
+}
+
+// Size reports the memory held by the state, for store.Sizer: its size on
+// 64-bit platforms.
+func (s *greylistState) Size() int {
+	return 48
+}
+
+const stateTypeGreylist byte = 'G'
+
+func init() {
+	// LimiterState fields of store.ProtobufCodec, see state_codec.go
+	store.RegisterProtobufFields(
+		store.ProtobufField{Name: "first_seen", Number: 16, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "last_seen", Number: 17, Kind: store.ProtobufSint64},
+	)
+}
+
+// greylistStateJSON is the JSON representation of greylistState.
+type greylistStateJSON struct {
+	Version   int    `json:"v"`
+	Type      string `json:"type"`
+	FirstSeen int64  `json:"first_seen"`
+	LastSeen  int64  `json:"last_seen"`
+}
+
+// MarshalBinary encodes the state in the versioned binary format.
+func (s *greylistState) MarshalBinary() ([]byte, error) {
+	b := make([]byte, stateHeaderSize+2*8)
+	b[0] = stateTypeGreylist
+	b[1] = stateVersion1
+	binary.BigEndian.PutUint64(b[2:], uint64(toUnixNano(s.FirstSeen)))
+	binary.BigEndian.PutUint64(b[10:], uint64(toUnixNano(s.LastSeen)))
+	return b, nil
+}
+
+// UnmarshalBinary decodes the state from the versioned binary format.
+func (s *greylistState) UnmarshalBinary(b []byte) error {
+	if len(b) < stateHeaderSize || b[0] != stateTypeGreylist {
+		return ErrInvalidState
+	}
+	if b[1] != stateVersion1 {
+		return ErrUnsupportedStateVersion
+	}
+	if len(b) < stateHeaderSize+2*8 {
+		return ErrInvalidState
+	}
+	s.FirstSeen = fromUnixNano(int64(binary.BigEndian.Uint64(b[2:])))
+	s.LastSeen = fromUnixNano(int64(binary.BigEndian.Uint64(b[10:])))
+	return nil
+}
+
+// MarshalJSON encodes the state as versioned JSON.
+func (s *greylistState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(greylistStateJSON{
+		Version:   int(stateVersion1),
+		Type:      "greylist",
+		FirstSeen: toUnixNano(s.FirstSeen),
+		LastSeen:  toUnixNano(s.LastSeen),
+	})
+}
+
+// UnmarshalJSON decodes the state from versioned JSON.
+func (s *greylistState) UnmarshalJSON(b []byte) error {
+	var j greylistStateJSON
+	if err := json.Unmarshal(b, &j); err != nil || j.Type != "greylist" {
+		return ErrInvalidState
+	}
+	if j.Version != int(stateVersion1) {
+		return ErrUnsupportedStateVersion
+	}
+	s.FirstSeen = fromUnixNano(j.FirstSeen)
+	s.LastSeen = fromUnixNano(j.LastSeen)
+	return nil
+}
+
+// Greylist gives keys never seen before a smaller provisional limit for
+// their first Period, then graduates them to the full limit. This blunts
+// botnets rotating fresh IPs, e.g. for credential stuffing, while known
+// clients keep the full limit.
+//
+// The time a key was first seen is kept in s under "gl:<key>". Checks of
+// the provisional limiter use the key "new:<key>", so both limiters can
+// share s even with the same algorithm.
+type Greylist struct {
+	full        ratelimiter.LimiterWithDetails
+	provisional ratelimiter.LimiterWithDetails
+	store       store.Store
+	config      GreylistConfig
+	now         func() time.Time
+}
+
+// NewGreylist returns a limiter applying provisional to new keys and full
+// to keys seen for at least config.Period.
+func NewGreylist(full, provisional ratelimiter.Limiter, s store.Store, config GreylistConfig) *Greylist {
+	if config.Period <= 0 {
+		config.Period = 10 * time.Minute
+	}
+	if config.Memory <= 0 {
+		config.Memory = 24 * time.Hour
+	}
+	return &Greylist{
+		full:        ratelimiter.WithDetails(full),
+		provisional: ratelimiter.WithDetails(provisional),
+		store:       s,
+		config:      config,
+		now:         time.Now,
+	}
+}
+
+// Allow checks if a single request is allowed.
+func (g *Greylist) Allow(key string) (bool, error) {
+	return g.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed.
+func (g *Greylist) AllowN(key string, n int) (bool, error) {
+	result, err := g.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks n requests against the limit of key: the
+// provisional limit if key is still new, the full limit otherwise.
+func (g *Greylist) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	now := g.now()
+	graduation, err := g.touch(key, now)
+	if err != nil {
+		return ratelimiter.Result{}, err
+	}
+	if !now.Before(graduation) {
+		return g.full.AllowNWithDetails(key, n)
+	}
+
+	result, err := g.provisional.AllowNWithDetails(g.provisionalKey(key), n)
+	if err == nil && !result.Allowed {
+		// The full limit applies after graduation
+		if wait := graduation.Sub(now); wait < result.RetryAfter {
+			result.RetryAfter = wait
+		}
+	}
+	return result, err
+}
+
+// Graduated reports whether key has been seen for at least Period.
+func (g *Greylist) Graduated(key string) bool {
+	now := g.now()
+	state, ok := g.loadAt(key, now)
+	return ok && !now.Before(state.FirstSeen.Add(g.config.Period))
+}
+
+// Reset clears the state of key in both limiters. The key keeps its
+// graduation progress.
+func (g *Greylist) Reset(key string) error {
+	if err := g.provisional.Reset(g.provisionalKey(key)); err != nil {
+		return err
+	}
+	return g.full.Reset(key)
+}
+
+// touch records a request of key and returns the time it graduates. The
+// store is written for new keys, then at most once per Period to keep
+// active keys remembered.
+func (g *Greylist) touch(key string, now time.Time) (time.Time, error) {
+	state, ok := g.loadAt(key, now)
+	if !ok {
+		state = &greylistState{FirstSeen: now}
+	}
+	if !ok || now.Sub(state.LastSeen) >= g.config.Period {
+		state.LastSeen = now
+		var err error
+		if ts, isTimeAware := g.store.(store.TimeAwareStore); isTimeAware {
+			err = ts.SetAt(g.storeKey(key), state, g.config.Memory, now)
+		} else {
+			err = g.store.Set(g.storeKey(key), state, g.config.Memory)
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return state.FirstSeen.Add(g.config.Period), nil
+}
+
+// loadAt returns a copy of the state of key at now, and whether the key is
+// known.
+func (g *Greylist) loadAt(key string, now time.Time) (*greylistState, bool) {
+	var val interface{}
+	var ok bool
+	if ts, isTimeAware := g.store.(store.TimeAwareStore); isTimeAware {
+		val, ok = ts.GetAt(g.storeKey(key), now)
+	} else {
+		val, ok = g.store.Get(g.storeKey(key))
+	}
+	if !ok {
+		return nil, false
+	}
+	switch v := val.(type) {
+	case *greylistState:
+		// Copy: the store may hand out the stored pointer
+		state := *v
+		return &state, true
+	case []byte:
+		state := &greylistState{}
+		if err := decodeState(v, state); err == nil {
+			return state, true
+		}
+	}
+	return nil, false
+}
+
+func (g *Greylist) storeKey(key string) string {
+	return "gl:" + key
+}
+
+func (g *Greylist) provisionalKey(key string) string {
+	return "new:" + key
+}
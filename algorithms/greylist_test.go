@@ -0,0 +1,96 @@
+package algorithms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+func newTestGreylist(t *testing.T, config GreylistConfig) (*Greylist, *fakeClock) {
+	t.Helper()
+	s, clock := newTestEnv(t)
+	full := newTestTokenBucket(t, s, clock, 10, time.Hour)
+	provisional := newTestTokenBucket(t, s, clock, 2, time.Hour)
+	g := NewGreylist(full, provisional, s, config)
+	g.now = clock.Now
+	return g, clock
+}
+
+func countAllowed(t *testing.T, l ratelimiter.Limiter, key string, n int) int {
+	t.Helper()
+	allowed := 0
+	for range n {
+		ok, err := l.Allow(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestGreylist_Graduation(t *testing.T) {
+	g, clock := newTestGreylist(t, GreylistConfig{Period: 10 * time.Minute})
+
+	if got := countAllowed(t, g, "k", 5); got != 2 {
+		t.Errorf("new key: allowed %d, want 2", got)
+	}
+	if g.Graduated("k") {
+		t.Error("new key should not be graduated")
+	}
+
+	// RetryAfter does not extend past graduation.
+	r, _ := g.AllowNWithDetails("k", 1)
+	if r.RetryAfter != 10*time.Minute {
+		t.Errorf("RetryAfter = %v, want 10m", r.RetryAfter)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if !g.Graduated("k") {
+		t.Error("key should be graduated after Period")
+	}
+	if got := countAllowed(t, g, "k", 12); got != 10 {
+		t.Errorf("graduated key: allowed %d, want 10", got)
+	}
+}
+
+func TestGreylist_Memory(t *testing.T) {
+	g, clock := newTestGreylist(t, GreylistConfig{Period: time.Minute, Memory: time.Hour})
+
+	g.Allow("k")
+	clock.Advance(time.Minute)
+	g.Allow("k")
+	if !g.Graduated("k") {
+		t.Fatal("key should be graduated")
+	}
+
+	// Active keys stay remembered past Memory.
+	for range 3 {
+		clock.Advance(50 * time.Minute)
+		g.Allow("k")
+	}
+	if !g.Graduated("k") {
+		t.Error("active key should stay graduated")
+	}
+
+	// Idle keys are forgotten.
+	clock.Advance(2 * time.Hour)
+	if g.Graduated("k") {
+		t.Error("idle key should be forgotten")
+	}
+}
+
+func TestGreylist_Reset(t *testing.T) {
+	g, _ := newTestGreylist(t, GreylistConfig{})
+
+	countAllowed(t, g, "k", 3)
+	if err := g.Reset("k"); err != nil {
+		t.Fatal(err)
+	}
+	if got := countAllowed(t, g, "k", 3); got != 2 {
+		t.Errorf("allowed %d after Reset, want 2", got)
+	}
+}
@@ -0,0 +1,136 @@
+package algorithms
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// Option configures a limiter beyond its ratelimiter.Config: how it runs
+// rather than what it limits.
+type Option func(*options)
+
+// options holds the options of a limiter.
+type options struct {
+	now      func() time.Time
+	shards   int
+	stateTTL time.Duration
+	metrics  Metrics
+	ns       string
+	mismatch MismatchPolicy
+	scale    *ratelimiter.Scale
+	replica  bool
+
+	sketchEpsilon, sketchDelta float64 // CountMin accuracy
+}
+
+// Metrics receives the outcome of every check of a limiter, e.g. to export
+// counters and latency histograms. It is called synchronously and must not
+// block.
+type Metrics interface {
+	ObserveCheck(algorithm string, result ratelimiter.Result, latency time.Duration, err error)
+}
+
+// WithClock sets the function returning the current time, e.g. a fake clock
+// in tests. Default: time.Now
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithShardCount sets the number of key lock shards. More shards reduce
+// contention between unrelated keys on machines with many cores, fewer save
+// memory for limiters with few keys. Default: 256
+func WithShardCount(n int) Option {
+	return func(o *options) {
+		o.shards = n
+	}
+}
+
+// WithStateTTL sets how long the state of a key is kept after its last
+// request, overriding Config.StateTTL.
+func WithStateTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.stateTTL = ttl
+	}
+}
+
+// WithMetrics reports the outcome and latency of every check to m.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithNamespace isolates the state of the limiter in the store: limiters
+// sharing a store with different namespaces never share the state of a key,
+// even with the same algorithm. Store keys become "<ns>:tb:<key>" instead of
+// "tb:<key>" (and the namespace of namespaced stores "<ns>:tb" instead of
+// "tb"). The namespace cannot contain ':'. Default: none
+func WithNamespace(ns string) Option {
+	return func(o *options) {
+		o.ns = ns
+	}
+}
+
+// WithReplicaReads serves Remaining from the replicas of stores implementing
+// store.ReplicaReader, such as a RedisStore with a Replica client, to take
+// read-heavy polling (dashboards, quota endpoints) off the primary. Checks
+// always read and write the primary. Replicas lag behind it, so Remaining
+// may report requests that the primary has already counted as remaining.
+// Default: Remaining reads from the primary
+func WithReplicaReads() Option {
+	return func(o *options) {
+		o.replica = true
+	}
+}
+
+// validate checks the options that cannot be defaulted.
+func (o *options) validate() error {
+	if strings.Contains(o.ns, ":") {
+		return ratelimiter.ErrInvalidNamespace
+	}
+	return nil
+}
+
+// namespace returns the store namespace of an algorithm's state.
+func (o *options) namespace(algorithm string) string {
+	if o.ns == "" {
+		return algorithm
+	}
+	return o.ns + ":" + algorithm
+}
+
+// replicaOf returns the store serving Remaining: the replica of s with
+// WithReplicaReads, or nil.
+func (o *options) replicaOf(s store.Store) store.Store {
+	if !o.replica {
+		return nil
+	}
+	if rr, ok := s.(store.ReplicaReader); ok {
+		return rr.Replica()
+	}
+	return nil
+}
+
+// newOptions applies opts over the defaults.
+func newOptions(config *ratelimiter.Config, opts []Option) options {
+	o := options{now: time.Now, shards: shardCount, stateTTL: config.StateTTL, scale: ratelimiter.GlobalScale()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.now == nil {
+		o.now = time.Now
+	}
+	if o.scale == nil {
+		o.scale = ratelimiter.GlobalScale()
+	}
+	if o.shards <= 0 {
+		o.shards = shardCount
+	}
+	config.StateTTL = o.stateTTL
+	return o
+}
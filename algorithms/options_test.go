@@ -0,0 +1,280 @@
+package algorithms
+
+import (
+	"encoding"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// fakeClock is a clock advanced by hand.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// newTestEnv returns a MemoryStore closed at the end of the test and a fake
+// clock set to the start of 2025.
+func newTestEnv(t *testing.T) (*store.MemoryStore, *fakeClock) {
+	t.Helper()
+	s := store.NewMemoryStore()
+	t.Cleanup(func() { s.Close() })
+	return s, &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// newTestTokenBucket returns a token bucket on s and clock allowing bursts of
+// rate requests per window.
+func newTestTokenBucket(t *testing.T, s store.Store, clock *fakeClock, rate int, window time.Duration) *TokenBucket {
+	t.Helper()
+	tb, err := NewTokenBucket(ratelimiter.Config{Rate: rate, Window: window, BurstSize: rate}, s, WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+func TestWithClock(t *testing.T) {
+	config := ratelimiter.Config{Rate: 2, Window: time.Minute}
+	for _, tc := range []struct {
+		name string
+		new  func(store.Store, *fakeClock) (ratelimiter.Limiter, error)
+	}{
+		{"token bucket", func(s store.Store, c *fakeClock) (ratelimiter.Limiter, error) {
+			return NewTokenBucket(config, s, WithClock(c.Now))
+		}},
+		{"sliding window", func(s store.Store, c *fakeClock) (ratelimiter.Limiter, error) {
+			return NewSlidingWindow(config, s, WithClock(c.Now))
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			defer s.Close()
+			clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+			l, err := tc.new(s, clock)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if ok, _ := l.Allow("k"); !ok {
+					t.Fatalf("Request %d: expected to be allowed", i)
+				}
+			}
+			if ok, _ := l.Allow("k"); ok {
+				t.Fatal("Expected the limit to be reached")
+			}
+
+			// Two windows later the limit is fully restored, without sleeping
+			clock.Advance(2 * time.Minute)
+			if ok, _ := l.Allow("k"); !ok {
+				t.Error("Expected the fake clock to restore the limit")
+			}
+		})
+	}
+}
+
+func TestWithShardCount(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, err := NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s, WithShardCount(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tb.mu) != 4 {
+		t.Errorf("Expected 4 shards, got %d", len(tb.mu))
+	}
+	if ok, _ := tb.Allow("k"); !ok {
+		t.Error("Expected the first request to be allowed")
+	}
+
+	sw, err := NewSlidingWindow(ratelimiter.Config{Rate: 1, Window: time.Minute}, s, WithShardCount(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sw.mu) != shardCount {
+		t.Errorf("Expected the default shard count, got %d", len(sw.mu))
+	}
+}
+
+func TestWithStateTTL(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, err := NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s, WithStateTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tb.ttl != time.Hour || tb.Config().StateTTL != time.Hour {
+		t.Errorf("Expected a one-hour TTL, got %v (config %v)", tb.ttl, tb.Config().StateTTL)
+	}
+
+	if _, err := NewSlidingWindow(ratelimiter.Config{Rate: 1, Window: time.Minute}, s, WithStateTTL(-time.Second)); !errors.Is(err, ratelimiter.ErrInvalidStateTTL) {
+		t.Errorf("Expected ErrInvalidStateTTL, got %v", err)
+	}
+}
+
+// recordingMetrics records the checks it observes.
+type recordingMetrics struct {
+	mu      sync.Mutex
+	allowed map[string]int
+	denied  map[string]int
+}
+
+func (m *recordingMetrics) ObserveCheck(algorithm string, result ratelimiter.Result, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if result.Allowed {
+		m.allowed[algorithm]++
+	} else {
+		m.denied[algorithm]++
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	m := &recordingMetrics{allowed: map[string]int{}, denied: map[string]int{}}
+	config := ratelimiter.Config{Rate: 1, Window: time.Minute}
+	tb, _ := NewTokenBucket(config, s, WithMetrics(m))
+	sw, _ := NewSlidingWindow(config, s, WithMetrics(m))
+
+	for i := 0; i < 3; i++ {
+		tb.Allow("k")
+		sw.Allow("k")
+	}
+
+	if m.allowed[TokenBucketName] != 1 || m.denied[TokenBucketName] != 2 {
+		t.Errorf("Unexpected token bucket metrics: %v allowed, %v denied", m.allowed, m.denied)
+	}
+	if m.allowed[SlidingWindowName] != 1 || m.denied[SlidingWindowName] != 2 {
+		t.Errorf("Unexpected sliding window metrics: %v allowed, %v denied", m.allowed, m.denied)
+	}
+}
+
+func TestWithNamespace(t *testing.T) {
+	memory := store.NewMemoryStore()
+	defer memory.Close()
+	encoding := newEncodingStore(store.BinaryCodec)
+
+	for name, s := range map[string]store.Store{"namespaced store": memory, "plain store": encoding} {
+		t.Run(name, func(t *testing.T) {
+			config := ratelimiter.Config{Rate: 1, Window: time.Minute}
+			login, err := NewTokenBucket(config, s, WithNamespace("login"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			search, err := NewTokenBucket(config, s, WithNamespace("search"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ok, _ := login.Allow("k"); !ok {
+				t.Fatal("Expected the first login request to be allowed")
+			}
+			if ok, _ := search.Allow("k"); !ok {
+				t.Error("Expected limiters with different namespaces not to share state")
+			}
+			if ok, _ := login.Allow("k"); ok {
+				t.Error("Expected the login limit to be reached")
+			}
+		})
+	}
+
+	if _, ok := encoding.data["login:tb:k"]; !ok {
+		t.Errorf("Expected the store key to include the namespace, got %v", encoding.data)
+	}
+	if _, err := NewSlidingWindow(ratelimiter.Config{Rate: 1, Window: time.Minute}, memory, WithNamespace("a:b")); !errors.Is(err, ratelimiter.ErrInvalidNamespace) {
+		t.Errorf("Expected ErrInvalidNamespace, got %v", err)
+	}
+}
+
+// laggingStore is a store whose replica has not received any write yet.
+type laggingStore struct {
+	*store.MemoryStore
+	replica *store.MemoryStore
+}
+
+func (s *laggingStore) Replica() store.Store {
+	return s.replica
+}
+
+func TestWithReplicaReads(t *testing.T) {
+	type limiter interface {
+		Allow(key string) (bool, error)
+		Remaining(key string) int
+	}
+	config := ratelimiter.Config{Rate: 2, Window: time.Minute}
+	for _, tc := range []struct {
+		name string
+		ns   string // Store namespace of the state
+		new  func(store.Store, ...Option) (limiter, error)
+	}{
+		{"token bucket", "tb", func(s store.Store, opts ...Option) (limiter, error) {
+			return NewTokenBucket(config, s, opts...)
+		}},
+		{"sliding window", "sw", func(s store.Store, opts ...Option) (limiter, error) {
+			return NewSlidingWindow(config, s, opts...)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			primary, _ := newTestEnv(t)
+			replica, _ := newTestEnv(t)
+			s := &laggingStore{MemoryStore: primary, replica: replica}
+
+			l, err := tc.new(s, WithReplicaReads())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := l.Allow("k"); !ok {
+				t.Fatal("Expected the first request to be allowed")
+			}
+			if _, ok := replica.GetWithNamespace(tc.ns, "k"); ok {
+				t.Fatal("Expected checks to write to the primary only")
+			}
+			if got := l.Remaining("k"); got != 2 {
+				t.Errorf("Expected Remaining from the lagging replica, got %d", got)
+			}
+
+			// Once replicated, the replica reports the request, read through
+			// the namespaced path like the primary
+			val, _ := primary.GetWithNamespace(tc.ns, "k")
+			b, err := val.(encoding.BinaryMarshaler).MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = replica.SetWithNamespace(tc.ns, "k", b, time.Minute)
+			if got := l.Remaining("k"); got != 1 {
+				t.Errorf("Expected Remaining from the replica, got %d", got)
+			}
+
+			l, err = tc.new(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := l.Allow("k"); !ok {
+				t.Fatal("Expected the second request to be allowed")
+			}
+			if got := l.Remaining("k"); got != 0 {
+				t.Errorf("Expected Remaining from the primary without the option, got %d", got)
+			}
+		})
+	}
+}
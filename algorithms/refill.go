@@ -0,0 +1,75 @@
+package algorithms
+
+import (
+	"math"
+	"time"
+)
+
+// Token bucket refill models: continuous (the default), stepped
+// (Config.RefillInterval) and scheduled (Config.RefillSchedule).
+
+// refill adds the tokens earned since state.LastRefill, up to capacity.
+func (tb *TokenBucket) refill(state *tokenBucketState, capacity float64, now time.Time) {
+	switch {
+	case tb.config.RefillSchedule != nil:
+		// Stop counting refills once the bucket is full, so a long idle key
+		// does not walk through every refill it missed
+		next := tb.config.RefillSchedule.Next
+		for t := next(state.LastRefill); !t.IsZero() && !t.After(now) && state.Tokens < capacity; t = next(t) {
+			state.Tokens += float64(tb.config.Rate)
+		}
+	case tb.config.RefillInterval > 0:
+		if steps := tb.step(now) - tb.step(state.LastRefill); steps > 0 {
+			state.Tokens += float64(steps) * tb.stepTokens
+		}
+	default:
+		// Optimization: Use multiplication instead of Duration.Seconds() which involves division
+		state.Tokens += float64(now.Sub(state.LastRefill)) * tb.tokensPerNano
+	}
+
+	if state.Tokens > capacity {
+		state.Tokens = capacity
+	}
+	state.LastRefill = now
+}
+
+// step returns the index of the refill step t is in. Steps are aligned to
+// the Unix epoch so that every key refills at the same times.
+func (tb *TokenBucket) step(t time.Time) int64 {
+	return t.UnixNano() / int64(tb.config.RefillInterval)
+}
+
+// refillWait returns how long until tokens more tokens have been added.
+func (tb *TokenBucket) refillWait(tokens float64, now time.Time) time.Duration {
+	switch {
+	case tb.config.RefillSchedule != nil:
+		t := now
+		for added := 0.0; added < tokens; added += float64(tb.config.Rate) {
+			if t = tb.config.RefillSchedule.Next(t); t.IsZero() {
+				// The schedule has no more refills
+				return 0
+			}
+		}
+		return t.Sub(now)
+	case tb.config.RefillInterval > 0:
+		steps := int64(math.Ceil(tokens / tb.stepTokens))
+		next := time.Unix(0, (tb.step(now)+steps)*int64(tb.config.RefillInterval))
+		return next.Sub(now)
+	default:
+		return time.Duration(tokens / tb.tokensPerNano)
+	}
+}
+
+// resetAt returns the ResetAt of a result: the next refill for stepped and
+// scheduled refill, one window from now for continuous refill.
+func (tb *TokenBucket) resetAt(now time.Time) time.Time {
+	switch {
+	case tb.config.RefillSchedule != nil:
+		if next := tb.config.RefillSchedule.Next(now); !next.IsZero() {
+			return next
+		}
+	case tb.config.RefillInterval > 0:
+		return time.Unix(0, (tb.step(now)+1)*int64(tb.config.RefillInterval))
+	}
+	return now.Add(tb.config.Window)
+}
@@ -0,0 +1,124 @@
+package algorithms
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestTokenBucket_SteppedRefill(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	// 60 per hour, refilled 10 at a time every 10 minutes
+	tb, err := NewTokenBucket(ratelimiter.Config{
+		Rate:           60,
+		Window:         time.Hour,
+		BurstSize:      20,
+		RefillInterval: 10 * time.Minute,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	start := time.Date(2025, 1, 1, 12, 1, 0, 0, time.UTC)
+	state := &tokenBucketState{Tokens: 20, LastRefill: start}
+	if r := tb.take(state, 20, start); !r.Allowed {
+		t.Fatal("Expected the full burst to be allowed")
+	}
+
+	// No tokens are added within a step
+	r := tb.take(state, 1, start.Add(8*time.Minute))
+	if r.Allowed {
+		t.Fatal("Expected no refill before the next step")
+	}
+	if want := time.Minute; r.RetryAfter != want {
+		t.Errorf("Expected RetryAfter=%v (next step at 12:10), got %v", want, r.RetryAfter)
+	}
+	if want := start.Add(9 * time.Minute); !r.ResetAt.Equal(want) {
+		t.Errorf("Expected ResetAt=%v, got %v", want, r.ResetAt)
+	}
+
+	// The whole step is added at once at 12:10
+	r = tb.take(state, 10, start.Add(9*time.Minute))
+	if !r.Allowed || r.Remaining != 0 {
+		t.Errorf("Expected 10 tokens at the step, got allowed=%v remaining=%d", r.Allowed, r.Remaining)
+	}
+
+	// Two steps are needed for 15 tokens
+	r = tb.take(state, 15, start.Add(9*time.Minute))
+	if want := 20 * time.Minute; r.Allowed || r.RetryAfter != want {
+		t.Errorf("Expected denial with RetryAfter=%v, got allowed=%v retryAfter=%v", want, r.Allowed, r.RetryAfter)
+	}
+
+	// Refills are capped to the burst size
+	r = tb.take(state, 1, start.Add(5*time.Hour))
+	if !r.Allowed || r.Remaining != 19 {
+		t.Errorf("Expected remaining=19 after a long idle time, got %d", r.Remaining)
+	}
+}
+
+func TestTokenBucket_ScheduledRefill(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	schedule, err := ratelimiter.ParseCron("0 * * * *")
+	if err != nil {
+		t.Fatalf("ParseCron: %v", err)
+	}
+	tb, err := NewTokenBucket(ratelimiter.Config{
+		Rate:           100,
+		Window:         time.Hour,
+		RefillSchedule: schedule,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	start := time.Date(2025, 1, 1, 12, 15, 0, 0, time.UTC)
+	state := &tokenBucketState{Tokens: 100, LastRefill: start}
+	if r := tb.take(state, 100, start); !r.Allowed {
+		t.Fatal("Expected the full quota to be allowed")
+	}
+
+	r := tb.take(state, 1, start.Add(44*time.Minute))
+	if r.Allowed {
+		t.Fatal("Expected no refill before the top of the hour")
+	}
+	if want := time.Minute; r.RetryAfter != want {
+		t.Errorf("Expected RetryAfter=%v, got %v", want, r.RetryAfter)
+	}
+	if want := time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC); !r.ResetAt.Equal(want) {
+		t.Errorf("Expected ResetAt=%v, got %v", want, r.ResetAt)
+	}
+
+	// The quota is refilled at 13:00
+	r = tb.take(state, 1, start.Add(45*time.Minute))
+	if !r.Allowed || r.Remaining != 99 {
+		t.Errorf("Expected a refilled quota, got allowed=%v remaining=%d", r.Allowed, r.Remaining)
+	}
+
+	// A key idle for a year is only refilled up to its burst size
+	r = tb.take(state, 1, start.AddDate(1, 0, 0))
+	if !r.Allowed || r.Remaining != 99 {
+		t.Errorf("Expected remaining=99 after a long idle time, got %d", r.Remaining)
+	}
+}
+
+func TestTokenBucket_RefillValidation(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	schedule, _ := ratelimiter.ParseCron("@hourly")
+	for _, config := range []ratelimiter.Config{
+		{Rate: 10, Window: time.Minute, RefillInterval: -time.Second},
+		{Rate: 10, Window: time.Minute, RefillInterval: time.Second, RefillSchedule: schedule},
+	} {
+		if _, err := NewTokenBucket(config, s); !errors.Is(err, ratelimiter.ErrInvalidRefill) {
+			t.Errorf("Expected ErrInvalidRefill for %+v, got %v", config, err)
+		}
+	}
+}
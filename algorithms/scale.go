@@ -0,0 +1,13 @@
+package algorithms
+
+import "github.com/Morditux/ratelimiter"
+
+// WithScale makes the limiter follow s instead of the process-wide scale
+// (see ratelimiter.SetGlobalScale), e.g. to scale a group of limiters
+// together, or to opt a limiter out of scaling with a Scale that is never
+// changed. Only TokenBucket and SlidingWindow are scaled.
+func WithScale(s *ratelimiter.Scale) Option {
+	return func(o *options) {
+		o.scale = s
+	}
+}
@@ -0,0 +1,79 @@
+package algorithms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// allowed returns how many of count requests for key l allows.
+func allowed(l ratelimiter.Limiter, key string, count int) int {
+	n := 0
+	for i := 0; i < count; i++ {
+		if ok, _ := l.Allow(key); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWithScale(t *testing.T) {
+	config := ratelimiter.Config{Rate: 10, Window: time.Hour}
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	scale := ratelimiter.NewScale(0.5)
+	tb, _ := NewTokenBucket(config, store.NewMemoryStore(), WithClock(clock.Now), WithScale(scale))
+	sw, _ := NewSlidingWindow(config, store.NewMemoryStore(), WithClock(clock.Now), WithScale(scale))
+
+	for _, l := range []ratelimiter.LimiterWithDetails{tb, sw} {
+		name := l.(ratelimiter.DescribableLimiter).Algorithm()
+		scale.Set(0.5)
+
+		result, _ := l.AllowNWithDetails("key", 1)
+		if result.Limit != 5 || result.Remaining != 4 {
+			t.Errorf("%s: Limit = %d, Remaining = %d, want the halved limit of 5", name, result.Limit, result.Remaining)
+		}
+		if got := allowed(l, "key", 10); got != 4 {
+			t.Errorf("%s: %d more requests allowed, want 4", name, got)
+		}
+		if _, err := l.AllowNWithDetails("other", 6); err != ratelimiter.ErrCostExceedsCapacity {
+			t.Errorf("%s: expected ErrCostExceedsCapacity over the halved limit, got %v", name, err)
+		}
+
+		// Loosening the scale applies to the next check, with the state
+		// counted so far: the bucket stays empty, the window has room for
+		// the other 5 requests
+		scale.Set(1)
+		want := map[string]int{TokenBucketName: 0, SlidingWindowName: 5}[name]
+		if got := allowed(l, "key", 10); got != want {
+			t.Errorf("%s: %d requests allowed after restoring the scale, want %d", name, got, want)
+		}
+		if err := l.Reset("key"); err != nil {
+			t.Fatal(err)
+		}
+
+		// A tiny scale still leaves 1 request
+		scale.Set(0.001)
+		if got := allowed(l, "key", 3); got != 1 {
+			t.Errorf("%s: %d requests allowed with a tiny scale, want 1", name, got)
+		}
+	}
+}
+
+func TestGlobalScale(t *testing.T) {
+	defer ratelimiter.SetGlobalScale(1)
+
+	config := ratelimiter.Config{Rate: 10, Window: time.Hour}
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tb, _ := NewTokenBucket(config, store.NewMemoryStore(), WithClock(clock.Now))
+	optOut, _ := NewTokenBucket(config, store.NewMemoryStore(), WithClock(clock.Now), WithScale(&ratelimiter.Scale{}))
+
+	ratelimiter.SetGlobalScale(0.2)
+	if got := allowed(tb, "key", 10); got != 2 {
+		t.Errorf("%d requests allowed, want 2 with a global scale of 0.2", got)
+	}
+	if got := allowed(optOut, "key", 10); got != 10 {
+		t.Errorf("%d requests allowed by a limiter with its own scale, want 10", got)
+	}
+}
@@ -0,0 +1,209 @@
+package algorithms
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// Profile is a limit that applies during the minutes matched by a cron
+// expression.
+type Profile struct {
+	// Name identifies the profile, e.g. "business-hours" (see
+	// Scheduled.Active).
+	Name string
+
+	// When is a cron expression (see ratelimiter.ParseCron) matching the
+	// minutes during which the profile applies, e.g. "* 9-17 * * 1-5" for
+	// 9:00 to 17:59 on weekdays.
+	When string
+
+	// Config is the limit of the profile.
+	Config ratelimiter.Config
+}
+
+// ScheduledConfig configures a Scheduled limiter.
+type ScheduledConfig struct {
+	// Algorithm is TokenBucketName or SlidingWindowName.
+	// Default: TokenBucketName.
+	Algorithm string
+
+	// Default is the limit applying when no profile does.
+	Default ratelimiter.Config
+
+	// Profiles override Default when their When expression matches. The
+	// first matching profile applies.
+	Profiles []Profile
+
+	// Location is the time zone in which When expressions are evaluated.
+	// Default: time.Local.
+	Location *time.Location
+}
+
+// Scheduled switches between limits by time of day and day of week, e.g.
+// stricter limits during business hours and relaxed ones at night:
+//
+//	limiter, _ := algorithms.NewScheduled(algorithms.ScheduledConfig{
+//		Default: ratelimiter.Config{Rate: 1000, Window: time.Minute},
+//		Profiles: []algorithms.Profile{
+//			{Name: "business-hours", When: "* 9-17 * * 1-5", Config: ratelimiter.Config{Rate: 100, Window: time.Minute}},
+//		},
+//	}, s)
+//
+// All profiles share the state of a key, so a transition does not start
+// keys over: the state is adopted by the new limit (see MismatchAdopt),
+// e.g. a token bucket keeps its tokens up to the new burst size. Profiles
+// are evaluated at most once per minute, the resolution of cron expressions.
+type Scheduled struct {
+	limiters  []ratelimiter.LimiterWithDetails // One per profile, then the default
+	configs   []ratelimiter.Config
+	names     []string
+	schedules []ratelimiter.Schedule
+	algorithm string
+	location  *time.Location
+	now       func() time.Time
+
+	// mu keeps checks of different profiles from running at once around a
+	// transition, since their limiters do not share key locks
+	mu     sync.RWMutex
+	active int       // Index of the active limiter
+	until  time.Time // End of the minute for which active was evaluated
+}
+
+// NewScheduled creates a scheduled limiter keeping its state in s. Options
+// apply to the limiter of every profile, except WithMismatchPolicy: profiles
+// always adopt each other's state.
+func NewScheduled(config ScheduledConfig, s store.Store, opts ...Option) (*Scheduled, error) {
+	if config.Algorithm == "" {
+		config.Algorithm = TokenBucketName
+	}
+	if config.Location == nil {
+		config.Location = time.Local
+	}
+
+	sc := &Scheduled{
+		algorithm: config.Algorithm,
+		location:  config.Location,
+		now:       newOptions(&ratelimiter.Config{}, opts).now,
+	}
+	opts = append(opts[:len(opts):len(opts)], WithMismatchPolicy(MismatchAdopt))
+
+	add := func(name string, c ratelimiter.Config) error {
+		var l ratelimiter.LimiterWithDetails
+		var err error
+		switch config.Algorithm {
+		case TokenBucketName:
+			l, err = NewTokenBucket(c, s, opts...)
+		case SlidingWindowName:
+			l, err = NewSlidingWindow(c, s, opts...)
+		default:
+			return fmt.Errorf("ratelimiter: unknown algorithm %q", config.Algorithm)
+		}
+		if err != nil {
+			return err
+		}
+		sc.limiters = append(sc.limiters, l)
+		sc.configs = append(sc.configs, l.(ratelimiter.DescribableLimiter).Config())
+		sc.names = append(sc.names, name)
+		return nil
+	}
+
+	for _, p := range config.Profiles {
+		schedule, err := ratelimiter.ParseCron(p.When)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(p.Name, p.Config); err != nil {
+			return nil, err
+		}
+		sc.schedules = append(sc.schedules, schedule)
+	}
+	if err := add("default", config.Default); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// Allow checks if a single request is allowed.
+func (sc *Scheduled) Allow(key string) (bool, error) {
+	return sc.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed.
+func (sc *Scheduled) AllowN(key string, n int) (bool, error) {
+	result, err := sc.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n requests are allowed by the active limit.
+func (sc *Scheduled) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	i := sc.rlock()
+	defer sc.mu.RUnlock()
+	return sc.limiters[i].AllowNWithDetails(key, n)
+}
+
+// Reset clears the rate limit state for the given key.
+func (sc *Scheduled) Reset(key string) error {
+	i := sc.rlock()
+	defer sc.mu.RUnlock()
+	return sc.limiters[i].Reset(key)
+}
+
+// Active returns the name of the active profile, or "default".
+func (sc *Scheduled) Active() string {
+	i := sc.rlock()
+	defer sc.mu.RUnlock()
+	return sc.names[i]
+}
+
+// Config returns the effective configuration of the active limit.
+func (sc *Scheduled) Config() ratelimiter.Config {
+	i := sc.rlock()
+	defer sc.mu.RUnlock()
+	return sc.configs[i]
+}
+
+// Algorithm returns the name of the algorithm.
+func (sc *Scheduled) Algorithm() string {
+	return sc.algorithm
+}
+
+// rlock read-locks sc and returns the index of the active limiter,
+// evaluating the profiles again if the minute has changed.
+func (sc *Scheduled) rlock() int {
+	now := sc.now()
+	sc.mu.RLock()
+	if now.Before(sc.until) {
+		return sc.active
+	}
+	sc.mu.RUnlock()
+
+	sc.mu.Lock()
+	if !now.Before(sc.until) {
+		sc.active = sc.evaluate(now)
+		sc.until = now.Truncate(time.Minute).Add(time.Minute)
+	}
+	sc.mu.Unlock()
+
+	// A check may run a little past the minute it was evaluated for;
+	// re-evaluating for every check around a transition would cost more
+	// than it is worth
+	sc.mu.RLock()
+	return sc.active
+}
+
+// evaluate returns the index of the limiter applying at now.
+func (sc *Scheduled) evaluate(now time.Time) int {
+	minute := now.In(sc.location).Truncate(time.Minute)
+	for i, schedule := range sc.schedules {
+		// Next is strictly after its argument: the minute matches if it is
+		// the next match from just before it
+		if schedule.Next(minute.Add(-time.Nanosecond)).Equal(minute) {
+			return i
+		}
+	}
+	return len(sc.limiters) - 1
+}
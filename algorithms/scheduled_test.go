@@ -0,0 +1,97 @@
+package algorithms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func newTestScheduled(t *testing.T, algorithm string) (*Scheduled, *fakeClock) {
+	t.Helper()
+	s, clock := newTestEnv(t)
+	// Wednesday, 8:59
+	clock.Advance(8*time.Hour + 59*time.Minute)
+	sc, err := NewScheduled(ScheduledConfig{
+		Algorithm: algorithm,
+		Default:   ratelimiter.Config{Rate: 10, Window: time.Hour},
+		Profiles: []Profile{
+			{Name: "business-hours", When: "* 9-17 * * 1-5", Config: ratelimiter.Config{Rate: 2, Window: time.Hour}},
+		},
+		Location: time.UTC,
+	}, s, WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sc, clock
+}
+
+func TestScheduled_SwitchesProfiles(t *testing.T) {
+	for _, algorithm := range []string{TokenBucketName, SlidingWindowName} {
+		sc, clock := newTestScheduled(t, algorithm)
+		if got := sc.Active(); got != "default" {
+			t.Errorf("%s: Active = %q before 9:00, want default", algorithm, got)
+		}
+		if got := sc.Config().Rate; got != 10 {
+			t.Errorf("%s: Rate = %d, want 10", algorithm, got)
+		}
+
+		clock.Advance(time.Minute)
+		if got := sc.Active(); got != "business-hours" {
+			t.Errorf("%s: Active = %q at 9:00, want business-hours", algorithm, got)
+		}
+		for i := 0; i < 2; i++ {
+			if allowed, _ := sc.Allow("key"); !allowed {
+				t.Errorf("%s: request %d should be allowed", algorithm, i+1)
+			}
+		}
+		if allowed, _ := sc.Allow("key"); allowed {
+			t.Errorf("%s: request over the business-hours limit should be denied", algorithm)
+		}
+
+		// 18:00 is outside the profile
+		clock.Advance(9 * time.Hour)
+		if got := sc.Active(); got != "default" {
+			t.Errorf("%s: Active = %q at 18:00, want default", algorithm, got)
+		}
+	}
+}
+
+func TestScheduled_KeepsStateAcrossTransitions(t *testing.T) {
+	for _, algorithm := range []string{TokenBucketName, SlidingWindowName} {
+		sc, clock := newTestScheduled(t, algorithm)
+		for i := 0; i < 9; i++ {
+			if allowed, _ := sc.Allow("key"); !allowed {
+				t.Fatalf("%s: request %d should be allowed", algorithm, i+1)
+			}
+		}
+
+		// At 9:00 the key has 1 token left in the bucket and 9 requests in
+		// the window: the transition must not start it over
+		clock.Advance(time.Minute)
+		allowed := 0
+		for i := 0; i < 2; i++ {
+			if ok, _ := sc.Allow("key"); ok {
+				allowed++
+			}
+		}
+		want := map[string]int{TokenBucketName: 1, SlidingWindowName: 0}[algorithm]
+		if allowed != want {
+			t.Errorf("%s: %d requests allowed after the transition, want %d", algorithm, allowed, want)
+		}
+	}
+}
+
+func TestScheduled_Errors(t *testing.T) {
+	config := ratelimiter.Config{Rate: 10, Window: time.Minute}
+	if _, err := NewScheduled(ScheduledConfig{
+		Default:  config,
+		Profiles: []Profile{{Name: "bad", When: "* 25 * * *", Config: config}},
+	}, store.NewMemoryStore()); err == nil {
+		t.Error("Expected an error for an invalid cron expression")
+	}
+	if _, err := NewScheduled(ScheduledConfig{Algorithm: "unknown", Default: config}, store.NewMemoryStore()); err == nil {
+		t.Error("Expected an error for an unknown algorithm")
+	}
+}
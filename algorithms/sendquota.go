@@ -0,0 +1,119 @@
+package algorithms
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// SendQuotaConfig configures a SendQuota.
+type SendQuotaConfig struct {
+	// Quota is the number of messages allowed per Period. Required.
+	Quota int
+
+	// Period is the period of the quota.
+	// Default: 24 hours.
+	Period time.Duration
+
+	// Rate is the number of messages allowed per second, smoothing the
+	// sends within the quota. Required.
+	Rate int
+
+	// Burst is the number of messages that can be sent at once.
+	// Default: Rate.
+	Burst int
+}
+
+// SendQuota is a preset for outbound email or SMS sending, where a long
+// quota (e.g. 10,000 messages a day) and a short-term rate (e.g. 10 per
+// second) must hold at once: a message is allowed only if both allow it.
+// The quota is a sliding window over Period, the rate a token bucket.
+//
+//	quota, _ := algorithms.NewSendQuota(algorithms.SendQuotaConfig{Quota: 10000, Rate: 10}, s)
+//	allowed, err := quota.Allow(account + ":" + algorithms.RecipientDomain(to))
+//
+// A message denied by the quota does not consume the rate, and the
+// reverse. Both limits keep their state in s under their own prefix.
+type SendQuota struct {
+	quota *SlidingWindow
+	rate  *TokenBucket
+}
+
+// NewSendQuota creates a sending quota. Options apply to both limits.
+func NewSendQuota(config SendQuotaConfig, s store.Store, opts ...Option) (*SendQuota, error) {
+	if config.Quota <= 0 || config.Rate <= 0 {
+		return nil, ratelimiter.ErrInvalidRate
+	}
+	if config.Period <= 0 {
+		config.Period = 24 * time.Hour
+	}
+	if config.Burst <= 0 {
+		config.Burst = config.Rate
+	}
+
+	quota, err := NewSlidingWindow(ratelimiter.Config{Rate: config.Quota, Window: config.Period}, s, opts...)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := NewTokenBucket(ratelimiter.Config{Rate: config.Rate, Window: time.Second, BurstSize: config.Burst}, s, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SendQuota{quota: quota, rate: rate}, nil
+}
+
+// Allow checks if a single message is allowed.
+func (q *SendQuota) Allow(key string) (bool, error) {
+	return q.AllowN(key, 1)
+}
+
+// AllowN checks if n messages are allowed.
+func (q *SendQuota) AllowN(key string, n int) (bool, error) {
+	result, err := q.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n messages are allowed by the rate and the
+// quota. A denial reports the result of the limit that denied the messages;
+// otherwise the result of the quota is returned.
+func (q *SendQuota) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	result, err := q.rate.AllowNWithDetails(key, n)
+	if err != nil || !result.Allowed {
+		return result, err
+	}
+	quota, err := q.quota.AllowNWithDetails(key, n)
+	if err != nil || !quota.Allowed {
+		_ = q.rate.RefundN(key, n)
+	}
+	return quota, err
+}
+
+// RefundN returns n previously allowed messages to the rate and the quota,
+// e.g. for messages that bounced before being accepted by the provider.
+func (q *SendQuota) RefundN(key string, n int) error {
+	return errors.Join(q.rate.RefundN(key, n), q.quota.RefundN(key, n))
+}
+
+// Reset clears the state of both limits for key.
+func (q *SendQuota) Reset(key string) error {
+	return errors.Join(q.rate.Reset(key), q.quota.Reset(key))
+}
+
+// RecipientDomain returns the lowercased domain of an email address, with
+// or without a display name ("Ann <ann@Example.com>" gives "example.com"),
+// to key limits by recipient domain. It returns "" for invalid addresses.
+func RecipientDomain(address string) string {
+	addr, err := mail.ParseAddress(address)
+	if err != nil {
+		return ""
+	}
+	at := strings.LastIndexByte(addr.Address, '@')
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(addr.Address[at+1:])
+}
@@ -0,0 +1,77 @@
+package algorithms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestSendQuota(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	quota, err := NewSendQuota(SendQuotaConfig{Quota: 5, Rate: 2}, s, WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rate allows 2 messages at once
+	for i, want := range []bool{true, true, false} {
+		if allowed, _ := quota.Allow("acme"); allowed != want {
+			t.Errorf("message %d: allowed = %v, want %v", i, allowed, want)
+		}
+	}
+
+	// Smoothed sends stop at the daily quota
+	sent := 2
+	for i := 0; i < 10; i++ {
+		clock.Advance(time.Second)
+		if allowed, _ := quota.Allow("acme"); allowed {
+			sent++
+		}
+	}
+	if sent != 5 {
+		t.Errorf("sent %d messages, want the quota of 5", sent)
+	}
+
+	result, _ := quota.AllowNWithDetails("acme", 1)
+	if result.Allowed || result.Limit != 5 || result.RetryAfter < time.Hour {
+		t.Errorf("result = %+v, want a quota denial", result)
+	}
+
+	// Denials by the quota do not consume the rate
+	if err := quota.quota.Reset("acme"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if allowed, _ := quota.Allow("acme"); !allowed {
+			t.Errorf("message %d after the quota reset should be allowed", i)
+		}
+	}
+}
+
+func TestSendQuota_Invalid(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	for _, config := range []SendQuotaConfig{{Quota: 100}, {Rate: 1}} {
+		if _, err := NewSendQuota(config, s); err != ratelimiter.ErrInvalidRate {
+			t.Errorf("%+v: err = %v, want ErrInvalidRate", config, err)
+		}
+	}
+}
+
+func TestRecipientDomain(t *testing.T) {
+	for address, want := range map[string]string{
+		"ann@Example.COM":              "example.com",
+		"Ann Smith <ann@mail.example>": "mail.example",
+		`"odd@name"@example.org`:       "example.org",
+		"not an address":               "",
+		"":                             "",
+	} {
+		if got := RecipientDomain(address); got != want {
+			t.Errorf("RecipientDomain(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package algorithms
+
+import (
+	"sync/atomic"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// ShadowConfig configures a Shadow.
+type ShadowConfig struct {
+	// OnDivergence, when set, is called when the shadow limiter decides
+	// differently from the primary one, e.g. to log the keys a migration
+	// would affect. It is called on the request path and must not block.
+	OnDivergence func(key string, primary, shadow ratelimiter.Result)
+}
+
+// ShadowStats counts the decisions compared by a Shadow.
+type ShadowStats struct {
+	Decisions     uint64 `json:"decisions"`      // Decisions of both limiters
+	ShadowDenied  uint64 `json:"shadow_denied"`  // Allowed by the primary, denied by the shadow
+	ShadowAllowed uint64 `json:"shadow_allowed"` // Denied by the primary, allowed by the shadow
+	ShadowErrors  uint64 `json:"shadow_errors"`  // Checks the shadow limiter failed
+}
+
+// Divergent returns the number of decisions on which the limiters disagreed.
+func (s ShadowStats) Divergent() uint64 {
+	return s.ShadowDenied + s.ShadowAllowed
+}
+
+// DivergenceRate returns the fraction of decisions on which the limiters
+// disagreed.
+func (s ShadowStats) DivergenceRate() float64 {
+	if s.Decisions == 0 {
+		return 0
+	}
+	return float64(s.Divergent()) / float64(s.Decisions)
+}
+
+// Shadow evaluates two limiters side by side: the primary one decides, the
+// shadow one is checked with the same key and cost and only compared, so a
+// migration to another algorithm or limit can be validated on live traffic
+// before it is enforced:
+//
+//	current, _ := algorithms.NewTokenBucket(config, s)
+//	candidate, _ := algorithms.NewSlidingWindow(config, s)
+//	limiter := algorithms.NewShadow(current, candidate, algorithms.ShadowConfig{})
+//
+// The shadow limiter is checked on the request path after the primary one;
+// its errors are counted and never returned. Limiters of the same algorithm
+// sharing a store must use different namespaces (see WithNamespace).
+type Shadow struct {
+	primary ratelimiter.LimiterWithDetails
+	shadow  ratelimiter.LimiterWithDetails
+	config  ShadowConfig
+
+	decisions     atomic.Uint64
+	shadowDenied  atomic.Uint64
+	shadowAllowed atomic.Uint64
+	shadowErrors  atomic.Uint64
+}
+
+// NewShadow wraps primary with a shadow limiter.
+func NewShadow(primary, shadow ratelimiter.Limiter, config ShadowConfig) *Shadow {
+	return &Shadow{
+		primary: ratelimiter.WithDetails(primary),
+		shadow:  ratelimiter.WithDetails(shadow),
+		config:  config,
+	}
+}
+
+// Allow checks if a single request is allowed.
+func (s *Shadow) Allow(key string) (bool, error) {
+	return s.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed.
+func (s *Shadow) AllowN(key string, n int) (bool, error) {
+	result, err := s.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n requests are allowed by the primary limiter,
+// and compares its decision with the shadow limiter's.
+func (s *Shadow) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	result, err := s.primary.AllowNWithDetails(key, n)
+	if err != nil {
+		// Nothing to compare with
+		return result, err
+	}
+
+	shadow, shadowErr := s.shadow.AllowNWithDetails(key, n)
+	if shadowErr != nil {
+		s.shadowErrors.Add(1)
+		return result, nil
+	}
+
+	s.decisions.Add(1)
+	if result.Allowed == shadow.Allowed {
+		return result, nil
+	}
+	if result.Allowed {
+		s.shadowDenied.Add(1)
+	} else {
+		s.shadowAllowed.Add(1)
+	}
+	if s.config.OnDivergence != nil {
+		s.config.OnDivergence(key, result, shadow)
+	}
+	return result, nil
+}
+
+// Stats returns the comparison counters.
+func (s *Shadow) Stats() ShadowStats {
+	return ShadowStats{
+		Decisions:     s.decisions.Load(),
+		ShadowDenied:  s.shadowDenied.Load(),
+		ShadowAllowed: s.shadowAllowed.Load(),
+		ShadowErrors:  s.shadowErrors.Load(),
+	}
+}
+
+// Reset clears the state of key in both limiters. Errors of the shadow
+// limiter are ignored.
+func (s *Shadow) Reset(key string) error {
+	_ = s.shadow.Reset(key)
+	return s.primary.Reset(key)
+}
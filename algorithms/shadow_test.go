@@ -0,0 +1,89 @@
+package algorithms
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// failingLimiter fails every check.
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(key string) (bool, error)         { return false, errors.New("down") }
+func (failingLimiter) AllowN(key string, n int) (bool, error) { return false, errors.New("down") }
+func (failingLimiter) Reset(key string) error                 { return errors.New("down") }
+
+func TestShadow_Divergence(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	primary, _ := NewTokenBucket(ratelimiter.Config{Rate: 5, Window: time.Minute}, s)
+	shadow, _ := NewTokenBucket(ratelimiter.Config{Rate: 3, Window: time.Minute}, s, WithNamespace("candidate"))
+
+	var diverged []string
+	limiter := NewShadow(primary, shadow, ShadowConfig{
+		OnDivergence: func(key string, p, s ratelimiter.Result) {
+			if !p.Allowed || s.Allowed {
+				t.Errorf("unexpected divergence: primary %+v, shadow %+v", p, s)
+			}
+			diverged = append(diverged, key)
+		},
+	})
+
+	for i := 0; i < 6; i++ {
+		allowed, err := limiter.Allow("k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != (i < 5) {
+			t.Errorf("request %d: allowed = %v, the primary limiter should decide", i, allowed)
+		}
+	}
+
+	stats := limiter.Stats()
+	if stats.Decisions != 6 || stats.ShadowDenied != 2 || stats.ShadowAllowed != 0 {
+		t.Errorf("Stats = %+v, want 6 decisions, 2 denied by the shadow only", stats)
+	}
+	if len(diverged) != 2 {
+		t.Errorf("OnDivergence called %d times, want 2", len(diverged))
+	}
+	if got := stats.DivergenceRate(); got != 2.0/6 {
+		t.Errorf("DivergenceRate = %v, want %v", got, 2.0/6)
+	}
+
+	if err := limiter.Reset("k"); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _ := shadow.Allow("k"); !allowed {
+		t.Error("Reset should reset the shadow limiter")
+	}
+}
+
+func TestShadow_ShadowErrors(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	primary, _ := NewTokenBucket(ratelimiter.Config{Rate: 5, Window: time.Minute}, s)
+	limiter := NewShadow(primary, failingLimiter{}, ShadowConfig{})
+
+	allowed, err := limiter.Allow("k")
+	if err != nil || !allowed {
+		t.Errorf("Allow = %v, %v: shadow errors should not affect the decision", allowed, err)
+	}
+	if err := limiter.Reset("k"); err != nil {
+		t.Errorf("Reset = %v: shadow errors should be ignored", err)
+	}
+	if stats := limiter.Stats(); stats.ShadowErrors != 1 || stats.Decisions != 0 {
+		t.Errorf("Stats = %+v, want 1 shadow error", stats)
+	}
+
+	// Primary errors are returned, and nothing is compared
+	limiter = NewShadow(failingLimiter{}, primary, ShadowConfig{})
+	if _, err := limiter.Allow("k"); err == nil {
+		t.Error("expected the primary error")
+	}
+	if stats := limiter.Stats(); stats.Decisions != 0 {
+		t.Errorf("Stats = %+v, want no decisions", stats)
+	}
+}
@@ -1,7 +1,9 @@
 package algorithms
 
 import (
+	"context"
 	"hash/maphash"
+	"io"
 	"sync"
 	"time"
 
@@ -15,34 +17,84 @@ type slidingWindowState struct {
 	CurrCount   int       // Count in current window
 	WindowStart time.Time // Start of current window
 	LastSave    time.Time // Last time the state was saved to the store
+
+	// Fingerprint identifies the config of the limiter that wrote the state
+	// (0 for state written before fingerprints existed).
+	Fingerprint uint32
+
+	// Grant is the extra capacity given by GrantN, usable until GrantExpiry.
+	Grant       int
+	GrantExpiry time.Time
+}
+
+// Size reports the memory held by the state, for store.Sizer: its size on
+// 64-bit platforms.
+func (s *slidingWindowState) Size() int {
+	return 104
 }
 
 // SlidingWindow implements the sliding window rate limiting algorithm.
 // It provides a more accurate rate limit than fixed windows by considering
 // a weighted count from the previous window.
 type SlidingWindow struct {
-	config           ratelimiter.Config
-	store            store.Store
-	nsStore          store.NamespacedStore
-	timeAwareStore   store.TimeAwareStore
-	nsTimeAwareStore store.NamespacedTimeAwareStore
-	mu               [shardCount]paddedMutex // Sharded mutexes to reduce contention
-	invWindow        float64                 // Pre-calculated inverse window for faster multiplication
-	seed             maphash.Seed            // Seed for sharding hash
-	isPointerStore   bool                    // True if store supports pointer updates (e.g., MemoryStore)
+	config ratelimiter.Config
+	storeViews
+	replica        *storeViews        // Serves Remaining when set by WithReplicaReads
+	mu             []paddedMutex      // Sharded mutexes to reduce contention
+	now            func() time.Time   // Clock, time.Now unless set by WithClock
+	metrics        Metrics            // Non-nil when set by WithMetrics
+	fingerprint    uint32             // Fingerprint of the config, stored with the state
+	mismatch       MismatchPolicy     // What to do with state of another config
+	scale          *ratelimiter.Scale // Multiplier of Rate, see WithScale
+	namespace      string             // Store namespace of the state, "sw" or "<WithNamespace>:sw"
+	keyPrefix      string             // namespace + ":", the prefix of store keys
+	invWindow      float64            // Pre-calculated inverse window for faster multiplication
+	seed           maphash.Seed       // Seed for sharding hash
+	isPointerStore bool               // True if store supports pointer updates (e.g., MemoryStore)
+	coalescer      *coalescer         // Non-nil when per-key request coalescing is enabled
+	maxCost        int                // Largest n that can ever be allowed
+	ttl            time.Duration      // TTL of the state of a key
+	saveInterval   time.Duration      // Longest time between saves of in-memory state
 }
 
 // NewSlidingWindow creates a new sliding window rate limiter.
-func NewSlidingWindow(config ratelimiter.Config, s store.Store) (*SlidingWindow, error) {
+func NewSlidingWindow(config ratelimiter.Config, s store.Store, opts ...Option) (*SlidingWindow, error) {
+	o := newOptions(&config, opts)
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	// Remote stores: bound store calls by StoreTimeout and StoreRetries
+	replica := wrapStore(o.replicaOf(s), config)
+	s = wrapStore(s, config)
 
 	sw := &SlidingWindow{
-		config:    config,
-		store:     s,
-		invWindow: 1.0 / float64(config.Window),
-		seed:      maphash.MakeSeed(),
+		config:     config,
+		storeViews: newStoreViews(s),
+		invWindow:  1.0 / float64(config.Window),
+		seed:       maphash.MakeSeed(),
+		mu:         make([]paddedMutex, o.shards),
+		now:        o.now,
+		metrics:    o.metrics,
+		namespace:  o.namespace("sw"),
+		mismatch:   o.mismatch,
+		scale:      o.scale,
+	}
+
+	sw.keyPrefix = sw.namespace + ":"
+	sw.fingerprint = configFingerprint(SlidingWindowName, config)
+	sw.ttl, sw.saveInterval = stateTTL(config, 3)
+
+	sw.maxCost = config.Rate
+	if config.MaxCost > 0 && config.MaxCost < sw.maxCost {
+		sw.maxCost = config.MaxCost
+	}
+
+	if config.CoalesceWindow > 0 {
+		sw.coalescer = newCoalescer(config.CoalesceWindow)
 	}
 
 	// Optimization: if store is MemoryStore, we can update state in-place via pointer
@@ -51,15 +103,9 @@ func NewSlidingWindow(config ratelimiter.Config, s store.Store) (*SlidingWindow,
 		sw.isPointerStore = true
 	}
 
-	if ns, ok := s.(store.NamespacedStore); ok {
-		sw.nsStore = ns
-	}
-
-	if tas, ok := s.(store.TimeAwareStore); ok {
-		sw.timeAwareStore = tas
-	}
-	if nstas, ok := s.(store.NamespacedTimeAwareStore); ok {
-		sw.nsTimeAwareStore = nstas
+	if replica != nil {
+		views := newStoreViews(replica)
+		sw.replica = &views
 	}
 
 	return sw, nil
@@ -78,8 +124,38 @@ func (sw *SlidingWindow) AllowN(key string, n int) (bool, error) {
 
 // AllowNWithDetails checks if n requests are allowed and returns detailed result.
 func (sw *SlidingWindow) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	if sw.metrics == nil {
+		return sw.allowN(key, n)
+	}
+	start := time.Now()
+	result, err := sw.allowN(key, n)
+	sw.metrics.ObserveCheck(SlidingWindowName, result, time.Since(start), err)
+	return result, err
+}
+
+// allowN checks if n requests are allowed.
+func (sw *SlidingWindow) allowN(key string, n int) (ratelimiter.Result, error) {
+	limit := ratelimiter.ScaleLimit(sw.config.Rate, sw.factor())
 	if n <= 0 {
-		return ratelimiter.Result{Allowed: true, Limit: sw.config.Rate, Remaining: sw.config.Rate}, nil
+		return ratelimiter.Result{
+			Allowed:   true,
+			Limit:     limit,
+			Remaining: limit,
+			Burst:     limit,
+			Window:    sw.config.Window,
+		}, nil
+	}
+
+	if n > sw.scaledMaxCost(limit) {
+		return ratelimiter.Result{
+			Limit:  limit,
+			Burst:  limit,
+			Window: sw.config.Window,
+		}, ratelimiter.ErrCostExceedsCapacity
+	}
+
+	if sw.coalescer != nil {
+		return sw.coalescer.do(key, n, sw.getLock(key), sw.allowBatch)
 	}
 
 	var storeKey string
@@ -92,13 +168,54 @@ func (sw *SlidingWindow) AllowNWithDetails(key string, n int) (ratelimiter.Resul
 	mu.Lock()
 	defer mu.Unlock()
 
-	now := time.Now()
-	state := sw.getState(key, storeKey, useNS, now)
+	now := sw.now()
+	state, err := sw.getState(key, storeKey, useNS, now)
+	if err != nil {
+		return ratelimiter.Result{}, err
+	}
+	result := sw.take(state, n, now)
 
+	if err := sw.persist(key, storeKey, useNS, state, now, result.Allowed); err != nil {
+		return ratelimiter.Result{}, err
+	}
+	return result, nil
+}
+
+// allowBatch evaluates a batch of coalesced requests against a single state load.
+// The caller must hold the lock for key.
+func (sw *SlidingWindow) allowBatch(key string, ns []int, results []ratelimiter.Result) error {
+	var storeKey string
+	useNS := sw.nsStore != nil
+	if !useNS {
+		storeKey = sw.storeKey(key)
+	}
+
+	now := sw.now()
+	state, err := sw.getState(key, storeKey, useNS, now)
+	if err != nil {
+		return err
+	}
+
+	anyAllowed := false
+	for i, n := range ns {
+		results[i] = sw.take(state, n, now)
+		anyAllowed = anyAllowed || results[i].Allowed
+	}
+
+	return sw.persist(key, storeKey, useNS, state, now, anyAllowed)
+}
+
+// take checks whether n requests fit in the current window and counts them if so.
+// It mutates state in-place; the caller must hold the lock for the key.
+func (sw *SlidingWindow) take(state *slidingWindowState, n int, now time.Time) ratelimiter.Result {
+	f := sw.factor()
+	rate := float64(sw.config.Rate) * f
 	result := ratelimiter.Result{
-		Limit:   sw.config.Rate,
+		Limit:   ratelimiter.ScaleLimit(sw.config.Rate, f),
 		ResetAt: state.WindowStart.Add(sw.config.Window),
+		Window:  sw.config.Window,
 	}
+	result.Burst = result.Limit
 
 	// Calculate the weighted count
 	windowProgress := float64(now.Sub(state.WindowStart)) * sw.invWindow
@@ -110,67 +227,86 @@ func (sw *SlidingWindow) AllowNWithDetails(key string, n int) (ratelimiter.Resul
 	prevWeight := 1.0 - windowProgress
 	weightedCount := float64(state.PrevCount)*prevWeight + float64(state.CurrCount)
 
-	// Check if adding n requests would exceed the limit
-	if weightedCount+float64(n) > float64(sw.config.Rate) {
+	// Check if adding n requests would exceed the limit, drawing on an
+	// active grant for the excess
+	grant := activeGrant(state.Grant, state.GrantExpiry, now)
+	granted, ok := fromGrant(n, weightedCount+float64(n)-rate, grant)
+	if !ok {
 		result.Allowed = false
 		// Conservative retry after: wait until the start of the next window
 		result.RetryAfter = sw.config.Window - now.Sub(state.WindowStart)
+		result.RetryAfter = ratelimiter.AddJitter(result.RetryAfter, sw.config.RetryAfterJitter)
 
-		remaining := float64(sw.config.Rate) - weightedCount
+		remaining := rate - weightedCount
 		if remaining < 0 {
 			remaining = 0
 		}
-		result.Remaining = int(remaining)
-
-		// Optimization: If we reject, we can just update the TTL to keep the key alive
-		// without writing the full state (which requires allocation).
-		// We only fall back to full save if UpdateTTL is not supported or fails.
-		if err := sw.updateTTL(key, storeKey, useNS, now); err != nil {
-			_ = sw.saveState(key, storeKey, useNS, state, now)
-		}
-		return result, nil
+		result.Remaining = int(remaining) + grant
+		result.Used = int(weightedCount)
+		return result
 	}
 
-	// Allow the request and increment the counter
-	state.CurrCount += n
+	// Allow the request and increment the counter; granted requests are not
+	// counted in the window
+	state.CurrCount += n - granted
+	state.Grant = grant - granted
+	result.Used = int(weightedCount) + n - granted
 
 	result.Allowed = true
-	remaining := float64(sw.config.Rate) - (weightedCount + float64(n))
+	remaining := rate - (weightedCount + float64(n-granted))
 	if remaining < 0 {
 		remaining = 0
 	}
-	result.Remaining = int(remaining)
+	result.Remaining = int(remaining) + state.Grant
+	return result
+}
+
+// persist writes the state back to the store after a check.
+// When nothing was counted only the TTL is refreshed.
+func (sw *SlidingWindow) persist(key, storeKey string, useNS bool, state *slidingWindowState, now time.Time, counted bool) error {
+	// Adopt state written before fingerprints existed
+	state.Fingerprint = sw.fingerprint
+
+	if !counted {
+		// Optimization: If we reject, we can just update the TTL to keep the key alive
+		// without writing the full state (which requires allocation).
+		// We only fall back to full save if UpdateTTL is not supported or fails.
+		// State with an active grant is saved to keep it until the grant expires.
+		if activeGrant(state.Grant, state.GrantExpiry, now) > 0 {
+			_ = sw.saveState(key, storeKey, useNS, state, now)
+		} else if err := sw.updateTTL(key, storeKey, useNS, now); err != nil {
+			_ = sw.saveState(key, storeKey, useNS, state, now)
+		}
+		return nil
+	}
 
 	// Optimization: For in-memory stores, we can skip saving if the TTL is still fresh.
 	// Modifications to state are already visible via pointer.
 	// We save if it's a new key (LastSave is zero) or if enough time has passed.
 	shouldSave := true
 	if sw.isPointerStore && !state.LastSave.IsZero() {
-		// Update TTL at least once per window to ensure it doesn't expire.
-		// The TTL is set to 3x Window, so updating once per Window is sufficient.
-		if now.Sub(state.LastSave) < sw.config.Window {
+		// Update TTL often enough to ensure it doesn't expire.
+		if now.Sub(state.LastSave) < sw.saveInterval {
 			shouldSave = false
 		}
 	}
 
 	if shouldSave {
 		state.LastSave = now
-		if err := sw.saveState(key, storeKey, useNS, state, now); err != nil {
-			return ratelimiter.Result{}, err
-		}
+		return sw.saveState(key, storeKey, useNS, state, now)
 	}
-	return result, nil
+	return nil
 }
 
 // updateTTL updates the expiration of the key without saving the state.
 func (sw *SlidingWindow) updateTTL(key, storeKey string, useNS bool, now time.Time) error {
-	ttl := sw.config.Window * 3
+	ttl := sw.ttl
 	if useNS {
 		if sw.nsTimeAwareStore != nil {
-			return sw.nsTimeAwareStore.UpdateTTLWithNamespaceAt("sw", key, ttl, now)
+			return sw.nsTimeAwareStore.UpdateTTLWithNamespaceAt(sw.namespace, key, ttl, now)
 		}
 		if ttlStore, ok := sw.nsStore.(store.NamespacedTTLStore); ok {
-			return ttlStore.UpdateTTLWithNamespace("sw", key, ttl)
+			return ttlStore.UpdateTTLWithNamespace(sw.namespace, key, ttl)
 		}
 	} else {
 		if sw.timeAwareStore != nil {
@@ -184,6 +320,54 @@ func (sw *SlidingWindow) updateTTL(key, storeKey string, useNS bool, now time.Ti
 	return ratelimiter.ErrNotSupported
 }
 
+// factor returns the scale factor of Rate, raised if needed so that scaling
+// leaves room for at least 1 request.
+func (sw *SlidingWindow) factor() float64 {
+	return max(sw.scale.Factor(), 1/float64(sw.config.Rate))
+}
+
+// scaledMaxCost returns the largest n that can ever be allowed with the
+// scaled limit.
+func (sw *SlidingWindow) scaledMaxCost(limit int) int {
+	if limit == sw.config.Rate {
+		return sw.maxCost
+	}
+	if sw.config.MaxCost > 0 {
+		return min(limit, sw.config.MaxCost)
+	}
+	return limit
+}
+
+// Config returns the effective configuration of the limiter.
+func (sw *SlidingWindow) Config() ratelimiter.Config {
+	return sw.config
+}
+
+// Algorithm returns the name of the algorithm.
+func (sw *SlidingWindow) Algorithm() string {
+	return SlidingWindowName
+}
+
+// Snapshot writes the state of all keys to w, for example before a restart.
+// Checks are blocked while the snapshot is taken so that it is consistent.
+// It returns ratelimiter.ErrNotSupported if the store does not implement
+// store.Snapshotter.
+func (sw *SlidingWindow) Snapshot(w io.Writer) error {
+	return snapshotStore(sw.store, sw.mu, w)
+}
+
+// RestoreSnapshot loads state written by Snapshot into the store.
+// It returns ratelimiter.ErrNotSupported if the store does not implement
+// store.Snapshotter.
+func (sw *SlidingWindow) RestoreSnapshot(r io.Reader) error {
+	return restoreStore(sw.store, sw.mu, r)
+}
+
+// Ping checks that the backing store is reachable (see store.Pinger).
+func (sw *SlidingWindow) Ping(ctx context.Context) error {
+	return store.Ping(ctx, sw.store)
+}
+
 // Reset clears the rate limit state for the given key.
 func (sw *SlidingWindow) Reset(key string) error {
 	mu := sw.getLock(key)
@@ -191,26 +375,80 @@ func (sw *SlidingWindow) Reset(key string) error {
 	defer mu.Unlock()
 
 	if sw.nsStore != nil {
-		return sw.nsStore.DeleteWithNamespace("sw", key)
+		return sw.nsStore.DeleteWithNamespace(sw.namespace, key)
 	}
 	return sw.store.Delete(sw.storeKey(key))
 }
 
-// Remaining returns an estimate of remaining requests for the given key.
-func (sw *SlidingWindow) Remaining(key string) int {
+// RefundN removes n requests from the counts of the given key. Requests
+// counted in a window that has since ended are removed from the previous window.
+func (sw *SlidingWindow) RefundN(key string, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	var storeKey string
+	useNS := sw.nsStore != nil
+	if !useNS {
+		storeKey = sw.storeKey(key)
+	}
+
 	mu := sw.getLock(key)
 	mu.Lock()
 	defer mu.Unlock()
 
+	now := sw.now()
+	state, err := sw.getState(key, storeKey, useNS, now)
+	if err != nil {
+		return err
+	}
+	if state.CurrCount >= n {
+		state.CurrCount -= n
+	} else {
+		state.PrevCount -= n - state.CurrCount
+		state.CurrCount = 0
+		if state.PrevCount < 0 {
+			state.PrevCount = 0
+		}
+	}
+	return sw.persist(key, storeKey, useNS, state, now, true)
+}
+
+// Remaining returns an estimate of remaining requests for the given key, or
+// 0 if its state was written by a limiter with a different config and the
+// mismatch policy is MismatchError. It only takes the read lock of the key,
+// so frequent polling (e.g. by a dashboard) does not contend with itself:
+// the window is advanced on a copy of the state and nothing is written back.
+// With WithReplicaReads, the state is read from a replica of the store.
+func (sw *SlidingWindow) Remaining(key string) int {
+	mu := sw.getLock(key)
+	mu.RLock()
+	defer mu.RUnlock()
+
+	views := &sw.storeViews
+	if sw.replica != nil {
+		views = sw.replica
+	}
 	var storeKey string
-	useNS := sw.nsStore != nil
+	useNS := views.nsStore != nil
 	if !useNS {
 		storeKey = sw.storeKey(key)
 	}
 
-	state := sw.getState(key, storeKey, useNS, time.Now())
+	now := sw.now()
+	stored := sw.loadState(views, key, storeKey, useNS, now)
+	state := slidingWindowState{WindowStart: now}
+	if stored != nil {
+		switch {
+		case fingerprintMatches(stored.Fingerprint, sw.fingerprint), sw.mismatch == MismatchAdopt:
+			state = *stored
+		case sw.mismatch == MismatchError:
+			return 0
+		}
+	}
+	sw.advanceWindow(&state, now)
 
-	windowProgress := float64(time.Since(state.WindowStart)) * sw.invWindow
+	windowProgress := float64(now.Sub(state.WindowStart)) * sw.invWindow
 	if windowProgress > 1 {
 		windowProgress = 1
 	}
@@ -218,48 +456,27 @@ func (sw *SlidingWindow) Remaining(key string) int {
 	prevWeight := 1.0 - windowProgress
 	weightedCount := float64(state.PrevCount)*prevWeight + float64(state.CurrCount)
 
-	remaining := float64(sw.config.Rate) - weightedCount
+	remaining := float64(sw.config.Rate)*sw.factor() - weightedCount
 	if remaining < 0 {
-		return 0
+		remaining = 0
 	}
-	return int(remaining)
+	return int(remaining) + activeGrant(state.Grant, state.GrantExpiry, now)
 }
 
-// getState retrieves or initializes the sliding window state.
+// getState retrieves or initializes the sliding window state. State written
+// by a limiter with a different config is handled by the mismatch policy.
 // Optimization: Returns a pointer to avoid allocation when updating state in MemoryStore.
 // Safety: This function and the returned pointer must only be accessed while holding the
 // lock for the key (sw.getLock(key)). In-place mutation via advanceWindow is safe
 // because access is serialized by the lock.
-func (sw *SlidingWindow) getState(key, storeKey string, useNS bool, now time.Time) *slidingWindowState {
-	var val interface{}
-	var ok bool
-
-	if useNS {
-		if sw.nsTimeAwareStore != nil {
-			val, ok = sw.nsTimeAwareStore.GetWithNamespaceAt("sw", key, now)
-		} else {
-			val, ok = sw.nsStore.GetWithNamespace("sw", key)
-		}
-	} else {
-		if sw.timeAwareStore != nil {
-			val, ok = sw.timeAwareStore.GetAt(storeKey, now)
-		} else {
-			val, ok = sw.store.Get(storeKey)
-		}
-	}
-
-	if ok {
-		// Fast path: pointer (zero allocation for MemoryStore updates)
-		if state, ok := val.(*slidingWindowState); ok {
+func (sw *SlidingWindow) getState(key, storeKey string, useNS bool, now time.Time) (*slidingWindowState, error) {
+	if state := sw.loadState(&sw.storeViews, key, storeKey, useNS, now); state != nil {
+		if fingerprintMatches(state.Fingerprint, sw.fingerprint) || sw.mismatch == MismatchAdopt {
 			sw.advanceWindow(state, now)
-			return state
+			return state, nil
 		}
-		// Fallback: value (handles migration or stores that return by value)
-		if state, ok := val.(slidingWindowState); ok {
-			// Copy to heap to allow pointer return
-			s := state
-			sw.advanceWindow(&s, now)
-			return &s
+		if sw.mismatch == MismatchError {
+			return nil, ratelimiter.ErrConfigMismatch
 		}
 	}
 
@@ -268,7 +485,43 @@ func (sw *SlidingWindow) getState(key, storeKey string, useNS bool, now time.Tim
 		PrevCount:   0,
 		CurrCount:   0,
 		WindowStart: now,
+		Fingerprint: sw.fingerprint,
+	}, nil
+}
+
+// loadState retrieves the sliding window state as stored, or nil if the key
+// has no state. The returned pointer may be the stored one: only modify it
+// while holding the write lock for the key.
+func (sw *SlidingWindow) loadState(views *storeViews, key, storeKey string, useNS bool, now time.Time) *slidingWindowState {
+	val, ok := views.get(sw.namespace, key, storeKey, useNS, now)
+	if !ok {
+		return nil
+	}
+	return slidingWindowStateOf(val)
+}
+
+// slidingWindowStateOf converts a stored value to the sliding window state,
+// or nil if it holds none.
+func slidingWindowStateOf(val interface{}) *slidingWindowState {
+	// Fast path: pointer (zero allocation for MemoryStore updates)
+	if state, ok := val.(*slidingWindowState); ok {
+		return state
+	}
+	// Fallback: value (handles migration or stores that return by value)
+	if state, ok := val.(slidingWindowState); ok {
+		// Copy to heap to allow pointer return
+		return &state
+	}
+	// Remote stores: encoded state (see state_codec.go)
+	if b, ok := val.([]byte); ok {
+		state := &slidingWindowState{}
+		if err := decodeState(b, state); err == nil {
+			// Not the stored pointer: force the next persist to store it
+			state.LastSave = time.Time{}
+			return state
+		}
 	}
+	return nil
 }
 
 // advanceWindow updates the window state if time has passed.
@@ -291,13 +544,12 @@ func (sw *SlidingWindow) advanceWindow(state *slidingWindowState, now time.Time)
 // saveState persists the sliding window state.
 // Optimization: Takes a pointer to support zero-allocation updates in MemoryStore.
 func (sw *SlidingWindow) saveState(key, storeKey string, useNS bool, state *slidingWindowState, now time.Time) error {
-	// Store with a TTL of 3x the window to allow for proper sliding
-	ttl := sw.config.Window * 3
+	ttl := grantTTL(sw.ttl, state.Grant, state.GrantExpiry, now)
 	if useNS {
 		if sw.nsTimeAwareStore != nil {
-			return sw.nsTimeAwareStore.SetWithNamespaceAt("sw", key, state, ttl, now)
+			return sw.nsTimeAwareStore.SetWithNamespaceAt(sw.namespace, key, state, ttl, now)
 		}
-		return sw.nsStore.SetWithNamespace("sw", key, state, ttl)
+		return sw.nsStore.SetWithNamespace(sw.namespace, key, state, ttl)
 	}
 	if sw.timeAwareStore != nil {
 		return sw.timeAwareStore.SetAt(storeKey, state, ttl, now)
@@ -307,11 +559,11 @@ func (sw *SlidingWindow) saveState(key, storeKey string, useNS bool, state *slid
 
 // storeKey generates the storage key for a rate limit key.
 func (sw *SlidingWindow) storeKey(key string) string {
-	return "sw:" + key
+	return sw.keyPrefix + key
 }
 
 // getLock returns the mutex for the given key based on a hash.
-func (sw *SlidingWindow) getLock(key string) *sync.Mutex {
-	idx := maphash.String(sw.seed, key) % shardCount
-	return &sw.mu[idx].Mutex
+func (sw *SlidingWindow) getLock(key string) *sync.RWMutex {
+	idx := maphash.String(sw.seed, key) % uint64(len(sw.mu))
+	return &sw.mu[idx].RWMutex
 }
@@ -330,3 +330,123 @@ func TestSlidingWindow_Concurrent(t *testing.T) {
 		t.Errorf("Expected max 100 allowed, got %d", allowedCount)
 	}
 }
+
+func TestSlidingWindow_ResultDetails(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	sw, err := NewSlidingWindow(ratelimiter.Config{
+		Rate:   10,
+		Window: time.Minute,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create SlidingWindow: %v", err)
+	}
+
+	sw.AllowN("test", 3)
+	result, err := sw.AllowNWithDetails("test", 2)
+	if err != nil {
+		t.Fatalf("AllowNWithDetails returned error: %v", err)
+	}
+	if result.Burst != 10 {
+		t.Errorf("Expected Burst=10, got %d", result.Burst)
+	}
+	if result.Window != time.Minute {
+		t.Errorf("Expected Window=1m, got %v", result.Window)
+	}
+	if result.Used != 5 {
+		t.Errorf("Expected Used=5, got %d", result.Used)
+	}
+
+	// Denied requests report usage without counting the rejected request
+	result, _ = sw.AllowNWithDetails("test", 10)
+	if result.Allowed {
+		t.Fatal("Expected request to be denied")
+	}
+	if result.Used != 5 {
+		t.Errorf("Expected Used=5 after denial, got %d", result.Used)
+	}
+}
+
+func TestSlidingWindow_Describe(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	sw, err := NewSlidingWindow(ratelimiter.Config{
+		Rate:   20,
+		Window: time.Second,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create SlidingWindow: %v", err)
+	}
+
+	var d ratelimiter.DescribableLimiter = sw
+	if d.Algorithm() != SlidingWindowName {
+		t.Errorf("Expected algorithm %q, got %q", SlidingWindowName, d.Algorithm())
+	}
+	if cfg := d.Config(); cfg.Rate != 20 || cfg.Window != time.Second {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+}
+
+func TestSlidingWindow_RefundN(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	sw, _ := NewSlidingWindow(ratelimiter.Config{Rate: 3, Window: time.Hour}, s)
+
+	sw.AllowN("key", 3)
+	if allowed, _ := sw.Allow("key"); allowed {
+		t.Fatal("Expected limit reached")
+	}
+	if err := sw.RefundN("key", 1); err != nil {
+		t.Fatalf("RefundN failed: %v", err)
+	}
+	if allowed, _ := sw.Allow("key"); !allowed {
+		t.Error("Expected refunded request to be available")
+	}
+
+	// Refunds never go below zero
+	sw.RefundN("key", 10)
+	if allowed, _ := sw.AllowN("key", 3); !allowed {
+		t.Error("Expected full window after large refund")
+	}
+	if allowed, _ := sw.Allow("key"); allowed {
+		t.Error("Expected refund not to raise capacity above Rate")
+	}
+}
+
+func TestSlidingWindow_RemainingIsReadOnly(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	sw, _ := NewSlidingWindow(ratelimiter.Config{Rate: 10, Window: time.Second}, s)
+	sw.Allow("test")
+
+	// Readers share the key lock
+	mu := sw.getLock("test")
+	mu.RLock()
+	done := make(chan int)
+	go func() { done <- sw.Remaining("test") }()
+	select {
+	case got := <-done:
+		if got != 9 {
+			t.Errorf("Expected 9 remaining, got %d", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Remaining blocked behind another reader")
+	}
+	mu.RUnlock()
+
+	// Two windows later the estimate is reset, but the stored state is untouched
+	val, _ := s.GetWithNamespace("sw", "test")
+	state := val.(*slidingWindowState)
+	state.WindowStart = state.WindowStart.Add(-3 * time.Second)
+	before := *state
+	if got := sw.Remaining("test"); got != 10 {
+		t.Errorf("Expected 10 remaining after two windows, got %d", got)
+	}
+	if *state != before {
+		t.Errorf("Remaining modified the stored state: %+v, was %+v", *state, before)
+	}
+}
@@ -0,0 +1,370 @@
+package algorithms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// SlidingWindowLogName is the name reported by SlidingWindowLog.Algorithm.
+const SlidingWindowLogName = "sliding_window_log"
+
+// ErrUnexpectedReply is returned when a store script replies with values
+// the limiter does not expect, e.g. a different script version.
+var ErrUnexpectedReply = errors.New("ratelimiter: unexpected script reply")
+
+// slidingWindowLogScript checks and logs n requests of a key in a sorted set
+// scored by request time, in microseconds or milliseconds (see
+// store.RedisSchema).
+//
+// KEYS[1]: the log. ARGV: now, window, limit, n, member prefix, time units
+// per millisecond.
+// Reply: {allowed (0 or 1), requests in the window, reset time}, where the
+// reset time is when the oldest request leaves the window if allowed, and
+// when enough of them have left to allow n requests otherwise.
+const slidingWindowLogScript = `
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+if count + n > limit then
+	local oldest = redis.call('ZRANGE', key, count + n - limit - 1, count + n - limit - 1, 'WITHSCORES')
+	return {0, count, tonumber(oldest[2]) + window}
+end
+
+for i = 1, n do
+	redis.call('ZADD', key, now, ARGV[5] .. ':' .. i)
+end
+redis.call('PEXPIRE', key, math.ceil(window / tonumber(ARGV[6])))
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {1, count + n, tonumber(oldest[2]) + window}
+`
+
+// slidingWindowLogCountScript counts the requests of a key in the window.
+//
+// KEYS[1]: the log. ARGV: now, window. Reply: the count.
+const slidingWindowLogCountScript = `
+return redis.call('ZCOUNT', KEYS[1], '(' .. (tonumber(ARGV[1]) - tonumber(ARGV[2])), '+inf')
+`
+
+// SlidingWindowLog is an exact sliding window limiter for stores running
+// scripts, such as store.RedisStore: the time of every allowed request is
+// logged in a sorted set per key, and a request is allowed if fewer than Rate
+// requests were logged in the last Window. The check and the update run in a
+// single Lua script, so instances sharing the store enforce the limit
+// exactly, without the Get/Set race of the other algorithms on remote stores.
+//
+// Memory grows with Rate per key, unlike the two counters of SlidingWindow,
+// so it suits low and medium rates. The log holds request times, not the
+// config, so limiters with different configs sharing a key each apply their
+// own. Times come from the limiter's clock: instances should have
+// synchronized clocks.
+//
+// Stores implementing store.SchemaStore select the layout of the logs, e.g.
+// store.RedisSchemaSortedSetMillis to share limits with sorted set sliding
+// logs written in other languages.
+type SlidingWindowLog struct {
+	config    ratelimiter.Config
+	store     store.ScriptStore
+	replica   store.ScriptStore // Serves Remaining when set by WithReplicaReads
+	now       func() time.Time
+	metrics   Metrics
+	scale     *ratelimiter.Scale
+	keyPrefix string
+	unit      time.Duration // Unit of the log scores, see store.RedisSchema
+	maxCost   int
+	id        string        // Random prefix of the log members of this limiter
+	seq       atomic.Uint64 // Makes log members unique
+}
+
+// NewSlidingWindowLog creates a new sliding window log limiter.
+func NewSlidingWindowLog(config ratelimiter.Config, s store.ScriptStore, opts ...Option) (*SlidingWindowLog, error) {
+	o := newOptions(&config, opts)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	sl := &SlidingWindowLog{
+		config:    config,
+		store:     s,
+		now:       o.now,
+		metrics:   o.metrics,
+		scale:     o.scale,
+		keyPrefix: o.namespace("swl") + ":",
+		unit:      time.Microsecond,
+		maxCost:   config.Rate,
+		id:        hex.EncodeToString(id),
+	}
+	if ss, ok := s.(store.SchemaStore); ok {
+		switch schema := ss.Schema(); schema {
+		case store.RedisSchemaNative:
+		case store.RedisSchemaSortedSetMillis:
+			sl.keyPrefix, sl.unit = "", time.Millisecond
+		default:
+			return nil, fmt.Errorf("ratelimiter: unsupported store schema %q", schema)
+		}
+	}
+	if config.MaxCost > 0 && config.MaxCost < sl.maxCost {
+		sl.maxCost = config.MaxCost
+	}
+	if replica, ok := o.replicaOf(s).(store.ScriptStore); ok {
+		sl.replica = replica
+	}
+	return sl, nil
+}
+
+// Allow checks if a single request is allowed.
+func (sl *SlidingWindowLog) Allow(key string) (bool, error) {
+	return sl.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed.
+func (sl *SlidingWindowLog) AllowN(key string, n int) (bool, error) {
+	result, err := sl.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n requests are allowed and returns detailed result.
+func (sl *SlidingWindowLog) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	if sl.metrics == nil {
+		return sl.allowN(key, n)
+	}
+	start := time.Now()
+	result, err := sl.allowN(key, n)
+	sl.metrics.ObserveCheck(SlidingWindowLogName, result, time.Since(start), err)
+	return result, err
+}
+
+// allowN checks if n requests are allowed.
+func (sl *SlidingWindowLog) allowN(key string, n int) (ratelimiter.Result, error) {
+	now := sl.now()
+	result, call, err := sl.check(key, n, now)
+	if call == nil {
+		return result, err
+	}
+
+	ctx, cancel := sl.context()
+	defer cancel()
+
+	reply, err := sl.store.Eval(ctx, call.Script, call.Keys, call.Args...)
+	if err != nil {
+		return result, err
+	}
+	return sl.complete(result, reply, now)
+}
+
+// check returns the script call checking n requests of key, or nil and the
+// final result if none is needed.
+func (sl *SlidingWindowLog) check(key string, n int, now time.Time) (ratelimiter.Result, *store.ScriptCall, error) {
+	limit := ratelimiter.ScaleLimit(sl.config.Rate, sl.scale.Factor())
+	result := ratelimiter.Result{
+		Limit:  limit,
+		Burst:  limit,
+		Window: sl.config.Window,
+	}
+	if n <= 0 {
+		result.Allowed = true
+		result.Remaining = limit
+		return result, nil, nil
+	}
+	if n > min(sl.maxCost, limit) {
+		return result, nil, ratelimiter.ErrCostExceedsCapacity
+	}
+
+	at := sl.score(now)
+	member := sl.id + ":" + strconv.FormatUint(sl.seq.Add(1), 36)
+	if sl.unit == time.Millisecond {
+		member = strconv.FormatInt(at, 10) + "-" + member
+	}
+	return result, &store.ScriptCall{
+		Script: slidingWindowLogScript,
+		Keys:   []string{sl.keyPrefix + key},
+		Args:   []interface{}{at, int64(sl.config.Window / sl.unit), limit, n, member, int64(time.Millisecond / sl.unit)},
+	}, nil
+}
+
+// complete fills result from the reply of its check script.
+func (sl *SlidingWindowLog) complete(result ratelimiter.Result, reply interface{}, now time.Time) (ratelimiter.Result, error) {
+	values, err := replyInts(reply, 3)
+	if err != nil {
+		return result, err
+	}
+
+	result.Allowed = values[0] == 1
+	result.Used = int(values[1])
+	result.Remaining = max(result.Limit-result.Used, 0)
+	result.ResetAt = time.Unix(0, values[2]*int64(sl.unit))
+	if !result.Allowed {
+		result.RetryAfter = ratelimiter.AddJitter(result.ResetAt.Sub(now), sl.config.RetryAfterJitter)
+	}
+	return result, nil
+}
+
+// LogCheck is a check of n requests of a key by a sliding window log, see
+// AllowBatch.
+type LogCheck struct {
+	Limiter *SlidingWindowLog
+	Key     string
+	N       int
+}
+
+// AllowBatch runs several checks with one store round trip per store, e.g.
+// the per-second and per-minute limits of a request, or the keys of a batch
+// of messages: the checks of limiters sharing a store.BatchScriptStore, such
+// as a store.RedisStore, are pipelined together. Checks are independent: a
+// denied check does not undo the others. Results and errors are in the order
+// of checks, and the store timeout is that of the first limiter of a store.
+func AllowBatch(checks []LogCheck) ([]ratelimiter.Result, []error) {
+	results := make([]ratelimiter.Result, len(checks))
+	errs := make([]error, len(checks))
+	start := time.Now()
+
+	type batch struct {
+		limiter *SlidingWindowLog // First limiter of the store
+		calls   []store.ScriptCall
+		index   []int // Index of each call in checks
+		now     []time.Time
+	}
+	var batches []*batch
+	byStore := make(map[store.ScriptStore]*batch)
+	for i, c := range checks {
+		now := c.Limiter.now()
+		result, call, err := c.Limiter.check(c.Key, c.N, now)
+		if call == nil {
+			results[i], errs[i] = result, err
+			continue
+		}
+		results[i] = result
+		b, ok := byStore[c.Limiter.store]
+		if !ok {
+			b = &batch{limiter: c.Limiter}
+			byStore[c.Limiter.store] = b
+			batches = append(batches, b)
+		}
+		b.calls = append(b.calls, *call)
+		b.index = append(b.index, i)
+		b.now = append(b.now, now)
+	}
+
+	for _, b := range batches {
+		replies := b.limiter.evalBatch(b.calls)
+		for j, i := range b.index {
+			if replies[j].Err != nil {
+				errs[i] = replies[j].Err
+				continue
+			}
+			results[i], errs[i] = checks[i].Limiter.complete(results[i], replies[j].Reply, b.now[j])
+		}
+	}
+
+	for i, c := range checks {
+		if c.Limiter.metrics != nil {
+			c.Limiter.metrics.ObserveCheck(SlidingWindowLogName, results[i], time.Since(start), errs[i])
+		}
+	}
+	return results, errs
+}
+
+// evalBatch runs calls on the store of the limiter, in one round trip if it
+// implements store.BatchScriptStore.
+func (sl *SlidingWindowLog) evalBatch(calls []store.ScriptCall) []store.ScriptResult {
+	ctx, cancel := sl.context()
+	defer cancel()
+
+	if bs, ok := sl.store.(store.BatchScriptStore); ok {
+		return bs.EvalBatch(ctx, calls)
+	}
+	results := make([]store.ScriptResult, len(calls))
+	for i, call := range calls {
+		results[i].Reply, results[i].Err = sl.store.Eval(ctx, call.Script, call.Keys, call.Args...)
+	}
+	return results
+}
+
+// Remaining returns the number of requests remaining for the given key, or
+// 0 if the store cannot be reached. With WithReplicaReads, the log is counted
+// on a replica of the store.
+func (sl *SlidingWindowLog) Remaining(key string) int {
+	limit := ratelimiter.ScaleLimit(sl.config.Rate, sl.scale.Factor())
+
+	s := sl.store
+	if sl.replica != nil {
+		s = sl.replica
+	}
+
+	ctx, cancel := sl.context()
+	defer cancel()
+
+	reply, err := s.Eval(ctx, slidingWindowLogCountScript, []string{sl.keyPrefix + key},
+		sl.score(sl.now()), int64(sl.config.Window/sl.unit))
+	if err != nil {
+		return 0
+	}
+	count, ok := reply.(int64)
+	if !ok {
+		return 0
+	}
+	return max(limit-int(count), 0)
+}
+
+// Reset clears the log of the given key.
+func (sl *SlidingWindowLog) Reset(key string) error {
+	return sl.store.Delete(sl.keyPrefix + key)
+}
+
+// Config returns the configuration of the limiter.
+func (sl *SlidingWindowLog) Config() ratelimiter.Config {
+	return sl.config
+}
+
+// Algorithm returns the name of the algorithm.
+func (sl *SlidingWindowLog) Algorithm() string {
+	return SlidingWindowLogName
+}
+
+// score returns the log score of a request at t.
+func (sl *SlidingWindowLog) score(t time.Time) int64 {
+	return t.UnixNano() / int64(sl.unit)
+}
+
+// context returns the context of a store script, bounded by StoreTimeout if
+// set.
+func (sl *SlidingWindowLog) context() (context.Context, context.CancelFunc) {
+	if sl.config.StoreTimeout > 0 {
+		return context.WithTimeout(context.Background(), sl.config.StoreTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// replyInts converts an array reply of n integers.
+func replyInts(reply interface{}, n int) ([]int64, error) {
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != n {
+		return nil, ErrUnexpectedReply
+	}
+	ints := make([]int64, n)
+	for i, v := range values {
+		if ints[i], ok = v.(int64); !ok {
+			return nil, ErrUnexpectedReply
+		}
+	}
+	return ints, nil
+}
@@ -0,0 +1,314 @@
+package algorithms
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// fakeScriptStore is a ScriptStore running the sliding window log scripts on
+// in-memory sorted sets of request times.
+type fakeScriptStore struct {
+	*store.MemoryStore
+	mu   sync.Mutex
+	logs map[string][]int64
+	err  error
+}
+
+func newFakeScriptStore(t *testing.T) *fakeScriptStore {
+	s, _ := newTestEnv(t)
+	return &fakeScriptStore{MemoryStore: s, logs: make(map[string][]int64)}
+}
+
+func (f *fakeScriptStore) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.logs, key)
+	return nil
+}
+
+func (f *fakeScriptStore) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	key := keys[0]
+	now, window := args[0].(int64), args[1].(int64)
+	switch script {
+	case slidingWindowLogCountScript:
+		var count int64
+		for _, at := range f.logs[key] {
+			if at > now-window {
+				count++
+			}
+		}
+		return count, nil
+	case slidingWindowLogScript:
+		limit, n := args[2].(int), args[3].(int)
+		log := f.logs[key][:0]
+		for _, at := range f.logs[key] {
+			if at > now-window {
+				log = append(log, at)
+			}
+		}
+		sort.Slice(log, func(i, j int) bool { return log[i] < log[j] })
+		count := len(log)
+		if count+n > limit {
+			f.logs[key] = log
+			return []interface{}{int64(0), int64(count), log[count+n-limit-1] + window}, nil
+		}
+		for i := 0; i < n; i++ {
+			log = append(log, now)
+		}
+		f.logs[key] = log
+		return []interface{}{int64(1), int64(count + n), log[0] + window}, nil
+	}
+	return nil, errors.New("unknown script")
+}
+
+func newTestSlidingWindowLog(t *testing.T, rate int, window time.Duration) (*SlidingWindowLog, *fakeScriptStore, *fakeClock) {
+	t.Helper()
+	s := newFakeScriptStore(t)
+	_, clock := newTestEnv(t)
+	sl, err := NewSlidingWindowLog(ratelimiter.Config{Rate: rate, Window: window}, s, WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sl, s, clock
+}
+
+func TestSlidingWindowLog_ExactWindow(t *testing.T) {
+	sl, _, clock := newTestSlidingWindowLog(t, 3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if ok, err := sl.Allow("key"); !ok || err != nil {
+			t.Fatalf("request %d: expected allowed, got %v, %v", i+1, ok, err)
+		}
+		clock.Advance(10 * time.Second)
+	}
+
+	result, err := sl.AllowNWithDetails("key", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Fatal("Expected the 4th request in the window to be denied")
+	}
+	if result.RetryAfter != 30*time.Second {
+		t.Errorf("Expected to retry when the first request leaves the window, got %v", result.RetryAfter)
+	}
+	if result.Remaining != 0 || result.Used != 3 {
+		t.Errorf("Expected 3 used and none remaining, got %d and %d", result.Used, result.Remaining)
+	}
+
+	// Unlike the weighted counters of SlidingWindow, the first request
+	// leaving the window frees exactly one slot.
+	clock.Advance(30 * time.Second)
+	if ok, _ := sl.Allow("key"); !ok {
+		t.Error("Expected a request once the oldest one left the window")
+	}
+	if ok, _ := sl.Allow("key"); ok {
+		t.Error("Expected a single slot to be freed")
+	}
+}
+
+func TestSlidingWindowLog_RemainingAndReset(t *testing.T) {
+	sl, _, _ := newTestSlidingWindowLog(t, 5, time.Minute)
+
+	if got := sl.Remaining("key"); got != 5 {
+		t.Errorf("Expected 5 remaining, got %d", got)
+	}
+	if ok, err := sl.AllowN("key", 2); !ok || err != nil {
+		t.Fatalf("Expected allowed, got %v, %v", ok, err)
+	}
+	if got := sl.Remaining("key"); got != 3 {
+		t.Errorf("Expected 3 remaining, got %d", got)
+	}
+
+	if err := sl.Reset("key"); err != nil {
+		t.Fatal(err)
+	}
+	if got := sl.Remaining("key"); got != 5 {
+		t.Errorf("Expected 5 remaining after Reset, got %d", got)
+	}
+}
+
+func TestSlidingWindowLog_Errors(t *testing.T) {
+	sl, s, _ := newTestSlidingWindowLog(t, 2, time.Minute)
+
+	if _, err := sl.AllowN("key", 3); !errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+
+	s.err = errors.New("redis unavailable")
+	if _, err := sl.Allow("key"); !errors.Is(err, s.err) {
+		t.Errorf("Expected the store error, got %v", err)
+	}
+	if got := sl.Remaining("key"); got != 0 {
+		t.Errorf("Expected 0 remaining on store errors, got %d", got)
+	}
+
+	if _, err := replyInts([]interface{}{int64(1), "2"}, 2); !errors.Is(err, ErrUnexpectedReply) {
+		t.Errorf("Expected ErrUnexpectedReply, got %v", err)
+	}
+}
+
+func TestSlidingWindowLog_Namespace(t *testing.T) {
+	s := newFakeScriptStore(t)
+	sl, err := NewSlidingWindowLog(ratelimiter.Config{Rate: 1, Window: time.Minute}, s, WithNamespace("login"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sl.Allow("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.logs["login:swl:key"]; !ok {
+		t.Errorf("Expected the log under login:swl:key, got %v", s.logs)
+	}
+	if sl.Algorithm() != SlidingWindowLogName {
+		t.Errorf("Unexpected algorithm %q", sl.Algorithm())
+	}
+}
+
+// schemaScriptStore is a fakeScriptStore with a state layout.
+type schemaScriptStore struct {
+	*fakeScriptStore
+	schema store.RedisSchema
+}
+
+func (s *schemaScriptStore) Schema() store.RedisSchema {
+	return s.schema
+}
+
+func TestSlidingWindowLog_Schema(t *testing.T) {
+	s := &schemaScriptStore{fakeScriptStore: newFakeScriptStore(t), schema: store.RedisSchemaSortedSetMillis}
+	_, clock := newTestEnv(t)
+	config := ratelimiter.Config{Rate: 1, Window: time.Minute}
+	sl, err := NewSlidingWindowLog(config, s, WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := sl.Allow("key"); !ok {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	if log := s.logs["key"]; len(log) != 1 || log[0] != clock.Now().UnixMilli() {
+		t.Errorf("Expected the log under the bare key, in milliseconds, got %v", s.logs)
+	}
+	clock.Advance(10 * time.Second)
+	result, err := sl.AllowNWithDetails("key", 1)
+	if err != nil || result.Allowed {
+		t.Fatalf("Expected the second request to be denied, got %+v, %v", result, err)
+	}
+	if result.RetryAfter != 50*time.Second {
+		t.Errorf("Expected to retry when the request leaves the window, got %v", result.RetryAfter)
+	}
+	if got := sl.Remaining("key"); got != 0 {
+		t.Errorf("Expected 0 remaining, got %d", got)
+	}
+
+	s.schema = "unknown"
+	if _, err := NewSlidingWindowLog(config, s); err == nil {
+		t.Error("Expected an error for an unknown schema")
+	}
+}
+
+// laggingScriptStore is a script store whose replica has not received any
+// write yet.
+type laggingScriptStore struct {
+	*fakeScriptStore
+	replica *fakeScriptStore
+}
+
+func (s *laggingScriptStore) Replica() store.Store {
+	return s.replica
+}
+
+func TestSlidingWindowLog_ReplicaReads(t *testing.T) {
+	s := &laggingScriptStore{fakeScriptStore: newFakeScriptStore(t), replica: newFakeScriptStore(t)}
+	_, clock := newTestEnv(t)
+	sl, err := NewSlidingWindowLog(ratelimiter.Config{Rate: 2, Window: time.Minute}, s, WithClock(clock.Now), WithReplicaReads())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := sl.Allow("key"); !ok {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	if got := sl.Remaining("key"); got != 2 {
+		t.Errorf("Expected Remaining from the lagging replica, got %d", got)
+	}
+	s.replica.logs["swl:key"] = s.logs["swl:key"]
+	if got := sl.Remaining("key"); got != 1 {
+		t.Errorf("Expected Remaining from the replica, got %d", got)
+	}
+}
+
+// batchScriptStore is a fakeScriptStore counting its batches.
+type batchScriptStore struct {
+	*fakeScriptStore
+	batches int
+}
+
+func (s *batchScriptStore) EvalBatch(ctx context.Context, calls []store.ScriptCall) []store.ScriptResult {
+	s.batches++
+	results := make([]store.ScriptResult, len(calls))
+	for i, c := range calls {
+		results[i].Reply, results[i].Err = s.Eval(ctx, c.Script, c.Keys, c.Args...)
+	}
+	return results
+}
+
+func TestAllowBatch(t *testing.T) {
+	s := &batchScriptStore{fakeScriptStore: newFakeScriptStore(t)}
+	_, clock := newTestEnv(t)
+	perSecond, err := NewSlidingWindowLog(ratelimiter.Config{Rate: 1, Window: time.Second}, s, WithClock(clock.Now), WithNamespace("s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	perMinute, err := NewSlidingWindowLog(ratelimiter.Config{Rate: 3, Window: time.Minute}, s, WithClock(clock.Now), WithNamespace("m"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, errs := AllowBatch([]LogCheck{
+		{Limiter: perSecond, Key: "user", N: 1},
+		{Limiter: perMinute, Key: "user", N: 1},
+		{Limiter: perSecond, Key: "user", N: 1},
+		{Limiter: perMinute, Key: "user", N: 4},
+		{Limiter: perMinute, Key: "user", N: 0},
+	})
+	if s.batches != 1 {
+		t.Errorf("Expected one round trip, got %d", s.batches)
+	}
+	for i, want := range []bool{true, true, false, false, true} {
+		if results[i].Allowed != want {
+			t.Errorf("check %d: expected allowed %v, got %v", i, want, results[i].Allowed)
+		}
+	}
+	if results[1].Remaining != 2 {
+		t.Errorf("Expected 2 remaining per minute, got %d", results[1].Remaining)
+	}
+	if !errors.Is(errs[3], ratelimiter.ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", errs[3])
+	}
+
+	// Stores without batches run the checks one after the other
+	plain := newFakeScriptStore(t)
+	sl, err := NewSlidingWindowLog(ratelimiter.Config{Rate: 1, Window: time.Minute}, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, errs = AllowBatch([]LogCheck{{Limiter: sl, Key: "a", N: 1}, {Limiter: sl, Key: "a", N: 1}})
+	if !results[0].Allowed || results[1].Allowed || errs[0] != nil || errs[1] != nil {
+		t.Errorf("Unexpected results %v, %v", results, errs)
+	}
+}
@@ -0,0 +1,332 @@
+package algorithms
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// Limiter state serialization.
+//
+// The state values passed to Store.Set implement encoding.BinaryMarshaler and
+// json.Marshaler, so remote stores can persist them without knowing their
+// concrete types. A store may return the encoded bytes ([]byte) from Get and
+// the algorithms decode them transparently (both binary and JSON encodings
+// are accepted).
+//
+// Binary layout (big endian), version 3:
+//
+//	byte 0     state type ('T' = token bucket, 'S' = sliding window)
+//	byte 1     format version
+//	bytes 2..  fixed-size fields, timestamps as Unix nanoseconds (0 = zero time)
+//
+//	token bucket:   Tokens (float64 bits), LastRefill, LastSave, Created
+//	sliding window: PrevCount (int64), CurrCount (int64), WindowStart, LastSave
+//	version 2:      Fingerprint (uint32) appended to both
+//	version 3:      Grant (int64), GrantExpiry appended to both
+//
+// Version 3 is only written for state with a grant (see GrantN), so that
+// decoders of version 2 keep reading all other state during upgrades.
+//
+// The JSON encoding has optional "fingerprint", "grant" and "grant_expiry"
+// fields; a missing or zero fingerprint is the one of state written before
+// fingerprints existed.
+//
+// New fields must only be appended in a new version; decoders keep accepting
+// all previous versions so that state survives upgrades.
+//
+// store.ProtobufCodec encodes the JSON fields as a LimiterState message. Each
+// state registers its fields, for the following schema:
+//
+//	message LimiterState {
+//	  uint32 v              = 1;
+//	  string type           = 2;
+//	  double tokens         = 3;
+//	  sint64 last_refill    = 4;
+//	  sint64 last_save      = 5;
+//	  sint64 created        = 6;
+//	  sint64 prev_count     = 7;
+//	  sint64 curr_count     = 8;
+//	  sint64 window_start   = 9;
+//	  uint32 fingerprint    = 10;
+//	  sint64 grant          = 11;
+//	  sint64 grant_expiry   = 12;
+//	  sint64 violations     = 13; // Backoff
+//	  sint64 last_violation = 14;
+//	  sint64 blocked_until  = 15;
+//	  sint64 first_seen     = 16; // Greylist
+//	  sint64 last_seen      = 17;
+//	}
+//
+// Field numbers are never reused, so that new states get new numbers.
+
+func init() {
+	store.RegisterProtobufFields(
+		store.ProtobufField{Name: "tokens", Number: 3, Kind: store.ProtobufDouble},
+		store.ProtobufField{Name: "last_refill", Number: 4, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "last_save", Number: 5, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "created", Number: 6, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "prev_count", Number: 7, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "curr_count", Number: 8, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "window_start", Number: 9, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "fingerprint", Number: 10, Kind: store.ProtobufUint32},
+		store.ProtobufField{Name: "grant", Number: 11, Kind: store.ProtobufSint64},
+		store.ProtobufField{Name: "grant_expiry", Number: 12, Kind: store.ProtobufSint64},
+	)
+}
+
+const (
+	stateTypeTokenBucket   byte = 'T'
+	stateTypeSlidingWindow byte = 'S'
+
+	stateVersion1 byte = 1
+	stateVersion2 byte = 2
+	stateVersion3 byte = 3
+
+	stateHeaderSize = 2
+	stateV1Size     = stateHeaderSize + 4*8
+	stateV2Size     = stateV1Size + 4
+	stateV3Size     = stateV2Size + 2*8
+)
+
+// ErrInvalidState is returned when encoded limiter state cannot be decoded.
+var ErrInvalidState = errors.New("ratelimiter: invalid encoded state")
+
+// ErrUnsupportedStateVersion is returned when encoded limiter state has an unknown version.
+var ErrUnsupportedStateVersion = errors.New("ratelimiter: unsupported state version")
+
+// tokenBucketStateJSON is the JSON representation of tokenBucketState.
+type tokenBucketStateJSON struct {
+	Version     int     `json:"v"`
+	Type        string  `json:"type"`
+	Tokens      float64 `json:"tokens"`
+	LastRefill  int64   `json:"last_refill"`
+	LastSave    int64   `json:"last_save,omitempty"`
+	Created     int64   `json:"created,omitempty"`
+	Fingerprint uint32  `json:"fingerprint,omitempty"`
+	Grant       int64   `json:"grant,omitempty"`
+	GrantExpiry int64   `json:"grant_expiry,omitempty"`
+}
+
+// slidingWindowStateJSON is the JSON representation of slidingWindowState.
+type slidingWindowStateJSON struct {
+	Version     int    `json:"v"`
+	Type        string `json:"type"`
+	PrevCount   int64  `json:"prev_count"`
+	CurrCount   int64  `json:"curr_count"`
+	WindowStart int64  `json:"window_start"`
+	LastSave    int64  `json:"last_save,omitempty"`
+	Fingerprint uint32 `json:"fingerprint,omitempty"`
+	Grant       int64  `json:"grant,omitempty"`
+	GrantExpiry int64  `json:"grant_expiry,omitempty"`
+}
+
+// MarshalBinary encodes the state in the versioned binary format.
+func (s *tokenBucketState) MarshalBinary() ([]byte, error) {
+	b := newStateBuffer(stateTypeTokenBucket, s.Grant, s.GrantExpiry)
+	binary.BigEndian.PutUint64(b[2:], math.Float64bits(s.Tokens))
+	binary.BigEndian.PutUint64(b[10:], uint64(toUnixNano(s.LastRefill)))
+	binary.BigEndian.PutUint64(b[18:], uint64(toUnixNano(s.LastSave)))
+	binary.BigEndian.PutUint64(b[26:], uint64(toUnixNano(s.Created)))
+	binary.BigEndian.PutUint32(b[34:], s.Fingerprint)
+	return b, nil
+}
+
+// UnmarshalBinary decodes the state from the versioned binary format.
+func (s *tokenBucketState) UnmarshalBinary(b []byte) error {
+	version, err := checkStateHeader(b, stateTypeTokenBucket)
+	if err != nil {
+		return err
+	}
+	s.Tokens = math.Float64frombits(binary.BigEndian.Uint64(b[2:]))
+	s.LastRefill = fromUnixNano(int64(binary.BigEndian.Uint64(b[10:])))
+	s.LastSave = fromUnixNano(int64(binary.BigEndian.Uint64(b[18:])))
+	s.Created = fromUnixNano(int64(binary.BigEndian.Uint64(b[26:])))
+	s.Fingerprint = 0
+	if version >= stateVersion2 {
+		s.Fingerprint = binary.BigEndian.Uint32(b[34:])
+	}
+	s.Grant, s.GrantExpiry = decodeGrant(b, version)
+	return nil
+}
+
+// MarshalJSON encodes the state as versioned JSON.
+func (s *tokenBucketState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tokenBucketStateJSON{
+		Version:     int(stateVersion1),
+		Type:        TokenBucketName,
+		Tokens:      s.Tokens,
+		LastRefill:  toUnixNano(s.LastRefill),
+		LastSave:    toUnixNano(s.LastSave),
+		Created:     toUnixNano(s.Created),
+		Fingerprint: s.Fingerprint,
+		Grant:       int64(s.Grant),
+		GrantExpiry: toUnixNano(s.GrantExpiry),
+	})
+}
+
+// UnmarshalJSON decodes the state from versioned JSON.
+func (s *tokenBucketState) UnmarshalJSON(b []byte) error {
+	var j tokenBucketStateJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return ErrInvalidState
+	}
+	if j.Type != TokenBucketName {
+		return ErrInvalidState
+	}
+	if j.Version != int(stateVersion1) {
+		return ErrUnsupportedStateVersion
+	}
+	s.Tokens = j.Tokens
+	s.LastRefill = fromUnixNano(j.LastRefill)
+	s.LastSave = fromUnixNano(j.LastSave)
+	s.Created = fromUnixNano(j.Created)
+	s.Fingerprint = j.Fingerprint
+	s.Grant = int(j.Grant)
+	s.GrantExpiry = fromUnixNano(j.GrantExpiry)
+	return nil
+}
+
+// MarshalBinary encodes the state in the versioned binary format.
+func (s *slidingWindowState) MarshalBinary() ([]byte, error) {
+	b := newStateBuffer(stateTypeSlidingWindow, s.Grant, s.GrantExpiry)
+	binary.BigEndian.PutUint64(b[2:], uint64(s.PrevCount))
+	binary.BigEndian.PutUint64(b[10:], uint64(s.CurrCount))
+	binary.BigEndian.PutUint64(b[18:], uint64(toUnixNano(s.WindowStart)))
+	binary.BigEndian.PutUint64(b[26:], uint64(toUnixNano(s.LastSave)))
+	binary.BigEndian.PutUint32(b[34:], s.Fingerprint)
+	return b, nil
+}
+
+// UnmarshalBinary decodes the state from the versioned binary format.
+func (s *slidingWindowState) UnmarshalBinary(b []byte) error {
+	version, err := checkStateHeader(b, stateTypeSlidingWindow)
+	if err != nil {
+		return err
+	}
+	s.PrevCount = int(int64(binary.BigEndian.Uint64(b[2:])))
+	s.CurrCount = int(int64(binary.BigEndian.Uint64(b[10:])))
+	s.WindowStart = fromUnixNano(int64(binary.BigEndian.Uint64(b[18:])))
+	s.LastSave = fromUnixNano(int64(binary.BigEndian.Uint64(b[26:])))
+	s.Fingerprint = 0
+	if version >= stateVersion2 {
+		s.Fingerprint = binary.BigEndian.Uint32(b[34:])
+	}
+	s.Grant, s.GrantExpiry = decodeGrant(b, version)
+	return nil
+}
+
+// MarshalJSON encodes the state as versioned JSON.
+func (s *slidingWindowState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(slidingWindowStateJSON{
+		Version:     int(stateVersion1),
+		Type:        SlidingWindowName,
+		PrevCount:   int64(s.PrevCount),
+		CurrCount:   int64(s.CurrCount),
+		WindowStart: toUnixNano(s.WindowStart),
+		LastSave:    toUnixNano(s.LastSave),
+		Fingerprint: s.Fingerprint,
+		Grant:       int64(s.Grant),
+		GrantExpiry: toUnixNano(s.GrantExpiry),
+	})
+}
+
+// UnmarshalJSON decodes the state from versioned JSON.
+func (s *slidingWindowState) UnmarshalJSON(b []byte) error {
+	var j slidingWindowStateJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return ErrInvalidState
+	}
+	if j.Type != SlidingWindowName {
+		return ErrInvalidState
+	}
+	if j.Version != int(stateVersion1) {
+		return ErrUnsupportedStateVersion
+	}
+	s.PrevCount = int(j.PrevCount)
+	s.CurrCount = int(j.CurrCount)
+	s.WindowStart = fromUnixNano(j.WindowStart)
+	s.LastSave = fromUnixNano(j.LastSave)
+	s.Fingerprint = j.Fingerprint
+	s.Grant = int(j.Grant)
+	s.GrantExpiry = fromUnixNano(j.GrantExpiry)
+	return nil
+}
+
+// decodeState decodes binary or JSON encoded state into dst.
+func decodeState(b []byte, dst interface {
+	UnmarshalBinary([]byte) error
+	UnmarshalJSON([]byte) error
+}) error {
+	if len(b) > 0 && b[0] == '{' {
+		return dst.UnmarshalJSON(b)
+	}
+	return dst.UnmarshalBinary(b)
+}
+
+// checkStateHeader validates the type and size of binary encoded state and
+// returns its version.
+func checkStateHeader(b []byte, stateType byte) (byte, error) {
+	if len(b) < stateHeaderSize || b[0] != stateType {
+		return 0, ErrInvalidState
+	}
+	size := stateV1Size
+	switch b[1] {
+	case stateVersion1:
+	case stateVersion2:
+		size = stateV2Size
+	case stateVersion3:
+		size = stateV3Size
+	default:
+		return 0, ErrUnsupportedStateVersion
+	}
+	if len(b) < size {
+		return 0, ErrInvalidState
+	}
+	return b[1], nil
+}
+
+// newStateBuffer returns a buffer for binary encoded state with its header
+// set: version 3 with the grant fields encoded if the state has a grant,
+// version 2 otherwise.
+func newStateBuffer(stateType byte, grant int, expiry time.Time) []byte {
+	if grant == 0 {
+		b := make([]byte, stateV2Size)
+		b[0], b[1] = stateType, stateVersion2
+		return b
+	}
+	b := make([]byte, stateV3Size)
+	b[0], b[1] = stateType, stateVersion3
+	binary.BigEndian.PutUint64(b[stateV2Size:], uint64(grant))
+	binary.BigEndian.PutUint64(b[stateV2Size+8:], uint64(toUnixNano(expiry)))
+	return b
+}
+
+// decodeGrant returns the grant fields of binary encoded state.
+func decodeGrant(b []byte, version byte) (int, time.Time) {
+	if version < stateVersion3 {
+		return 0, time.Time{}
+	}
+	return int(int64(binary.BigEndian.Uint64(b[stateV2Size:]))),
+		fromUnixNano(int64(binary.BigEndian.Uint64(b[stateV2Size+8:])))
+}
+
+// toUnixNano converts t to Unix nanoseconds, mapping the zero time to 0.
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano converts Unix nanoseconds to a time, mapping 0 to the zero time.
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
@@ -0,0 +1,376 @@
+package algorithms
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// encodingStore simulates a remote store that only keeps encoded bytes.
+type encodingStore struct {
+	mu    sync.Mutex
+	data  map[string][]byte
+	codec store.Codec
+}
+
+func newEncodingStore(codec store.Codec) *encodingStore {
+	return &encodingStore{data: make(map[string][]byte), codec: codec}
+}
+
+func (s *encodingStore) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+	v, err := s.codec.Unmarshal(b)
+	if err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+func (s *encodingStore) Set(key string, value interface{}, ttl time.Duration) error {
+	b, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = b
+	return nil
+}
+
+func (s *encodingStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *encodingStore) Close() error { return nil }
+
+func TestStateCodec_RoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+
+	tb := &tokenBucketState{Tokens: 2.5, LastRefill: now, Created: now.Add(-time.Minute)}
+	sw := &slidingWindowState{PrevCount: 7, CurrCount: 3, WindowStart: now}
+
+	for _, useJSON := range []bool{false, true} {
+		var tbData, swData []byte
+		var err error
+		if useJSON {
+			tbData, err = tb.MarshalJSON()
+			if err == nil {
+				swData, err = sw.MarshalJSON()
+			}
+		} else {
+			tbData, err = tb.MarshalBinary()
+			if err == nil {
+				swData, err = sw.MarshalBinary()
+			}
+		}
+		if err != nil {
+			t.Fatalf("Marshal (json=%v) failed: %v", useJSON, err)
+		}
+
+		var gotTB tokenBucketState
+		if err := decodeState(tbData, &gotTB); err != nil {
+			t.Fatalf("Decode token bucket (json=%v) failed: %v", useJSON, err)
+		}
+		if gotTB.Tokens != tb.Tokens || !gotTB.LastRefill.Equal(tb.LastRefill) ||
+			!gotTB.Created.Equal(tb.Created) || !gotTB.LastSave.IsZero() {
+			t.Errorf("Token bucket round trip (json=%v) = %+v, want %+v", useJSON, gotTB, *tb)
+		}
+
+		var gotSW slidingWindowState
+		if err := decodeState(swData, &gotSW); err != nil {
+			t.Fatalf("Decode sliding window (json=%v) failed: %v", useJSON, err)
+		}
+		if gotSW.PrevCount != sw.PrevCount || gotSW.CurrCount != sw.CurrCount ||
+			!gotSW.WindowStart.Equal(sw.WindowStart) {
+			t.Errorf("Sliding window round trip (json=%v) = %+v, want %+v", useJSON, gotSW, *sw)
+		}
+	}
+}
+
+func TestStateCodec_Invalid(t *testing.T) {
+	tbData, _ := (&tokenBucketState{Tokens: 1}).MarshalBinary()
+
+	unknownVersion := append([]byte(nil), tbData...)
+	unknownVersion[1] = 99
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"empty", nil, ErrInvalidState},
+		{"truncated", tbData[:10], ErrInvalidState},
+		{"wrong type", append([]byte{stateTypeSlidingWindow}, tbData[1:]...), ErrInvalidState},
+		{"unknown version", unknownVersion, ErrUnsupportedStateVersion},
+		{"json wrong type", []byte(`{"v":1,"type":"sliding_window"}`), ErrInvalidState},
+		{"json unknown version", []byte(`{"v":2,"type":"token_bucket"}`), ErrUnsupportedStateVersion},
+		{"json malformed", []byte(`{"v":`), ErrInvalidState},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s tokenBucketState
+			if err := decodeState(tt.data, &s); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStateCodec_EncodedStore(t *testing.T) {
+	config := ratelimiter.Config{Rate: 3, Window: time.Minute}
+
+	codecs := []store.Codec{store.BinaryCodec, store.JSONCodec, store.MsgpackCodec, store.ProtobufCodec}
+	for _, codec := range codecs {
+		tb, _ := NewTokenBucket(config, newEncodingStore(codec))
+		sw, _ := NewSlidingWindow(config, newEncodingStore(codec))
+
+		for _, l := range []ratelimiter.Limiter{tb, sw} {
+			for i := 0; i < 3; i++ {
+				if ok, err := l.Allow("key"); !ok || err != nil {
+					t.Fatalf("%s: request %d should be allowed, got %v, %v", codec.Name(), i+1, ok, err)
+				}
+			}
+			if ok, _ := l.Allow("key"); ok {
+				t.Errorf("%s: request 4 should be denied after state round trips", codec.Name())
+			}
+		}
+	}
+}
+
+type snapshotLimiter interface {
+	ratelimiter.Limiter
+	Snapshot(io.Writer) error
+	RestoreSnapshot(io.Reader) error
+}
+
+func TestSnapshot_RestoreAcrossRestart(t *testing.T) {
+	config := ratelimiter.Config{Rate: 5, Window: time.Hour}
+
+	constructors := map[string]func(store.Store) (snapshotLimiter, error){
+		TokenBucketName: func(s store.Store) (snapshotLimiter, error) {
+			return NewTokenBucket(config, s)
+		},
+		SlidingWindowName: func(s store.Store) (snapshotLimiter, error) {
+			return NewSlidingWindow(config, s)
+		},
+	}
+
+	for name, newLimiter := range constructors {
+		t.Run(name, func(t *testing.T) {
+			before := store.NewMemoryStore()
+			defer before.Close()
+			l, _ := newLimiter(before)
+
+			for i := 0; i < 3; i++ {
+				l.Allow("key")
+			}
+
+			var buf bytes.Buffer
+			if err := l.Snapshot(&buf); err != nil {
+				t.Fatalf("Snapshot failed: %v", err)
+			}
+
+			after := store.NewMemoryStore()
+			defer after.Close()
+			restored, _ := newLimiter(after)
+			if err := restored.RestoreSnapshot(&buf); err != nil {
+				t.Fatalf("RestoreSnapshot failed: %v", err)
+			}
+
+			// The remaining 2 requests are allowed and then consumed for good
+			for i := 0; i < 2; i++ {
+				if ok, _ := restored.Allow("key"); !ok {
+					t.Fatalf("Request %d after restore should be allowed", i+1)
+				}
+			}
+			if ok, _ := restored.Allow("key"); ok {
+				t.Error("Expected limit to survive the restart")
+			}
+		})
+	}
+}
+
+func TestSnapshot_NotSupported(t *testing.T) {
+	tb, _ := NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Second}, newSlowStore(0))
+	if err := tb.Snapshot(io.Discard); !errors.Is(err, ratelimiter.ErrNotSupported) {
+		t.Errorf("Expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestStateCodec_Fingerprint(t *testing.T) {
+	state := &tokenBucketState{Tokens: 1, LastRefill: time.Unix(1700000000, 0), Fingerprint: 0xdeadbeef}
+
+	for _, codec := range []store.Codec{store.BinaryCodec, store.JSONCodec, store.MsgpackCodec, store.ProtobufCodec} {
+		data, err := codec.Marshal(state)
+		if err != nil {
+			t.Fatalf("%s: Marshal failed: %v", codec.Name(), err)
+		}
+		v, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: Unmarshal failed: %v", codec.Name(), err)
+		}
+		var got tokenBucketState
+		if err := decodeState(v.([]byte), &got); err != nil {
+			t.Fatalf("%s: decode failed: %v", codec.Name(), err)
+		}
+		if got.Fingerprint != state.Fingerprint {
+			t.Errorf("%s: fingerprint = %x, want %x", codec.Name(), got.Fingerprint, state.Fingerprint)
+		}
+	}
+
+	// Version 1 state has no fingerprint
+	v2, _ := state.MarshalBinary()
+	v1 := append([]byte(nil), v2[:stateV1Size]...)
+	v1[1] = stateVersion1
+	var got tokenBucketState
+	if err := decodeState(v1, &got); err != nil || got.Fingerprint != 0 || got.Tokens != 1 {
+		t.Errorf("Expected version 1 state to decode without a fingerprint, got %+v (err %v)", got, err)
+	}
+}
+
+func TestStateCodec_Grant(t *testing.T) {
+	expiry := time.Unix(1700003600, 0)
+	tb := &tokenBucketState{Tokens: 1, Grant: 50, GrantExpiry: expiry}
+	sw := &slidingWindowState{CurrCount: 2, Grant: 50, GrantExpiry: expiry}
+
+	for _, codec := range []store.Codec{store.BinaryCodec, store.JSONCodec, store.MsgpackCodec, store.ProtobufCodec} {
+		for _, state := range []any{tb, sw} {
+			data, err := codec.Marshal(state)
+			if err != nil {
+				t.Fatalf("%s: Marshal failed: %v", codec.Name(), err)
+			}
+			v, err := codec.Unmarshal(data)
+			if err != nil {
+				t.Fatalf("%s: Unmarshal failed: %v", codec.Name(), err)
+			}
+			var grant int
+			var grantExpiry time.Time
+			switch state.(type) {
+			case *tokenBucketState:
+				var got tokenBucketState
+				err = decodeState(v.([]byte), &got)
+				grant, grantExpiry = got.Grant, got.GrantExpiry
+			case *slidingWindowState:
+				var got slidingWindowState
+				err = decodeState(v.([]byte), &got)
+				grant, grantExpiry = got.Grant, got.GrantExpiry
+			}
+			if err != nil || grant != 50 || !grantExpiry.Equal(expiry) {
+				t.Errorf("%s: %T grant = %d until %v (err %v), want 50 until %v", codec.Name(), state, grant, grantExpiry, err, expiry)
+			}
+		}
+	}
+
+	// State without a grant stays readable by version 2 decoders
+	if b, _ := (&tokenBucketState{Tokens: 1}).MarshalBinary(); b[1] != stateVersion2 || len(b) != stateV2Size {
+		t.Errorf("State without a grant encoded as version %d (%d bytes), want version 2", b[1], len(b))
+	}
+	if b, _ := tb.MarshalBinary(); b[1] != stateVersion3 || len(b) != stateV3Size {
+		t.Errorf("State with a grant encoded as version %d (%d bytes), want version 3", b[1], len(b))
+	}
+}
+
+func TestStateCodec_Backoff(t *testing.T) {
+	state := &backoffState{Violations: 3, LastViolation: time.Unix(1700000000, 0), BlockedUntil: time.Unix(1700000004, 0)}
+
+	for _, codec := range []store.Codec{store.BinaryCodec, store.JSONCodec, store.MsgpackCodec, store.ProtobufCodec} {
+		data, err := codec.Marshal(state)
+		if err != nil {
+			t.Fatalf("%s: Marshal failed: %v", codec.Name(), err)
+		}
+		v, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: Unmarshal failed: %v", codec.Name(), err)
+		}
+		var got backoffState
+		if err := decodeState(v.([]byte), &got); err != nil || got.Violations != 3 ||
+			!got.LastViolation.Equal(state.LastViolation) || !got.BlockedUntil.Equal(state.BlockedUntil) {
+			t.Errorf("%s: got %+v (err %v), want %+v", codec.Name(), got, err, *state)
+		}
+
+		// The backoff applies on stores encoding with the codec
+		s := newEncodingStore(codec)
+		tb, _ := NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Hour, BurstSize: 1}, s)
+		b := NewBackoff(tb, s, BackoffConfig{})
+		b.Allow("k")
+		for i := 0; i < 2; i++ {
+			if _, err := b.AllowNWithDetails("k", 1); err != nil {
+				t.Fatalf("%s: AllowNWithDetails failed: %v", codec.Name(), err)
+			}
+		}
+		if got := b.Violations("k"); got != 2 {
+			t.Errorf("%s: Violations = %d, want 2", codec.Name(), got)
+		}
+	}
+}
+
+func TestStateCodec_Greylist(t *testing.T) {
+	state := &greylistState{FirstSeen: time.Unix(1700000000, 0), LastSeen: time.Unix(1700003600, 0)}
+
+	for _, codec := range []store.Codec{store.BinaryCodec, store.JSONCodec, store.MsgpackCodec, store.ProtobufCodec} {
+		data, err := codec.Marshal(state)
+		if err != nil {
+			t.Fatalf("%s: Marshal failed: %v", codec.Name(), err)
+		}
+		v, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: Unmarshal failed: %v", codec.Name(), err)
+		}
+		var got greylistState
+		if err := decodeState(v.([]byte), &got); err != nil ||
+			!got.FirstSeen.Equal(state.FirstSeen) || !got.LastSeen.Equal(state.LastSeen) {
+			t.Errorf("%s: got %+v (err %v), want %+v", codec.Name(), got, err, *state)
+		}
+
+		// Keys graduate on stores encoding with the codec
+		s := newEncodingStore(codec)
+		_, clock := newTestEnv(t)
+		full := newTestTokenBucket(t, s, clock, 10, time.Hour)
+		provisional := newTestTokenBucket(t, s, clock, 1, time.Hour)
+		g := NewGreylist(full, provisional, s, GreylistConfig{Period: time.Minute})
+		g.now = clock.Now
+		if _, err := g.Allow("k"); err != nil {
+			t.Fatalf("%s: Allow failed: %v", codec.Name(), err)
+		}
+		clock.Advance(time.Minute)
+		if !g.Graduated("k") {
+			t.Errorf("%s: expected key to graduate after Period", codec.Name())
+		}
+	}
+}
+
+func TestStateSizes(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("State sizes are those of 64-bit platforms")
+	}
+	for _, tc := range []struct {
+		name string
+		got  int
+		want uintptr
+	}{
+		{"token bucket", (&tokenBucketState{}).Size(), unsafe.Sizeof(tokenBucketState{})},
+		{"sliding window", (&slidingWindowState{}).Size(), unsafe.Sizeof(slidingWindowState{})},
+		{"backoff", (&backoffState{}).Size(), unsafe.Sizeof(backoffState{})},
+		{"greylist", (&greylistState{}).Size(), unsafe.Sizeof(greylistState{})},
+	} {
+		if tc.got != int(tc.want) {
+			t.Errorf("%s: expected Size %d, got %d", tc.name, tc.want, tc.got)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package algorithms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// timeoutStore applies Config.StoreTimeout and Config.StoreRetries to the
+// operations of a store.ContextStore.
+type timeoutStore struct {
+	store.ContextStore
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+// wrapStore returns s wrapped with the store timeout and retry policy of
+// config, or s unchanged if no policy is set or s does not support contexts.
+func wrapStore(s store.Store, config ratelimiter.Config) store.Store {
+	if config.StoreTimeout <= 0 && config.StoreRetries <= 0 {
+		return s
+	}
+	cs, ok := s.(store.ContextStore)
+	if !ok {
+		return s
+	}
+	return &timeoutStore{
+		ContextStore: cs,
+		timeout:      config.StoreTimeout,
+		retries:      config.StoreRetries,
+		backoff:      config.StoreRetryBackoff,
+	}
+}
+
+// Get retrieves a value from the store. Failed lookups are reported as a
+// missing key once the retries or the timeout are exhausted.
+func (s *timeoutStore) Get(key string) (interface{}, bool) {
+	var val interface{}
+	var ok bool
+	_ = s.do(func(ctx context.Context) error {
+		var err error
+		val, ok, err = s.GetContext(ctx, key)
+		return err
+	})
+	return val, ok
+}
+
+// Set stores a value with an optional TTL.
+func (s *timeoutStore) Set(key string, value interface{}, ttl time.Duration) error {
+	return s.do(func(ctx context.Context) error {
+		return s.SetContext(ctx, key, value, ttl)
+	})
+}
+
+// Delete removes a value from the store.
+func (s *timeoutStore) Delete(key string) error {
+	return s.do(func(ctx context.Context) error {
+		return s.DeleteContext(ctx, key)
+	})
+}
+
+// Ping checks the underlying store.
+func (s *timeoutStore) Ping(ctx context.Context) error {
+	return store.Ping(ctx, s.ContextStore)
+}
+
+// do runs op within the timeout, retrying retryable errors with
+// exponential backoff until the retries or the timeout are exhausted.
+func (s *timeoutStore) do(op func(ctx context.Context) error) error {
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err := op(ctx)
+		if err == nil || attempt >= s.retries || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// retryable reports whether a store error may go away on retry.
+func retryable(err error) bool {
+	switch {
+	case errors.Is(err, store.ErrKeyTooLong),
+		errors.Is(err, store.ErrStoreFull),
+		errors.Is(err, store.ErrCASConflict),
+		errors.Is(err, store.ErrCircuitOpen):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package algorithms
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// contextStore is a slowStore that honors contexts and can fail the first sets.
+type contextStore struct {
+	*slowStore
+	failSets atomic.Int64
+}
+
+func (s *contextStore) wait(ctx context.Context) error {
+	select {
+	case <-time.After(s.latency):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *contextStore) GetContext(ctx context.Context, key string) (interface{}, bool, error) {
+	s.gets.Add(1)
+	if err := s.wait(ctx); err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok, nil
+}
+
+func (s *contextStore) SetContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	s.sets.Add(1)
+	if s.failSets.Add(-1) >= 0 {
+		return errors.New("connection reset")
+	}
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+func (s *contextStore) DeleteContext(ctx context.Context, key string) error {
+	return s.Delete(key)
+}
+
+func TestStoreTimeout(t *testing.T) {
+	s := &contextStore{slowStore: newSlowStore(200 * time.Millisecond)}
+	config := ratelimiter.Config{Rate: 10, Window: time.Minute, StoreTimeout: 10 * time.Millisecond}
+
+	for _, l := range []ratelimiter.Limiter{
+		mustTokenBucket(t, config, s),
+		mustSlidingWindow(t, config, s),
+	} {
+		start := time.Now()
+		_, err := l.Allow("key")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%T: expected deadline exceeded, got %v", l, err)
+		}
+		// One timeout for Get and one for Set
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("%T: expected the store timeout to bound the call, took %v", l, elapsed)
+		}
+	}
+}
+
+func TestStoreRetries(t *testing.T) {
+	s := &contextStore{slowStore: newSlowStore(0)}
+	s.failSets.Store(2)
+
+	tb := mustTokenBucket(t, ratelimiter.Config{
+		Rate:              10,
+		Window:            time.Minute,
+		StoreRetries:      2,
+		StoreRetryBackoff: time.Millisecond,
+	}, s)
+
+	allowed, err := tb.Allow("key")
+	if err != nil || !allowed {
+		t.Fatalf("Expected the retried Set to succeed, got %v, %v", allowed, err)
+	}
+	if got := s.sets.Load(); got != 3 {
+		t.Errorf("Expected 3 Set attempts, got %d", got)
+	}
+
+	s.failSets.Store(3)
+	if _, err := tb.Allow("key"); err == nil {
+		t.Error("Expected an error once the retries are exhausted")
+	}
+}
+
+func TestStoreRetries_NotRetryable(t *testing.T) {
+	if retryable(store.ErrKeyTooLong) || retryable(store.ErrCASConflict) || retryable(store.ErrCircuitOpen) {
+		t.Error("Expected permanent store errors not to be retried")
+	}
+	if !retryable(errors.New("connection reset")) {
+		t.Error("Expected transient errors to be retried")
+	}
+}
+
+func TestStoreTimeout_IgnoredWithoutContextStore(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	config := ratelimiter.Config{Rate: 10, Window: time.Minute, StoreTimeout: time.Millisecond}
+	if wrapStore(s, config) != store.Store(s) {
+		t.Error("Expected stores without context support to be used directly")
+	}
+}
+
+func mustTokenBucket(t *testing.T, config ratelimiter.Config, s store.Store) *TokenBucket {
+	t.Helper()
+	tb, err := NewTokenBucket(config, s)
+	if err != nil {
+		t.Fatalf("NewTokenBucket failed: %v", err)
+	}
+	return tb
+}
+
+func mustSlidingWindow(t *testing.T, config ratelimiter.Config, s store.Store) *SlidingWindow {
+	t.Helper()
+	sw, err := NewSlidingWindow(config, s)
+	if err != nil {
+		t.Fatalf("NewSlidingWindow failed: %v", err)
+	}
+	return sw
+}
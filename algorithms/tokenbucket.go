@@ -2,7 +2,9 @@
 package algorithms
 
 import (
+	"context"
 	"hash/maphash"
+	"io"
 	"sync"
 	"time"
 
@@ -15,46 +17,120 @@ type tokenBucketState struct {
 	Tokens     float64
 	LastRefill time.Time
 	LastSave   time.Time
+	Created    time.Time // First time the key was seen, used for warm-up
+
+	// Fingerprint identifies the config of the limiter that wrote the state
+	// (0 for state written before fingerprints existed).
+	Fingerprint uint32
+
+	// Grant is the extra capacity given by GrantN, usable until GrantExpiry.
+	Grant       int
+	GrantExpiry time.Time
+}
+
+// Size reports the memory held by the state, for store.Sizer: its size on
+// 64-bit platforms.
+func (s *tokenBucketState) Size() int {
+	return 120
 }
 
 const shardCount = 256
 
+// Algorithm names reported by the limiters in this package.
+const (
+	// TokenBucketName is the name reported by TokenBucket.Algorithm.
+	TokenBucketName = "token_bucket"
+
+	// SlidingWindowName is the name reported by SlidingWindow.Algorithm.
+	SlidingWindowName = "sliding_window"
+)
+
 // TokenBucket implements the token bucket rate limiting algorithm.
 // Tokens are added at a steady rate and consumed by requests.
 // This allows for controlled bursting while maintaining an average rate.
 type TokenBucket struct {
-	config           ratelimiter.Config
-	store            store.Store
-	nsStore          store.NamespacedStore
-	timeAwareStore   store.TimeAwareStore
-	nsTimeAwareStore store.NamespacedTimeAwareStore
-	mu               [shardCount]paddedMutex // Sharded mutexes to reduce contention
-	tokensPerNano    float64                 // Pre-calculated tokens/ns to avoid repetitive division
-	seed             maphash.Seed            // Seed for sharding hash
-	isPointerStore   bool                    // True if store supports pointer updates (e.g., MemoryStore)
+	config ratelimiter.Config
+	storeViews
+	replica        *storeViews        // Serves Remaining when set by WithReplicaReads
+	mu             []paddedMutex      // Sharded mutexes to reduce contention
+	now            func() time.Time   // Clock, time.Now unless set by WithClock
+	metrics        Metrics            // Non-nil when set by WithMetrics
+	fingerprint    uint32             // Fingerprint of the config, stored with the state
+	mismatch       MismatchPolicy     // What to do with state of another config
+	scale          *ratelimiter.Scale // Multiplier of Rate and BurstSize, see WithScale
+	namespace      string             // Store namespace of the state, "tb" or "<WithNamespace>:tb"
+	keyPrefix      string             // namespace + ":", the prefix of store keys
+	tokensPerNano  float64            // Pre-calculated tokens/ns to avoid repetitive division
+	stepTokens     float64            // Tokens added per RefillInterval (stepped refill)
+	seed           maphash.Seed       // Seed for sharding hash
+	isPointerStore bool               // True if store supports pointer updates (e.g., MemoryStore)
+	coalescer      *coalescer         // Non-nil when per-key request coalescing is enabled
+	maxCost        int                // Largest n that can ever be allowed
+	ttl            time.Duration      // TTL of the state of a key
+	saveInterval   time.Duration      // Longest time between saves of in-memory state
 }
 
 // NewTokenBucket creates a new token bucket rate limiter.
-func NewTokenBucket(config ratelimiter.Config, s store.Store) (*TokenBucket, error) {
+func NewTokenBucket(config ratelimiter.Config, s store.Store, opts ...Option) (*TokenBucket, error) {
+	o := newOptions(&config, opts)
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
 
 	// Default burst size to rate if not set
 	if config.BurstSize == 0 {
 		config.BurstSize = config.Rate
 	}
 
+	if config.WarmupPeriod > 0 {
+		if config.WarmupBurst == 0 {
+			config.WarmupBurst = 1
+		}
+		if config.WarmupBurst > config.BurstSize {
+			config.WarmupBurst = config.BurstSize
+		}
+	}
+
 	// Calculate tokens per nanosecond
 	// Rate is tokens/window. Window is duration.
 	// tokensPerNano = Rate / Window.Nanoseconds()
 	tokensPerNano := float64(config.Rate) / float64(config.Window.Nanoseconds())
 
+	// Remote stores: bound store calls by StoreTimeout and StoreRetries
+	replica := wrapStore(o.replicaOf(s), config)
+	s = wrapStore(s, config)
+
 	tb := &TokenBucket{
 		config:        config,
-		store:         s,
+		storeViews:    newStoreViews(s),
 		tokensPerNano: tokensPerNano,
 		seed:          maphash.MakeSeed(),
+		mu:            make([]paddedMutex, o.shards),
+		now:           o.now,
+		metrics:       o.metrics,
+		namespace:     o.namespace("tb"),
+		mismatch:      o.mismatch,
+		scale:         o.scale,
+	}
+
+	tb.keyPrefix = tb.namespace + ":"
+	tb.fingerprint = configFingerprint(TokenBucketName, config)
+	tb.ttl, tb.saveInterval = stateTTL(config, 2)
+
+	if config.RefillInterval > 0 {
+		tb.stepTokens = float64(config.Rate) * float64(config.RefillInterval) / float64(config.Window)
+	}
+
+	tb.maxCost = config.BurstSize + config.MaxDebt
+	if config.MaxCost > 0 && config.MaxCost < tb.maxCost {
+		tb.maxCost = config.MaxCost
+	}
+
+	if config.CoalesceWindow > 0 {
+		tb.coalescer = newCoalescer(config.CoalesceWindow)
 	}
 
 	// Optimization: if store is MemoryStore, we can update state in-place via pointer
@@ -63,15 +139,9 @@ func NewTokenBucket(config ratelimiter.Config, s store.Store) (*TokenBucket, err
 		tb.isPointerStore = true
 	}
 
-	if ns, ok := s.(store.NamespacedStore); ok {
-		tb.nsStore = ns
-	}
-
-	if tas, ok := s.(store.TimeAwareStore); ok {
-		tb.timeAwareStore = tas
-	}
-	if nstas, ok := s.(store.NamespacedTimeAwareStore); ok {
-		tb.nsTimeAwareStore = nstas
+	if replica != nil {
+		views := newStoreViews(replica)
+		tb.replica = &views
 	}
 
 	return tb, nil
@@ -90,8 +160,38 @@ func (tb *TokenBucket) AllowN(key string, n int) (bool, error) {
 
 // AllowNWithDetails checks if n requests are allowed and returns detailed result.
 func (tb *TokenBucket) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	if tb.metrics == nil {
+		return tb.allowN(key, n)
+	}
+	start := time.Now()
+	result, err := tb.allowN(key, n)
+	tb.metrics.ObserveCheck(TokenBucketName, result, time.Since(start), err)
+	return result, err
+}
+
+// allowN checks if n requests are allowed.
+func (tb *TokenBucket) allowN(key string, n int) (ratelimiter.Result, error) {
+	f := tb.factor()
 	if n <= 0 {
-		return ratelimiter.Result{Allowed: true, Limit: tb.config.Rate, Remaining: int(tb.config.BurstSize)}, nil
+		return ratelimiter.Result{
+			Allowed:   true,
+			Limit:     ratelimiter.ScaleLimit(tb.config.Rate, f),
+			Remaining: ratelimiter.ScaleLimit(tb.config.BurstSize, f),
+			Burst:     ratelimiter.ScaleLimit(tb.config.BurstSize, f),
+			Window:    tb.config.Window,
+		}, nil
+	}
+
+	if n > tb.scaledMaxCost(f) {
+		return ratelimiter.Result{
+			Limit:  ratelimiter.ScaleLimit(tb.config.Rate, f),
+			Burst:  ratelimiter.ScaleLimit(tb.config.BurstSize, f),
+			Window: tb.config.Window,
+		}, ratelimiter.ErrCostExceedsCapacity
+	}
+
+	if tb.coalescer != nil {
+		return tb.coalescer.do(key, n, tb.getLock(key), tb.allowBatch)
 	}
 
 	var storeKey string
@@ -105,68 +205,197 @@ func (tb *TokenBucket) AllowNWithDetails(key string, n int) (ratelimiter.Result,
 	mu.Lock()
 	defer mu.Unlock()
 
-	now := time.Now()
-	state := tb.getState(key, storeKey, useNS, now)
+	now := tb.now()
+	state, err := tb.getState(key, storeKey, useNS, now)
+	if err != nil {
+		return ratelimiter.Result{}, err
+	}
+	result := tb.take(state, n, now)
 
-	// Refill tokens based on time elapsed
-	elapsed := now.Sub(state.LastRefill)
-	// Optimization: Use multiplication instead of Duration.Seconds() which involves division
-	tokensToAdd := float64(elapsed) * tb.tokensPerNano
+	if err := tb.persist(key, storeKey, useNS, state, now, result.Allowed); err != nil {
+		return ratelimiter.Result{}, err
+	}
+	return result, nil
+}
+
+// allowBatch evaluates a batch of coalesced requests against a single state load.
+// The caller must hold the lock for key.
+func (tb *TokenBucket) allowBatch(key string, ns []int, results []ratelimiter.Result) error {
+	var storeKey string
+	useNS := tb.nsStore != nil
+	if !useNS {
+		storeKey = tb.storeKey(key)
+	}
+
+	now := tb.now()
+	state, err := tb.getState(key, storeKey, useNS, now)
+	if err != nil {
+		return err
+	}
 
-	state.Tokens += tokensToAdd
-	if state.Tokens > float64(tb.config.BurstSize) {
-		state.Tokens = float64(tb.config.BurstSize)
+	anyAllowed := false
+	for i, n := range ns {
+		results[i] = tb.take(state, n, now)
+		anyAllowed = anyAllowed || results[i].Allowed
 	}
-	state.LastRefill = now
 
+	return tb.persist(key, storeKey, useNS, state, now, anyAllowed)
+}
+
+// take refills the bucket and tries to consume n tokens from state.
+// It mutates state in-place; the caller must hold the lock for the key.
+//
+// The state is kept in unscaled tokens, so that changing the scale does not
+// invalidate it: with a scale factor f, a request costs 1/f tokens.
+func (tb *TokenBucket) take(state *tokenBucketState, n int, now time.Time) ratelimiter.Result {
+	capacity := tb.capacity(state, now)
+	tb.refill(state, float64(capacity), now)
+
+	f := tb.factor()
+	burst := ratelimiter.ScaleLimit(capacity, f)
 	result := ratelimiter.Result{
-		Limit:   tb.config.Rate,
-		ResetAt: now.Add(tb.config.Window),
+		Limit:   ratelimiter.ScaleLimit(tb.config.Rate, f),
+		ResetAt: tb.resetAt(now),
+		Burst:   burst,
+		Window:  tb.config.Window,
 	}
 
-	// Check if we have enough tokens
-	if state.Tokens >= float64(n) {
-		state.Tokens -= float64(n)
+	// Check if we have enough tokens (allowing up to MaxDebt tokens of
+	// debt), drawing on an active grant for the shortfall
+	grant := activeGrant(state.Grant, state.GrantExpiry, now)
+	tokensNeeded := float64(n)/f - float64(tb.config.MaxDebt) - state.Tokens
+	granted, ok := fromGrant(n, tokensNeeded*f, grant)
+	if ok {
+		state.Tokens -= float64(n-granted) / f
+		state.Grant = grant - granted
 		result.Allowed = true
-		result.Remaining = int(state.Tokens)
+		result.Remaining = remainingTokens(state.Tokens*f) + state.Grant
+		result.Used = burst - int(state.Tokens*f)
+		return result
+	}
 
+	// Not enough tokens
+	result.Allowed = false
+	result.Remaining = remainingTokens(state.Tokens*f) + grant
+	result.Used = burst - int(state.Tokens*f)
+	if tokensNeeded > 0 {
+		result.RetryAfter = tb.refillWait(tokensNeeded, now)
+	}
+	result.RetryAfter = ratelimiter.AddJitter(result.RetryAfter, tb.config.RetryAfterJitter)
+	return result
+}
+
+// remainingTokens converts a token count to a remaining request count.
+// Buckets in debt have no remaining requests.
+func remainingTokens(tokens float64) int {
+	if tokens < 0 {
+		return 0
+	}
+	return int(tokens)
+}
+
+// factor returns the scale factor of the limits, raised if needed so that
+// scaling leaves room for at least 1 request.
+func (tb *TokenBucket) factor() float64 {
+	return max(tb.scale.Factor(), 1/float64(tb.config.BurstSize+tb.config.MaxDebt))
+}
+
+// scaledMaxCost returns the largest n that can ever be allowed with the scale
+// factor f.
+func (tb *TokenBucket) scaledMaxCost(f float64) int {
+	if f == 1 {
+		return tb.maxCost
+	}
+	maxCost := ratelimiter.ScaleLimit(tb.config.BurstSize+tb.config.MaxDebt, f)
+	if tb.config.MaxCost > 0 {
+		maxCost = min(maxCost, tb.config.MaxCost)
+	}
+	return maxCost
+}
+
+// capacity returns the current burst capacity of the bucket.
+// During warm-up it grows linearly from WarmupBurst to BurstSize.
+func (tb *TokenBucket) capacity(state *tokenBucketState, now time.Time) int {
+	if tb.config.WarmupPeriod <= 0 || state.Created.IsZero() {
+		return tb.config.BurstSize
+	}
+
+	age := now.Sub(state.Created)
+	if age >= tb.config.WarmupPeriod {
+		return tb.config.BurstSize
+	}
+
+	progress := float64(age) / float64(tb.config.WarmupPeriod)
+	extra := float64(tb.config.BurstSize-tb.config.WarmupBurst) * progress
+	return tb.config.WarmupBurst + int(extra)
+}
+
+// persist writes the state back to the store after a check.
+// When nothing was consumed only the TTL is refreshed.
+func (tb *TokenBucket) persist(key, storeKey string, useNS bool, state *tokenBucketState, now time.Time, consumed bool) error {
+	// Adopt state written before fingerprints existed
+	state.Fingerprint = tb.fingerprint
+
+	if consumed {
 		// Optimization: For in-memory stores, we can skip saving if the TTL is still fresh.
 		// Modifications to state are already visible via pointer.
 		// We save if it's a new key (LastSave is zero) or if enough time has passed.
 		shouldSave := true
 		if tb.isPointerStore && !state.LastSave.IsZero() {
-			// Update TTL at least once per window to ensure it doesn't expire.
-			// The TTL is set to 2x Window, so updating once per Window is sufficient.
-			if now.Sub(state.LastSave) < tb.config.Window {
+			// Update TTL often enough to ensure it doesn't expire.
+			if now.Sub(state.LastSave) < tb.saveInterval {
 				shouldSave = false
 			}
 		}
 
 		if shouldSave {
 			state.LastSave = now
-			if err := tb.saveState(key, storeKey, useNS, state, now); err != nil {
-				return ratelimiter.Result{}, err
-			}
+			return tb.saveState(key, storeKey, useNS, state, now)
 		}
-		return result, nil
-	}
-
-	// Not enough tokens
-	result.Allowed = false
-	result.Remaining = int(state.Tokens)
-	tokensNeeded := float64(n) - state.Tokens
-	if tokensNeeded > 0 {
-		result.RetryAfter = time.Duration(tokensNeeded / tb.tokensPerNano)
+		return nil
 	}
 
 	// Not enough tokens, save state and reject
 	// Optimization: If we reject, we can just update the TTL to keep the key alive
 	// without writing the full state (which requires allocation).
 	// We only fall back to full save if UpdateTTL is not supported or fails.
-	if err := tb.updateTTL(key, storeKey, useNS, now); err != nil {
+	// State with an active grant is saved to keep it until the grant expires.
+	if activeGrant(state.Grant, state.GrantExpiry, now) > 0 {
+		_ = tb.saveState(key, storeKey, useNS, state, now)
+	} else if err := tb.updateTTL(key, storeKey, useNS, now); err != nil {
 		_ = tb.saveState(key, storeKey, useNS, state, now)
 	}
-	return result, nil
+	return nil
+}
+
+// Config returns the effective configuration of the limiter.
+func (tb *TokenBucket) Config() ratelimiter.Config {
+	return tb.config
+}
+
+// Algorithm returns the name of the algorithm.
+func (tb *TokenBucket) Algorithm() string {
+	return TokenBucketName
+}
+
+// Snapshot writes the state of all keys to w, for example before a restart.
+// Checks are blocked while the snapshot is taken so that it is consistent.
+// It returns ratelimiter.ErrNotSupported if the store does not implement
+// store.Snapshotter.
+func (tb *TokenBucket) Snapshot(w io.Writer) error {
+	return snapshotStore(tb.store, tb.mu, w)
+}
+
+// RestoreSnapshot loads state written by Snapshot into the store.
+// It returns ratelimiter.ErrNotSupported if the store does not implement
+// store.Snapshotter.
+func (tb *TokenBucket) RestoreSnapshot(r io.Reader) error {
+	return restoreStore(tb.store, tb.mu, r)
+}
+
+// Ping checks that the backing store is reachable (see store.Pinger).
+func (tb *TokenBucket) Ping(ctx context.Context) error {
+	return store.Ping(ctx, tb.store)
 }
 
 // Reset clears the rate limit state for the given key.
@@ -176,75 +405,149 @@ func (tb *TokenBucket) Reset(key string) error {
 	defer mu.Unlock()
 
 	if tb.nsStore != nil {
-		return tb.nsStore.DeleteWithNamespace("tb", key)
+		return tb.nsStore.DeleteWithNamespace(tb.namespace, key)
 	}
 	return tb.store.Delete(tb.storeKey(key))
 }
 
-// Remaining returns the number of tokens remaining for the given key.
-func (tb *TokenBucket) Remaining(key string) int {
+// RefundN returns n tokens to the bucket of the given key, up to its capacity.
+func (tb *TokenBucket) RefundN(key string, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	var storeKey string
+	useNS := tb.nsStore != nil
+	if !useNS {
+		storeKey = tb.storeKey(key)
+	}
+
 	mu := tb.getLock(key)
 	mu.Lock()
 	defer mu.Unlock()
 
+	now := tb.now()
+	state, err := tb.getState(key, storeKey, useNS, now)
+	if err != nil {
+		return err
+	}
+	state.Tokens += float64(n) / tb.factor()
+	if capacity := float64(tb.capacity(state, now)); state.Tokens > capacity {
+		state.Tokens = capacity
+	}
+	return tb.persist(key, storeKey, useNS, state, now, true)
+}
+
+// Remaining returns the number of tokens remaining for the given key, or 0
+// if its state was written by a limiter with a different config and the
+// mismatch policy is MismatchError. It only takes the read lock of the key,
+// so frequent polling (e.g. by a dashboard) does not contend with itself;
+// getState does not modify the stored state. With WithReplicaReads, the
+// state is read from a replica of the store.
+func (tb *TokenBucket) Remaining(key string) int {
+	mu := tb.getLock(key)
+	mu.RLock()
+	defer mu.RUnlock()
+
+	views := &tb.storeViews
+	if tb.replica != nil {
+		views = tb.replica
+	}
 	var storeKey string
-	useNS := tb.nsStore != nil
+	useNS := views.nsStore != nil
 	if !useNS {
 		storeKey = tb.storeKey(key)
 	}
 
-	state := tb.getState(key, storeKey, useNS, time.Now())
-	return int(state.Tokens)
+	now := tb.now()
+	stored := tb.loadState(views, key, storeKey, useNS, now)
+	state, err := tb.resolveState(stored, now)
+	if err != nil {
+		return 0
+	}
+	return remainingTokens(state.Tokens*tb.factor()) + activeGrant(state.Grant, state.GrantExpiry, now)
 }
 
-// getState retrieves or initializes the token bucket state.
+// getState retrieves or initializes the token bucket state. State written
+// by a limiter with a different config is handled by the mismatch policy.
 // Optimization: Returns a pointer to avoid allocation when updating state in MemoryStore.
-func (tb *TokenBucket) getState(key, storeKey string, useNS bool, now time.Time) *tokenBucketState {
-	var val interface{}
-	var ok bool
+func (tb *TokenBucket) getState(key, storeKey string, useNS bool, now time.Time) (*tokenBucketState, error) {
+	return tb.resolveState(tb.loadState(&tb.storeViews, key, storeKey, useNS, now), now)
+}
 
-	if useNS {
-		if tb.nsTimeAwareStore != nil {
-			val, ok = tb.nsTimeAwareStore.GetWithNamespaceAt("tb", key, now)
-		} else {
-			val, ok = tb.nsStore.GetWithNamespace("tb", key)
+// resolveState returns the stored state, or the state of a new key if none
+// is stored or it belongs to another config.
+func (tb *TokenBucket) resolveState(state *tokenBucketState, now time.Time) (*tokenBucketState, error) {
+	if state != nil {
+		if fingerprintMatches(state.Fingerprint, tb.fingerprint) || tb.mismatch == MismatchAdopt {
+			return state, nil
 		}
-	} else {
-		if tb.timeAwareStore != nil {
-			val, ok = tb.timeAwareStore.GetAt(storeKey, now)
-		} else {
-			val, ok = tb.store.Get(storeKey)
+		if tb.mismatch == MismatchError {
+			return nil, ratelimiter.ErrConfigMismatch
 		}
 	}
 
-	if ok {
-		// Fast path: pointer (zero allocation for MemoryStore updates)
-		if state, ok := val.(*tokenBucketState); ok {
-			return state
-		}
-		// Fallback: value (handles migration or stores that return by value)
-		if state, ok := val.(tokenBucketState); ok {
-			return &state
-		}
+	if tb.config.WarmupPeriod > 0 {
+		// Slow start: new keys earn their full burst capacity over time
+		return &tokenBucketState{
+			Tokens:      float64(tb.config.WarmupBurst),
+			LastRefill:  now,
+			Created:     now,
+			Fingerprint: tb.fingerprint,
+		}, nil
 	}
 
 	// Initialize with full tokens
 	return &tokenBucketState{
-		Tokens:     float64(tb.config.BurstSize),
-		LastRefill: now,
+		Tokens:      float64(tb.config.BurstSize),
+		LastRefill:  now,
+		Fingerprint: tb.fingerprint,
+	}, nil
+}
+
+// loadState retrieves the token bucket state as stored, or nil if the key
+// has no state. The returned pointer may be the stored one: only modify it
+// while holding the write lock for the key.
+func (tb *TokenBucket) loadState(views *storeViews, key, storeKey string, useNS bool, now time.Time) *tokenBucketState {
+	val, ok := views.get(tb.namespace, key, storeKey, useNS, now)
+	if !ok {
+		return nil
+	}
+	return tokenBucketStateOf(val)
+}
+
+// tokenBucketStateOf converts a stored value to the token bucket state, or
+// nil if it holds none.
+func tokenBucketStateOf(val interface{}) *tokenBucketState {
+	// Fast path: pointer (zero allocation for MemoryStore updates)
+	if state, ok := val.(*tokenBucketState); ok {
+		return state
+	}
+	// Fallback: value (handles migration or stores that return by value)
+	if state, ok := val.(tokenBucketState); ok {
+		return &state
+	}
+	// Remote stores: encoded state (see state_codec.go)
+	if b, ok := val.([]byte); ok {
+		state := &tokenBucketState{}
+		if err := decodeState(b, state); err == nil {
+			// Not the stored pointer: force the next persist to store it
+			state.LastSave = time.Time{}
+			return state
+		}
 	}
+	return nil
 }
 
 // saveState persists the token bucket state.
 // Optimization: Takes a pointer to support zero-allocation updates in MemoryStore.
 func (tb *TokenBucket) saveState(key, storeKey string, useNS bool, state *tokenBucketState, now time.Time) error {
-	// Store with a TTL of 2x the window to allow for cleanup
-	ttl := tb.config.Window * 2
+	ttl := grantTTL(tb.ttl, state.Grant, state.GrantExpiry, now)
 	if useNS {
 		if tb.nsTimeAwareStore != nil {
-			return tb.nsTimeAwareStore.SetWithNamespaceAt("tb", key, state, ttl, now)
+			return tb.nsTimeAwareStore.SetWithNamespaceAt(tb.namespace, key, state, ttl, now)
 		}
-		return tb.nsStore.SetWithNamespace("tb", key, state, ttl)
+		return tb.nsStore.SetWithNamespace(tb.namespace, key, state, ttl)
 	}
 	if tb.timeAwareStore != nil {
 		return tb.timeAwareStore.SetAt(storeKey, state, ttl, now)
@@ -254,13 +557,13 @@ func (tb *TokenBucket) saveState(key, storeKey string, useNS bool, state *tokenB
 
 // updateTTL updates the expiration of the key without saving the state.
 func (tb *TokenBucket) updateTTL(key, storeKey string, useNS bool, now time.Time) error {
-	ttl := tb.config.Window * 2
+	ttl := tb.ttl
 	if useNS {
 		if tb.nsTimeAwareStore != nil {
-			return tb.nsTimeAwareStore.UpdateTTLWithNamespaceAt("tb", key, ttl, now)
+			return tb.nsTimeAwareStore.UpdateTTLWithNamespaceAt(tb.namespace, key, ttl, now)
 		}
 		if ttlStore, ok := tb.nsStore.(store.NamespacedTTLStore); ok {
-			return ttlStore.UpdateTTLWithNamespace("tb", key, ttl)
+			return ttlStore.UpdateTTLWithNamespace(tb.namespace, key, ttl)
 		}
 		// Fallback for stores that don't support NamespacedTTLStore but might support TTLStore (unlikely but possible)
 	} else {
@@ -277,11 +580,11 @@ func (tb *TokenBucket) updateTTL(key, storeKey string, useNS bool, now time.Time
 
 // storeKey generates the storage key for a rate limit key.
 func (tb *TokenBucket) storeKey(key string) string {
-	return "tb:" + key
+	return tb.keyPrefix + key
 }
 
 // getLock returns the mutex for the given key based on a hash.
-func (tb *TokenBucket) getLock(key string) *sync.Mutex {
-	idx := maphash.String(tb.seed, key) % shardCount
-	return &tb.mu[idx].Mutex
+func (tb *TokenBucket) getLock(key string) *sync.RWMutex {
+	idx := maphash.String(tb.seed, key) % uint64(len(tb.mu))
+	return &tb.mu[idx].RWMutex
 }
@@ -333,3 +333,266 @@ func TestTokenBucket_Concurrent(t *testing.T) {
 		t.Errorf("Expected max 100 allowed, got %d", allowedCount)
 	}
 }
+
+func TestTokenBucket_ResultDetails(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, err := NewTokenBucket(ratelimiter.Config{
+		Rate:      10,
+		Window:    time.Minute,
+		BurstSize: 5,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	result, err := tb.AllowNWithDetails("test", 2)
+	if err != nil {
+		t.Fatalf("AllowNWithDetails returned error: %v", err)
+	}
+	if result.Burst != 5 {
+		t.Errorf("Expected Burst=5, got %d", result.Burst)
+	}
+	if result.Window != time.Minute {
+		t.Errorf("Expected Window=1m, got %v", result.Window)
+	}
+	if result.Used != 2 {
+		t.Errorf("Expected Used=2, got %d", result.Used)
+	}
+	if result.Used+result.Remaining != result.Burst {
+		t.Errorf("Expected Used+Remaining=Burst, got %d+%d", result.Used, result.Remaining)
+	}
+}
+
+func TestTokenBucket_Describe(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, err := NewTokenBucket(ratelimiter.Config{
+		Rate:   10,
+		Window: time.Minute,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	var d ratelimiter.DescribableLimiter = tb
+	if d.Algorithm() != TokenBucketName {
+		t.Errorf("Expected algorithm %q, got %q", TokenBucketName, d.Algorithm())
+	}
+	cfg := d.Config()
+	if cfg.Rate != 10 || cfg.Window != time.Minute {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+	// Effective config has the defaulted burst size
+	if cfg.BurstSize != 10 {
+		t.Errorf("Expected effective BurstSize=10, got %d", cfg.BurstSize)
+	}
+}
+
+func TestTokenBucket_Warmup(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, err := NewTokenBucket(ratelimiter.Config{
+		Rate:         1000,
+		Window:       time.Second,
+		BurstSize:    10,
+		WarmupPeriod: 100 * time.Millisecond,
+		WarmupBurst:  2,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	// A fresh key cannot burst beyond WarmupBurst
+	result, err := tb.AllowNWithDetails("new", 5)
+	if err != nil {
+		t.Fatalf("AllowNWithDetails returned error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Expected burst of 5 to be denied during warm-up")
+	}
+	if result.Burst != 2 {
+		t.Errorf("Expected Burst=2 during warm-up, got %d", result.Burst)
+	}
+	if ok, _ := tb.AllowN("new", 2); !ok {
+		t.Error("Expected WarmupBurst requests to be allowed")
+	}
+
+	// After the warm-up period the full burst is available
+	time.Sleep(150 * time.Millisecond)
+	result, _ = tb.AllowNWithDetails("new", 10)
+	if !result.Allowed {
+		t.Error("Expected full burst after warm-up")
+	}
+	if result.Burst != 10 {
+		t.Errorf("Expected Burst=10 after warm-up, got %d", result.Burst)
+	}
+}
+
+func TestTokenBucket_WarmupDefaults(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, err := NewTokenBucket(ratelimiter.Config{
+		Rate:         10,
+		Window:       time.Hour,
+		WarmupPeriod: time.Hour,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+	if tb.Config().WarmupBurst != 1 {
+		t.Errorf("Expected default WarmupBurst=1, got %d", tb.Config().WarmupBurst)
+	}
+
+	if ok, _ := tb.Allow("new"); !ok {
+		t.Error("Expected first request to be allowed")
+	}
+	if ok, _ := tb.Allow("new"); ok {
+		t.Error("Expected second request to be denied during warm-up")
+	}
+}
+
+func TestTokenBucket_RetryAfterJitter(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, err := NewTokenBucket(ratelimiter.Config{
+		Rate:             1,
+		Window:           time.Hour,
+		RetryAfterJitter: time.Minute,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	tb.Allow("test")
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		result, _ := tb.AllowNWithDetails("test", 1)
+		if result.Allowed {
+			t.Fatal("Expected request to be denied")
+		}
+		// Base retry is just under one hour, jitter adds up to one minute
+		if result.RetryAfter < 59*time.Minute || result.RetryAfter >= 61*time.Minute {
+			t.Fatalf("RetryAfter out of bounds: %v", result.RetryAfter)
+		}
+		seen[result.RetryAfter.Truncate(time.Second)] = true
+	}
+	if len(seen) < 2 {
+		t.Error("Expected RetryAfter to be jittered")
+	}
+}
+
+func TestTokenBucket_Debt(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, err := NewTokenBucket(ratelimiter.Config{
+		Rate:      10,
+		Window:    time.Second,
+		BurstSize: 10,
+		MaxDebt:   3,
+	}, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	// Oversize request within the debt limit is allowed
+	result, _ := tb.AllowNWithDetails("test", 12)
+	if !result.Allowed {
+		t.Fatal("Expected oversize request within debt limit to be allowed")
+	}
+	if result.Remaining != 0 {
+		t.Errorf("Expected Remaining=0 while in debt, got %d", result.Remaining)
+	}
+	if result.Used != 12 {
+		t.Errorf("Expected Used=12 while in debt, got %d", result.Used)
+	}
+
+	// Debt must be paid back before new requests: -2 - 2 = -4 exceeds the debt limit
+	result, _ = tb.AllowNWithDetails("test", 2)
+	if result.Allowed {
+		t.Fatal("Expected request exceeding debt limit to be denied")
+	}
+	// Needs to get back to -1 (2 - 3): ~1 token at 10/s = ~100ms
+	if result.RetryAfter < 90*time.Millisecond || result.RetryAfter > 110*time.Millisecond {
+		t.Errorf("Expected RetryAfter ~100ms, got %v", result.RetryAfter)
+	}
+
+	if tb.Remaining("test") != 0 {
+		t.Errorf("Expected Remaining()=0 while in debt, got %d", tb.Remaining("test"))
+	}
+
+	// Requests beyond BurstSize+MaxDebt can never succeed
+	if ok, _ := tb.AllowN("other", 14); ok {
+		t.Error("Expected request above burst+debt to be denied")
+	}
+}
+
+func TestTokenBucket_RefundN(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	tb, _ := NewTokenBucket(ratelimiter.Config{Rate: 3, Window: time.Hour}, s)
+
+	tb.AllowN("key", 3)
+	if err := tb.RefundN("key", 2); err != nil {
+		t.Fatalf("RefundN failed: %v", err)
+	}
+	if got := tb.Remaining("key"); got != 2 {
+		t.Errorf("Expected 2 tokens after refund, got %d", got)
+	}
+
+	// Refunds are capped at the burst size
+	tb.RefundN("key", 10)
+	if got := tb.Remaining("key"); got != 3 {
+		t.Errorf("Expected refund capped at 3 tokens, got %d", got)
+	}
+}
+
+func TestTokenBucket_StateSize(t *testing.T) {
+	s := store.NewMemoryStoreWithConfig(store.MemoryStoreConfig{TrackMemory: true})
+	defer s.Close()
+
+	tb, _ := NewTokenBucket(ratelimiter.Config{Rate: 3, Window: time.Hour}, s)
+	tb.Allow("a")
+	tb.Allow("b")
+
+	if got, want := s.MemoryStats().ValueBytes, int64(2*(&tokenBucketState{}).Size()); got != want {
+		t.Errorf("Expected %d value bytes for two states, got %d", want, got)
+	}
+}
+
+func TestTokenBucket_FloatRate(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	config, err := ratelimiter.FloatRate(0.5, time.Second)
+	if err != nil {
+		t.Fatalf("FloatRate: %v", err)
+	}
+	tb, err := NewTokenBucket(config, s)
+	if err != nil {
+		t.Fatalf("Failed to create TokenBucket: %v", err)
+	}
+
+	now := time.Now()
+	state := &tokenBucketState{Tokens: float64(config.BurstSize), LastRefill: now}
+	if r := tb.take(state, 1, now); !r.Allowed {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	r := tb.take(state, 1, now.Add(time.Second))
+	if r.Allowed {
+		t.Fatal("Expected a second request within 2s to be denied")
+	}
+	if r.RetryAfter < time.Second-time.Millisecond || r.RetryAfter > time.Second {
+		t.Errorf("Expected RetryAfter~1s, got %v", r.RetryAfter)
+	}
+	if r := tb.take(state, 1, now.Add(2*time.Second)); !r.Allowed {
+		t.Error("Expected a request after 2s to be allowed")
+	}
+}
@@ -0,0 +1,80 @@
+package algorithms
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestStateTTL(t *testing.T) {
+	for _, tc := range []struct {
+		window, stateTTL time.Duration
+		windows          time.Duration
+		ttl, interval    time.Duration
+	}{
+		{time.Minute, 0, 2, 2 * time.Minute, time.Minute},
+		{time.Minute, 0, 3, 3 * time.Minute, time.Minute},
+		{time.Minute, 24 * time.Hour, 2, 24 * time.Hour, time.Minute},
+		{time.Hour, 10 * time.Minute, 3, 10 * time.Minute, 5 * time.Minute},
+	} {
+		ttl, interval := stateTTL(ratelimiter.Config{Window: tc.window, StateTTL: tc.stateTTL}, tc.windows)
+		if ttl != tc.ttl || interval != tc.interval {
+			t.Errorf("stateTTL(%v, %v, %d) = %v, %v, expected %v, %v", tc.window, tc.stateTTL, tc.windows, ttl, interval, tc.ttl, tc.interval)
+		}
+	}
+}
+
+func TestStateTTL_Algorithms(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		namespace string
+		create    func(ratelimiter.Config, store.Store) (ratelimiter.Limiter, error)
+	}{
+		{"token bucket", "tb", func(c ratelimiter.Config, s store.Store) (ratelimiter.Limiter, error) { return NewTokenBucket(c, s) }},
+		{"sliding window", "sw", func(c ratelimiter.Config, s store.Store) (ratelimiter.Limiter, error) { return NewSlidingWindow(c, s) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			defer s.Close()
+
+			// State outlives the default TTL of a few windows
+			long, err := tc.create(ratelimiter.Config{Rate: 1, Window: 10 * time.Millisecond, StateTTL: time.Hour}, s)
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+			long.Allow("long")
+
+			// State expires before the end of its window
+			short, err := tc.create(ratelimiter.Config{Rate: 1, Window: time.Hour, StateTTL: 20 * time.Millisecond}, s)
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+			short.Allow("short")
+
+			time.Sleep(60 * time.Millisecond)
+
+			if _, ok := s.GetWithNamespace(tc.namespace, "long"); !ok {
+				t.Error("Expected state with a long StateTTL to be kept")
+			}
+			if _, ok := s.GetWithNamespace(tc.namespace, "short"); ok {
+				t.Error("Expected state with a short StateTTL to expire")
+			}
+		})
+	}
+}
+
+func TestStateTTL_Invalid(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	config := ratelimiter.Config{Rate: 1, Window: time.Second, StateTTL: -time.Second}
+	if _, err := NewTokenBucket(config, s); !errors.Is(err, ratelimiter.ErrInvalidStateTTL) {
+		t.Errorf("Expected ErrInvalidStateTTL, got %v", err)
+	}
+	if _, err := NewSlidingWindow(config, s); !errors.Is(err, ratelimiter.ErrInvalidStateTTL) {
+		t.Errorf("Expected ErrInvalidStateTTL, got %v", err)
+	}
+}
@@ -1,11 +1,65 @@
 package algorithms
 
-import "sync"
+import (
+	"io"
+	"sync"
+	"time"
 
-// paddedMutex is a mutex with padding to avoid false sharing.
-// sync.Mutex is 8 bytes on 64-bit systems.
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// paddedMutex is a key lock with padding to avoid false sharing.
+// sync.RWMutex is 24 bytes on 64-bit systems.
 // We pad to 64 bytes (cache line size).
+//
+// Admission takes the write lock; read-only queries such as Remaining take
+// the read lock so that they do not serialize with each other.
 type paddedMutex struct {
-	sync.Mutex
-	_ [56]byte
+	sync.RWMutex
+	_ [40]byte
+}
+
+// lockAll locks every shard mutex, in order, and returns a function that unlocks them.
+func lockAll(mu []paddedMutex) func() {
+	for i := range mu {
+		mu[i].Lock()
+	}
+	return func() {
+		for i := range mu {
+			mu[i].Unlock()
+		}
+	}
+}
+
+// snapshotStore writes the content of s to w while all key locks are held.
+func snapshotStore(s store.Store, mu []paddedMutex, w io.Writer) error {
+	snap, ok := s.(store.Snapshotter)
+	if !ok {
+		return ratelimiter.ErrNotSupported
+	}
+	defer lockAll(mu)()
+	return snap.Snapshot(w)
+}
+
+// restoreStore loads a snapshot into s while all key locks are held.
+func restoreStore(s store.Store, mu []paddedMutex, r io.Reader) error {
+	snap, ok := s.(store.Snapshotter)
+	if !ok {
+		return ratelimiter.ErrNotSupported
+	}
+	defer lockAll(mu)()
+	return snap.RestoreSnapshot(r)
+}
+
+// stateTTL returns the TTL of the state of a key (Config.StateTTL, or
+// defaultWindows x Window) and the longest time in-memory state may go
+// without being saved: once per window, or more often if the TTL is shorter,
+// so that active keys never expire.
+func stateTTL(config ratelimiter.Config, defaultWindows time.Duration) (ttl, saveInterval time.Duration) {
+	ttl = config.StateTTL
+	if ttl == 0 {
+		ttl = config.Window * defaultWindows
+	}
+	return ttl, min(config.Window, ttl/2)
 }
@@ -0,0 +1,40 @@
+package algorithms
+
+import (
+	"time"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// storeViews is a store with its optional interfaces, resolved once so that
+// checks do not repeat the type assertions.
+type storeViews struct {
+	store            store.Store
+	nsStore          store.NamespacedStore
+	timeAwareStore   store.TimeAwareStore
+	nsTimeAwareStore store.NamespacedTimeAwareStore
+}
+
+// newStoreViews resolves the interfaces implemented by s.
+func newStoreViews(s store.Store) storeViews {
+	v := storeViews{store: s}
+	v.nsStore, _ = s.(store.NamespacedStore)
+	v.timeAwareStore, _ = s.(store.TimeAwareStore)
+	v.nsTimeAwareStore, _ = s.(store.NamespacedTimeAwareStore)
+	return v
+}
+
+// get retrieves the value of a key through the most specific interface of
+// the store: by namespace and key if useNS, by storeKey otherwise.
+func (v *storeViews) get(namespace, key, storeKey string, useNS bool, now time.Time) (interface{}, bool) {
+	if useNS {
+		if v.nsTimeAwareStore != nil {
+			return v.nsTimeAwareStore.GetWithNamespaceAt(namespace, key, now)
+		}
+		return v.nsStore.GetWithNamespace(namespace, key)
+	}
+	if v.timeAwareStore != nil {
+		return v.timeAwareStore.GetAt(storeKey, now)
+	}
+	return v.store.Get(storeKey)
+}
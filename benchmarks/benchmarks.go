@@ -0,0 +1,233 @@
+// Package benchmarks compares limiters and stores under realistic key
+// distributions: Zipfian popularity, a single hot key and churning keys that
+// are never seen twice, so that algorithms and stores can be chosen on
+// evidence rather than on uniform-key microbenchmarks.
+//
+// The suite of this repository runs every built-in algorithm against the
+// built-in stores:
+//
+//	go test ./benchmarks -bench . -benchtime 2s
+//
+// A third-party store joins the comparison with a single benchmark, in the
+// spirit of storetest:
+//
+//	func BenchmarkRedisSkew(b *testing.B) {
+//		stores := []benchmarks.Store{{Name: "redis", New: newTestRedisStore}}
+//		benchmarks.RunAll(b, benchmarks.Algorithms(benchmarks.DefaultConfig), stores, benchmarks.Distributions(10000))
+//	}
+package benchmarks
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// Distribution generates the keys of a workload.
+type Distribution struct {
+	// Name identifies the distribution in benchmark names, e.g. "zipf".
+	Name string
+
+	// New returns a generator of keys seeded with seed. A generator is used
+	// by a single goroutine; generators with different seeds give
+	// independent sequences.
+	New func(seed uint64) func() string
+}
+
+// Algorithm creates limiters under test.
+type Algorithm struct {
+	// Name identifies the algorithm in benchmark names.
+	Name string
+
+	// New creates a limiter keeping its state in s. Limiters that ignore
+	// the store (e.g. count-min sketches) are run once per store anyway.
+	New func(s store.Store) (ratelimiter.Limiter, error)
+}
+
+// Store creates stores under test.
+type Store struct {
+	// Name identifies the store in benchmark names.
+	Name string
+
+	// New creates an empty store, closed when its benchmark ends.
+	New func() store.Store
+}
+
+// DefaultConfig is the limit used by Algorithms in this suite: low enough
+// for hot keys to be denied most of the time, as in production.
+var DefaultConfig = ratelimiter.Config{Rate: 100, Window: time.Second}
+
+// Uniform returns a distribution picking each of n keys with the same
+// probability.
+func Uniform(n int) Distribution {
+	keys := makeKeys(n)
+	return Distribution{
+		Name: "uniform",
+		New: func(seed uint64) func() string {
+			rng := newRand(seed)
+			return func() string { return keys[rng.IntN(len(keys))] }
+		},
+	}
+}
+
+// Zipf returns a distribution over n keys where the k-th most popular key is
+// picked with a probability proportional to 1/(k+1)^s, as for users of an API
+// or pages of a site. s must be greater than 1; 1.1 is typical of web traffic.
+func Zipf(n int, s float64) Distribution {
+	keys := makeKeys(n)
+	return Distribution{
+		Name: "zipf",
+		New: func(seed uint64) func() string {
+			zipf := rand.NewZipf(newRand(seed), s, 1, uint64(len(keys)-1))
+			return func() string { return keys[zipf.Uint64()] }
+		},
+	}
+}
+
+// HotKey returns a distribution sending share (between 0 and 1) of the
+// requests to a single key, e.g. an attacker or a runaway client, and the
+// others uniformly to n other keys.
+func HotKey(n int, share float64) Distribution {
+	n = max(n, 1)
+	keys := makeKeys(n + 1)
+	return Distribution{
+		Name: "hot",
+		New: func(seed uint64) func() string {
+			rng := newRand(seed)
+			return func() string {
+				if rng.Float64() < share {
+					return keys[0]
+				}
+				return keys[1+rng.IntN(n)]
+			}
+		},
+	}
+}
+
+// Churn returns a distribution where every key is new, as for scans or
+// spoofed addresses: each request creates limiter state that is never used
+// again, which measures the cost of growing the store.
+func Churn() Distribution {
+	return Distribution{
+		Name: "churn",
+		New: func(seed uint64) func() string {
+			prefix := "churn-" + strconv.FormatUint(seed, 10) + "-"
+			var i uint64
+			return func() string {
+				i++
+				return prefix + strconv.FormatUint(i, 10)
+			}
+		},
+	}
+}
+
+// Distributions returns the distributions of the suite over n keys: uniform,
+// Zipf with s = 1.1, a hot key taking 90% of the requests, and churn.
+func Distributions(n int) []Distribution {
+	return []Distribution{Uniform(n), Zipf(n, 1.1), HotKey(n, 0.9), Churn()}
+}
+
+// Algorithms returns the built-in algorithms configured with config.
+func Algorithms(config ratelimiter.Config) []Algorithm {
+	return []Algorithm{
+		{Name: algorithms.TokenBucketName, New: func(s store.Store) (ratelimiter.Limiter, error) {
+			return algorithms.NewTokenBucket(config, s)
+		}},
+		{Name: algorithms.SlidingWindowName, New: func(s store.Store) (ratelimiter.Limiter, error) {
+			return algorithms.NewSlidingWindow(config, s)
+		}},
+		{Name: algorithms.CountMinName, New: func(store.Store) (ratelimiter.Limiter, error) {
+			return algorithms.NewCountMin(config)
+		}},
+	}
+}
+
+// Stores returns the built-in stores: the default memory store and a memory
+// store with a single shard, which shows the cost of lock contention on hot
+// keys.
+func Stores() []Store {
+	return []Store{
+		{Name: "memory", New: func() store.Store { return store.NewMemoryStore() }},
+		{Name: "memory-1shard", New: func() store.Store {
+			config := store.DefaultMemoryStoreConfig()
+			config.Shards = 1
+			return store.NewMemoryStoreWithConfig(config)
+		}},
+	}
+}
+
+// RunAll runs Run for every combination of algorithm, store and
+// distribution, as sub-benchmarks named "algorithm/store/distribution".
+func RunAll(b *testing.B, algs []Algorithm, stores []Store, dists []Distribution) {
+	for _, alg := range algs {
+		b.Run(alg.Name, func(b *testing.B) {
+			for _, st := range stores {
+				b.Run(st.Name, func(b *testing.B) {
+					for _, dist := range dists {
+						b.Run(dist.Name, func(b *testing.B) {
+							Run(b, alg, st, dist)
+						})
+					}
+				})
+			}
+		})
+	}
+}
+
+// Run benchmarks a limiter created by alg on a fresh store under keys drawn
+// from dist, from GOMAXPROCS goroutines (see testing.B.SetParallelism).
+// Besides time and allocations per operation, it reports the share of
+// allowed requests ("allowed/op") and of errors ("errors/op"), since a fast
+// limiter that fails open under load is no bargain.
+func Run(b *testing.B, alg Algorithm, st Store, dist Distribution) {
+	s := st.New()
+	defer s.Close()
+	limiter, err := alg.New(s)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var seeds, allowed, errCount atomic.Uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		next := dist.New(seeds.Add(1))
+		var ok, failed uint64
+		for pb.Next() {
+			res, err := limiter.Allow(next())
+			if err != nil {
+				failed++
+			} else if res {
+				ok++
+			}
+		}
+		allowed.Add(ok)
+		errCount.Add(failed)
+	})
+	b.StopTimer()
+
+	if b.N > 0 {
+		b.ReportMetric(float64(allowed.Load())/float64(b.N), "allowed/op")
+		b.ReportMetric(float64(errCount.Load())/float64(b.N), "errors/op")
+	}
+}
+
+// makeKeys returns n keys, built once so that generators do not allocate.
+func makeKeys(n int) []string {
+	keys := make([]string, max(n, 1))
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// newRand returns a generator seeded with seed.
+func newRand(seed uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, seed))
+}
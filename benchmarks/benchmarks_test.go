@@ -0,0 +1,55 @@
+package benchmarks
+
+import "testing"
+
+// counts draws n keys from dist and counts them.
+func counts(dist Distribution, n int) map[string]int {
+	next := dist.New(1)
+	seen := map[string]int{}
+	for i := 0; i < n; i++ {
+		seen[next()]++
+	}
+	return seen
+}
+
+func TestZipf(t *testing.T) {
+	seen := counts(Zipf(1000, 1.1), 100000)
+	if seen["key-0"] < 10*seen["key-99"] {
+		t.Errorf("key-0 drawn %d times, key-99 %d times: want a skewed distribution", seen["key-0"], seen["key-99"])
+	}
+}
+
+func TestHotKey(t *testing.T) {
+	seen := counts(HotKey(100, 0.9), 10000)
+	if share := float64(seen["key-0"]) / 10000; share < 0.85 || share > 0.95 {
+		t.Errorf("hot key share = %.2f, want about 0.9", share)
+	}
+	if len(seen) != 101 {
+		t.Errorf("drew %d keys, want 101", len(seen))
+	}
+}
+
+func TestChurn(t *testing.T) {
+	if seen := counts(Churn(), 1000); len(seen) != 1000 {
+		t.Errorf("drew %d distinct keys out of 1000", len(seen))
+	}
+	a, b := Churn().New(1), Churn().New(2)
+	if a() == b() {
+		t.Error("generators with different seeds should not share keys")
+	}
+}
+
+func TestDistributions_Deterministic(t *testing.T) {
+	for _, dist := range Distributions(100) {
+		a, b := dist.New(7), dist.New(7)
+		for i := 0; i < 100; i++ {
+			if x, y := a(), b(); x != y {
+				t.Fatalf("%s: same seed gave %q and %q", dist.Name, x, y)
+			}
+		}
+	}
+}
+
+func BenchmarkSkew(b *testing.B) {
+	RunAll(b, Algorithms(DefaultConfig), Stores(), Distributions(10000))
+}
@@ -0,0 +1,598 @@
+// Package cluster provides an approximately-global rate limiter for small
+// clusters without an external datastore.
+//
+// Each node counts requests in a MemoryStore and periodically gossips its
+// per-key counts for the current window to the other nodes over UDP. A request is
+// allowed when the cluster-wide estimate (local + remote counts, weighted
+// like the sliding window algorithm) stays within the limit.
+//
+// Because counts propagate asynchronously, the cluster can over-admit. Each
+// node admits at most MaxUnsynced requests per key between two gossip rounds,
+// so the over-admission is bounded by (number of nodes) x MaxUnsynced per
+// GossipInterval, plus any lost packets. Windows are aligned to wall-clock
+// time, so node clocks should be synchronized (e.g. NTP).
+//
+// Packets are authenticated with Config.Secret and carry a timestamp and a
+// sequence number, so that captured packets cannot be replayed. They are not
+// encrypted: run the gossip on a private network.
+package cluster
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+const (
+	// maxPacketSize is the maximum gossip payload size. Larger updates are
+	// split across several packets.
+	maxPacketSize = 8 * 1024
+
+	// readBufferSize is large enough for any UDP datagram.
+	readBufferSize = 64 * 1024
+
+	// readErrorBackoff is the pause after a failed read from the socket.
+	readErrorBackoff = 50 * time.Millisecond
+
+	// minSecretSize is the minimum length of Config.Secret.
+	minSecretSize = 16
+
+	// replayWindowSize is the number of recent sequence numbers remembered
+	// per node to drop duplicated packets.
+	replayWindowSize = 64
+)
+
+var (
+	// ErrInvalidMaxUnsynced is returned when MaxUnsynced is negative.
+	ErrInvalidMaxUnsynced = errors.New("ratelimiter: max unsynced must be non-negative")
+
+	// ErrSecretRequired is returned when Secret is shorter than 16 bytes.
+	ErrSecretRequired = errors.New("ratelimiter: cluster secret must be at least 16 bytes")
+)
+
+// Config holds the cluster limiter configuration.
+type Config struct {
+	// Limit is the cluster-wide limit (Rate requests per Window).
+	Limit ratelimiter.Config
+
+	// BindAddr is the UDP address to listen on for gossip (e.g. ":7946").
+	BindAddr string
+
+	// Peers are the UDP addresses of the other nodes.
+	Peers []string
+
+	// NodeID uniquely identifies this node. Default: random.
+	NodeID string
+
+	// GossipInterval is how often local counts are sent to peers.
+	// Shorter intervals converge faster at the cost of more packets.
+	// Default: 100ms.
+	GossipInterval time.Duration
+
+	// MaxUnsynced is the maximum number of requests a node admits for a key
+	// between two gossip rounds. It bounds the over-admission of the cluster
+	// and the maximum n accepted by AllowN.
+	// Default: Rate divided by the number of nodes (at least 1).
+	MaxUnsynced int
+
+	// MaxKeys bounds the number of keys tracked, the size of the MemoryStore
+	// holding the counts. Requests for new keys beyond the limit fail with
+	// store.ErrStoreFull.
+	// Default: 100,000.
+	MaxKeys int
+
+	// Secret authenticates gossip packets with HMAC-SHA256. It is required,
+	// at least 16 bytes long, and shared by all nodes.
+	Secret []byte
+
+	// MaxPacketAge is how long after being sent a packet is accepted.
+	// Older packets are dropped as replays, so node clocks must agree
+	// within it.
+	// Default: 5s.
+	MaxPacketAge time.Duration
+}
+
+// message is a gossip packet: the sender's counts for a window.
+type message struct {
+	Node   string         `json:"n"`
+	Seq    uint64         `json:"s"` // Increases with every packet of the node
+	Time   int64          `json:"t"` // Unix nanoseconds when sent
+	Window int64          `json:"w"`
+	Counts map[string]int `json:"c"`
+}
+
+// entry holds the counts of a key. It is stored in the MemoryStore until
+// the end of the window following the last one it counted.
+type entry struct {
+	window   int64 // Window of the counts
+	prev     int   // Cluster-wide count of the previous window
+	local    int
+	unsynced int
+	remote   map[string]int // node ID -> count
+}
+
+// roll moves e to window, keeping the total of the window before it.
+func (e *entry) roll(window int64) {
+	if e.window == window {
+		return
+	}
+	prev := 0
+	if e.window == window-1 {
+		prev = e.total()
+	}
+	*e = entry{window: window, prev: prev}
+}
+
+// total returns the cluster-wide count of the key.
+func (e *entry) total() int {
+	t := e.local
+	for _, c := range e.remote {
+		t += c
+	}
+	return t
+}
+
+// replayWindow remembers the recent sequence numbers of a node, like the
+// IPsec anti-replay window.
+type replayWindow struct {
+	highest uint64    // Highest sequence number accepted
+	seen    uint64    // Bit i is set if highest-i was accepted
+	last    time.Time // When the last packet was accepted
+}
+
+// accept records seq and reports whether it was not seen before.
+func (w *replayWindow) accept(seq uint64) bool {
+	switch {
+	case seq > w.highest:
+		if shift := seq - w.highest; shift < replayWindowSize {
+			w.seen = w.seen<<shift | 1
+		} else {
+			w.seen = 1
+		}
+		w.highest = seq
+		return true
+	case w.highest-seq >= replayWindowSize:
+		return false
+	default:
+		bit := uint64(1) << (w.highest - seq)
+		if w.seen&bit != 0 {
+			return false
+		}
+		w.seen |= bit
+		return true
+	}
+}
+
+// Limiter is a rate limiter whose counts are shared with peers by gossip.
+type Limiter struct {
+	config   Config
+	conn     net.PacketConn
+	store    *store.MemoryStore
+	now      func() time.Time
+	seq      atomic.Uint64
+	stopChan chan struct{}
+	closeMu  sync.Once
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	peers  []net.Addr
+	dirty  map[string]*entry // Entries with counts not yet gossiped
+	replay map[string]*replayWindow
+}
+
+// New creates a cluster limiter, starts listening on BindAddr and begins
+// gossiping with the peers. Call Close to stop it.
+func New(config Config) (*Limiter, error) {
+	if err := config.Limit.Validate(); err != nil {
+		return nil, err
+	}
+	if config.MaxUnsynced < 0 {
+		return nil, ErrInvalidMaxUnsynced
+	}
+	if len(config.Secret) < minSecretSize {
+		return nil, ErrSecretRequired
+	}
+
+	peers := make([]net.Addr, 0, len(config.Peers))
+	for _, p := range config.Peers {
+		addr, err := net.ResolveUDPAddr("udp", p)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, addr)
+	}
+
+	if config.NodeID == "" {
+		config.NodeID = randomID()
+	}
+	if config.GossipInterval <= 0 {
+		config.GossipInterval = 100 * time.Millisecond
+	}
+	if config.MaxUnsynced == 0 {
+		config.MaxUnsynced = max(config.Limit.Rate/(len(peers)+1), 1)
+	}
+	if config.MaxKeys <= 0 {
+		config.MaxKeys = 100_000
+	}
+	if config.MaxPacketAge <= 0 {
+		config.MaxPacketAge = 5 * time.Second
+	}
+
+	conn, err := net.ListenPacket("udp", config.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Limiter{
+		config: config,
+		conn:   conn,
+		// A single shard keeps MaxKeys exact; the limiter serializes
+		// accesses anyway
+		store:    store.NewMemoryStoreWithConfig(store.MemoryStoreConfig{MaxEntries: config.MaxKeys, Shards: 1}),
+		peers:    peers,
+		now:      time.Now,
+		stopChan: make(chan struct{}),
+		dirty:    make(map[string]*entry),
+		replay:   make(map[string]*replayWindow),
+	}
+	// Sequence numbers keep increasing across restarts with the same NodeID
+	l.seq.Store(uint64(time.Now().UnixNano()))
+
+	l.wg.Add(2)
+	go l.receiveLoop()
+	go l.gossipLoop()
+
+	return l, nil
+}
+
+// Addr returns the local gossip address.
+func (l *Limiter) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// AddPeer adds the UDP address of a node that joined the cluster.
+func (l *Limiter) AddPeer(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Copy on write: gossip iterates over the slice without the lock
+	peers := make([]net.Addr, len(l.peers), len(l.peers)+1)
+	copy(peers, l.peers)
+	l.peers = append(peers, udpAddr)
+	return nil
+}
+
+// Allow checks if a single request is allowed for the given key.
+func (l *Limiter) Allow(key string) (bool, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed for the given key.
+func (l *Limiter) AllowN(key string, n int) (bool, error) {
+	if n <= 0 {
+		return true, nil
+	}
+	if n > l.config.Limit.Rate || n > l.config.MaxUnsynced {
+		return false, ratelimiter.ErrCostExceedsCapacity
+	}
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, err := l.entry(key, now)
+	if err != nil {
+		return false, err
+	}
+
+	if e.unsynced+n > l.config.MaxUnsynced {
+		return false, nil
+	}
+
+	// Sliding window estimate over the cluster-wide counts
+	window := l.config.Limit.Window
+	elapsed := now.Sub(time.Unix(0, e.window*int64(window)))
+	weight := 1 - float64(elapsed)/float64(window)
+	estimate := float64(e.prev)*weight + float64(e.total())
+
+	if estimate+float64(n) > float64(l.config.Limit.Rate) {
+		return false, nil
+	}
+
+	e.local += n
+	e.unsynced += n
+	l.dirty[key] = e
+	return true, nil
+}
+
+// Reset clears the local state for the given key. Counts already gossiped
+// to peers are not retracted.
+func (l *Limiter) Reset(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.dirty, key)
+	return l.store.Delete(key)
+}
+
+// Close stops gossiping and closes the UDP socket and the store.
+func (l *Limiter) Close() error {
+	var err error
+	l.closeMu.Do(func() {
+		close(l.stopChan)
+		err = l.conn.Close()
+		l.wg.Wait()
+		err = errors.Join(err, l.store.Close())
+	})
+	return err
+}
+
+// Shutdown sends the counts not yet gossiped to the peers and closes the
+// limiter, waiting for the background goroutines to exit or ctx to be done.
+func (l *Limiter) Shutdown(ctx context.Context) error {
+	l.gossip()
+
+	done := make(chan error, 1)
+	go func() { done <- l.Close() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// windowAt returns the number of the window containing now.
+func (l *Limiter) windowAt(now time.Time) int64 {
+	return now.UnixNano() / int64(l.config.Limit.Window)
+}
+
+// entry returns the entry of key for the window containing now, creating it
+// if needed. It is kept until the end of the next window, for the sliding
+// window estimate. It must be called with l.mu held.
+func (l *Limiter) entry(key string, now time.Time) (*entry, error) {
+	window := l.windowAt(now)
+	ttl := time.Unix(0, (window+2)*int64(l.config.Limit.Window)).Sub(now)
+
+	if v, ok := l.store.GetAt(key, now); ok {
+		e := v.(*entry)
+		if e.window != window {
+			e.roll(window)
+			if err := l.store.UpdateTTLAt(key, ttl, now); err != nil {
+				return nil, err
+			}
+		}
+		return e, nil
+	}
+
+	e := &entry{window: window}
+	if err := l.store.SetAt(key, e, ttl, now); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// gossipLoop periodically sends the dirty counts to the peers.
+func (l *Limiter) gossipLoop() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.config.GossipInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.gossip()
+			l.pruneReplay()
+		case <-l.stopChan:
+			return
+		}
+	}
+}
+
+// gossip sends this node's counts for the keys updated since the last round.
+// Counts are totals for the window rather than increments, so lost or
+// duplicated packets never inflate the peers' view.
+func (l *Limiter) gossip() {
+	l.mu.Lock()
+	now := l.now()
+	msg := message{Node: l.config.NodeID, Time: now.UnixNano(), Window: l.windowAt(now), Counts: make(map[string]int)}
+	for key, e := range l.dirty {
+		// Counts of past windows are ignored by the peers
+		if e.window == msg.Window {
+			msg.Counts[key] = e.local
+		}
+		e.unsynced = 0
+	}
+	clear(l.dirty)
+	peers := l.peers
+	l.mu.Unlock()
+
+	if len(msg.Counts) == 0 || len(peers) == 0 {
+		return
+	}
+
+	for _, packet := range l.encode(msg) {
+		for _, peer := range peers {
+			_, _ = l.conn.WriteTo(packet, peer)
+		}
+	}
+}
+
+// encode splits msg into signed packets of at most maxPacketSize bytes,
+// each with its own sequence number.
+func (l *Limiter) encode(msg message) [][]byte {
+	var packets [][]byte
+	chunk := message{Node: msg.Node, Time: msg.Time, Window: msg.Window, Counts: make(map[string]int)}
+	size := 0
+
+	flush := func() {
+		if len(chunk.Counts) == 0 {
+			return
+		}
+		chunk.Seq = l.seq.Add(1)
+		data, err := json.Marshal(chunk)
+		if err == nil {
+			packets = append(packets, l.sign(data))
+		}
+		chunk.Counts = make(map[string]int)
+		size = 0
+	}
+
+	for key, count := range msg.Counts {
+		// Approximate JSON size of the "key":count pair
+		pair := len(key) + 24
+		if size+pair > maxPacketSize-256 {
+			flush()
+		}
+		chunk.Counts[key] = count
+		size += pair
+	}
+	flush()
+
+	return packets
+}
+
+// receiveLoop applies the counts received from peers.
+func (l *Limiter) receiveLoop() {
+	defer l.wg.Done()
+
+	buf := make([]byte, readBufferSize)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Back off so that a persistent socket error does not spin
+			select {
+			case <-l.stopChan:
+				return
+			case <-time.After(readErrorBackoff):
+				continue
+			}
+		}
+
+		data, ok := l.verify(buf[:n])
+		if !ok {
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Node == l.config.NodeID {
+			continue
+		}
+		if !l.fresh(msg) {
+			continue
+		}
+		l.apply(msg)
+	}
+}
+
+// fresh reports whether msg was sent recently and not received before, and
+// records it as received.
+func (l *Limiter) fresh(msg message) bool {
+	now := l.now()
+	if age := now.Sub(time.Unix(0, msg.Time)); age > l.config.MaxPacketAge || age < -l.config.MaxPacketAge {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.replay[msg.Node]
+	if !ok {
+		w = &replayWindow{}
+		l.replay[msg.Node] = w
+	}
+	if !w.accept(msg.Seq) {
+		return false
+	}
+	w.last = now
+	return true
+}
+
+// pruneReplay forgets the sequence numbers of nodes silent for long enough
+// that their past packets are too old to be accepted anyway.
+func (l *Limiter) pruneReplay() {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for node, w := range l.replay {
+		if now.Sub(w.last) > 2*l.config.MaxPacketAge {
+			delete(l.replay, node)
+		}
+	}
+}
+
+// apply merges the counts of a peer for the current window.
+func (l *Limiter) apply(msg message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if msg.Window != l.windowAt(now) {
+		return
+	}
+
+	for key, count := range msg.Counts {
+		e, err := l.entry(key, now)
+		if err != nil {
+			continue
+		}
+		if e.remote == nil {
+			e.remote = make(map[string]int)
+		}
+		// Counts only grow within a window; ignore reordered stale packets
+		if count > e.remote[msg.Node] {
+			e.remote[msg.Node] = count
+		}
+	}
+}
+
+// sign prefixes data with its HMAC.
+func (l *Limiter) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, l.config.Secret)
+	mac.Write(data)
+	return append(mac.Sum(nil), data...)
+}
+
+// verify checks and strips the HMAC of a packet.
+func (l *Limiter) verify(packet []byte) ([]byte, bool) {
+	if len(packet) < sha256.Size {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, l.config.Secret)
+	mac.Write(packet[sha256.Size:])
+	if !hmac.Equal(mac.Sum(nil), packet[:sha256.Size]) {
+		return nil, false
+	}
+	return packet[sha256.Size:], true
+}
+
+// randomID returns a random node identifier.
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,273 @@
+package cluster
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// testSecret is the secret of test limiters without one.
+var testSecret = []byte("0123456789abcdef")
+
+func newTestLimiter(t *testing.T, config Config) *Limiter {
+	t.Helper()
+	if config.Secret == nil {
+		config.Secret = testSecret
+	}
+	if config.BindAddr == "" {
+		config.BindAddr = "127.0.0.1:0"
+	}
+	if config.GossipInterval == 0 {
+		config.GossipInterval = 10 * time.Millisecond
+	}
+	l, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create cluster limiter: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// waitFor polls cond until it holds or the timeout expires.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Condition not met before timeout")
+}
+
+func remoteCount(l *Limiter, key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, err := l.entry(key, l.now())
+	if err != nil {
+		return 0
+	}
+	return e.total() - e.local
+}
+
+func TestCluster_SharedLimit(t *testing.T) {
+	limit := ratelimiter.Config{Rate: 10, Window: time.Hour}
+	a := newTestLimiter(t, Config{Limit: limit, NodeID: "a", MaxUnsynced: 10})
+	b := newTestLimiter(t, Config{Limit: limit, NodeID: "b", MaxUnsynced: 10,
+		Peers: []string{a.Addr().String()}})
+	if err := a.AddPeer(b.Addr().String()); err != nil {
+		t.Fatalf("AddPeer failed: %v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		if ok, err := a.Allow("key"); !ok || err != nil {
+			t.Fatalf("Request %d on node a should be allowed, got %v, %v", i+1, ok, err)
+		}
+	}
+
+	waitFor(t, func() bool { return remoteCount(b, "key") == 6 })
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := b.Allow("key"); ok {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Errorf("Expected node b to allow the remaining 4 requests, got %d", allowed)
+	}
+
+	waitFor(t, func() bool { return remoteCount(a, "key") == 4 })
+	if ok, _ := a.Allow("key"); ok {
+		t.Error("Expected node a to deny once the cluster-wide limit is reached")
+	}
+}
+
+func TestCluster_MaxUnsynced(t *testing.T) {
+	l := newTestLimiter(t, Config{
+		Limit:          ratelimiter.Config{Rate: 100, Window: time.Hour},
+		MaxUnsynced:    3,
+		GossipInterval: time.Hour,
+	})
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("key"); !ok {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	if ok, _ := l.Allow("key"); ok {
+		t.Error("Expected denial once MaxUnsynced requests are pending gossip")
+	}
+
+	l.gossip()
+	if ok, _ := l.Allow("key"); !ok {
+		t.Error("Expected requests to be allowed again after a gossip round")
+	}
+
+	if _, err := l.AllowN("key", 4); !errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity above MaxUnsynced, got %v", err)
+	}
+}
+
+func TestCluster_SlidingWindow(t *testing.T) {
+	l := newTestLimiter(t, Config{
+		Limit:          ratelimiter.Config{Rate: 10, Window: time.Hour},
+		MaxUnsynced:    10,
+		GossipInterval: time.Hour,
+	})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	allowed := func() int {
+		n := 0
+		for i := 0; i < 10; i++ {
+			if ok, _ := l.Allow("key"); ok {
+				n++
+			}
+		}
+		l.gossip()
+		return n
+	}
+
+	if got := allowed(); got != 10 {
+		t.Fatalf("Expected 10 requests allowed, got %d", got)
+	}
+	// Half of the previous window still counts
+	now = now.Add(90 * time.Minute)
+	if got := allowed(); got != 5 {
+		t.Errorf("Expected 5 requests allowed half way through the next window, got %d", got)
+	}
+	// The counts expire from the store after two windows
+	now = now.Add(150 * time.Minute)
+	if got := allowed(); got != 10 {
+		t.Errorf("Expected 10 requests allowed after two windows, got %d", got)
+	}
+}
+
+func TestCluster_MaxKeys(t *testing.T) {
+	l := newTestLimiter(t, Config{Limit: ratelimiter.Config{Rate: 10, Window: time.Hour}, MaxKeys: 1})
+
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("Expected first key to be allowed")
+	}
+	if _, err := l.Allow("b"); !errors.Is(err, store.ErrStoreFull) {
+		t.Errorf("Expected ErrStoreFull, got %v", err)
+	}
+}
+
+func TestCluster_Authentication(t *testing.T) {
+	l := newTestLimiter(t, Config{Limit: ratelimiter.Config{Rate: 10, Window: time.Hour}})
+	other := newTestLimiter(t, Config{Limit: ratelimiter.Config{Rate: 10, Window: time.Hour}, Secret: []byte("fedcba9876543210")})
+
+	signed := other.sign([]byte(`{"n":"x","w":1,"c":{"k":1}}`))
+	if _, ok := l.verify(signed); ok {
+		t.Error("Expected packet signed with another secret to be rejected")
+	}
+	if _, ok := other.verify(signed); !ok {
+		t.Error("Expected packet signed with the same secret to be accepted")
+	}
+	if _, ok := l.verify([]byte("short")); ok {
+		t.Error("Expected truncated packet to be rejected")
+	}
+}
+
+func TestCluster_Replay(t *testing.T) {
+	l := newTestLimiter(t, Config{Limit: ratelimiter.Config{Rate: 10, Window: time.Hour}})
+	now := time.Now()
+	msg := message{Node: "x", Seq: 100, Time: now.UnixNano()}
+
+	if !l.fresh(msg) {
+		t.Fatal("Expected first packet to be accepted")
+	}
+	if l.fresh(msg) {
+		t.Error("Expected replayed packet to be rejected")
+	}
+
+	// Reordered packets are accepted once
+	msg.Seq = 105
+	l.fresh(msg)
+	msg.Seq = 103
+	if !l.fresh(msg) || l.fresh(msg) {
+		t.Error("Expected reordered packet to be accepted once")
+	}
+	msg.Seq = 105 - replayWindowSize
+	if l.fresh(msg) {
+		t.Error("Expected packet older than the replay window to be rejected")
+	}
+
+	// Packets are only accepted for MaxPacketAge
+	msg.Seq = 200
+	msg.Time = now.Add(-time.Minute).UnixNano()
+	if l.fresh(msg) {
+		t.Error("Expected stale packet to be rejected")
+	}
+}
+
+func TestCluster_InvalidConfig(t *testing.T) {
+	if _, err := New(Config{Limit: ratelimiter.Config{Rate: 0, Window: time.Second}, Secret: testSecret}); err == nil {
+		t.Error("Expected error for invalid limit")
+	}
+	_, err := New(Config{Limit: ratelimiter.Config{Rate: 1, Window: time.Second}, MaxUnsynced: -1, Secret: testSecret})
+	if !errors.Is(err, ErrInvalidMaxUnsynced) {
+		t.Errorf("Expected ErrInvalidMaxUnsynced, got %v", err)
+	}
+	for _, secret := range [][]byte{nil, []byte("short")} {
+		_, err := New(Config{Limit: ratelimiter.Config{Rate: 1, Window: time.Second}, Secret: secret, BindAddr: "127.0.0.1:0"})
+		if !errors.Is(err, ErrSecretRequired) {
+			t.Errorf("Secret %q: expected ErrSecretRequired, got %v", secret, err)
+		}
+	}
+}
+
+// failingConn is a PacketConn whose reads fail with err.
+type failingConn struct {
+	net.PacketConn
+	err   error
+	reads atomic.Int64
+}
+
+func (c *failingConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.reads.Add(1)
+	return 0, nil, c.err
+}
+
+func TestCluster_ReceiveErrors(t *testing.T) {
+	run := func(conn *failingConn) (*Limiter, chan struct{}) {
+		l := &Limiter{conn: conn, stopChan: make(chan struct{})}
+		l.wg.Add(1)
+		done := make(chan struct{})
+		go func() {
+			l.receiveLoop()
+			close(done)
+		}()
+		return l, done
+	}
+
+	// A closed socket stops the loop
+	_, done := run(&failingConn{err: net.ErrClosed})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the loop to stop on a closed socket")
+	}
+
+	// Other errors are retried with a backoff until the limiter stops
+	conn := &failingConn{err: errors.New("read failed")}
+	l, done := run(conn)
+	time.Sleep(100 * time.Millisecond)
+	if reads := conn.reads.Load(); reads > 5 {
+		t.Errorf("Expected failed reads to back off, got %d reads in 100ms", reads)
+	}
+	close(l.stopChan)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the loop to stop with the limiter")
+	}
+}
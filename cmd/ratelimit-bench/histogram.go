@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math/bits"
+	"time"
+)
+
+// subBuckets is the number of linear sub-buckets per power of two,
+// giving a relative precision of 1/subBuckets.
+const subBuckets = 16
+
+// histogram records latencies in log-linear buckets, so that percentiles can
+// be computed without keeping every sample. It is not safe for concurrent use.
+type histogram struct {
+	counts [64 * subBuckets]uint64
+	total  uint64
+	max    time.Duration
+}
+
+func newHistogram() *histogram {
+	return &histogram{}
+}
+
+// bucket returns the bucket index of d.
+func bucket(d time.Duration) int {
+	v := uint64(d)
+	if v < subBuckets {
+		return int(v)
+	}
+	exp := bits.Len64(v) - 1
+	shift := exp - bits.Len64(subBuckets-1)
+	sub := int(v>>uint(shift)) & (subBuckets - 1)
+	return (shift+1)*subBuckets + sub
+}
+
+// bucketValue returns the upper bound of bucket i.
+func bucketValue(i int) time.Duration {
+	if i < subBuckets {
+		return time.Duration(i)
+	}
+	shift := i/subBuckets - 1
+	sub := uint64(i % subBuckets)
+	return time.Duration(((subBuckets + sub + 1) << uint(shift)) - 1)
+}
+
+// record adds a sample.
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[bucket(d)]++
+	h.total++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// merge adds the samples of o to h.
+func (h *histogram) merge(o *histogram) {
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.total += o.total
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// quantile returns an upper bound of the q-quantile (0 < q <= 1).
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.total))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := bucketValue(i)
+			if v > h.max {
+				return h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := newHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Microsecond)
+	}
+
+	for _, tt := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.50, 500 * time.Microsecond},
+		{0.99, 990 * time.Microsecond},
+		{1, 1000 * time.Microsecond},
+	} {
+		got := h.quantile(tt.q)
+		// Buckets have a relative precision of 1/subBuckets
+		if got < tt.want || got > tt.want+tt.want/subBuckets {
+			t.Errorf("quantile(%v) = %v, want about %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	a, b := newHistogram(), newHistogram()
+	a.record(time.Millisecond)
+	b.record(3 * time.Millisecond)
+	a.merge(b)
+
+	if a.total != 2 || a.max != 3*time.Millisecond {
+		t.Errorf("Unexpected merged histogram: total %d, max %v", a.total, a.max)
+	}
+}
+
+func TestTheoreticalAllowed(t *testing.T) {
+	cfg := benchConfig{algorithm: "token_bucket", rate: 10, window: time.Second, keys: 2}
+	if got := theoreticalAllowed(cfg, 2*time.Second); got != 60 {
+		t.Errorf("Expected 2 keys x (burst 10 + 20 refilled) = 60, got %v", got)
+	}
+
+	cfg.algorithm = "sliding_window"
+	if got := theoreticalAllowed(cfg, 500*time.Millisecond); got != 20 {
+		t.Errorf("Expected a full first window per key, got %v", got)
+	}
+}
@@ -0,0 +1,269 @@
+// Command ratelimit-bench drives load against a rate limiter and reports
+// throughput, allocations, latency percentiles and accuracy, to help size
+// stores and compare algorithms before going to production.
+//
+// Run with: go run ./cmd/ratelimit-bench -algorithm sliding_window -keys 1000 -concurrency 16 -duration 10s
+//
+// The "remote" store simulates a network store: values are encoded with the
+// selected codec and every operation waits for -latency.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// benchConfig holds the command-line options.
+type benchConfig struct {
+	algorithm   string
+	storeName   string
+	codec       string
+	latency     time.Duration
+	rate        int
+	window      time.Duration
+	burst       int
+	keys        int
+	concurrency int
+	qps         int
+	duration    time.Duration
+}
+
+// benchResult holds the aggregated outcome of a run.
+type benchResult struct {
+	requests int64
+	allowed  int64
+	errors   int64
+	elapsed  time.Duration
+	mallocs  uint64
+	latency  *histogram
+}
+
+func main() {
+	var cfg benchConfig
+	flag.StringVar(&cfg.algorithm, "algorithm", algorithms.TokenBucketName, "algorithm: token_bucket, sliding_window or count_min")
+	flag.StringVar(&cfg.storeName, "store", "memory", "store: memory or remote (simulated network store)")
+	flag.StringVar(&cfg.codec, "codec", "binary", "codec of the remote store: binary, json, msgpack or protobuf")
+	flag.DurationVar(&cfg.latency, "latency", time.Millisecond, "latency of each remote store operation")
+	flag.IntVar(&cfg.rate, "rate", 100, "requests allowed per window and key")
+	flag.DurationVar(&cfg.window, "window", time.Second, "rate limit window")
+	flag.IntVar(&cfg.burst, "burst", 0, "burst size (token bucket; default: rate)")
+	flag.IntVar(&cfg.keys, "keys", 100, "number of distinct keys")
+	flag.IntVar(&cfg.concurrency, "concurrency", runtime.GOMAXPROCS(0), "number of concurrent workers")
+	flag.IntVar(&cfg.qps, "qps", 0, "target total requests per second (0: as fast as possible)")
+	flag.DurationVar(&cfg.duration, "duration", 5*time.Second, "duration of the run")
+	flag.Parse()
+
+	if cfg.keys <= 0 || cfg.concurrency <= 0 || cfg.qps < 0 || cfg.duration <= 0 {
+		fmt.Fprintln(os.Stderr, "keys, concurrency and duration must be positive, qps non-negative")
+		os.Exit(2)
+	}
+
+	s, err := newStore(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+
+	limiter, err := newLimiter(cfg, s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result := run(cfg, limiter)
+	report(cfg, result)
+}
+
+// newStore creates the store selected by cfg.
+func newStore(cfg benchConfig) (store.Store, error) {
+	switch cfg.storeName {
+	case "memory":
+		return store.NewMemoryStore(), nil
+	case "remote":
+		codec, err := codecByName(cfg.codec)
+		if err != nil {
+			return nil, err
+		}
+		return newRemoteStore(codec, cfg.latency), nil
+	}
+	return nil, fmt.Errorf("unknown store %q", cfg.storeName)
+}
+
+// codecByName returns the codec with the given name.
+func codecByName(name string) (store.Codec, error) {
+	for _, c := range []store.Codec{store.BinaryCodec, store.JSONCodec, store.MsgpackCodec, store.ProtobufCodec} {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
+
+// newLimiter creates the limiter selected by cfg.
+func newLimiter(cfg benchConfig, s store.Store) (ratelimiter.Limiter, error) {
+	config := ratelimiter.Config{
+		Rate:      cfg.rate,
+		Window:    cfg.window,
+		BurstSize: cfg.burst,
+	}
+
+	switch cfg.algorithm {
+	case algorithms.TokenBucketName:
+		return algorithms.NewTokenBucket(config, s)
+	case algorithms.SlidingWindowName:
+		return algorithms.NewSlidingWindow(config, s)
+	case algorithms.CountMinName:
+		return algorithms.NewCountMin(config)
+	}
+	return nil, fmt.Errorf("unknown algorithm %q", cfg.algorithm)
+}
+
+// run drives the limiter for cfg.duration and aggregates the results.
+func run(cfg benchConfig, limiter ratelimiter.Limiter) benchResult {
+	keys := make([]string, cfg.keys)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+
+	// Per-worker pacing interval when a target QPS is set
+	var interval time.Duration
+	if cfg.qps > 0 {
+		interval = time.Duration(int64(time.Second) * int64(cfg.concurrency) / int64(cfg.qps))
+	}
+
+	var requests, allowed, errCount atomic.Int64
+	histograms := make([]*histogram, cfg.concurrency)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	deadline := start.Add(cfg.duration)
+
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.concurrency; w++ {
+		h := newHistogram()
+		histograms[w] = h
+
+		wg.Add(1)
+		go func(seed uint64) {
+			defer wg.Done()
+
+			rng := rand.New(rand.NewPCG(seed, seed))
+			next := time.Now()
+			var n, ok, failed int64
+
+			for {
+				now := time.Now()
+				if !now.Before(deadline) {
+					break
+				}
+				if interval > 0 {
+					if wait := next.Sub(now); wait > 0 {
+						time.Sleep(wait)
+					}
+					next = next.Add(interval)
+				}
+
+				key := keys[rng.IntN(len(keys))]
+				t0 := time.Now()
+				res, err := limiter.Allow(key)
+				h.record(time.Since(t0))
+
+				n++
+				if err != nil {
+					failed++
+				} else if res {
+					ok++
+				}
+			}
+
+			requests.Add(n)
+			allowed.Add(ok)
+			errCount.Add(failed)
+		}(uint64(w + 1))
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	latency := newHistogram()
+	for _, h := range histograms {
+		latency.merge(h)
+	}
+
+	return benchResult{
+		requests: requests.Load(),
+		allowed:  allowed.Load(),
+		errors:   errCount.Load(),
+		elapsed:  elapsed,
+		mallocs:  after.Mallocs - before.Mallocs,
+		latency:  latency,
+	}
+}
+
+// theoreticalAllowed returns the number of requests a perfect limiter would
+// allow over elapsed for the configured keys, assuming every key is
+// saturated.
+func theoreticalAllowed(cfg benchConfig, elapsed time.Duration) float64 {
+	windows := float64(elapsed) / float64(cfg.window)
+	perKey := float64(cfg.rate) * windows
+
+	switch cfg.algorithm {
+	case algorithms.TokenBucketName:
+		burst := cfg.burst
+		if burst == 0 {
+			burst = cfg.rate
+		}
+		perKey += float64(burst)
+	default:
+		// The first window admits a full Rate
+		if windows < 1 {
+			perKey = float64(cfg.rate)
+		}
+	}
+	return perKey * float64(cfg.keys)
+}
+
+// report prints the results of a run.
+func report(cfg benchConfig, r benchResult) {
+	ops := float64(r.requests)
+	if ops == 0 {
+		ops = 1
+	}
+
+	fmt.Printf("algorithm:    %s\n", cfg.algorithm)
+	fmt.Printf("store:        %s\n", cfg.storeName)
+	fmt.Printf("keys:         %d\n", cfg.keys)
+	fmt.Printf("concurrency:  %d\n", cfg.concurrency)
+	fmt.Printf("duration:     %v\n", r.elapsed.Round(time.Millisecond))
+	fmt.Println()
+	fmt.Printf("requests:     %d (%.0f req/s)\n", r.requests, float64(r.requests)/r.elapsed.Seconds())
+	fmt.Printf("allowed:      %d (%.1f%%)\n", r.allowed, 100*float64(r.allowed)/ops)
+	fmt.Printf("errors:       %d\n", r.errors)
+	fmt.Printf("allocs/op:    %.2f\n", float64(r.mallocs)/ops)
+	fmt.Printf("latency:      p50 %v  p99 %v  p99.9 %v  max %v\n",
+		r.latency.quantile(0.50), r.latency.quantile(0.99), r.latency.quantile(0.999), r.latency.max)
+
+	// Accuracy is only meaningful when the offered load exceeds the limit
+	expected := theoreticalAllowed(cfg, r.elapsed)
+	if float64(r.requests) > expected {
+		fmt.Printf("accuracy:     %.1f%% (allowed %d, theoretical %.0f)\n",
+			100*float64(r.allowed)/expected, r.allowed, expected)
+	} else {
+		fmt.Printf("accuracy:     n/a (offered load %d below theoretical limit %.0f)\n", r.requests, expected)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// remoteStore simulates a network store such as Redis: values are stored
+// encoded with a codec, and every operation waits for a fixed latency.
+// TTLs are ignored since runs are short.
+type remoteStore struct {
+	mu      sync.RWMutex
+	data    map[string][]byte
+	codec   store.Codec
+	latency time.Duration
+}
+
+func newRemoteStore(codec store.Codec, latency time.Duration) *remoteStore {
+	return &remoteStore{
+		data:    make(map[string][]byte),
+		codec:   codec,
+		latency: latency,
+	}
+}
+
+// Get retrieves a value from the store.
+func (s *remoteStore) Get(key string) (interface{}, bool) {
+	time.Sleep(s.latency)
+
+	s.mu.RLock()
+	data, ok := s.data[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	val, err := s.codec.Unmarshal(data)
+	if err != nil {
+		return nil, false
+	}
+	return val, true
+}
+
+// Set stores a value.
+func (s *remoteStore) Set(key string, value interface{}, ttl time.Duration) error {
+	data, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	time.Sleep(s.latency)
+
+	s.mu.Lock()
+	s.data[key] = data
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete removes a value from the store.
+func (s *remoteStore) Delete(key string) error {
+	time.Sleep(s.latency)
+
+	s.mu.Lock()
+	delete(s.data, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// Close releases the stored values.
+func (s *remoteStore) Close() error {
+	s.mu.Lock()
+	s.data = nil
+	s.mu.Unlock()
+	return nil
+}
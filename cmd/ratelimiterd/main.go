@@ -0,0 +1,228 @@
+// Command ratelimiterd is a rate limiting reverse proxy: it runs the
+// middleware Router in front of an upstream HTTP service, so services not
+// written in Go can be rate limited by deploying it as a sidecar.
+//
+// Run with: go run ./cmd/ratelimiterd -config ratelimiterd.yaml
+//
+// Example configuration:
+//
+//	listen: ":8080"
+//	upstream: http://127.0.0.1:3000
+//	trustedProxies: [10.0.0.0/8]
+//	store:
+//	  type: memory
+//	  maxEntries: 100000
+//	endpoints:
+//	  - path: /api/auth/*
+//	    rate: 5 per minute
+//	    algorithm: sliding_window
+//	  - path: /api/*
+//	    rate: 100
+//	    window: 1m
+//
+// Endpoints use the middleware.EndpointSpec schema. On SIGINT or SIGTERM the
+// proxy stops accepting connections and waits up to shutdownTimeout for the
+// requests in flight.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Morditux/ratelimiter/middleware"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// config is the configuration file of the proxy.
+type config struct {
+	// Listen is the address the proxy listens on. Default: ":8080"
+	Listen string `json:"listen"`
+
+	// Upstream is the URL of the proxied service.
+	Upstream string `json:"upstream"`
+
+	// TrustedProxies are the IPs or CIDR blocks of the proxies in front of
+	// ratelimiterd whose X-Forwarded-For entries are trusted.
+	TrustedProxies []string `json:"trustedProxies"`
+
+	// Headers is the rate limit header mode: always, denied or never.
+	// Default: always
+	Headers string `json:"headers"`
+
+	// ShutdownTimeout bounds the wait for in-flight requests on shutdown.
+	// Default: 30s
+	ShutdownTimeout string `json:"shutdownTimeout"`
+
+	Store     storeConfig               `json:"store"`
+	Endpoints []middleware.EndpointSpec `json:"endpoints"`
+}
+
+// storeConfig selects and sizes the store backend.
+type storeConfig struct {
+	// Type is the store backend. Only "memory" is built in. Default: memory
+	Type           string `json:"type"`
+	MaxEntries     int    `json:"maxEntries"`
+	MaxMemoryBytes int64  `json:"maxMemoryBytes"`
+	Shards         int    `json:"shards"`
+}
+
+func main() {
+	configPath := flag.String("config", "ratelimiterd.yaml", "path of the YAML configuration file")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	handler, shutdown, err := newProxy(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		timeout, _ := time.ParseDuration(cfg.ShutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+		if err := shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("ratelimiterd listening on %s, proxying to %s (%d endpoints)", cfg.Listen, cfg.Upstream, len(cfg.Endpoints))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-done
+}
+
+// loadConfig reads the configuration file and applies the defaults.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
+
+// parseConfig parses a YAML configuration and applies the defaults.
+func parseConfig(data []byte) (*config, error) {
+	js, err := yamlToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &config{}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	if cfg.Listen == "" {
+		cfg.Listen = ":8080"
+	}
+	if cfg.Upstream == "" {
+		return nil, errors.New("config: missing upstream")
+	}
+	if cfg.ShutdownTimeout == "" {
+		cfg.ShutdownTimeout = "30s"
+	}
+	if _, err := time.ParseDuration(cfg.ShutdownTimeout); err != nil {
+		return nil, fmt.Errorf("config: shutdownTimeout: %w", err)
+	}
+	if cfg.Store.Type == "" {
+		cfg.Store.Type = "memory"
+	}
+	return cfg, nil
+}
+
+// newProxy returns the rate limited reverse proxy described by cfg, and a
+// function shutting down its limiters.
+func newProxy(cfg *config) (http.Handler, func(context.Context) error, error) {
+	upstream, err := url.Parse(cfg.Upstream)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config: upstream: %w", err)
+	}
+	if upstream.Scheme == "" || upstream.Host == "" {
+		return nil, nil, fmt.Errorf("config: upstream: %q is not an absolute URL", cfg.Upstream)
+	}
+
+	endpoints, err := middleware.EndpointConfigs(cfg.Endpoints)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+
+	opts := []middleware.Option{middleware.WithStoreOwnership(true)}
+	if len(cfg.TrustedProxies) > 0 {
+		keyFunc, err := middleware.TrustedIPKeyFunc(cfg.TrustedProxies)
+		if err != nil {
+			return nil, nil, fmt.Errorf("config: trustedProxies: %w", err)
+		}
+		opts = append(opts, middleware.WithKeyFunc(keyFunc))
+	}
+	switch cfg.Headers {
+	case "", "always":
+	case "denied":
+		opts = append(opts, middleware.WithHeaders(middleware.HeadersOnDenial))
+	case "never":
+		opts = append(opts, middleware.WithHeaders(middleware.HeadersNever))
+	default:
+		return nil, nil, fmt.Errorf("config: unknown headers mode %q", cfg.Headers)
+	}
+
+	s, err := newStore(cfg.Store)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.SetXForwarded()
+		},
+	}
+	router, err := middleware.NewRouter(proxy, s, endpoints, opts...)
+	if err != nil {
+		s.Close()
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+	return router, router.Shutdown, nil
+}
+
+// newStore creates the store backend.
+func newStore(cfg storeConfig) (store.Store, error) {
+	switch cfg.Type {
+	case "memory":
+		return store.NewMemoryStoreWithConfig(store.MemoryStoreConfig{
+			MaxEntries:     cfg.MaxEntries,
+			MaxMemoryBytes: cfg.MaxMemoryBytes,
+			Shards:         cfg.Shards,
+		}), nil
+	default:
+		return nil, fmt.Errorf("config: unknown store type %q (supported: memory)", cfg.Type)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+upstream: http://127.0.0.1:3000
+trustedProxies: [10.0.0.0/8]
+store:
+  maxEntries: 1000
+endpoints:
+  - path: /api/*
+    rate: 100
+    window: 1m
+  - path: /login
+    rate: 5 per minute
+`))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if cfg.Listen != ":8080" || cfg.ShutdownTimeout != "30s" || cfg.Store.Type != "memory" {
+		t.Errorf("Expected defaults to be applied, got %+v", cfg)
+	}
+	if cfg.Store.MaxEntries != 1000 || len(cfg.Endpoints) != 2 || cfg.Endpoints[0].Window != "1m" {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+	if login := cfg.Endpoints[1]; login.Rate != 5 || login.Window != "1m0s" {
+		t.Errorf("Expected the string rate to set rate and window, got %+v", login)
+	}
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	for _, yaml := range []string{
+		"listen: :8080",
+		"upstream: http://u\nshutdownTimeout: later",
+		"upstream: http://u\nendpoints: nope",
+	} {
+		if _, err := parseConfig([]byte(yaml)); err == nil {
+			t.Errorf("Expected an error for %q", yaml)
+		}
+	}
+}
+
+func TestNewProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	cfg, err := parseConfig([]byte(`
+upstream: ` + upstream.URL + `
+endpoints:
+  - path: /api/*
+    rate: 1
+    window: 1m
+`))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	handler, shutdown, err := newProxy(cfg)
+	if err != nil {
+		t.Fatalf("newProxy failed: %v", err)
+	}
+	defer shutdown(context.Background())
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	if rec := serve("/api/x"); rec.Code != http.StatusOK || rec.Header().Get("X-Upstream-Path") != "/api/x" {
+		t.Fatalf("Expected the request to be proxied, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := serve("/api/x"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("X-Upstream-Path") != "" {
+		t.Errorf("Expected the second request to be limited, got %d", rec.Code)
+	}
+	if rec := serve("/other"); rec.Code != http.StatusOK {
+		t.Errorf("Expected unmatched paths to be proxied, got %d", rec.Code)
+	}
+}
+
+func TestNewProxy_InvalidConfig(t *testing.T) {
+	for _, cfg := range []*config{
+		{Upstream: "not a url"},
+		{Upstream: "http://u", Headers: "sometimes"},
+		{Upstream: "http://u", Store: storeConfig{Type: "redis"}},
+		{Upstream: "http://u", TrustedProxies: []string{"nope"}},
+	} {
+		if cfg.Store.Type == "" {
+			cfg.Store.Type = "memory"
+		}
+		if _, _, err := newProxy(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
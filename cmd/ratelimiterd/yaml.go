@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The configuration is YAML, parsed by a small parser covering what a
+// configuration file needs, so that the module keeps no dependencies: block
+// mappings and sequences, plain and quoted scalars, one-line flow sequences
+// ([a, b]) and comments. Anchors, multi-line scalars and flow mappings are
+// not supported.
+
+// yamlLine is a non-blank line of a YAML document without its comment.
+type yamlLine struct {
+	num    int // 1-based line number
+	indent int
+	text   string // Without indentation
+}
+
+// yamlParser parses a YAML document into nil, bool, json.Number, string,
+// []any and map[string]any values.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// yamlToJSON converts a YAML document to JSON.
+func yamlToJSON(data []byte) ([]byte, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(stripComment(raw), " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		if text == "" || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs cannot be used for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(text), text: text})
+	}
+
+	var v any
+	if len(p.lines) > 0 {
+		var err error
+		if v, err = p.parseBlock(p.lines[0].indent); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.lines) {
+			return nil, p.errorf("unexpected indentation")
+		}
+	}
+	return json.Marshal(v)
+}
+
+// parseBlock parses the mapping or sequence starting at the current line,
+// whose lines are indented by indent.
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	if isSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+// parseSequence parses "- item" lines indented by indent.
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isSequenceItem(line.text) {
+			break
+		}
+
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		switch {
+		case rest == "":
+			// The item is the block on the next lines
+			p.pos++
+			item, err := p.parseNested(indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		case isSequenceItem(rest) || isMappingEntry(rest):
+			// The item is a block starting on this line: parse it as if the
+			// dash were indentation
+			itemIndent := indent + len(line.text) - len(rest)
+			p.lines[p.pos] = yamlLine{num: line.num, indent: itemIndent, text: rest}
+			item, err := p.parseBlock(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		default:
+			p.pos++
+			item, err := parseScalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("yaml: line %d: %w", line.num, err)
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// parseMapping parses "key: value" lines indented by indent.
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || isSequenceItem(line.text) {
+			break
+		}
+
+		key, value, ok := cutMappingEntry(line.text)
+		if !ok {
+			return nil, p.errorf("expected \"key: value\"")
+		}
+		if k, err := parseScalar(key); err == nil {
+			key = fmt.Sprint(k)
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+
+		if value != "" {
+			v, err := parseScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("yaml: line %d: %w", line.num, err)
+			}
+			m[key] = v
+			continue
+		}
+
+		// A sequence under a key may have the indentation of the key
+		if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+			v, err := p.parseSequence(indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		v, err := p.parseNested(indent)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// parseNested parses the block on the current line if it is indented
+// deeper than indent, or returns nil for an empty value.
+func (p *yamlParser) parseNested(indent int) (any, error) {
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+		return nil, nil
+	}
+	return p.parseBlock(p.lines[p.pos].indent)
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	line := p.lines[min(p.pos, len(p.lines)-1)]
+	return fmt.Errorf("yaml: line %d: "+format, append([]any{line.num}, args...)...)
+}
+
+// isSequenceItem reports whether text is a "- item" line.
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// isMappingEntry reports whether text is a "key: value" line.
+func isMappingEntry(text string) bool {
+	_, _, ok := cutMappingEntry(text)
+	return ok
+}
+
+// cutMappingEntry splits "key: value" (or "key:") at the first colon
+// outside quotes that is followed by a space or ends the line.
+func cutMappingEntry(text string) (key, value string, ok bool) {
+	if text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripComment removes a comment: a # at the start of the line or after a
+// space, outside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseScalar parses a scalar or a flow sequence.
+func parseScalar(s string) (any, error) {
+	switch {
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence %q", s)
+		}
+		items := []any{}
+		inner := strings.TrimSpace(s[1 : len(s)-1])
+		if inner == "" {
+			return items, nil
+		}
+		for _, item := range splitFlow(inner) {
+			v, err := parseScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case s == "{}":
+		return map[string]any{}, nil
+	case strings.HasPrefix(s, "{"):
+		return nil, fmt.Errorf("flow mappings are not supported: %q", s)
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return nil, fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*") && !strings.HasPrefix(s, "*."):
+		return nil, fmt.Errorf("anchors and aliases are not supported: %q", s)
+	}
+
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil && json.Valid([]byte(s)) {
+		return json.Number(s), nil
+	}
+	return s, nil
+}
+
+// splitFlow splits the items of a flow sequence at commas outside quotes.
+func splitFlow(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name, yaml, want string
+	}{
+		{"scalars", "a: 1\nb: true\nc: hello world\nd: \"quoted: # not a comment\"\ne: 'it''s'\nf: ~\ng: 1m", `{"a":1,"b":true,"c":"hello world","d":"quoted: # not a comment","e":"it's","f":null,"g":"1m"}`},
+		{"comments", "# header\na: 1 # trailing\n\nb: /api/*", `{"a":1,"b":"/api/*"}`},
+		{"nested mapping", "store:\n  type: memory\n  maxEntries: 10", `{"store":{"maxEntries":10,"type":"memory"}}`},
+		{"flow sequence", "ips: [10.0.0.0/8, \"::1\"]\nnone: []", `{"ips":["10.0.0.0/8","::1"],"none":[]}`},
+		{"sequence of mappings", "endpoints:\n  - path: /a\n    rate: 1\n  - path: /b\n    methods:\n      - GET\n      - POST", `{"endpoints":[{"path":"/a","rate":1},{"methods":["GET","POST"],"path":"/b"}]}`},
+		{"sequence at key indentation", "list:\n- a\n- b\nnext: 1", `{"list":["a","b"],"next":1}`},
+		{"dash on its own line", "list:\n  -\n    a: 1", `{"list":[{"a":1}]}`},
+		{"empty value", "a:\nb: 1", `{"a":null,"b":1}`},
+		{"empty document", "# nothing\n", `null`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := yamlToJSON([]byte(tc.yaml))
+			if err != nil {
+				t.Fatalf("yamlToJSON failed: %v", err)
+			}
+			var gotV, wantV any
+			json.Unmarshal(got, &gotV)
+			json.Unmarshal([]byte(tc.want), &wantV)
+			if !reflect.DeepEqual(gotV, wantV) {
+				t.Errorf("Expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestYAMLToJSON_Errors(t *testing.T) {
+	for _, yaml := range []string{
+		"a: 1\na: 2",
+		"a: 1\n  b: 2",
+		"just a scalar line\nb: 1",
+		"a: [1, 2",
+		"a: {b: 1}",
+		"a: |\n  text",
+		"a: &anchor 1",
+		"a:\n\tb: 1",
+		"a: \"unterminated",
+	} {
+		if _, err := yamlToJSON([]byte(yaml)); err == nil {
+			t.Errorf("Expected an error for %q", yaml)
+		}
+	}
+}
@@ -8,10 +8,13 @@ per-endpoint configuration.
 # Architecture
 
 The library is organized into several components:
-  - Core: Defines the Limiter interface and Config structure.
+  - Core: Defines the Limiter and LimiterWithDetails interfaces, the Config
+    structure and the Result returned by detailed checks.
   - Algorithms: Implements rate limiting logic (Token Bucket, Sliding Window).
   - Store: Provides storage backends (In-memory, extensible for Redis/Memcached).
   - Middleware: Integrates rate limiting with net/http.
+  - Cluster: Approximately-global limits shared between nodes by gossip.
+  - Envoy: The Envoy rate limit service API, for Envoy and Istio global limits.
 
 # Algorithms
 
@@ -30,6 +33,8 @@ Rate limiting state is persisted using a Store. The library includes:
 
   - MemoryStore: A thread-safe, in-memory store with automatic background cleanup.
     It is ideal for single-node applications or development.
+  - EtcdStore and ConsulStore: Shared stores on top of minimal client
+    interfaces, so the module does not depend on their client libraries.
 
 External stores like Redis or Memcached can be implemented by satisfying the
 store.Store interface.
@@ -0,0 +1,125 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvName returns the name of an environment variable under prefix, e.g.
+// EnvName("API", "RATE") is "API_RATE". An empty prefix returns name as is.
+func EnvName(prefix, name string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "_") {
+		return prefix + name
+	}
+	return prefix + "_" + name
+}
+
+// ConfigFromEnv reads a config from environment variables under prefix, so
+// that deployments can tune limits without code changes:
+//
+//	RATE                a number of requests per WINDOW, or a rate parsed
+//	                    with ParseRate (e.g. "100/m"), which sets WINDOW too
+//	WINDOW              a duration, e.g. 1m
+//	BURST               BurstSize
+//	MAX_DEBT, MAX_COST  MaxDebt and MaxCost
+//	WARMUP_PERIOD       WarmupPeriod, a duration
+//	WARMUP_BURST        WarmupBurst
+//	RETRY_AFTER_JITTER  RetryAfterJitter, a duration
+//	STATE_TTL           StateTTL, a duration
+//	REFILL_INTERVAL     RefillInterval, a duration
+//	REFILL_SCHEDULE     RefillSchedule, a cron expression (see ParseCron)
+//
+// With prefix "API", RATE is read from API_RATE. Unset variables keep the
+// values of DefaultConfig, except BURST which defaults to the rate. The
+// config is validated.
+func ConfigFromEnv(prefix string) (Config, error) {
+	config := DefaultConfig()
+	config.BurstSize = 0
+	env := envReader{prefix: prefix}
+
+	if rate, ok := env.lookup("RATE"); ok {
+		if n, err := strconv.Atoi(rate); err == nil {
+			config.Rate = n
+		} else {
+			parsed, err := ParseRate(rate)
+			if err != nil {
+				return Config{}, fmt.Errorf("%s: %w", EnvName(prefix, "RATE"), err)
+			}
+			if _, ok := env.lookup("WINDOW"); ok {
+				return Config{}, fmt.Errorf("%s: rate %q cannot be combined with %s", EnvName(prefix, "RATE"), rate, EnvName(prefix, "WINDOW"))
+			}
+			config.Rate, config.Window, config.BurstSize = parsed.Rate, parsed.Window, parsed.BurstSize
+		}
+	}
+	env.duration("WINDOW", &config.Window)
+	env.int("BURST", &config.BurstSize)
+	env.int("MAX_DEBT", &config.MaxDebt)
+	env.int("MAX_COST", &config.MaxCost)
+	env.duration("WARMUP_PERIOD", &config.WarmupPeriod)
+	env.int("WARMUP_BURST", &config.WarmupBurst)
+	env.duration("RETRY_AFTER_JITTER", &config.RetryAfterJitter)
+	env.duration("STATE_TTL", &config.StateTTL)
+	env.duration("REFILL_INTERVAL", &config.RefillInterval)
+	if expr, ok := env.lookup("REFILL_SCHEDULE"); ok && env.err == nil {
+		schedule, err := ParseCron(expr)
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", EnvName(prefix, "REFILL_SCHEDULE"), err)
+		}
+		config.RefillSchedule = schedule
+	}
+	if env.err != nil {
+		return Config{}, env.err
+	}
+
+	if config.BurstSize == 0 {
+		config.BurstSize = config.Rate
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// envReader reads environment variables under a prefix and records the
+// first parse error.
+type envReader struct {
+	prefix string
+	err    error
+}
+
+// lookup returns the trimmed value of a variable, and whether it is set
+// and not empty.
+func (e *envReader) lookup(name string) (string, bool) {
+	v, ok := os.LookupEnv(EnvName(e.prefix, name))
+	v = strings.TrimSpace(v)
+	return v, ok && v != ""
+}
+
+func (e *envReader) int(name string, dst *int) {
+	v, ok := e.lookup(name)
+	if !ok || e.err != nil {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.err = fmt.Errorf("%s: invalid integer %q", EnvName(e.prefix, name), v)
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) duration(name string, dst *time.Duration) {
+	v, ok := e.lookup(name)
+	if !ok || e.err != nil {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.err = fmt.Errorf("%s: invalid duration %q", EnvName(e.prefix, name), v)
+		return
+	}
+	*dst = d
+}
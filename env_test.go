@@ -0,0 +1,81 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	for _, tc := range []struct{ prefix, want string }{
+		{"", "RATE"},
+		{"API", "API_RATE"},
+		{"API_", "API_RATE"},
+	} {
+		if got := EnvName(tc.prefix, "RATE"); got != tc.want {
+			t.Errorf("EnvName(%q) = %q, want %q", tc.prefix, got, tc.want)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("API_RATE", "50")
+	t.Setenv("API_WINDOW", "10s")
+	t.Setenv("API_MAX_DEBT", "5")
+	t.Setenv("API_STATE_TTL", "1h")
+	t.Setenv("API_REFILL_SCHEDULE", "@hourly")
+
+	config, err := ConfigFromEnv("API")
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	if config.Rate != 50 || config.Window != 10*time.Second || config.BurstSize != 50 {
+		t.Errorf("Unexpected rate: %+v", config)
+	}
+	if config.MaxDebt != 5 || config.StateTTL != time.Hour || config.RefillSchedule == nil {
+		t.Errorf("Unexpected options: %+v", config)
+	}
+}
+
+func TestConfigFromEnv_Defaults(t *testing.T) {
+	config, err := ConfigFromEnv("RATELIMITER_TEST_UNSET")
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	if config != DefaultConfig() {
+		t.Errorf("Expected DefaultConfig, got %+v", config)
+	}
+}
+
+func TestConfigFromEnv_RateString(t *testing.T) {
+	t.Setenv("RATE", "0.5/s")
+	t.Setenv("BURST", "3")
+
+	config, err := ConfigFromEnv("")
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	if config.Rate != 1 || config.Window != 2*time.Second || config.BurstSize != 3 {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+}
+
+func TestConfigFromEnv_Invalid(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"T_RATE": "fast"},
+		{"T_RATE": "-1"},
+		{"T_RATE": "100/m", "T_WINDOW": "1h"},
+		{"T_WINDOW": "soon"},
+		{"T_BURST": "1.5"},
+		{"T_REFILL_SCHEDULE": "hourly"},
+		{"T_REFILL_INTERVAL": "1m", "T_REFILL_SCHEDULE": "@hourly"},
+	} {
+		t.Run("", func(t *testing.T) {
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+			if _, err := ConfigFromEnv("T"); err == nil {
+				t.Errorf("%v: expected an error", env)
+			}
+		})
+	}
+}
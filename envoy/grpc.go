@@ -0,0 +1,116 @@
+package envoy
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ShouldRateLimitPath is the HTTP path of the ShouldRateLimit gRPC method.
+const ShouldRateLimitPath = "/envoy.service.ratelimit.v3.RateLimitService/ShouldRateLimit"
+
+// maxRequestSize bounds the size of a RateLimitRequest message.
+const maxRequestSize = 1 << 20
+
+// gRPC status codes returned by the service.
+const (
+	grpcOK                = 0
+	grpcInvalidArgument   = 3
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcUnavailable       = 14
+)
+
+var (
+	errCompressed = errors.New("envoy: compressed messages are not supported")
+	errTooLarge   = errors.New("envoy: message too large")
+)
+
+// Protocols returns the protocols of an http.Server serving the service:
+// Envoy calls rate limit services over HTTP/2 without TLS.
+func Protocols() *http.Protocols {
+	p := &http.Protocols{}
+	p.SetHTTP1(true)
+	p.SetUnencryptedHTTP2(true)
+	return p
+}
+
+// ServeHTTP serves the ShouldRateLimit method over gRPC. Store errors fail
+// the call with UNAVAILABLE, so Envoy applies its failure mode.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.URL.Path != ShouldRateLimitPath {
+		writeGRPCError(w, grpcUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+
+	msg, code, err := readGRPCMessage(r.Body)
+	if err != nil {
+		writeGRPCError(w, code, err.Error())
+		return
+	}
+	req, err := unmarshalRequest(msg)
+	if err != nil {
+		writeGRPCError(w, grpcInvalidArgument, err.Error())
+		return
+	}
+	if req.Domain == "" {
+		writeGRPCError(w, grpcInvalidArgument, "rate limit domain must not be empty")
+		return
+	}
+
+	resp, err := s.ShouldRateLimit(r.Context(), req)
+	if err != nil {
+		writeGRPCError(w, grpcUnavailable, err.Error())
+		return
+	}
+
+	body := marshalResponse(resp)
+	frame := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(body)))
+	frame = append(frame, body...)
+
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc+proto")
+	h.Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	w.Write(frame)
+	h.Set("Grpc-Status", strconv.Itoa(grpcOK))
+}
+
+// readGRPCMessage reads the single message of a unary call. On error, it
+// also returns the gRPC status code to fail the call with.
+func readGRPCMessage(body io.Reader) ([]byte, int, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, grpcInvalidArgument, err
+	}
+	if prefix[0] != 0 {
+		return nil, grpcUnimplemented, errCompressed
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxRequestSize {
+		return nil, grpcResourceExhausted, errTooLarge
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, grpcInvalidArgument, err
+	}
+	return msg, grpcOK, nil
+}
+
+// writeGRPCError writes a trailers-only response failing the call.
+func writeGRPCError(w http.ResponseWriter, code int, msg string) {
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc+proto")
+	h.Set("Grpc-Status", strconv.Itoa(code))
+	h.Set("Grpc-Message", url.PathEscape(msg))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,189 @@
+package envoy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// marshalRequest encodes a RateLimitRequest like Envoy does.
+func marshalRequest(req *RateLimitRequest) []byte {
+	b := appendBytesField(nil, requestDomain, []byte(req.Domain))
+	for _, d := range req.Descriptors {
+		var db []byte
+		for _, e := range d.Entries {
+			eb := appendBytesField(nil, entryKey, []byte(e.Key))
+			eb = appendBytesField(eb, entryValue, []byte(e.Value))
+			db = appendBytesField(db, descriptorEntries, eb)
+		}
+		if d.HitsAddend != 0 {
+			db = appendBytesField(db, descriptorHitsAddend, appendVarintField(nil, uint32Value, uint64(d.HitsAddend)))
+		}
+		b = appendBytesField(b, requestDescriptors, db)
+	}
+	return appendVarintField(b, requestHitsAddend, uint64(req.HitsAddend))
+}
+
+// unmarshalResponse decodes the fields of a RateLimitResponse checked by tests.
+func unmarshalResponse(t *testing.T, data []byte) *RateLimitResponse {
+	t.Helper()
+	resp := &RateLimitResponse{}
+	err := forEachField(data, func(f protoField) error {
+		switch f.num {
+		case responseOverallCode:
+			resp.OverallCode = Code(f.varint)
+		case responseStatuses:
+			var s DescriptorStatus
+			err := forEachField(f.payload, func(f protoField) error {
+				switch f.num {
+				case statusCode:
+					s.Code = Code(f.varint)
+				case statusLimitRemaining:
+					s.LimitRemaining = uint32(f.varint)
+				case statusCurrentLimit:
+					s.CurrentLimit = &RateLimit{}
+					return forEachField(f.payload, func(f protoField) error {
+						switch f.num {
+						case limitRequestsPerUnit:
+							s.CurrentLimit.RequestsPerUnit = uint32(f.varint)
+						case limitUnit:
+							s.CurrentLimit.Unit = Unit(f.varint)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			resp.Statuses = append(resp.Statuses, s)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	return resp
+}
+
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+func TestProto_RequestRoundTrip(t *testing.T) {
+	want := &RateLimitRequest{
+		Domain:     "edge",
+		HitsAddend: 3,
+		Descriptors: []Descriptor{
+			{Entries: []Entry{{"remote_address", "1.2.3.4"}, {"path", "/"}}, HitsAddend: 7},
+			{Entries: []Entry{{"generic_key", ""}}},
+		},
+	}
+	got, err := unmarshalRequest(marshalRequest(want))
+	if err != nil {
+		t.Fatalf("unmarshalRequest failed: %v", err)
+	}
+	if got.Domain != want.Domain || got.HitsAddend != 3 || len(got.Descriptors) != 2 ||
+		got.Descriptors[0].HitsAddend != 7 || got.Descriptors[0].Entries[1] != want.Descriptors[0].Entries[1] {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if _, err := unmarshalRequest([]byte{0x0a, 0x10, 'x'}); err == nil {
+		t.Error("Expected an error for a truncated message")
+	}
+}
+
+// TestServeHTTP_H2C calls the service like Envoy: gRPC over HTTP/2 without TLS.
+func TestServeHTTP_H2C(t *testing.T) {
+	svc := newTestService(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := &http.Server{Handler: svc, Protocols: Protocols()}
+	go server.Serve(ln)
+	defer server.Close()
+
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{
+		Transport: &http.Transport{Protocols: protocols},
+		Timeout:   5 * time.Second,
+	}
+
+	call := func() *RateLimitResponse {
+		msg := marshalRequest(&RateLimitRequest{
+			Domain:      "edge",
+			Descriptors: []Descriptor{{Entries: []Entry{{"remote_address", "1.2.3.4"}}}},
+		})
+		req, _ := http.NewRequestWithContext(context.Background(), "POST", "http://"+ln.Addr().String()+ShouldRateLimitPath, bytes.NewReader(grpcFrame(msg)))
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Te", "trailers")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		if resp.ProtoMajor != 2 {
+			t.Errorf("Expected HTTP/2, got %s", resp.Proto)
+		}
+		if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+			t.Fatalf("Expected Grpc-Status 0, got %q (headers %v)", got, resp.Header)
+		}
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Fatalf("Invalid response frame %x", body)
+		}
+		return unmarshalResponse(t, body[5:])
+	}
+
+	first := call()
+	if first.OverallCode != CodeOK || first.Statuses[0].LimitRemaining != 1 || *first.Statuses[0].CurrentLimit != (RateLimit{2, UnitMinute}) {
+		t.Errorf("Unexpected first response %+v", first)
+	}
+	call()
+	if resp := call(); resp.OverallCode != CodeOverLimit || resp.Statuses[0].Code != CodeOverLimit {
+		t.Errorf("Expected the third call to be over limit, got %+v", resp)
+	}
+}
+
+func TestServeHTTP_Errors(t *testing.T) {
+	svc := newTestService(t)
+
+	for _, tc := range []struct {
+		name, path, contentType string
+		body                    []byte
+		status                  int
+		grpcStatus              string
+	}{
+		{"not grpc", ShouldRateLimitPath, "application/json", nil, http.StatusUnsupportedMediaType, ""},
+		{"unknown method", "/envoy.service.ratelimit.v3.RateLimitService/Other", "application/grpc", grpcFrame(nil), http.StatusOK, "12"},
+		{"truncated frame", ShouldRateLimitPath, "application/grpc", []byte{0, 0}, http.StatusOK, "3"},
+		{"compressed", ShouldRateLimitPath, "application/grpc", []byte{1, 0, 0, 0, 0}, http.StatusOK, "12"},
+		{"too large", ShouldRateLimitPath, "application/grpc", []byte{0, 0xff, 0xff, 0xff, 0xff}, http.StatusOK, "8"},
+		{"no domain", ShouldRateLimitPath, "application/grpc", grpcFrame(nil), http.StatusOK, "3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tc.path, bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			rec := httptest.NewRecorder()
+			svc.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, rec.Code)
+			}
+			if got := rec.Header().Get("Grpc-Status"); got != tc.grpcStatus {
+				t.Errorf("Expected Grpc-Status %q, got %q", tc.grpcStatus, got)
+			}
+		})
+	}
+}
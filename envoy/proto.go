@@ -0,0 +1,203 @@
+package envoy
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// The messages of envoy/service/ratelimit/v3/rls.proto used by the service,
+// encoded and decoded by hand so that the module keeps no dependencies.
+// Fields the service does not use are skipped on decoding.
+
+// errInvalidMessage is returned when a protobuf message cannot be decoded.
+var errInvalidMessage = errors.New("envoy: invalid protobuf message")
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Field numbers of RateLimitRequest, RateLimitDescriptor and its Entry.
+const (
+	requestDomain      = 1
+	requestDescriptors = 2
+	requestHitsAddend  = 3
+
+	descriptorEntries    = 1
+	descriptorHitsAddend = 3
+
+	entryKey   = 1
+	entryValue = 2
+)
+
+// Field numbers of RateLimitResponse, its DescriptorStatus and RateLimit.
+const (
+	responseOverallCode = 1
+	responseStatuses    = 2
+
+	statusCode               = 1
+	statusCurrentLimit       = 2
+	statusLimitRemaining     = 3
+	statusDurationUntilReset = 4
+
+	limitRequestsPerUnit = 1
+	limitUnit            = 2
+
+	durationSeconds = 1
+	durationNanos   = 2
+
+	uint32Value = 1
+)
+
+// protoField is a decoded field of a message.
+type protoField struct {
+	num     uint64
+	wire    uint64
+	varint  uint64
+	payload []byte // Wire type bytes only
+}
+
+// forEachField calls fn with each field of the message in data.
+func forEachField(data []byte, fn func(f protoField) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errInvalidMessage
+		}
+		data = data[n:]
+		f := protoField{num: tag >> 3, wire: tag & 7}
+
+		switch f.wire {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errInvalidMessage
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errInvalidMessage
+			}
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errInvalidMessage
+			}
+			data = data[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errInvalidMessage
+			}
+			f.payload = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			return errInvalidMessage
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalRequest decodes a RateLimitRequest.
+func unmarshalRequest(data []byte) (*RateLimitRequest, error) {
+	req := &RateLimitRequest{}
+	err := forEachField(data, func(f protoField) error {
+		switch {
+		case f.num == requestDomain && f.wire == wireBytes:
+			req.Domain = string(f.payload)
+		case f.num == requestDescriptors && f.wire == wireBytes:
+			d, err := unmarshalDescriptor(f.payload)
+			if err != nil {
+				return err
+			}
+			req.Descriptors = append(req.Descriptors, d)
+		case f.num == requestHitsAddend && f.wire == wireVarint:
+			req.HitsAddend = uint32(f.varint)
+		}
+		return nil
+	})
+	return req, err
+}
+
+// unmarshalDescriptor decodes a RateLimitDescriptor.
+func unmarshalDescriptor(data []byte) (Descriptor, error) {
+	var d Descriptor
+	err := forEachField(data, func(f protoField) error {
+		switch {
+		case f.num == descriptorEntries && f.wire == wireBytes:
+			var e Entry
+			err := forEachField(f.payload, func(f protoField) error {
+				switch {
+				case f.num == entryKey && f.wire == wireBytes:
+					e.Key = string(f.payload)
+				case f.num == entryValue && f.wire == wireBytes:
+					e.Value = string(f.payload)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			d.Entries = append(d.Entries, e)
+		case f.num == descriptorHitsAddend && f.wire == wireBytes:
+			// google.protobuf.UInt32Value
+			return forEachField(f.payload, func(f protoField) error {
+				if f.num == uint32Value && f.wire == wireVarint {
+					d.HitsAddend = uint32(f.varint)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return d, err
+}
+
+// marshalResponse encodes a RateLimitResponse.
+func marshalResponse(resp *RateLimitResponse) []byte {
+	var b []byte
+	b = appendVarintField(b, responseOverallCode, uint64(resp.OverallCode))
+	for _, s := range resp.Statuses {
+		var sb []byte
+		sb = appendVarintField(sb, statusCode, uint64(s.Code))
+		if s.CurrentLimit != nil {
+			var lb []byte
+			lb = appendVarintField(lb, limitRequestsPerUnit, uint64(s.CurrentLimit.RequestsPerUnit))
+			lb = appendVarintField(lb, limitUnit, uint64(s.CurrentLimit.Unit))
+			sb = appendBytesField(sb, statusCurrentLimit, lb)
+		}
+		sb = appendVarintField(sb, statusLimitRemaining, uint64(s.LimitRemaining))
+		if s.DurationUntilReset > 0 {
+			var db []byte
+			db = appendVarintField(db, durationSeconds, uint64(s.DurationUntilReset/time.Second))
+			db = appendVarintField(db, durationNanos, uint64(s.DurationUntilReset%time.Second))
+			sb = appendBytesField(sb, statusDurationUntilReset, db)
+		}
+		b = appendBytesField(b, responseStatuses, sb)
+	}
+	return b
+}
+
+// appendVarintField appends a varint field, omitted if zero like proto3 does.
+func appendVarintField(b []byte, num, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, num<<3|wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytesField appends a length-delimited field (string or message).
+func appendBytesField(b []byte, num uint64, payload []byte) []byte {
+	b = binary.AppendUvarint(b, num<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(payload)))
+	return append(b, payload...)
+}
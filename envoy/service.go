@@ -0,0 +1,329 @@
+// Package envoy implements the Envoy rate limit service API
+// (envoy.service.ratelimit.v3.RateLimitService) on top of the algorithms and
+// stores of this module, so that Envoy's and Istio's global rate limit
+// filters can use it instead of a separate lyft/ratelimit deployment.
+//
+// Limits are configured like lyft/ratelimit: per domain, a tree of
+// descriptors whose keys and values match the entries of the descriptors
+// sent by Envoy. The service is a gRPC server over HTTP/2 without TLS:
+//
+//	svc, err := envoy.NewService(s, []envoy.Domain{{
+//		Name: "edge",
+//		Descriptors: []envoy.DescriptorConfig{{
+//			Key:   "remote_address",
+//			Limit: &ratelimiter.Config{Rate: 100, Window: time.Minute},
+//		}},
+//	}})
+//	server := &http.Server{Addr: ":8081", Handler: svc, Protocols: envoy.Protocols()}
+//	server.ListenAndServe()
+package envoy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// ErrInvalidConfig is returned by NewService for an invalid configuration.
+var ErrInvalidConfig = errors.New("envoy: invalid configuration")
+
+// Domain holds the limits of a rate limit domain, the domain Envoy sends in
+// its requests.
+type Domain struct {
+	Name        string
+	Descriptors []DescriptorConfig
+}
+
+// DescriptorConfig matches a descriptor entry and limits the descriptors
+// ending at it. Nested descriptors match the following entries, so that
+// e.g. (remote_address, path) can be limited per address and path.
+type DescriptorConfig struct {
+	// Key is the entry key to match.
+	Key string
+
+	// Value is the entry value to match. Empty matches any value, and each
+	// value gets its own limit. Exact values take precedence.
+	Value string
+
+	// Limit is the limit of descriptors ending at this entry. Nil means
+	// they are not limited.
+	Limit *ratelimiter.Config
+
+	// Algorithm is algorithms.TokenBucketName or algorithms.SlidingWindowName.
+	// Default: token bucket
+	Algorithm string
+
+	// Descriptors match the next entry of descriptors.
+	Descriptors []DescriptorConfig
+}
+
+// Entry is an entry of a descriptor sent by Envoy.
+type Entry struct {
+	Key, Value string
+}
+
+// Descriptor is a descriptor sent by Envoy: a list of entries identifying
+// what to limit, e.g. [(remote_address, 1.2.3.4), (path, /login)].
+type Descriptor struct {
+	Entries []Entry
+
+	// HitsAddend overrides the request's HitsAddend when non-zero.
+	HitsAddend uint32
+}
+
+// RateLimitRequest is a request to check the descriptors of a domain.
+type RateLimitRequest struct {
+	Domain      string
+	Descriptors []Descriptor
+
+	// HitsAddend is the number of hits to count. Default: 1
+	HitsAddend uint32
+}
+
+// Code is the outcome of a check.
+type Code int32
+
+const (
+	CodeUnknown   Code = 0
+	CodeOK        Code = 1
+	CodeOverLimit Code = 2
+)
+
+// Unit is the time unit of a limit reported to Envoy.
+type Unit int32
+
+const (
+	UnitUnknown Unit = 0
+	UnitSecond  Unit = 1
+	UnitMinute  Unit = 2
+	UnitHour    Unit = 3
+	UnitDay     Unit = 4
+)
+
+// RateLimit is a limit reported to Envoy.
+type RateLimit struct {
+	RequestsPerUnit uint32
+	Unit            Unit
+}
+
+// DescriptorStatus is the outcome of a descriptor check.
+type DescriptorStatus struct {
+	Code Code
+
+	// CurrentLimit is the limit of the descriptor, nil if it is not limited
+	// or its window is not a whole time unit.
+	CurrentLimit       *RateLimit
+	LimitRemaining     uint32
+	DurationUntilReset time.Duration
+}
+
+// RateLimitResponse is the outcome of a RateLimitRequest. Statuses are in
+// the order of the request's descriptors.
+type RateLimitResponse struct {
+	OverallCode Code
+	Statuses    []DescriptorStatus
+}
+
+// Service is an Envoy rate limit service.
+type Service struct {
+	domains map[string]*node
+}
+
+// node is a DescriptorConfig with its limiter.
+type node struct {
+	limiter  ratelimiter.LimiterWithDetails // Nil if not limited
+	limit    *RateLimit
+	exact    map[Entry]*node
+	anyValue map[string]*node // By key
+}
+
+// NewService creates a service enforcing the limits of domains in s.
+func NewService(s store.Store, domains []Domain) (*Service, error) {
+	svc := &Service{domains: make(map[string]*node, len(domains))}
+	for _, d := range domains {
+		if d.Name == "" {
+			return nil, fmt.Errorf("%w: domain without a name", ErrInvalidConfig)
+		}
+		if _, dup := svc.domains[d.Name]; dup {
+			return nil, fmt.Errorf("%w: duplicate domain %q", ErrInvalidConfig, d.Name)
+		}
+		root := &node{}
+		if err := root.add(s, d.Name, d.Descriptors); err != nil {
+			return nil, err
+		}
+		svc.domains[d.Name] = root
+	}
+	return svc, nil
+}
+
+// add adds the nodes of descriptors under n.
+func (n *node) add(s store.Store, path string, descriptors []DescriptorConfig) error {
+	for _, dc := range descriptors {
+		if dc.Key == "" {
+			return fmt.Errorf("%w: %s: descriptor without a key", ErrInvalidConfig, path)
+		}
+		childPath := path + "." + dc.Key
+		if dc.Value != "" {
+			childPath += "_" + dc.Value
+		}
+
+		child := &node{}
+		if dc.Limit != nil {
+			limiter, err := newLimiter(dc.Algorithm, *dc.Limit, s)
+			if err != nil {
+				return fmt.Errorf("%w: %s: %w", ErrInvalidConfig, childPath, err)
+			}
+			child.limiter = limiter
+			child.limit = reportedLimit(*dc.Limit)
+		}
+		if err := child.add(s, childPath, dc.Descriptors); err != nil {
+			return err
+		}
+
+		if dc.Value == "" {
+			if n.anyValue == nil {
+				n.anyValue = make(map[string]*node)
+			}
+			if _, dup := n.anyValue[dc.Key]; dup {
+				return fmt.Errorf("%w: duplicate descriptor %s", ErrInvalidConfig, childPath)
+			}
+			n.anyValue[dc.Key] = child
+		} else {
+			if n.exact == nil {
+				n.exact = make(map[Entry]*node)
+			}
+			e := Entry{Key: dc.Key, Value: dc.Value}
+			if _, dup := n.exact[e]; dup {
+				return fmt.Errorf("%w: duplicate descriptor %s", ErrInvalidConfig, childPath)
+			}
+			n.exact[e] = child
+		}
+	}
+	return nil
+}
+
+// newLimiter creates the limiter of a descriptor.
+func newLimiter(algorithm string, config ratelimiter.Config, s store.Store) (ratelimiter.LimiterWithDetails, error) {
+	switch algorithm {
+	case "", algorithms.TokenBucketName:
+		return algorithms.NewTokenBucket(config, s)
+	case algorithms.SlidingWindowName:
+		return algorithms.NewSlidingWindow(config, s)
+	default:
+		return nil, fmt.Errorf("unknown algorithm %q", algorithm)
+	}
+}
+
+// reportedLimit expresses config in a whole time unit, or returns nil.
+func reportedLimit(config ratelimiter.Config) *RateLimit {
+	for _, u := range []struct {
+		unit Unit
+		d    time.Duration
+	}{
+		{UnitSecond, time.Second},
+		{UnitMinute, time.Minute},
+		{UnitHour, time.Hour},
+		{UnitDay, 24 * time.Hour},
+	} {
+		if config.Window == u.d {
+			return &RateLimit{RequestsPerUnit: uint32(config.Rate), Unit: u.unit}
+		}
+	}
+	return nil
+}
+
+// ShouldRateLimit counts the hits of each descriptor of req against the
+// limit its entries match. Descriptors matching no limit are OK. The overall
+// code is CodeOverLimit if any descriptor is over its limit.
+func (s *Service) ShouldRateLimit(ctx context.Context, req *RateLimitRequest) (*RateLimitResponse, error) {
+	resp := &RateLimitResponse{
+		OverallCode: CodeOK,
+		Statuses:    make([]DescriptorStatus, len(req.Descriptors)),
+	}
+	root := s.domains[req.Domain]
+
+	for i, d := range req.Descriptors {
+		resp.Statuses[i] = DescriptorStatus{Code: CodeOK}
+		n := root.match(d.Entries)
+		if n == nil || n.limiter == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		hits := d.HitsAddend
+		if hits == 0 {
+			hits = req.HitsAddend
+		}
+		if hits == 0 {
+			hits = 1
+		}
+
+		result, err := n.limiter.AllowNWithDetails(descriptorKey(req.Domain, d.Entries), int(hits))
+		if err != nil && !errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+			return nil, err
+		}
+
+		status := DescriptorStatus{
+			Code:           CodeOK,
+			CurrentLimit:   n.limit,
+			LimitRemaining: uint32(max(result.Remaining, 0)),
+		}
+		if !result.Allowed {
+			status.Code = CodeOverLimit
+			status.DurationUntilReset = result.RetryAfter
+			resp.OverallCode = CodeOverLimit
+		} else if !result.ResetAt.IsZero() {
+			status.DurationUntilReset = max(time.Until(result.ResetAt), 0)
+		}
+		resp.Statuses[i] = status
+	}
+	return resp, nil
+}
+
+// match returns the node matched by entries, or nil. Exact values take
+// precedence over any value.
+func (n *node) match(entries []Entry) *node {
+	for _, e := range entries {
+		if n == nil {
+			return nil
+		}
+		if child, ok := n.exact[e]; ok {
+			n = child
+		} else {
+			n = n.anyValue[e.Key]
+		}
+	}
+	return n
+}
+
+// descriptorKey returns the limiter key of a descriptor. Keys and values are
+// escaped so that distinct descriptors cannot produce the same key.
+func descriptorKey(domain string, entries []Entry) string {
+	var b strings.Builder
+	b.WriteString(escapeKeyPart(domain))
+	for _, e := range entries {
+		b.WriteByte('|')
+		b.WriteString(escapeKeyPart(e.Key))
+		b.WriteByte('=')
+		b.WriteString(escapeKeyPart(e.Value))
+	}
+	return b.String()
+}
+
+// keyEscaper escapes the separators of descriptor keys.
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, `=`, `\=`)
+
+func escapeKeyPart(s string) string {
+	if !strings.ContainsAny(s, `\|=`) {
+		return s
+	}
+	return keyEscaper.Replace(s)
+}
@@ -0,0 +1,156 @@
+package envoy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	s := store.NewMemoryStore()
+	t.Cleanup(func() { s.Close() })
+
+	svc, err := NewService(s, []Domain{{
+		Name: "edge",
+		Descriptors: []DescriptorConfig{
+			{
+				Key:   "remote_address",
+				Limit: &ratelimiter.Config{Rate: 2, Window: time.Minute},
+				Descriptors: []DescriptorConfig{
+					{Key: "path", Value: "/login", Limit: &ratelimiter.Config{Rate: 1, Window: time.Hour}, Algorithm: algorithms.SlidingWindowName},
+					{Key: "path", Limit: &ratelimiter.Config{Rate: 100, Window: 90 * time.Second}},
+				},
+			},
+			{Key: "generic_key", Value: "unlimited"},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	return svc
+}
+
+func check(t *testing.T, svc *Service, entries ...Entry) DescriptorStatus {
+	t.Helper()
+	resp, err := svc.ShouldRateLimit(context.Background(), &RateLimitRequest{
+		Domain:      "edge",
+		Descriptors: []Descriptor{{Entries: entries}},
+	})
+	if err != nil {
+		t.Fatalf("ShouldRateLimit failed: %v", err)
+	}
+	if (resp.OverallCode == CodeOverLimit) != (resp.Statuses[0].Code == CodeOverLimit) {
+		t.Errorf("Overall code %d does not match status %d", resp.OverallCode, resp.Statuses[0].Code)
+	}
+	return resp.Statuses[0]
+}
+
+func TestService_ShouldRateLimit(t *testing.T) {
+	svc := newTestService(t)
+	addr := Entry{"remote_address", "1.2.3.4"}
+
+	status := check(t, svc, addr)
+	if status.Code != CodeOK || status.LimitRemaining != 1 || *status.CurrentLimit != (RateLimit{2, UnitMinute}) {
+		t.Errorf("Unexpected first status %+v", status)
+	}
+	check(t, svc, addr)
+	if status := check(t, svc, addr); status.Code != CodeOverLimit || status.DurationUntilReset <= 0 {
+		t.Errorf("Expected the third request to be over limit, got %+v", status)
+	}
+
+	// Each value of remote_address has its own limit
+	if status := check(t, svc, Entry{"remote_address", "5.6.7.8"}); status.Code != CodeOK {
+		t.Errorf("Expected another address to be OK, got %+v", status)
+	}
+}
+
+func TestService_NestedDescriptors(t *testing.T) {
+	svc := newTestService(t)
+	addr := Entry{"remote_address", "1.2.3.4"}
+
+	// Exact values take precedence over any value
+	check(t, svc, addr, Entry{"path", "/login"})
+	if status := check(t, svc, addr, Entry{"path", "/login"}); status.Code != CodeOverLimit {
+		t.Errorf("Expected /login to be over limit, got %+v", status)
+	}
+	status := check(t, svc, addr, Entry{"path", "/home"})
+	if status.Code != CodeOK || status.LimitRemaining != 99 {
+		t.Errorf("Expected /home to have its own limit, got %+v", status)
+	}
+	if status.CurrentLimit != nil {
+		t.Errorf("Expected no reported limit for a 90s window, got %+v", status.CurrentLimit)
+	}
+}
+
+func TestService_Unmatched(t *testing.T) {
+	svc := newTestService(t)
+	for _, entries := range [][]Entry{
+		{{"generic_key", "unlimited"}},
+		{{"generic_key", "other"}},
+		{{"remote_address", "1.2.3.4"}, {"path", "/x"}, {"extra", "y"}},
+	} {
+		for i := 0; i < 5; i++ {
+			if status := check(t, svc, entries...); status.Code != CodeOK || status.CurrentLimit != nil {
+				t.Errorf("%v: expected unlimited OK, got %+v", entries, status)
+			}
+		}
+	}
+
+	resp, err := svc.ShouldRateLimit(context.Background(), &RateLimitRequest{
+		Domain:      "unknown",
+		Descriptors: []Descriptor{{Entries: []Entry{{"remote_address", "1.2.3.4"}}}},
+	})
+	if err != nil || resp.OverallCode != CodeOK {
+		t.Errorf("Expected unknown domains to be OK, got %+v, %v", resp, err)
+	}
+}
+
+func TestService_HitsAddend(t *testing.T) {
+	svc := newTestService(t)
+	addr := Entry{"remote_address", "1.2.3.4"}
+
+	resp, _ := svc.ShouldRateLimit(context.Background(), &RateLimitRequest{
+		Domain:      "edge",
+		HitsAddend:  5,
+		Descriptors: []Descriptor{{Entries: []Entry{addr}}, {Entries: []Entry{addr, {"path", "/a"}}, HitsAddend: 10}},
+	})
+	if resp.OverallCode != CodeOverLimit || resp.Statuses[0].Code != CodeOverLimit {
+		t.Errorf("Expected 5 hits to exceed a limit of 2, got %+v", resp)
+	}
+	if resp.Statuses[1].Code != CodeOK || resp.Statuses[1].LimitRemaining != 90 {
+		t.Errorf("Expected the descriptor's hits to be counted, got %+v", resp.Statuses[1])
+	}
+}
+
+func TestNewService_InvalidConfig(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limit := &ratelimiter.Config{Rate: 1, Window: time.Second}
+
+	for _, domains := range [][]Domain{
+		{{Name: ""}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Descriptors: []DescriptorConfig{{Key: ""}}}},
+		{{Name: "a", Descriptors: []DescriptorConfig{{Key: "k"}, {Key: "k"}}}},
+		{{Name: "a", Descriptors: []DescriptorConfig{{Key: "k", Limit: limit, Algorithm: "leaky_bucket"}}}},
+		{{Name: "a", Descriptors: []DescriptorConfig{{Key: "k", Limit: &ratelimiter.Config{}}}}},
+	} {
+		if _, err := NewService(s, domains); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%+v: expected ErrInvalidConfig, got %v", domains, err)
+		}
+	}
+}
+
+func TestDescriptorKey_NoCollisions(t *testing.T) {
+	a := descriptorKey("d", []Entry{{"k", "v|k2=v2"}})
+	b := descriptorKey("d", []Entry{{"k", "v"}, {"k2", "v2"}})
+	if a == b {
+		t.Errorf("Expected distinct keys, got %q", a)
+	}
+}
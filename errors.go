@@ -13,6 +13,51 @@ var (
 	// ErrInvalidBurstSize is returned when the burst size configuration is invalid.
 	ErrInvalidBurstSize = errors.New("ratelimiter: burst size must be non-negative")
 
+	// ErrInvalidCoalesceWindow is returned when the coalesce window configuration is invalid.
+	ErrInvalidCoalesceWindow = errors.New("ratelimiter: coalesce window must be non-negative")
+
+	// ErrInvalidWarmup is returned when the warm-up configuration is invalid.
+	ErrInvalidWarmup = errors.New("ratelimiter: warm-up period and burst must be non-negative")
+
+	// ErrInvalidRetryAfterJitter is returned when the retry-after jitter configuration is invalid.
+	ErrInvalidRetryAfterJitter = errors.New("ratelimiter: retry-after jitter must be non-negative")
+
+	// ErrInvalidMaxDebt is returned when the max debt configuration is invalid.
+	ErrInvalidMaxDebt = errors.New("ratelimiter: max debt must be non-negative")
+
+	// ErrInvalidMaxCost is returned when the max cost configuration is invalid.
+	ErrInvalidMaxCost = errors.New("ratelimiter: max cost must be non-negative")
+
+	// ErrInvalidStoreTimeout is returned when the store timeout or retry configuration is invalid.
+	ErrInvalidStoreTimeout = errors.New("ratelimiter: store timeout, retries and backoff must be non-negative")
+
+	// ErrInvalidStateTTL is returned when the state TTL configuration is invalid.
+	ErrInvalidStateTTL = errors.New("ratelimiter: state TTL must be non-negative")
+
+	// ErrInvalidRefill is returned when the refill configuration is invalid.
+	ErrInvalidRefill = errors.New("ratelimiter: refill interval must be non-negative and cannot be combined with a refill schedule")
+
+	// ErrInvalidCronExpression is returned by ParseCron for an invalid expression.
+	ErrInvalidCronExpression = errors.New("ratelimiter: invalid cron expression")
+
+	// ErrInvalidRateFormat is returned by ParseRate for an invalid rate.
+	ErrInvalidRateFormat = errors.New("ratelimiter: invalid rate format")
+
+	// ErrInvalidNamespace is returned when a limiter namespace is invalid.
+	ErrInvalidNamespace = errors.New("ratelimiter: namespace must not contain ':'")
+
+	// ErrConfigMismatch is returned when the state of a key was written by a
+	// limiter with a different config (see algorithms.WithMismatchPolicy).
+	ErrConfigMismatch = errors.New("ratelimiter: state was written by a limiter with a different config")
+
+	// ErrCostExceedsCapacity is returned when a request costs more than the
+	// limiter can ever allow (or more than Config.MaxCost).
+	ErrCostExceedsCapacity = errors.New("ratelimiter: request cost exceeds capacity")
+
+	// ErrDuplicateLimiter is returned by Registry.Register for a name that is
+	// already registered.
+	ErrDuplicateLimiter = errors.New("ratelimiter: limiter already registered")
+
 	// ErrLimitExceeded is returned when the rate limit has been exceeded.
 	ErrLimitExceeded = errors.New("ratelimiter: rate limit exceeded")
 
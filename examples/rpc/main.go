@@ -0,0 +1,81 @@
+// Example: Per-method rate limiting of RPCs
+//
+// This example demonstrates how to limit gRPC and Connect RPCs per method,
+// and how to give the HTTP routes generated by gRPC-Gateway the limits of the
+// methods they call.
+//
+// RPCs are served over HTTP at /pkg.Service/Method, so the Router matches
+// them like any path: an exact method is more specific than its service
+// wildcard. RPCOnLimited answers rate limited RPCs with RESOURCE_EXHAUSTED
+// in the caller's protocol.
+//
+// Run with: go run examples/rpc/main.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/middleware"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// methodLimits are the limits of each RPC method, by fully-qualified name.
+var methodLimits = map[string]ratelimiter.Config{
+	"/users.v1.UserService/CreateUser": {Rate: 5, Window: time.Minute},
+	"/users.v1.UserService/*":          {Rate: 100, Window: time.Minute},
+}
+
+// gatewayRoutes maps the HTTP routes generated by gRPC-Gateway (from the
+// google.api.http annotations of the service) onto the methods they call.
+var gatewayRoutes = []struct {
+	Method, Path, RPC string
+}{
+	{"POST", "/v1/users", "/users.v1.UserService/CreateUser"},
+	{"GET", "/v1/users/*", "/users.v1.UserService/*"},
+}
+
+func main() {
+	memStore := store.NewMemoryStore()
+	defer memStore.Close()
+
+	// Stands in for the mux serving the connect-go (or grpc-go) handlers and
+	// the gRPC-Gateway handler
+	mux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "served %s %s\n", r.Method, r.URL.Path)
+	})
+
+	var endpoints []middleware.EndpointConfig
+	for rpc, config := range methodLimits {
+		endpoints = append(endpoints, middleware.EndpointConfig{Path: rpc, Config: config})
+	}
+	for _, route := range gatewayRoutes {
+		endpoints = append(endpoints, middleware.EndpointConfig{
+			Path:    route.Path,
+			Methods: []string{route.Method},
+			Config:  methodLimits[route.RPC],
+		})
+	}
+
+	router, err := middleware.NewRouter(mux, memStore, endpoints,
+		middleware.WithOnLimited(middleware.RPCOnLimited))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer router.Close()
+
+	fmt.Println("Server starting on :8080")
+	fmt.Println("")
+	fmt.Println("Method rate limits:")
+	fmt.Println("  CreateUser (POST /v1/users)      : 5 req/min")
+	fmt.Println("  other UserService methods        : 100 req/min")
+	fmt.Println("")
+	fmt.Println("Test commands:")
+	fmt.Println(`  Connect: for i in {1..7}; do curl -s -X POST -H 'Content-Type: application/json' -H 'Connect-Protocol-Version: 1' -d '{}' http://localhost:8080/users.v1.UserService/CreateUser; done`)
+	fmt.Println(`  Gateway: for i in {1..7}; do curl -s -X POST -d '{}' http://localhost:8080/v1/users; done`)
+
+	log.Fatal(http.ListenAndServe(":8080", router))
+}
@@ -0,0 +1,147 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// FallbackConfig configures a FallbackLimiter.
+type FallbackConfig struct {
+	// ProbeInterval is how often the primary is retried while degraded.
+	// Default: 5 seconds.
+	ProbeInterval time.Duration
+
+	// IsFailure reports whether an error from the primary means it is
+	// unavailable. Default: any error except ErrCostExceedsCapacity.
+	// Request-specific store errors (e.g. store.ErrKeyTooLong) can be
+	// excluded here so that they are returned instead of degrading.
+	IsFailure func(error) bool
+
+	// OnSwitch is called when the limiter switches to the secondary
+	// (degraded=true) or back to the primary (degraded=false), e.g. for
+	// logging or metrics. It must not block.
+	OnSwitch func(degraded bool)
+}
+
+// FallbackLimiter uses a primary limiter (e.g. backed by Redis) and
+// transparently switches to a secondary limiter (e.g. backed by a local
+// MemoryStore) when the primary fails, instead of failing open. While
+// degraded, the primary is probed every ProbeInterval, with Ping if it
+// implements Pinger or with a live request otherwise, and used again as soon
+// as it succeeds.
+//
+// The secondary only sees the traffic of this process, so limits are
+// per-instance while degraded.
+type FallbackLimiter struct {
+	primary   Limiter
+	secondary Limiter
+	config    FallbackConfig
+	degraded  atomic.Bool
+	nextProbe atomic.Int64 // Unix nanoseconds of the next primary probe
+}
+
+// NewFallbackLimiter creates a fallback limiter with default configuration.
+func NewFallbackLimiter(primary, secondary Limiter) *FallbackLimiter {
+	return NewFallbackLimiterWithConfig(primary, secondary, FallbackConfig{})
+}
+
+// NewFallbackLimiterWithConfig creates a fallback limiter with custom configuration.
+func NewFallbackLimiterWithConfig(primary, secondary Limiter, config FallbackConfig) *FallbackLimiter {
+	if config.ProbeInterval <= 0 {
+		config.ProbeInterval = 5 * time.Second
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = func(err error) bool {
+			return !errors.Is(err, ErrCostExceedsCapacity)
+		}
+	}
+
+	return &FallbackLimiter{
+		primary:   primary,
+		secondary: secondary,
+		config:    config,
+	}
+}
+
+// Allow checks if a single request is allowed for the given key.
+func (f *FallbackLimiter) Allow(key string) (bool, error) {
+	return f.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed for the given key.
+func (f *FallbackLimiter) AllowN(key string, n int) (bool, error) {
+	result, err := f.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n requests are allowed and returns detailed result.
+// If a limiter does not provide details, only Result.Allowed is populated.
+func (f *FallbackLimiter) AllowNWithDetails(key string, n int) (Result, error) {
+	if !f.degraded.Load() || f.shouldProbe(time.Now()) {
+		result, err := WithDetails(f.primary).AllowNWithDetails(key, n)
+		if err == nil || !f.config.IsFailure(err) {
+			f.restore()
+			return result, err
+		}
+		f.degrade(time.Now())
+	}
+
+	return WithDetails(f.secondary).AllowNWithDetails(key, n)
+}
+
+// Reset clears the rate limit state for the given key in both limiters.
+func (f *FallbackLimiter) Reset(key string) error {
+	errPrimary := f.primary.Reset(key)
+	errSecondary := f.secondary.Reset(key)
+	return errors.Join(errPrimary, errSecondary)
+}
+
+// Degraded reports whether the secondary limiter is currently in use.
+func (f *FallbackLimiter) Degraded() bool {
+	return f.degraded.Load()
+}
+
+// Ping checks the primary limiter if it implements Pinger.
+func (f *FallbackLimiter) Ping(ctx context.Context) error {
+	if p, ok := f.primary.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// shouldProbe reports whether this caller should retry the primary.
+// Only one caller wins each probe slot. If the primary implements Pinger,
+// it is pinged first so that a failing probe does not cost a request timeout.
+func (f *FallbackLimiter) shouldProbe(now time.Time) bool {
+	next := f.nextProbe.Load()
+	if now.UnixNano() < next {
+		return false
+	}
+	if !f.nextProbe.CompareAndSwap(next, now.Add(f.config.ProbeInterval).UnixNano()) {
+		return false
+	}
+
+	if p, ok := f.primary.(Pinger); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), f.config.ProbeInterval)
+		defer cancel()
+		return p.Ping(ctx) == nil
+	}
+	return true
+}
+
+// degrade switches to the secondary limiter.
+func (f *FallbackLimiter) degrade(now time.Time) {
+	f.nextProbe.Store(now.Add(f.config.ProbeInterval).UnixNano())
+	if f.degraded.CompareAndSwap(false, true) && f.config.OnSwitch != nil {
+		f.config.OnSwitch(true)
+	}
+}
+
+// restore switches back to the primary limiter.
+func (f *FallbackLimiter) restore() {
+	if f.degraded.Load() && f.degraded.CompareAndSwap(true, false) && f.config.OnSwitch != nil {
+		f.config.OnSwitch(false)
+	}
+}
@@ -0,0 +1,83 @@
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyLimiter wraps countingLimiter and fails while err is set.
+type flakyLimiter struct {
+	countingLimiter
+	err   error
+	calls int
+}
+
+func (f *flakyLimiter) Allow(key string) (bool, error) { return f.AllowN(key, 1) }
+
+func (f *flakyLimiter) AllowN(key string, n int) (bool, error) {
+	f.calls++
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.countingLimiter.AllowN(key, n)
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	primary := &flakyLimiter{countingLimiter: countingLimiter{limit: 100, counts: map[string]int{}}}
+	secondary := &countingLimiter{limit: 2, counts: map[string]int{}}
+
+	var switches []bool
+	f := NewFallbackLimiterWithConfig(primary, secondary, FallbackConfig{
+		ProbeInterval: 20 * time.Millisecond,
+		OnSwitch:      func(degraded bool) { switches = append(switches, degraded) },
+	})
+
+	if ok, err := f.Allow("key"); !ok || err != nil || f.Degraded() {
+		t.Fatalf("Expected primary to serve the request, got %v, %v", ok, err)
+	}
+
+	// Primary outage: the secondary enforces its own limit instead of failing open
+	primary.err = errors.New("connection refused")
+	for i := 0; i < 2; i++ {
+		if ok, err := f.Allow("key"); !ok || err != nil {
+			t.Fatalf("Request %d should be allowed by the secondary, got %v, %v", i+1, ok, err)
+		}
+	}
+	if ok, _ := f.Allow("key"); ok {
+		t.Error("Expected the secondary limit to apply while degraded")
+	}
+	if !f.Degraded() {
+		t.Error("Expected limiter to be degraded")
+	}
+	if primary.calls != 2 {
+		t.Errorf("Expected the primary not to be retried before the probe interval, got %d calls", primary.calls)
+	}
+
+	// Primary recovers and is picked up by the next probe
+	primary.err = nil
+	time.Sleep(25 * time.Millisecond)
+	if ok, err := f.Allow("key"); !ok || err != nil {
+		t.Errorf("Expected the probe to use the recovered primary, got %v, %v", ok, err)
+	}
+	if f.Degraded() {
+		t.Error("Expected limiter to switch back to the primary")
+	}
+
+	if len(switches) != 2 || !switches[0] || switches[1] {
+		t.Errorf("Expected switches [true false], got %v", switches)
+	}
+}
+
+func TestFallbackLimiter_NonFailureErrors(t *testing.T) {
+	primary := &flakyLimiter{err: ErrCostExceedsCapacity}
+	secondary := &countingLimiter{limit: 10, counts: map[string]int{}}
+	f := NewFallbackLimiter(primary, secondary)
+
+	if _, err := f.AllowN("key", 1000); !errors.Is(err, ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity from the primary, got %v", err)
+	}
+	if f.Degraded() {
+		t.Error("Request errors must not switch to the secondary")
+	}
+}
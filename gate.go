@@ -0,0 +1,314 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrGateClosed is returned by Gate.Submit after Shutdown or Close.
+	ErrGateClosed = errors.New("ratelimiter: gate closed")
+
+	// ErrGateFull is returned by Gate.Submit when the lane of a job is full.
+	ErrGateFull = errors.New("ratelimiter: gate queue full")
+)
+
+// gatePollInterval is the wait between checks of limiters that do not
+// report a retry delay, and between checks of Shutdown.
+const gatePollInterval = 10 * time.Millisecond
+
+// GateConfig configures a Gate.
+type GateConfig struct {
+	// Workers is the maximum number of jobs running at once.
+	// Default: 1.
+	Workers int
+
+	// Lanes is the number of priority lanes. Lane 0 has the highest priority.
+	// Default: 1.
+	Lanes int
+
+	// QueueSize is the maximum number of jobs queued per lane.
+	// Default: 1000.
+	QueueSize int
+}
+
+// GateStats are the counters of a Gate.
+type GateStats struct {
+	Queued     []int  `json:"queued"`     // Jobs waiting, per lane
+	Running    int    `json:"running"`    // Jobs running
+	Dispatched uint64 `json:"dispatched"` // Jobs started
+	Throttled  uint64 `json:"throttled"`  // Quota checks that held jobs back
+	Dropped    uint64 `json:"dropped"`    // Jobs costing more than their quota can ever allow
+}
+
+// gateJob is a queued job.
+type gateJob struct {
+	key  string
+	cost int
+	run  func()
+}
+
+// Gate runs queued jobs on a pool of workers as their key's quota allows,
+// for batch and cron systems that must respect per-tenant processing
+// quotas. Jobs are dispatched by priority lane, then in submission order;
+// a job whose quota is exhausted does not hold back the jobs of other keys.
+//
+//	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 100, Window: time.Hour}, s)
+//	gate := ratelimiter.NewGate(limiter, ratelimiter.GateConfig{Workers: 8, Lanes: 2})
+//	defer gate.Shutdown(ctx)
+//
+//	gate.Submit(tenant, 0, func() { export(tenant) }) // interactive, lane 0
+//	gate.Submit(tenant, 1, func() { reindex(tenant) }) // background, lane 1
+//
+// Store errors fail open: jobs are dispatched rather than stalled while the
+// store is unavailable.
+type Gate struct {
+	limiter LimiterWithDetails
+	config  GateConfig
+
+	mu     sync.Mutex
+	lanes  [][]gateJob
+	closed bool
+
+	wake  chan struct{} // Signals new jobs to the dispatcher
+	slots chan struct{} // Worker slots
+	stop  chan struct{}
+	done  chan struct{} // Closed when the dispatcher exits
+	once  sync.Once
+	jobs  sync.WaitGroup
+
+	running    atomic.Int64
+	dispatched atomic.Uint64
+	throttled  atomic.Uint64
+	dropped    atomic.Uint64
+}
+
+// NewGate creates a gate and starts its dispatcher.
+func NewGate(limiter Limiter, config GateConfig) *Gate {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.Lanes <= 0 {
+		config.Lanes = 1
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+	g := &Gate{
+		limiter: WithDetails(limiter),
+		config:  config,
+		lanes:   make([][]gateJob, config.Lanes),
+		wake:    make(chan struct{}, 1),
+		slots:   make(chan struct{}, config.Workers),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go g.dispatch()
+	return g
+}
+
+// Submit queues a job of key in the given priority lane (0 is the highest;
+// out of range lanes are clamped). The job runs once the quota of key allows
+// one request.
+func (g *Gate) Submit(key string, lane int, job func()) error {
+	return g.SubmitN(key, lane, 1, job)
+}
+
+// SubmitN queues a job of key costing n requests of its quota.
+func (g *Gate) SubmitN(key string, lane, n int, job func()) error {
+	lane = min(max(lane, 0), g.config.Lanes-1)
+	n = max(n, 1)
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return ErrGateClosed
+	}
+	if len(g.lanes[lane]) >= g.config.QueueSize {
+		g.mu.Unlock()
+		return ErrGateFull
+	}
+	g.lanes[lane] = append(g.lanes[lane], gateJob{key: key, cost: n, run: job})
+	g.mu.Unlock()
+
+	select {
+	case g.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// dispatch starts jobs as worker slots and quotas allow, until stopped.
+func (g *Gate) dispatch() {
+	defer close(g.done)
+	for {
+		select {
+		case <-g.stop:
+			return
+		default:
+		}
+		select {
+		case g.slots <- struct{}{}:
+		case <-g.stop:
+			return
+		}
+
+		job, wait, ok := g.next()
+		if ok {
+			g.start(job)
+			continue
+		}
+		<-g.slots
+
+		var timer *time.Timer
+		var retry <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			retry = timer.C
+		}
+		select {
+		case <-g.wake:
+		case <-retry:
+		case <-g.stop:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// next removes and returns the first job allowed by its quota, by lane then
+// in order. Otherwise it returns the time until a held back job may be
+// allowed, or 0 if no job is queued.
+func (g *Gate) next() (gateJob, time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var wait time.Duration
+	var denied map[string]bool
+	for l, jobs := range g.lanes {
+		for i := 0; i < len(jobs); i++ {
+			job := jobs[i]
+			if denied[job.key] {
+				continue
+			}
+
+			result, err := g.limiter.AllowNWithDetails(job.key, job.cost)
+			if errors.Is(err, ErrCostExceedsCapacity) {
+				g.dropped.Add(1)
+				jobs = append(jobs[:i], jobs[i+1:]...)
+				g.lanes[l] = jobs
+				i--
+				continue
+			}
+			if err == nil && !result.Allowed {
+				g.throttled.Add(1)
+				if denied == nil {
+					denied = make(map[string]bool)
+				}
+				denied[job.key] = true
+				retry := result.RetryAfter
+				if retry <= 0 {
+					retry = gatePollInterval
+				}
+				if wait == 0 || retry < wait {
+					wait = retry
+				}
+				continue
+			}
+
+			g.lanes[l] = append(jobs[:i], jobs[i+1:]...)
+			return job, 0, true
+		}
+	}
+	return gateJob{}, wait, false
+}
+
+// start runs job in its worker slot.
+func (g *Gate) start(job gateJob) {
+	g.dispatched.Add(1)
+	g.running.Add(1)
+	g.jobs.Add(1)
+	go func() {
+		defer func() {
+			g.running.Add(-1)
+			<-g.slots
+			g.jobs.Done()
+			// A slot is free: jobs held back for lack of workers can start
+			select {
+			case g.wake <- struct{}{}:
+			default:
+			}
+		}()
+		job.run()
+	}()
+}
+
+// Stats returns the counters of the gate.
+func (g *Gate) Stats() GateStats {
+	g.mu.Lock()
+	queued := make([]int, len(g.lanes))
+	for i, jobs := range g.lanes {
+		queued[i] = len(jobs)
+	}
+	g.mu.Unlock()
+
+	return GateStats{
+		Queued:     queued,
+		Running:    int(g.running.Load()),
+		Dispatched: g.dispatched.Load(),
+		Throttled:  g.throttled.Load(),
+		Dropped:    g.dropped.Load(),
+	}
+}
+
+// Shutdown stops accepting jobs and waits for the queued jobs to be
+// dispatched as their quotas allow and for the running jobs to finish.
+// If ctx is done first, the jobs still queued are dropped, Shutdown waits
+// for the running jobs and returns the context's error.
+func (g *Gate) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	ticker := time.NewTicker(gatePollInterval)
+	defer ticker.Stop()
+
+	for {
+		stats := g.Stats()
+		idle := stats.Running == 0
+		for _, n := range stats.Queued {
+			idle = idle && n == 0
+		}
+		if idle {
+			g.Close()
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			g.Close()
+			return ctx.Err()
+		}
+	}
+}
+
+// Close stops the gate at once: it stops accepting jobs, drops the queued
+// ones and waits for the running jobs to finish.
+func (g *Gate) Close() error {
+	g.mu.Lock()
+	g.closed = true
+	for i := range g.lanes {
+		g.lanes[i] = nil
+	}
+	g.mu.Unlock()
+
+	g.once.Do(func() { close(g.stop) })
+	<-g.done
+	g.jobs.Wait()
+	return nil
+}
@@ -0,0 +1,169 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// quotaLimiter allows limit requests per key until refilled. It is safe for
+// concurrent use.
+type quotaLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	counts map[string]int
+}
+
+func (q *quotaLimiter) Allow(key string) (bool, error) { return q.AllowN(key, 1) }
+
+func (q *quotaLimiter) AllowN(key string, n int) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > q.limit {
+		return false, ErrCostExceedsCapacity
+	}
+	if q.counts[key]+n > q.limit {
+		return false, nil
+	}
+	q.counts[key] += n
+	return true, nil
+}
+
+func (q *quotaLimiter) Reset(key string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.counts, key)
+	return nil
+}
+
+// record returns a job appending name to a shared log.
+func record(mu *sync.Mutex, log *[]string, name string) func() {
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		*log = append(*log, name)
+	}
+}
+
+func TestGate_Quotas(t *testing.T) {
+	limiter := &quotaLimiter{limit: 2, counts: map[string]int{}}
+	gate := NewGate(limiter, GateConfig{Workers: 4})
+
+	var mu sync.Mutex
+	var ran []string
+	for _, name := range []string{"a1", "a2", "a3", "b1"} {
+		if err := gate.Submit(name[:1], 0, record(&mu, &ran, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a3 is held back by its quota without holding back b1
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := gate.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want DeadlineExceeded while a job is held back", err)
+	}
+	slices.Sort(ran)
+	if !slices.Equal(ran, []string{"a1", "a2", "b1"}) {
+		t.Errorf("ran %v, want a1 a2 b1", ran)
+	}
+
+	stats := gate.Stats()
+	if stats.Dispatched != 3 || stats.Throttled == 0 {
+		t.Errorf("Stats = %+v, want 3 dispatched and throttled checks", stats)
+	}
+	if err := gate.Submit("a", 0, func() {}); !errors.Is(err, ErrGateClosed) {
+		t.Errorf("Submit after Shutdown = %v, want ErrGateClosed", err)
+	}
+}
+
+func TestGate_Lanes(t *testing.T) {
+	limiter := &quotaLimiter{limit: 100, counts: map[string]int{}}
+	gate := NewGate(limiter, GateConfig{Lanes: 2})
+
+	// Hold the only worker while the jobs are queued
+	release := make(chan struct{})
+	gate.Submit("k", 0, func() { <-release })
+
+	var mu sync.Mutex
+	var ran []string
+	gate.Submit("k", 1, record(&mu, &ran, "low1"))
+	gate.Submit("k", 1, record(&mu, &ran, "low2"))
+	gate.Submit("k", 0, record(&mu, &ran, "high"))
+	gate.Submit("k", 7, record(&mu, &ran, "low3")) // clamped to lane 1
+
+	time.Sleep(20 * time.Millisecond)
+	if queued := gate.Stats().Queued; !slices.Equal(queued, []int{1, 3}) {
+		t.Errorf("Queued = %v, want [1 3]", queued)
+	}
+	close(release)
+
+	if err := gate.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ran, []string{"high", "low1", "low2", "low3"}) {
+		t.Errorf("ran %v, want high then low jobs in order", ran)
+	}
+}
+
+func TestGate_Workers(t *testing.T) {
+	limiter := &quotaLimiter{limit: 100, counts: map[string]int{}}
+	gate := NewGate(limiter, GateConfig{Workers: 2})
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	for i := 0; i < 6; i++ {
+		gate.Submit("k", 0, func() {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	if err := gate.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak)
+	}
+	if stats := gate.Stats(); stats.Dispatched != 6 || stats.Running != 0 {
+		t.Errorf("Stats = %+v, want 6 dispatched", stats)
+	}
+}
+
+func TestGate_Limits(t *testing.T) {
+	limiter := &quotaLimiter{limit: 2, counts: map[string]int{}}
+	gate := NewGate(limiter, GateConfig{QueueSize: 1})
+	defer gate.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	gate.Submit("k", 0, func() { <-release })
+	time.Sleep(20 * time.Millisecond)
+
+	if err := gate.SubmitN("k", 0, 3, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gate.Submit("k", 0, func() {}); !errors.Is(err, ErrGateFull) {
+		t.Errorf("Submit = %v, want ErrGateFull", err)
+	}
+}
+
+func TestGate_DropsImpossibleJobs(t *testing.T) {
+	limiter := &quotaLimiter{limit: 2, counts: map[string]int{}}
+	gate := NewGate(limiter, GateConfig{})
+	gate.SubmitN("k", 0, 3, func() { t.Error("job costing more than its quota should not run") })
+	if err := gate.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := gate.Stats(); stats.Dropped != 1 {
+		t.Errorf("Stats = %+v, want 1 dropped", stats)
+	}
+}
@@ -0,0 +1,52 @@
+package ratelimiter
+
+// GlobalKey is the key used by limiters created with NewGlobal.
+const GlobalKey = "global"
+
+// FixedKeyLimiter wraps a Limiter so that every check uses the same key,
+// regardless of the key passed by the caller. It can be passed anywhere a
+// Limiter is expected (e.g. middleware) to enforce a single shared limit.
+type FixedKeyLimiter struct {
+	limiter Limiter
+	key     string
+}
+
+// NewFixedKey returns a limiter that always checks l with key.
+func NewFixedKey(l Limiter, key string) *FixedKeyLimiter {
+	return &FixedKeyLimiter{limiter: l, key: key}
+}
+
+// NewGlobal returns a limiter that caps the total throughput of l across all
+// callers, without the caller inventing a dummy key. The underlying limiter
+// should not be shared with per-key limits, or its state would collide with
+// a real key named GlobalKey.
+func NewGlobal(l Limiter) *FixedKeyLimiter {
+	return NewFixedKey(l, GlobalKey)
+}
+
+// Allow checks if a single request is allowed. The key is ignored.
+func (f *FixedKeyLimiter) Allow(_ string) (bool, error) {
+	return f.limiter.Allow(f.key)
+}
+
+// AllowN checks if n requests are allowed. The key is ignored.
+func (f *FixedKeyLimiter) AllowN(_ string, n int) (bool, error) {
+	return f.limiter.AllowN(f.key, n)
+}
+
+// AllowNWithDetails checks if n requests are allowed and returns detailed result.
+// The key is ignored. If the underlying limiter does not provide details, only
+// Result.Allowed is populated.
+func (f *FixedKeyLimiter) AllowNWithDetails(_ string, n int) (Result, error) {
+	return WithDetails(f.limiter).AllowNWithDetails(f.key, n)
+}
+
+// Reset clears the shared rate limit state. The key is ignored.
+func (f *FixedKeyLimiter) Reset(_ string) error {
+	return f.limiter.Reset(f.key)
+}
+
+// Key returns the fixed key used for all checks.
+func (f *FixedKeyLimiter) Key() string {
+	return f.key
+}
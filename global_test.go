@@ -0,0 +1,66 @@
+package ratelimiter
+
+import "testing"
+
+// countingLimiter allows up to limit requests per key.
+type countingLimiter struct {
+	limit  int
+	counts map[string]int
+}
+
+func (c *countingLimiter) Allow(key string) (bool, error) { return c.AllowN(key, 1) }
+
+func (c *countingLimiter) AllowN(key string, n int) (bool, error) {
+	if c.counts[key]+n > c.limit {
+		return false, nil
+	}
+	c.counts[key] += n
+	return true, nil
+}
+
+func (c *countingLimiter) Reset(key string) error {
+	delete(c.counts, key)
+	return nil
+}
+
+func TestNewGlobal(t *testing.T) {
+	inner := &countingLimiter{limit: 3, counts: map[string]int{}}
+	g := NewGlobal(inner)
+
+	// Different keys share the same global limit
+	for i, key := range []string{"a", "b", "c"} {
+		if ok, _ := g.Allow(key); !ok {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+	if ok, _ := g.Allow("d"); ok {
+		t.Error("Fourth request should be denied")
+	}
+	if inner.counts[GlobalKey] != 3 {
+		t.Errorf("Expected state under %q, got %v", GlobalKey, inner.counts)
+	}
+
+	result, err := g.AllowNWithDetails("e", 1)
+	if err != nil || result.Allowed {
+		t.Errorf("Expected denied result, got %+v, %v", result, err)
+	}
+
+	if err := g.Reset("anything"); err != nil {
+		t.Fatalf("Reset returned error: %v", err)
+	}
+	if ok, _ := g.AllowN("x", 3); !ok {
+		t.Error("Expected requests to be allowed after reset")
+	}
+}
+
+func TestNewFixedKey(t *testing.T) {
+	inner := &countingLimiter{limit: 1, counts: map[string]int{}}
+	f := NewFixedKey(inner, "endpoint:/search")
+	if f.Key() != "endpoint:/search" {
+		t.Errorf("Unexpected key %q", f.Key())
+	}
+	f.Allow("client")
+	if inner.counts["endpoint:/search"] != 1 {
+		t.Errorf("Expected state under fixed key, got %v", inner.counts)
+	}
+}
@@ -0,0 +1,135 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pinger is implemented by limiters and stores that can verify their backend
+// is reachable.
+type Pinger interface {
+	// Ping returns an error if the backend cannot serve requests.
+	Ping(ctx context.Context) error
+}
+
+// namedPinger is a registered health check.
+type namedPinger struct {
+	name   string
+	pinger Pinger
+}
+
+// HealthChecker aggregates the health of several limiters or stores, for
+// readiness probes and to let the middleware switch to a degraded mode
+// before every request pays for a failing backend.
+//
+// Check runs the probes on demand. Start runs them periodically and caches
+// the outcome, which Healthy reports without blocking.
+type HealthChecker struct {
+	mu      sync.RWMutex
+	checks  []namedPinger
+	healthy atomic.Bool
+
+	stopChan  chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewHealthChecker creates an empty health checker. It reports healthy
+// until a check fails.
+func NewHealthChecker() *HealthChecker {
+	h := &HealthChecker{stopChan: make(chan struct{})}
+	h.healthy.Store(true)
+	return h
+}
+
+// Register adds a named check. Values that do not implement Pinger (e.g. a
+// store without Ping support) are considered always healthy and ignored.
+func (h *HealthChecker) Register(name string, v interface{}) {
+	p, ok := v.(Pinger)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, namedPinger{name: name, pinger: p})
+}
+
+// Check pings every registered check and returns their errors joined,
+// each prefixed by the check name. It also updates the cached status.
+func (h *HealthChecker) Check(ctx context.Context) error {
+	h.mu.RLock()
+	checks := h.checks
+	h.mu.RUnlock()
+
+	var errs []error
+	for _, c := range checks {
+		if err := c.pinger.Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+
+	err := errors.Join(errs...)
+	h.healthy.Store(err == nil)
+	return err
+}
+
+// Healthy reports the outcome of the last Check.
+func (h *HealthChecker) Healthy() bool {
+	return h.healthy.Load()
+}
+
+// Start runs Check every interval in the background, each bounded by
+// timeout (or interval if timeout is not positive). Call Close to stop it.
+func (h *HealthChecker) Start(interval, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = interval
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				_ = h.Check(ctx)
+				cancel()
+			case <-h.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background checks started by Start.
+func (h *HealthChecker) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.stopChan)
+	})
+	h.wg.Wait()
+	return nil
+}
+
+// ServeHTTP runs the checks and responds 200 OK if they pass, or
+// 503 Service Unavailable otherwise. Check names are not exposed.
+func (h *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := h.Check(r.Context()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("unhealthy\n"))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
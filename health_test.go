@@ -0,0 +1,99 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakePinger struct {
+	err   atomic.Pointer[error]
+	calls atomic.Int32
+}
+
+func (p *fakePinger) Ping(ctx context.Context) error {
+	p.calls.Add(1)
+	if err := p.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func (p *fakePinger) fail(err error) {
+	p.err.Store(&err)
+}
+
+func TestHealthChecker_Check(t *testing.T) {
+	hc := NewHealthChecker()
+	store, limiter := &fakePinger{}, &fakePinger{}
+	hc.Register("store", store)
+	hc.Register("limiter", limiter)
+	hc.Register("ignored", struct{}{})
+
+	if !hc.Healthy() {
+		t.Error("Expected healthy before any check")
+	}
+	if err := hc.Check(context.Background()); err != nil {
+		t.Fatalf("Expected healthy, got %v", err)
+	}
+
+	down := errors.New("connection refused")
+	store.fail(down)
+	err := hc.Check(context.Background())
+	if !errors.Is(err, down) || !strings.Contains(err.Error(), "store: ") {
+		t.Errorf("Expected named store error, got %v", err)
+	}
+	if hc.Healthy() {
+		t.Error("Expected cached status to be unhealthy")
+	}
+}
+
+func TestHealthChecker_ServeHTTP(t *testing.T) {
+	hc := NewHealthChecker()
+	p := &fakePinger{}
+	hc.Register("store", p)
+
+	rec := httptest.NewRecorder()
+	hc.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+
+	p.fail(errors.New("secret internal detail"))
+	rec = httptest.NewRecorder()
+	hc.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Error("Health endpoint must not leak error details")
+	}
+}
+
+func TestHealthChecker_Start(t *testing.T) {
+	hc := NewHealthChecker()
+	p := &fakePinger{}
+	p.fail(errors.New("down"))
+	hc.Register("store", p)
+
+	hc.Start(time.Millisecond, 0)
+	deadline := time.Now().Add(time.Second)
+	for hc.Healthy() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if hc.Healthy() {
+		t.Fatal("Expected background check to mark the checker unhealthy")
+	}
+
+	hc.Close()
+	calls := p.calls.Load()
+	time.Sleep(5 * time.Millisecond)
+	if p.calls.Load() != calls {
+		t.Error("Expected no checks after Close")
+	}
+}
@@ -0,0 +1,17 @@
+package ratelimiter
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// AddJitter returns d plus a uniformly random duration in [0, max).
+// It is used to spread the retries of clients that were limited at the same
+// time. Jitter is only ever added, so clients never retry before d has passed.
+// If max is not positive, d is returned unchanged.
+func AddJitter(d, max time.Duration) time.Duration {
+	if max <= 0 {
+		return d
+	}
+	return d + rand.N(max)
+}
@@ -0,0 +1,27 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddJitter(t *testing.T) {
+	if got := AddJitter(time.Second, 0); got != time.Second {
+		t.Errorf("Expected no jitter with max=0, got %v", got)
+	}
+	if got := AddJitter(time.Second, -time.Second); got != time.Second {
+		t.Errorf("Expected no jitter with negative max, got %v", got)
+	}
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		got := AddJitter(time.Second, 100*time.Millisecond)
+		if got < time.Second || got >= 1100*time.Millisecond {
+			t.Fatalf("Jitter out of bounds: %v", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Error("Expected jitter to produce different values")
+	}
+}
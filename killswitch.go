@@ -0,0 +1,69 @@
+package ratelimiter
+
+import "sync/atomic"
+
+// KillSwitch wraps a Limiter with a runtime switch for emergencies ("stop
+// blocking customers now"): while enforcement is off, every check still goes
+// through the wrapped limiter, so state keeps being counted and its metrics
+// emitted, but denials are turned into allowances. Turning enforcement back
+// on takes effect with the next check, with the state counted in between.
+//
+//	limiter := ratelimiter.NewKillSwitch(tokenBucket)
+//	limiter.SetEnforcement(false) // e.g. from an admin endpoint
+//
+// Errors of the wrapped limiter are returned unchanged.
+type KillSwitch struct {
+	limiter  LimiterWithDetails
+	disabled atomic.Bool
+	bypassed atomic.Uint64
+}
+
+// NewKillSwitch returns l with enforcement on.
+func NewKillSwitch(l Limiter) *KillSwitch {
+	return &KillSwitch{limiter: WithDetails(l)}
+}
+
+// SetEnforcement turns the enforcement of the limit on or off.
+func (k *KillSwitch) SetEnforcement(enabled bool) {
+	k.disabled.Store(!enabled)
+}
+
+// Enforcing reports whether the limit is enforced.
+func (k *KillSwitch) Enforcing() bool {
+	return !k.disabled.Load()
+}
+
+// Bypassed returns the number of checks denied by the wrapped limiter but
+// allowed because enforcement was off.
+func (k *KillSwitch) Bypassed() uint64 {
+	return k.bypassed.Load()
+}
+
+// Allow checks if a single request is allowed.
+func (k *KillSwitch) Allow(key string) (bool, error) {
+	return k.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed.
+func (k *KillSwitch) AllowN(key string, n int) (bool, error) {
+	result, err := k.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n requests are allowed. While enforcement is
+// off, denied checks are reported as allowed without a RetryAfter; the other
+// fields describe the state of the wrapped limiter.
+func (k *KillSwitch) AllowNWithDetails(key string, n int) (Result, error) {
+	result, err := k.limiter.AllowNWithDetails(key, n)
+	if err == nil && !result.Allowed && k.disabled.Load() {
+		k.bypassed.Add(1)
+		result.Allowed = true
+		result.RetryAfter = 0
+	}
+	return result, err
+}
+
+// Reset clears the rate limit state for the given key.
+func (k *KillSwitch) Reset(key string) error {
+	return k.limiter.Reset(key)
+}
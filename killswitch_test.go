@@ -0,0 +1,37 @@
+package ratelimiter
+
+import "testing"
+
+func TestKillSwitch(t *testing.T) {
+	inner := &quotaLimiter{limit: 1, counts: map[string]int{}}
+	k := NewKillSwitch(inner)
+
+	if allowed, _ := k.Allow("a"); !allowed {
+		t.Fatal("first request should be allowed")
+	}
+	if allowed, _ := k.Allow("a"); allowed {
+		t.Error("request over the limit should be denied while enforcing")
+	}
+
+	k.SetEnforcement(false)
+	if k.Enforcing() {
+		t.Error("Enforcing should be false")
+	}
+	result, err := k.AllowNWithDetails("a", 1)
+	if err != nil || !result.Allowed || result.RetryAfter != 0 {
+		t.Errorf("AllowNWithDetails = %+v, %v, want allowed while not enforcing", result, err)
+	}
+	if _, err := k.AllowN("a", 2); err != ErrCostExceedsCapacity {
+		t.Errorf("AllowN(2) = %v, want errors passed through", err)
+	}
+
+	// Checks keep being counted: "b" uses its quota while not enforcing
+	k.Allow("b")
+	k.SetEnforcement(true)
+	if allowed, _ := k.Allow("b"); allowed {
+		t.Error("quota used while not enforcing should still count")
+	}
+	if got := k.Bypassed(); got != 1 {
+		t.Errorf("Bypassed = %d, want 1", got)
+	}
+}
@@ -33,6 +33,82 @@ type Config struct {
 	// BurstSize is the maximum burst size (used by Token Bucket algorithm).
 	// If not set, defaults to Rate.
 	BurstSize int
+
+	// CoalesceWindow enables per-key request coalescing when positive.
+	// Concurrent checks for the same key are grouped so that only one store
+	// round trip (Get + Set) is performed per batch; the other callers are
+	// served from the in-flight result. The first caller of a batch waits up
+	// to CoalesceWindow to collect followers, so keep it small (e.g. 1ms).
+	// This is mainly useful with remote stores under a thundering herd.
+	CoalesceWindow time.Duration
+
+	// WarmupPeriod enables slow-start for new keys when positive (Token Bucket only).
+	// A key seen for the first time starts with WarmupBurst tokens and its burst
+	// capacity grows linearly to BurstSize over WarmupPeriod, so that fresh keys
+	// (or every key after a store restart) do not get an instant full burst.
+	WarmupPeriod time.Duration
+
+	// WarmupBurst is the initial burst capacity of a new key during warm-up.
+	// If not set, defaults to 1. Values above BurstSize are capped to BurstSize.
+	WarmupBurst int
+
+	// RetryAfterJitter adds a random duration in [0, RetryAfterJitter) to
+	// Result.RetryAfter on denied requests, so that clients limited at the same
+	// time do not retry in lockstep. Default: 0 (no jitter).
+	RetryAfterJitter time.Duration
+
+	// MaxDebt allows a request to take more tokens than are available, letting
+	// the bucket go negative by up to MaxDebt tokens (Token Bucket only). The debt
+	// is paid back by future refills before new requests are allowed. This
+	// smooths occasional oversize requests (e.g. AllowN slightly above the
+	// current tokens) instead of hard-rejecting them. Default: 0 (no debt).
+	MaxDebt int
+
+	// MaxCost is the maximum n accepted by AllowN. Requests with a higher cost
+	// are rejected with ErrCostExceedsCapacity instead of being evaluated.
+	// Regardless of MaxCost, a cost that can never be satisfied (above
+	// BurstSize+MaxDebt for Token Bucket, above Rate for Sliding Window) is
+	// also rejected with ErrCostExceedsCapacity. Default: 0 (no explicit cap).
+	MaxCost int
+
+	// StoreTimeout bounds each store operation (including its retries) when
+	// the store implements store.ContextStore, so that a slow remote store
+	// cannot stall the request path. A Get that times out is treated as a
+	// missing key; a Set or Delete that times out returns the context error.
+	// Default: 0 (only the store's own timeout applies).
+	StoreTimeout time.Duration
+
+	// StoreRetries is the number of times a failed store operation is retried
+	// when the store implements store.ContextStore. Errors that retrying
+	// cannot fix (e.g. store.ErrKeyTooLong, store.ErrCASConflict) are not
+	// retried. Default: 0 (no retries).
+	StoreRetries int
+
+	// StoreRetryBackoff is the delay before the first retry; it doubles on
+	// each subsequent retry. Default: 0 (retry immediately).
+	StoreRetryBackoff time.Duration
+
+	// StateTTL is how long the state of a key is kept after its last request.
+	// A TTL shorter than the time a key takes to recover its full limit (e.g.
+	// 2x Window for Sliding Window) lets idle keys come back early with a
+	// full limit; a longer one keeps state around, e.g. for analytics.
+	// Default: 0 (2x Window for Token Bucket, 3x Window for Sliding Window).
+	StateTTL time.Duration
+
+	// RefillInterval switches the Token Bucket to stepped refill when
+	// positive: instead of continuously, tokens are added in steps of
+	// Rate*RefillInterval/Window at every multiple of RefillInterval since
+	// the Unix epoch (e.g. 10 tokens at the start of each minute for a rate of
+	// 600 per hour with a one-minute interval). Default: 0 (continuous refill).
+	RefillInterval time.Duration
+
+	// RefillSchedule switches the Token Bucket to scheduled refill when set:
+	// Rate tokens are added at each time of the schedule, up to BurstSize
+	// (see ParseCron, e.g. "0 * * * *" for the top of each hour). Window
+	// should be the period of the schedule: it is reported as the window of
+	// the limit and sizes the default StateTTL. Cannot be combined with
+	// RefillInterval. Default: nil (continuous refill).
+	RefillSchedule Schedule
 }
 
 // DefaultConfig returns a sensible default configuration.
@@ -56,6 +132,30 @@ func (c Config) Validate() error {
 	if c.BurstSize < 0 {
 		return ErrInvalidBurstSize
 	}
+	if c.CoalesceWindow < 0 {
+		return ErrInvalidCoalesceWindow
+	}
+	if c.WarmupPeriod < 0 || c.WarmupBurst < 0 {
+		return ErrInvalidWarmup
+	}
+	if c.RetryAfterJitter < 0 {
+		return ErrInvalidRetryAfterJitter
+	}
+	if c.MaxDebt < 0 {
+		return ErrInvalidMaxDebt
+	}
+	if c.MaxCost < 0 {
+		return ErrInvalidMaxCost
+	}
+	if c.StoreTimeout < 0 || c.StoreRetries < 0 || c.StoreRetryBackoff < 0 {
+		return ErrInvalidStoreTimeout
+	}
+	if c.StateTTL < 0 {
+		return ErrInvalidStateTTL
+	}
+	if c.RefillInterval < 0 || c.RefillInterval > 0 && c.RefillSchedule != nil {
+		return ErrInvalidRefill
+	}
 	return nil
 }
 
@@ -81,11 +181,75 @@ type Result struct {
 
 	// RetryAfter is the duration to wait before retrying (if not allowed).
 	RetryAfter time.Duration
+
+	// Used is the number of requests counted against the limit at the time of the check.
+	// For Token Bucket this is the consumed part of the burst capacity; for
+	// Sliding Window it is the weighted request count.
+	Used int
+
+	// Burst is the maximum number of requests that can be made at once.
+	// For Token Bucket this is the BurstSize; for Sliding Window it equals Limit.
+	Burst int
+
+	// Window is the time window the Limit applies to.
+	Window time.Duration
 }
 
 // LimiterWithDetails extends Limiter to provide detailed rate limit information.
+// All limiters in the algorithms package implement it, and the HTTP middleware
+// uses it to emit X-RateLimit-* headers. Use WithDetails to adapt a Limiter
+// that does not implement it.
 type LimiterWithDetails interface {
 	Limiter
 	// AllowNWithDetails checks if n requests are allowed and returns detailed result.
 	AllowNWithDetails(key string, n int) (Result, error)
 }
+
+// WithDetails returns l as a LimiterWithDetails.
+// If l already implements the interface it is returned unchanged. Otherwise the
+// returned adapter reports only Result.Allowed; all other fields are zero.
+func WithDetails(l Limiter) LimiterWithDetails {
+	if d, ok := l.(LimiterWithDetails); ok {
+		return d
+	}
+	return detailsAdapter{l}
+}
+
+// detailsAdapter implements LimiterWithDetails for limiters without details.
+type detailsAdapter struct {
+	Limiter
+}
+
+// AllowNWithDetails checks if n requests are allowed using AllowN.
+func (a detailsAdapter) AllowNWithDetails(key string, n int) (Result, error) {
+	allowed, err := a.AllowN(key, n)
+	return Result{Allowed: allowed}, err
+}
+
+// Refunder is implemented by limiters that can give back capacity consumed
+// by AllowN, e.g. when a request turns out not to count toward the limit
+// (a successful login, a server error). Refunds never raise the available
+// capacity above its maximum.
+type Refunder interface {
+	// RefundN returns n previously allowed requests to the key's budget.
+	RefundN(key string, n int) error
+}
+
+// Granter is implemented by limiters that can give a key temporary capacity
+// on top of its limit, e.g. a one-off boost for a customer during an
+// incident, without changing the configuration of the limiter.
+type Granter interface {
+	// GrantN gives key n extra requests usable until expiry.
+	GrantN(key string, n int, expiry time.Time) error
+}
+
+// DescribableLimiter extends Limiter to report the policy it enforces.
+// Wrappers, admin APIs and metrics can use it instead of keeping a parallel
+// copy of the configuration.
+type DescribableLimiter interface {
+	Limiter
+	// Config returns the effective configuration (with defaults applied).
+	Config() Config
+	// Algorithm returns the name of the rate limiting algorithm (e.g. "token_bucket").
+	Algorithm() string
+}
@@ -70,6 +70,69 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "negative coalesce window",
+			config: Config{
+				Rate:           100,
+				Window:         time.Minute,
+				CoalesceWindow: -time.Millisecond,
+			},
+			wantErr: ErrInvalidCoalesceWindow,
+		},
+		{
+			name: "negative warmup period",
+			config: Config{
+				Rate:         100,
+				Window:       time.Minute,
+				WarmupPeriod: -time.Second,
+			},
+			wantErr: ErrInvalidWarmup,
+		},
+		{
+			name: "negative warmup burst",
+			config: Config{
+				Rate:        100,
+				Window:      time.Minute,
+				WarmupBurst: -1,
+			},
+			wantErr: ErrInvalidWarmup,
+		},
+		{
+			name: "negative retry-after jitter",
+			config: Config{
+				Rate:             100,
+				Window:           time.Minute,
+				RetryAfterJitter: -time.Second,
+			},
+			wantErr: ErrInvalidRetryAfterJitter,
+		},
+		{
+			name: "negative max debt",
+			config: Config{
+				Rate:    100,
+				Window:  time.Minute,
+				MaxDebt: -1,
+			},
+			wantErr: ErrInvalidMaxDebt,
+		},
+		{
+			name: "negative max cost",
+			config: Config{
+				Rate:    100,
+				Window:  time.Minute,
+				MaxCost: -1,
+			},
+			wantErr: ErrInvalidMaxCost,
+		},
+		{
+			name: "negative store retries",
+			config: Config{
+				Rate:         100,
+				Window:       time.Minute,
+				StoreRetries: -1,
+			},
+			wantErr: ErrInvalidStoreTimeout,
+		},
 	}
 
 	for _, tt := range tests {
@@ -127,3 +190,44 @@ func TestDefaultConfig(t *testing.T) {
 		t.Errorf("Default config should be valid: %v", err)
 	}
 }
+
+// plainLimiter is a Limiter without details support.
+type plainLimiter struct {
+	allowed bool
+}
+
+func (p plainLimiter) Allow(key string) (bool, error)         { return p.allowed, nil }
+func (p plainLimiter) AllowN(key string, n int) (bool, error) { return p.allowed, nil }
+func (p plainLimiter) Reset(key string) error                 { return nil }
+
+// detailedLimiter is a Limiter with details support.
+type detailedLimiter struct {
+	plainLimiter
+}
+
+func (d detailedLimiter) AllowNWithDetails(key string, n int) (Result, error) {
+	return Result{Allowed: d.allowed, Limit: 42}, nil
+}
+
+func TestWithDetails(t *testing.T) {
+	// Limiters without details are adapted
+	d := WithDetails(plainLimiter{allowed: true})
+	result, err := d.AllowNWithDetails("key", 1)
+	if err != nil {
+		t.Fatalf("AllowNWithDetails returned error: %v", err)
+	}
+	if !result.Allowed || result.Limit != 0 {
+		t.Errorf("Unexpected adapted result: %+v", result)
+	}
+
+	// Limiters with details are returned unchanged
+	orig := detailedLimiter{plainLimiter{allowed: false}}
+	d = WithDetails(orig)
+	if _, ok := d.(detailedLimiter); !ok {
+		t.Fatalf("Expected original limiter, got %T", d)
+	}
+	result, _ = d.AllowNWithDetails("key", 1)
+	if result.Allowed || result.Limit != 42 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
@@ -0,0 +1,277 @@
+package middleware
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// WithAudit records (sampled) decisions of the middleware in a.
+func WithAudit(a *Auditor) Option {
+	return func(o *Options) {
+		o.Auditor = a
+	}
+}
+
+// AuditRecord is an audited rate limit decision.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Key       string    `json:"key"` // Hashed with AuditConfig.HashKey
+	Endpoint  string    `json:"endpoint"`
+	Allowed   bool      `json:"allowed"`
+	Remaining int       `json:"remaining"`
+
+	// DryRun marks decisions made in dry-run mode: a denied record is a
+	// request that would have been blocked (see WithDryRun).
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// AuditSink receives batches of audit records, e.g. to write them to a
+// file or publish them to a message queue. WriteAudit is called from a
+// single goroutine; the slice is reused once it returns, so sinks that keep
+// records must copy them.
+type AuditSink interface {
+	WriteAudit(records []AuditRecord) error
+}
+
+// AuditSinkFunc adapts a function to AuditSink.
+type AuditSinkFunc func(records []AuditRecord) error
+
+// WriteAudit calls f(records).
+func (f AuditSinkFunc) WriteAudit(records []AuditRecord) error {
+	return f(records)
+}
+
+// NewWriterSink returns a sink writing records to w as JSON lines.
+func NewWriterSink(w io.Writer) AuditSink {
+	enc := json.NewEncoder(w)
+	return AuditSinkFunc(func(records []AuditRecord) error {
+		for i := range records {
+			if err := enc.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NewCSVSink returns a sink writing records to w as CSV, after a header row:
+//
+//	time,key,endpoint,allowed,remaining,dry_run
+//
+// Times are RFC 3339 with nanoseconds. Columnar formats such as Parquet can
+// be produced by a custom AuditSink.
+func NewCSVSink(w io.Writer) AuditSink {
+	cw := csv.NewWriter(w)
+	header := true
+	return AuditSinkFunc(func(records []AuditRecord) error {
+		if header {
+			if err := cw.Write([]string{"time", "key", "endpoint", "allowed", "remaining", "dry_run"}); err != nil {
+				return err
+			}
+			header = false
+		}
+		for _, r := range records {
+			err := cw.Write([]string{
+				r.Time.UTC().Format(time.RFC3339Nano),
+				r.Key,
+				r.Endpoint,
+				strconv.FormatBool(r.Allowed),
+				strconv.Itoa(r.Remaining),
+				strconv.FormatBool(r.DryRun),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	})
+}
+
+// AuditConfig configures an Auditor.
+type AuditConfig struct {
+	// Sink receives the records. Required.
+	Sink AuditSink
+
+	// SampleRate is the fraction of decisions recorded, in (0, 1].
+	// Default: 1 (every decision).
+	SampleRate float64
+
+	// KeepDenied records every denied decision regardless of SampleRate.
+	KeepDenied bool
+
+	// OnlyDenied records denied decisions only, e.g. to export the requests
+	// a dry run would have blocked. Combined with KeepDenied, every denied
+	// decision is recorded.
+	OnlyDenied bool
+
+	// BufferSize is the number of records buffered for the sink. Records
+	// arriving while the buffer is full are dropped (see Auditor.Dropped)
+	// so that a slow sink never blocks requests.
+	// Default: 4096.
+	BufferSize int
+
+	// BatchSize is the maximum number of records passed to the sink at once.
+	// Default: 100.
+	BatchSize int
+
+	// FlushInterval is the maximum time a record waits for its batch to fill.
+	// Default: 1 second.
+	FlushInterval time.Duration
+
+	// HashKey hides keys in records.
+	// Default: the first 16 hex digits of the key's SHA-256 (see MonitorConfig.HashKey).
+	HashKey func(key string) string
+
+	// OnError is called with sink errors. It must not block.
+	// Default: nil (errors are ignored).
+	OnError func(err error)
+}
+
+// Auditor records sampled rate limit decisions to a sink, for post-incident
+// forensics and abuse analysis. Records are buffered and written by a
+// background goroutine; call Close to flush them.
+type Auditor struct {
+	config  AuditConfig
+	records chan auditEntry
+	dropped atomic.Uint64
+
+	stopChan  chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// auditEntry is a record whose key is not hashed yet; hashing is done off
+// the request path.
+type auditEntry struct {
+	record AuditRecord
+	key    string
+}
+
+// NewAuditor creates an auditor and starts its background writer.
+func NewAuditor(config AuditConfig) (*Auditor, error) {
+	if config.Sink == nil {
+		return nil, errors.New("middleware: auditor requires a sink")
+	}
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		config.SampleRate = 1
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 4096
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.HashKey == nil {
+		config.HashKey = hashKey
+	}
+
+	a := &Auditor{
+		config:   config,
+		records:  make(chan auditEntry, config.BufferSize),
+		stopChan: make(chan struct{}),
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a, nil
+}
+
+// record queues a decision if it is sampled. It never blocks.
+func (a *Auditor) record(endpoint, key string, result ratelimiter.Result, dryRun bool) {
+	if a.config.OnlyDenied && result.Allowed {
+		return
+	}
+	if !(a.config.KeepDenied && !result.Allowed) &&
+		a.config.SampleRate < 1 && rand.Float64() >= a.config.SampleRate {
+		return
+	}
+
+	entry := auditEntry{
+		record: AuditRecord{
+			Time:      time.Now(),
+			Endpoint:  endpoint,
+			Allowed:   result.Allowed,
+			Remaining: result.Remaining,
+			DryRun:    dryRun,
+		},
+		key: key,
+	}
+	select {
+	case a.records <- entry:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of records dropped because the buffer was full.
+func (a *Auditor) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// run batches records and passes them to the sink until Close.
+func (a *Auditor) run() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]AuditRecord, 0, a.config.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := a.config.Sink.WriteAudit(batch); err != nil && a.config.OnError != nil {
+			a.config.OnError(err)
+		}
+		batch = batch[:0]
+	}
+	add := func(e auditEntry) {
+		e.record.Key = a.config.HashKey(e.key)
+		batch = append(batch, e.record)
+		if len(batch) == cap(batch) {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case e := <-a.records:
+			add(e)
+		case <-ticker.C:
+			flush()
+		case <-a.stopChan:
+			// Drain what was buffered before Close
+			for {
+				select {
+				case e := <-a.records:
+					add(e)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close flushes the buffered records and stops the background writer.
+// Decisions made afterwards are dropped.
+func (a *Auditor) Close() error {
+	a.closeOnce.Do(func() {
+		close(a.stopChan)
+	})
+	a.wg.Wait()
+	return nil
+}
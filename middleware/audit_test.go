@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestAuditor_RecordsDecisions(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s)
+
+	var buf bytes.Buffer
+	a, err := NewAuditor(AuditConfig{Sink: NewWriterSink(&buf)})
+	if err != nil {
+		t.Fatalf("NewAuditor failed: %v", err)
+	}
+	handler := RateLimitMiddleware(limiter, WithAudit(a))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	a.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if !records[0].Allowed || records[1].Allowed {
+		t.Errorf("Expected allowed then denied, got %+v", records)
+	}
+	if records[0].Key != hashKey("1.2.3.4") || records[0].Endpoint != defaultEndpointName {
+		t.Errorf("Unexpected record: %+v", records[0])
+	}
+	if records[0].Time.IsZero() {
+		t.Error("Expected a timestamp")
+	}
+}
+
+func TestAuditor_Sampling(t *testing.T) {
+	var mu sync.Mutex
+	var allowed, denied int
+	a, _ := NewAuditor(AuditConfig{
+		SampleRate: 0.1,
+		KeepDenied: true,
+		Sink: AuditSinkFunc(func(records []AuditRecord) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range records {
+				if r.Allowed {
+					allowed++
+				} else {
+					denied++
+				}
+			}
+			return nil
+		}),
+	})
+
+	for i := 0; i < 1000; i++ {
+		a.record("*", "k", ratelimiter.Result{Allowed: true}, false)
+		a.record("*", "k", ratelimiter.Result{Allowed: false}, false)
+	}
+	a.Close()
+
+	if denied != 1000 {
+		t.Errorf("Expected every denial with KeepDenied, got %d", denied)
+	}
+	if allowed < 30 || allowed > 200 {
+		t.Errorf("Expected about 100 sampled allowed decisions, got %d", allowed)
+	}
+}
+
+func TestAuditor_NeverBlocks(t *testing.T) {
+	block := make(chan struct{})
+	a, _ := NewAuditor(AuditConfig{
+		BufferSize: 4,
+		BatchSize:  1,
+		Sink: AuditSinkFunc(func(records []AuditRecord) error {
+			<-block
+			return nil
+		}),
+	})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			a.record("*", "k", ratelimiter.Result{}, false)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("record blocked on a slow sink")
+	}
+	if a.Dropped() == 0 {
+		t.Error("Expected records to be dropped")
+	}
+	close(block)
+	a.Close()
+}
+
+func TestAuditor_FlushInterval(t *testing.T) {
+	flushed := make(chan int, 1)
+	a, _ := NewAuditor(AuditConfig{
+		FlushInterval: 10 * time.Millisecond,
+		Sink: AuditSinkFunc(func(records []AuditRecord) error {
+			flushed <- len(records)
+			return nil
+		}),
+	})
+	defer a.Close()
+
+	a.record("*", "k", ratelimiter.Result{Allowed: true}, false)
+	select {
+	case n := <-flushed:
+		if n != 1 {
+			t.Errorf("Expected 1 record, got %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Partial batch not flushed")
+	}
+}
+
+func TestAuditor_SinkErrors(t *testing.T) {
+	var got error
+	a, _ := NewAuditor(AuditConfig{
+		Sink:    AuditSinkFunc(func(records []AuditRecord) error { return errors.New("kafka down") }),
+		OnError: func(err error) { got = err },
+	})
+	a.record("*", "k", ratelimiter.Result{}, false)
+	a.Close()
+
+	if got == nil {
+		t.Error("Expected OnError to be called")
+	}
+}
+
+func TestNewAuditor_RequiresSink(t *testing.T) {
+	if _, err := NewAuditor(AuditConfig{}); err == nil {
+		t.Error("Expected error without a sink")
+	}
+}
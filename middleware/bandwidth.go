@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// ErrBandwidthExceeded is returned by the request body Read and the
+// ResponseWriter Write of a BandwidthMiddleware when the quota is exhausted.
+var ErrBandwidthExceeded = errors.New("middleware: bandwidth limit exceeded")
+
+// BandwidthDirection selects the bodies charged by BandwidthMiddleware.
+type BandwidthDirection int
+
+const (
+	// BandwidthUpload charges request bodies.
+	BandwidthUpload BandwidthDirection = 1 << iota
+
+	// BandwidthDownload charges response bodies.
+	BandwidthDownload
+)
+
+// bandwidthChunk is the largest number of bytes charged at once.
+const bandwidthChunk = 32 << 10
+
+// BandwidthMiddleware creates a middleware that charges one token per body
+// byte, for quotas such as "10 MB per minute per API key":
+//
+//	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{
+//		Rate:   10 << 20, // bytes
+//		Window: time.Minute,
+//	}, store)
+//	mw := middleware.BandwidthMiddleware(limiter, middleware.BandwidthUpload|middleware.BandwidthDownload)
+//
+// Uploads with a Content-Length are charged before the handler runs and
+// rejected with OnLimited if the quota is exhausted (or with 413 if the
+// body can never fit). Other bodies are charged as they are read or
+// written, in chunks of at most 32 KiB (or the limiter's burst size if
+// smaller); once the quota is exhausted, Read and Write return
+// ErrBandwidthExceeded. A response denied before anything was written is
+// answered with OnLimited instead.
+//
+// Store errors other than capacity errors fail open, like RateLimitMiddleware.
+func BandwidthMiddleware(limiter ratelimiter.Limiter, direction BandwidthDirection, opts ...Option) func(http.Handler) http.Handler {
+	options := &Options{
+		KeyFunc:    DefaultKeyFunc,
+		OnLimited:  DefaultOnLimited,
+		MaxKeySize: 4096,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	for i, p := range options.ExcludePaths {
+		options.ExcludePaths[i] = path.Clean(p)
+	}
+	if options.MaxKeySize <= 0 {
+		options.MaxKeySize = 4096
+	}
+	options.KeyFunc = MaskIPKeyFunc(options.KeyFunc, options.IPv4Prefix, options.IPv6Prefix)
+
+	chunk := bandwidthChunk
+	if d, ok := limiter.(ratelimiter.DescribableLimiter); ok {
+		if burst := d.Config().BurstSize; burst > 0 && burst < chunk {
+			chunk = burst
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(options.ExcludePaths) > 0 {
+				cleanPath := fastPathClean(r.URL.Path)
+				for _, p := range options.ExcludePaths {
+					if matchPath(cleanPath, p) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			if options.SkipFunc != nil && options.SkipFunc(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := options.KeyFunc(r)
+			if len(key) > options.MaxKeySize {
+				writeError(w, "Rate limit key too long", http.StatusRequestHeaderFieldsTooLarge)
+				return
+			}
+
+			if direction&BandwidthUpload != 0 && r.Body != nil && r.Body != http.NoBody {
+				if r.ContentLength > 0 {
+					allowed, err := limiter.AllowN(key, int(r.ContentLength))
+					if err != nil {
+						if writeBandwidthError(w, err) {
+							return
+						}
+					} else if !allowed {
+						options.OnLimited(w, r)
+						return
+					}
+				} else {
+					r.Body = &bandwidthReader{ReadCloser: r.Body, limiter: limiter, key: key, chunk: chunk}
+				}
+			}
+
+			if direction&BandwidthDownload != 0 {
+				orig := w
+				w = &bandwidthWriter{
+					ResponseWriter: orig,
+					limiter:        limiter,
+					key:            key,
+					chunk:          chunk,
+					onLimited:      func() { options.OnLimited(orig, r) },
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeBandwidthError maps limiter errors like RateLimitMiddleware and
+// reports whether a response was written. Other errors fail open.
+func writeBandwidthError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrKeyTooLong):
+		writeError(w, "Rate limit key too long", http.StatusRequestHeaderFieldsTooLarge)
+	case errors.Is(err, store.ErrStoreFull):
+		writeError(w, "Rate limit store full", http.StatusServiceUnavailable)
+	case errors.Is(err, ratelimiter.ErrCostExceedsCapacity):
+		writeError(w, "Request cost exceeds rate limit capacity", http.StatusRequestEntityTooLarge)
+	default:
+		return false
+	}
+	return true
+}
+
+// chargeBytes charges n bytes to key. Store errors fail open, except
+// capacity errors which are reported as ErrBandwidthExceeded.
+func chargeBytes(l ratelimiter.Limiter, key string, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	allowed, err := l.AllowN(key, n)
+	if err != nil {
+		if errors.Is(err, store.ErrStoreFull) || errors.Is(err, store.ErrKeyTooLong) ||
+			errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+			return ErrBandwidthExceeded
+		}
+		return nil
+	}
+	if !allowed {
+		return ErrBandwidthExceeded
+	}
+	return nil
+}
+
+// bandwidthReader charges request body bytes as they are read.
+type bandwidthReader struct {
+	io.ReadCloser
+	limiter ratelimiter.Limiter
+	key     string
+	chunk   int
+}
+
+// Read reads at most one chunk and charges the bytes read.
+func (b *bandwidthReader) Read(p []byte) (int, error) {
+	if len(p) > b.chunk {
+		p = p[:b.chunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if cerr := chargeBytes(b.limiter, b.key, n); cerr != nil {
+		return 0, cerr
+	}
+	return n, err
+}
+
+// bandwidthWriter charges response body bytes before writing them.
+type bandwidthWriter struct {
+	http.ResponseWriter
+	limiter   ratelimiter.Limiter
+	key       string
+	chunk     int
+	onLimited func()
+	written   bool
+	limited   bool
+}
+
+// WriteHeader sends the response status.
+func (b *bandwidthWriter) WriteHeader(code int) {
+	if b.limited {
+		return
+	}
+	b.written = true
+	b.ResponseWriter.WriteHeader(code)
+}
+
+// Write charges and writes p in chunks.
+func (b *bandwidthWriter) Write(p []byte) (int, error) {
+	if b.limited {
+		return 0, ErrBandwidthExceeded
+	}
+
+	total := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > b.chunk {
+			n = b.chunk
+		}
+		if err := chargeBytes(b.limiter, b.key, n); err != nil {
+			b.limited = true
+			if !b.written {
+				// Nothing sent yet: answer with a proper rate limit response
+				b.written = true
+				b.onLimited()
+			}
+			return total, err
+		}
+
+		b.written = true
+		w, err := b.ResponseWriter.Write(p[:n])
+		total += w
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Flush sends buffered data to the client.
+func (b *bandwidthWriter) Flush() {
+	flushWriter(b.ResponseWriter)
+}
+
+// Hijack takes over the connection. Bytes sent on a hijacked connection
+// are not charged.
+func (b *bandwidthWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijackWriter(b.ResponseWriter)
+}
+
+// Push initiates an HTTP/2 server push. Pushed responses are not charged.
+func (b *bandwidthWriter) Push(target string, opts *http.PushOptions) error {
+	return pushWriter(b.ResponseWriter, target, opts)
+}
+
+// ReadFrom charges and writes the body from src through Write, so the
+// underlying ReaderFrom is deliberately not used.
+func (b *bandwidthWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(writerOnly{b}, src)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (b *bandwidthWriter) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
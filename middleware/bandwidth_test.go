@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func newBandwidthLimiter(t *testing.T, bytes int) ratelimiter.Limiter {
+	t.Helper()
+	s := store.NewMemoryStore()
+	t.Cleanup(func() { s.Close() })
+	l, err := algorithms.NewTokenBucket(ratelimiter.Config{Rate: bytes, Window: time.Hour}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestBandwidthMiddleware_UploadContentLength(t *testing.T) {
+	limiter := newBandwidthLimiter(t, 100)
+	handler := BandwidthMiddleware(limiter, BandwidthUpload)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+
+	send := func(size int) int {
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", size)))
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send(60); code != http.StatusOK {
+		t.Errorf("Expected first upload to pass, got %d", code)
+	}
+	if code := send(60); code != http.StatusTooManyRequests {
+		t.Errorf("Expected upload over quota to be limited, got %d", code)
+	}
+	if code := send(101); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected upload larger than the quota to get 413, got %d", code)
+	}
+}
+
+func TestBandwidthMiddleware_UploadStreaming(t *testing.T) {
+	limiter := newBandwidthLimiter(t, 100)
+
+	var readErr error
+	var read int64
+	handler := BandwidthMiddleware(limiter, BandwidthUpload)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		read, readErr = io.Copy(io.Discard, r.Body)
+	}))
+
+	// Unknown length: charged while reading
+	req := httptest.NewRequest(http.MethodPost, "/upload", io.MultiReader(strings.NewReader(strings.Repeat("x", 500))))
+	req.ContentLength = -1
+	req.RemoteAddr = "1.2.3.4:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !errors.Is(readErr, ErrBandwidthExceeded) {
+		t.Errorf("Expected ErrBandwidthExceeded, got %v", readErr)
+	}
+	if read > 100 {
+		t.Errorf("Expected at most 100 bytes delivered, got %d", read)
+	}
+}
+
+func TestBandwidthMiddleware_Download(t *testing.T) {
+	limiter := newBandwidthLimiter(t, 100)
+
+	var writeErr error
+	handler := BandwidthMiddleware(limiter, BandwidthDownload)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, writeErr = w.Write(bytes.Repeat([]byte("x"), 80))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if writeErr != nil || rec.Body.Len() != 80 {
+		t.Fatalf("Expected first download to be written, got %d bytes, %v", rec.Body.Len(), writeErr)
+	}
+
+	// Quota exhausted before anything was sent: rate limit response
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !errors.Is(writeErr, ErrBandwidthExceeded) {
+		t.Errorf("Expected ErrBandwidthExceeded, got %v", writeErr)
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429, got %d", rec.Code)
+	}
+}
+
+func TestBandwidthMiddleware_DownloadChunks(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1 << 20, Window: time.Hour, BurstSize: 1000}, s)
+
+	var n int
+	var writeErr error
+	handler := BandwidthMiddleware(limiter, BandwidthDownload)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		n, writeErr = w.Write(bytes.Repeat([]byte("x"), 2500))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	// Writes are split in chunks of at most the burst size
+	if !errors.Is(writeErr, ErrBandwidthExceeded) || n != 1000 {
+		t.Errorf("Expected 1000 bytes then ErrBandwidthExceeded, got %d, %v", n, writeErr)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status already sent to be kept, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,305 @@
+package middleware
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/maphash"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// BruteForceOptions configures BruteForceProtection.
+type BruteForceOptions struct {
+	// UsernameFunc extracts the account name targeted by a login request,
+	// e.g. func(r *http.Request) string { return r.PostFormValue("username") }.
+	// Default: nil (attempts are tracked per client IP only).
+	UsernameFunc func(r *http.Request) string
+
+	// KeyFunc extracts the client identifier.
+	// Default: DefaultKeyFunc.
+	KeyFunc KeyFunc
+
+	// MaxAttempts is the number of failed attempts allowed before a lockout.
+	// Default: 5.
+	MaxAttempts int
+
+	// Window is how long failed attempts are remembered. The lockout level
+	// is also forgotten after a quiet Window following a lockout.
+	// Default: 15 minutes.
+	Window time.Duration
+
+	// Lockout is the duration of the first lockout. Each further lockout of
+	// the same pair doubles it, up to MaxLockout.
+	// Default: 1 minute.
+	Lockout time.Duration
+
+	// MaxLockout caps the lockout duration.
+	// Default: 1 hour.
+	MaxLockout time.Duration
+
+	// IsFailure reports whether a response status is a failed attempt.
+	// Successful responses (below 400) reset the pair.
+	// Default: 401 and 403.
+	IsFailure func(status int) bool
+
+	// OnLocked is called for requests of a locked-out pair. Retry-After is
+	// set before it is called.
+	// Default: DefaultOnLimited.
+	OnLocked OnLimitedFunc
+
+	// MaxKeySize is the maximum length of the (IP, username) key.
+	// Longer keys are rejected with 431 Request Header Fields Too Large.
+	// Default: 4096.
+	MaxKeySize int
+}
+
+// bruteForceState is the state stored per (IP, username) pair.
+type bruteForceState struct {
+	Failures    int       // Failed (or in-flight) attempts in the current window
+	Lockouts    int       // Lockouts so far, for exponential backoff
+	LockedUntil time.Time // Zero when not locked
+}
+
+// MarshalBinary encodes the state for remote stores.
+func (s *bruteForceState) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 2+3*8)
+	b[0] = 'B'
+	b[1] = 1
+	binary.BigEndian.PutUint64(b[2:], uint64(s.Failures))
+	binary.BigEndian.PutUint64(b[10:], uint64(s.Lockouts))
+	var until int64
+	if !s.LockedUntil.IsZero() {
+		until = s.LockedUntil.UnixNano()
+	}
+	binary.BigEndian.PutUint64(b[18:], uint64(until))
+	return b, nil
+}
+
+// bruteForceStateJSON is the JSON representation of bruteForceState.
+type bruteForceStateJSON struct {
+	Version     int    `json:"v"`
+	Type        string `json:"type"`
+	Failures    int    `json:"failures"`
+	Lockouts    int    `json:"lockouts"`
+	LockedUntil int64  `json:"locked_until,omitempty"`
+}
+
+// MarshalJSON encodes the state for remote stores.
+func (s *bruteForceState) MarshalJSON() ([]byte, error) {
+	v := bruteForceStateJSON{Version: 1, Type: "brute_force", Failures: s.Failures, Lockouts: s.Lockouts}
+	if !s.LockedUntil.IsZero() {
+		v.LockedUntil = s.LockedUntil.UnixNano()
+	}
+	return json.Marshal(v)
+}
+
+// decodeBruteForceState decodes a state returned by a remote store as bytes.
+func decodeBruteForceState(b []byte) (*bruteForceState, bool) {
+	s := &bruteForceState{}
+	if len(b) == 2+3*8 && b[0] == 'B' && b[1] == 1 {
+		s.Failures = int(binary.BigEndian.Uint64(b[2:]))
+		s.Lockouts = int(binary.BigEndian.Uint64(b[10:]))
+		if until := int64(binary.BigEndian.Uint64(b[18:])); until != 0 {
+			s.LockedUntil = time.Unix(0, until)
+		}
+		return s, true
+	}
+
+	var v bruteForceStateJSON
+	if err := json.Unmarshal(b, &v); err != nil || v.Type != "brute_force" {
+		return nil, false
+	}
+	s.Failures, s.Lockouts = v.Failures, v.Lockouts
+	if v.LockedUntil != 0 {
+		s.LockedUntil = time.Unix(0, v.LockedUntil)
+	}
+	return s, true
+}
+
+// bruteForce implements BruteForceProtection.
+type bruteForce struct {
+	store   store.Store
+	options BruteForceOptions
+	mu      [256]sync.Mutex // Serializes updates of the same pair in this process
+	seed    maphash.Seed
+}
+
+// BruteForceProtection returns a middleware for login endpoints that tracks
+// failed authentications per (IP, username) pair in s and locks the pair
+// out after MaxAttempts failures, for a duration that doubles with each
+// lockout.
+//
+// Attempts are counted before the handler runs and only forgiven once the
+// response is known, so concurrent guesses cannot exceed MaxAttempts.
+// Tracking the pair rather than the IP alone avoids locking out every user
+// behind a shared NAT; combine it with a per-IP RateLimitMiddleware to also
+// slow down password spraying across many usernames.
+//
+// Remote stores should use the binary or JSON codec.
+func BruteForceProtection(s store.Store, opts BruteForceOptions) (func(http.Handler) http.Handler, error) {
+	if s == nil {
+		return nil, errors.New("middleware: brute force protection requires a store")
+	}
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = DefaultKeyFunc
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Window <= 0 {
+		opts.Window = 15 * time.Minute
+	}
+	if opts.Lockout <= 0 {
+		opts.Lockout = time.Minute
+	}
+	if opts.MaxLockout <= 0 {
+		opts.MaxLockout = time.Hour
+	}
+	if opts.MaxLockout < opts.Lockout {
+		opts.MaxLockout = opts.Lockout
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = func(status int) bool {
+			return status == http.StatusUnauthorized || status == http.StatusForbidden
+		}
+	}
+	if opts.OnLocked == nil {
+		opts.OnLocked = DefaultOnLimited
+	}
+	if opts.MaxKeySize <= 0 {
+		opts.MaxKeySize = 4096
+	}
+
+	bf := &bruteForce{store: s, options: opts, seed: maphash.MakeSeed()}
+	return bf.middleware, nil
+}
+
+// middleware wraps next with brute-force protection.
+func (bf *bruteForce) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := bf.options.KeyFunc(r)
+		if bf.options.UsernameFunc != nil {
+			// NUL cannot appear in an IP, so pairs cannot collide
+			key += "\x00" + bf.options.UsernameFunc(r)
+		}
+		if len(key) > bf.options.MaxKeySize {
+			writeError(w, "Rate limit key too long", http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+		key = "bf:" + key
+
+		if wait := bf.begin(key, time.Now()); wait > 0 {
+			setRetryAfter(w, wait)
+			bf.options.OnLocked(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		bf.end(key, status, time.Now())
+	})
+}
+
+// begin counts a new attempt for key. It returns how long the caller must
+// wait if the pair is locked out or already has MaxAttempts attempts.
+func (bf *bruteForce) begin(key string, now time.Time) time.Duration {
+	mu := bf.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	state := bf.load(key)
+	if now.Before(state.LockedUntil) {
+		return state.LockedUntil.Sub(now)
+	}
+	if state.Failures >= bf.options.MaxAttempts {
+		// Attempts in flight: wait for their outcome
+		return time.Second
+	}
+
+	state.Failures++
+	bf.save(key, state, now)
+	return 0
+}
+
+// end records the outcome of an attempt started by begin.
+func (bf *bruteForce) end(key string, status int, now time.Time) {
+	mu := bf.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if status < 400 {
+		_ = bf.store.Delete(key)
+		return
+	}
+
+	state := bf.load(key)
+	if !bf.options.IsFailure(status) {
+		// Neither success nor failure (e.g. 400 or 5xx): forgive the attempt
+		if state.Failures > 0 {
+			state.Failures--
+		}
+		bf.save(key, state, now)
+		return
+	}
+
+	if state.Failures >= bf.options.MaxAttempts {
+		state.Lockouts++
+		state.Failures = 0
+		state.LockedUntil = now.Add(bf.lockout(state.Lockouts))
+	}
+	bf.save(key, state, now)
+}
+
+// lockout returns the duration of the n-th lockout.
+func (bf *bruteForce) lockout(n int) time.Duration {
+	d := bf.options.Lockout
+	for i := 1; i < n && d < bf.options.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > bf.options.MaxLockout {
+		d = bf.options.MaxLockout
+	}
+	return d
+}
+
+// load returns the state of key, or a fresh state.
+func (bf *bruteForce) load(key string) *bruteForceState {
+	val, ok := bf.store.Get(key)
+	if !ok {
+		return &bruteForceState{}
+	}
+	switch v := val.(type) {
+	case *bruteForceState:
+		// Copy: the store may hand out the stored pointer
+		state := *v
+		return &state
+	case []byte:
+		if state, ok := decodeBruteForceState(v); ok {
+			return state
+		}
+	}
+	return &bruteForceState{}
+}
+
+// save stores the state of key until a quiet Window after any lockout.
+func (bf *bruteForce) save(key string, state *bruteForceState, now time.Time) {
+	ttl := bf.options.Window
+	if state.LockedUntil.After(now) {
+		ttl += state.LockedUntil.Sub(now)
+	}
+	_ = bf.store.Set(key, state, ttl)
+}
+
+// lock returns the mutex for key.
+func (bf *bruteForce) lock(key string) *sync.Mutex {
+	return &bf.mu[maphash.String(bf.seed, key)%uint64(len(bf.mu))]
+}
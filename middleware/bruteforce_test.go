@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"hash/maphash"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func newBruteForceHandler(t *testing.T, s store.Store, opts BruteForceOptions, status *int) http.Handler {
+	t.Helper()
+	if opts.UsernameFunc == nil {
+		opts.UsernameFunc = func(r *http.Request) string { return r.URL.Query().Get("user") }
+	}
+	mw, err := BruteForceProtection(s, opts)
+	if err != nil {
+		t.Fatalf("BruteForceProtection failed: %v", err)
+	}
+	return mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(*status)
+	}))
+}
+
+func sendLogin(h http.Handler, ip, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login?user="+user, nil)
+	req.RemoteAddr = ip + ":1234"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBruteForceProtection_RequiresStore(t *testing.T) {
+	if _, err := BruteForceProtection(nil, BruteForceOptions{}); err == nil {
+		t.Error("Expected error for nil store")
+	}
+}
+
+func TestBruteForceProtection_LocksOutPair(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	status := http.StatusUnauthorized
+	h := newBruteForceHandler(t, s, BruteForceOptions{MaxAttempts: 3, Lockout: time.Minute}, &status)
+
+	for i := 0; i < 3; i++ {
+		if rec := sendLogin(h, "1.2.3.4", "alice"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected 401, got %d", i+1, rec.Code)
+		}
+	}
+
+	rec := sendLogin(h, "1.2.3.4", "alice")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 after lockout, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Expected Retry-After 60, got %q", got)
+	}
+
+	// Correct password is refused too while locked
+	status = http.StatusOK
+	if rec := sendLogin(h, "1.2.3.4", "alice"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 while locked, got %d", rec.Code)
+	}
+
+	// Other pairs are unaffected
+	if rec := sendLogin(h, "1.2.3.4", "bob"); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for another username, got %d", rec.Code)
+	}
+	if rec := sendLogin(h, "5.6.7.8", "alice"); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for another IP, got %d", rec.Code)
+	}
+}
+
+func TestBruteForceProtection_SuccessResets(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	status := http.StatusUnauthorized
+	h := newBruteForceHandler(t, s, BruteForceOptions{MaxAttempts: 3}, &status)
+
+	sendLogin(h, "1.2.3.4", "alice")
+	sendLogin(h, "1.2.3.4", "alice")
+
+	status = http.StatusOK
+	sendLogin(h, "1.2.3.4", "alice")
+
+	status = http.StatusUnauthorized
+	for i := 0; i < 3; i++ {
+		if rec := sendLogin(h, "1.2.3.4", "alice"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d after success: expected 401, got %d", i+1, rec.Code)
+		}
+	}
+}
+
+func TestBruteForceProtection_OtherStatusesForgiven(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	status := http.StatusBadRequest
+	h := newBruteForceHandler(t, s, BruteForceOptions{MaxAttempts: 2}, &status)
+
+	for i := 0; i < 5; i++ {
+		if rec := sendLogin(h, "1.2.3.4", "alice"); rec.Code != http.StatusBadRequest {
+			t.Fatalf("Attempt %d: expected 400, got %d", i+1, rec.Code)
+		}
+	}
+}
+
+func TestBruteForceProtection_ExponentialLockout(t *testing.T) {
+	bf := &bruteForce{}
+	bf.options.Lockout = time.Minute
+	bf.options.MaxLockout = 3 * time.Minute
+
+	want := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}
+	for i, w := range want {
+		if got := bf.lockout(i + 1); got != w {
+			t.Errorf("lockout(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestBruteForceProtection_LockoutEscalates(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	bf := &bruteForce{store: s, seed: maphash.MakeSeed()}
+	bf.options.MaxAttempts = 1
+	bf.options.Window = time.Hour
+	bf.options.Lockout = time.Minute
+	bf.options.MaxLockout = time.Hour
+	bf.options.IsFailure = func(status int) bool { return status == http.StatusUnauthorized }
+
+	now := time.Now()
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		if wait := bf.begin("k", now); wait != 0 {
+			t.Fatalf("Round %d: unexpected wait %v", i+1, wait)
+		}
+		bf.end("k", http.StatusUnauthorized, now)
+		if wait := bf.begin("k", now); wait != want {
+			t.Fatalf("Round %d: expected lockout %v, got %v", i+1, want, wait)
+		}
+		now = now.Add(want)
+	}
+}
+
+func TestBruteForceProtection_ConcurrentAttempts(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	served := 0
+	mw, _ := BruteForceProtection(s, BruteForceOptions{MaxAttempts: 3})
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		served++
+		mu.Unlock()
+		<-release
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- sendLogin(h, "1.2.3.4", "alice").Code
+		}()
+	}
+
+	// Rejected requests return immediately; wait for them
+	waitUntil(t, func() bool { return len(codes) == 17 })
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	if served != 3 {
+		t.Errorf("Expected 3 guesses to reach the handler, got %d", served)
+	}
+}
+
+func TestBruteForceProtection_KeyTooLong(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	status := http.StatusOK
+	h := newBruteForceHandler(t, s, BruteForceOptions{MaxKeySize: 16}, &status)
+	if rec := sendLogin(h, "1.2.3.4", "a-very-long-username"); rec.Code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected 431, got %d", rec.Code)
+	}
+}
+
+func TestBruteForceState_Encoding(t *testing.T) {
+	state := &bruteForceState{Failures: 2, Lockouts: 3, LockedUntil: time.Unix(0, 1700000000000000000)}
+
+	bin, _ := state.MarshalBinary()
+	js, _ := state.MarshalJSON()
+	for name, b := range map[string][]byte{"binary": bin, "json": js} {
+		got, ok := decodeBruteForceState(b)
+		if !ok {
+			t.Fatalf("%s: decode failed", name)
+		}
+		if got.Failures != 2 || got.Lockouts != 3 || !got.LockedUntil.Equal(state.LockedUntil) {
+			t.Errorf("%s: got %+v", name, got)
+		}
+	}
+
+	if _, ok := decodeBruteForceState([]byte(`{"v":1,"type":"token_bucket"}`)); ok {
+		t.Error("Expected other state types to be rejected")
+	}
+}
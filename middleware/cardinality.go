@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// scopeOverflow replaces the scope of a client's keys past MaxKeysPerClient,
+// so they share a single limit.
+const scopeOverflow = "~"
+
+// defaultMaxTrackedClients bounds the clients tracked by a scopeLimit in a
+// window. Past it, untracked clients only get the overflow scope.
+const defaultMaxTrackedClients = 100000
+
+// scopeLimit bounds the distinct scopes (host and KeyQuery values) each
+// client of an endpoint can use. Scopes are tracked by hash, so collisions
+// may let a client use slightly fewer scopes than the limit. Budgets are
+// renewed every window, typically the window of the endpoint's limit, after
+// which the state of unused keys expires from the store.
+type scopeLimit struct {
+	max        int
+	maxClients int
+	window     time.Duration
+	seed       maphash.Seed
+	now        func() time.Time
+
+	mu      sync.Mutex
+	renewed time.Time
+	scopes  map[string]map[uint64]struct{} // Scope hashes by client in this window
+}
+
+// newScopeLimit returns nil if max is not positive.
+func newScopeLimit(max int, window time.Duration) *scopeLimit {
+	if max <= 0 {
+		return nil
+	}
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &scopeLimit{
+		max:        max,
+		maxClients: defaultMaxTrackedClients,
+		window:     window,
+		seed:       maphash.MakeSeed(),
+		now:        time.Now,
+		scopes:     make(map[string]map[uint64]struct{}),
+	}
+}
+
+// admit reports whether scope is one of the first max distinct scopes of
+// client in the current window.
+func (l *scopeLimit) admit(client, scope string) bool {
+	h := maphash.String(l.seed, scope)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now := l.now(); now.Sub(l.renewed) >= l.window {
+		clear(l.scopes)
+		l.renewed = now
+	}
+
+	scopes, ok := l.scopes[client]
+	if !ok {
+		if len(l.scopes) >= l.maxClients {
+			return false
+		}
+		scopes = make(map[uint64]struct{})
+		l.scopes[client] = scopes
+	}
+	if _, ok := scopes[h]; ok {
+		return true
+	}
+	if len(scopes) >= l.max {
+		return false
+	}
+	scopes[h] = struct{}{}
+	return true
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRouter_MaxKeysPerClient(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	var keys []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := KeyFromContext(r.Context())
+		keys = append(keys, key)
+	})
+	router, err := NewRouter(handler, s, []EndpointConfig{{
+		Path:             "/api/*",
+		Host:             "*.example.com",
+		MaxKeysPerClient: 2,
+		Config:           ratelimiter.Config{Rate: 1, Window: time.Minute},
+	}})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	serve := func(host, remoteAddr string) int {
+		req := httptest.NewRequest("GET", "http://"+host+"/api/x", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if serve("a.example.com", "192.168.1.1:1") != http.StatusOK || serve("b.example.com", "192.168.1.1:1") != http.StatusOK {
+		t.Fatal("Expected the first request of each host to be allowed")
+	}
+	if keys[0] != "192.168.1.1:a.example.com/api/*" {
+		t.Errorf("Unexpected key %q", keys[0])
+	}
+
+	// Past MaxKeysPerClient, the client's new hosts share a single limit
+	if code := serve("c.example.com", "192.168.1.1:1"); code != http.StatusOK {
+		t.Fatalf("Expected the first overflow host to be allowed, got %d", code)
+	}
+	if keys[2] != "192.168.1.1:"+scopeOverflow+"/api/*" {
+		t.Errorf("Unexpected overflow key %q", keys[2])
+	}
+	if code := serve("d.example.com", "192.168.1.1:1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected overflow hosts to share a limit, got %d", code)
+	}
+
+	// Other clients have their own budget
+	if code := serve("e.example.com", "192.168.1.2:1"); code != http.StatusOK {
+		t.Errorf("Expected another client's new host to be allowed, got %d", code)
+	}
+	if keys[len(keys)-1] != "192.168.1.2:e.example.com/api/*" {
+		t.Errorf("Unexpected key %q", keys[len(keys)-1])
+	}
+}
+
+func TestRouter_WildcardKeyedByPattern(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{{
+		Path:   "/files/*",
+		Config: ratelimiter.Config{Rate: 3, Window: time.Minute},
+	}})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	// Random paths under a wildcard share the endpoint's limit
+	limited := 0
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d", i), nil)
+		req.RemoteAddr = "192.168.1.1:1"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited != 7 {
+		t.Errorf("Expected 7 limited requests, got %d", limited)
+	}
+}
+
+func TestScopeLimit_Renewal(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newScopeLimit(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		l.admit("client", fmt.Sprintf("scope%d", i))
+	}
+	if n := len(l.scopes["client"]); n != 2 {
+		t.Errorf("Expected 2 tracked scopes, got %d", n)
+	}
+	if !l.admit("client", "scope1") {
+		t.Error("Expected a tracked scope to be admitted")
+	}
+	if l.admit("client", "scope50") {
+		t.Error("Expected a new scope past the limit to be refused")
+	}
+
+	now = now.Add(time.Minute)
+	if !l.admit("client", "scope50") {
+		t.Error("Expected the budget to be renewed after the window")
+	}
+}
+
+func TestScopeLimit_MaxClients(t *testing.T) {
+	l := newScopeLimit(1, time.Minute)
+	l.maxClients = 2
+
+	if !l.admit("a", "x") || !l.admit("b", "x") {
+		t.Fatal("Expected tracked clients to be admitted")
+	}
+	if l.admit("c", "x") {
+		t.Error("Expected untracked clients to be refused past maxClients")
+	}
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// ErrClientLimited is returned by ClientThrottle when an outbound call is not
+// allowed within its maximum wait.
+var ErrClientLimited = errors.New("middleware: outbound rate limit exceeded")
+
+// clientPollInterval is the wait between checks of limiters that do not
+// report a retry delay.
+const clientPollInterval = 10 * time.Millisecond
+
+// ClientConfig configures a ClientThrottle.
+type ClientConfig struct {
+	// Key returns the rate limit key of a call to method on target, e.g.
+	// PerTarget to share one limit between all the methods of a dependency.
+	// Default: PerMethod.
+	Key func(target, method string) string
+
+	// MaxWait is the maximum time a call waits for the limit to allow it.
+	// Calls that cannot be allowed in time fail at once with
+	// ErrClientLimited rather than waiting in vain. Calls never wait past
+	// their context deadline.
+	// Default: 0 (calls over the limit fail without waiting).
+	MaxWait time.Duration
+}
+
+// PerMethod keys outbound calls by target and method.
+func PerMethod(target, method string) string {
+	return target + method
+}
+
+// PerTarget keys outbound calls by target only.
+func PerTarget(target, method string) string {
+	return target
+}
+
+// ClientThrottle limits outbound calls, so that a service throttles itself
+// against the dependencies it calls instead of relying on their limits. It
+// is typically built from the same configuration as the server-side limits
+// of the dependency.
+//
+// RPC clients over net/http (e.g. connect-go) use RoundTripper, grpc-go
+// clients the interceptors of UnaryWait and StreamWait:
+//
+//	throttle := middleware.NewClientThrottle(limiter, middleware.ClientConfig{MaxWait: time.Second})
+//	conn, err := grpc.NewClient(target,
+//		grpc.WithUnaryInterceptor(middleware.UnaryWait[grpc.UnaryInvoker](throttle)),
+//		grpc.WithStreamInterceptor(middleware.StreamWait[grpc.Streamer](throttle)))
+//
+// Other clients call Wait before each call.
+//
+// Store errors fail open, like RateLimitMiddleware.
+type ClientThrottle struct {
+	limiter ratelimiter.LimiterWithDetails
+	config  ClientConfig
+}
+
+// NewClientThrottle creates a throttle for outbound calls.
+func NewClientThrottle(limiter ratelimiter.Limiter, config ClientConfig) *ClientThrottle {
+	if config.Key == nil {
+		config.Key = PerMethod
+	}
+	return &ClientThrottle{
+		limiter: ratelimiter.WithDetails(limiter),
+		config:  config,
+	}
+}
+
+// Wait blocks until a call to method on target is allowed. It returns
+// ErrClientLimited if the call cannot be allowed within MaxWait or before the
+// context deadline, and the context error if ctx is done while waiting.
+func (c *ClientThrottle) Wait(ctx context.Context, target, method string) error {
+	key := c.config.Key(target, method)
+	deadline := time.Now().Add(c.config.MaxWait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	for {
+		result, err := c.limiter.AllowNWithDetails(key, 1)
+		if err != nil {
+			if errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+				return ErrClientLimited
+			}
+			return nil
+		}
+		if result.Allowed {
+			return nil
+		}
+
+		wait := result.RetryAfter
+		if wait <= 0 {
+			wait = clientPollInterval
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return ErrClientLimited
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// RoundTripper returns a transport that waits for the limit before sending
+// each request through next (http.DefaultTransport if nil). Requests are
+// keyed by URL host and path, which for RPCs is /pkg.Service/Method.
+func (c *ClientThrottle) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := c.Wait(req.Context(), req.URL.Host, req.URL.Path); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+// ClientConn is the connection of an RPC client, e.g. *grpc.ClientConn.
+type ClientConn interface {
+	Target() string
+}
+
+// UnaryWait returns a unary client interceptor that waits for the limit
+// before each call, keyed by the target of the connection and the method.
+// It has the signature of grpc.UnaryClientInterceptor when Invoker is
+// grpc.UnaryInvoker, without this module importing grpc:
+//
+//	grpc.WithUnaryInterceptor(middleware.UnaryWait[grpc.UnaryInvoker](throttle))
+//
+// Calls over the limit fail with the error of Wait, which grpc reports with
+// code Unknown; wrap the interceptor to return another status.
+func UnaryWait[Invoker ~func(ctx context.Context, method string, req, reply any, cc Conn, opts ...Opt) error, Conn ClientConn, Opt any](c *ClientThrottle) func(ctx context.Context, method string, req, reply any, cc Conn, invoker Invoker, opts ...Opt) error {
+	return func(ctx context.Context, method string, req, reply any, cc Conn, invoker Invoker, opts ...Opt) error {
+		if err := c.Wait(ctx, cc.Target(), method); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamWait returns a stream client interceptor that waits for the limit
+// before opening each stream, like UnaryWait. It has the signature of
+// grpc.StreamClientInterceptor when Streamer is grpc.Streamer:
+//
+//	grpc.WithStreamInterceptor(middleware.StreamWait[grpc.Streamer](throttle))
+func StreamWait[Streamer ~func(ctx context.Context, desc Desc, cc Conn, method string, opts ...Opt) (Stream, error), Desc any, Conn ClientConn, Opt any, Stream any](c *ClientThrottle) func(ctx context.Context, desc Desc, cc Conn, method string, streamer Streamer, opts ...Opt) (Stream, error) {
+	return func(ctx context.Context, desc Desc, cc Conn, method string, streamer Streamer, opts ...Opt) (Stream, error) {
+		if err := c.Wait(ctx, cc.Target(), method); err != nil {
+			var stream Stream
+			return stream, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestClientThrottle_Wait(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	// One call every 50ms
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 20, Window: time.Second, BurstSize: 1}, s)
+	throttle := NewClientThrottle(limiter, ClientConfig{MaxWait: time.Second})
+
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := throttle.Wait(ctx, "users:443", "/users.v1.UserService/GetUser"); err != nil {
+			t.Fatalf("Wait %d: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected calls to be spaced by the limit, took %v", elapsed)
+	}
+
+	// Other methods have their own limit by default
+	if err := NewClientThrottle(limiter, ClientConfig{}).Wait(ctx, "users:443", "/users.v1.UserService/ListUsers"); err != nil {
+		t.Errorf("Expected another method to be allowed, got %v", err)
+	}
+}
+
+func TestClientThrottle_MaxWait(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s)
+	throttle := NewClientThrottle(limiter, ClientConfig{Key: PerTarget, MaxWait: time.Second})
+
+	ctx := context.Background()
+	if err := throttle.Wait(ctx, "users:443", "/a"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := throttle.Wait(ctx, "users:443", "/b"); !errors.Is(err, ErrClientLimited) {
+		t.Errorf("err = %v, want ErrClientLimited", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("Expected a call that cannot be allowed in time to fail without waiting")
+	}
+}
+
+func TestClientThrottle_RoundTripper(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := &http.Client{Transport: NewClientThrottle(limiter, ClientConfig{}).RoundTripper(nil)}
+
+	resp, err := client.Post(server.URL+"/users.v1.UserService/GetUser", "application/grpc", nil)
+	if err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := client.Post(server.URL+"/users.v1.UserService/GetUser", "application/grpc", nil); !errors.Is(err, ErrClientLimited) {
+		t.Errorf("err = %v, want ErrClientLimited", err)
+	}
+}
+
+// Types with the shapes of the grpc-go client types.
+type (
+	fakeConn       struct{ target string }
+	fakeCallOption struct{}
+	fakeStreamDesc struct{}
+	fakeStream     interface{ Context() context.Context }
+
+	unaryInvoker            func(ctx context.Context, method string, req, reply any, cc *fakeConn, opts ...fakeCallOption) error
+	unaryClientInterceptor  func(ctx context.Context, method string, req, reply any, cc *fakeConn, invoker unaryInvoker, opts ...fakeCallOption) error
+	streamer                func(ctx context.Context, desc *fakeStreamDesc, cc *fakeConn, method string, opts ...fakeCallOption) (fakeStream, error)
+	streamClientInterceptor func(ctx context.Context, desc *fakeStreamDesc, cc *fakeConn, method string, streamer streamer, opts ...fakeCallOption) (fakeStream, error)
+)
+
+func (c *fakeConn) Target() string { return c.target }
+
+func TestClientThrottle_Interceptors(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s)
+	throttle := NewClientThrottle(limiter, ClientConfig{})
+
+	var unary unaryClientInterceptor = UnaryWait[unaryInvoker](throttle)
+	var stream streamClientInterceptor = StreamWait[streamer](throttle)
+
+	ctx := context.Background()
+	conn := &fakeConn{target: "users:443"}
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply any, cc *fakeConn, opts ...fakeCallOption) error {
+		calls++
+		return nil
+	}
+	for i, want := range []error{nil, ErrClientLimited} {
+		if err := unary(ctx, "/users.v1.UserService/GetUser", nil, nil, conn, invoker); !errors.Is(err, want) {
+			t.Errorf("call %d: err = %v, want %v", i+1, err, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected calls over the limit not to be invoked, got %d calls", calls)
+	}
+
+	open := func(ctx context.Context, desc *fakeStreamDesc, cc *fakeConn, method string, opts ...fakeCallOption) (fakeStream, error) {
+		calls++
+		return nil, nil
+	}
+	for i, want := range []error{nil, ErrClientLimited} {
+		if _, err := stream(ctx, &fakeStreamDesc{}, conn, "/users.v1.UserService/Watch", open); !errors.Is(err, want) {
+			t.Errorf("stream %d: err = %v, want %v", i+1, err, want)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected streams over the limit not to be opened, got %d calls", calls)
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// ErrConflictingLimits is returned by NewRouter when an endpoint sets Limits
+// together with Config or Profiles.
+var ErrConflictingLimits = errors.New("middleware: endpoint sets Limits with Config or Profiles")
+
+// Limit is one of the limits of an endpoint with composite limits, see
+// EndpointConfig.Limits.
+type Limit struct {
+	// Config is the rate limit configuration.
+	Config ratelimiter.Config
+
+	// Algorithm is the rate limiting algorithm to use.
+	// Default: AlgorithmTokenBucket
+	Algorithm Algorithm
+}
+
+// compositeLimiter allows a request only if all of its limiters allow it.
+//
+// The limiters are checked in order. When one denies the request, the
+// requests counted by the previous ones are refunded, so a burst rejected by
+// a per-second limit does not eat into a per-minute limit. The checks are not
+// atomic: concurrent requests for a key may be refunded after having been
+// counted by another request's check.
+type compositeLimiter struct {
+	limiters []ratelimiter.LimiterWithDetails
+	suffixes []string // Appended to the key for each limiter, so that they keep separate state
+}
+
+// newCompositeLimiter combines limiters sharing a store. The first limiter
+// uses the key unchanged, so turning a single limit into a composite one
+// keeps its state.
+func newCompositeLimiter(limiters []ratelimiter.Limiter) *compositeLimiter {
+	c := &compositeLimiter{
+		limiters: make([]ratelimiter.LimiterWithDetails, len(limiters)),
+		suffixes: make([]string, len(limiters)),
+	}
+	for i, l := range limiters {
+		c.limiters[i] = ratelimiter.WithDetails(l)
+		if i > 0 {
+			c.suffixes[i] = "#" + strconv.Itoa(i)
+		}
+	}
+	return c
+}
+
+// Allow checks if a single request is allowed by all limits.
+func (c *compositeLimiter) Allow(key string) (bool, error) {
+	return c.AllowN(key, 1)
+}
+
+// AllowN checks if n requests are allowed by all limits.
+func (c *compositeLimiter) AllowN(key string, n int) (bool, error) {
+	result, err := c.AllowNWithDetails(key, n)
+	return result.Allowed, err
+}
+
+// AllowNWithDetails checks if n requests are allowed by all limits. A
+// denial reports the result of the limit that denied the request; otherwise
+// the result of the limit with the fewest remaining requests is returned.
+func (c *compositeLimiter) AllowNWithDetails(key string, n int) (ratelimiter.Result, error) {
+	var tightest ratelimiter.Result
+	for i, l := range c.limiters {
+		result, err := l.AllowNWithDetails(key+c.suffixes[i], n)
+		if err != nil || !result.Allowed {
+			c.refund(key, n, i)
+			return result, err
+		}
+		if i == 0 || result.Remaining < tightest.Remaining {
+			tightest = result
+		}
+	}
+	return tightest, nil
+}
+
+// Reset clears the state of every limit for key.
+func (c *compositeLimiter) Reset(key string) error {
+	var errs []error
+	for i, l := range c.limiters {
+		if err := l.Reset(key + c.suffixes[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RefundN returns n previously allowed requests to every limit.
+func (c *compositeLimiter) RefundN(key string, n int) error {
+	return c.refund(key, n, len(c.limiters))
+}
+
+// refund returns n requests to the first count limits that support refunds.
+func (c *compositeLimiter) refund(key string, n, count int) error {
+	var errs []error
+	for i, l := range c.limiters[:count] {
+		if r, ok := l.(ratelimiter.Refunder); ok {
+			if err := r.RefundN(key+c.suffixes[i], n); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRouter_CompositeLimits(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{
+		{
+			Path: "/api/*",
+			Limits: []Limit{
+				{Config: ratelimiter.Config{Rate: 2, Window: time.Second}},
+				{Config: ratelimiter.Config{Rate: 3, Window: time.Minute}, Algorithm: AlgorithmSlidingWindow},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/x", nil))
+		return rec
+	}
+
+	// The per-second limit denies the third request
+	for i := 0; i < 2; i++ {
+		if rec := serve(); rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i+1, rec.Code)
+		}
+	}
+	rec := serve()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 from the per-second limit, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "2" {
+		t.Errorf("Expected the denying limit in headers, got %q", got)
+	}
+
+	// The denied request was not counted by the per-minute limit: one
+	// request is left once the per-second limit refills
+	ep := router.matcher.match("/api/x", httptest.NewRequest("GET", "/api/x", nil))
+	ep.limiter.(*compositeLimiter).limiters[0].Reset("192.0.2.1:/api/*")
+	rec = serve()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("Expected the tightest limit in headers, got remaining %q", got)
+	}
+}
+
+func TestCompositeLimiter_RefundsOnDenial(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	perMinute, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 10, Window: time.Minute}, s)
+	perHour, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Hour}, s)
+	c := newCompositeLimiter([]ratelimiter.Limiter{perMinute, perHour})
+
+	if ok, _ := c.Allow("k"); !ok {
+		t.Fatal("Expected first request to be allowed")
+	}
+	if ok, _ := c.Allow("k"); ok {
+		t.Fatal("Expected second request to be denied by the hourly limit")
+	}
+	if got := perMinute.Remaining("k"); got != 9 {
+		t.Errorf("Expected denied request to be refunded to the first limit, got %d remaining", got)
+	}
+	// The limits keep separate state
+	if got := perHour.Remaining("k#1"); got != 0 {
+		t.Errorf("Expected hourly limit state under its own key, got %d remaining", got)
+	}
+}
+
+func TestCompositeLimiter_ErrorRefunds(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	first, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 10, Window: time.Minute}, s)
+	failing := &MockLimiter{AllowFunc: func(key string) (bool, error) { return false, errors.New("backend down") }}
+	c := newCompositeLimiter([]ratelimiter.Limiter{first, failing})
+
+	if _, err := c.Allow("k"); err == nil {
+		t.Fatal("Expected the error of the failing limit")
+	}
+	if got := first.Remaining("k"); got != 10 {
+		t.Errorf("Expected the request to be refunded, got %d remaining", got)
+	}
+}
+
+func TestNewRouter_ConflictingLimits(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	_, err := NewRouter(http.NotFoundHandler(), s, []EndpointConfig{{
+		Path:   "/",
+		Config: ratelimiter.Config{Rate: 1, Window: time.Second},
+		Limits: []Limit{{Config: ratelimiter.Config{Rate: 1, Window: time.Second}}},
+	}})
+	if !errors.Is(err, ErrConflictingLimits) {
+		t.Errorf("Expected ErrConflictingLimits, got %v", err)
+	}
+}
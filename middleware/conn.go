@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// ErrInvalidMaxConns is returned by NewConnLimiter when maxPerKey is not positive.
+var ErrInvalidMaxConns = errors.New("middleware: max connections per key must be positive")
+
+// WithMessageLimiter sets the limiter used by Conn.Allow and Conn.AllowN to
+// rate limit messages inside a long-lived connection (see ConnLimiter).
+// Each connection is limited separately.
+func WithMessageLimiter(l ratelimiter.Limiter) Option {
+	return func(o *Options) {
+		o.MessageLimiter = l
+	}
+}
+
+// ConnLimiter caps the number of concurrent long-lived connections
+// (WebSocket upgrades and Server-Sent Events streams) per key. Request rate
+// limits do not protect against these: a client that opens a few hundred
+// streams stays well under any request rate while holding server resources.
+//
+// Other requests are passed through untouched; combine ConnLimiter with
+// RateLimitMiddleware or a Router to limit them.
+//
+// A connection slot is released when the handler returns or, if the handler
+// hijacked the connection (as WebSocket libraries do), when the hijacked
+// net.Conn is closed.
+type ConnLimiter struct {
+	conns   *keyCounter
+	options *Options
+
+	seq atomic.Uint64 // Connection IDs for per-connection message limits
+}
+
+// NewConnLimiter creates a connection limiter allowing maxPerKey concurrent
+// connections per key. It accepts the middleware options; KeyFunc,
+// OnLimited, ExcludePaths, SkipFunc, MaxKeySize, the IP prefixes and
+// MessageLimiter are used.
+func NewConnLimiter(maxPerKey int, opts ...Option) (*ConnLimiter, error) {
+	if maxPerKey <= 0 {
+		return nil, ErrInvalidMaxConns
+	}
+
+	options := &Options{
+		KeyFunc:    DefaultKeyFunc,
+		OnLimited:  DefaultOnLimited,
+		MaxKeySize: 4096,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	for i, p := range options.ExcludePaths {
+		options.ExcludePaths[i] = path.Clean(p)
+	}
+	if options.MaxKeySize <= 0 {
+		options.MaxKeySize = 4096
+	}
+	options.KeyFunc = MaskIPKeyFunc(options.KeyFunc, options.IPv4Prefix, options.IPv6Prefix)
+
+	return &ConnLimiter{
+		conns:   newKeyCounter(maxPerKey),
+		options: options,
+	}, nil
+}
+
+// Handler wraps next with the connection limit.
+func (c *ConnLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLongLived(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(c.options.ExcludePaths) > 0 {
+			cleanPath := fastPathClean(r.URL.Path)
+			for _, p := range c.options.ExcludePaths {
+				if matchPath(cleanPath, p) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		if c.options.SkipFunc != nil && c.options.SkipFunc(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := c.options.KeyFunc(r)
+		if len(key) > c.options.MaxKeySize {
+			writeError(w, "Rate limit key too long", http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+
+		if !c.conns.acquire(key) {
+			c.options.OnLimited(w, r)
+			return
+		}
+
+		conn := &Conn{
+			key:     key,
+			id:      key + "#" + strconv.FormatUint(c.seq.Add(1), 10),
+			limiter: c.options.MessageLimiter,
+		}
+		var once sync.Once
+		release := func() {
+			once.Do(func() {
+				c.conns.release(key)
+				if conn.limiter != nil {
+					_ = conn.limiter.Reset(conn.id)
+				}
+			})
+		}
+
+		cw := &connWriter{ResponseWriter: w, release: release}
+		defer func() {
+			if !cw.hijacked {
+				release()
+			}
+		}()
+
+		next.ServeHTTP(cw, r.WithContext(context.WithValue(r.Context(), connContextKey{}, conn)))
+	})
+}
+
+// Active returns the number of open connections for key.
+func (c *ConnLimiter) Active(key string) int {
+	return c.conns.count(key)
+}
+
+// isLongLived reports whether r opens a WebSocket or Server-Sent Events stream.
+func isLongLived(r *http.Request) bool {
+	for _, v := range r.Header.Values("Upgrade") {
+		if headerHasToken(v, "websocket") {
+			return true
+		}
+	}
+	for _, v := range r.Header.Values("Accept") {
+		if strings.Contains(strings.ToLower(v), "text/event-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// headerHasToken reports whether the comma-separated header value v contains token.
+func headerHasToken(v, token string) bool {
+	for v != "" {
+		var part string
+		part, v, _ = strings.Cut(v, ",")
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// connContextKey is the context key of the Conn of a long-lived connection.
+type connContextKey struct{}
+
+// Conn describes a long-lived connection admitted by ConnLimiter.
+type Conn struct {
+	key     string
+	id      string
+	limiter ratelimiter.Limiter
+}
+
+// ConnFromContext returns the Conn stored in ctx by ConnLimiter.
+// The boolean is false if the request was not admitted by a ConnLimiter.
+func ConnFromContext(ctx context.Context) (*Conn, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(*Conn)
+	return conn, ok
+}
+
+// Key returns the rate limiting key of the client.
+func (c *Conn) Key() string {
+	return c.key
+}
+
+// Allow checks if a single message is allowed on the connection.
+func (c *Conn) Allow() (bool, error) {
+	return c.AllowN(1)
+}
+
+// AllowN checks if n messages are allowed on the connection. Without a
+// message limiter (see WithMessageLimiter) every message is allowed.
+func (c *Conn) AllowN(n int) (bool, error) {
+	if c.limiter == nil {
+		return true, nil
+	}
+	return c.limiter.AllowN(c.id, n)
+}
+
+// connWriter tracks whether the handler hijacked the connection, so that its
+// slot is released when the hijacked connection is closed rather than when
+// the handler returns.
+type connWriter struct {
+	http.ResponseWriter
+	release  func()
+	hijacked bool
+}
+
+// Flush sends buffered data to the client, as needed by event streams.
+func (w *connWriter) Flush() {
+	flushWriter(w.ResponseWriter)
+}
+
+// Hijack takes over the connection; closing it releases the connection slot.
+func (w *connWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := hijackWriter(w.ResponseWriter)
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	return &releaseConn{Conn: conn, release: w.release}, rw, nil
+}
+
+// Push initiates an HTTP/2 server push.
+func (w *connWriter) Push(target string, opts *http.PushOptions) error {
+	return pushWriter(w.ResponseWriter, target, opts)
+}
+
+// ReadFrom sends the body from src.
+func (w *connWriter) ReadFrom(src io.Reader) (int64, error) {
+	return readFromWriter(w.ResponseWriter, src)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *connWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// releaseConn releases a connection slot when closed.
+type releaseConn struct {
+	net.Conn
+	release func()
+}
+
+// Close closes the connection and releases its slot.
+func (c *releaseConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
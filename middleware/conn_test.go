@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func newStreamRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.Header.Set("Accept", "text/event-stream")
+	return req
+}
+
+func TestConnLimiter_MaxPerKey(t *testing.T) {
+	cl, err := NewConnLimiter(1)
+	if err != nil {
+		t.Fatalf("NewConnLimiter failed: %v", err)
+	}
+
+	entered := make(chan struct{})
+	done := make(chan struct{})
+	handler := cl.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			entered <- struct{}{}
+			<-done
+		}
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), newStreamRequest())
+	<-entered
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newStreamRequest())
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected second stream to be limited, got %d", rec.Code)
+	}
+
+	// Regular requests are not counted
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected regular request to pass, got %d", rec.Code)
+	}
+
+	close(done)
+	waitUntil(t, func() bool { return cl.Active("1.2.3.4") == 0 })
+
+	go handler.ServeHTTP(httptest.NewRecorder(), newStreamRequest())
+	select {
+	case <-entered:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a stream to be admitted after release")
+	}
+}
+
+func TestConnLimiter_Hijack(t *testing.T) {
+	cl, _ := NewConnLimiter(1)
+
+	hijacked := make(chan net.Conn, 1)
+	srv := httptest.NewServer(cl.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		hijacked <- conn
+	})))
+	defer srv.Close()
+
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	conn := <-hijacked
+	// The handler returned, but the hijacked connection is still open
+	time.Sleep(10 * time.Millisecond)
+	if got := cl.Active("127.0.0.1"); got != 1 {
+		t.Errorf("Expected hijacked connection to hold its slot, got %d", got)
+	}
+
+	conn.Close()
+	if got := cl.Active("127.0.0.1"); got != 0 {
+		t.Errorf("Expected slot released on close, got %d", got)
+	}
+}
+
+func TestConnLimiter_MessageLimiter(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	messages, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 2, Window: time.Hour}, s)
+
+	cl, _ := NewConnLimiter(2, WithMessageLimiter(messages))
+
+	var results []bool
+	handler := cl.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := ConnFromContext(r.Context())
+		if !ok {
+			t.Fatal("Expected Conn in context")
+		}
+		if conn.Key() != "1.2.3.4" {
+			t.Errorf("Unexpected key %q", conn.Key())
+		}
+		for i := 0; i < 3; i++ {
+			allowed, _ := conn.Allow()
+			results = append(results, allowed)
+		}
+	}))
+
+	// Each connection has its own message budget
+	for i := 0; i < 2; i++ {
+		results = nil
+		handler.ServeHTTP(httptest.NewRecorder(), newStreamRequest())
+		if len(results) != 3 || !results[0] || !results[1] || results[2] {
+			t.Errorf("Connection %d: expected [true true false], got %v", i+1, results)
+		}
+	}
+}
+
+func TestConnLimiter_InvalidMax(t *testing.T) {
+	if _, err := NewConnLimiter(0); !errors.Is(err, ErrInvalidMaxConns) {
+		t.Errorf("Expected ErrInvalidMaxConns, got %v", err)
+	}
+}
+
+func TestIsLongLived(t *testing.T) {
+	tests := []struct {
+		header, value string
+		want          bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"Upgrade", "h2c, WebSocket", true},
+		{"Upgrade", "h2c", false},
+		{"Accept", "text/event-stream", true},
+		{"Accept", "application/json", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(tt.header, tt.value)
+		if got := isLongLived(req); got != tt.want {
+			t.Errorf("%s: %q: got %v, want %v", tt.header, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// contextKey is the key type for values stored in the request context.
+type contextKey struct{}
+
+// contextInfo is the rate limit information stored in the request context.
+type contextInfo struct {
+	key    string
+	result ratelimiter.Result
+}
+
+// resultContext carries a contextInfo. It does the job of
+// context.WithValue with a single allocation for the context and the info.
+type resultContext struct {
+	context.Context
+	info contextInfo
+}
+
+// Value returns the contextInfo for contextKey and defers to the parent
+// context for other keys.
+func (c *resultContext) Value(key any) any {
+	if key == (contextKey{}) {
+		return &c.info
+	}
+	return c.Context.Value(key)
+}
+
+// withResult returns a shallow copy of r carrying the rate limit key and result.
+func withResult(r *http.Request, key string, result ratelimiter.Result) *http.Request {
+	return r.WithContext(&resultContext{
+		Context: r.Context(),
+		info:    contextInfo{key: key, result: result},
+	})
+}
+
+// ResultFromContext returns the rate limit Result stored in ctx by the middleware or Router.
+// Downstream handlers can use it to adapt their behavior or log the remaining quota.
+// For limiters that do not implement ratelimiter.LimiterWithDetails only
+// Result.Allowed is populated.
+// The boolean is false if the request was not rate limited (e.g. excluded or skipped).
+func ResultFromContext(ctx context.Context) (ratelimiter.Result, bool) {
+	info, ok := ctx.Value(contextKey{}).(*contextInfo)
+	if !ok {
+		return ratelimiter.Result{}, false
+	}
+	return info.result, true
+}
+
+// KeyFromContext returns the rate limiting key stored in ctx by the middleware or Router.
+// The boolean is false if the request was not rate limited (e.g. excluded or skipped).
+func KeyFromContext(ctx context.Context) (string, bool) {
+	info, ok := ctx.Value(contextKey{}).(*contextInfo)
+	if !ok {
+		return "", false
+	}
+	return info.key, true
+}
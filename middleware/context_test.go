@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRateLimitMiddleware_ResultInContext(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{
+		Rate:   5,
+		Window: time.Minute,
+	}, s)
+
+	var gotResult ratelimiter.Result
+	var gotKey string
+	var found bool
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotResult, found = ResultFromContext(r.Context())
+		gotKey, _ = KeyFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !found {
+		t.Fatal("Expected result in context")
+	}
+	if !gotResult.Allowed || gotResult.Limit != 5 || gotResult.Remaining != 4 {
+		t.Errorf("Unexpected result: %+v", gotResult)
+	}
+	if gotKey != "10.0.0.1" {
+		t.Errorf("Expected key 10.0.0.1, got %q", gotKey)
+	}
+}
+
+func TestRateLimitMiddleware_ResultInContextOnLimited(t *testing.T) {
+	limiter := &MockLimiter{
+		AllowFunc: func(key string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	var found bool
+	var result ratelimiter.Result
+	onLimited := func(w http.ResponseWriter, r *http.Request) {
+		result, found = ResultFromContext(r.Context())
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+
+	handler := RateLimitMiddleware(limiter, WithOnLimited(onLimited))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !found {
+		t.Fatal("Expected result in context for OnLimited")
+	}
+	if result.Allowed {
+		t.Error("Expected Allowed=false")
+	}
+}
+
+func TestRateLimitMiddleware_NoResultWhenExcluded(t *testing.T) {
+	limiter := &MockLimiter{}
+
+	found := true
+	handler := RateLimitMiddleware(limiter, WithExcludePaths("/health"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, found = ResultFromContext(r.Context())
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	if found {
+		t.Error("Expected no result in context for excluded path")
+	}
+}
+
+func TestRouter_ResultInContext(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	var gotKey string
+	var gotResult ratelimiter.Result
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey, _ = KeyFromContext(r.Context())
+		gotResult, _ = ResultFromContext(r.Context())
+	})
+
+	router, err := NewRouter(handler, s, []EndpointConfig{
+		{Path: "/api", Config: ratelimiter.Config{Rate: 3, Window: time.Minute}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotKey != "10.0.0.2:/api" {
+		t.Errorf("Expected key 10.0.0.2:/api, got %q", gotKey)
+	}
+	if gotResult.Limit != 3 || gotResult.Remaining != 2 {
+		t.Errorf("Unexpected result: %+v", gotResult)
+	}
+}
+
+func TestWithResult_KeepsParentContext(t *testing.T) {
+	type parentKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), parentKey{}, "parent"))
+	req := withResult(httptest.NewRequest("GET", "/", nil).WithContext(ctx), "k", ratelimiter.Result{Allowed: true})
+
+	if v := req.Context().Value(parentKey{}); v != "parent" {
+		t.Errorf("Expected parent value, got %v", v)
+	}
+	if key, ok := KeyFromContext(req.Context()); !ok || key != "k" {
+		t.Errorf("Expected key k, got %q, %v", key, ok)
+	}
+
+	// Contexts derived from the request are canceled with the parent
+	child, stop := context.WithCancel(req.Context())
+	defer stop()
+	cancel()
+	select {
+	case <-child.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Derived context not canceled with the parent")
+	}
+}
+
+func TestRateLimitMiddleware_Allocations(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 60, Window: time.Minute}, s)
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	// Only the request copy carrying the result, its context and the header
+	// values allocate
+	if allocs := testing.AllocsPerRun(10, func() { handler.ServeHTTP(w, req) }); allocs > 3 {
+		t.Errorf("Expected at most 3 allocations per request, got %v", allocs)
+	}
+}
+
+func BenchmarkRateLimitMiddleware(b *testing.B) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1000000000, Window: time.Second}, s)
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrInvalidGraphQLRequest is returned by the GraphQLCost cost function for
+// requests that are not GraphQL requests.
+var ErrInvalidGraphQLRequest = errors.New("middleware: invalid GraphQL request")
+
+// CostFunc returns the number of requests a request counts for. Requests
+// whose cost cannot be computed are rejected with 400 Bad Request.
+type CostFunc func(r *http.Request) (int, error)
+
+// WithCost charges each request the cost returned by fn instead of 1, for
+// endpoints whose requests vary widely in weight (GraphQL queries, batch
+// APIs). Costs below 1 count as 1. Requests that cost more than the limiter
+// can ever allow are rejected with 413.
+func WithCost(fn CostFunc) Option {
+	return func(o *Options) {
+		o.CostFunc = fn
+	}
+}
+
+// requestCost returns the cost of r. It reports false if the cost could not
+// be computed and a response has been written.
+func requestCost(w http.ResponseWriter, r *http.Request, fn CostFunc) (int, bool) {
+	if fn == nil {
+		return 1, true
+	}
+	cost, err := fn(r)
+	if err != nil {
+		writeError(w, "Invalid request cost", http.StatusBadRequest)
+		return 0, false
+	}
+	return max(cost, 1), true
+}
+
+// GraphQLRequest is a GraphQL operation, as sent in the body of a POST
+// request or in the query string of a GET request.
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// defaultGraphQLBodySize is the default maximum body size read by GraphQLCost.
+const defaultGraphQLBodySize = 1 << 20
+
+// GraphQLCost returns a CostFunc charging GraphQL requests the complexity
+// score of their operation, as computed by complexity (e.g. with the
+// complexity package of the GraphQL server in use):
+//
+//	mw := middleware.RateLimitMiddleware(limiter, middleware.WithCost(
+//		middleware.GraphQLCost(func(req middleware.GraphQLRequest) (int, error) {
+//			return estimateComplexity(schema, req.Query, req.OperationName, req.Variables)
+//		}, 0),
+//	))
+//
+// The operation is read from the JSON body of POST requests, which is
+// restored for the handler, or from the query string of GET requests. A
+// batch of operations costs the sum of their scores. Bodies larger than
+// maxBodySize (default 1 MiB) are rejected.
+func GraphQLCost(complexity func(req GraphQLRequest) (int, error), maxBodySize int64) CostFunc {
+	if maxBodySize <= 0 {
+		maxBodySize = defaultGraphQLBodySize
+	}
+	return func(r *http.Request) (int, error) {
+		if r.Method == http.MethodGet {
+			q := r.URL.Query()
+			req := GraphQLRequest{Query: q.Get("query"), OperationName: q.Get("operationName")}
+			if v := q.Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					return 0, ErrInvalidGraphQLRequest
+				}
+			}
+			return graphQLCost(complexity, req)
+		}
+
+		if r.Body == nil || r.Body == http.NoBody {
+			return 0, ErrInvalidGraphQLRequest
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		if err != nil {
+			return 0, err
+		}
+		if int64(len(body)) > maxBodySize {
+			return 0, ErrInvalidGraphQLRequest
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		body = bytes.TrimSpace(body)
+		if len(body) > 0 && body[0] == '[' {
+			var batch []GraphQLRequest
+			if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+				return 0, ErrInvalidGraphQLRequest
+			}
+			total := 0
+			for _, req := range batch {
+				cost, err := graphQLCost(complexity, req)
+				if err != nil {
+					return 0, err
+				}
+				total += cost
+			}
+			return total, nil
+		}
+
+		var req GraphQLRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return 0, ErrInvalidGraphQLRequest
+		}
+		return graphQLCost(complexity, req)
+	}
+}
+
+// graphQLCost scores a single operation.
+func graphQLCost(complexity func(req GraphQLRequest) (int, error), req GraphQLRequest) (int, error) {
+	if req.Query == "" {
+		return 0, ErrInvalidGraphQLRequest
+	}
+	cost, err := complexity(req)
+	if err != nil {
+		return 0, err
+	}
+	return max(cost, 1), nil
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// fieldCount scores a GraphQL operation by its number of fields, a crude
+// stand-in for a real complexity analysis.
+func fieldCount(req GraphQLRequest) (int, error) {
+	if strings.Contains(req.Query, "error") {
+		return 0, errors.New("unknown field")
+	}
+	return len(strings.Fields(strings.NewReplacer("{", " ", "}", " ").Replace(req.Query))) - 1, nil
+}
+
+func TestRateLimitMiddleware_GraphQLCost(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 10, Window: time.Minute}, s)
+
+	var bodies []string
+	handler := RateLimitMiddleware(limiter, WithCost(GraphQLCost(fieldCount, 0)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 5 fields, then 1 + 2 in a batch: 8 of 10 tokens
+	heavy := `{"query": "query { user { name friends { name email } } }"}`
+	if rec := post(heavy); rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Remaining") != "5" {
+		t.Errorf("Expected 200 with 5 remaining, got %d with %s", rec.Code, rec.Header().Get("X-RateLimit-Remaining"))
+	}
+	if len(bodies) != 1 || bodies[0] != heavy {
+		t.Errorf("Expected the body to be restored for the handler, got %q", bodies)
+	}
+	if rec := post(`[{"query": "query { me }"}, {"query": "query { me { name } }"}]`); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for the batch, got %d", rec.Code)
+	}
+	if rec := post(heavy); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 once the cost exceeds the remaining tokens, got %d", rec.Code)
+	}
+	if rec := post(`{"query": "query { me }"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected a cheap query to fit in the remaining tokens, got %d", rec.Code)
+	}
+
+	for _, body := range []string{`not json`, `{"query": ""}`, `{"query": "query { error }"}`, `[]`} {
+		if rec := post(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestGraphQLCost_Get(t *testing.T) {
+	cost := GraphQLCost(func(req GraphQLRequest) (int, error) {
+		if req.OperationName != "Me" || req.Variables["id"] != "42" {
+			t.Errorf("Unexpected request %+v", req)
+		}
+		return 7, nil
+	}, 0)
+
+	q := url.Values{"query": {"query Me($id: ID) { user(id: $id) { name } }"}, "operationName": {"Me"}, "variables": {`{"id": "42"}`}}
+	n, err := cost(httptest.NewRequest(http.MethodGet, "/graphql?"+q.Encode(), nil))
+	if err != nil || n != 7 {
+		t.Errorf("cost = %d, %v, want 7", n, err)
+	}
+}
+
+func TestGraphQLCost_MaxBodySize(t *testing.T) {
+	cost := GraphQLCost(fieldCount, 16)
+	_, err := cost(httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "query { me { name } }"}`)))
+	if !errors.Is(err, ErrInvalidGraphQLRequest) {
+		t.Errorf("err = %v, want ErrInvalidGraphQLRequest", err)
+	}
+}
+
+func TestRouter_CostRefund(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}), s, []EndpointConfig{{
+		Path:   "/batch",
+		Config: ratelimiter.Config{Rate: 10, Window: time.Minute},
+	}}, WithCost(func(r *http.Request) (int, error) { return 8, nil }), WithCountStatus(NotServerError))
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	// Each request costs 8 of 10 tokens, and is refunded on 5xx
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/batch", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Request %d: expected the cost to be refunded, got %d", i, rec.Code)
+		}
+	}
+}
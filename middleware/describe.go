@@ -0,0 +1,257 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// Description is a machine-readable summary of the limits of a Router, for
+// developer portals and client documentation (see Router.Describe).
+type Description struct {
+	// Global is the limit on the total throughput of all clients, if any.
+	Global []LimitDescription `json:"global,omitempty"`
+
+	// Endpoints are the rate limited endpoints, in matching order.
+	Endpoints []EndpointDescription `json:"endpoints"`
+}
+
+// EndpointDescription describes the limits of an endpoint.
+type EndpointDescription struct {
+	Path    string            `json:"path"`
+	Methods []string          `json:"methods,omitempty"`
+	Host    string            `json:"host,omitempty"`
+	Query   map[string]string `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Scope is what each limit is counted for, e.g. "client" or
+	// "client per tenant" for an endpoint with KeyQuery "tenant".
+	Scope string `json:"scope"`
+
+	// Limits must all allow a request. With scheduled profiles, the limit
+	// without When applies when no profile does.
+	Limits []LimitDescription `json:"limits"`
+
+	// Blocked is set while the endpoint is in maintenance (see
+	// Router.SetBlocked).
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// LimitDescription describes a single limit.
+type LimitDescription struct {
+	Algorithm string `json:"algorithm"`
+	Rate      int    `json:"rate"`
+	Window    string `json:"window"`
+	Burst     int    `json:"burst"`
+
+	// Profile and When are the name and cron expression of a scheduled
+	// profile (see EndpointConfig.Profiles).
+	Profile string `json:"profile,omitempty"`
+	When    string `json:"when,omitempty"`
+}
+
+// Describe returns the limits of the router's endpoints as configured, e.g.
+// to serve them as JSON to a developer portal so that the documented limits
+// are always those running. Limits are the configured ones, before any
+// global scale (see ratelimiter.SetGlobalScale).
+func (r *Router) Describe() Description {
+	d := Description{Endpoints: make([]EndpointDescription, 0, len(r.endpoints))}
+	if dl, ok := r.options.GlobalLimiter.(ratelimiter.DescribableLimiter); ok {
+		d.Global = []LimitDescription{describeLimit(Algorithm(dl.Algorithm()), dl.Config())}
+	}
+
+	for i := range r.endpoints {
+		ep := &r.endpoints[i]
+		desc := EndpointDescription{
+			Path:    ep.config.Path,
+			Methods: ep.config.Methods,
+			Host:    ep.config.Host,
+			Query:   ep.config.Query,
+			Headers: ep.config.Headers,
+			Scope:   endpointScope(ep.config),
+			Blocked: ep.blocked.Load(),
+		}
+		for _, p := range ep.config.Profiles {
+			limit := describeLimit(ep.config.Algorithm, p.Config)
+			limit.Profile, limit.When = p.Name, p.When
+			desc.Limits = append(desc.Limits, limit)
+		}
+		if len(ep.config.Limits) == 0 {
+			desc.Limits = append(desc.Limits, describeLimit(ep.config.Algorithm, ep.config.Config))
+		}
+		for _, l := range ep.config.Limits {
+			desc.Limits = append(desc.Limits, describeLimit(l.Algorithm, l.Config))
+		}
+		d.Endpoints = append(d.Endpoints, desc)
+	}
+	return d
+}
+
+// describeLimit describes a limit with the defaults of its algorithm applied.
+func describeLimit(algorithm Algorithm, config ratelimiter.Config) LimitDescription {
+	if algorithm == "" {
+		algorithm = AlgorithmTokenBucket
+	}
+	burst := config.Rate
+	if algorithm == AlgorithmTokenBucket && config.BurstSize > 0 {
+		burst = config.BurstSize
+	}
+	return LimitDescription{
+		Algorithm: string(algorithm),
+		Rate:      config.Rate,
+		Window:    config.Window.String(),
+		Burst:     burst,
+	}
+}
+
+// endpointScope returns what the limits of an endpoint are counted for.
+func endpointScope(config EndpointConfig) string {
+	scope := "client"
+	if strings.HasPrefix(config.Host, "*") {
+		scope += " per host"
+	}
+	for _, name := range config.KeyQuery {
+		scope += " per " + name
+	}
+	return scope
+}
+
+// Markdown renders the description as a Markdown table.
+func (d Description) Markdown() string {
+	var b strings.Builder
+	b.WriteString("| Endpoint | Methods | Limit | Algorithm | Scope |\n")
+	b.WriteString("|---|---|---|---|---|\n")
+	if len(d.Global) > 0 {
+		fmt.Fprintf(&b, "| All endpoints | All | %s | %s | all clients |\n",
+			d.Global[0].Text(), d.Global[0].Algorithm)
+	}
+	for _, ep := range d.Endpoints {
+		for _, limit := range ep.Limits {
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n",
+				ep.Endpoint(), ep.MethodList(), limit.Text(), limit.Algorithm, ep.Scope)
+		}
+	}
+	return b.String()
+}
+
+// descriptionHTML renders a Description as an HTML table.
+var descriptionHTML = template.Must(template.New("description").Parse(`<table>
+<thead><tr><th>Endpoint</th><th>Methods</th><th>Limit</th><th>Algorithm</th><th>Scope</th></tr></thead>
+<tbody>
+{{- with .Global}}{{with index . 0}}
+<tr><td>All endpoints</td><td>All</td><td>{{.Text}}</td><td>{{.Algorithm}}</td><td>all clients</td></tr>
+{{- end}}{{end}}
+{{- range $ep := .Endpoints}}{{range .Limits}}
+<tr><td><code>{{$ep.Endpoint}}</code></td><td>{{$ep.MethodList}}</td><td>{{.Text}}</td><td>{{.Algorithm}}</td><td>{{$ep.Scope}}</td></tr>
+{{- end}}{{end}}
+</tbody>
+</table>
+`))
+
+// HTML renders the description as an HTML table, with its values escaped.
+func (d Description) HTML() string {
+	var b bytes.Buffer
+	if err := descriptionHTML.Execute(&b, d); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+// Endpoint returns the path of the endpoint, with its host and query
+// conditions.
+func (ep EndpointDescription) Endpoint() string {
+	s := ep.Host + ep.Path
+	var conditions []string
+	for name, value := range ep.Query {
+		conditions = append(conditions, name+"="+value)
+	}
+	if len(conditions) > 0 {
+		slices.Sort(conditions)
+		s += "?" + strings.Join(conditions, "&")
+	}
+	return s
+}
+
+// MethodList returns the methods of the endpoint, or "All".
+func (ep EndpointDescription) MethodList() string {
+	if len(ep.Methods) == 0 {
+		return "All"
+	}
+	return strings.Join(ep.Methods, ", ")
+}
+
+// Text returns the limit in words, e.g. "100 requests per minute (burst
+// 200)".
+func (l LimitDescription) Text() string {
+	s := fmt.Sprintf("%d requests per %s", l.Rate, windowText(l.Window))
+	if l.Rate == 1 {
+		s = "1 request per " + windowText(l.Window)
+	}
+	if l.Burst != l.Rate {
+		s += fmt.Sprintf(" (burst %d)", l.Burst)
+	}
+	if l.When != "" {
+		s += fmt.Sprintf(" when %q", l.When)
+	}
+	return s
+}
+
+// windowText returns a window in words, e.g. "minute" or "10s".
+func windowText(window string) string {
+	d, err := time.ParseDuration(window)
+	if err != nil {
+		return window
+	}
+	switch d {
+	case time.Second:
+		return "second"
+	case time.Minute:
+		return "minute"
+	case time.Hour:
+		return "hour"
+	case 24 * time.Hour:
+		return "day"
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// DescribeHandler returns an HTTP handler serving Describe as JSON, or as
+// Markdown or HTML with the "format" query parameter set to "markdown" or
+// "html". It exposes the configuration of the limits but no client data.
+func (r *Router) DescribeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		d := r.Describe()
+		w.Header().Set("Cache-Control", "no-store")
+		switch req.URL.Query().Get("format") {
+		case "markdown":
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			_, _ = w.Write([]byte(d.Markdown()))
+		case "html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(d.HTML()))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(d)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func newDescribeRouter(t *testing.T) *Router {
+	t.Helper()
+	s := store.NewMemoryStore()
+	t.Cleanup(func() { s.Close() })
+
+	router, err := NewRouter(http.NotFoundHandler(), s, []EndpointConfig{
+		{
+			Path:     "/api/search",
+			Methods:  []string{"GET"},
+			Config:   ratelimiter.Config{Rate: 100, Window: time.Minute, BurstSize: 200},
+			KeyQuery: []string{"tenant"},
+		},
+		{
+			Path: "/api/*",
+			Limits: []Limit{
+				{Config: ratelimiter.Config{Rate: 10, Window: time.Second}},
+				{Config: ratelimiter.Config{Rate: 1000, Window: time.Hour}, Algorithm: AlgorithmSlidingWindow},
+			},
+		},
+		{
+			Path:   "/reports",
+			Config: ratelimiter.Config{Rate: 5, Window: 10 * time.Second},
+			Profiles: []algorithms.Profile{
+				{Name: "business-hours", When: "* 9-17 * * 1-5", Config: ratelimiter.Config{Rate: 1, Window: 10 * time.Second}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	t.Cleanup(func() { router.Close() })
+	return router
+}
+
+func TestRouter_Describe(t *testing.T) {
+	router := newDescribeRouter(t)
+	router.SetBlocked("/reports", true)
+
+	d := router.Describe()
+	if len(d.Endpoints) != 3 {
+		t.Fatalf("Expected 3 endpoints, got %+v", d.Endpoints)
+	}
+
+	search := d.Endpoints[0]
+	if search.Path != "/api/search" || search.Scope != "client per tenant" {
+		t.Errorf("Unexpected /api/search description: %+v", search)
+	}
+	want := LimitDescription{Algorithm: "token_bucket", Rate: 100, Window: "1m0s", Burst: 200}
+	if len(search.Limits) != 1 || search.Limits[0] != want {
+		t.Errorf("Limits = %+v, want %+v", search.Limits, want)
+	}
+
+	reports := d.Endpoints[1]
+	if !reports.Blocked || len(reports.Limits) != 2 || reports.Limits[0].Profile != "business-hours" || reports.Limits[1].When != "" {
+		t.Errorf("Unexpected /reports description: %+v", reports)
+	}
+
+	api := d.Endpoints[2]
+	if len(api.Limits) != 2 || api.Limits[1].Algorithm != "sliding_window" || api.Limits[1].Burst != 1000 {
+		t.Errorf("Unexpected /api/* description: %+v", api)
+	}
+}
+
+func TestDescription_Markdown(t *testing.T) {
+	md := newDescribeRouter(t).Describe().Markdown()
+	for _, want := range []string{
+		"| `/api/search` | GET | 100 requests per minute (burst 200) | token_bucket | client per tenant |",
+		"| `/api/*` | All | 1000 requests per hour | sliding_window | client |",
+		`| ` + "`/reports`" + ` | All | 1 request per 10s when "* 9-17 * * 1-5" | token_bucket | client |`,
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown lacks %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestRouter_DescribeHandler(t *testing.T) {
+	handler := newDescribeRouter(t).DescribeHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var d Description
+	if err := json.Unmarshal(rec.Body.Bytes(), &d); err != nil || len(d.Endpoints) != 3 {
+		t.Errorf("Expected the JSON description, got %s (%v)", rec.Body, err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/?format=html", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "<td><code>/api/search</code></td><td>GET</td><td>100 requests per minute (burst 200)</td>") {
+		t.Errorf("Unexpected HTML:\n%s", rec.Body)
+	}
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRateLimitMiddleware_DryRun(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s)
+
+	var buf bytes.Buffer
+	a, _ := NewAuditor(AuditConfig{Sink: NewCSVSink(&buf), OnlyDenied: true})
+	served := 0
+	handler := RateLimitMiddleware(limiter, WithDryRun(true), WithAudit(a))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}))
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Request %d: expected 200 in dry run, got %d", i, rec.Code)
+		}
+		if rec.Header().Get("Retry-After") != "" {
+			t.Errorf("Request %d: unexpected Retry-After in dry run", i)
+		}
+	}
+	a.Close()
+
+	if served != 3 {
+		t.Errorf("Expected 3 requests served, got %d", served)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected a header and 2 would-block rows, got %v", rows)
+	}
+	if rows[0][0] != "time" || rows[0][5] != "dry_run" {
+		t.Errorf("Unexpected header %v", rows[0])
+	}
+	if row := rows[1]; row[1] != hashKey("1.2.3.4") || row[2] != defaultEndpointName || row[3] != "false" || row[5] != "true" {
+		t.Errorf("Unexpected row %v", row)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, rows[1][0]); err != nil {
+		t.Errorf("Invalid time %q: %v", rows[1][0], err)
+	}
+}
+
+func TestRouter_DryRun(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	history := NewHistory(HistoryConfig{})
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{{
+		Path:   "/api/*",
+		Config: ratelimiter.Config{Rate: 1, Window: time.Minute},
+	}}, WithDryRun(true), WithHistory(history), WithQueue(10, time.Second))
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/api/x", nil)
+		req.RemoteAddr = "192.168.1.1:1"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Request %d: expected 200 in dry run, got %d", i, rec.Code)
+		}
+	}
+
+	entries := history.Key("192.168.1.1")
+	if len(entries) != 2 || !entries[0].Allowed || entries[1].Allowed {
+		t.Errorf("Expected allowed then would-block, got %+v", entries)
+	}
+}
+
+func TestRateLimitMiddleware_DryRunGlobal(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	perClient, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 10, Window: time.Minute}, s)
+	global, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s)
+
+	handler := RateLimitMiddleware(perClient, WithGlobalLimit(global), WithDryRun(true))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Request %d: expected 200 in dry run, got %d", i, rec.Code)
+		}
+	}
+}
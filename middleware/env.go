@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// OptionsFromEnv reads middleware options from environment variables under
+// prefix (see ratelimiter.EnvName), the counterpart of
+// ratelimiter.ConfigFromEnv:
+//
+//	EXCLUDE_PATHS       comma-separated paths, see WithExcludePaths
+//	INCLUDE_METHODS     comma-separated methods, see WithIncludeMethods
+//	TRUSTED_PROXIES     comma-separated IPs or CIDR blocks, see TrustedIPKeyFunc
+//	IPV4_PREFIX         see WithIPv4Prefix
+//	IPV6_PREFIX         see WithIPv6Prefix
+//	HEADERS             always, denied or never, see WithHeaders
+//	HEADER_PREFIX       see WithHeaderPrefix
+//	RETRY_AFTER_JITTER  a duration, see WithRetryAfterJitter
+//	MAX_KEY_SIZE        see WithMaxKeySize
+//	MAX_IN_FLIGHT       see WithMaxInFlight
+//
+// Unset variables add no option, so the returned options can be appended
+// to options set in code to override them.
+func OptionsFromEnv(prefix string) ([]Option, error) {
+	var opts []Option
+	lookup := func(name string) (string, bool) {
+		v, ok := os.LookupEnv(ratelimiter.EnvName(prefix, name))
+		v = strings.TrimSpace(v)
+		return v, ok && v != ""
+	}
+	invalid := func(name, v string) error {
+		return fmt.Errorf("%s: invalid value %q", ratelimiter.EnvName(prefix, name), v)
+	}
+	ints := []struct {
+		name   string
+		option func(int) Option
+	}{
+		{"IPV4_PREFIX", WithIPv4Prefix},
+		{"IPV6_PREFIX", WithIPv6Prefix},
+		{"MAX_KEY_SIZE", WithMaxKeySize},
+		{"MAX_IN_FLIGHT", WithMaxInFlight},
+	}
+
+	if v, ok := lookup("EXCLUDE_PATHS"); ok {
+		opts = append(opts, WithExcludePaths(splitList(v)...))
+	}
+	if v, ok := lookup("INCLUDE_METHODS"); ok {
+		methods := splitList(v)
+		for i, m := range methods {
+			methods[i] = strings.ToUpper(m)
+		}
+		opts = append(opts, WithIncludeMethods(methods...))
+	}
+	if v, ok := lookup("TRUSTED_PROXIES"); ok {
+		keyFunc, err := TrustedIPKeyFunc(splitList(v))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ratelimiter.EnvName(prefix, "TRUSTED_PROXIES"), err)
+		}
+		opts = append(opts, WithKeyFunc(keyFunc))
+	}
+	for _, o := range ints {
+		if v, ok := lookup(o.name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, invalid(o.name, v)
+			}
+			opts = append(opts, o.option(n))
+		}
+	}
+	if v, ok := lookup("HEADERS"); ok {
+		mode, ok := headerModes[strings.ToLower(v)]
+		if !ok {
+			return nil, invalid("HEADERS", v)
+		}
+		opts = append(opts, WithHeaders(mode))
+	}
+	if v, ok := lookup("HEADER_PREFIX"); ok {
+		opts = append(opts, WithHeaderPrefix(v))
+	}
+	if v, ok := lookup("RETRY_AFTER_JITTER"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, invalid("RETRY_AFTER_JITTER", v)
+		}
+		opts = append(opts, WithRetryAfterJitter(d))
+	}
+	return opts, nil
+}
+
+// headerModes are the names of the header modes in configuration.
+var headerModes = map[string]HeaderMode{
+	"always": HeadersAlways,
+	"denied": HeadersOnDenial,
+	"never":  HeadersNever,
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
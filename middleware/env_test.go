@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("RL_EXCLUDE_PATHS", "/health, /metrics")
+	t.Setenv("RL_INCLUDE_METHODS", "post,put")
+	t.Setenv("RL_TRUSTED_PROXIES", "10.0.0.0/8")
+	t.Setenv("RL_IPV6_PREFIX", "64")
+	t.Setenv("RL_HEADERS", "denied")
+	t.Setenv("RL_HEADER_PREFIX", "RateLimit")
+	t.Setenv("RL_RETRY_AFTER_JITTER", "2s")
+
+	opts, err := OptionsFromEnv("RL")
+	if err != nil {
+		t.Fatalf("OptionsFromEnv: %v", err)
+	}
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if len(o.ExcludePaths) != 2 || o.ExcludePaths[1] != "/metrics" {
+		t.Errorf("Unexpected ExcludePaths: %q", o.ExcludePaths)
+	}
+	if len(o.IncludeMethods) != 2 || o.IncludeMethods[0] != "POST" {
+		t.Errorf("Unexpected IncludeMethods: %q", o.IncludeMethods)
+	}
+	if o.IPv6Prefix != 64 || o.HeaderMode != HeadersOnDenial || o.HeaderPrefix != "RateLimit" || o.RetryAfterJitter != 2*time.Second {
+		t.Errorf("Unexpected options: %+v", o)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "192.0.2.7")
+	if key := o.KeyFunc(req); key != "192.0.2.7" {
+		t.Errorf("Expected the trusted proxy's X-Forwarded-For to be used, got %q", key)
+	}
+}
+
+func TestOptionsFromEnv_Unset(t *testing.T) {
+	opts, err := OptionsFromEnv("RATELIMITER_TEST_UNSET")
+	if err != nil || len(opts) != 0 {
+		t.Errorf("Expected no options, got %d (err %v)", len(opts), err)
+	}
+}
+
+func TestOptionsFromEnv_Invalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"T_TRUSTED_PROXIES":    "not-an-ip",
+		"T_IPV4_PREFIX":        "-1",
+		"T_MAX_IN_FLIGHT":      "many",
+		"T_HEADERS":            "sometimes",
+		"T_RETRY_AFTER_JITTER": "1",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := OptionsFromEnv("T"); err == nil {
+				t.Errorf("%s=%s: expected an error", name, value)
+			}
+		})
+	}
+}
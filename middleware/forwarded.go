@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// maxForwardedElements bounds the number of elements kept from Forwarded
+// headers to prevent memory DoS with huge header chains. The rightmost
+// elements (closest to us, appended by trusted proxies) are kept.
+const maxForwardedElements = 64
+
+// ForwardedElement is a single proxy hop from an RFC 7239 Forwarded header.
+type ForwardedElement struct {
+	// For identifies the node making the request to the proxy (usually the client IP).
+	// IPv6 brackets and ports are preserved as sent (e.g. "[2001:db8::1]:4711").
+	For string
+
+	// By identifies the interface where the request came in to the proxy.
+	By string
+
+	// Host is the Host request header as received by the proxy.
+	Host string
+
+	// Proto is the protocol used to make the request (e.g. "https").
+	Proto string
+}
+
+// ParseForwarded parses RFC 7239 Forwarded header values into their elements,
+// in the order they appear (leftmost element is the original client).
+// Multiple header values are treated as one comma-separated list.
+// Unknown parameters are ignored and malformed pairs are skipped.
+// At most 64 elements are returned; for longer chains the leftmost elements are dropped.
+func ParseForwarded(values []string) []ForwardedElement {
+	var elements []ForwardedElement
+	for _, v := range values {
+		for len(v) > 0 {
+			var elem ForwardedElement
+			elem, v = parseForwardedElement(v)
+			if len(elements) == maxForwardedElements {
+				copy(elements, elements[1:])
+				elements = elements[:maxForwardedElements-1]
+			}
+			elements = append(elements, elem)
+		}
+	}
+	return elements
+}
+
+// parseForwardedElement parses one comma-terminated element and returns the rest of the header.
+func parseForwardedElement(s string) (ForwardedElement, string) {
+	var elem ForwardedElement
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return elem, ""
+		}
+		if s[0] == ',' {
+			return elem, s[1:]
+		}
+		if s[0] == ';' {
+			s = s[1:]
+			continue
+		}
+
+		// Parameter name
+		eq := strings.IndexAny(s, "=;,")
+		if eq < 0 || s[eq] != '=' {
+			// Malformed pair without a value, skip to the next separator
+			if eq < 0 {
+				return elem, ""
+			}
+			s = s[eq:]
+			continue
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+
+		// Parameter value: token or quoted-string
+		var value string
+		if len(s) > 0 && s[0] == '"' {
+			value, s = parseQuotedString(s)
+		} else {
+			end := strings.IndexAny(s, ";,")
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+
+		switch strings.ToLower(name) {
+		case "for":
+			elem.For = value
+		case "by":
+			elem.By = value
+		case "host":
+			elem.Host = value
+		case "proto":
+			elem.Proto = value
+		}
+	}
+}
+
+// parseQuotedString parses a quoted-string starting at s[0] == '"'
+// and returns the unescaped value and the remainder after the closing quote.
+func parseQuotedString(s string) (string, string) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	// Unterminated quoted-string: consume the rest
+	return b.String(), ""
+}
+
+// forwardedNodeIP extracts the IP from a Forwarded "for"/"by" node value.
+// It reports false for obfuscated identifiers ("_hidden"), "unknown" and invalid values.
+func forwardedNodeIP(node string) (netip.Addr, bool) {
+	if node == "" || len(node) > maxIPLength {
+		return netip.Addr{}, false
+	}
+	return parseHopIP(stripIPPort(node))
+}
+
+// TrustedForwardedKeyFunc returns a KeyFunc that securely extracts the client IP
+// from the RFC 7239 Forwarded header, trusting only specific proxies.
+// It walks the "for=" chain from right to left, skipping hops that match the
+// trustedProxies list, exactly like TrustedIPKeyFunc does for X-Forwarded-For.
+// Obfuscated and "unknown" identifiers are skipped.
+//
+// Only use this if your trusted proxies set or sanitize the Forwarded header.
+// Proxies that only append X-Forwarded-For pass client-supplied Forwarded
+// headers through unchanged, which would allow spoofing.
+func TrustedForwardedKeyFunc(trustedProxies []string) (KeyFunc, error) {
+	prefixes, err := parseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(r *http.Request) string {
+		remoteIP := getRemoteIP(r)
+
+		addr, ok := parseHopIP(remoteIP)
+		if !ok || !containsAddr(prefixes, addr) {
+			return remoteIP
+		}
+
+		headers := r.Header.Values("Forwarded")
+		if len(headers) == 0 {
+			return remoteIP
+		}
+
+		elements := ParseForwarded(headers)
+		for i := len(elements) - 1; i >= 0; i-- {
+			hop, ok := forwardedNodeIP(elements[i].For)
+			if !ok {
+				continue // Skip invalid, unknown and obfuscated nodes
+			}
+			if !containsAddr(prefixes, hop) {
+				return hop.String()
+			}
+		}
+
+		// All hops are trusted, return the original client
+		for _, elem := range elements {
+			if hop, ok := forwardedNodeIP(elem.For); ok {
+				return hop.String()
+			}
+		}
+
+		return remoteIP
+	}, nil
+}
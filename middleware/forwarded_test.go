@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseForwarded(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []ForwardedElement
+	}{
+		{
+			name:   "single element",
+			values: []string{"for=192.0.2.60;proto=http;by=203.0.113.43"},
+			want:   []ForwardedElement{{For: "192.0.2.60", Proto: "http", By: "203.0.113.43"}},
+		},
+		{
+			name:   "quoted ipv6 with port",
+			values: []string{`For="[2001:db8:cafe::17]:4711"`},
+			want:   []ForwardedElement{{For: "[2001:db8:cafe::17]:4711"}},
+		},
+		{
+			name:   "multiple elements and headers",
+			values: []string{"for=192.0.2.43, for=198.51.100.17", "for=10.0.0.1;host=example.com"},
+			want: []ForwardedElement{
+				{For: "192.0.2.43"},
+				{For: "198.51.100.17"},
+				{For: "10.0.0.1", Host: "example.com"},
+			},
+		},
+		{
+			name:   "quoted value with comma and escapes",
+			values: []string{`host="a,b\"c";for=unknown, for=_hidden`},
+			want:   []ForwardedElement{{Host: `a,b"c`, For: "unknown"}, {For: "_hidden"}},
+		},
+		{
+			name:   "malformed pairs are skipped",
+			values: []string{"garbage;for=1.2.3.4"},
+			want:   []ForwardedElement{{For: "1.2.3.4"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseForwarded(tt.values)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseForwarded() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("element %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseForwarded_KeepsRightmostElements(t *testing.T) {
+	header := strings.Repeat("for=6.6.6.6, ", 100) + "for=1.2.3.4"
+	got := ParseForwarded([]string{header})
+	if len(got) != maxForwardedElements {
+		t.Fatalf("Expected %d elements, got %d", maxForwardedElements, len(got))
+	}
+	if got[len(got)-1].For != "1.2.3.4" {
+		t.Errorf("Expected rightmost element to be kept, got %q", got[len(got)-1].For)
+	}
+}
+
+func TestTrustedForwardedKeyFunc(t *testing.T) {
+	keyFunc, err := TrustedForwardedKeyFunc([]string{"10.0.0.0/8", "2001:db8:ffff::/48"})
+	if err != nil {
+		t.Fatalf("Failed to create key func: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{
+			name:       "untrusted remote ignores header",
+			remoteAddr: "203.0.113.5:1234",
+			forwarded:  []string{"for=1.1.1.1"},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "trusted remote uses client",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=198.51.100.7;proto=https"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "spoofed leftmost entry is ignored",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=1.1.1.1, for=198.51.100.7, for=10.0.0.2"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "quoted ipv6 with port",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`for="[2001:db8:cafe::17]:4711"`},
+			want:       "2001:db8:cafe::17",
+		},
+		{
+			name:       "obfuscated and unknown are skipped",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=198.51.100.7, for=unknown, for=_hidden"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "all trusted returns original client",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=10.1.1.1, for=10.2.2.2"},
+			want:       "10.1.1.1",
+		},
+		{
+			name:       "no header returns remote",
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "multiple headers",
+			remoteAddr: "[2001:db8:ffff::1]:443",
+			forwarded:  []string{"for=198.51.100.7", "for=\"[2001:db8:ffff::2]\""},
+			want:       "198.51.100.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("Forwarded", v)
+			}
+			if got := keyFunc(req); got != tt.want {
+				t.Errorf("keyFunc() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedForwardedKeyFunc_InvalidProxy(t *testing.T) {
+	if _, err := TrustedForwardedKeyFunc([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected error for invalid proxy")
+	}
+}
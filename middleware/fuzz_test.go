@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Morditux/ratelimiter/middleware/middlewaretest"
+)
+
+func FuzzFastPathClean(f *testing.F) {
+	middlewaretest.AddPaths(f)
+	f.Fuzz(func(t *testing.T, p string) {
+		if got, want := fastPathClean(p), path.Clean(p); got != want {
+			t.Errorf("fastPathClean(%q) = %q, path.Clean = %q", p, got, want)
+		}
+	})
+}
+
+func FuzzMatchPath(f *testing.F) {
+	for _, p := range middlewaretest.Paths() {
+		for _, pattern := range middlewaretest.Paths() {
+			f.Add(p, pattern)
+		}
+	}
+	f.Fuzz(func(t *testing.T, p, pattern string) {
+		want := p == pattern
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			want = strings.HasPrefix(p, prefix) ||
+				(strings.HasSuffix(prefix, "/") && p == strings.TrimSuffix(prefix, "/"))
+		}
+		if got := matchPath(p, pattern); got != want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", p, pattern, got, want)
+		}
+	})
+}
+
+func FuzzStripIPPort(f *testing.F) {
+	middlewaretest.AddAddrs(f)
+	f.Fuzz(func(t *testing.T, addr string) {
+		got := stripIPPort(addr)
+		if !strings.Contains(addr, got) {
+			t.Fatalf("stripIPPort(%q) = %q, not a substring of the input", addr, got)
+		}
+		if host, _, err := net.SplitHostPort(addr); err == nil && got != host {
+			t.Errorf("stripIPPort(%q) = %q, net.SplitHostPort = %q", addr, got, host)
+		}
+		if _, err := netip.ParseAddr(addr); err == nil && got != addr {
+			t.Errorf("stripIPPort(%q) = %q, want the bare address unchanged", addr, got)
+		}
+	})
+}
+
+// checkIPKey checks that a key extracted from a request is a canonical IP,
+// or the raw RemoteAddr fallback.
+func checkIPKey(t *testing.T, r *http.Request, key string) {
+	t.Helper()
+	if key == getRemoteIP(r) {
+		return
+	}
+	addr, err := netip.ParseAddr(key)
+	if err != nil {
+		t.Fatalf("key %q is neither an IP nor the RemoteAddr fallback", key)
+	}
+	if canonical := addr.Unmap().String(); canonical != key {
+		t.Errorf("key %q is not canonical, want %q", key, canonical)
+	}
+}
+
+func FuzzDefaultKeyFunc(f *testing.F) {
+	for _, xff := range middlewaretest.ForwardedFor() {
+		for _, addr := range middlewaretest.Addrs() {
+			f.Add(xff, addr, addr)
+		}
+	}
+	f.Fuzz(func(t *testing.T, xff, xri, remoteAddr string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		if xff != "" {
+			r.Header.Set("X-Forwarded-For", xff)
+		}
+		if xri != "" {
+			r.Header.Set("X-Real-IP", xri)
+		}
+		checkIPKey(t, r, DefaultKeyFunc(r))
+	})
+}
+
+func FuzzTrustedIPKeyFunc(f *testing.F) {
+	for _, xff := range middlewaretest.ForwardedFor() {
+		f.Add(xff, "10.0.0.1:1234")
+		f.Add(xff, "1.2.3.4:1234")
+		f.Add(xff, "[::1]:1234")
+	}
+	keyFunc, err := TrustedIPKeyFunc([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, xff, remoteAddr string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", xff)
+
+		key := keyFunc(r)
+		remote := getRemoteIP(r)
+		ip := net.ParseIP(remote)
+		trusted := ip != nil && (ip.IsLoopback() && ip.To4() == nil || ip.To4() != nil && ip.To4()[0] == 10)
+		if !trusted && key != remote {
+			t.Errorf("untrusted RemoteAddr %q: X-Forwarded-For must be ignored, got key %q", remoteAddr, key)
+		}
+		if len(key) > maxIPLength && key != remote {
+			t.Errorf("key %q longer than %d bytes", key, maxIPLength)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// WithGlobalLimit caps the total request throughput with limiter, on top of
+// the per-client limits. The limiter is always checked with
+// ratelimiter.GlobalKey, and only for requests that passed their per-client
+// limit, so that abusive clients cannot exhaust the global budget.
+//
+//	global, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1000, Window: time.Second}, s)
+//	mw := middleware.RateLimitMiddleware(perClient, middleware.WithGlobalLimit(global))
+func WithGlobalLimit(limiter ratelimiter.Limiter) Option {
+	return func(o *Options) {
+		if limiter == nil {
+			o.GlobalLimiter = nil
+			return
+		}
+		o.GlobalLimiter = ratelimiter.WithDetails(limiter)
+	}
+}
+
+// checkGlobal enforces the global limit, unless dryRun is set.
+// It returns false if the request was rejected and a response has been written.
+func checkGlobal(w http.ResponseWriter, r *http.Request, o *Options, dryRun bool) bool {
+	if o.GlobalLimiter == nil {
+		return true
+	}
+
+	result, err := o.GlobalLimiter.AllowNWithDetails(ratelimiter.GlobalKey, 1)
+	if err != nil {
+		// FAIL SECURE: the global state cannot be persisted, so we cannot enforce the limit.
+		if errors.Is(err, store.ErrStoreFull) {
+			writeError(w, "Rate limit store full", http.StatusServiceUnavailable)
+			return false
+		}
+		if errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+			writeError(w, "Request cost exceeds rate limit capacity", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		// Fail open on other errors to ensure system resilience
+		return true
+	}
+
+	if !result.Allowed && !dryRun {
+		setRetryAfter(w, ratelimiter.AddJitter(result.RetryAfter, o.RetryAfterJitter))
+		o.OnLimited(w, r)
+		return false
+	}
+
+	return true
+}
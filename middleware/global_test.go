@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRateLimitMiddleware_GlobalLimit(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	perClient, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 2, Window: time.Minute}, s)
+
+	gs := store.NewMemoryStore()
+	defer gs.Close()
+	global, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 3, Window: time.Minute}, gs)
+
+	handler := RateLimitMiddleware(perClient, WithGlobalLimit(global))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Client A uses 2, client A's third request is denied by its own limit
+	// without consuming global budget.
+	send("10.0.0.1")
+	send("10.0.0.1")
+	if rec := send("10.0.0.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected per-client limit, got %d", rec.Code)
+	}
+
+	// One global token left
+	if rec := send("10.0.0.2"); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+
+	// Global limit reached for everyone
+	rec := send("10.0.0.3")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected global limit, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on global limit")
+	}
+}
+
+func TestRouter_GlobalLimit(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	gs := store.NewMemoryStore()
+	defer gs.Close()
+	global, _ := algorithms.NewSlidingWindow(ratelimiter.Config{Rate: 3, Window: time.Minute}, gs)
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), s, []EndpointConfig{
+		{Path: "/api/*", Config: ratelimiter.Config{Rate: 10, Window: time.Minute}},
+	}, WithGlobalLimit(global))
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	// Matched and unmatched paths both count toward the global limit
+	paths := []string{"/api/a", "/other", "/api/b", "/other"}
+	want := []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, p := range paths {
+		req := httptest.NewRequest("GET", p, nil)
+		req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i+1)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want[i] {
+			t.Errorf("Request %d to %s: expected %d, got %d", i+1, p, want[i], rec.Code)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import "strings"
+
+// RouterGroup returns endpoints under a common path prefix that inherit the
+// settings of defaults they leave unset: Methods, Config or Limits,
+// Algorithm, CountStatus, KeyFunc, KeyQuery, MaxKeysPerClient, OnLimited and
+// Store or NewStore (each endpoint then creates its own store).
+// The Path of defaults is ignored.
+//
+// Groups nest, since an inner group's endpoints keep the settings they
+// inherited when passed to an outer group:
+//
+//	endpoints := middleware.RouterGroup("/api/v1", middleware.EndpointConfig{
+//		Config:  ratelimiter.Config{Rate: 100, Window: time.Minute},
+//		KeyFunc: apiKey,
+//	},
+//		middleware.EndpointConfig{Path: "/users/*"},
+//		middleware.EndpointConfig{Path: "/search", Config: ratelimiter.Config{Rate: 10, Window: time.Minute}},
+//	)
+func RouterGroup(prefix string, defaults EndpointConfig, endpoints ...EndpointConfig) []EndpointConfig {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	grouped := make([]EndpointConfig, len(endpoints))
+	for i, ep := range endpoints {
+		ep.Path = prefix + ep.Path
+		if ep.Methods == nil {
+			ep.Methods = defaults.Methods
+		}
+		if ep.Config.Rate == 0 && len(ep.Limits) == 0 {
+			ep.Config = defaults.Config
+			ep.Limits = defaults.Limits
+		}
+		if ep.Algorithm == "" {
+			ep.Algorithm = defaults.Algorithm
+		}
+		if ep.CountStatus == nil {
+			ep.CountStatus = defaults.CountStatus
+		}
+		if ep.KeyFunc == nil {
+			ep.KeyFunc = defaults.KeyFunc
+		}
+		if ep.KeyQuery == nil {
+			ep.KeyQuery = defaults.KeyQuery
+			ep.MaxQueryValues = defaults.MaxQueryValues
+		}
+		if ep.MaxKeysPerClient == 0 {
+			ep.MaxKeysPerClient = defaults.MaxKeysPerClient
+		}
+		if ep.OnLimited == nil {
+			ep.OnLimited = defaults.OnLimited
+		}
+		if ep.Store == nil && ep.NewStore == nil {
+			ep.Store, ep.NewStore = defaults.Store, defaults.NewStore
+		}
+		grouped[i] = ep
+	}
+	return grouped
+}
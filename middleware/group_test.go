@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRouterGroup_Inheritance(t *testing.T) {
+	perMinute := ratelimiter.Config{Rate: 100, Window: time.Minute}
+	strict := ratelimiter.Config{Rate: 1, Window: time.Minute}
+	keyFunc := func(r *http.Request) string { return r.Header.Get("X-API-Key") }
+
+	endpoints := RouterGroup("/api/", EndpointConfig{
+		Path:      "/ignored",
+		Config:    perMinute,
+		Algorithm: AlgorithmSlidingWindow,
+		Methods:   []string{"GET"},
+		KeyFunc:   keyFunc,
+	},
+		EndpointConfig{Path: "/users/*"},
+		EndpointConfig{Path: "/login", Config: strict, Methods: []string{"POST"}},
+		EndpointConfig{Path: "/search", Limits: []Limit{{Config: strict}}},
+	)
+
+	if len(endpoints) != 3 {
+		t.Fatalf("Expected 3 endpoints, got %d", len(endpoints))
+	}
+	users, login, search := endpoints[0], endpoints[1], endpoints[2]
+
+	if users.Path != "/api/users/*" || users.Config != perMinute || users.Algorithm != AlgorithmSlidingWindow || users.KeyFunc == nil {
+		t.Errorf("Expected /api/users/* to inherit the defaults, got %+v", users)
+	}
+	if login.Path != "/api/login" || login.Config != strict || login.Methods[0] != "POST" {
+		t.Errorf("Expected /api/login to keep its overrides, got %+v", login)
+	}
+	if search.Config.Rate != 0 || len(search.Limits) != 1 {
+		t.Errorf("Expected /api/search to keep its limits, got %+v", search)
+	}
+}
+
+func TestRouterGroup_Nested(t *testing.T) {
+	outer := ratelimiter.Config{Rate: 100, Window: time.Minute}
+	inner := ratelimiter.Config{Rate: 10, Window: time.Minute}
+
+	endpoints := RouterGroup("/api", EndpointConfig{Config: outer, Algorithm: AlgorithmSlidingWindow},
+		RouterGroup("/admin", EndpointConfig{Config: inner},
+			EndpointConfig{Path: "/*"},
+		)...,
+	)
+
+	ep := endpoints[0]
+	if ep.Path != "/api/admin/*" || ep.Config != inner || ep.Algorithm != AlgorithmSlidingWindow {
+		t.Errorf("Expected inner settings to win and unset ones to be inherited, got %+v", ep)
+	}
+}
+
+func TestRouter_EndpointKeyFuncAndOnLimited(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	limited := false
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, RouterGroup("/api", EndpointConfig{
+		Config:    ratelimiter.Config{Rate: 1, Window: time.Minute},
+		KeyFunc:   func(r *http.Request) string { return r.Header.Get("X-API-Key") },
+		OnLimited: func(w http.ResponseWriter, r *http.Request) { limited = true; w.WriteHeader(http.StatusTeapot) },
+	},
+		EndpointConfig{Path: "/*"},
+	))
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	serve := func(apiKey string) int {
+		req := httptest.NewRequest("GET", "/api/x", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Keys come from the endpoint's KeyFunc, not the shared client IP
+	if serve("a") != http.StatusOK || serve("b") != http.StatusOK {
+		t.Fatal("Expected one request per API key to be allowed")
+	}
+	if code := serve("a"); code != http.StatusTeapot || !limited {
+		t.Errorf("Expected the endpoint's OnLimited, got %d", code)
+	}
+}
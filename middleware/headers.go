@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// HeaderMode selects when X-RateLimit-* headers are written.
+type HeaderMode int
+
+const (
+	// HeadersAlways writes the headers on every rate limited request.
+	HeadersAlways HeaderMode = iota
+
+	// HeadersOnDenial writes the headers only on denied requests.
+	HeadersOnDenial
+
+	// HeadersNever never writes the headers, so that the limits are not
+	// disclosed to clients. Retry-After is still set on denied requests.
+	HeadersNever
+)
+
+// DefaultHeaderPrefix is the prefix of the rate limit headers.
+const DefaultHeaderPrefix = "X-RateLimit"
+
+// WithHeaders sets when the X-RateLimit-* headers are written.
+func WithHeaders(mode HeaderMode) Option {
+	return func(o *Options) {
+		o.HeaderMode = mode
+	}
+}
+
+// WithHeaderPrefix renames the rate limit headers, e.g. "RateLimit" writes
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset.
+func WithHeaderPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.HeaderPrefix = prefix
+	}
+}
+
+// WithHeaderFilter writes the rate limit headers only for requests for which
+// fn returns true, e.g. authenticated callers.
+func WithHeaderFilter(fn func(r *http.Request) bool) Option {
+	return func(o *Options) {
+		o.HeaderFilter = fn
+	}
+}
+
+// headerWriter writes the rate limit headers according to the options.
+type headerWriter struct {
+	mode      HeaderMode
+	filter    func(r *http.Request) bool
+	limit     string
+	remaining string
+	reset     string
+	warning   string
+}
+
+// newHeaderWriter resolves the header policy and names of o once.
+func newHeaderWriter(o *Options) headerWriter {
+	prefix := o.HeaderPrefix
+	if prefix == "" {
+		prefix = DefaultHeaderPrefix
+	}
+	return headerWriter{
+		mode:      o.HeaderMode,
+		filter:    o.HeaderFilter,
+		limit:     http.CanonicalHeaderKey(prefix + "-Limit"),
+		remaining: http.CanonicalHeaderKey(prefix + "-Remaining"),
+		reset:     http.CanonicalHeaderKey(prefix + "-Reset"),
+		warning:   http.CanonicalHeaderKey(prefix + "-Warning"),
+	}
+}
+
+// write sets the headers for result if the policy allows it. values caches
+// the rendered values of the limiter that produced result.
+func (h headerWriter) write(w http.ResponseWriter, r *http.Request, result ratelimiter.Result, values *headerValues) {
+	switch h.mode {
+	case HeadersNever:
+		return
+	case HeadersOnDenial:
+		if result.Allowed {
+			return
+		}
+	}
+	if h.filter != nil && !h.filter(r) {
+		return
+	}
+
+	// The names are canonical, so the map is written directly. Each response
+	// gets its own values, so that a handler editing one in place does not
+	// change those of other responses, in a single allocation.
+	v := make([]string, 3)
+	v[0] = values.limit.render(int64(result.Limit))
+	v[1] = headerText(int64(result.Remaining))
+	v[2] = values.reset.render(result.ResetAt.Unix())
+	header := w.Header()
+	header[h.limit] = v[0:1:1]
+	header[h.remaining] = v[1:2:2]
+	header[h.reset] = v[2:3:3]
+}
+
+// writeWarning sets the soft limit warning header to percent if the policy
+// allows it. Warnings are only written for allowed requests, so
+// HeadersOnDenial never writes them.
+func (h headerWriter) writeWarning(w http.ResponseWriter, r *http.Request, percent int) {
+	if h.mode != HeadersAlways || (h.filter != nil && !h.filter(r)) {
+		return
+	}
+	w.Header()[h.warning] = headerValue(int64(percent))
+}
+
+// smallHeaderValues are the rendered values of 0 to 99, shared by all
+// limiters.
+var smallHeaderValues = func() (v [100]string) {
+	for i := range v {
+		v[i] = strconv.Itoa(i)
+	}
+	return v
+}()
+
+// headerText renders n, allocating only if n is not small.
+func headerText(n int64) string {
+	if n >= 0 && n < int64(len(smallHeaderValues)) {
+		return smallHeaderValues[n]
+	}
+	var buf [20]byte
+	return string(strconv.AppendInt(buf[:0], n, 10))
+}
+
+// headerValue returns a new header value for n.
+func headerValue(n int64) []string {
+	return []string{headerText(n)}
+}
+
+// headerValues caches the rendered header values of a limiter: its limit
+// is constant and its reset time changes at most once per second under
+// steady traffic, so both are rendered once and reused by the responses.
+type headerValues struct {
+	limit renderedInt
+	reset renderedInt
+}
+
+// renderedInt caches the header value of the last integer rendered.
+type renderedInt struct {
+	last atomic.Pointer[renderedValue]
+}
+
+type renderedValue struct {
+	n int64
+	v string
+}
+
+// render returns the rendered n, reusing the last one if n has not changed.
+func (c *renderedInt) render(n int64) string {
+	if last := c.last.Load(); last != nil && last.n == n {
+		return last.v
+	}
+	v := headerText(n)
+	c.last.Store(&renderedValue{n: n, v: v})
+	return v
+}
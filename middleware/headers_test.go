@@ -136,3 +136,151 @@ func checkHeaderExists(t *testing.T, rec *httptest.ResponseRecorder, key string)
 		t.Errorf("Header %s missing", key)
 	}
 }
+
+func TestRateLimitMiddleware_HeaderPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		header      string
+		wantAllowed bool
+		wantDenied  bool
+	}{
+		{"always", nil, "X-RateLimit-Limit", true, true},
+		{"on denial", []Option{WithHeaders(HeadersOnDenial)}, "X-RateLimit-Limit", false, true},
+		{"never", []Option{WithHeaders(HeadersNever)}, "X-RateLimit-Limit", false, false},
+		{"prefix", []Option{WithHeaderPrefix("RateLimit")}, "RateLimit-Limit", true, true},
+		{"filter", []Option{WithHeaderFilter(func(r *http.Request) bool {
+			return r.Header.Get("Authorization") != ""
+		})}, "X-RateLimit-Limit", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			defer s.Close()
+			limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s)
+			server := RateLimitMiddleware(limiter, tt.opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for i, want := range []bool{tt.wantAllowed, tt.wantDenied} {
+				rec := httptest.NewRecorder()
+				server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if got := rec.Header().Get(tt.header) != ""; got != want {
+					t.Errorf("Request %d: %s present = %v, want %v", i+1, tt.header, got, want)
+				}
+				if i == 1 && rec.Header().Get("Retry-After") == "" {
+					t.Error("Expected Retry-After on denial regardless of header policy")
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware_HeaderFilterAuthenticated(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 5, Window: time.Minute}, s)
+	server := RateLimitMiddleware(limiter, WithHeaderFilter(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") != ""
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Header().Get("X-RateLimit-Remaining") != "4" {
+		t.Errorf("Expected headers for authenticated callers, got %v", rec.Header())
+	}
+}
+
+func TestRouter_HeaderPolicy(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	router, _ := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{
+		{Path: "/api", Config: ratelimiter.Config{Rate: 5, Window: time.Minute}},
+	}, WithHeaderPrefix("RateLimit"))
+	defer router.Close()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	if rec.Header().Get("RateLimit-Remaining") != "4" || rec.Header().Get("X-RateLimit-Remaining") != "" {
+		t.Errorf("Expected renamed headers, got %v", rec.Header())
+	}
+}
+
+func TestHeaderValues_Cached(t *testing.T) {
+	var values headerValues
+	reset := time.Now().Add(time.Minute)
+	result := ratelimiter.Result{Allowed: true, Limit: 1000, Remaining: 12345, ResetAt: reset}
+	h := newHeaderWriter(&Options{})
+
+	rec := httptest.NewRecorder()
+	h.write(rec, httptest.NewRequest("GET", "/", nil), result, &values)
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "1000" {
+		t.Errorf("Expected limit 1000, got %q", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "12345" {
+		t.Errorf("Expected remaining 12345, got %q", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Reset"); got != strconv.FormatInt(reset.Unix(), 10) {
+		t.Errorf("Expected reset %d, got %q", reset.Unix(), got)
+	}
+
+	// Adding to a shared value must not modify it for other responses
+	rec.Header().Add("X-RateLimit-Limit", "other")
+	rec = httptest.NewRecorder()
+	h.write(rec, httptest.NewRequest("GET", "/", nil), result, &values)
+	if got := rec.Header().Values("X-RateLimit-Limit"); len(got) != 1 || got[0] != "1000" {
+		t.Errorf("Expected shared limit value to be unchanged, got %q", got)
+	}
+
+	// Editing a value in place must not modify it for other responses
+	result.Remaining = 7
+	h.write(rec, httptest.NewRequest("GET", "/", nil), result, &values)
+	rec.Header()["X-Ratelimit-Remaining"][0] = "edited"
+	rec.Header()["X-Ratelimit-Limit"][0] = "edited"
+	rec = httptest.NewRecorder()
+	h.write(rec, httptest.NewRequest("GET", "/", nil), result, &values)
+	if rec.Header().Get("X-RateLimit-Limit") != "1000" || rec.Header().Get("X-RateLimit-Remaining") != "7" {
+		t.Errorf("Expected values of other responses to be unchanged, got %v", rec.Header())
+	}
+
+	// The limit and reset values are rendered once: only the values of the
+	// response allocate
+	result.Remaining = 5
+	allocs := testing.AllocsPerRun(100, func() {
+		h.write(rec, nil, result, &values)
+	})
+	if allocs != 1 {
+		t.Errorf("Expected 1 allocation, got %v", allocs)
+	}
+}
+
+func TestSetRetryAfter_Values(t *testing.T) {
+	for _, tc := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{time.Millisecond, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Hour, "3600"},
+	} {
+		rec := httptest.NewRecorder()
+		setRetryAfter(rec, tc.d)
+		if got := rec.Header().Get("Retry-After"); got != tc.want {
+			t.Errorf("Retry-After for %v: expected %q, got %q", tc.d, tc.want, got)
+		}
+	}
+}
+
+func BenchmarkHeaderWriter(b *testing.B) {
+	var values headerValues
+	h := newHeaderWriter(&Options{})
+	w := httptest.NewRecorder()
+	result := ratelimiter.Result{Allowed: true, Limit: 1000, Remaining: 999, ResetAt: time.Now().Add(time.Minute)}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		result.Remaining = i % 100
+		h.write(w, nil, result, &values)
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// DegradedMode selects how requests are handled while the limiter backend is unhealthy.
+type DegradedMode int
+
+const (
+	// DegradedFailOpen passes requests through without rate limiting.
+	DegradedFailOpen DegradedMode = iota
+
+	// DegradedFailClosed rejects requests with 503 Service Unavailable.
+	DegradedFailClosed
+)
+
+// WithHealthChecker skips the limiter while hc reports unhealthy and handles
+// requests according to mode instead. Start hc with HealthChecker.Start so
+// that the status is refreshed in the background; the middleware only reads
+// the cached status and never blocks on a probe.
+func WithHealthChecker(hc *ratelimiter.HealthChecker, mode DegradedMode) Option {
+	return func(o *Options) {
+		o.HealthChecker = hc
+		o.DegradedMode = mode
+	}
+}
+
+// serveDegraded handles the request if the health checker reports unhealthy.
+// It returns false if rate limiting should proceed normally.
+func serveDegraded(w http.ResponseWriter, r *http.Request, next http.Handler, options *Options) bool {
+	if options.HealthChecker == nil || options.HealthChecker.Healthy() {
+		return false
+	}
+
+	if options.DegradedMode == DegradedFailClosed {
+		writeError(w, "Rate limiter unavailable", http.StatusServiceUnavailable)
+		return true
+	}
+
+	next.ServeHTTP(w, r)
+	return true
+}
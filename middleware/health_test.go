@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+type downPinger struct{}
+
+func (downPinger) Ping(ctx context.Context) error { return errors.New("down") }
+
+func TestRateLimitMiddleware_DegradedMode(t *testing.T) {
+	hc := ratelimiter.NewHealthChecker()
+	hc.Register("store", downPinger{})
+	hc.Check(context.Background())
+
+	calls := 0
+	limiter := &MockLimiter{AllowFunc: func(key string) (bool, error) {
+		calls++
+		return false, nil
+	}}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		mode DegradedMode
+		want int
+	}{
+		{DegradedFailOpen, http.StatusOK},
+		{DegradedFailClosed, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		mw := RateLimitMiddleware(limiter, WithHealthChecker(hc, tt.mode))(handler)
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != tt.want {
+			t.Errorf("mode %d: expected %d, got %d", tt.mode, tt.want, rec.Code)
+		}
+	}
+
+	if calls != 0 {
+		t.Errorf("Expected limiter to be skipped while unhealthy, got %d calls", calls)
+	}
+}
+
+func TestRouter_DegradedMode(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	hc := ratelimiter.NewHealthChecker()
+	hc.Register("store", downPinger{})
+	hc.Check(context.Background())
+
+	router, err := NewRouter(http.NotFoundHandler(), s, []EndpointConfig{
+		{Path: "/", Config: ratelimiter.Config{Rate: 1, Window: time.Minute}},
+	}, WithHealthChecker(hc, DegradedFailClosed))
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rec.Code)
+	}
+	if s.Len() != 0 {
+		t.Error("Expected the store not to be used while unhealthy")
+	}
+}
@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// WithHistory records the recent decisions of the middleware in h.
+// RateLimitMiddleware records them under the endpoint "*", a Router under
+// the path of each endpoint. Keys are recorded as returned by the key
+// function, without the endpoint scope.
+func WithHistory(h *History) Option {
+	return func(o *Options) {
+		o.History = h
+	}
+}
+
+// HistoryConfig configures a History.
+type HistoryConfig struct {
+	// Size is the number of decisions kept per key and per endpoint.
+	// Default: 64.
+	Size int
+
+	// MaxKeys is the number of keys whose history is kept. Past it, the
+	// history of the least recently seen key is dropped.
+	// Default: 10000.
+	MaxKeys int
+}
+
+// HistoryEntry is a recorded rate limit decision.
+type HistoryEntry struct {
+	Time      time.Time `json:"time"`
+	Endpoint  string    `json:"endpoint"`
+	Key       string    `json:"key"`
+	Allowed   bool      `json:"allowed"`
+	Remaining int       `json:"remaining"`
+}
+
+// History keeps the last decisions of each key and each endpoint in ring
+// buffers, so support engineers can answer "was customer X limited at
+// 14:03?" without logging every request. Unlike Monitor and Auditor it
+// keeps raw keys: expose Handler on an internal listener only.
+type History struct {
+	config HistoryConfig
+	now    func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]*list.Element // Values are *keyHistory
+	lru       *list.List               // Most recently seen key first
+	endpoints map[string]*historyRing
+}
+
+// keyHistory is the history of a key, an element of History.lru.
+type keyHistory struct {
+	key  string
+	ring *historyRing
+}
+
+// historyRing is a ring buffer of decisions.
+type historyRing struct {
+	entries []HistoryEntry
+	next    int
+	full    bool
+}
+
+func newHistoryRing(size int) *historyRing {
+	return &historyRing{entries: make([]HistoryEntry, size)}
+}
+
+func (r *historyRing) add(e HistoryEntry) {
+	r.entries[r.next] = e
+	r.next++
+	if r.next == len(r.entries) {
+		r.next, r.full = 0, true
+	}
+}
+
+// list returns the entries, oldest first.
+func (r *historyRing) list() []HistoryEntry {
+	if !r.full {
+		return append([]HistoryEntry(nil), r.entries[:r.next]...)
+	}
+	out := make([]HistoryEntry, 0, len(r.entries))
+	out = append(out, r.entries[r.next:]...)
+	return append(out, r.entries[:r.next]...)
+}
+
+// NewHistory creates a history recorder.
+func NewHistory(config HistoryConfig) *History {
+	if config.Size <= 0 {
+		config.Size = 64
+	}
+	if config.MaxKeys <= 0 {
+		config.MaxKeys = 10000
+	}
+	return &History{
+		config:    config,
+		now:       time.Now,
+		keys:      make(map[string]*list.Element),
+		lru:       list.New(),
+		endpoints: make(map[string]*historyRing),
+	}
+}
+
+// record adds a decision for key on endpoint.
+func (h *History) record(endpoint, key string, result ratelimiter.Result) {
+	e := HistoryEntry{
+		Time:      h.now(),
+		Endpoint:  endpoint,
+		Key:       key,
+		Allowed:   result.Allowed,
+		Remaining: result.Remaining,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ring, ok := h.endpoints[endpoint]
+	if !ok {
+		ring = newHistoryRing(h.config.Size)
+		h.endpoints[endpoint] = ring
+	}
+	ring.add(e)
+
+	if el, ok := h.keys[key]; ok {
+		h.lru.MoveToFront(el)
+		el.Value.(*keyHistory).ring.add(e)
+		return
+	}
+	kh := &keyHistory{key: key}
+	if h.lru.Len() >= h.config.MaxKeys {
+		// Reuse the ring of the least recently seen key
+		oldest := h.lru.Back()
+		evicted := h.lru.Remove(oldest).(*keyHistory)
+		delete(h.keys, evicted.key)
+		kh.ring = evicted.ring
+		kh.ring.next, kh.ring.full = 0, false
+	} else {
+		kh.ring = newHistoryRing(h.config.Size)
+	}
+	kh.ring.add(e)
+	h.keys[key] = h.lru.PushFront(kh)
+}
+
+// Key returns the recorded decisions of key, oldest first.
+func (h *History) Key(key string) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	el, ok := h.keys[key]
+	if !ok {
+		return nil
+	}
+	return el.Value.(*keyHistory).ring.list()
+}
+
+// Endpoint returns the recorded decisions on endpoint, oldest first.
+func (h *History) Endpoint(endpoint string) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ring, ok := h.endpoints[endpoint]
+	if !ok {
+		return nil
+	}
+	return ring.list()
+}
+
+// Handler returns an HTTP handler serving the history of the key or
+// endpoint named by the "key" or "endpoint" query parameter as JSON,
+// optionally restricted to decisions at or after "since" and before
+// "until" (RFC 3339 times). It exposes raw keys: mount it on an internal
+// listener or behind authentication.
+func (h *History) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var since, until time.Time
+		for name, t := range map[string]*time.Time{"since": &since, "until": &until} {
+			if v := q.Get(name); v != "" {
+				parsed, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					writeError(w, "Invalid "+name+" time", http.StatusBadRequest)
+					return
+				}
+				*t = parsed
+			}
+		}
+
+		var entries []HistoryEntry
+		switch {
+		case q.Has("key"):
+			entries = h.Key(q.Get("key"))
+		case q.Has("endpoint"):
+			entries = h.Endpoint(q.Get("endpoint"))
+		default:
+			writeError(w, "Missing key or endpoint parameter", http.StatusBadRequest)
+			return
+		}
+
+		filtered := entries[:0]
+		for _, e := range entries {
+			if (since.IsZero() || !e.Time.Before(since)) && (until.IsZero() || e.Time.Before(until)) {
+				filtered = append(filtered, e)
+			}
+		}
+		if filtered == nil {
+			filtered = []HistoryEntry{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(filtered)
+	})
+}
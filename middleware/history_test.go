@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestHistory_Router(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	history := NewHistory(HistoryConfig{})
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{{
+		Path:   "/api/*",
+		Config: ratelimiter.Config{Rate: 2, Window: time.Minute},
+	}}, WithHistory(history))
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/api/x", nil)
+		req.RemoteAddr = "192.168.1.1:1"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	entries := history.Key("192.168.1.1")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if !entries[0].Allowed || !entries[1].Allowed || entries[2].Allowed {
+		t.Errorf("Expected allowed, allowed, denied, got %+v", entries)
+	}
+	if entries[2].Endpoint != "/api/*" {
+		t.Errorf("Expected endpoint /api/*, got %q", entries[2].Endpoint)
+	}
+	if n := len(history.Endpoint("/api/*")); n != 3 {
+		t.Errorf("Expected 3 endpoint entries, got %d", n)
+	}
+}
+
+func TestHistory_Ring(t *testing.T) {
+	h := NewHistory(HistoryConfig{Size: 3})
+	for i := 0; i < 5; i++ {
+		h.record("*", "k", ratelimiter.Result{Remaining: i})
+	}
+
+	entries := h.Key("k")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.Remaining != i+2 {
+			t.Errorf("Entry %d: expected Remaining %d, got %d", i, i+2, e.Remaining)
+		}
+	}
+}
+
+func TestHistory_MaxKeys(t *testing.T) {
+	h := NewHistory(HistoryConfig{Size: 2, MaxKeys: 2})
+	h.record("*", "a", ratelimiter.Result{})
+	h.record("*", "b", ratelimiter.Result{})
+	h.record("*", "a", ratelimiter.Result{})
+	h.record("*", "c", ratelimiter.Result{})
+
+	if h.Key("b") != nil {
+		t.Error("Expected the least recently seen key to be dropped")
+	}
+	if len(h.Key("a")) != 2 || len(h.Key("c")) != 1 {
+		t.Errorf("Unexpected histories: a=%v c=%v", h.Key("a"), h.Key("c"))
+	}
+}
+
+func TestHistory_Handler(t *testing.T) {
+	now := time.Date(2025, 1, 1, 14, 0, 0, 0, time.UTC)
+	h := NewHistory(HistoryConfig{})
+	h.now = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		h.record("/login", "customer-x", ratelimiter.Result{Allowed: i < 3})
+		now = now.Add(time.Minute)
+	}
+
+	get := func(query url.Values) (int, []HistoryEntry) {
+		rec := httptest.NewRecorder()
+		h.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/history?"+query.Encode(), nil))
+		var entries []HistoryEntry
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+		}
+		return rec.Code, entries
+	}
+
+	// Was customer X limited at 14:03?
+	code, entries := get(url.Values{"key": {"customer-x"}, "since": {"2025-01-01T14:03:00Z"}, "until": {"2025-01-01T14:04:00Z"}})
+	if code != http.StatusOK || len(entries) != 1 || entries[0].Allowed {
+		t.Errorf("Expected one denied entry, got %d %+v", code, entries)
+	}
+
+	if _, entries := get(url.Values{"endpoint": {"/login"}}); len(entries) != 5 {
+		t.Errorf("Expected 5 endpoint entries, got %d", len(entries))
+	}
+	if _, entries := get(url.Values{"key": {"unknown"}}); entries == nil || len(entries) != 0 {
+		t.Errorf("Expected an empty list for unknown keys, got %v", entries)
+	}
+	for _, query := range []url.Values{{}, {"key": {"k"}, "since": {"yesterday"}}} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", query, code)
+		}
+	}
+}
+
+func BenchmarkHistory_Record(b *testing.B) {
+	h := NewHistory(HistoryConfig{MaxKeys: 1000})
+	keys := make([]string, 2000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.record("*", keys[i%len(keys)], ratelimiter.Result{})
+	}
+}
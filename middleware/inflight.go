@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// WithMaxInFlight caps the number of requests per key being handled at the
+// same time, on top of the rate limit. Requests over the cap are rejected
+// with OnLimited (and a Retry-After of 1 second) before the limiter is
+// checked, so they do not consume rate limit budget.
+//
+// The cap is enforced in memory, per middleware instance; only the rate
+// limit uses the store. Used by RateLimitMiddleware.
+func WithMaxInFlight(n int) Option {
+	return func(o *Options) {
+		o.MaxInFlight = n
+	}
+}
+
+// ConcurrencyLimitMiddleware creates a middleware enforcing both a rate
+// limit and a cap of maxInFlight concurrent requests per key in one pass,
+// with a single key extraction. It is RateLimitMiddleware with
+// WithMaxInFlight(maxInFlight).
+func ConcurrencyLimitMiddleware(limiter ratelimiter.Limiter, maxInFlight int, opts ...Option) func(http.Handler) http.Handler {
+	return RateLimitMiddleware(limiter, append(opts, WithMaxInFlight(maxInFlight))...)
+}
+
+// inFlightRetryAfter is the Retry-After sent when the in-flight cap is reached.
+const inFlightRetryAfter = time.Second
+
+// keyCounter counts concurrent holders per key, up to max.
+type keyCounter struct {
+	max int
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+// newKeyCounter creates a counter allowing max holders per key.
+func newKeyCounter(max int) *keyCounter {
+	return &keyCounter{max: max, active: make(map[string]int)}
+}
+
+// acquire takes a slot for key if one is free.
+func (c *keyCounter) acquire(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active[key] >= c.max {
+		return false
+	}
+	c.active[key]++
+	return true
+}
+
+// release frees a slot for key.
+func (c *keyCounter) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active[key] <= 1 {
+		delete(c.active, key)
+		return
+	}
+	c.active[key]--
+}
+
+// count returns the number of slots held for key.
+func (c *keyCounter) count(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active[key]
+}
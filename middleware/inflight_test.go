@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 10, Window: time.Minute}, s)
+
+	var keyCalls atomic.Int32
+	keyFunc := func(r *http.Request) string {
+		keyCalls.Add(1)
+		return "client"
+	}
+
+	var entered atomic.Int32
+	release := make(chan struct{})
+	handler := ConcurrencyLimitMiddleware(limiter, 2, WithKeyFunc(keyFunc))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entered.Add(1)
+			<-release
+		}),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+	waitUntil(t, func() bool { return entered.Load() == 2 })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 over the in-flight cap, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", got)
+	}
+	if got := keyCalls.Load(); got != 3 {
+		t.Errorf("Expected one key extraction per request, got %d calls", got)
+	}
+
+	close(release)
+	wg.Wait()
+
+	// The rejected request did not consume a token: 10 - 2 remain
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 once slots are released, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "7" {
+		t.Errorf("Expected 7 remaining, got %q", got)
+	}
+}
+
+func TestWithMaxInFlight_ReleasesOnRateLimit(t *testing.T) {
+	limiter := &MockLimiter{AllowFunc: func(key string) (bool, error) { return false, nil }}
+	handler := RateLimitMiddleware(limiter, WithMaxInFlight(1))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	// Rate limited requests must give their slot back
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("Request %d: expected 429, got %d", i+1, rec.Code)
+		}
+		if got := rec.Header().Get("Retry-After"); got == "1" {
+			t.Fatalf("Request %d: rejected by the in-flight cap instead of the limiter", i+1)
+		}
+	}
+}
+
+func TestKeyCounter(t *testing.T) {
+	c := newKeyCounter(2)
+	if !c.acquire("k") || !c.acquire("k") {
+		t.Fatal("Expected two slots")
+	}
+	if c.acquire("k") {
+		t.Fatal("Expected third acquire to fail")
+	}
+	if !c.acquire("other") {
+		t.Fatal("Expected slots to be per key")
+	}
+	c.release("k")
+	if got := c.count("k"); got != 1 {
+		t.Errorf("Expected 1 active, got %d", got)
+	}
+	c.release("k")
+	if _, ok := c.active["k"]; ok {
+		t.Error("Expected released keys to be removed")
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// WithIPv4Prefix masks IPv4 client keys to the given prefix length (e.g. 24)
+// so that all clients in the same subnet share a rate limit.
+// A value of 0 or 32 disables masking.
+func WithIPv4Prefix(bits int) Option {
+	return func(o *Options) {
+		o.IPv4Prefix = bits
+	}
+}
+
+// WithIPv6Prefix masks IPv6 client keys to the given prefix length (e.g. 64)
+// so that a client cannot evade per-IP limits by rotating addresses within
+// its allocation. A value of 0 or 128 disables masking.
+func WithIPv6Prefix(bits int) Option {
+	return func(o *Options) {
+		o.IPv6Prefix = bits
+	}
+}
+
+// MaskIPKeyFunc wraps fn so that keys which are IP addresses are masked to
+// the given IPv4/IPv6 prefix lengths. Keys that are not IP addresses are
+// returned unchanged. Masked keys use CIDR notation (e.g. "2001:db8::/64").
+// Prefix lengths outside (0, 32) for IPv4 and (0, 128) for IPv6 disable
+// masking for that address family.
+func MaskIPKeyFunc(fn KeyFunc, ipv4Bits, ipv6Bits int) KeyFunc {
+	if ipv4Bits <= 0 || ipv4Bits >= 32 {
+		ipv4Bits = 0
+	}
+	if ipv6Bits <= 0 || ipv6Bits >= 128 {
+		ipv6Bits = 0
+	}
+	if ipv4Bits == 0 && ipv6Bits == 0 {
+		return fn
+	}
+
+	return func(r *http.Request) string {
+		key := fn(r)
+		addr, err := netip.ParseAddr(key)
+		if err != nil {
+			return key
+		}
+		addr = addr.Unmap()
+
+		bits := ipv6Bits
+		if addr.Is4() {
+			bits = ipv4Bits
+		}
+		if bits == 0 {
+			return key
+		}
+
+		prefix, err := addr.WithZone("").Prefix(bits)
+		if err != nil {
+			return key
+		}
+		return prefix.String()
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestMaskIPKeyFunc(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		ipv4Bits int
+		ipv6Bits int
+		want     string
+	}{
+		{"ipv6 /64", "2001:db8:1:2:3:4:5:6", 0, 64, "2001:db8:1:2::/64"},
+		{"ipv6 /48", "2001:db8:1:2::1", 0, 48, "2001:db8:1::/48"},
+		{"ipv4 /24", "192.168.1.77", 24, 64, "192.168.1.0/24"},
+		{"ipv4 unmasked", "192.168.1.77", 0, 64, "192.168.1.77"},
+		{"ipv6 unmasked", "2001:db8::1", 24, 0, "2001:db8::1"},
+		{"ipv4-mapped ipv6", "::ffff:10.1.2.3", 16, 64, "10.1.0.0/16"},
+		{"full ipv6 length disables masking", "2001:db8::1", 0, 128, "2001:db8::1"},
+		{"non-ip key", "user:42", 24, 64, "user:42"},
+		{"zoned ipv6", "fe80::1%eth0", 0, 64, "fe80::/64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := MaskIPKeyFunc(func(r *http.Request) string { return tt.key }, tt.ipv4Bits, tt.ipv6Bits)
+			if got := fn(httptest.NewRequest("GET", "/", nil)); got != tt.want {
+				t.Errorf("MaskIPKeyFunc() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware_IPv6Prefix(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{
+		Rate:   2,
+		Window: time.Minute,
+	}, s)
+
+	handler := RateLimitMiddleware(limiter, WithIPv6Prefix(64))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Rotating addresses within the same /64 shares one bucket
+	addrs := []string{"[2001:db8::1]:1234", "[2001:db8::2]:1234", "[2001:db8::ffff]:1234"}
+	want := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, addr := range addrs {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want[i] {
+			t.Errorf("Request from %s: expected %d, got %d", addr, want[i], rec.Code)
+		}
+	}
+
+	// A different /64 has its own bucket
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "[2001:db8:0:1::1]:1234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for different subnet, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRateLimitMiddleware_RetryAfterJitter(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	limiter, _ := algorithms.NewSlidingWindow(ratelimiter.Config{
+		Rate:   1,
+		Window: 10 * time.Second,
+	}, s)
+
+	handler := RateLimitMiddleware(limiter, WithRetryAfterJitter(30*time.Second))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if i == 0 {
+			continue
+		}
+
+		v := rec.Header().Get("Retry-After")
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			t.Fatalf("Invalid Retry-After %q", v)
+		}
+		if seconds < 10 || seconds > 40 {
+			t.Fatalf("Retry-After out of bounds: %d", seconds)
+		}
+		seen[v] = true
+	}
+	if len(seen) < 2 {
+		t.Error("Expected Retry-After values to be jittered")
+	}
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// KeyExtractor extracts the rate limit key of a request. CompileKey builds
+// one from a KeyConfig; KeyFunc adapts a function.
+type KeyExtractor interface {
+	Key(r *http.Request) string
+}
+
+// Key calls f(r).
+func (f KeyFunc) Key(r *http.Request) string {
+	return f(r)
+}
+
+// WithKeyExtractor sets the key extraction to e.
+func WithKeyExtractor(e KeyExtractor) Option {
+	return func(o *Options) {
+		o.KeyFunc = e.Key
+	}
+}
+
+// KeyConfig describes how CompileKey extracts keys.
+type KeyConfig struct {
+	// Headers are read in order; the first one set gives the key, as
+	// "Name=value" so that it cannot collide with client IPs (e.g.
+	// "X-Api-Key"). Requests without any of them are keyed by client IP.
+	Headers []string
+
+	// TrustedProxies are the proxies whose X-Forwarded-For entries are
+	// trusted to find the client IP, like TrustedIPKeyFunc. Without
+	// trusted proxies, the client IP is the address of the connection and
+	// forwarding headers are ignored.
+	TrustedProxies []netip.Prefix
+
+	// IPv4Prefix and IPv6Prefix mask client IPs, like MaskIPKeyFunc.
+	// Default: 0 (no masking).
+	IPv4Prefix int
+	IPv6Prefix int
+
+	// Hash replaces keys with the first 16 hex digits of their SHA-256,
+	// bounding their size in the store and keeping raw API keys out of it.
+	Hash bool
+}
+
+// compiledKey is the KeyExtractor built by CompileKey.
+type compiledKey struct {
+	headers    []string // Canonical names
+	prefixes   []netip.Prefix
+	ipv4Bits   int
+	ipv6Bits   int
+	hash       bool
+	maskIPs    bool
+	resolveXFF bool
+}
+
+// CompileKey validates config and builds a KeyExtractor doing in one pass
+// what layered KeyFuncs (a header lookup falling back to TrustedIPKeyFunc,
+// wrapped by MaskIPKeyFunc and a hash) do with one closure per layer: header
+// names are canonicalized and prefixes normalized once, and client IPs are
+// parsed once and masked without being formatted in between.
+func CompileKey(config KeyConfig) (KeyExtractor, error) {
+	k := &compiledKey{
+		prefixes:   normalizePrefixes(config.TrustedProxies),
+		ipv4Bits:   config.IPv4Prefix,
+		ipv6Bits:   config.IPv6Prefix,
+		hash:       config.Hash,
+		resolveXFF: len(config.TrustedProxies) > 0,
+	}
+	for _, name := range config.Headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return nil, fmt.Errorf("middleware: invalid key header %q", name)
+		}
+		k.headers = append(k.headers, http.CanonicalHeaderKey(name))
+	}
+	for _, p := range config.TrustedProxies {
+		if !p.IsValid() {
+			return nil, fmt.Errorf("middleware: invalid trusted proxy prefix %v", p)
+		}
+	}
+	if k.ipv4Bits < 0 || k.ipv4Bits > 32 || k.ipv6Bits < 0 || k.ipv6Bits > 128 {
+		return nil, fmt.Errorf("middleware: invalid IP prefix lengths %d and %d", k.ipv4Bits, k.ipv6Bits)
+	}
+	if k.ipv4Bits == 32 {
+		k.ipv4Bits = 0
+	}
+	if k.ipv6Bits == 128 {
+		k.ipv6Bits = 0
+	}
+	k.maskIPs = k.ipv4Bits > 0 || k.ipv6Bits > 0
+	return k, nil
+}
+
+// Key extracts the key of r.
+func (k *compiledKey) Key(r *http.Request) string {
+	for _, name := range k.headers {
+		// Direct map access: the name is already canonical
+		if v := r.Header[name]; len(v) > 0 && v[0] != "" {
+			if k.hash {
+				var buf [256]byte
+				return k.finish(append(append(append(buf[:0], name...), '='), v[0]...))
+			}
+			return name + "=" + v[0]
+		}
+	}
+
+	var addr netip.Addr
+	var s string
+	if k.resolveXFF {
+		addr, s = trustedXFFAddr(r, k.prefixes)
+	} else {
+		s = getRemoteIP(r)
+		addr, _ = parseHopIP(s)
+	}
+
+	if k.maskIPs && addr.IsValid() {
+		bits := k.ipv6Bits
+		if addr.Is4() {
+			bits = k.ipv4Bits
+		}
+		if bits > 0 {
+			prefix, _ := addr.Prefix(bits)
+			var buf [64]byte
+			return k.finish(prefix.AppendTo(buf[:0]))
+		}
+	}
+	if addr.IsValid() {
+		s = addrString(addr, s)
+	}
+	if k.hash {
+		return hashKey(s)
+	}
+	return s
+}
+
+// finish returns the key b, hashed like hashKey if configured.
+func (k *compiledKey) finish(b []byte) string {
+	if k.hash {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:8])
+	}
+	return string(b)
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestCompileKey(t *testing.T) {
+	k, err := CompileKey(KeyConfig{
+		Headers:        []string{"x-api-key"},
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		IPv4Prefix:     24,
+		IPv6Prefix:     64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, remote, xff, apiKey, want string
+	}{
+		{"header", "10.0.0.1:1", "203.0.113.7", "secret", "X-Api-Key=secret"},
+		{"trusted ipv4", "10.0.0.1:1", "203.0.113.7, 10.0.0.2", "", "203.0.113.0/24"},
+		{"trusted ipv6", "10.0.0.1:1", "2001:db8:1:2:3::1", "", "2001:db8:1:2::/64"},
+		{"untrusted", "198.51.100.9:1", "203.0.113.7", "", "198.51.100.0/24"},
+		{"invalid remote", "garbage", "", "", "garbage"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.apiKey != "" {
+			req.Header.Set("X-API-Key", tc.apiKey)
+		}
+		if got := k.Key(req); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCompileKey_MatchesLayeredKeyFuncs(t *testing.T) {
+	trusted, _ := TrustedIPKeyFunc([]string{"10.0.0.0/8"})
+	layered := MaskIPKeyFunc(trusted, 24, 64)
+	compiled, _ := CompileKey(KeyConfig{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		IPv4Prefix:     24,
+		IPv6Prefix:     64,
+	})
+
+	for _, xff := range []string{"203.0.113.7", "::ffff:203.0.113.7", "2001:DB8::1", "bogus, 10.0.0.3", "10.0.0.2, 10.0.0.3", ""} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1"
+		req.Header.Set("X-Forwarded-For", xff)
+		if got, want := compiled.Key(req), layered(req); got != want {
+			t.Errorf("%q: compiled %q, layered %q", xff, got, want)
+		}
+	}
+}
+
+func TestCompileKey_Hash(t *testing.T) {
+	k, _ := CompileKey(KeyConfig{Headers: []string{"X-Api-Key"}, Hash: true})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Api-Key", "secret")
+	if got, want := k.Key(req), hashKey("X-Api-Key=secret"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1"
+	if got, want := k.Key(req), hashKey("192.0.2.1"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCompileKey_Invalid(t *testing.T) {
+	for _, config := range []KeyConfig{
+		{Headers: []string{""}},
+		{Headers: []string{"X-Api-Key:"}},
+		{TrustedProxies: []netip.Prefix{{}}},
+		{IPv4Prefix: 33},
+		{IPv6Prefix: -1},
+	} {
+		if _, err := CompileKey(config); err == nil {
+			t.Errorf("%+v: expected an error", config)
+		}
+	}
+}
+
+func TestWithKeyExtractor(t *testing.T) {
+	o := &Options{}
+	WithKeyExtractor(KeyFunc(func(r *http.Request) string { return "k" }))(o)
+	if got := o.KeyFunc(httptest.NewRequest("GET", "/", nil)); got != "k" {
+		t.Errorf("got %q, want k", got)
+	}
+}
+
+// Key extraction behind a proxy with IPv6 /64 masking, as layered KeyFuncs
+// and compiled.
+func newMaskedKeyRequest() *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("X-Forwarded-For", "2001:db8:1:2:3::1, 10.0.0.2")
+	return req
+}
+
+func BenchmarkKeyFunc_Layered(b *testing.B) {
+	trusted, _ := TrustedIPKeyFunc([]string{"10.0.0.0/8"})
+	keyFunc := MaskIPKeyFunc(trusted, 24, 64)
+	req := newMaskedKeyRequest()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		keyFunc(req)
+	}
+}
+
+func BenchmarkKeyFunc_Compiled(b *testing.B) {
+	k, _ := CompileKey(KeyConfig{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		IPv4Prefix:     24,
+		IPv6Prefix:     64,
+	})
+	req := newMaskedKeyRequest()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		k.Key(req)
+	}
+}
+
+// Hashed API key extraction, as layered KeyFuncs and compiled.
+func BenchmarkKeyFunc_LayeredHash(b *testing.B) {
+	header := headerKeyFunc("X-Api-Key")
+	keyFunc := func(r *http.Request) string { return hashKey(header(r)) }
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Api-Key", "0123456789abcdef0123456789abcdef")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		keyFunc(req)
+	}
+}
+
+func BenchmarkKeyFunc_CompiledHash(b *testing.B) {
+	k, _ := CompileKey(KeyConfig{Headers: []string{"X-Api-Key"}, Hash: true})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Api-Key", "0123456789abcdef0123456789abcdef")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		k.Key(req)
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+)
+
+// ErrUnknownEndpoint is returned by Router.SetBlocked for paths that are not
+// the Path of any endpoint.
+var ErrUnknownEndpoint = errors.New("middleware: unknown endpoint")
+
+// SetBlocked puts the endpoints whose EndpointConfig.Path is endpointPath
+// (e.g. "/api/search" or "/api/reports/*") in or out of maintenance. While
+// blocked, every request matching them gets the OnLimited response of the
+// endpoint without touching the store, to shed the load of expensive
+// endpoints during incidents. Blocked requests are counted as
+// denied by the Monitor. Blocking applies even in dry run and while the
+// Switch is off: it is an explicit decision of the operator.
+func (r *Router) SetBlocked(endpointPath string, blocked bool) error {
+	endpointPath = path.Clean(endpointPath)
+	found := false
+	for i := range r.endpoints {
+		if r.endpoints[i].config.Path == endpointPath {
+			r.endpoints[i].blocked.Store(blocked)
+			found = true
+		}
+	}
+	if !found {
+		return ErrUnknownEndpoint
+	}
+	return nil
+}
+
+// Blocked returns the paths of the blocked endpoints, in matching order.
+func (r *Router) Blocked() []string {
+	paths := []string{}
+	for i := range r.endpoints {
+		ep := &r.endpoints[i]
+		if ep.blocked.Load() && !slices.Contains(paths, ep.config.Path) {
+			paths = append(paths, ep.config.Path)
+		}
+	}
+	return paths
+}
+
+// maintenanceStatus is the JSON representation of the blocked endpoints.
+type maintenanceStatus struct {
+	Blocked []string `json:"blocked"`
+}
+
+// MaintenanceHandler returns an HTTP handler for admin APIs: GET lists the
+// blocked endpoints as JSON ({"blocked": ["/api/search"]}); POST blocks or
+// unblocks the endpoint named by the "endpoint" query or form parameter
+// according to the "blocked" parameter (e.g. POST
+// /ratelimit/maintenance?endpoint=/api/search&blocked=true) and lists the
+// blocked endpoints. Mount it on an internal listener or behind
+// authentication.
+func (r *Router) MaintenanceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			blocked, err := strconv.ParseBool(req.FormValue("blocked"))
+			if err != nil {
+				writeError(w, "Invalid blocked parameter", http.StatusBadRequest)
+				return
+			}
+			if err := r.SetBlocked(req.FormValue("endpoint"), blocked); err != nil {
+				writeError(w, "Unknown endpoint", http.StatusNotFound)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(maintenanceStatus{Blocked: r.Blocked()})
+	})
+}
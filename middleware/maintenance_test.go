@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRouter_SetBlocked(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	config := ratelimiter.Config{Rate: 100, Window: time.Minute}
+	endpoints := []EndpointConfig{
+		{Path: "/api/search", Config: config},
+		{Path: "/api/reports/*", Config: config},
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router, err := NewRouter(ok, s, endpoints, WithSwitch(NewSwitch()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := router.SetBlocked("/api/reports/*", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.SetBlocked("/api/unknown", true); err != ErrUnknownEndpoint {
+		t.Errorf("SetBlocked(unknown) = %v, want ErrUnknownEndpoint", err)
+	}
+	router.SetEnabled(false) // blocking ignores the kill switch
+
+	for target, want := range map[string]int{
+		"/api/search":      http.StatusOK,
+		"/api/reports/q1":  http.StatusTooManyRequests,
+		"//api/reports/q1": http.StatusTooManyRequests,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Errorf("%s: status %d, want %d", target, rec.Code, want)
+		}
+	}
+
+	router.SetBlocked("/api/reports/*", false)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/reports/q1", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 after unblocking, got %d", rec.Code)
+	}
+}
+
+func TestRouter_MaintenanceHandler(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	endpoints := []EndpointConfig{{Path: "/api/search", Config: ratelimiter.Config{Rate: 1, Window: time.Minute}}}
+	router, _ := NewRouter(http.NotFoundHandler(), s, endpoints)
+	h := router.MaintenanceHandler()
+
+	for _, tc := range []struct {
+		method, target string
+		code           int
+		blocked        []string
+	}{
+		{http.MethodGet, "/", http.StatusOK, []string{}},
+		{http.MethodPost, "/?endpoint=/api/search&blocked=true", http.StatusOK, []string{"/api/search"}},
+		{http.MethodPost, "/?endpoint=/api/other&blocked=true", http.StatusNotFound, nil},
+		{http.MethodPost, "/?endpoint=/api/search&blocked=soon", http.StatusBadRequest, nil},
+		{http.MethodPut, "/", http.StatusMethodNotAllowed, nil},
+		{http.MethodPost, "/?endpoint=/api/search&blocked=false", http.StatusOK, []string{}},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.target, rec.Code, tc.code)
+			continue
+		}
+		if tc.blocked != nil {
+			var status maintenanceStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil || !slices.Equal(status.Blocked, tc.blocked) {
+				t.Errorf("%s %s: body %+v (err %v), want %v", tc.method, tc.target, status, err, tc.blocked)
+			}
+		}
+	}
+}
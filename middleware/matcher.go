@@ -0,0 +1,287 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// endpointMatcher finds the endpoint of a request in time proportional to
+// the length of its path, whatever the number of endpoints.
+//
+// Exact paths come first, then templated paths (with {param} segments),
+// preferring literal segments over parameters from left to right, then
+// wildcard paths from the longest to the shortest. For each path the
+// endpoints are tried in their sorted order (see NewRouter) until one
+// accepts the request (see endpointLimiter.accepts).
+type endpointMatcher struct {
+	endpoints []endpointLimiter
+	exact     map[string][]int // Endpoint indexes by exact path
+	templates *segmentNode     // Endpoint indexes by templated path, nil if none
+	wildcards *trieNode        // Endpoint indexes by wildcard prefix (path without *)
+}
+
+// segmentNode is a node of a tree of templated paths, one segment per level.
+type segmentNode struct {
+	literals  map[string]*segmentNode
+	param     *segmentNode // Child for a {param} segment
+	endpoints []int        // Endpoints whose path ends at this node
+}
+
+// trieNode is a node of a radix tree of wildcard prefixes. The prefix of a
+// node is the concatenation of the labels from the root.
+type trieNode struct {
+	label     string
+	children  []*trieNode // Labels start with distinct bytes
+	endpoints []int       // Endpoints whose prefix ends at this node
+}
+
+// newEndpointMatcher indexes endpoints, which must be sorted by specificity.
+func newEndpointMatcher(endpoints []endpointLimiter) *endpointMatcher {
+	m := &endpointMatcher{
+		endpoints: endpoints,
+		exact:     make(map[string][]int),
+		wildcards: &trieNode{},
+	}
+	for i, ep := range endpoints {
+		if prefix, ok := strings.CutSuffix(ep.config.Path, "*"); ok {
+			m.wildcards.insert(prefix, i)
+		} else if isTemplatePath(ep.config.Path) {
+			if m.templates == nil {
+				m.templates = &segmentNode{}
+			}
+			m.templates.insert(strings.TrimPrefix(ep.config.Path, "/"), i)
+		} else {
+			m.exact[ep.config.Path] = append(m.exact[ep.config.Path], i)
+		}
+	}
+	return m
+}
+
+// match returns the endpoint of a request, or nil if none matches.
+func (m *endpointMatcher) match(cleanPath string, req *http.Request) *endpointLimiter {
+	i := m.pick(m.exact[cleanPath], req)
+	if i < 0 && m.templates != nil {
+		i = m.templates.lookup(m, strings.TrimPrefix(cleanPath, "/"), req)
+	}
+	if i < 0 {
+		i = m.wildcards.lookup(m, cleanPath, req)
+	}
+	if i < 0 {
+		return nil
+	}
+	return &m.endpoints[i]
+}
+
+// pick returns the first of the given endpoints that accepts req, or -1.
+func (m *endpointMatcher) pick(indexes []int, req *http.Request) int {
+	for _, i := range indexes {
+		if m.endpoints[i].accepts(req) {
+			return i
+		}
+	}
+	return -1
+}
+
+// accepts reports whether the endpoint matches req on everything but the
+// path: its method, host, query and headers.
+func (ep *endpointLimiter) accepts(req *http.Request) bool {
+	return matchMethod(req.Method, ep.config.Methods) &&
+		matchHost(requestHost(req), ep.config.Host) &&
+		matchQuery(req.URL.RawQuery, ep.config.Query) &&
+		matchHeaders(req.Header, ep.config.Headers)
+}
+
+// matchMethod reports whether method is one of methods, or methods is empty.
+func matchMethod(method string, methods []string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHost reports whether host matches pattern: an exact host name, a
+// wildcard (*.example.com matches any subdomain of example.com, but not
+// example.com itself) or empty for any host. Pattern must be lowercase.
+func matchHost(host, pattern string) bool {
+	if pattern == "" {
+		return true
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return len(host) > len(suffix) && strings.EqualFold(host[len(host)-len(suffix):], suffix)
+	}
+	return strings.EqualFold(host, pattern)
+}
+
+// matchHeaders reports whether header has every header of conditions with
+// the required value, or with any value if the required value is empty.
+// The names of conditions must be canonical (see canonicalHeaders).
+func matchHeaders(header http.Header, conditions map[string]string) bool {
+	for name, want := range conditions {
+		values, ok := header[name]
+		if !ok || len(values) == 0 {
+			return false
+		}
+		if want == "" {
+			continue
+		}
+		// Compare the value without its parameters, e.g. the boundary of
+		// multipart/form-data; boundary=...
+		value, _, _ := strings.Cut(values[0], ";")
+		if !strings.EqualFold(strings.TrimSpace(value), want) {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalHeaders returns a copy of conditions with canonical header names.
+func canonicalHeaders(conditions map[string]string) map[string]string {
+	if len(conditions) == 0 {
+		return nil
+	}
+	canonical := make(map[string]string, len(conditions))
+	for name, value := range conditions {
+		canonical[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return canonical
+}
+
+// requestHost returns the host name of req, without port or trailing dot.
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	host = strings.TrimPrefix(host, "[")
+	host = strings.TrimSuffix(host, "]")
+	return strings.TrimSuffix(host, ".")
+}
+
+// insert adds endpoint i under prefix.
+func (n *trieNode) insert(prefix string, i int) {
+	for prefix != "" {
+		c := n.child(prefix[0])
+		if c == nil {
+			n.children = append(n.children, &trieNode{label: prefix, endpoints: []int{i}})
+			return
+		}
+
+		l := 0
+		for l < len(prefix) && l < len(c.label) && prefix[l] == c.label[l] {
+			l++
+		}
+		if l < len(c.label) {
+			// Split the edge at the end of the common prefix
+			*c = trieNode{
+				label:    c.label[:l],
+				children: []*trieNode{{label: c.label[l:], children: c.children, endpoints: c.endpoints}},
+			}
+		}
+		n, prefix = c, prefix[l:]
+	}
+	n.endpoints = append(n.endpoints, i)
+}
+
+// child returns the child whose label starts with b, or nil.
+func (n *trieNode) child(b byte) *trieNode {
+	for _, c := range n.children {
+		if c.label[0] == b {
+			return c
+		}
+	}
+	return nil
+}
+
+// lookup returns the endpoint with the longest prefix of rest (the path
+// left after the prefix of n) that accepts req, or -1.
+func (n *trieNode) lookup(m *endpointMatcher, rest string, req *http.Request) int {
+	next := byte('/')
+	if rest != "" {
+		next = rest[0]
+	}
+	if c := n.child(next); c != nil {
+		switch {
+		case strings.HasPrefix(rest, c.label):
+			if i := c.lookup(m, rest[len(c.label):], req); i >= 0 {
+				return i
+			}
+		case len(c.label) == len(rest)+1 && c.label[len(rest)] == '/' && strings.HasPrefix(c.label, rest):
+			// A pattern ending in /* also matches the path without the
+			// trailing slash (/api/* matches /api)
+			if i := m.pick(c.endpoints, req); i >= 0 {
+				return i
+			}
+		}
+	}
+	return m.pick(n.endpoints, req)
+}
+
+// isTemplatePath reports whether path has {param} segments, each matching
+// any single non-empty segment.
+func isTemplatePath(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if isParamSegment(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// isParamSegment reports whether a path segment is a {param}.
+func isParamSegment(segment string) bool {
+	return len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}'
+}
+
+// insert adds endpoint i under path, without its leading slash.
+func (n *segmentNode) insert(path string, i int) {
+	for {
+		segment, rest, more := strings.Cut(path, "/")
+		var c *segmentNode
+		if isParamSegment(segment) {
+			if n.param == nil {
+				n.param = &segmentNode{}
+			}
+			c = n.param
+		} else {
+			if n.literals == nil {
+				n.literals = make(map[string]*segmentNode)
+			}
+			if c = n.literals[segment]; c == nil {
+				c = &segmentNode{}
+				n.literals[segment] = c
+			}
+		}
+		n, path = c, rest
+		if !more {
+			break
+		}
+	}
+	n.endpoints = append(n.endpoints, i)
+}
+
+// lookup returns the endpoint whose templated path matches path (the path
+// left after the segments of n, without leading slash) and accepts req, or
+// -1. Literal segments are tried before parameters.
+func (n *segmentNode) lookup(m *endpointMatcher, path string, req *http.Request) int {
+	segment, rest, more := strings.Cut(path, "/")
+	next := func(c *segmentNode) int {
+		if !more {
+			return m.pick(c.endpoints, req)
+		}
+		return c.lookup(m, rest, req)
+	}
+	if c := n.literals[segment]; c != nil {
+		if i := next(c); i >= 0 {
+			return i
+		}
+	}
+	if n.param != nil && segment != "" {
+		return next(n.param)
+	}
+	return -1
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// linearMatch is the reference scan the matcher replaces.
+func linearMatch(endpoints []endpointLimiter, cleanPath string, req *http.Request) *endpointLimiter {
+	for i := range endpoints {
+		if matchPath(cleanPath, endpoints[i].config.Path) && endpoints[i].accepts(req) {
+			return &endpoints[i]
+		}
+	}
+	return nil
+}
+
+func newTestRouter(t testing.TB, endpoints []EndpointConfig) *Router {
+	t.Helper()
+	s := store.NewMemoryStore()
+	t.Cleanup(func() { s.Close() })
+	r, err := NewRouter(http.NotFoundHandler(), s, endpoints)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	return r
+}
+
+func TestEndpointMatcher_MatchesLinearScan(t *testing.T) {
+	cfg := ratelimiter.Config{Rate: 10, Window: time.Minute}
+	var endpoints []EndpointConfig
+	for _, p := range []string{
+		"*", "/*", "/api", "/api/*", "/api*", "/api/users", "/api/users/*", "/api/users/me",
+		"/api/u*", "/apix", "/api/posts/*", "/a", "/a/*", "/static/*", "/static/js/*",
+	} {
+		endpoints = append(endpoints, EndpointConfig{Path: p, Config: cfg})
+	}
+	endpoints = append(endpoints,
+		EndpointConfig{Path: "/api/users", Methods: []string{"POST"}, Config: cfg},
+		EndpointConfig{Path: "/api/posts/*", Methods: []string{"DELETE", "PUT"}, Config: cfg},
+		EndpointConfig{Path: "/api/*", Methods: []string{"PATCH"}, Config: cfg},
+	)
+	r := newTestRouter(t, endpoints)
+
+	paths := []string{
+		"/", ".", "/a", "/a/b", "/ab", "/api", "/api/", "/apix", "/apixy", "/api/users", "/api/users/1",
+		"/api/users/me", "/api/u", "/api/unknown", "/api/posts", "/api/posts/1", "/static", "/static/js",
+		"/static/js/app.js", "/other", "/ap",
+	}
+	for _, p := range paths {
+		for _, method := range []string{"GET", "POST", "PUT", "DELETE", "PATCH"} {
+			req := httptest.NewRequest(method, "/", nil)
+			want := linearMatch(r.endpoints, p, req)
+			got := r.matcher.match(p, req)
+			if got != want {
+				t.Errorf("%s %s: expected %v, got %v", method, p, endpointString(want), endpointString(got))
+			}
+		}
+	}
+}
+
+func TestEndpointMatcher_NoMatch(t *testing.T) {
+	cfg := ratelimiter.Config{Rate: 10, Window: time.Minute}
+	r := newTestRouter(t, []EndpointConfig{
+		{Path: "/api/*", Methods: []string{"POST"}, Config: cfg},
+		{Path: "/login", Config: cfg},
+	})
+
+	for _, tc := range []struct{ method, path string }{
+		{"GET", "/api/x"},
+		{"POST", "/ap"},
+		{"GET", "/login/x"},
+	} {
+		if ep := r.matcher.match(tc.path, httptest.NewRequest(tc.method, "/", nil)); ep != nil {
+			t.Errorf("%s %s: expected no match, got %s", tc.method, tc.path, ep.config.Path)
+		}
+	}
+}
+
+func TestEndpointMatcher_Templates(t *testing.T) {
+	cfg := ratelimiter.Config{Rate: 10, Window: time.Minute}
+	r := newTestRouter(t, []EndpointConfig{
+		{Path: "/users/{id}", Config: cfg},
+		{Path: "/users/{id}/posts", Config: cfg},
+		{Path: "/users/me", Config: cfg},
+		{Path: "/users/{id}/{section}", Methods: []string{"POST"}, Config: cfg},
+		{Path: "/users/*", Config: cfg},
+	})
+
+	for _, tc := range []struct{ method, path, want string }{
+		{"GET", "/users/42", "/users/{id}"},
+		{"GET", "/users/me", "/users/me"},
+		{"GET", "/users/42/posts", "/users/{id}/posts"},
+		{"GET", "/users/me/posts", "/users/{id}/posts"},
+		{"POST", "/users/42/likes", "/users/{id}/{section}"},
+		{"GET", "/users/42/likes", "/users/*"},
+		{"GET", "/users/42/posts/1", "/users/*"},
+		{"GET", "/users", "/users/*"},
+	} {
+		ep := r.matcher.match(tc.path, httptest.NewRequest(tc.method, "/", nil))
+		if ep == nil || ep.config.Path != tc.want {
+			t.Errorf("%s %s: expected %s, got %s", tc.method, tc.path, tc.want, endpointString(ep))
+		}
+	}
+}
+
+func TestEndpointMatcher_Host(t *testing.T) {
+	cfg := ratelimiter.Config{Rate: 10, Window: time.Minute}
+	r := newTestRouter(t, []EndpointConfig{
+		{Path: "/api/*", Config: cfg},
+		{Path: "/api/*", Host: "*.Example.com", Config: cfg},
+		{Path: "/api/*", Host: "admin.example.com.", Config: cfg},
+	})
+
+	for _, tc := range []struct{ host, want string }{
+		{"admin.example.com", "admin.example.com"},
+		{"ADMIN.example.com:8443", "admin.example.com"},
+		{"tenant.example.com", "*.example.com"},
+		{"a.b.example.com", "*.example.com"},
+		{"example.com", ""},
+		{"badexample.com", ""},
+		{"[::1]:8080", ""},
+	} {
+		req := httptest.NewRequest("GET", "/api/x", nil)
+		req.Host = tc.host
+		ep := r.matcher.match("/api/x", req)
+		if ep == nil || ep.config.Host != tc.want {
+			t.Errorf("Host %q: expected endpoint for host %q, got %s", tc.host, tc.want, endpointString(ep))
+		}
+	}
+}
+
+func TestEndpointMatcher_Headers(t *testing.T) {
+	r := newTestRouter(t, []EndpointConfig{
+		{Path: "/api/*", Config: ratelimiter.Config{Rate: 100, Window: time.Minute}},
+		{Path: "/api/*", Headers: map[string]string{"accept-version": "v2"}, Config: ratelimiter.Config{Rate: 2, Window: time.Minute}},
+		{Path: "/api/*", Headers: map[string]string{"Content-Type": "multipart/form-data"}, Config: ratelimiter.Config{Rate: 3, Window: time.Minute}},
+		{Path: "/api/*", Headers: map[string]string{"Content-Type": "multipart/form-data", "X-Beta": ""}, Config: ratelimiter.Config{Rate: 4, Window: time.Minute}},
+	})
+
+	for _, tc := range []struct {
+		headers map[string]string
+		rate    int
+	}{
+		{nil, 100},
+		{map[string]string{"Accept-Version": "v1"}, 100},
+		{map[string]string{"Accept-Version": "V2"}, 2},
+		{map[string]string{"Content-Type": "multipart/form-data; boundary=xyz"}, 3},
+		{map[string]string{"Content-Type": "application/json"}, 100},
+		{map[string]string{"Content-Type": "multipart/form-data", "X-Beta": "1"}, 4},
+	} {
+		req := httptest.NewRequest("POST", "/api/upload", nil)
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+		ep := r.matcher.match("/api/upload", req)
+		if ep == nil || ep.config.Config.Rate != tc.rate {
+			t.Errorf("Headers %v: expected the endpoint with rate %d, got %s", tc.headers, tc.rate, endpointString(ep))
+		}
+	}
+}
+
+func TestRequestHost(t *testing.T) {
+	for host, want := range map[string]string{
+		"example.com":    "example.com",
+		"example.com:80": "example.com",
+		"example.com.":   "example.com",
+		"[::1]":          "::1",
+		"[::1]:8080":     "::1",
+		"127.0.0.1:8080": "127.0.0.1",
+		"":               "",
+	} {
+		if got := requestHost(&http.Request{Host: host}); got != want {
+			t.Errorf("requestHost(%q) = %q, expected %q", host, got, want)
+		}
+	}
+}
+
+func endpointString(ep *endpointLimiter) string {
+	if ep == nil {
+		return "no match"
+	}
+	return fmt.Sprintf("%s %s %v", ep.config.Host, ep.config.Path, ep.config.Methods)
+}
+
+// BenchmarkRouter_Match matches the last of many endpoints, which a linear
+// scan reaches after trying all the others; the matcher cost only depends on
+// the path length.
+func BenchmarkRouter_Match(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		endpoints := make([]EndpointConfig, n)
+		for i := range endpoints {
+			endpoints[i] = EndpointConfig{
+				Path:   fmt.Sprintf("/api/v1/resource-%d/*", i),
+				Config: ratelimiter.Config{Rate: 10, Window: time.Minute},
+			}
+		}
+		r := newTestRouter(b, endpoints)
+		path := "/api/v1/resource-0/items/42"
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+
+		b.Run(fmt.Sprintf("endpoints=%d/matcher", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r.matcher.match(path, req)
+			}
+		})
+		b.Run(fmt.Sprintf("endpoints=%d/linear", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearMatch(r.endpoints, path, req)
+			}
+		})
+	}
+}
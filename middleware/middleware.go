@@ -5,12 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"net"
 	"net/http"
 	"net/netip"
 	"path"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Morditux/ratelimiter"
 	"github.com/Morditux/ratelimiter/store"
@@ -24,6 +23,9 @@ type KeyFunc func(r *http.Request) string
 // It should write the appropriate response to w.
 type OnLimitedFunc func(w http.ResponseWriter, r *http.Request)
 
+// SkipFunc reports whether a request should bypass rate limiting.
+type SkipFunc func(r *http.Request) bool
+
 // Options configures the rate limiting middleware behavior.
 type Options struct {
 	// KeyFunc extracts the rate limiting key from the request.
@@ -45,6 +47,120 @@ type Options struct {
 	// Keys exceeding this length will be rejected with 431 Request Header Fields Too Large.
 	// Default: 4096.
 	MaxKeySize int
+
+	// SkipFunc reports whether a request should bypass rate limiting.
+	// It allows skipping based on arbitrary request attributes (e.g. an
+	// authenticated admin or a valid service token).
+	// Default: nil (no request is skipped).
+	SkipFunc SkipFunc
+
+	// IPv4Prefix masks IPv4 keys to this prefix length before use.
+	// Default: 0 (no masking).
+	IPv4Prefix int
+
+	// IPv6Prefix masks IPv6 keys to this prefix length before use.
+	// Default: 0 (no masking).
+	IPv6Prefix int
+
+	// GlobalLimiter caps the total request throughput on top of per-client limits.
+	// Default: nil (no global limit).
+	GlobalLimiter ratelimiter.LimiterWithDetails
+
+	// RetryAfterJitter adds a random duration in [0, RetryAfterJitter) to the
+	// Retry-After header of limited requests, so that clients do not retry in lockstep.
+	// Default: 0 (no jitter).
+	RetryAfterJitter time.Duration
+
+	// OwnsStore makes Router.Close and Router.Shutdown close the store passed
+	// to NewRouter. Leave it unset when the store is shared with other limiters.
+	// Only Router uses it: RateLimitMiddleware is given a limiter, not a
+	// store, and ignores it.
+	// Default: false (the caller closes the store).
+	OwnsStore bool
+
+	// HealthChecker, when set, makes the middleware skip the limiter while it
+	// reports unhealthy and handle requests according to DegradedMode.
+	// Default: nil (the limiter is always used).
+	HealthChecker *ratelimiter.HealthChecker
+
+	// DegradedMode selects how requests are handled while HealthChecker
+	// reports unhealthy.
+	// Default: DegradedFailOpen.
+	DegradedMode DegradedMode
+
+	// MessageLimiter rate limits messages inside long-lived connections
+	// admitted by ConnLimiter (see Conn.AllowN).
+	// Default: nil (messages are not limited).
+	MessageLimiter ratelimiter.Limiter
+
+	// CountStatus decides from the response status whether a request counts
+	// toward the limit (see WithCountStatus).
+	// Default: nil (every allowed request counts).
+	CountStatus func(status int) bool
+
+	// QueueSize is the number of over-limit requests per key held in a FIFO
+	// queue instead of being rejected (see WithQueue).
+	// Default: 0 (no queuing).
+	QueueSize int
+
+	// QueueTimeout is the maximum time a request waits in the queue.
+	// Default: 1 second when QueueSize is set.
+	QueueTimeout time.Duration
+
+	// MaxInFlight caps the number of requests per key handled concurrently
+	// (see WithMaxInFlight).
+	// Default: 0 (no cap).
+	MaxInFlight int
+
+	// HeaderMode selects when the X-RateLimit-* headers are written.
+	// Default: HeadersAlways.
+	HeaderMode HeaderMode
+
+	// HeaderPrefix is the prefix of the rate limit header names.
+	// Default: "X-RateLimit".
+	HeaderPrefix string
+
+	// HeaderFilter, when set, restricts the rate limit headers to requests
+	// for which it returns true (e.g. authenticated callers).
+	// Default: nil (headers are written for every request).
+	HeaderFilter func(r *http.Request) bool
+
+	// Monitor, when set, records decisions and fail-open occurrences
+	// (see WithMonitor).
+	// Default: nil.
+	Monitor *Monitor
+
+	// Auditor, when set, records sampled decisions (see WithAudit).
+	// Default: nil.
+	Auditor *Auditor
+
+	// History, when set, keeps the recent decisions of each key and
+	// endpoint (see WithHistory).
+	// Default: nil.
+	History *History
+
+	// DryRun evaluates the limits without enforcing them (see WithDryRun).
+	// Default: false.
+	DryRun bool
+
+	// CostFunc returns the number of requests each request counts for
+	// (see WithCost).
+	// Default: nil (every request counts for 1).
+	CostFunc CostFunc
+
+	// WarningThreshold is the soft limit, as a share of the limit, above
+	// which allowed requests carry a warning header (see WithWarning).
+	// Default: 0 (no soft limit).
+	WarningThreshold float64
+
+	// OnWarning is called when a key crosses WarningThreshold.
+	// Default: nil.
+	OnWarning WarningFunc
+
+	// Switch, when set, turns enforcement on and off at runtime
+	// (see WithSwitch).
+	// Default: nil (limits are always enforced unless DryRun is set).
+	Switch *Switch
 }
 
 // Option is a function that configures Options.
@@ -85,10 +201,45 @@ func WithMaxKeySize(size int) Option {
 	}
 }
 
+// WithSkipFunc sets a function that decides per request whether to bypass rate limiting.
+func WithSkipFunc(fn SkipFunc) Option {
+	return func(o *Options) {
+		o.SkipFunc = fn
+	}
+}
+
+// WithRetryAfterJitter adds bounded random jitter to the Retry-After header.
+func WithRetryAfterJitter(max time.Duration) Option {
+	return func(o *Options) {
+		o.RetryAfterJitter = max
+	}
+}
+
+// WithDryRun evaluates the limits without enforcing them: requests over the
+// limit are recorded as denied by the Monitor, Auditor and History, then
+// served anyway. Use it to try new limits on live traffic; with an Auditor
+// using AuditConfig.OnlyDenied, the audit log lists the requests that would
+// have been blocked. Protections against overload (WithMaxInFlight, key size
+// and store capacity) are still enforced.
+func WithDryRun(enabled bool) Option {
+	return func(o *Options) {
+		o.DryRun = enabled
+	}
+}
+
+// WithStoreOwnership sets whether the Router owns, and therefore closes, its
+// store. RateLimitMiddleware ignores it.
+func WithStoreOwnership(owned bool) Option {
+	return func(o *Options) {
+		o.OwnsStore = owned
+	}
+}
+
 const maxIPLength = 256
 
 // DefaultKeyFunc extracts the client IP from the request.
-// It checks X-Forwarded-For, X-Real-IP, and falls back to RemoteAddr.
+// It checks X-Forwarded-For, X-Real-IP, and falls back to RemoteAddr
+// (or the peer UID for Unix socket connections, see PeerCredConnContext).
 // Note: This function blindly trusts X-Forwarded-For, which can be spoofed.
 // It validates that the extracted value is a valid IP address to prevent
 // storage exhaustion attacks with garbage keys.
@@ -118,8 +269,9 @@ func DefaultKeyFunc(r *http.Request) string {
 		}
 	}
 
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+	// Check X-Real-IP header (spelled canonically, which Get would otherwise
+	// allocate for on every request)
+	if xri := r.Header.Get("X-Real-Ip"); xri != "" {
 		if len(xri) <= maxIPLength {
 			cleanIP := stripIPPort(xri)
 			if canonical, ok := canonicalizeIP(cleanIP); ok {
@@ -128,6 +280,13 @@ func DefaultKeyFunc(r *http.Request) string {
 		}
 	}
 
+	// Unix socket connections carry no IP; use the peer credentials if available
+	if IsUnixSocketRequest(r) {
+		if key := unixSocketKey(r); key != "" {
+			return key
+		}
+	}
+
 	return getRemoteIP(r)
 }
 
@@ -160,128 +319,190 @@ func canonicalizeIP(ipStr string) (string, bool) {
 // skipping IPs that match the trustedProxies list.
 // trustedProxies can be individual IPs or CIDR blocks (e.g., "10.0.0.0/8").
 func TrustedIPKeyFunc(trustedProxies []string) (KeyFunc, error) {
-	cidrs := make([]*net.IPNet, 0, len(trustedProxies))
-	for _, t := range trustedProxies {
-		_, network, err := net.ParseCIDR(t)
-		if err != nil {
-			// Try parsing as single IP
-			ip := net.ParseIP(t)
-			if ip == nil {
-				return nil, fmt.Errorf("invalid IP or CIDR: %s", t)
-			}
-			// Convert single IP to /32 or /128 CIDR
-			bits := 32
-			if ip.To4() == nil {
-				bits = 128
-			}
-			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
-		}
-		cidrs = append(cidrs, network)
+	prefixes, err := parseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
 	}
+	return TrustedPrefixesKeyFunc(prefixes), nil
+}
 
+// TrustedPrefixesKeyFunc is like TrustedIPKeyFunc with the trusted proxies
+// given as prefixes (a single IP is a /32 or /128 prefix).
+func TrustedPrefixesKeyFunc(trustedProxies []netip.Prefix) KeyFunc {
+	prefixes := normalizePrefixes(trustedProxies)
 	return func(r *http.Request) string {
-		remoteIP := getRemoteIP(r)
-
-		// 1. Check RemoteAddr first
-		ip := net.ParseIP(remoteIP)
-		if ip == nil {
-			// If RemoteAddr is invalid, we return it (as untrusted/raw)
-			// or fallback to XFF? Original logic appended it and skipped if nil.
-			// But if it's the only one, we return it.
-			return remoteIP
-		}
+		return trustedXFFKey(r, prefixes)
+	}
+}
 
-		isTrusted := false
-		for _, cidr := range cidrs {
-			if cidr.Contains(ip) {
-				isTrusted = true
-				break
-			}
-		}
+// WithTrustedPrefixes sets the key function to TrustedPrefixesKeyFunc(prefixes).
+func WithTrustedPrefixes(prefixes []netip.Prefix) Option {
+	return func(o *Options) {
+		o.KeyFunc = TrustedPrefixesKeyFunc(prefixes)
+	}
+}
 
-		if !isTrusted {
-			return remoteIP
-		}
+// trustedXFFKey walks X-Forwarded-For from right to left and returns the first
+// IP that is not in prefixes (see TrustedIPKeyFunc).
+func trustedXFFKey(r *http.Request, prefixes []netip.Prefix) string {
+	addr, s := trustedXFFAddr(r, prefixes)
+	if addr.IsValid() {
+		return addrString(addr, s)
+	}
+	return s
+}
 
-		// 2. RemoteAddr is trusted, check X-Forwarded-For backwards
-		// Handle multiple X-Forwarded-For headers by checking all values
-		xffHeaders := r.Header.Values("X-Forwarded-For")
-		if len(xffHeaders) == 0 {
-			return remoteIP
-		}
+// trustedXFFAddr walks X-Forwarded-For from right to left and returns the
+// first IP that is not in prefixes, with the text it was parsed from. If no
+// valid IP is found, addr is invalid and s is the raw fallback key.
+func trustedXFFAddr(r *http.Request, prefixes []netip.Prefix) (addr netip.Addr, s string) {
+	remoteIP := getRemoteIP(r)
+
+	// 1. Check RemoteAddr first. An invalid RemoteAddr is returned raw
+	// (untrusted).
+	addr, ok := parseHopIP(remoteIP)
+	if !ok {
+		return netip.Addr{}, remoteIP
+	}
+	if !containsAddr(prefixes, addr) {
+		return addr, remoteIP
+	}
 
-		// Iterate backwards through all XFF headers (starting from the last header)
-		for i := len(xffHeaders) - 1; i >= 0; i-- {
-			xff := xffHeaders[i]
-			// Iterate backwards through the current XFF header string
-			idx := len(xff)
-			for idx > 0 {
-				prevComma := strings.LastIndexByte(xff[:idx], ',')
-				var part string
-				if prevComma == -1 {
-					part = xff[:idx]
-					idx = -1 // Stop after this in current header
-				} else {
-					part = xff[prevComma+1 : idx]
-					idx = prevComma
-				}
+	// 2. RemoteAddr is trusted, check X-Forwarded-For backwards
+	// Handle multiple X-Forwarded-For headers by checking all values
+	xffHeaders := r.Header.Values("X-Forwarded-For")
+	if len(xffHeaders) == 0 {
+		return addr, remoteIP
+	}
 
-				part = strings.TrimSpace(part)
-				if part == "" {
-					continue
-				}
+	// Iterate backwards through all XFF headers (starting from the last header)
+	for i := len(xffHeaders) - 1; i >= 0; i-- {
+		xff := xffHeaders[i]
+		// Iterate backwards through the current XFF header string
+		idx := len(xff)
+		for idx > 0 {
+			prevComma := strings.LastIndexByte(xff[:idx], ',')
+			var part string
+			if prevComma == -1 {
+				part = xff[:idx]
+				idx = -1 // Stop after this in current header
+			} else {
+				part = xff[prevComma+1 : idx]
+				idx = prevComma
+			}
 
-				if len(part) > maxIPLength {
-					continue
-				}
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
 
-				cleanPart := stripIPPort(part)
-				ip := net.ParseIP(cleanPart)
-				if ip == nil {
-					continue // Skip invalid IPs
-				}
+			if len(part) > maxIPLength {
+				continue
+			}
 
-				isTrusted := false
-				for _, cidr := range cidrs {
-					if cidr.Contains(ip) {
-						isTrusted = true
-						break
-					}
-				}
+			cleanPart := stripIPPort(part)
+			hop, ok := parseHopIP(cleanPart)
+			if !ok {
+				continue // Skip invalid IPs
+			}
 
-				if !isTrusted {
-					return ip.String()
-				}
+			if !containsAddr(prefixes, hop) {
+				return hop, cleanPart
 			}
 		}
+	}
 
-		// 3. If all are trusted, return the first IP (original client)
-		// Use optimized extraction for first IP from the first header
-		firstHeader := xffHeaders[0]
-		if idx := strings.IndexByte(firstHeader, ','); idx >= 0 {
-			if ip := strings.TrimSpace(firstHeader[:idx]); ip != "" {
-				if len(ip) <= maxIPLength {
-					cleanIP := stripIPPort(ip)
-					if ipObj := net.ParseIP(cleanIP); ipObj != nil {
-						return ipObj.String()
-					}
-					return cleanIP
+	// 3. If all are trusted, return the first IP (original client)
+	// Use optimized extraction for first IP from the first header
+	firstHeader := xffHeaders[0]
+	if idx := strings.IndexByte(firstHeader, ','); idx >= 0 {
+		if ip := strings.TrimSpace(firstHeader[:idx]); ip != "" {
+			if len(ip) <= maxIPLength {
+				cleanIP := stripIPPort(ip)
+				if hop, ok := parseHopIP(cleanIP); ok {
+					return hop, cleanIP
 				}
+				return netip.Addr{}, cleanIP
 			}
-		} else {
-			if ip := strings.TrimSpace(firstHeader); ip != "" {
-				if len(ip) <= maxIPLength {
-					cleanIP := stripIPPort(ip)
-					if ipObj := net.ParseIP(cleanIP); ipObj != nil {
-						return ipObj.String()
-					}
-					return ip
+		}
+	} else {
+		if ip := strings.TrimSpace(firstHeader); ip != "" {
+			if len(ip) <= maxIPLength {
+				cleanIP := stripIPPort(ip)
+				if hop, ok := parseHopIP(cleanIP); ok {
+					return hop, cleanIP
 				}
+				return netip.Addr{}, ip
+			}
+		}
+	}
+
+	return addr, remoteIP
+}
+
+// parseHopIP parses the IP of a proxy hop. IPv4-mapped IPv6 addresses are
+// unmapped; addresses with an IPv6 zone are invalid.
+func parseHopIP(s string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// addrString returns the canonical form of addr, reusing s when it is
+// already canonical to avoid an allocation.
+func addrString(addr netip.Addr, s string) string {
+	var buf [64]byte
+	if string(addr.AppendTo(buf[:0])) == s {
+		return s
+	}
+	return addr.String()
+}
+
+// containsAddr reports whether addr belongs to one of prefixes.
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses a list of IPs or CIDR blocks.
+func parseTrustedProxies(trustedProxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, t := range trustedProxies {
+		prefix, err := netip.ParsePrefix(t)
+		if err != nil {
+			// Try parsing as single IP
+			addr, err := netip.ParseAddr(t)
+			if err != nil || addr.Zone() != "" {
+				return nil, fmt.Errorf("invalid IP or CIDR: %s", t)
 			}
+			// Convert single IP to /32 or /128 CIDR
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
 		}
+		prefixes = append(prefixes, prefix)
+	}
+	return normalizePrefixes(prefixes), nil
+}
 
-		return remoteIP
-	}, nil
+// normalizePrefixes masks prefixes and turns IPv4-mapped IPv6 prefixes into
+// IPv4 ones, since addresses are unmapped before they are matched.
+func normalizePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	out := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		if !p.IsValid() {
+			continue
+		}
+		if addr := p.Addr(); addr.Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(addr.Unmap(), p.Bits()-96)
+		}
+		out = append(out, p.Masked())
+	}
+	return out
 }
 
 // getRemoteIP extracts the IP from RemoteAddr, handling IPv6 brackets and ports.
@@ -328,6 +549,19 @@ func stripIPPort(addr string) string {
 	return addr
 }
 
+// setRetryAfter sets the Retry-After header, rounding d up to the nearest second.
+// Nothing is set if d is not positive.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header()["Retry-After"] = headerValue(int64(seconds))
+}
+
 // writeError writes an error response with security headers.
 func writeError(w http.ResponseWriter, msg string, code int) {
 	w.Header().Set("Cache-Control", "no-store")
@@ -377,6 +611,19 @@ func RateLimitMiddleware(limiter ratelimiter.Limiter, opts ...Option) func(http.
 		options.MaxKeySize = 4096
 	}
 
+	options.KeyFunc = MaskIPKeyFunc(options.KeyFunc, options.IPv4Prefix, options.IPv6Prefix)
+
+	// Resolve the details capability once instead of on every request.
+	detailsLimiter, hasDetails := limiter.(ratelimiter.LimiterWithDetails)
+	queue := newRequestQueue(options)
+	headers := newHeaderWriter(options)
+	values := &headerValues{}
+
+	var inFlight *keyCounter
+	if options.MaxInFlight > 0 {
+		inFlight = newKeyCounter(options.MaxInFlight)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Check excluded paths
@@ -406,6 +653,17 @@ func RateLimitMiddleware(limiter ratelimiter.Limiter, opts ...Option) func(http.
 				}
 			}
 
+			// Check custom skip function
+			if options.SkipFunc != nil && options.SkipFunc(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Degraded mode: don't pay for a backend known to be down
+			if serveDegraded(w, r, next, options) {
+				return
+			}
+
 			// Get the rate limiting key
 			key := options.KeyFunc(r)
 
@@ -415,31 +673,57 @@ func RateLimitMiddleware(limiter ratelimiter.Limiter, opts ...Option) func(http.
 				return
 			}
 
+			// Concurrency cap first: it is in memory and rejected requests
+			// must not consume rate limit budget
+			if inFlight != nil {
+				if !inFlight.acquire(key) {
+					setRetryAfter(w, inFlightRetryAfter)
+					options.OnLimited(w, r)
+					return
+				}
+				defer inFlight.release(key)
+			}
+
+			cost, ok := requestCost(w, r, options.CostFunc)
+			if !ok {
+				return
+			}
+			dryRun := options.dryRun()
+
 			var allowed bool
 			var err error
+			var result ratelimiter.Result
 
 			// Check if limiter supports details
-			if detailsLimiter, ok := limiter.(ratelimiter.LimiterWithDetails); ok {
-				var result ratelimiter.Result
-				result, err = detailsLimiter.AllowNWithDetails(key, 1)
+			if hasDetails {
+				result, err = detailsLimiter.AllowNWithDetails(key, cost)
+				if err == nil && !result.Allowed && queue != nil && !dryRun {
+					result, err = queue.wait(r.Context(), key, result, func() (ratelimiter.Result, error) {
+						return detailsLimiter.AllowNWithDetails(key, cost)
+					})
+				}
 				allowed = result.Allowed
 
-				// Set headers
-				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
-				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
-				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.ResetAt.Unix(), 10))
+				headers.write(w, r, result, values)
+				if allowed {
+					warn(w, r, options, headers, key, result, cost)
+				}
 
-				if !allowed && result.RetryAfter > 0 {
-					// Round up to nearest second
-					seconds := int(math.Ceil(result.RetryAfter.Seconds()))
-					if seconds < 1 {
-						seconds = 1
-					}
-					w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				if !allowed && !dryRun {
+					result.RetryAfter = ratelimiter.AddJitter(result.RetryAfter, options.RetryAfterJitter)
+					setRetryAfter(w, result.RetryAfter)
 				}
 			} else {
 				// Check the rate limit using standard interface
-				allowed, err = limiter.Allow(key)
+				allowed, err = limiter.AllowN(key, cost)
+				if err == nil && !allowed && queue != nil && !dryRun {
+					result, err = queue.wait(r.Context(), key, result, func() (ratelimiter.Result, error) {
+						ok, err := limiter.AllowN(key, cost)
+						return ratelimiter.Result{Allowed: ok}, err
+					})
+					allowed = result.Allowed
+				}
+				result.Allowed = allowed
 			}
 
 			if err != nil {
@@ -458,18 +742,45 @@ func RateLimitMiddleware(limiter ratelimiter.Limiter, opts ...Option) func(http.
 					return
 				}
 
+				// FAIL SECURE: A request that costs more than the limiter can ever allow
+				// is a client error, not a transient condition.
+				if errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+					writeError(w, "Request cost exceeds rate limit capacity", http.StatusRequestEntityTooLarge)
+					return
+				}
+
 				// FAIL OPEN: Log error but allow request on other errors (e.g. redis down)
 				// This ensures system resilience.
+				if options.Monitor != nil {
+					options.Monitor.recordFailOpen(defaultEndpointName)
+				}
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			if !allowed {
+			if options.Monitor != nil {
+				options.Monitor.record(defaultEndpointName, key, allowed)
+			}
+			if options.Auditor != nil {
+				options.Auditor.record(defaultEndpointName, key, result, dryRun)
+			}
+			if options.History != nil {
+				options.History.record(defaultEndpointName, key, result)
+			}
+
+			// Expose the decision to OnLimited and downstream handlers
+			r = withResult(r, key, result)
+
+			if !allowed && !dryRun {
 				options.OnLimited(w, r)
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			if !checkGlobal(w, r, options, dryRun) {
+				return
+			}
+
+			serveCounted(w, r, next, limiter, key, cost, options.CountStatus)
 		})
 	}
 }
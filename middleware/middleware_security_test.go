@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/Morditux/ratelimiter"
 	"github.com/Morditux/ratelimiter/store"
 )
 
@@ -81,3 +82,18 @@ func TestRateLimitMiddleware_FailOpenOnOtherErrors(t *testing.T) {
 		t.Errorf("Middleware should fail open on system errors, got status %d", w.Code)
 	}
 }
+
+func TestRateLimitMiddleware_CostExceedsCapacity(t *testing.T) {
+	limiter := &ErrorLimiter{Err: ratelimiter.ErrCostExceedsCapacity}
+
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler should not be called")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", rec.Code)
+	}
+}
@@ -414,3 +414,26 @@ func TestMatchPath_Prefix(t *testing.T) {
 		t.Error("Non-matching prefix should return false")
 	}
 }
+
+func TestRateLimitMiddleware_LimiterWithoutDetails(t *testing.T) {
+	limiter := &MockLimiter{
+		AllowFunc: func(key string) (bool, error) {
+			return true, nil
+		},
+	}
+
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("X-RateLimit-Limit") != "" {
+		t.Error("Expected no X-RateLimit-Limit header for limiter without details")
+	}
+}
@@ -0,0 +1,129 @@
+// Package middlewaretest provides seed corpora for fuzzing request key
+// extraction and path matching, so that forks and custom KeyFuncs can be
+// fuzzed with the same hostile inputs as the middleware package:
+//
+//	func FuzzMyKeyFunc(f *testing.F) {
+//		middlewaretest.AddForwardedFor(f)
+//		f.Fuzz(func(t *testing.T, xff string) { ... })
+//	}
+package middlewaretest
+
+import "testing"
+
+// Paths returns request paths and patterns covering dot segments, repeated
+// and trailing slashes, encoded characters and unicode.
+func Paths() []string {
+	return []string{
+		"",
+		"/",
+		"//",
+		".",
+		"..",
+		"/.",
+		"/..",
+		"/api",
+		"/api/",
+		"/api/*",
+		"/api*",
+		"*",
+		"/*",
+		"/api//users",
+		"/api/./users",
+		"/api/../admin",
+		"/api/users/..",
+		"/api/users/.",
+		"/api/.../x",
+		"/api/..x/y",
+		"/api/.hidden",
+		"api/relative",
+		"/api/%2e%2e/admin",
+		"/api/%2F/x",
+		"/api\\..\\admin",
+		"/api/\x00/x",
+		"/ünïcödé/パス",
+		"/api/‮/x",
+		"/\xff\xfe",
+		"/a/b/c/d/e/f/g/h/i/j/k/l/m/n/o/p",
+	}
+}
+
+// Addrs returns host and host:port values as found in RemoteAddr or
+// X-Real-IP, including malformed IPv6, zones and IPv4-mapped addresses.
+func Addrs() []string {
+	return []string{
+		"",
+		":",
+		":80",
+		"1.2.3.4",
+		"1.2.3.4:80",
+		"1.2.3.4:",
+		"01.02.03.04",
+		"1.2.3.4.5",
+		"256.1.1.1",
+		"::1",
+		"[::1]",
+		"[::1]:80",
+		"[::1",
+		"::1]",
+		"[]:80",
+		"[[::1]]:80",
+		"[::1]:80:90",
+		"[1.2.3.4]:80",
+		"::ffff:1.2.3.4",
+		"[::ffff:1.2.3.4]:80",
+		"fe80::1%eth0",
+		"[fe80::1%eth0]:80",
+		"fe80::1%",
+		"2001:db8::1:80",
+		"2001:0db8:0000:0000:0000:0000:0000:0001",
+		"localhost:80",
+		"@",
+		"/tmp/socket.sock",
+		"１.２.３.４",
+	}
+}
+
+// ForwardedFor returns X-Forwarded-For values with empty elements,
+// whitespace, ports, garbage and long chains.
+func ForwardedFor() []string {
+	return []string{
+		"",
+		",",
+		",,,",
+		" , ",
+		"1.2.3.4",
+		"1.2.3.4, 10.0.0.1",
+		"10.0.0.1, 1.2.3.4",
+		"1.2.3.4:80, [::1]:443",
+		"garbage, 1.2.3.4",
+		"1.2.3.4, garbage",
+		"unknown",
+		"[::1], ::ffff:10.0.0.1",
+		"\t1.2.3.4\t,\t5.6.7.8",
+		"1.2.3.4,,5.6.7.8",
+		"2001:db8::1, fe80::1%eth0",
+		"1.2.3.4 5.6.7.8",
+		"1.1.1.1, 2.2.2.2, 3.3.3.3, 4.4.4.4, 5.5.5.5, 6.6.6.6, 7.7.7.7, 8.8.8.8",
+	}
+}
+
+// AddPaths adds Paths to the seed corpus of f.
+func AddPaths(f *testing.F) {
+	for _, p := range Paths() {
+		f.Add(p)
+	}
+}
+
+// AddAddrs adds Addrs to the seed corpus of f.
+func AddAddrs(f *testing.F) {
+	for _, a := range Addrs() {
+		f.Add(a)
+	}
+}
+
+// AddForwardedFor adds ForwardedFor to the seed corpus of f.
+func AddForwardedFor(f *testing.F) {
+	for _, xff := range ForwardedFor() {
+		f.Add(xff)
+	}
+}
@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// defaultEndpointName is the endpoint name RateLimitMiddleware reports to
+// monitors and auditors.
+const defaultEndpointName = "*"
+
+// WithMonitor records the decisions of the middleware in m.
+// RateLimitMiddleware reports its decisions under the endpoint "*", a
+// Router under the path of each endpoint. Like History, it counts keys as
+// returned by the key function, without the endpoint scope.
+func WithMonitor(m *Monitor) Option {
+	return func(o *Options) {
+		o.Monitor = m
+	}
+}
+
+// MonitorConfig configures a Monitor.
+type MonitorConfig struct {
+	// TopN is the number of most limited keys reported.
+	// Default: 10.
+	TopN int
+
+	// Window is the period over which the most limited keys are counted;
+	// the report covers the current and the previous window, so it shows
+	// who is being limited right now.
+	// Default: 1 minute.
+	Window time.Duration
+
+	// HashKey hides keys (client IPs, API keys) in reports.
+	// Default: the first 16 hex digits of the key's SHA-256. IPv4 keys are
+	// easy to brute force from an unsalted hash; use a keyed hash (HMAC)
+	// if reports leave the operators' hands.
+	HashKey func(key string) string
+
+	// Store, when it reports its size with a Len() int method (as
+	// MemoryStore does), is included in reports, along with its memory
+	// usage if it has a MemoryStats method.
+	// Default: nil (size not reported).
+	Store store.Store
+}
+
+// Monitor collects live rate limiting counters for operators: decisions,
+// per-endpoint denial rates, the most limited keys and fail-open
+// occurrences. Share one Monitor between middlewares with WithMonitor and
+// expose it with Handler or Var, on an internal listener.
+type Monitor struct {
+	config MonitorConfig
+
+	allowed  atomic.Uint64
+	denied   atomic.Uint64
+	failOpen atomic.Uint64
+
+	mu        sync.RWMutex
+	endpoints map[string]*endpointCounters
+
+	topMu    sync.Mutex
+	curr     *topKeys
+	prev     *topKeys
+	rotateAt time.Time
+}
+
+// endpointCounters are the live counters of an endpoint.
+type endpointCounters struct {
+	allowed  atomic.Uint64
+	denied   atomic.Uint64
+	failOpen atomic.Uint64
+}
+
+// MonitorSnapshot is a point-in-time report of a Monitor.
+type MonitorSnapshot struct {
+	Allowed    uint64                   `json:"allowed"`
+	Denied     uint64                   `json:"denied"`
+	FailOpen   uint64                   `json:"fail_open"`
+	StoreSize  int                      `json:"store_size"` // -1 if unknown
+	StoreMem   *store.MemoryStats       `json:"store_memory,omitempty"`
+	Endpoints  map[string]EndpointStats `json:"endpoints"`
+	TopLimited []LimitedKey             `json:"top_limited"`
+}
+
+// EndpointStats are the counters of an endpoint.
+type EndpointStats struct {
+	Allowed    uint64  `json:"allowed"`
+	Denied     uint64  `json:"denied"`
+	FailOpen   uint64  `json:"fail_open"`
+	DenialRate float64 `json:"denial_rate"` // Denied / (Allowed + Denied)
+}
+
+// LimitedKey is a frequently limited key.
+type LimitedKey struct {
+	Key    string `json:"key"` // Hashed with MonitorConfig.HashKey
+	Denied uint64 `json:"denied"`
+}
+
+// NewMonitor creates a monitor.
+func NewMonitor(config MonitorConfig) *Monitor {
+	if config.TopN <= 0 {
+		config.TopN = 10
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.HashKey == nil {
+		config.HashKey = hashKey
+	}
+
+	// Track more keys than reported so the top N are accurate
+	capacity := config.TopN * 10
+	return &Monitor{
+		config:    config,
+		endpoints: make(map[string]*endpointCounters),
+		curr:      newTopKeys(capacity),
+		prev:      newTopKeys(capacity),
+		rotateAt:  time.Now().Add(config.Window),
+	}
+}
+
+// hashKey returns the first 16 hex digits of the SHA-256 of key.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// record counts a decision for key on endpoint.
+func (m *Monitor) record(endpoint, key string, allowed bool) {
+	c := m.endpoint(endpoint)
+	if allowed {
+		m.allowed.Add(1)
+		c.allowed.Add(1)
+		return
+	}
+	m.denied.Add(1)
+	c.denied.Add(1)
+
+	m.topMu.Lock()
+	m.rotate(time.Now())
+	m.curr.add(key)
+	m.topMu.Unlock()
+}
+
+// recordFailOpen counts a request let through because the limiter failed.
+func (m *Monitor) recordFailOpen(endpoint string) {
+	m.failOpen.Add(1)
+	m.endpoint(endpoint).failOpen.Add(1)
+}
+
+// endpoint returns the counters of name, creating them if needed.
+func (m *Monitor) endpoint(name string) *endpointCounters {
+	m.mu.RLock()
+	c, ok := m.endpoints[name]
+	m.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok = m.endpoints[name]; !ok {
+		c = &endpointCounters{}
+		m.endpoints[name] = c
+	}
+	return c
+}
+
+// rotate starts a new top keys window if the current one is over.
+// m.topMu must be held.
+func (m *Monitor) rotate(now time.Time) {
+	if now.Before(m.rotateAt) {
+		return
+	}
+	if now.Sub(m.rotateAt) >= m.config.Window {
+		// Idle for more than a window: the previous one is stale too
+		m.prev = newTopKeys(m.curr.capacity)
+	} else {
+		m.prev = m.curr
+	}
+	m.curr = newTopKeys(m.curr.capacity)
+	m.rotateAt = now.Add(m.config.Window)
+}
+
+// Snapshot returns the current counters.
+func (m *Monitor) Snapshot() MonitorSnapshot {
+	snap := MonitorSnapshot{
+		Allowed:   m.allowed.Load(),
+		Denied:    m.denied.Load(),
+		FailOpen:  m.failOpen.Load(),
+		StoreSize: -1,
+		Endpoints: make(map[string]EndpointStats),
+	}
+
+	if l, ok := m.config.Store.(interface{ Len() int }); ok {
+		snap.StoreSize = l.Len()
+	}
+	if ms, ok := m.config.Store.(interface{ MemoryStats() store.MemoryStats }); ok {
+		stats := ms.MemoryStats()
+		snap.StoreMem = &stats
+	}
+
+	m.mu.RLock()
+	for name, c := range m.endpoints {
+		stats := EndpointStats{
+			Allowed:  c.allowed.Load(),
+			Denied:   c.denied.Load(),
+			FailOpen: c.failOpen.Load(),
+		}
+		if total := stats.Allowed + stats.Denied; total > 0 {
+			stats.DenialRate = float64(stats.Denied) / float64(total)
+		}
+		snap.Endpoints[name] = stats
+	}
+	m.mu.RUnlock()
+
+	// Merge the previous and current windows
+	counts := make(map[string]uint64)
+	m.topMu.Lock()
+	m.rotate(time.Now())
+	for key, n := range m.prev.counts {
+		counts[key] += n
+	}
+	for key, n := range m.curr.counts {
+		counts[key] += n
+	}
+	m.topMu.Unlock()
+
+	snap.TopLimited = make([]LimitedKey, 0, len(counts))
+	for key, n := range counts {
+		snap.TopLimited = append(snap.TopLimited, LimitedKey{Key: m.config.HashKey(key), Denied: n})
+	}
+	sort.Slice(snap.TopLimited, func(i, j int) bool {
+		if snap.TopLimited[i].Denied != snap.TopLimited[j].Denied {
+			return snap.TopLimited[i].Denied > snap.TopLimited[j].Denied
+		}
+		return snap.TopLimited[i].Key < snap.TopLimited[j].Key
+	})
+	if len(snap.TopLimited) > m.config.TopN {
+		snap.TopLimited = snap.TopLimited[:m.config.TopN]
+	}
+	return snap
+}
+
+// Handler returns an HTTP handler serving the snapshot as JSON. It exposes
+// traffic patterns: mount it on an internal listener or behind authentication.
+func (m *Monitor) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(m.Snapshot())
+	})
+}
+
+// Var returns the snapshot as an expvar.Var, e.g.
+// expvar.Publish("ratelimit", monitor.Var()).
+func (m *Monitor) Var() expvar.Var {
+	return expvar.Func(func() any { return m.Snapshot() })
+}
+
+// topKeys approximates the most frequent keys in bounded memory with the
+// Space-Saving algorithm: when full, a new key replaces the least frequent
+// one and inherits its count, so heavy hitters are never missed.
+type topKeys struct {
+	capacity int
+	counts   map[string]uint64
+}
+
+// newTopKeys creates a tracker of up to capacity keys.
+func newTopKeys(capacity int) *topKeys {
+	return &topKeys{capacity: capacity, counts: make(map[string]uint64, capacity)}
+}
+
+// add counts one occurrence of key.
+func (t *topKeys) add(key string) {
+	if _, ok := t.counts[key]; ok || len(t.counts) < t.capacity {
+		t.counts[key]++
+		return
+	}
+
+	var minKey string
+	var minCount uint64
+	first := true
+	for k, n := range t.counts {
+		if first || n < minCount {
+			minKey, minCount, first = k, n, false
+		}
+	}
+	delete(t.counts, minKey)
+	t.counts[key] = minCount + 1
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestMonitor_RateLimitMiddleware(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 2, Window: time.Minute}, s)
+
+	m := NewMonitor(MonitorConfig{Store: s, HashKey: func(key string) string { return "h(" + key + ")" }})
+	handler := RateLimitMiddleware(limiter, WithMonitor(m))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, ip := range []string{"1.1.1.1", "1.1.1.1", "1.1.1.1", "1.1.1.1", "2.2.2.2", "2.2.2.2", "2.2.2.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	snap := m.Snapshot()
+	if snap.Allowed != 4 || snap.Denied != 3 {
+		t.Errorf("Expected 4 allowed and 3 denied, got %d and %d", snap.Allowed, snap.Denied)
+	}
+	if snap.StoreSize != 2 {
+		t.Errorf("Expected store size 2, got %d", snap.StoreSize)
+	}
+	if snap.StoreMem == nil || snap.StoreMem.Entries != 2 {
+		t.Errorf("Expected store memory stats with 2 entries, got %+v", snap.StoreMem)
+	}
+	ep := snap.Endpoints[defaultEndpointName]
+	if ep.Denied != 3 || ep.DenialRate != 3.0/7 {
+		t.Errorf("Unexpected endpoint stats: %+v", ep)
+	}
+	want := []LimitedKey{{Key: "h(1.1.1.1)", Denied: 2}, {Key: "h(2.2.2.2)", Denied: 1}}
+	if fmt.Sprint(snap.TopLimited) != fmt.Sprint(want) {
+		t.Errorf("Expected top limited %v, got %v", want, snap.TopLimited)
+	}
+}
+
+func TestMonitor_FailOpen(t *testing.T) {
+	limiter := &MockLimiter{AllowFunc: func(key string) (bool, error) { return false, errors.New("backend down") }}
+	m := NewMonitor(MonitorConfig{})
+	handler := RateLimitMiddleware(limiter, WithMonitor(m))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	snap := m.Snapshot()
+	if snap.FailOpen != 1 || snap.Endpoints[defaultEndpointName].FailOpen != 1 {
+		t.Errorf("Expected one fail-open, got %+v", snap)
+	}
+	if snap.StoreSize != -1 {
+		t.Errorf("Expected unknown store size, got %d", snap.StoreSize)
+	}
+}
+
+func TestMonitor_RouterEndpoints(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	m := NewMonitor(MonitorConfig{})
+	router, _ := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{
+		{Path: "/login", Config: ratelimiter.Config{Rate: 1, Window: time.Minute}},
+		{Path: "/api/*", Config: ratelimiter.Config{Rate: 10, Window: time.Minute}},
+	}, WithMonitor(m))
+	defer router.Close()
+
+	for _, p := range []string{"/login", "/login", "/api/a", "/api/b"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	snap := m.Snapshot()
+	if got := snap.Endpoints["/login"]; got.Allowed != 1 || got.Denied != 1 || got.DenialRate != 0.5 {
+		t.Errorf("Unexpected /login stats: %+v", got)
+	}
+	if got := snap.Endpoints["/api/*"]; got.Allowed != 2 || got.Denied != 0 {
+		t.Errorf("Unexpected /api/* stats: %+v", got)
+	}
+	// Keys are reported as returned by the key function, like in History
+	if len(snap.TopLimited) != 1 || snap.TopLimited[0].Key != hashKey("192.0.2.1") {
+		t.Errorf("Expected the client key to be reported, got %v", snap.TopLimited)
+	}
+}
+
+func TestMonitor_HashesKeysByDefault(t *testing.T) {
+	m := NewMonitor(MonitorConfig{})
+	m.record("*", "1.2.3.4", false)
+
+	snap := m.Snapshot()
+	if len(snap.TopLimited) != 1 || snap.TopLimited[0].Key != hashKey("1.2.3.4") || len(snap.TopLimited[0].Key) != 16 {
+		t.Errorf("Expected hashed key, got %v", snap.TopLimited)
+	}
+}
+
+func TestMonitor_WindowRotation(t *testing.T) {
+	m := NewMonitor(MonitorConfig{Window: time.Minute})
+	m.record("*", "old", false)
+
+	// One window later the key is still reported from the previous window
+	m.topMu.Lock()
+	m.rotate(m.rotateAt)
+	m.topMu.Unlock()
+	if snap := m.Snapshot(); len(snap.TopLimited) != 1 {
+		t.Fatalf("Expected key from the previous window, got %v", snap.TopLimited)
+	}
+
+	// After two windows it is gone
+	m.topMu.Lock()
+	m.rotate(m.rotateAt)
+	m.topMu.Unlock()
+	if snap := m.Snapshot(); len(snap.TopLimited) != 0 {
+		t.Errorf("Expected no keys after two windows, got %v", snap.TopLimited)
+	}
+}
+
+func TestMonitor_Handler(t *testing.T) {
+	m := NewMonitor(MonitorConfig{})
+	m.record("*", "k", true)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/ratelimit", nil))
+
+	var snap MonitorSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if snap.Allowed != 1 {
+		t.Errorf("Expected 1 allowed, got %d", snap.Allowed)
+	}
+	if err := json.Unmarshal([]byte(m.Var().String()), &snap); err != nil {
+		t.Errorf("Invalid expvar JSON: %v", err)
+	}
+}
+
+func TestTopKeys_KeepsHeavyHitters(t *testing.T) {
+	top := newTopKeys(4)
+	for i := 0; i < 1000; i++ {
+		top.add("heavy")
+		top.add(fmt.Sprintf("noise-%d", i))
+	}
+	if len(top.counts) != 4 {
+		t.Errorf("Expected bounded size 4, got %d", len(top.counts))
+	}
+	if top.counts["heavy"] < 1000 {
+		t.Errorf("Expected heavy hitter to be kept with count >= 1000, got %d", top.counts["heavy"])
+	}
+}
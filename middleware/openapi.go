@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// OpenAPIExtension is the vendor extension declaring the limits of an
+// operation, or of every operation of a path item, in an OpenAPI document.
+const OpenAPIExtension = "x-ratelimit"
+
+// openAPIMethods are the operations of an OpenAPI path item, in the order
+// their endpoints are listed.
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// openAPIDocument is the part of an OpenAPI 3 document that declares limits.
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// OpenAPIEndpointSpecs reads the limits declared in an OpenAPI 3 document
+// (JSON; YAML documents must be converted by the application), so that the
+// API definition stays the single source of truth for limits. Limits are
+// declared by an x-ratelimit extension on operations, or on path items for
+// all their operations without one, with the fields of an EndpointSpec
+// except path and methods:
+//
+//	"paths": {
+//	  "/search": {
+//	    "get": {"x-ratelimit": {"rate": "100/m", "keyHeader": "X-API-Key"}}
+//	  },
+//	  "/users/{id}": {
+//	    "x-ratelimit": {"rate": 10, "window": "1s"}
+//	  }
+//	}
+//
+// Paths are prefixed with the path of the first server URL, if any. Each
+// operation gets its own endpoint and limits, keyed by path template and
+// method: /users/{id} matches /users/42 but not /users/42/posts. Segments
+// mixing text and parameters (/files/{name}.json) match any segment.
+// Operations without limits are not rate limited. Limits of different
+// operations that end up on the same path and method return an
+// ErrInvalidSpec error instead of shadowing each other.
+func OpenAPIEndpointSpecs(r io.Reader) ([]EndpointSpec, error) {
+	var doc openAPIDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: openapi: %w", ErrInvalidSpec, err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("%w: openapi: unsupported version %q", ErrInvalidSpec, doc.OpenAPI)
+	}
+
+	base := ""
+	if len(doc.Servers) > 0 {
+		u, err := url.Parse(doc.Servers[0].URL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: openapi: server URL: %w", ErrInvalidSpec, err)
+		}
+		base = strings.TrimSuffix(u.Path, "/")
+	}
+
+	var specs []EndpointSpec
+	declared := make(map[string]string) // Template declaring each path and method
+	add := func(template, method string, raw json.RawMessage) error {
+		var spec EndpointSpec
+		if err := json.Unmarshal(raw, &spec); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidSpec, template, err)
+		}
+		spec.Path = base + openAPIPath(template)
+		spec.Methods = []string{strings.ToUpper(method)}
+
+		key := spec.Path + " " + spec.Methods[0]
+		if other, ok := declared[key]; ok && other != template {
+			return fmt.Errorf("%w: %s and %s both limit %s", ErrInvalidSpec, other, template, key)
+		}
+		declared[key] = template
+		specs = append(specs, spec)
+		return nil
+	}
+
+	templates := make([]string, 0, len(doc.Paths))
+	for template := range doc.Paths {
+		templates = append(templates, template)
+	}
+	slices.Sort(templates)
+
+	for _, template := range templates {
+		item := doc.Paths[template]
+		for _, method := range openAPIMethods {
+			op, ok := item[method]
+			if !ok {
+				continue
+			}
+			var operation map[string]json.RawMessage
+			if err := json.Unmarshal(op, &operation); err != nil {
+				return nil, fmt.Errorf("%w: %s %s: %w", ErrInvalidSpec, method, template, err)
+			}
+			// Operations without their own limits get those of the path item
+			raw, ok := operation[OpenAPIExtension]
+			if !ok {
+				raw, ok = item[OpenAPIExtension]
+			}
+			if ok {
+				if err := add(template, method, raw); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return specs, nil
+}
+
+// openAPIPath converts an OpenAPI path template to an EndpointConfig path,
+// turning segments with parameters into {param} segments.
+func openAPIPath(template string) string {
+	segments := strings.Split(template, "/")
+	for i, segment := range segments {
+		if strings.Contains(segment, "{") && !isParamSegment(segment) {
+			segments[i] = "{param}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// NewRouterFromOpenAPI creates a router whose endpoints are the limits
+// declared in an OpenAPI 3 document (see OpenAPIEndpointSpecs).
+func NewRouterFromOpenAPI(handler http.Handler, s store.Store, r io.Reader, opts ...Option) (*Router, error) {
+	specs, err := OpenAPIEndpointSpecs(r)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := EndpointConfigs(specs)
+	if err != nil {
+		return nil, err
+	}
+	return NewRouter(handler, s, endpoints, opts...)
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+const testOpenAPI = `{
+	"openapi": "3.0.3",
+	"servers": [{"url": "https://api.example.com/v1"}],
+	"paths": {
+		"/search": {
+			"get": {"operationId": "search", "x-ratelimit": {"rate": "2/m", "keyHeader": "X-API-Key"}},
+			"post": {"operationId": "index"}
+		},
+		"/users/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true}],
+			"x-ratelimit": {"rate": 1, "window": "1m"},
+			"get": {"operationId": "getUser"},
+			"delete": {"operationId": "deleteUser", "x-ratelimit": {"rate": 2, "window": "1m"}}
+		},
+		"/users/{id}/posts": {
+			"get": {"operationId": "listPosts"}
+		},
+		"/files/{name}.json": {
+			"get": {"operationId": "getFile", "x-ratelimit": {"rate": 1, "window": "1m"}}
+		}
+	}
+}`
+
+func TestOpenAPIEndpointSpecs(t *testing.T) {
+	specs, err := OpenAPIEndpointSpecs(strings.NewReader(testOpenAPI))
+	if err != nil {
+		t.Fatalf("OpenAPIEndpointSpecs failed: %v", err)
+	}
+	if len(specs) != 4 {
+		t.Fatalf("Expected 4 specs, got %+v", specs)
+	}
+
+	search := specs[1]
+	if search.Path != "/v1/search" || !slices.Equal(search.Methods, []string{"GET"}) || search.Rate != 2 || search.KeyHeader != "X-API-Key" {
+		t.Errorf("Unexpected /search spec: %+v", search)
+	}
+	for i, want := range []struct {
+		path, method string
+		rate         int
+	}{
+		{"/v1/files/{param}", "GET", 1},
+		{"/v1/search", "GET", 2},
+		{"/v1/users/{id}", "GET", 1},
+		{"/v1/users/{id}", "DELETE", 2},
+	} {
+		spec := specs[i]
+		if spec.Path != want.path || !slices.Equal(spec.Methods, []string{want.method}) || spec.Rate != want.rate {
+			t.Errorf("Expected %s %s limited to %d, got %+v", want.method, want.path, want.rate, spec)
+		}
+	}
+}
+
+func TestOpenAPIEndpointSpecs_Invalid(t *testing.T) {
+	for name, doc := range map[string]string{
+		"swagger 2": `{"swagger": "2.0", "paths": {}}`,
+		"not JSON":  `openapi: 3.0.3`,
+		"collision": `{"openapi": "3.1.0", "paths": {
+			"/files/{name}.json": {"get": {"x-ratelimit": {"rate": 1, "window": "1m"}}},
+			"/files/{name}.xml": {"get": {"x-ratelimit": {"rate": 2, "window": "1m"}}}
+		}}`,
+	} {
+		if _, err := OpenAPIEndpointSpecs(strings.NewReader(doc)); !errors.Is(err, ErrInvalidSpec) {
+			t.Errorf("%s: expected ErrInvalidSpec, got %v", name, err)
+		}
+	}
+}
+
+func TestNewRouterFromOpenAPI(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	router, err := NewRouterFromOpenAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, strings.NewReader(testOpenAPI))
+	if err != nil {
+		t.Fatalf("NewRouterFromOpenAPI failed: %v", err)
+	}
+	defer router.Close()
+
+	serve := func(method, path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec.Code
+	}
+	if serve("GET", "/v1/users/42") != http.StatusOK || serve("GET", "/v1/users/43") != http.StatusTooManyRequests {
+		t.Error("Expected GET /v1/users/{id} to be limited to 1 request per minute")
+	}
+	// DELETE has its own limits, kept apart from those of GET
+	if serve("DELETE", "/v1/users/42") != http.StatusOK || serve("DELETE", "/v1/users/42") != http.StatusOK ||
+		serve("DELETE", "/v1/users/42") != http.StatusTooManyRequests {
+		t.Error("Expected DELETE /v1/users/{id} to be limited to 2 requests per minute")
+	}
+	// Nested templates without limits are not rate limited by their parent
+	for i := 0; i < 3; i++ {
+		if code := serve("GET", "/v1/users/42/posts"); code != http.StatusOK {
+			t.Errorf("Expected /v1/users/{id}/posts to be served, got %d", code)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if code := serve("POST", "/v1/search"); code != http.StatusOK {
+			t.Errorf("Expected operations without limits to be served, got %d", code)
+		}
+	}
+}
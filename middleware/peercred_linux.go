@@ -0,0 +1,32 @@
+//go:build linux
+
+package middleware
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCred reads SO_PEERCRED from a Unix domain socket connection.
+func peerCred(c net.Conn) (PeerCred, bool) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return PeerCred{}, false
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return PeerCred{}, false
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return PeerCred{}, false
+	}
+
+	return PeerCred{PID: int(cred.Pid), UID: int(cred.Uid), GID: int(cred.Gid)}, true
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package middleware
+
+import "net"
+
+// peerCred is not supported on this platform.
+func peerCred(c net.Conn) (PeerCred, bool) {
+	return PeerCred{}, false
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Provider describes a CDN or platform that reports the client IP in a request header.
+type Provider struct {
+	// Name is a human-readable name of the provider.
+	Name string
+
+	// Header is the request header carrying the client IP.
+	Header string
+}
+
+// Well-known client IP header providers.
+var (
+	// ProviderCloudflare reads CF-Connecting-IP set by Cloudflare.
+	ProviderCloudflare = Provider{Name: "cloudflare", Header: "CF-Connecting-IP"}
+
+	// ProviderAkamai reads True-Client-IP set by Akamai (and Cloudflare Enterprise).
+	ProviderAkamai = Provider{Name: "akamai", Header: "True-Client-IP"}
+
+	// ProviderAzure reads X-Azure-ClientIP set by Azure Front Door.
+	ProviderAzure = Provider{Name: "azure", Header: "X-Azure-ClientIP"}
+
+	// ProviderFly reads Fly-Client-IP set by Fly.io.
+	ProviderFly = Provider{Name: "fly", Header: "Fly-Client-IP"}
+
+	// ProviderFastly reads Fastly-Client-IP set by Fastly.
+	ProviderFastly = Provider{Name: "fastly", Header: "Fastly-Client-IP"}
+)
+
+// ProviderKeyFunc returns a KeyFunc that reads the client IP from the provider's header.
+//
+// If trustedRanges is non-empty, the header is only honored when RemoteAddr
+// belongs to one of the ranges (IPs or CIDR blocks), which should be the
+// provider's published edge ranges. Otherwise anyone reaching the origin
+// directly could spoof the header. With no ranges, the header is always trusted.
+//
+// The header value is validated and canonicalized. If it is missing, too long
+// or not a valid IP, the key falls back to the RemoteAddr IP.
+func ProviderKeyFunc(p Provider, trustedRanges []string) (KeyFunc, error) {
+	prefixes, err := parseTrustedProxies(trustedRanges)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.CanonicalHeaderKey(p.Header)
+
+	return func(r *http.Request) string {
+		remoteIP := getRemoteIP(r)
+
+		if len(prefixes) > 0 {
+			addr, ok := parseHopIP(remoteIP)
+			if !ok || !containsAddr(prefixes, addr) {
+				return remoteIP
+			}
+		}
+
+		v := strings.TrimSpace(r.Header.Get(header))
+		if v == "" || len(v) > maxIPLength {
+			return remoteIP
+		}
+		if canonical, ok := canonicalizeIP(stripIPPort(v)); ok {
+			return canonical
+		}
+		return remoteIP
+	}, nil
+}
+
+// CloudflareKeyFunc returns a KeyFunc for services behind Cloudflare.
+// trustedRanges should contain Cloudflare's published IP ranges.
+func CloudflareKeyFunc(trustedRanges []string) (KeyFunc, error) {
+	return ProviderKeyFunc(ProviderCloudflare, trustedRanges)
+}
+
+// AkamaiKeyFunc returns a KeyFunc for services behind Akamai.
+// trustedRanges should contain the Akamai edge ranges that can reach the origin.
+func AkamaiKeyFunc(trustedRanges []string) (KeyFunc, error) {
+	return ProviderKeyFunc(ProviderAkamai, trustedRanges)
+}
+
+// AzureFrontDoorKeyFunc returns a KeyFunc for services behind Azure Front Door.
+// trustedRanges should contain the AzureFrontDoor.Backend service tag ranges.
+func AzureFrontDoorKeyFunc(trustedRanges []string) (KeyFunc, error) {
+	return ProviderKeyFunc(ProviderAzure, trustedRanges)
+}
+
+// FlyKeyFunc returns a KeyFunc for services running on Fly.io.
+// trustedRanges should contain the Fly proxy ranges (may be empty on the private network).
+func FlyKeyFunc(trustedRanges []string) (KeyFunc, error) {
+	return ProviderKeyFunc(ProviderFly, trustedRanges)
+}
+
+// FastlyKeyFunc returns a KeyFunc for services behind Fastly.
+// trustedRanges should contain Fastly's published IP ranges.
+func FastlyKeyFunc(trustedRanges []string) (KeyFunc, error) {
+	return ProviderKeyFunc(ProviderFastly, trustedRanges)
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProviderKeyFunc(t *testing.T) {
+	cf, err := CloudflareKeyFunc([]string{"173.245.48.0/20", "2400:cb00::/32"})
+	if err != nil {
+		t.Fatalf("Failed to create key func: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		want       string
+	}{
+		{"trusted edge", "173.245.48.10:443", "198.51.100.7", "198.51.100.7"},
+		{"trusted ipv6 edge", "[2400:cb00::1]:443", "2001:db8::1", "2001:db8::1"},
+		{"canonicalizes header", "173.245.48.10:443", "::ffff:198.51.100.7", "198.51.100.7"},
+		{"untrusted remote is not spoofable", "203.0.113.9:443", "1.1.1.1", "203.0.113.9"},
+		{"missing header falls back", "173.245.48.10:443", "", "173.245.48.10"},
+		{"invalid header falls back", "173.245.48.10:443", "not-an-ip", "173.245.48.10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set("CF-Connecting-IP", tt.header)
+			}
+			if got := cf(req); got != tt.want {
+				t.Errorf("keyFunc() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderKeyFunc_NoRanges(t *testing.T) {
+	tests := []struct {
+		provider Provider
+		header   string
+	}{
+		{ProviderAkamai, "True-Client-IP"},
+		{ProviderAzure, "X-Azure-ClientIP"},
+		{ProviderFly, "Fly-Client-IP"},
+		{ProviderFastly, "Fastly-Client-IP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider.Name, func(t *testing.T) {
+			fn, err := ProviderKeyFunc(tt.provider, nil)
+			if err != nil {
+				t.Fatalf("Failed to create key func: %v", err)
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set(tt.header, "198.51.100.7")
+			if got := fn(req); got != "198.51.100.7" {
+				t.Errorf("keyFunc() = %q, want 198.51.100.7", got)
+			}
+		})
+	}
+}
+
+func TestProviderKeyFunc_InvalidRange(t *testing.T) {
+	if _, err := FlyKeyFunc([]string{"bogus"}); err == nil {
+		t.Error("Expected error for invalid range")
+	}
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// defaultMaxQueryValues is the default number of distinct values of each
+// KeyQuery parameter that get their own limits.
+const defaultMaxQueryValues = 100
+
+// queryOverflow replaces the values of a KeyQuery parameter past
+// MaxQueryValues in keys, so they share a single limit.
+const queryOverflow = "~"
+
+// matchQuery reports whether rawQuery has every parameter of conditions with
+// the required value, or with any value if the required value is empty.
+func matchQuery(rawQuery string, conditions map[string]string) bool {
+	for name, want := range conditions {
+		value, ok := queryValue(rawQuery, name)
+		if !ok || (want != "" && value != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryValue returns the first value of the named parameter of rawQuery. It
+// does not allocate unless the parameter is escaped.
+func queryValue(rawQuery, name string) (string, bool) {
+	for rawQuery != "" {
+		var param string
+		param, rawQuery, _ = strings.Cut(rawQuery, "&")
+		key, value, _ := strings.Cut(param, "=")
+		if key != name {
+			if !strings.ContainsAny(key, "%+") {
+				continue
+			}
+			if unescaped, err := url.QueryUnescape(key); err != nil || unescaped != name {
+				continue
+			}
+		}
+		if strings.ContainsAny(value, "%+") {
+			unescaped, err := url.QueryUnescape(value)
+			if err != nil {
+				return "", false
+			}
+			value = unescaped
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// queryKey builds the part of a rate limit key taken from the KeyQuery
+// parameters of an endpoint, bounding the distinct values of each.
+type queryKey struct {
+	params []string
+	max    int
+
+	mu   sync.RWMutex
+	seen map[string]map[string]struct{} // Values given their own limits, by parameter
+}
+
+// newQueryKey returns nil if params is empty.
+func newQueryKey(params []string, max int) *queryKey {
+	if len(params) == 0 {
+		return nil
+	}
+	if max <= 0 {
+		max = defaultMaxQueryValues
+	}
+	q := &queryKey{
+		params: params,
+		max:    max,
+		seen:   make(map[string]map[string]struct{}, len(params)),
+	}
+	for _, p := range params {
+		q.seen[p] = make(map[string]struct{})
+	}
+	return q
+}
+
+// scope returns "?name=value&..." for the KeyQuery parameters of rawQuery.
+// Absent parameters have an empty value, and values past the first max
+// distinct ones of a parameter are replaced by queryOverflow.
+func (q *queryKey) scope(rawQuery string) string {
+	var b strings.Builder
+	for i, p := range q.params {
+		if i == 0 {
+			b.WriteByte('?')
+		} else {
+			b.WriteByte('&')
+		}
+		value, _ := queryValue(rawQuery, p)
+		b.WriteString(p)
+		b.WriteByte('=')
+		b.WriteString(q.admit(p, value))
+	}
+	return b.String()
+}
+
+// admit returns value if it is one of the first max distinct values of
+// param, queryOverflow otherwise.
+func (q *queryKey) admit(param, value string) string {
+	if value == "" {
+		return value
+	}
+
+	q.mu.RLock()
+	_, ok := q.seen[param][value]
+	n := len(q.seen[param])
+	q.mu.RUnlock()
+	if ok {
+		return value
+	}
+	if n >= q.max {
+		return queryOverflow
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	seen := q.seen[param]
+	if _, ok := seen[value]; !ok {
+		if len(seen) >= q.max {
+			return queryOverflow
+		}
+		seen[value] = struct{}{}
+	}
+	return value
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestQueryValue(t *testing.T) {
+	for _, tc := range []struct {
+		query, name, want string
+		ok                bool
+	}{
+		{"deep=true", "deep", "true", true},
+		{"a=1&deep=true&deep=false", "deep", "true", true},
+		{"deep", "deep", "", true},
+		{"deeper=true", "deep", "", false},
+		{"q=a%20b", "q", "a b", true},
+		{"q=a+b", "q", "a b", true},
+		{"d%65ep=1", "deep", "1", true},
+		{"q=%zz", "q", "", false},
+		{"", "q", "", false},
+	} {
+		got, ok := queryValue(tc.query, tc.name)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("queryValue(%q, %q) = %q, %v, expected %q, %v", tc.query, tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestRouter_QueryMatching(t *testing.T) {
+	r := newTestRouter(t, []EndpointConfig{
+		{Path: "/search", Config: ratelimiter.Config{Rate: 100, Window: time.Minute}},
+		{Path: "/search", Query: map[string]string{"deep": "true"}, Config: ratelimiter.Config{Rate: 1, Window: time.Minute}},
+		{Path: "/search", Query: map[string]string{"debug": ""}, Config: ratelimiter.Config{Rate: 2, Window: time.Minute}},
+	})
+
+	for _, tc := range []struct {
+		target string
+		rate   int
+	}{
+		{"/search", 100},
+		{"/search?deep=false", 100},
+		{"/search?q=x&deep=true", 1},
+		{"/search?debug=1", 2},
+		{"/search?debug", 2},
+	} {
+		req := httptest.NewRequest("GET", tc.target, nil)
+		ep := r.matcher.match("/search", req)
+		if ep == nil || ep.config.Config.Rate != tc.rate {
+			t.Errorf("%s: expected the endpoint with rate %d, got %s", tc.target, tc.rate, endpointString(ep))
+		}
+	}
+}
+
+func TestRouter_KeyQuery(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	var keys []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := KeyFromContext(r.Context())
+		keys = append(keys, key)
+	})
+	router, err := NewRouter(handler, s, []EndpointConfig{{
+		Path:           "/api/*",
+		KeyQuery:       []string{"tenant"},
+		MaxQueryValues: 2,
+		Config:         ratelimiter.Config{Rate: 1, Window: time.Minute},
+	}})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	serve := func(target string) int {
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = "192.168.1.1:12345"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Each tenant has its own limit, other parameters are ignored
+	if serve("/api/x?tenant=a&page=1") != http.StatusOK || serve("/api/x?tenant=b") != http.StatusOK {
+		t.Fatal("Expected the first request of each tenant to be allowed")
+	}
+	if code := serve("/api/x?tenant=a&page=2"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second request of tenant a to be limited, got %d", code)
+	}
+	if keys[0] != "192.168.1.1:/api/*?tenant=a" {
+		t.Errorf("Unexpected key %q", keys[0])
+	}
+
+	// Past MaxQueryValues, new tenants share a single limit
+	if code := serve("/api/x?tenant=c"); code != http.StatusOK {
+		t.Fatalf("Expected the first overflow tenant to be allowed, got %d", code)
+	}
+	if code := serve("/api/x?tenant=d"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected overflow tenants to share a limit, got %d", code)
+	}
+}
+
+func TestQueryKey_BoundsCardinality(t *testing.T) {
+	q := newQueryKey([]string{"id"}, 10)
+	for i := 0; i < 1000; i++ {
+		q.scope(fmt.Sprintf("id=%d", i))
+	}
+	if n := len(q.seen["id"]); n != 10 {
+		t.Errorf("Expected 10 tracked values, got %d", n)
+	}
+	if got := q.scope("id=5"); got != "?id=5" {
+		t.Errorf("Expected a tracked value to keep its key, got %q", got)
+	}
+	if got := q.scope("id=999"); got != "?id="+queryOverflow {
+		t.Errorf("Expected an overflow value to be replaced, got %q", got)
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// queuePollInterval is how often a queued request retries when the limiter
+// does not report RetryAfter.
+const queuePollInterval = 10 * time.Millisecond
+
+// WithQueue holds over-limit requests in a FIFO queue of up to size requests
+// per key instead of rejecting them at once. Queued requests are admitted in
+// order as the limit allows; a request is rejected with OnLimited only if the
+// queue of its key is full or it cannot be admitted before its deadline, the
+// earlier of maxWait and the request context deadline. Requests whose
+// RetryAfter already exceeds the deadline are rejected without waiting.
+//
+// Bursty but legitimate clients see latency instead of errors. Each queued
+// request holds its connection and goroutine, so keep size and maxWait small.
+// A maxWait <= 0 defaults to 1 second.
+func WithQueue(size int, maxWait time.Duration) Option {
+	return func(o *Options) {
+		o.QueueSize = size
+		o.QueueTimeout = maxWait
+	}
+}
+
+// requestQueue holds the per-key FIFO queues of a middleware.
+type requestQueue struct {
+	size    int
+	timeout time.Duration
+
+	mu   sync.Mutex
+	keys map[string][]chan struct{} // Waiters in FIFO order; the first one is polling
+}
+
+// newRequestQueue returns the queue configured by o, or nil if queuing is disabled.
+func newRequestQueue(o *Options) *requestQueue {
+	if o.QueueSize <= 0 || o.DryRun {
+		// Dry run: denied requests are let through, never queued
+		return nil
+	}
+	timeout := o.QueueTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &requestQueue{
+		size:    o.QueueSize,
+		timeout: timeout,
+		keys:    make(map[string][]chan struct{}),
+	}
+}
+
+// wait queues a request denied with denied and retries check in FIFO order
+// until it is allowed, fails, or the deadline passes. It returns the last
+// result of check, or denied if the request was not queued.
+func (q *requestQueue) wait(ctx context.Context, key string, denied ratelimiter.Result, check func() (ratelimiter.Result, error)) (ratelimiter.Result, error) {
+	deadline := time.Now().Add(q.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if time.Now().Add(denied.RetryAfter).After(deadline) {
+		return denied, nil
+	}
+
+	turn, ok := q.join(key)
+	if !ok {
+		return denied, nil
+	}
+	defer q.leave(key, turn)
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	// Wait to reach the head of the queue
+	select {
+	case <-turn:
+	case <-timer.C:
+		return denied, nil
+	case <-ctx.Done():
+		return denied, nil
+	}
+
+	result := denied
+	for {
+		// The head may have waited behind others: check before sleeping
+		r, err := check()
+		if err != nil || r.Allowed {
+			return r, err
+		}
+		result = r
+
+		delay := result.RetryAfter
+		if delay <= 0 {
+			delay = queuePollInterval
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return result, nil
+		}
+
+		poll := time.NewTimer(delay)
+		select {
+		case <-poll.C:
+		case <-timer.C:
+			poll.Stop()
+			return result, nil
+		case <-ctx.Done():
+			poll.Stop()
+			return result, nil
+		}
+	}
+}
+
+// join appends a waiter to the queue of key. The returned channel is closed
+// when the waiter reaches the head. It returns false if the queue is full.
+func (q *requestQueue) join(key string) (chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiters := q.keys[key]
+	if len(waiters) >= q.size {
+		return nil, false
+	}
+	turn := make(chan struct{})
+	if len(waiters) == 0 {
+		close(turn)
+	}
+	q.keys[key] = append(waiters, turn)
+	return turn, true
+}
+
+// leave removes a waiter from the queue of key and hands the turn to the
+// next waiter if it was the head.
+func (q *requestQueue) leave(key string, turn chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiters := q.keys[key]
+	for i, w := range waiters {
+		if w != turn {
+			continue
+		}
+		waiters = append(waiters[:i], waiters[i+1:]...)
+		if len(waiters) == 0 {
+			delete(q.keys, key)
+			return
+		}
+		q.keys[key] = waiters
+		if i == 0 {
+			close(waiters[0])
+		}
+		return
+	}
+}
+
+// queued returns the number of requests queued for key.
+func (q *requestQueue) queued(key string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.keys[key])
+}
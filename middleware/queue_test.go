@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRateLimitMiddleware_QueueAdmitsAfterRefill(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	// One token every 100ms
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 10, Window: time.Second, BurstSize: 1}, s)
+
+	handler := RateLimitMiddleware(limiter, WithQueue(2, time.Second))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i+1, rec.Code)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected queued requests to wait for refills, took %v", elapsed)
+	}
+}
+
+func TestRateLimitMiddleware_QueueRejectsBeyondDeadline(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s)
+
+	handler := RateLimitMiddleware(limiter, WithQueue(5, time.Second))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	send()
+	start := time.Now()
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", code)
+	}
+	// RetryAfter (60s) exceeds the 1s deadline: no point in waiting
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected immediate rejection, took %v", elapsed)
+	}
+}
+
+func TestRateLimitMiddleware_QueueHonorsContextDeadline(t *testing.T) {
+	limiter := &MockLimiter{AllowFunc: func(key string) (bool, error) { return false, nil }}
+
+	handler := RateLimitMiddleware(limiter, WithQueue(5, 10*time.Second))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the context deadline to end the wait, took %v", elapsed)
+	}
+}
+
+func TestRateLimitMiddleware_QueueWithoutDetails(t *testing.T) {
+	var calls atomic.Int32
+	limiter := &MockLimiter{AllowFunc: func(key string) (bool, error) {
+		return calls.Add(1) > 3, nil
+	}}
+
+	handler := RateLimitMiddleware(limiter, WithQueue(1, time.Second))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 after polling, got %d", rec.Code)
+	}
+}
+
+func TestRouter_Queue(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{
+		{Path: "/api", Config: ratelimiter.Config{Rate: 10, Window: time.Second, BurstSize: 1}},
+	}, WithQueue(1, time.Second))
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i+1, rec.Code)
+		}
+	}
+}
+
+func TestRequestQueue_FIFOAndCapacity(t *testing.T) {
+	q := newRequestQueue(&Options{QueueSize: 3})
+
+	a, _ := q.join("k")
+	b, _ := q.join("k")
+	c, _ := q.join("k")
+	if _, ok := q.join("k"); ok {
+		t.Fatal("Expected join to fail on a full queue")
+	}
+	if _, ok := q.join("other"); !ok {
+		t.Fatal("Expected queues to be per key")
+	}
+
+	isClosed := func(ch chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+	if !isClosed(a) || isClosed(b) || isClosed(c) {
+		t.Fatal("Expected only the first waiter to hold the turn")
+	}
+
+	// A waiter giving up in the middle does not take the turn
+	q.leave("k", b)
+	if isClosed(c) {
+		t.Fatal("Expected c to wait behind a")
+	}
+
+	q.leave("k", a)
+	if !isClosed(c) {
+		t.Fatal("Expected the turn to pass to c")
+	}
+
+	q.leave("k", c)
+	if n := q.queued("k"); n != 0 {
+		t.Errorf("Expected empty queue, got %d", n)
+	}
+}
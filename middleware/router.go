@@ -1,13 +1,16 @@
 package middleware
 
 import (
+	"context"
 	"errors"
-	"math"
+	"hash/fnv"
 	"net/http"
 	"path"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/Morditux/ratelimiter"
 	"github.com/Morditux/ratelimiter/algorithms"
@@ -19,45 +22,157 @@ type Algorithm string
 
 const (
 	// AlgorithmTokenBucket uses the token bucket algorithm.
-	AlgorithmTokenBucket Algorithm = "token_bucket"
+	AlgorithmTokenBucket Algorithm = algorithms.TokenBucketName
 
 	// AlgorithmSlidingWindow uses the sliding window algorithm.
-	AlgorithmSlidingWindow Algorithm = "sliding_window"
+	AlgorithmSlidingWindow Algorithm = algorithms.SlidingWindowName
+
+	// AlgorithmCountMin uses the approximate count-min sliding window, whose
+	// memory is constant regardless of the number of keys. It keeps its
+	// counts in memory rather than in the router's store.
+	AlgorithmCountMin Algorithm = algorithms.CountMinName
+
+	// AlgorithmSlidingWindowLog uses the exact sliding window log, checked
+	// atomically by a script in the store. It requires a store.ScriptStore,
+	// such as store.RedisStore.
+	AlgorithmSlidingWindowLog Algorithm = algorithms.SlidingWindowLogName
 )
 
+// ErrScriptStoreRequired is returned when AlgorithmSlidingWindowLog is used
+// with a store that does not run scripts.
+var ErrScriptStoreRequired = errors.New("middleware: sliding_window_log requires a store.ScriptStore")
+
 // EndpointConfig holds the rate limit configuration for a specific endpoint.
 type EndpointConfig struct {
 	// Path is the URL path to match.
-	// Supports exact match and prefix match (ending with *).
+	// Supports exact match, templated segments ({param} matches any single
+	// segment, e.g. /users/{id}/posts) and prefix match (ending with *). All
+	// paths matching a template or prefix share the limits of the endpoint:
+	// keys use the pattern, not the request path. Endpoints on the same
+	// path that differ by methods, host, query or headers keep separate
+	// limits.
 	Path string
 
 	// Methods are the HTTP methods to match.
 	// Empty means all methods.
 	Methods []string
 
+	// Host is the request host to match, ignoring case and port: an exact
+	// host name (api.example.com) or a wildcard matching its subdomains
+	// (*.example.com). Each host gets its own limits, so tenants served by
+	// one wildcard endpoint do not share a budget.
+	// Empty means all hosts.
+	Host string
+
+	// Query are query parameters the request must carry to match, by name,
+	// e.g. {"deep": "true"} to limit /search?deep=true more strictly than
+	// /search. An empty value matches any value of the parameter.
+	Query map[string]string
+
+	// Headers are request headers the request must carry to match, by name,
+	// e.g. {"Accept-Version": "v2"} or {"Content-Type": "multipart/form-data"}.
+	// Values are compared ignoring case and parameters after ";". An empty
+	// value matches any value of the header.
+	Headers map[string]string
+
+	// KeyQuery are query parameters whose values get their own limits, e.g.
+	// "tenant" to limit each client per tenant. Other parameters are ignored.
+	KeyQuery []string
+
+	// MaxQueryValues bounds the number of distinct values of each KeyQuery
+	// parameter that get their own limits. Past it, new values share a
+	// single limit, so clients cannot create keys without bound.
+	// Default: 100
+	MaxQueryValues int
+
+	// MaxKeysPerClient bounds the distinct keys each client can use on this
+	// endpoint, one per host of a wildcard Host and per KeyQuery values.
+	// Past it, the client's requests with new hosts or values share a single
+	// limit, so a client cannot create keys without bound. Keys are tracked
+	// approximately and budgets are renewed every window of the endpoint's
+	// limit. Default: 0 (unbounded)
+	MaxKeysPerClient int
+
 	// Config is the rate limit configuration for this endpoint.
 	Config ratelimiter.Config
 
 	// Algorithm is the rate limiting algorithm to use.
 	// Default: AlgorithmTokenBucket
 	Algorithm Algorithm
+
+	// Limits declares several limits enforced together instead of Config
+	// and Algorithm, e.g. 5 per second and 100 per minute. A request is
+	// allowed only if every limit allows it; requests denied by one limit
+	// are not counted by the others.
+	Limits []Limit
+
+	// Profiles replace Config at the times their cron expressions match,
+	// e.g. a stricter limit during business hours; Config applies the rest
+	// of the time. Keys keep their state across transitions (see
+	// algorithms.Scheduled). Profiles cannot be combined with Limits or
+	// AlgorithmCountMin.
+	Profiles []algorithms.Profile
+
+	// Store keeps the state of this endpoint's limits instead of the
+	// router's store, e.g. a memory store for cheap endpoints and a shared
+	// store for limits enforced across instances. It is owned by the caller.
+	// Default: the router's store.
+	Store store.Store
+
+	// NewStore creates the store of this endpoint when the router is
+	// created, if Store is not set. The router owns the stores it creates:
+	// Router.Close and Router.Shutdown close them.
+	NewStore func() (store.Store, error)
+
+	// CountStatus decides from the response status whether a request counts
+	// toward this endpoint's limit (see WithCountStatus), e.g. to only count
+	// failed logins. Default: the router's CountStatus option.
+	CountStatus func(status int) bool
+
+	// KeyFunc extracts the rate limiting key of this endpoint's requests,
+	// e.g. an API key instead of the client IP. IP keys are masked like the
+	// router's (see WithIPv4Prefix). Default: the router's KeyFunc option.
+	KeyFunc KeyFunc
+
+	// OnLimited is called when a request to this endpoint is rate limited.
+	// Default: the router's OnLimited option.
+	OnLimited OnLimitedFunc
 }
 
+// shutdownPollInterval is how often Shutdown checks for in-flight rate limit checks.
+const shutdownPollInterval = 5 * time.Millisecond
+
 // Router is an HTTP handler that applies per-endpoint rate limiting.
 type Router struct {
 	endpoints []endpointLimiter
+	matcher   *endpointMatcher
 	store     store.Store
 	handler   http.Handler
 	options   *Options
+	queue     *requestQueue // Nil unless WithQueue is set
+	headers   headerWriter
+	stores    []store.Store // Endpoint stores created with NewStore
+	inFlight  atomic.Int64  // Rate limit checks currently using the store
+	closing   atomic.Bool   // Set by Shutdown, new requests bypass the limiters
 }
 
 // endpointLimiter holds a compiled endpoint configuration.
 type endpointLimiter struct {
-	config  EndpointConfig
-	limiter ratelimiter.Limiter
+	config     EndpointConfig
+	limiter    ratelimiter.Limiter
+	details    ratelimiter.LimiterWithDetails // Non-nil if limiter supports details
+	keyFunc    KeyFunc                        // The endpoint's or the router's
+	onLimited  OnLimitedFunc                  // The endpoint's or the router's
+	queryKey   *queryKey                      // Nil unless KeyQuery is set
+	scopeLimit *scopeLimit                    // Nil unless MaxKeysPerClient is set
+	blocked    *atomic.Bool                   // Set by SetBlocked
+	keySuffix  string                         // Distinguishes the keys of endpoints sharing a path
+
+	headerValues *headerValues
 }
 
 // NewRouter creates a new router with per-endpoint rate limiting.
+// The store is owned by the caller unless WithStoreOwnership(true) is passed.
 func NewRouter(handler http.Handler, s store.Store, endpoints []EndpointConfig, opts ...Option) (*Router, error) {
 	options := &Options{
 		KeyFunc:    DefaultKeyFunc,
@@ -73,6 +188,13 @@ func NewRouter(handler http.Handler, s store.Store, endpoints []EndpointConfig,
 		options.MaxKeySize = 4096
 	}
 
+	options.KeyFunc = MaskIPKeyFunc(options.KeyFunc, options.IPv4Prefix, options.IPv6Prefix)
+
+	// SetEnabled needs a switch even if WithSwitch was not used
+	if options.Switch == nil {
+		options.Switch = NewSwitch()
+	}
+
 	// Create a copy of endpoints to avoid mutating caller's slice
 	sortedEndpoints := make([]EndpointConfig, len(endpoints))
 	copy(sortedEndpoints, endpoints)
@@ -80,13 +202,19 @@ func NewRouter(handler http.Handler, s store.Store, endpoints []EndpointConfig,
 	// Normalize paths in configuration to prevent bypasses due to mismatched slash handling
 	for i := range sortedEndpoints {
 		sortedEndpoints[i].Path = path.Clean(sortedEndpoints[i].Path)
+		sortedEndpoints[i].Host = strings.ToLower(strings.TrimSuffix(sortedEndpoints[i].Host, "."))
+		sortedEndpoints[i].Headers = canonicalHeaders(sortedEndpoints[i].Headers)
 	}
 
-	// Sort endpoints to prevent shadowing and ensure specificity
+	// Sort endpoints to prevent shadowing and ensure specificity. The
+	// matcher picks the first endpoint in this order that matches.
 	// Order:
 	// 1. Exact matches (no *) before wildcards
 	// 2. Longer paths before shorter paths
-	// 3. Specific methods before all methods
+	// 3. Exact hosts before wildcard hosts before all hosts
+	// 4. More query conditions before fewer
+	// 5. More header conditions before fewer
+	// 6. Specific methods before all methods
 	sort.SliceStable(sortedEndpoints, func(i, j int) bool {
 		a, b := sortedEndpoints[i], sortedEndpoints[j]
 
@@ -102,7 +230,22 @@ func NewRouter(handler http.Handler, s store.Store, endpoints []EndpointConfig,
 			return len(a.Path) > len(b.Path)
 		}
 
-		// 3. Method Specificity (Defined methods > All methods)
+		// 3. Host Specificity (Exact host > Wildcard host > All hosts)
+		if aHost, bHost := hostSpecificity(a.Host), hostSpecificity(b.Host); aHost != bHost {
+			return aHost > bHost
+		}
+
+		// 4. Query Specificity (More query conditions are more specific)
+		if len(a.Query) != len(b.Query) {
+			return len(a.Query) > len(b.Query)
+		}
+
+		// 5. Header Specificity (More header conditions are more specific)
+		if len(a.Headers) != len(b.Headers) {
+			return len(a.Headers) > len(b.Headers)
+		}
+
+		// 6. Method Specificity (Defined methods > All methods)
 		aMethods := len(a.Methods) > 0
 		bMethods := len(b.Methods) > 0
 		if aMethods != bMethods {
@@ -117,137 +260,426 @@ func NewRouter(handler http.Handler, s store.Store, endpoints []EndpointConfig,
 		store:     s,
 		handler:   handler,
 		options:   options,
+		queue:     newRequestQueue(options),
+		headers:   newHeaderWriter(options),
 	}
 
+	keySuffixes := endpointKeySuffixes(sortedEndpoints)
+
 	// Create limiters for each endpoint
-	for _, ep := range sortedEndpoints {
+	for i, ep := range sortedEndpoints {
+		if ep.Store == nil && ep.NewStore != nil {
+			epStore, err := ep.NewStore()
+			if err != nil {
+				r.closeStores()
+				return nil, err
+			}
+			ep.Store = epStore
+			r.stores = append(r.stores, epStore)
+		}
+
 		limiter, err := r.createLimiter(ep)
 		if err != nil {
+			r.closeStores()
 			return nil, err
 		}
 
+		details, _ := limiter.(ratelimiter.LimiterWithDetails)
+		keyFunc := options.KeyFunc
+		if ep.KeyFunc != nil {
+			keyFunc = MaskIPKeyFunc(ep.KeyFunc, options.IPv4Prefix, options.IPv6Prefix)
+		}
+		onLimited := options.OnLimited
+		if ep.OnLimited != nil {
+			onLimited = ep.OnLimited
+		}
 		r.endpoints = append(r.endpoints, endpointLimiter{
-			config:  ep,
-			limiter: limiter,
+			config:     ep,
+			limiter:    limiter,
+			details:    details,
+			keyFunc:    keyFunc,
+			onLimited:  onLimited,
+			queryKey:   newQueryKey(ep.KeyQuery, ep.MaxQueryValues),
+			scopeLimit: newScopeLimit(ep.MaxKeysPerClient, endpointWindow(ep)),
+			blocked:    &atomic.Bool{},
+			keySuffix:  keySuffixes[i],
+
+			headerValues: &headerValues{},
 		})
 	}
+	r.matcher = newEndpointMatcher(r.endpoints)
 
 	return r, nil
 }
 
 // ServeHTTP implements the http.Handler interface.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.options.SkipFunc != nil && r.options.SkipFunc(req) {
+		r.handler.ServeHTTP(w, req)
+		return
+	}
+
+	// Degraded mode: don't pay for a backend known to be down
+	if serveDegraded(w, req, r.handler, r.options) {
+		return
+	}
+
+	// Track in-flight checks for Shutdown. Once shutting down, requests are
+	// passed through without touching the store being closed.
+	r.inFlight.Add(1)
+	if r.closing.Load() {
+		r.inFlight.Add(-1)
+		r.handler.ServeHTTP(w, req)
+		return
+	}
+
 	// Normalize path to prevent bypasses once per request
 	// e.g. //api/sensitive -> /api/sensitive
 	cleanPath := fastPathClean(req.URL.Path)
 
 	// Find matching endpoint
-	for _, ep := range r.endpoints {
-		if r.matchEndpoint(cleanPath, req, ep.config) {
-			key := r.options.KeyFunc(req) + ":" + ep.config.Path
+	if ep := r.matcher.match(cleanPath, req); ep != nil {
+		client := ep.keyFunc(req)
+
+		// Maintenance: shed the load before touching the store
+		if ep.blocked.Load() {
+			r.inFlight.Add(-1)
+			if r.options.Monitor != nil {
+				r.options.Monitor.record(ep.config.Path, client, false)
+			}
+			ep.onLimited(w, req)
+			return
+		}
 
-			// FAIL SECURE: Check key length early to prevent DoS (memory/cpu) in the limiter/store.
-			if len(key) > r.options.MaxKeySize {
-				writeError(w, "Rate limit key too long", http.StatusRequestHeaderFieldsTooLarge)
-				return
+		var host, query string
+		if ep.config.Host != "" {
+			host = strings.ToLower(requestHost(req))
+		}
+		if ep.queryKey != nil {
+			query = ep.queryKey.scope(req.URL.RawQuery)
+		}
+		if ep.scopeLimit != nil && !ep.scopeLimit.admit(client, host+query) {
+			host, query = scopeOverflow, ""
+		}
+		key := client + ":" + host + ep.config.Path + ep.keySuffix + query
+
+		// FAIL SECURE: Check key length early to prevent DoS (memory/cpu) in the limiter/store.
+		if len(key) > r.options.MaxKeySize {
+			r.inFlight.Add(-1)
+			writeError(w, "Rate limit key too long", http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+
+		cost, ok := requestCost(w, req, r.options.CostFunc)
+		if !ok {
+			r.inFlight.Add(-1)
+			return
+		}
+		dryRun := r.options.dryRun()
+
+		// Requests refunded by status use the store until the handler
+		// returns: Shutdown must not close it before
+		countStatus := ep.config.CountStatus
+		if countStatus == nil {
+			countStatus = r.options.CountStatus
+		}
+		_, refunds := ep.limiter.(ratelimiter.Refunder)
+		holdInFlight := refunds && countStatus != nil
+		if holdInFlight {
+			defer r.inFlight.Add(-1)
+		}
+
+		var allowed bool
+		var err error
+		var result ratelimiter.Result
+
+		if ep.details != nil {
+			result, err = ep.details.AllowNWithDetails(key, cost)
+			if err == nil && !result.Allowed && r.queue != nil && !dryRun {
+				result, err = r.queue.wait(req.Context(), key, result, func() (ratelimiter.Result, error) {
+					return ep.details.AllowNWithDetails(key, cost)
+				})
 			}
+			allowed = result.Allowed
 
-			var allowed bool
-			var err error
+			r.headers.write(w, req, result, ep.headerValues)
+			if allowed {
+				warn(w, req, r.options, r.headers, key, result, cost)
+			}
 
-			if detailsLimiter, ok := ep.limiter.(ratelimiter.LimiterWithDetails); ok {
-				var result ratelimiter.Result
-				result, err = detailsLimiter.AllowNWithDetails(key, 1)
+			if !allowed && !dryRun {
+				result.RetryAfter = ratelimiter.AddJitter(result.RetryAfter, r.options.RetryAfterJitter)
+				setRetryAfter(w, result.RetryAfter)
+			}
+		} else {
+			allowed, err = ep.limiter.AllowN(key, cost)
+			if err == nil && !allowed && r.queue != nil && !dryRun {
+				result, err = r.queue.wait(req.Context(), key, result, func() (ratelimiter.Result, error) {
+					ok, err := ep.limiter.AllowN(key, cost)
+					return ratelimiter.Result{Allowed: ok}, err
+				})
 				allowed = result.Allowed
+			}
+			result.Allowed = allowed
+		}
+		if !holdInFlight {
+			r.inFlight.Add(-1)
+		}
 
-				// Set headers
-				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
-				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
-				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.ResetAt.Unix(), 10))
-
-				if !allowed && result.RetryAfter > 0 {
-					seconds := int(math.Ceil(result.RetryAfter.Seconds()))
-					if seconds < 1 {
-						seconds = 1
-					}
-					w.Header().Set("Retry-After", strconv.Itoa(seconds))
-				}
-			} else {
-				allowed, err = ep.limiter.Allow(key)
+		if err != nil {
+			// FAIL SECURE: If the key is too long (likely an attack or misconfiguration),
+			// reject the request with 431 Request Header Fields Too Large.
+			if errors.Is(err, store.ErrKeyTooLong) {
+				writeError(w, "Rate limit key too long", http.StatusRequestHeaderFieldsTooLarge)
+				return
 			}
 
-			if err != nil {
-				// FAIL SECURE: If the key is too long (likely an attack or misconfiguration),
-				// reject the request with 431 Request Header Fields Too Large.
-				if errors.Is(err, store.ErrKeyTooLong) {
-					writeError(w, "Rate limit key too long", http.StatusRequestHeaderFieldsTooLarge)
-					return
-				}
-
-				// FAIL SECURE: If the store is full, we must reject the request to prevent
-				// rate limit bypass. When the store is full, we cannot persist the state,
-				// so we cannot enforce the limit.
-				if errors.Is(err, store.ErrStoreFull) {
-					writeError(w, "Rate limit store full", http.StatusServiceUnavailable)
-					return
-				}
-
-				// Fail open on other errors (e.g. redis down) to ensure system resilience
-				r.handler.ServeHTTP(w, req)
+			// FAIL SECURE: If the store is full, we must reject the request to prevent
+			// rate limit bypass. When the store is full, we cannot persist the state,
+			// so we cannot enforce the limit.
+			if errors.Is(err, store.ErrStoreFull) {
+				writeError(w, "Rate limit store full", http.StatusServiceUnavailable)
 				return
 			}
 
-			if !allowed {
-				r.options.OnLimited(w, req)
+			// FAIL SECURE: A request that costs more than the limiter can ever allow
+			// is a client error, not a transient condition.
+			if errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+				writeError(w, "Request cost exceeds rate limit capacity", http.StatusRequestEntityTooLarge)
 				return
 			}
 
+			// Fail open on other errors (e.g. redis down) to ensure system resilience
+			if r.options.Monitor != nil {
+				r.options.Monitor.recordFailOpen(ep.config.Path)
+			}
 			r.handler.ServeHTTP(w, req)
 			return
 		}
+
+		if r.options.Monitor != nil {
+			r.options.Monitor.record(ep.config.Path, client, allowed)
+		}
+		if r.options.Auditor != nil {
+			r.options.Auditor.record(ep.config.Path, key, result, dryRun)
+		}
+		if r.options.History != nil {
+			r.options.History.record(ep.config.Path, client, result)
+		}
+
+		// Expose the decision to OnLimited and downstream handlers
+		req = withResult(req, key, result)
+
+		if !allowed && !dryRun {
+			ep.onLimited(w, req)
+			return
+		}
+
+		if !checkGlobal(w, req, r.options, dryRun) {
+			return
+		}
+
+		serveCounted(w, req, r.handler, ep.limiter, key, cost, countStatus)
+		return
+	}
+
+	r.inFlight.Add(-1)
+
+	// No matching endpoint, only the global limit applies
+	if !checkGlobal(w, req, r.options, r.options.dryRun()) {
+		return
 	}
 
-	// No matching endpoint, allow request
 	r.handler.ServeHTTP(w, req)
 }
 
-// matchEndpoint checks if a request matches an endpoint configuration.
-func (r *Router) matchEndpoint(cleanPath string, req *http.Request, config EndpointConfig) bool {
-	// Check path
-	if !matchPath(cleanPath, config.Path) {
-		return false
+// hostSpecificity ranks host patterns for endpoint sorting: exact hosts
+// first, then wildcards, then endpoints matching all hosts.
+func hostSpecificity(host string) int {
+	switch {
+	case host == "":
+		return 0
+	case strings.HasPrefix(host, "*"):
+		return 1
+	default:
+		return 2
 	}
+}
 
-	// Check methods if specified
-	if len(config.Methods) > 0 {
-		methodMatch := false
-		for _, method := range config.Methods {
-			if req.Method == method {
-				methodMatch = true
-				break
-			}
+// endpointKeySuffixes returns the key suffix of each endpoint. Endpoints
+// sharing a path with others (differing by methods, host, query or headers)
+// get a suffix derived from their conditions, so that they keep separate
+// state: otherwise endpoints with different limits would reset each other's
+// state (see algorithms.MismatchReset). Endpoints alone on their path keep
+// plain keys. The suffixes only depend on the configuration, so instances
+// sharing a store agree on them.
+func endpointKeySuffixes(endpoints []EndpointConfig) []string {
+	paths := make(map[string]int, len(endpoints))
+	for _, ep := range endpoints {
+		paths[ep.Path]++
+	}
+
+	suffixes := make([]string, len(endpoints))
+	for i, ep := range endpoints {
+		if paths[ep.Path] < 2 {
+			continue
 		}
-		if !methodMatch {
-			return false
+		methods := make([]string, len(ep.Methods))
+		for j, m := range ep.Methods {
+			methods[j] = strings.ToUpper(m)
 		}
+		sort.Strings(methods)
+		conditions := []string{strings.Join(methods, ","), ep.Host, sortedPairs(ep.Query), sortedPairs(ep.Headers)}
+
+		h := fnv.New32a()
+		h.Write([]byte(strings.Join(conditions, "\x00")))
+		suffixes[i] = "#" + strconv.FormatUint(uint64(h.Sum32()), 36)
 	}
+	return suffixes
+}
 
-	return true
+// sortedPairs returns the name=value pairs of m, sorted.
+func sortedPairs(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
 }
 
 // createLimiter creates a rate limiter for an endpoint configuration.
 func (r *Router) createLimiter(config EndpointConfig) (ratelimiter.Limiter, error) {
-	switch config.Algorithm {
+	if len(config.Profiles) > 0 {
+		if len(config.Limits) > 0 {
+			return nil, ErrConflictingLimits
+		}
+		algorithm := string(config.Algorithm)
+		if algorithm == "" {
+			algorithm = algorithms.TokenBucketName
+		}
+		return algorithms.NewScheduled(algorithms.ScheduledConfig{
+			Algorithm: algorithm,
+			Default:   config.Config,
+			Profiles:  config.Profiles,
+		}, r.storeFor(config))
+	}
+	if len(config.Limits) == 0 {
+		return r.createAlgorithm(config.Algorithm, config.Config, r.storeFor(config))
+	}
+	if config.Config.Rate != 0 {
+		return nil, ErrConflictingLimits
+	}
+
+	limiters := make([]ratelimiter.Limiter, len(config.Limits))
+	for i, limit := range config.Limits {
+		l, err := r.createAlgorithm(limit.Algorithm, limit.Config, r.storeFor(config))
+		if err != nil {
+			return nil, err
+		}
+		limiters[i] = l
+	}
+	return newCompositeLimiter(limiters), nil
+}
+
+// endpointWindow returns the longest window of an endpoint's limits, or 0 if
+// none is set.
+func endpointWindow(config EndpointConfig) time.Duration {
+	window := config.Config.Window
+	for _, limit := range config.Limits {
+		window = max(window, limit.Config.Window)
+	}
+	return window
+}
+
+// createAlgorithm creates a rate limiter using the given algorithm.
+func (r *Router) createAlgorithm(algorithm Algorithm, config ratelimiter.Config, s store.Store) (ratelimiter.Limiter, error) {
+	switch algorithm {
 	case AlgorithmSlidingWindow:
-		return algorithms.NewSlidingWindow(config.Config, r.store)
+		return algorithms.NewSlidingWindow(config, s)
+	case AlgorithmCountMin:
+		return algorithms.NewCountMin(config)
+	case AlgorithmSlidingWindowLog:
+		ss, ok := s.(store.ScriptStore)
+		if !ok {
+			return nil, ErrScriptStoreRequired
+		}
+		return algorithms.NewSlidingWindowLog(config, ss)
 	case AlgorithmTokenBucket, "":
-		return algorithms.NewTokenBucket(config.Config, r.store)
+		return algorithms.NewTokenBucket(config, s)
 	default:
-		return algorithms.NewTokenBucket(config.Config, r.store)
+		return algorithms.NewTokenBucket(config, s)
+	}
+}
+
+// storeFor returns the store of an endpoint.
+func (r *Router) storeFor(config EndpointConfig) store.Store {
+	if config.Store != nil {
+		return config.Store
+	}
+	return r.store
+}
+
+// closeStores closes the endpoint stores created by the router.
+func (r *Router) closeStores() error {
+	var errs []error
+	for _, s := range r.stores {
+		errs = append(errs, s.Close())
 	}
+	return errors.Join(errs...)
+}
+
+// SetEnabled turns the enforcement of the router's limits on or off at
+// runtime (see Switch). It changes the switch passed with WithSwitch, if
+// any, and with it the other middlewares sharing it.
+func (r *Router) SetEnabled(enabled bool) {
+	r.options.Switch.SetEnabled(enabled)
 }
 
-// Close releases resources held by the router.
+// Enabled reports whether the router enforces its limits.
+func (r *Router) Enabled() bool {
+	return r.options.Switch.Enabled()
+}
+
+// Close releases resources held by the router: the endpoint stores it
+// created (see EndpointConfig.NewStore), and its store if it owns it (see
+// WithStoreOwnership).
 func (r *Router) Close() error {
-	return r.store.Close()
+	err := r.closeStores()
+	if !r.options.OwnsStore {
+		return err
+	}
+	return errors.Join(err, r.store.Close())
+}
+
+// Shutdown gracefully stops rate limiting and releases the resources held by
+// the router. It is safe to call while requests are in flight: new requests
+// are passed through without rate limiting and Shutdown waits for the running
+// checks to finish, including the refunds of responses not counted (see
+// EndpointConfig.CountStatus). The endpoint stores it created (see
+// EndpointConfig.NewStore) are then shut down (see store.Shutdown), and its
+// store if it owns it (see WithStoreOwnership).
+// If ctx is done first, Shutdown returns the context's error.
+func (r *Router) Shutdown(ctx context.Context) error {
+	r.closing.Store(true)
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for r.inFlight.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var errs []error
+	for _, s := range r.stores {
+		errs = append(errs, store.Shutdown(ctx, s))
+	}
+	if r.options.OwnsStore {
+		errs = append(errs, store.Shutdown(ctx, r.store))
+	}
+	return errors.Join(errs...)
 }
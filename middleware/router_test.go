@@ -1,12 +1,15 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
 	"github.com/Morditux/ratelimiter/store"
 )
 
@@ -397,3 +400,239 @@ func TestRouter_InvalidConfig(t *testing.T) {
 		t.Error("Expected error for invalid config")
 	}
 }
+
+func TestRouter_HostScopedLimits(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router, err := NewRouter(handler, s, []EndpointConfig{
+		{Path: "/api/*", Host: "*.example.com", Config: ratelimiter.Config{Rate: 1, Window: time.Minute}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	defer router.Close()
+
+	serve := func(host string) int {
+		req := httptest.NewRequest("GET", "/api/x", nil)
+		req.Host = host
+		req.RemoteAddr = "192.168.1.1:12345"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Each tenant host has its own budget for the same client
+	if serve("a.example.com") != http.StatusOK || serve("b.example.com") != http.StatusOK {
+		t.Fatal("Expected the first request to each host to be allowed")
+	}
+	if code := serve("A.example.com:443"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second request to a.example.com to be limited, got %d", code)
+	}
+
+	// Other hosts are not rate limited by this endpoint
+	for i := 0; i < 3; i++ {
+		if code := serve("other.org"); code != http.StatusOK {
+			t.Errorf("other.org request %d: expected 200, got %d", i+1, code)
+		}
+	}
+}
+
+func TestRouter_CountMin(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{{
+		Path:      "/api/*",
+		Config:    ratelimiter.Config{Rate: 2, Window: time.Minute},
+		Algorithm: AlgorithmCountMin,
+	}})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/api/x", nil)
+		req.RemoteAddr = "192.168.1.1:1"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("request %d: expected %d, got %d", i+1, want, rec.Code)
+		}
+	}
+}
+
+// scriptStore is a ScriptStore allowing requests until denied is set.
+type scriptStore struct {
+	*store.MemoryStore
+	denied bool
+}
+
+func (s *scriptStore) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	if s.denied {
+		return []interface{}{int64(0), int64(1), int64(0)}, nil
+	}
+	return []interface{}{int64(1), int64(1), int64(0)}, nil
+}
+
+func TestRouter_SlidingWindowLog(t *testing.T) {
+	s := &scriptStore{MemoryStore: store.NewMemoryStore()}
+	defer s.Close()
+
+	endpoints := []EndpointConfig{{
+		Path:      "/api/*",
+		Config:    ratelimiter.Config{Rate: 1, Window: time.Minute},
+		Algorithm: AlgorithmSlidingWindowLog,
+	}}
+	if _, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s.MemoryStore, endpoints); !errors.Is(err, ErrScriptStoreRequired) {
+		t.Fatalf("Expected ErrScriptStoreRequired, got %v", err)
+	}
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, endpoints)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	for _, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/api/x", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("expected %d, got %d", want, rec.Code)
+		}
+		s.denied = true
+	}
+}
+
+func TestRouter_Profiles(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{{
+		Path:   "/api/*",
+		Config: ratelimiter.Config{Rate: 5, Window: time.Minute},
+		Profiles: []algorithms.Profile{
+			{Name: "always", When: "* * * * *", Config: ratelimiter.Config{Rate: 1, Window: time.Minute}},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/x", nil))
+		if rec.Code != want {
+			t.Errorf("Request %d: expected %d from the active profile, got %d", i+1, want, rec.Code)
+		}
+	}
+
+	_, err = NewRouter(http.NotFoundHandler(), s, []EndpointConfig{{
+		Path:     "/",
+		Limits:   []Limit{{Config: ratelimiter.Config{Rate: 1, Window: time.Second}}},
+		Profiles: []algorithms.Profile{{When: "* * * * *", Config: ratelimiter.Config{Rate: 1, Window: time.Second}}},
+	}})
+	if !errors.Is(err, ErrConflictingLimits) {
+		t.Errorf("Expected ErrConflictingLimits, got %v", err)
+	}
+}
+
+func TestRouter_EndpointStores(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	var callerSets, callerClosed, createdClosed int
+	callerStore := &MockStore{
+		SetFunc:   func(string, interface{}, time.Duration) error { callerSets++; return nil },
+		CloseFunc: func() error { callerClosed++; return nil },
+	}
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{
+		{
+			Path:   "/shared",
+			Config: ratelimiter.Config{Rate: 10, Window: time.Minute},
+			Store:  callerStore,
+		},
+		{
+			Path:   "/local",
+			Config: ratelimiter.Config{Rate: 10, Window: time.Minute},
+			NewStore: func() (store.Store, error) {
+				return &MockStore{CloseFunc: func() error { createdClosed++; return nil }}, nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/shared", nil))
+	if callerSets != 1 {
+		t.Errorf("Expected the endpoint state in its own store, got %d sets", callerSets)
+	}
+
+	if err := router.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if createdClosed != 1 || callerClosed != 0 {
+		t.Errorf("Expected only the created store to be closed, got %d created and %d caller closes", createdClosed, callerClosed)
+	}
+
+	_, err = NewRouter(http.NotFoundHandler(), s, []EndpointConfig{{
+		Path:     "/",
+		Config:   ratelimiter.Config{Rate: 1, Window: time.Second},
+		NewStore: func() (store.Store, error) { return nil, errors.New("unreachable") },
+	}})
+	if err == nil {
+		t.Error("Expected the error of NewStore")
+	}
+}
+
+func TestRouter_EndpointsSharingPathKeepSeparateState(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{
+		{Path: "/api", Methods: []string{"GET"}, Config: ratelimiter.Config{Rate: 2, Window: time.Hour}},
+		{Path: "/api", Methods: []string{"POST"}, Config: ratelimiter.Config{Rate: 3, Window: time.Hour}},
+		{Path: "/v", Headers: map[string]string{"Accept-Version": "v1"}, Config: ratelimiter.Config{Rate: 2, Window: time.Hour}},
+		{Path: "/v", Headers: map[string]string{"Accept-Version": "v2"}, Config: ratelimiter.Config{Rate: 3, Window: time.Hour}},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	// Alternating requests must not reset the state of the other endpoint
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		method := []string{"GET", "POST"}[i%2]
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, "/api", nil))
+		if rec.Code == http.StatusOK {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("Methods: %d of 100 requests allowed, want 2 GET and 3 POST", allowed)
+	}
+
+	allowed = 0
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest("GET", "/v", nil)
+		req.Header.Set("Accept-Version", []string{"v1", "v2"}[i%2])
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code == http.StatusOK {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("Headers: %d of 100 requests allowed, want 2 v1 and 3 v2", allowed)
+	}
+}
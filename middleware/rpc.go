@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// rpcLimitedMessage is the error message of rate limited RPCs.
+const rpcLimitedMessage = "rate limit exceeded"
+
+// grpcResourceExhausted is the gRPC status code of rate limited RPCs.
+const grpcResourceExhausted = "8"
+
+// RPCOnLimited is an OnLimitedFunc for servers of gRPC, gRPC-Web and Connect
+// RPCs (e.g. connect-go handlers), whose clients expect errors in their own
+// protocol rather than a plain HTTP 429. Rate limited RPCs fail with the
+// RESOURCE_EXHAUSTED code; other requests get DefaultOnLimited's response.
+//
+// RPCs are served over HTTP at paths of the form /pkg.Service/Method, so
+// Router endpoints limit them per method or per service:
+//
+//	router, err := middleware.NewRouter(mux, s, []middleware.EndpointConfig{
+//		{Path: "/pkg.UserService/CreateUser", Config: strict},
+//		{Path: "/pkg.UserService/*", Config: relaxed},
+//	}, middleware.WithOnLimited(middleware.RPCOnLimited))
+func RPCOnLimited(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc"):
+		writeGRPCLimited(w, contentType)
+	case strings.HasPrefix(contentType, "application/connect+"):
+		writeConnectStreamLimited(w, contentType)
+	case r.Header.Get("Connect-Protocol-Version") != "":
+		writeConnectLimited(w)
+	default:
+		DefaultOnLimited(w, r)
+	}
+}
+
+// writeGRPCLimited writes a trailers-only gRPC (or gRPC-Web) response: the
+// status is carried by headers of an HTTP 200 response without a body.
+func writeGRPCLimited(w http.ResponseWriter, contentType string) {
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Grpc-Status", grpcResourceExhausted)
+	h.Set("Grpc-Message", url.PathEscape(rpcLimitedMessage))
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeConnectLimited writes the error of a Connect unary RPC, which maps
+// resource_exhausted to HTTP 429.
+func writeConnectLimited(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(`{"code":"resource_exhausted","message":"` + rpcLimitedMessage + `"}`))
+}
+
+// writeConnectStreamLimited writes the error of a Connect streaming RPC: an
+// HTTP 200 response holding only the end-of-stream message.
+func writeConnectStreamLimited(w http.ResponseWriter, contentType string) {
+	const endStreamFlag = 0x02
+	msg := `{"error":{"code":"resource_exhausted","message":"` + rpcLimitedMessage + `"}}`
+
+	envelope := make([]byte, 5, 5+len(msg))
+	envelope[0] = endStreamFlag
+	binary.BigEndian.PutUint32(envelope[1:], uint32(len(msg)))
+	envelope = append(envelope, msg...)
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(envelope)
+}
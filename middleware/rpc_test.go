@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRPCOnLimited(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		headers     map[string]string
+		status      int
+		grpcStatus  string
+		body        string
+	}{
+		{name: "grpc", contentType: "application/grpc+proto", status: http.StatusOK, grpcStatus: "8"},
+		{name: "grpc-web", contentType: "application/grpc-web+proto", status: http.StatusOK, grpcStatus: "8"},
+		{
+			name:        "connect unary",
+			contentType: "application/json",
+			headers:     map[string]string{"Connect-Protocol-Version": "1"},
+			status:      http.StatusTooManyRequests,
+			body:        `"code":"resource_exhausted"`,
+		},
+		{name: "connect stream", contentType: "application/connect+json", status: http.StatusOK, body: `"code":"resource_exhausted"`},
+		{name: "plain http", contentType: "application/json", status: http.StatusTooManyRequests, body: `"error":"rate limit exceeded"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/pkg.Service/Method", nil)
+			req.Header.Set("Content-Type", tc.contentType)
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			RPCOnLimited(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, rec.Code)
+			}
+			if got := rec.Header().Get("Grpc-Status"); got != tc.grpcStatus {
+				t.Errorf("Expected Grpc-Status %q, got %q", tc.grpcStatus, got)
+			}
+			if !strings.Contains(rec.Body.String(), tc.body) {
+				t.Errorf("Expected body to contain %s, got %q", tc.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRPCOnLimited_ConnectStreamEnvelope(t *testing.T) {
+	req := httptest.NewRequest("POST", "/pkg.Service/Watch", nil)
+	req.Header.Set("Content-Type", "application/connect+proto")
+	rec := httptest.NewRecorder()
+	RPCOnLimited(rec, req)
+
+	body := rec.Body.Bytes()
+	if len(body) < 5 || body[0] != 0x02 {
+		t.Fatalf("Expected an end-of-stream envelope, got %q", body)
+	}
+	if n := binary.BigEndian.Uint32(body[1:5]); int(n) != len(body)-5 {
+		t.Errorf("Expected envelope length %d, got %d", len(body)-5, n)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/connect+proto" {
+		t.Errorf("Expected the request content type, got %q", got)
+	}
+}
+
+func TestRouter_PerProcedureLimits(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	router, err := NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), s, []EndpointConfig{
+		{Path: "/pkg.UserService/CreateUser", Config: ratelimiter.Config{Rate: 1, Window: time.Minute}},
+		{Path: "/pkg.UserService/*", Config: ratelimiter.Config{Rate: 100, Window: time.Minute}},
+	}, WithOnLimited(RPCOnLimited))
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	defer router.Close()
+
+	call := func(procedure string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", procedure, nil)
+		req.Header.Set("Content-Type", "application/grpc")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	call("/pkg.UserService/CreateUser")
+	if got := call("/pkg.UserService/CreateUser").Header().Get("Grpc-Status"); got != grpcResourceExhausted {
+		t.Errorf("Expected CreateUser to be limited, got Grpc-Status %q", got)
+	}
+	if got := call("/pkg.UserService/GetUser").Header().Get("Grpc-Status"); got != "" {
+		t.Errorf("Expected GetUser to be allowed, got Grpc-Status %q", got)
+	}
+}
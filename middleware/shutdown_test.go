@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+func TestRouter_Shutdown(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var gets, closes atomic.Int32
+
+	s := &MockStore{
+		GetFunc: func(key string) (interface{}, bool) {
+			if gets.Add(1) == 1 {
+				close(entered)
+				<-release
+			}
+			return nil, false
+		},
+		CloseFunc: func() error {
+			closes.Add(1)
+			return nil
+		},
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router, err := NewRouter(handler, s, []EndpointConfig{
+		{Path: "/api/*", Config: ratelimiter.Config{Rate: 10, Window: time.Minute}},
+	}, WithStoreOwnership(true))
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	// A check is in flight when Shutdown starts
+	go router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/a", nil))
+	<-entered
+
+	done := make(chan error, 1)
+	go func() { done <- router.Shutdown(context.Background()) }()
+
+	// New requests bypass the limiter while shutting down
+	waitUntil(t, router.closing.Load)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/b", nil))
+	if rec.Code != http.StatusOK || gets.Load() != 1 {
+		t.Errorf("Expected request to pass through without a store access, got %d (%d gets)", rec.Code, gets.Load())
+	}
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned while a check was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if closes.Load() != 0 {
+		t.Fatal("Store closed while a check was in flight")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if closes.Load() != 1 {
+		t.Errorf("Expected store to be closed once, got %d", closes.Load())
+	}
+}
+
+func TestRouter_ShutdownContextDone(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	entered := make(chan struct{})
+
+	s := &MockStore{
+		GetFunc: func(key string) (interface{}, bool) {
+			close(entered)
+			<-release
+			return nil, false
+		},
+	}
+
+	router, _ := NewRouter(http.NotFoundHandler(), s, []EndpointConfig{
+		{Path: "/", Config: ratelimiter.Config{Rate: 10, Window: time.Minute}},
+	})
+
+	go router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := router.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRouter_StoreOwnership(t *testing.T) {
+	for _, owned := range []bool{false, true} {
+		var closes atomic.Int32
+		s := &MockStore{CloseFunc: func() error {
+			closes.Add(1)
+			return nil
+		}}
+
+		router, err := NewRouter(http.NotFoundHandler(), s, nil, WithStoreOwnership(owned))
+		if err != nil {
+			t.Fatalf("Failed to create router: %v", err)
+		}
+		router.Close()
+		router.Shutdown(context.Background())
+
+		want := int32(0)
+		if owned {
+			want = 2
+		}
+		if closes.Load() != want {
+			t.Errorf("owned=%v: expected %d store closes, got %d", owned, want, closes.Load())
+		}
+	}
+}
+
+// waitUntil polls cond until it holds or the test times out.
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not met before timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRouter_ShutdownWaitsForRefunds(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var closes, setsAfterClose atomic.Int32
+
+	s := &MockStore{
+		SetFunc: func(key string, value interface{}, ttl time.Duration) error {
+			if closes.Load() > 0 {
+				setsAfterClose.Add(1)
+			}
+			return nil
+		},
+		CloseFunc: func() error {
+			closes.Add(1)
+			return nil
+		},
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	router, err := NewRouter(handler, s, []EndpointConfig{{
+		Path:        "/api/*",
+		Config:      ratelimiter.Config{Rate: 10, Window: time.Minute},
+		CountStatus: func(status int) bool { return status < 500 },
+	}}, WithStoreOwnership(true))
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	// The response is refunded once the handler returns
+	served := make(chan struct{})
+	go func() {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/a", nil))
+		close(served)
+	}()
+	<-entered
+
+	done := make(chan error, 1)
+	go func() { done <- router.Shutdown(context.Background()) }()
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned before the refund")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	<-served
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if closes.Load() != 1 || setsAfterClose.Load() != 0 {
+		t.Errorf("Expected the store to be closed once after the refund, got %d closes and %d writes after", closes.Load(), setsAfterClose.Load())
+	}
+}
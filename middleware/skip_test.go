@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRateLimitMiddleware_SkipFunc(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{
+		Rate:   1,
+		Window: time.Minute,
+	}, s)
+
+	skip := func(r *http.Request) bool {
+		return r.Header.Get("X-Service-Token") == "secret"
+	}
+
+	handler := RateLimitMiddleware(limiter, WithSkipFunc(skip))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Exhaust the limit for a regular client
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.168.1.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Request %d: expected %d, got %d", i+1, want, rec.Code)
+		}
+	}
+
+	// Requests with the service token bypass the limit
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.168.1.1:1234"
+		req.Header.Set("X-Service-Token", "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Skipped request %d: expected 200, got %d", i+1, rec.Code)
+		}
+		if rec.Header().Get("X-RateLimit-Limit") != "" {
+			t.Error("Expected no rate limit headers on skipped request")
+		}
+	}
+}
+
+func TestRouter_SkipFunc(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router, err := NewRouter(handler, s, []EndpointConfig{
+		{
+			Path:   "/api/*",
+			Config: ratelimiter.Config{Rate: 1, Window: time.Minute},
+		},
+	}, WithSkipFunc(func(r *http.Request) bool {
+		return r.Header.Get("X-Admin") == "true"
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("X-Admin", "true")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Admin request %d: expected 200, got %d", i+1, rec.Code)
+		}
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Request %d: expected %d, got %d", i+1, want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// ErrInvalidSpec is returned when an EndpointSpec cannot be converted to an
+// EndpointConfig.
+var ErrInvalidSpec = errors.New("invalid endpoint spec")
+
+// EndpointSpec is the declarative form of an EndpointConfig, for endpoints
+// read from configuration files (JSON, or YAML decoded by the host
+// application or proxy) instead of Go code. Durations are strings parsed
+// with time.ParseDuration, e.g. "1m". In JSON, the rate may also be a string
+// parsed with ratelimiter.ParseRate, e.g. "100/m", which sets the window too.
+type EndpointSpec struct {
+	Path           string            `json:"path"`
+	Methods        []string          `json:"methods,omitempty"`
+	Host           string            `json:"host,omitempty"`
+	Query          map[string]string `json:"query,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	KeyQuery       []string          `json:"keyQuery,omitempty"`
+	MaxQueryValues int               `json:"maxQueryValues,omitempty"`
+
+	// MaxKeysPerClient bounds the distinct hosts and KeyQuery values each
+	// client can use, see EndpointConfig.MaxKeysPerClient.
+	MaxKeysPerClient int `json:"maxKeysPerClient,omitempty"`
+
+	// KeyHeader keys requests by the value of this header (e.g. X-API-Key)
+	// instead of the client IP. Requests without it are keyed by client IP.
+	KeyHeader string `json:"keyHeader,omitempty"`
+
+	// Rate, Window, Burst and Algorithm are a single limit. Limits declares
+	// several limits instead.
+	Rate      int         `json:"rate,omitempty"`
+	Window    string      `json:"window,omitempty"`
+	Burst     int         `json:"burst,omitempty"`
+	Algorithm string      `json:"algorithm,omitempty"`
+	Limits    []LimitSpec `json:"limits,omitempty"`
+}
+
+// LimitSpec is the declarative form of a Limit.
+type LimitSpec struct {
+	Rate      int    `json:"rate,omitempty"`
+	Window    string `json:"window,omitempty"`
+	Burst     int    `json:"burst,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// UnmarshalJSON decodes a spec whose rate is a number or a string.
+func (s *EndpointSpec) UnmarshalJSON(data []byte) error {
+	type plain EndpointSpec
+	var v struct {
+		plain
+		Rate json.RawMessage `json:"rate"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := decodeRate(v.Rate, &v.plain.Rate, &v.plain.Window, &v.plain.Burst); err != nil {
+		return err
+	}
+	*s = EndpointSpec(v.plain)
+	return nil
+}
+
+// UnmarshalJSON decodes a spec whose rate is a number or a string.
+func (s *LimitSpec) UnmarshalJSON(data []byte) error {
+	type plain LimitSpec
+	var v struct {
+		plain
+		Rate json.RawMessage `json:"rate"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := decodeRate(v.Rate, &v.plain.Rate, &v.plain.Window, &v.plain.Burst); err != nil {
+		return err
+	}
+	*s = LimitSpec(v.plain)
+	return nil
+}
+
+// decodeRate decodes a JSON rate. A string rate such as "100/m" also sets
+// the window, and the burst unless it is set.
+func decodeRate(raw json.RawMessage, rate *int, window *string, burst *int) error {
+	if len(raw) == 0 || raw[0] != '"' {
+		if len(raw) == 0 {
+			return nil
+		}
+		return json.Unmarshal(raw, rate)
+	}
+
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return err
+	}
+	config, err := ratelimiter.ParseRate(str)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSpec, err)
+	}
+	if *window != "" {
+		return fmt.Errorf("%w: rate %q cannot be combined with a window", ErrInvalidSpec, str)
+	}
+	*rate, *window = config.Rate, config.Window.String()
+	if *burst == 0 {
+		*burst = config.BurstSize
+	}
+	return nil
+}
+
+// EndpointConfig converts the spec to an EndpointConfig.
+func (s EndpointSpec) EndpointConfig() (EndpointConfig, error) {
+	ep := EndpointConfig{
+		Path:           s.Path,
+		Methods:        s.Methods,
+		Host:           s.Host,
+		Query:          s.Query,
+		Headers:        s.Headers,
+		KeyQuery:       s.KeyQuery,
+		MaxQueryValues: s.MaxQueryValues,
+
+		MaxKeysPerClient: s.MaxKeysPerClient,
+	}
+	if s.Path == "" {
+		return ep, fmt.Errorf("%w: missing path", ErrInvalidSpec)
+	}
+
+	if len(s.Limits) == 0 {
+		spec := LimitSpec{Rate: s.Rate, Window: s.Window, Burst: s.Burst, Algorithm: s.Algorithm}
+		limit, err := spec.limit()
+		if err != nil {
+			return ep, fmt.Errorf("%w: %s: %w", ErrInvalidSpec, s.Path, err)
+		}
+		ep.Config, ep.Algorithm = limit.Config, limit.Algorithm
+	} else {
+		if s.Rate != 0 {
+			return ep, fmt.Errorf("%w: %s: %w", ErrInvalidSpec, s.Path, ErrConflictingLimits)
+		}
+		for _, spec := range s.Limits {
+			limit, err := spec.limit()
+			if err != nil {
+				return ep, fmt.Errorf("%w: %s: %w", ErrInvalidSpec, s.Path, err)
+			}
+			ep.Limits = append(ep.Limits, limit)
+		}
+	}
+
+	if s.KeyHeader != "" {
+		ep.KeyFunc = headerKeyFunc(http.CanonicalHeaderKey(s.KeyHeader))
+	}
+	return ep, nil
+}
+
+// EndpointConfigs converts specs to EndpointConfigs, for NewRouter.
+func EndpointConfigs(specs []EndpointSpec) ([]EndpointConfig, error) {
+	endpoints := make([]EndpointConfig, len(specs))
+	for i, spec := range specs {
+		ep, err := spec.EndpointConfig()
+		if err != nil {
+			return nil, err
+		}
+		endpoints[i] = ep
+	}
+	return endpoints, nil
+}
+
+// limit converts the spec to a Limit.
+func (s LimitSpec) limit() (Limit, error) {
+	window, err := time.ParseDuration(s.Window)
+	if err != nil {
+		return Limit{}, fmt.Errorf("window: %w", err)
+	}
+
+	algorithm := Algorithm(s.Algorithm)
+	switch algorithm {
+	case "", AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmCountMin, AlgorithmSlidingWindowLog:
+	default:
+		return Limit{}, fmt.Errorf("unknown algorithm %q", s.Algorithm)
+	}
+
+	config := ratelimiter.Config{Rate: s.Rate, Window: window, BurstSize: s.Burst}
+	if err := config.Validate(); err != nil {
+		return Limit{}, err
+	}
+	return Limit{Config: config, Algorithm: algorithm}, nil
+}
+
+// headerKeyFunc keys requests by the value of a header, falling back to
+// DefaultKeyFunc. Header keys are prefixed so that they cannot collide with
+// client IPs.
+func headerKeyFunc(name string) KeyFunc {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(name); v != "" {
+			return name + "=" + v
+		}
+		return DefaultKeyFunc(r)
+	}
+}
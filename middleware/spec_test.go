@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+func TestEndpointSpec_EndpointConfig(t *testing.T) {
+	var specs []EndpointSpec
+	err := json.Unmarshal([]byte(`[
+		{"path": "/login", "methods": ["POST"], "rate": 5, "window": "1m", "algorithm": "sliding_window"},
+		{"path": "/api/*", "keyHeader": "x-api-key", "limits": [
+			{"rate": 10, "window": "1s", "burst": 20},
+			{"rate": 1000, "window": "1h"}
+		]}
+	]`), &specs)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	endpoints, err := EndpointConfigs(specs)
+	if err != nil {
+		t.Fatalf("EndpointConfigs failed: %v", err)
+	}
+
+	login := endpoints[0]
+	if login.Config != (ratelimiter.Config{Rate: 5, Window: time.Minute}) || login.Algorithm != AlgorithmSlidingWindow {
+		t.Errorf("Unexpected /login config: %+v", login)
+	}
+
+	api := endpoints[1]
+	if len(api.Limits) != 2 || api.Limits[0].Config.BurstSize != 20 || api.Limits[1].Config.Window != time.Hour {
+		t.Errorf("Unexpected /api/* limits: %+v", api.Limits)
+	}
+
+	req := httptest.NewRequest("GET", "/api/x", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if key := api.KeyFunc(req); key != "192.0.2.1" {
+		t.Errorf("Expected requests without the header to be keyed by IP, got %q", key)
+	}
+	req.Header.Set("X-Api-Key", "k1")
+	if key := api.KeyFunc(req); key != "X-Api-Key=k1" {
+		t.Errorf("Expected requests to be keyed by header, got %q", key)
+	}
+}
+
+func TestEndpointSpec_Invalid(t *testing.T) {
+	for _, spec := range []EndpointSpec{
+		{Rate: 1, Window: "1m"},
+		{Path: "/a", Rate: 1, Window: "soon"},
+		{Path: "/a", Rate: 0, Window: "1m"},
+		{Path: "/a", Rate: 1, Window: "1m", Algorithm: "leaky_bucket"},
+		{Path: "/a", Rate: 1, Window: "1m", Limits: []LimitSpec{{Rate: 1, Window: "1s"}}},
+	} {
+		if _, err := spec.EndpointConfig(); !errors.Is(err, ErrInvalidSpec) {
+			t.Errorf("%+v: expected ErrInvalidSpec, got %v", spec, err)
+		}
+	}
+}
+
+func TestEndpointSpec_StringRate(t *testing.T) {
+	var specs []EndpointSpec
+	err := json.Unmarshal([]byte(`[
+		{"path": "/login", "rate": "5 per minute"},
+		{"path": "/search", "rate": "0.5/s"},
+		{"path": "/api/*", "limits": [{"rate": "10/s", "burst": 20}, {"rate": "1000/h"}]}
+	]`), &specs)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	endpoints, err := EndpointConfigs(specs)
+	if err != nil {
+		t.Fatalf("EndpointConfigs failed: %v", err)
+	}
+	if c := endpoints[0].Config; c != (ratelimiter.Config{Rate: 5, Window: time.Minute, BurstSize: 5}) {
+		t.Errorf("Unexpected /login config: %+v", c)
+	}
+	if c := endpoints[1].Config; c != (ratelimiter.Config{Rate: 1, Window: 2 * time.Second, BurstSize: 1}) {
+		t.Errorf("Unexpected /search config: %+v", c)
+	}
+	limits := endpoints[2].Limits
+	if len(limits) != 2 || limits[0].Config.BurstSize != 20 || limits[1].Config.Rate != 1000 || limits[1].Config.Window != time.Hour {
+		t.Errorf("Unexpected /api/* limits: %+v", limits)
+	}
+
+	for _, doc := range []string{
+		`{"path": "/a", "rate": "5 every minute"}`,
+		`{"path": "/a", "rate": "5/m", "window": "1h"}`,
+	} {
+		var spec EndpointSpec
+		if err := json.Unmarshal([]byte(doc), &spec); !errors.Is(err, ErrInvalidSpec) {
+			t.Errorf("%s: expected ErrInvalidSpec, got %v", doc, err)
+		}
+	}
+}
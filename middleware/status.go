@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// WithCountStatus makes the middleware decide after the handler runs whether
+// a request counts toward the limit, based on the response status. Requests
+// are still checked and charged before the handler runs, so concurrent
+// requests cannot exceed the limit; if countStatus returns false, the charge
+// is refunded. The limiter must implement ratelimiter.Refunder (all limiters
+// in the algorithms package do); otherwise every request counts.
+//
+// For example, to only count failed logins toward an auth limit:
+//
+//	middleware.WithCountStatus(middleware.CountStatuses(http.StatusUnauthorized))
+func WithCountStatus(countStatus func(status int) bool) Option {
+	return func(o *Options) {
+		o.CountStatus = countStatus
+	}
+}
+
+// CountStatuses returns a WithCountStatus function counting only responses
+// with one of the given status codes.
+func CountStatuses(codes ...int) func(status int) bool {
+	return func(status int) bool {
+		for _, code := range codes {
+			if status == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// NotServerError is a WithCountStatus function that does not count 5xx
+// responses, so that clients are not penalized for server failures.
+func NotServerError(status int) bool {
+	return status < 500
+}
+
+// serveCounted runs next and refunds the cost of the request to limiter if
+// countStatus reports that its response status does not count.
+func serveCounted(w http.ResponseWriter, r *http.Request, next http.Handler, limiter ratelimiter.Limiter, key string, cost int, countStatus func(int) bool) {
+	if countStatus == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	refunder, ok := limiter.(ratelimiter.Refunder)
+	if !ok {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	rec := &statusRecorder{ResponseWriter: w}
+	next.ServeHTTP(rec, r)
+
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if !countStatus(status) {
+		_ = refunder.RefundN(key, cost)
+	}
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records and sends the response status.
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Write sends the body, with an implicit 200 status if none was written.
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client.
+func (s *statusRecorder) Flush() {
+	flushWriter(s.ResponseWriter)
+}
+
+// Hijack takes over the connection.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijackWriter(s.ResponseWriter)
+}
+
+// Push initiates an HTTP/2 server push.
+func (s *statusRecorder) Push(target string, opts *http.PushOptions) error {
+	return pushWriter(s.ResponseWriter, target, opts)
+}
+
+// ReadFrom sends the body from src, with an implicit 200 status if none was written.
+func (s *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return readFromWriter(s.ResponseWriter, src)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
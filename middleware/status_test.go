@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRateLimitMiddleware_CountStatus(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 2, Window: time.Hour}, s)
+
+	status := http.StatusOK
+	handler := RateLimitMiddleware(limiter,
+		WithCountStatus(CountStatuses(http.StatusUnauthorized)),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Successful logins are refunded
+	for i := 0; i < 5; i++ {
+		if code := send(); code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i+1, code)
+		}
+	}
+
+	// Failed logins count
+	status = http.StatusUnauthorized
+	send()
+	send()
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected limit after 2 failed logins, got %d", code)
+	}
+}
+
+func TestRouter_CountStatus(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	router, err := NewRouter(handler, s, []EndpointConfig{
+		{
+			Path:        "/api/*",
+			Config:      ratelimiter.Config{Rate: 1, Window: time.Hour},
+			Algorithm:   AlgorithmSlidingWindow,
+			CountStatus: NotServerError,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Request %d: expected server errors not to count, got %d", i+1, rec.Code)
+		}
+	}
+}
+
+func TestCountStatus_RequiresRefunder(t *testing.T) {
+	limiter := &MockLimiter{AllowFunc: func(key string) (bool, error) { return true, nil }}
+
+	called := false
+	handler := RateLimitMiddleware(limiter, WithCountStatus(func(status int) bool {
+		called = true
+		return true
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if called {
+		t.Error("Expected CountStatus to be ignored for limiters without Refunder")
+	}
+}
+
+func TestStatusRecorder_ImplicitOK(t *testing.T) {
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	rec.Write([]byte("ok"))
+	rec.WriteHeader(http.StatusTeapot)
+	if rec.status != http.StatusOK {
+		t.Errorf("Expected implicit 200, got %d", rec.status)
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// Switch turns the enforcement of rate limits on and off at runtime, for
+// emergencies ("stop blocking customers now"). While it is off, the
+// middleware behaves as in dry run (see WithDryRun): limits are still
+// evaluated and decisions recorded by the Monitor, Auditor and History, but
+// requests over the limit are served. A Switch can be shared by several
+// middlewares and routers. The zero value is on.
+type Switch struct {
+	disabled atomic.Bool
+}
+
+// NewSwitch returns a switch with enforcement on.
+func NewSwitch() *Switch {
+	return &Switch{}
+}
+
+// SetEnabled turns enforcement on or off.
+func (s *Switch) SetEnabled(enabled bool) {
+	s.disabled.Store(!enabled)
+}
+
+// Enabled reports whether limits are enforced. A nil Switch is on.
+func (s *Switch) Enabled() bool {
+	return s == nil || !s.disabled.Load()
+}
+
+// switchStatus is the JSON representation of a Switch.
+type switchStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Handler returns an HTTP handler for admin APIs: GET reports the state of
+// the switch as JSON ({"enabled": true}); POST sets it from the "enabled"
+// query or form parameter (e.g. POST /ratelimit/enforcement?enabled=false)
+// and reports the new state. Anyone reaching it can lift every limit: mount
+// it on an internal listener or behind authentication.
+func (s *Switch) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+			if err != nil {
+				writeError(w, "Invalid enabled parameter", http.StatusBadRequest)
+				return
+			}
+			s.SetEnabled(enabled)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(switchStatus{Enabled: s.Enabled()})
+	})
+}
+
+// WithSwitch makes enforcement depend on s, so that it can be turned off at
+// runtime without restarting or reconfiguring the middleware.
+func WithSwitch(s *Switch) Option {
+	return func(o *Options) {
+		o.Switch = s
+	}
+}
+
+// dryRun reports whether limits are evaluated without being enforced, by
+// configuration or because the switch is off.
+func (o *Options) dryRun() bool {
+	return o.DryRun || !o.Switch.Enabled()
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRateLimitMiddleware_Switch(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Minute}, s)
+
+	sw := NewSwitch()
+	monitor := NewMonitor(MonitorConfig{})
+	handler := RateLimitMiddleware(limiter, WithSwitch(sw), WithMonitor(monitor))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	serve()
+	if code := serve(); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 while enforcing, got %d", code)
+	}
+
+	sw.SetEnabled(false)
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("Expected 200 while enforcement is off, got %d", code)
+	}
+	if snap := monitor.Snapshot(); snap.Denied != 2 {
+		t.Errorf("Expected denials to be recorded while enforcement is off, got %d", snap.Denied)
+	}
+
+	sw.SetEnabled(true)
+	if code := serve(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 after enforcement is back on, got %d", code)
+	}
+}
+
+func TestRouter_SetEnabled(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	endpoints := []EndpointConfig{{Path: "/api", Config: ratelimiter.Config{Rate: 1, Window: time.Minute}}}
+	router, err := NewRouter(http.NotFoundHandler(), s, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	router.SetEnabled(false)
+	if router.Enabled() {
+		t.Error("Enabled should be false")
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Retry-After") != "" {
+		t.Errorf("Expected the request to reach the handler, got %d", rec.Code)
+	}
+}
+
+func TestSwitch_Handler(t *testing.T) {
+	sw := NewSwitch()
+	h := sw.Handler()
+
+	for _, tc := range []struct {
+		method, target string
+		code           int
+		enabled        bool
+	}{
+		{http.MethodGet, "/", http.StatusOK, true},
+		{http.MethodPost, "/?enabled=false", http.StatusOK, false},
+		{http.MethodGet, "/", http.StatusOK, false},
+		{http.MethodPost, "/?enabled=maybe", http.StatusBadRequest, false},
+		{http.MethodDelete, "/", http.StatusMethodNotAllowed, false},
+		{http.MethodPost, "/?enabled=true", http.StatusOK, true},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.target, rec.Code, tc.code)
+		}
+		if sw.Enabled() != tc.enabled {
+			t.Errorf("%s %s: Enabled = %v, want %v", tc.method, tc.target, sw.Enabled(), tc.enabled)
+		}
+		if rec.Code == http.StatusOK {
+			var status switchStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil || status.Enabled != tc.enabled {
+				t.Errorf("%s %s: body %+v (err %v), want enabled=%v", tc.method, tc.target, status, err, tc.enabled)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PrivateNetworks lists the loopback, link-local and private address ranges
+// (RFC 1918, RFC 4193) that typically contain load balancers and ingress
+// controllers in Kubernetes and other private deployments.
+var PrivateNetworks = []string{
+	"127.0.0.0/8",    // IPv4 loopback
+	"10.0.0.0/8",     // RFC 1918
+	"172.16.0.0/12",  // RFC 1918
+	"192.168.0.0/16", // RFC 1918
+	"169.254.0.0/16", // IPv4 link-local
+	"::1/128",        // IPv6 loopback
+	"fc00::/7",       // IPv6 unique local addresses
+	"fe80::/10",      // IPv6 link-local
+}
+
+// TrustedPrivateNetworksKeyFunc returns a KeyFunc that behaves like
+// TrustedIPKeyFunc with all PrivateNetworks trusted as proxies.
+func TrustedPrivateNetworksKeyFunc() KeyFunc {
+	prefixes, err := parseTrustedProxies(PrivateNetworks)
+	if err != nil {
+		// PrivateNetworks is a static list of valid CIDRs
+		panic(err)
+	}
+	return TrustedPrefixesKeyFunc(prefixes)
+}
+
+// RangeFetcher returns a list of IPs or CIDR blocks, for example the
+// published edge ranges of a CDN provider.
+type RangeFetcher func(ctx context.Context) ([]string, error)
+
+// TrustedProxyRanges is a set of trusted proxy ranges that can be refreshed
+// at runtime from a RangeFetcher. It is safe for concurrent use.
+type TrustedProxyRanges struct {
+	static    []netip.Prefix
+	fetcher   RangeFetcher
+	cidrs     atomic.Pointer[[]netip.Prefix]
+	stopChan  chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewTrustedProxyRanges creates a refreshable set of trusted proxy ranges.
+// The static ranges are always trusted. If fetcher is non-nil, it is called
+// once immediately and then every interval (if positive) to replace the
+// fetched ranges. A failed refresh keeps the previous ranges.
+// Call Close to stop the background refresh.
+func NewTrustedProxyRanges(ctx context.Context, static []string, fetcher RangeFetcher, interval time.Duration) (*TrustedProxyRanges, error) {
+	cidrs, err := parseTrustedProxies(static)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TrustedProxyRanges{
+		static:   cidrs,
+		fetcher:  fetcher,
+		stopChan: make(chan struct{}),
+	}
+	t.cidrs.Store(&cidrs)
+
+	if fetcher == nil {
+		return t, nil
+	}
+
+	if err := t.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		t.wg.Add(1)
+		go t.refreshLoop(ctx, interval)
+	}
+
+	return t, nil
+}
+
+// Refresh fetches the ranges and atomically replaces the current set.
+func (t *TrustedProxyRanges) Refresh(ctx context.Context) error {
+	if t.fetcher == nil {
+		return nil
+	}
+
+	ranges, err := t.fetcher(ctx)
+	if err != nil {
+		return err
+	}
+
+	fetched, err := parseTrustedProxies(ranges)
+	if err != nil {
+		return err
+	}
+
+	cidrs := make([]netip.Prefix, 0, len(t.static)+len(fetched))
+	cidrs = append(cidrs, t.static...)
+	cidrs = append(cidrs, fetched...)
+	t.cidrs.Store(&cidrs)
+	return nil
+}
+
+// KeyFunc returns a KeyFunc that behaves like TrustedIPKeyFunc using the
+// current set of ranges at the time of each request.
+func (t *TrustedProxyRanges) KeyFunc() KeyFunc {
+	return func(r *http.Request) string {
+		return trustedXFFKey(r, *t.cidrs.Load())
+	}
+}
+
+// Close stops the background refresh.
+func (t *TrustedProxyRanges) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.stopChan)
+	})
+	t.wg.Wait()
+	return nil
+}
+
+// refreshLoop periodically refreshes the ranges until Close is called or ctx is done.
+func (t *TrustedProxyRanges) refreshLoop(ctx context.Context, interval time.Duration) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = t.Refresh(ctx)
+		case <-ctx.Done():
+			return
+		case <-t.stopChan:
+			return
+		}
+	}
+}
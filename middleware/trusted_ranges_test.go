@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTrustedPrivateNetworksKeyFunc(t *testing.T) {
+	keyFunc := TrustedPrivateNetworksKeyFunc()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"rfc1918 proxy", "10.1.2.3:1234", "198.51.100.7", "198.51.100.7"},
+		{"chain of private proxies", "192.168.0.1:1234", "198.51.100.7, 172.16.5.5", "198.51.100.7"},
+		{"loopback proxy", "127.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"ipv6 ula proxy", "[fd00::1]:1234", "2001:db8::7", "2001:db8::7"},
+		{"public remote ignores xff", "203.0.113.5:1234", "1.1.1.1", "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			if got := keyFunc(req); got != tt.want {
+				t.Errorf("keyFunc() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxyRanges_Refresh(t *testing.T) {
+	var ranges atomic.Value
+	ranges.Store([]string{"203.0.113.0/24"})
+	fetcher := func(ctx context.Context) ([]string, error) {
+		return ranges.Load().([]string), nil
+	}
+
+	tr, err := NewTrustedProxyRanges(context.Background(), []string{"10.0.0.0/8"}, fetcher, 0)
+	if err != nil {
+		t.Fatalf("Failed to create ranges: %v", err)
+	}
+	defer tr.Close()
+
+	keyFunc := tr.KeyFunc()
+	check := func(remoteAddr, want string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		if got := keyFunc(req); got != want {
+			t.Errorf("keyFunc() from %s = %q, want %q", remoteAddr, got, want)
+		}
+	}
+
+	check("10.0.0.1:1", "198.51.100.7")    // static range
+	check("203.0.113.1:1", "198.51.100.7") // fetched range
+	check("192.0.2.1:1", "192.0.2.1")      // not trusted
+
+	// Provider ranges change
+	ranges.Store([]string{"192.0.2.0/24"})
+	if err := tr.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh returned error: %v", err)
+	}
+	check("10.0.0.1:1", "198.51.100.7")
+	check("203.0.113.1:1", "203.0.113.1")
+	check("192.0.2.1:1", "198.51.100.7")
+
+	// Invalid fetched ranges keep the previous set
+	ranges.Store([]string{"garbage"})
+	if err := tr.Refresh(context.Background()); err == nil {
+		t.Error("Expected error for invalid fetched range")
+	}
+	check("192.0.2.1:1", "198.51.100.7")
+}
+
+func TestTrustedProxyRanges_BackgroundRefresh(t *testing.T) {
+	var calls atomic.Int32
+	fetcher := func(ctx context.Context) ([]string, error) {
+		calls.Add(1)
+		return []string{"203.0.113.0/24"}, nil
+	}
+
+	tr, err := NewTrustedProxyRanges(context.Background(), nil, fetcher, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to create ranges: %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	tr.Close()
+	after := calls.Load()
+	if after < 2 {
+		t.Errorf("Expected periodic refreshes, got %d calls", after)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if calls.Load() != after {
+		t.Error("Expected refresh to stop after Close")
+	}
+}
+
+func TestTrustedProxyRanges_InitialFetchError(t *testing.T) {
+	fetcher := func(ctx context.Context) ([]string, error) {
+		return nil, errors.New("unavailable")
+	}
+	if _, err := NewTrustedProxyRanges(context.Background(), nil, fetcher, time.Minute); err == nil {
+		t.Error("Expected error when initial fetch fails")
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 )
 
@@ -115,3 +116,53 @@ func TestTrustedIPKeyFunc_SpoofingWithPort(t *testing.T) {
 		t.Errorf("Unexpected key: %s", key)
 	}
 }
+
+func TestTrustedPrefixesKeyFunc(t *testing.T) {
+	keyFunc := TrustedPrefixesKeyFunc([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::ffff:192.168.0.0/112"), // IPv4-mapped, matches 192.168.0.0/16
+	})
+
+	for _, tc := range []struct {
+		remote, xff, want string
+	}{
+		{"10.0.0.1:1", "203.0.113.1, 10.0.0.2", "203.0.113.1"},
+		{"192.168.1.1:1", "203.0.113.1", "203.0.113.1"},
+		{"[::ffff:10.0.0.1]:1", "2001:DB8::1", "2001:db8::1"},
+		{"10.0.0.1:1", "fe80::1%eth0, 203.0.113.1, fe80::2%eth0", "203.0.113.1"}, // Zoned hops are invalid
+		{"203.0.113.9:1", "198.51.100.1", "203.0.113.9"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		req.Header.Set("X-Forwarded-For", tc.xff)
+		if got := keyFunc(req); got != tc.want {
+			t.Errorf("%s via %s: got %q, want %q", tc.xff, tc.remote, got, tc.want)
+		}
+	}
+}
+
+func TestWithTrustedPrefixes(t *testing.T) {
+	o := &Options{}
+	WithTrustedPrefixes([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})(o)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	if got := o.KeyFunc(req); got != "203.0.113.1" {
+		t.Errorf("got %q, want 203.0.113.1", got)
+	}
+}
+
+func TestTrustedIPKeyFunc_NoAllocs(t *testing.T) {
+	keyFunc, err := TrustedIPKeyFunc([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1, 10.0.0.2")
+
+	if allocs := testing.AllocsPerRun(100, func() { keyFunc(req) }); allocs != 0 {
+		t.Errorf("TrustedIPKeyFunc allocated %v times per call, want 0", allocs)
+	}
+}
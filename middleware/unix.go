@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PeerCred holds the credentials of the process on the other end of a Unix domain socket.
+type PeerCred struct {
+	PID int
+	UID int
+	GID int
+}
+
+// peerCredKey is the context key for PeerCred.
+type peerCredKey struct{}
+
+// PeerCredConnContext is an http.Server.ConnContext hook that stores the peer
+// credentials (SO_PEERCRED) of Unix domain socket connections in the context.
+// It is a no-op for other connections and on platforms without SO_PEERCRED.
+//
+//	srv := &http.Server{Handler: h, ConnContext: middleware.PeerCredConnContext}
+func PeerCredConnContext(ctx context.Context, c net.Conn) context.Context {
+	if cred, ok := peerCred(c); ok {
+		return context.WithValue(ctx, peerCredKey{}, cred)
+	}
+	return ctx
+}
+
+// PeerCredFromContext returns the peer credentials stored by PeerCredConnContext.
+func PeerCredFromContext(ctx context.Context) (PeerCred, bool) {
+	cred, ok := ctx.Value(peerCredKey{}).(PeerCred)
+	return cred, ok
+}
+
+// IsUnixSocketRequest reports whether the request arrived over a Unix domain socket.
+// net/http reports such connections with an empty, "@" or path RemoteAddr,
+// which carries no client IP.
+func IsUnixSocketRequest(r *http.Request) bool {
+	addr := r.RemoteAddr
+	return addr == "" || addr[0] == '@' || addr[0] == '/'
+}
+
+// unixSocketKey returns the per-caller key for a Unix socket request based on
+// its peer credentials, or "" if none are available.
+func unixSocketKey(r *http.Request) string {
+	if cred, ok := PeerCredFromContext(r.Context()); ok {
+		return "uid:" + strconv.Itoa(cred.UID)
+	}
+	return ""
+}
+
+// unidentifiedKey is the shared key for Unix socket callers without an identity.
+const unidentifiedKey = "unix:unidentified"
+
+// UnixSocketKeyFunc returns a KeyFunc that gives Unix socket callers a
+// per-caller key instead of the constant RemoteAddr:
+//
+//  1. the peer UID ("uid:1000"), if PeerCredConnContext is installed;
+//  2. otherwise the value of identityHeader ("id:<value>"), if set;
+//  3. otherwise the shared key "unix:unidentified", so callers without an
+//     identity are limited together.
+//
+// Requests that did not arrive over a Unix socket use next.
+// Identity header values longer than 256 bytes are ignored.
+func UnixSocketKeyFunc(identityHeader string, next KeyFunc) KeyFunc {
+	if next == nil {
+		next = DefaultKeyFunc
+	}
+	return func(r *http.Request) string {
+		if !IsUnixSocketRequest(r) {
+			return next(r)
+		}
+		if key := unixSocketKey(r); key != "" {
+			return key
+		}
+		if identityHeader != "" {
+			if v := strings.TrimSpace(r.Header.Get(identityHeader)); v != "" && len(v) <= maxIdentityLength {
+				return "id:" + v
+			}
+		}
+		return unidentifiedKey
+	}
+}
+
+// maxIdentityLength bounds identity header values used as keys.
+const maxIdentityLength = 256
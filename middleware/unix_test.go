@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestUnixSocketKeyFunc(t *testing.T) {
+	keyFunc := UnixSocketKeyFunc("X-Caller-ID", nil)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		cred       *PeerCred
+		want       string
+	}{
+		{"tcp request uses next", "10.0.0.1:1234", "svc-a", nil, "10.0.0.1"},
+		{"peer credentials", "@", "svc-a", &PeerCred{UID: 1000}, "uid:1000"},
+		{"identity header", "@", "svc-a", nil, "id:svc-a"},
+		{"empty remote addr", "", "svc-b", nil, "id:svc-b"},
+		{"unidentified callers share a key", "@", "", nil, unidentifiedKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set("X-Caller-ID", tt.header)
+			}
+			if tt.cred != nil {
+				req = req.WithContext(context.WithValue(req.Context(), peerCredKey{}, *tt.cred))
+			}
+			if got := keyFunc(req); got != tt.want {
+				t.Errorf("keyFunc() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeerCredConnContext_UnixSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_PEERCRED is only supported on Linux")
+	}
+
+	sock := filepath.Join(t.TempDir(), "test.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(DefaultKeyFunc(r)))
+		}),
+		ConnContext: PeerCredConnContext,
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+
+	resp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	want := "uid:" + strconv.Itoa(os.Getuid())
+	if string(body) != want {
+		t.Errorf("DefaultKeyFunc() = %q, want %q", body, want)
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// WarningFunc is called when a key crosses the soft limit set by
+// WithWarning, with the result of the request that crossed it.
+type WarningFunc func(r *http.Request, key string, result ratelimiter.Result)
+
+// WithWarning sets a soft limit at threshold (between 0 and 1) of the limit,
+// e.g. 0.8 for 80%. Allowed requests at or above it carry an
+// X-RateLimit-Warning header with the percentage of the limit used, so that
+// clients can back off before being cut off, and fn (if not nil) is called
+// once per crossing, e.g. to alert customers approaching their quota. The
+// header follows the HeaderMode and HeaderFilter of the other rate limit
+// headers. Only limiters reporting details (Limit and Remaining) have a soft
+// limit.
+func WithWarning(threshold float64, fn WarningFunc) Option {
+	return func(o *Options) {
+		o.WarningThreshold = threshold
+		o.OnWarning = fn
+	}
+}
+
+// softLimit returns the percentage of the limit used after an allowed
+// request of the given cost, whether it reaches threshold and whether this
+// request crossed it. A request crosses the soft limit when usage was below
+// it before the request and is at or above it after: the crossing is found
+// from the result alone, without per-key state.
+func softLimit(result ratelimiter.Result, cost int, threshold float64) (percent int, over, crossed bool) {
+	if threshold <= 0 || !result.Allowed || result.Limit <= 0 {
+		return 0, false, false
+	}
+	mark := int(math.Ceil(threshold * float64(result.Limit)))
+	used := result.Limit - result.Remaining
+	percent = used * 100 / result.Limit
+	return percent, used >= mark, used >= mark && used-cost < mark
+}
+
+// warn writes the warning header and calls the warning callback if the
+// allowed request described by result reaches the soft limit of o.
+func warn(w http.ResponseWriter, r *http.Request, o *Options, headers headerWriter, key string, result ratelimiter.Result, cost int) {
+	percent, over, crossed := softLimit(result, cost, o.WarningThreshold)
+	if !over {
+		return
+	}
+	headers.writeWarning(w, r, percent)
+	if crossed && o.OnWarning != nil {
+		o.OnWarning(r, key, result)
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestRateLimitMiddleware_Warning(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 10, Window: time.Minute}, s)
+
+	var warned []string
+	handler := RateLimitMiddleware(limiter, WithWarning(0.8, func(r *http.Request, key string, result ratelimiter.Result) {
+		warned = append(warned, key)
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 1; i <= 11; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		// Requests 8 to 10 use 80% or more of the limit; 11 is denied
+		want := ""
+		if i >= 8 && i <= 10 {
+			want = strconv.Itoa(i * 10)
+		}
+		if got := rec.Header().Get("X-RateLimit-Warning"); got != want {
+			t.Errorf("Request %d: warning = %q, want %q", i, got, want)
+		}
+	}
+	if len(warned) != 1 || warned[0] != "1.2.3.4" {
+		t.Errorf("OnWarning called for %v, want once for 1.2.3.4", warned)
+	}
+}
+
+func TestRateLimitMiddleware_WarningCrossedByCost(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 10, Window: time.Minute}, s)
+
+	calls := 0
+	handler := RateLimitMiddleware(limiter,
+		WithCost(func(r *http.Request) (int, error) { return 5, nil }),
+		WithWarning(0.8, func(r *http.Request, key string, result ratelimiter.Result) { calls++ }),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// 5 then 10 out of 10: the second request jumps over the soft limit
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if calls != 1 {
+		t.Errorf("OnWarning called %d times, want 1", calls)
+	}
+}
+
+func TestRouter_WarningHeaderMode(t *testing.T) {
+	endpoints := []EndpointConfig{{Path: "/api", Config: ratelimiter.Config{Rate: 2, Window: time.Minute}}}
+
+	for _, tc := range []struct {
+		mode HeaderMode
+		want string
+	}{
+		{HeadersAlways, "50"},
+		{HeadersOnDenial, ""},
+		{HeadersNever, ""},
+	} {
+		s := store.NewMemoryStore()
+		router, err := NewRouter(http.NotFoundHandler(), s, endpoints, WithWarning(0.5, nil), WithHeaders(tc.mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+		s.Close()
+		if got := rec.Header().Get("X-RateLimit-Warning"); got != tc.want {
+			t.Errorf("mode %d: warning = %q, want %q", tc.mode, got, tc.want)
+		}
+	}
+}
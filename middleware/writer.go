@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// The middleware ResponseWriter wrappers (statusRecorder, bandwidthWriter,
+// connWriter) implement http.Flusher, http.Hijacker, http.Pusher and
+// io.ReaderFrom, and Unwrap for http.ResponseController, so that wrapping
+// does not hide the capabilities of the underlying writer from handlers
+// doing streaming, WebSocket upgrades, server push or sendfile.
+
+// flushWriter flushes w if it supports flushing.
+func flushWriter(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// hijackWriter hijacks the connection of w, or returns http.ErrNotSupported.
+func hijackWriter(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+// pushWriter initiates an HTTP/2 server push on w, or returns http.ErrNotSupported.
+func pushWriter(w http.ResponseWriter, target string, opts *http.PushOptions) error {
+	p, ok := w.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+// readFromWriter copies src to w, using w's io.ReaderFrom (e.g. sendfile)
+// when available.
+func readFromWriter(w http.ResponseWriter, src io.Reader) (int64, error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(writerOnly{w}, src)
+}
+
+// writerOnly hides the io.ReaderFrom of a writer, so that io.Copy uses
+// Write instead of recursing into ReadFrom.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// capableWriter implements every optional ResponseWriter interface and
+// records which ones were used.
+type capableWriter struct {
+	*httptest.ResponseRecorder
+	flushed  bool
+	hijacked bool
+	pushed   string
+	readFrom bool
+}
+
+func (c *capableWriter) Flush() { c.flushed = true }
+
+func (c *capableWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c.hijacked = true
+	server, client := net.Pipe()
+	client.Close()
+	return server, nil, nil
+}
+
+func (c *capableWriter) Push(target string, opts *http.PushOptions) error {
+	c.pushed = target
+	return nil
+}
+
+func (c *capableWriter) ReadFrom(src io.Reader) (int64, error) {
+	c.readFrom = true
+	return io.Copy(writerOnly{c.ResponseRecorder}, src)
+}
+
+func wrappers(w http.ResponseWriter) map[string]http.ResponseWriter {
+	limiter := &MockLimiter{}
+	return map[string]http.ResponseWriter{
+		"statusRecorder":  &statusRecorder{ResponseWriter: w},
+		"bandwidthWriter": &bandwidthWriter{ResponseWriter: w, limiter: limiter, chunk: bandwidthChunk, onLimited: func() {}},
+		"connWriter":      &connWriter{ResponseWriter: w, release: func() {}},
+	}
+}
+
+func TestResponseWriterWrappers_Passthrough(t *testing.T) {
+	for name := range wrappers(nil) {
+		t.Run(name, func(t *testing.T) {
+			under := &capableWriter{ResponseRecorder: httptest.NewRecorder()}
+			w := wrappers(under)[name]
+
+			w.(http.Flusher).Flush()
+			if !under.flushed {
+				t.Error("Flush not passed through")
+			}
+
+			if err := w.(http.Pusher).Push("/style.css", nil); err != nil || under.pushed != "/style.css" {
+				t.Errorf("Push not passed through: %v", err)
+			}
+
+			n, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("hello"))
+			if err != nil || n != 5 || under.Body.String() != "hello" {
+				t.Errorf("ReadFrom = %d, %v; body %q", n, err, under.Body.String())
+			}
+			// Bytes must go through bandwidth accounting rather than the fast path
+			if wantFast := name != "bandwidthWriter"; under.readFrom != wantFast {
+				t.Errorf("Underlying ReadFrom used = %v, want %v", under.readFrom, wantFast)
+			}
+
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil || !under.hijacked {
+				t.Fatalf("Hijack not passed through: %v", err)
+			}
+			conn.Close()
+		})
+	}
+}
+
+func TestResponseWriterWrappers_Unsupported(t *testing.T) {
+	for name, w := range wrappers(httptest.NewRecorder()) {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := w.(http.Hijacker).Hijack(); !errors.Is(err, http.ErrNotSupported) {
+				t.Errorf("Hijack: expected ErrNotSupported, got %v", err)
+			}
+			if err := w.(http.Pusher).Push("/", nil); !errors.Is(err, http.ErrNotSupported) {
+				t.Errorf("Push: expected ErrNotSupported, got %v", err)
+			}
+			if n, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("abc")); err != nil || n != 3 {
+				t.Errorf("ReadFrom fallback = %d, %v", n, err)
+			}
+		})
+	}
+}
+
+func TestStatusRecorder_ReadFromImpliesOK(t *testing.T) {
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	rec.ReadFrom(strings.NewReader("x"))
+	if rec.status != http.StatusOK {
+		t.Errorf("Expected implicit 200, got %d", rec.status)
+	}
+}
+
+func TestRateLimitMiddleware_HijackWithCountStatus(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 5, Window: time.Minute}, s)
+
+	handler := RateLimitMiddleware(limiter, WithCountStatus(NotServerError))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, rw, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				t.Errorf("Hijack through the status recorder failed: %v", err)
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: close\r\n\r\n")
+			rw.Flush()
+		}),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected 101 from the hijacked connection, got %d", resp.StatusCode)
+	}
+}
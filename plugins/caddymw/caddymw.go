@@ -0,0 +1,245 @@
+// Package caddymw is a Caddy HTTP handler module applying per-endpoint rate
+// limits with the middleware Router, configured with the same endpoint
+// schema as EndpointSpec.
+//
+// It is a separate module, so that the ratelimiter module keeps depending on
+// the standard library only. Build Caddy with it using xcaddy:
+//
+//	xcaddy build --with github.com/Morditux/ratelimiter/plugins/caddymw
+//
+// The module ID is http.handlers.ratelimiter, and the Caddyfile directive
+// ratelimiter is ordered before reverse_proxy:
+//
+//	ratelimiter {
+//		trusted_proxies 10.0.0.0/8
+//		max_entries 100000
+//		endpoint /api/auth/* 5/m {
+//			algorithm sliding_window
+//			methods POST
+//		}
+//		endpoint /api/* 100/m
+//	}
+//
+// Limits are kept in memory, per Caddy instance, and start over when the
+// configuration is reloaded.
+package caddymw
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/middleware"
+	"github.com/Morditux/ratelimiter/store"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+	httpcaddyfile.RegisterHandlerDirective("ratelimiter", parseCaddyfile)
+	httpcaddyfile.RegisterDirectiveOrder("ratelimiter", httpcaddyfile.Before, "reverse_proxy")
+}
+
+// Handler rate limits the requests matching its endpoints. Requests matching
+// none of them are not limited.
+type Handler struct {
+	// Endpoints are the rate limited endpoints.
+	Endpoints []middleware.EndpointSpec `json:"endpoints,omitempty"`
+
+	// TrustedProxies are the IPs or CIDR blocks whose X-Forwarded-For
+	// entries are trusted to find the client IP (see TrustedIPKeyFunc).
+	// Default: clients are keyed by their connection's IP.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+
+	// MaxEntries bounds the number of keys kept in memory.
+	// Default: the MemoryStore default.
+	MaxEntries int `json:"max_entries,omitempty"`
+
+	router *middleware.Router
+}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ratelimiter",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision creates the router of the handler.
+func (h *Handler) Provision(ctx caddy.Context) error {
+	endpoints, err := middleware.EndpointConfigs(h.Endpoints)
+	if err != nil {
+		return err
+	}
+
+	opts := []middleware.Option{middleware.WithStoreOwnership(true)}
+	if len(h.TrustedProxies) > 0 {
+		keyFunc, err := middleware.TrustedIPKeyFunc(h.TrustedProxies)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, middleware.WithKeyFunc(keyFunc))
+	}
+
+	s := store.NewMemoryStoreWithConfig(store.MemoryStoreConfig{MaxEntries: h.MaxEntries})
+	h.router, err = middleware.NewRouter(nextHandler{}, s, endpoints, opts...)
+	if err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+// Cleanup releases the store of the handler when its configuration is
+// unloaded.
+func (h *Handler) Cleanup() error {
+	if h.router == nil {
+		return nil
+	}
+	return h.router.Close()
+}
+
+// nextKey is the context key of the nextCall of a request.
+type nextKey struct{}
+
+// nextCall is the rest of the Caddy handler chain of a request, and the
+// error it returned.
+type nextCall struct {
+	next caddyhttp.Handler
+	err  error
+}
+
+// nextHandler is the handler of the router: it calls the rest of the chain
+// of the request, which Caddy only passes to ServeHTTP.
+type nextHandler struct{}
+
+func (nextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := r.Context().Value(nextKey{}).(*nextCall)
+	call.err = call.next.ServeHTTP(w, r)
+}
+
+// ServeHTTP rate limits the request, and passes it to next if allowed.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	call := &nextCall{next: next}
+	h.router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), nextKey{}, call)))
+	return call.err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens:
+//
+//	ratelimiter {
+//		trusted_proxies <ips or cidrs...>
+//		max_entries <n>
+//		endpoint <path> <rate> {
+//			algorithm <token_bucket|sliding_window>
+//			burst <n>
+//			methods <methods...>
+//			host <host>
+//			key_header <header>
+//		}
+//	}
+//
+// Rates are parsed with ratelimiter.ParseRate, e.g. 100/m or 5/10m.
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // Directive name
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+
+	for d.NextBlock(0) {
+		switch d.Val() {
+		case "trusted_proxies":
+			proxies := d.RemainingArgs()
+			if len(proxies) == 0 {
+				return d.ArgErr()
+			}
+			h.TrustedProxies = append(h.TrustedProxies, proxies...)
+		case "max_entries":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return d.Errf("invalid max_entries %q: %v", d.Val(), err)
+			}
+			h.MaxEntries = n
+		case "endpoint":
+			spec, err := unmarshalEndpoint(d)
+			if err != nil {
+				return err
+			}
+			h.Endpoints = append(h.Endpoints, spec)
+		default:
+			return d.Errf("unknown subdirective %q", d.Val())
+		}
+	}
+	return nil
+}
+
+// unmarshalEndpoint parses an endpoint subdirective.
+func unmarshalEndpoint(d *caddyfile.Dispenser) (middleware.EndpointSpec, error) {
+	var spec middleware.EndpointSpec
+	var rate string
+	if !d.Args(&spec.Path, &rate) {
+		return spec, d.ArgErr()
+	}
+	config, err := ratelimiter.ParseRate(rate)
+	if err != nil {
+		return spec, d.Errf("invalid rate %q: %v", rate, err)
+	}
+	spec.Rate, spec.Window, spec.Burst = config.Rate, config.Window.String(), config.BurstSize
+
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "algorithm":
+			if !d.Args(&spec.Algorithm) {
+				return spec, d.ArgErr()
+			}
+		case "burst":
+			if !d.NextArg() {
+				return spec, d.ArgErr()
+			}
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return spec, d.Errf("invalid burst %q: %v", d.Val(), err)
+			}
+			spec.Burst = n
+		case "methods":
+			spec.Methods = d.RemainingArgs()
+			if len(spec.Methods) == 0 {
+				return spec, d.ArgErr()
+			}
+		case "host":
+			if !d.Args(&spec.Host) {
+				return spec, d.ArgErr()
+			}
+		case "key_header":
+			if !d.Args(&spec.KeyHeader) {
+				return spec, d.ArgErr()
+			}
+		default:
+			return spec, d.Errf("unknown endpoint subdirective %q", d.Val())
+		}
+	}
+	return spec, nil
+}
+
+// parseCaddyfile sets up the handler of a ratelimiter directive.
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(Handler)
+	err := handler.UnmarshalCaddyfile(h.Dispenser)
+	return handler, err
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.CleanerUpper          = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyfile.Unmarshaler       = (*Handler)(nil)
+)
@@ -0,0 +1,121 @@
+package caddymw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Morditux/ratelimiter/middleware"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	ratelimiter {
+		trusted_proxies 10.0.0.0/8 192.168.0.0/16
+		max_entries 1000
+		endpoint /api/auth/* 5/m {
+			algorithm sliding_window
+			methods POST PUT
+			key_header X-API-Key
+		}
+		endpoint /api/* 100/m {
+			burst 20
+		}
+	}`)
+	var h Handler
+	if err := h.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+
+	if len(h.TrustedProxies) != 2 || h.MaxEntries != 1000 || len(h.Endpoints) != 2 {
+		t.Fatalf("Unexpected handler %+v", h)
+	}
+	auth, api := h.Endpoints[0], h.Endpoints[1]
+	if auth.Path != "/api/auth/*" || auth.Rate != 5 || auth.Window != "1m0s" || auth.Algorithm != "sliding_window" ||
+		len(auth.Methods) != 2 || auth.KeyHeader != "X-API-Key" {
+		t.Errorf("Unexpected auth endpoint %+v", auth)
+	}
+	if api.Rate != 100 || api.Burst != 20 {
+		t.Errorf("Unexpected api endpoint %+v", api)
+	}
+
+	for _, input := range []string{
+		`ratelimiter extra`,
+		`ratelimiter { endpoint /api/* }`,
+		`ratelimiter { endpoint /api/* fast }`,
+		`ratelimiter { endpoint /api/* 10/s { unknown } }`,
+		`ratelimiter { max_entries many }`,
+		`ratelimiter { unknown }`,
+	} {
+		var h Handler
+		if err := h.UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	ratelimiter {
+		trusted_proxies 10.0.0.0/8
+		endpoint /api/* 1/m
+	}`)
+	h := new(Handler)
+	if err := h.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	if err := h.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	defer h.Cleanup()
+
+	errNext := errors.New("upstream failed")
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Path == "/api/fail" {
+			return errNext
+		}
+		return nil
+	})
+	serve := func(path, clientIP string) (int, error) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", clientIP)
+		rec := httptest.NewRecorder()
+		err := h.ServeHTTP(rec, req, next)
+		return rec.Code, err
+	}
+
+	if code, err := serve("/api/users", "203.0.113.1"); code != http.StatusOK || err != nil {
+		t.Fatalf("Expected the first request to be allowed, got %d, %v", code, err)
+	}
+	if code, _ := serve("/api/users", "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second request to be limited, got %d", code)
+	}
+	if code, _ := serve("/other", "203.0.113.1"); code != http.StatusOK {
+		t.Errorf("Expected requests outside the endpoints not to be limited, got %d", code)
+	}
+	// Errors of the rest of the chain are returned to Caddy
+	if _, err := serve("/api/fail", "203.0.113.2"); !errors.Is(err, errNext) {
+		t.Errorf("Expected the error of next, got %v", err)
+	}
+}
+
+func TestProvision_InvalidConfig(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	for _, h := range []*Handler{
+		{TrustedProxies: []string{"not an ip"}},
+		{Endpoints: []middleware.EndpointSpec{{Path: "/api/*", Rate: 10}}},
+	} {
+		if err := h.Provision(ctx); err == nil {
+			t.Errorf("Expected an error for %+v", h)
+		}
+	}
+}
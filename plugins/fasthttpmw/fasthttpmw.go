@@ -0,0 +1,211 @@
+// Package fasthttpmw is the rate limiting middleware for fasthttp servers.
+//
+// It applies a limiter like middleware.RateLimitMiddleware, without the
+// conversion of fasthttp requests to net/http: keys are appended to a
+// reused buffer from the RequestCtx, and the strings passed to the limiter
+// are interned, so that requests of known clients do not allocate.
+//
+//	limiter, _ := algorithms.NewTokenBucket(config, store.NewMemoryStore())
+//	limit := fasthttpmw.New(limiter, fasthttpmw.WithKeyFunc(fasthttpmw.HeaderKey("X-API-Key")))
+//	fasthttp.ListenAndServe(":8080", limit(handler))
+//
+// It is a separate module, so that the ratelimiter module keeps depending on
+// the standard library only.
+package fasthttpmw
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/store"
+	"github.com/valyala/fasthttp"
+)
+
+// KeyFunc appends the rate limiting key of a request to dst and returns the
+// extended buffer. An empty key falls back to RemoteIPKey.
+type KeyFunc func(ctx *fasthttp.RequestCtx, dst []byte) []byte
+
+// Options configures the middleware.
+type Options struct {
+	// KeyFunc extracts the rate limiting key from the request.
+	// Default: RemoteIPKey.
+	KeyFunc KeyFunc
+
+	// OnLimited writes the response of rate limited requests.
+	// Default: DefaultOnLimited.
+	OnLimited fasthttp.RequestHandler
+
+	// MaxKeySize is the maximum allowed length of a rate limit key. Longer
+	// keys are rejected with 431 Request Header Fields Too Large.
+	// Default: 4096.
+	MaxKeySize int
+
+	// MaxKeys bounds the number of interned keys. Beyond it, interned
+	// keys are dropped and allocated again on their next request.
+	// Default: 65536.
+	MaxKeys int
+
+	// Headers writes the X-RateLimit-Limit, X-RateLimit-Remaining and
+	// X-RateLimit-Reset headers for limiters reporting details.
+	// Default: true.
+	Headers bool
+}
+
+// Option is a function that configures Options.
+type Option func(*Options)
+
+// WithKeyFunc sets a custom key extraction function.
+func WithKeyFunc(fn KeyFunc) Option {
+	return func(o *Options) {
+		o.KeyFunc = fn
+	}
+}
+
+// WithOnLimited sets a custom rate limit exceeded handler.
+func WithOnLimited(fn fasthttp.RequestHandler) Option {
+	return func(o *Options) {
+		o.OnLimited = fn
+	}
+}
+
+// WithMaxKeySize sets the maximum allowed length of a rate limit key.
+func WithMaxKeySize(size int) Option {
+	return func(o *Options) {
+		o.MaxKeySize = size
+	}
+}
+
+// WithMaxKeys sets the number of interned keys.
+func WithMaxKeys(n int) Option {
+	return func(o *Options) {
+		o.MaxKeys = n
+	}
+}
+
+// WithHeaders turns the rate limit headers on or off.
+func WithHeaders(enabled bool) Option {
+	return func(o *Options) {
+		o.Headers = enabled
+	}
+}
+
+var (
+	headerLimit     = []byte("X-RateLimit-Limit")
+	headerRemaining = []byte("X-RateLimit-Remaining")
+	headerReset     = []byte("X-RateLimit-Reset")
+	headerRetry     = []byte("Retry-After")
+)
+
+// New returns the middleware applying limiter to fasthttp handlers.
+//
+// Like middleware.RateLimitMiddleware, it fails secure on keys too long,
+// full stores and costs exceeding the limit, and fails open on other
+// limiter errors (e.g. an unreachable remote store).
+func New(limiter ratelimiter.Limiter, opts ...Option) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	options := &Options{
+		KeyFunc:    RemoteIPKey,
+		OnLimited:  DefaultOnLimited,
+		MaxKeySize: 4096,
+		MaxKeys:    65536,
+		Headers:    true,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.MaxKeySize <= 0 {
+		options.MaxKeySize = 4096
+	}
+	if options.MaxKeys <= 0 {
+		options.MaxKeys = 65536
+	}
+
+	details, hasDetails := limiter.(ratelimiter.LimiterWithDetails)
+	keys := newInterner(options.MaxKeys)
+	buffers := sync.Pool{New: func() interface{} { return new([]byte) }}
+
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			buf := buffers.Get().(*[]byte)
+			defer buffers.Put(buf)
+
+			b := options.KeyFunc(ctx, (*buf)[:0])
+			if len(b) == 0 {
+				b = RemoteIPKey(ctx, b)
+			}
+			*buf = b
+
+			// FAIL SECURE: Check key length early to prevent DoS (memory/cpu) in the limiter/store.
+			if len(b) > options.MaxKeySize {
+				ctx.Error("Rate limit key too long", fasthttp.StatusRequestHeaderFieldsTooLarge)
+				return
+			}
+			key := keys.intern(b)
+
+			var result ratelimiter.Result
+			var err error
+			if hasDetails {
+				result, err = details.AllowNWithDetails(key, 1)
+			} else {
+				result.Allowed, err = limiter.Allow(key)
+			}
+
+			if err != nil {
+				switch {
+				case errors.Is(err, store.ErrKeyTooLong):
+					ctx.Error("Rate limit key too long", fasthttp.StatusRequestHeaderFieldsTooLarge)
+				case errors.Is(err, store.ErrStoreFull):
+					ctx.Error("Rate limit store full", fasthttp.StatusServiceUnavailable)
+				case errors.Is(err, ratelimiter.ErrCostExceedsCapacity):
+					ctx.Error("Request cost exceeds rate limit capacity", fasthttp.StatusRequestEntityTooLarge)
+				default:
+					// FAIL OPEN: e.g. the remote store is down
+					next(ctx)
+				}
+				return
+			}
+
+			if hasDetails && options.Headers {
+				writeHeaders(ctx, result, buf)
+			}
+			if !result.Allowed {
+				if result.RetryAfter > 0 {
+					seconds := int64((result.RetryAfter + time.Second - 1) / time.Second)
+					*buf = strconv.AppendInt((*buf)[:0], seconds, 10)
+					ctx.Response.Header.SetBytesKV(headerRetry, *buf)
+				}
+				options.OnLimited(ctx)
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// writeHeaders writes the rate limit headers of result, formatting the
+// values in buf.
+func writeHeaders(ctx *fasthttp.RequestCtx, result ratelimiter.Result, buf *[]byte) {
+	h := &ctx.Response.Header
+	*buf = strconv.AppendInt((*buf)[:0], int64(result.Limit), 10)
+	h.SetBytesKV(headerLimit, *buf)
+	*buf = strconv.AppendInt((*buf)[:0], int64(result.Remaining), 10)
+	h.SetBytesKV(headerRemaining, *buf)
+	if !result.ResetAt.IsZero() {
+		*buf = strconv.AppendInt((*buf)[:0], result.ResetAt.Unix(), 10)
+		h.SetBytesKV(headerReset, *buf)
+	}
+}
+
+// DefaultOnLimited responds 429 Too Many Requests with the JSON body of
+// middleware.DefaultOnLimited.
+func DefaultOnLimited(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	if len(ctx.Response.Header.Peek("Retry-After")) == 0 {
+		ctx.Response.Header.Set("Retry-After", "60")
+	}
+	ctx.SetStatusCode(fasthttp.StatusTooManyRequests)
+	ctx.SetContentType("application/json")
+	ctx.SetBodyString(`{"error":"rate limit exceeded","message":"too many requests, please try again later"}`)
+}
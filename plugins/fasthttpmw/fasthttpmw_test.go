@@ -0,0 +1,149 @@
+package fasthttpmw
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+	"github.com/valyala/fasthttp"
+)
+
+// newCtx returns a request context from the given client IP.
+func newCtx(ip string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&fasthttp.Request{}, &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}, nil)
+	ctx.Request.SetRequestURI("/api")
+	return ctx
+}
+
+func newLimiter(t *testing.T, rate int) ratelimiter.Limiter {
+	t.Helper()
+	s := store.NewMemoryStore()
+	t.Cleanup(func() { s.Close() })
+	l, err := algorithms.NewTokenBucket(ratelimiter.Config{Rate: rate, Window: time.Minute}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestNew(t *testing.T) {
+	handler := New(newLimiter(t, 2))(func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusOK)
+	})
+
+	for i, want := range []int{fasthttp.StatusOK, fasthttp.StatusOK, fasthttp.StatusTooManyRequests} {
+		ctx := newCtx("192.0.2.1")
+		handler(ctx)
+		if got := ctx.Response.StatusCode(); got != want {
+			t.Errorf("request %d: expected %d, got %d", i+1, want, got)
+		}
+		if i == 0 {
+			if got := string(ctx.Response.Header.Peek("X-RateLimit-Remaining")); got != "1" {
+				t.Errorf("Expected 1 remaining, got %q", got)
+			}
+		}
+		if want == fasthttp.StatusTooManyRequests && len(ctx.Response.Header.Peek("Retry-After")) == 0 {
+			t.Error("Expected a Retry-After header")
+		}
+	}
+
+	// Other clients are limited separately
+	ctx := newCtx("192.0.2.2")
+	handler(ctx)
+	if got := ctx.Response.StatusCode(); got != fasthttp.StatusOK {
+		t.Errorf("Expected another client to be allowed, got %d", got)
+	}
+}
+
+func TestHeaderKey(t *testing.T) {
+	handler := New(newLimiter(t, 1), WithKeyFunc(HeaderKey("X-API-Key")))(func(ctx *fasthttp.RequestCtx) {})
+
+	serve := func(apiKey string) int {
+		ctx := newCtx("192.0.2.1")
+		if apiKey != "" {
+			ctx.Request.Header.Set("X-API-Key", apiKey)
+		}
+		handler(ctx)
+		return ctx.Response.StatusCode()
+	}
+
+	if code := serve("a"); code != fasthttp.StatusOK {
+		t.Fatalf("Expected the first request to be allowed, got %d", code)
+	}
+	if code := serve("b"); code != fasthttp.StatusOK {
+		t.Errorf("Expected another API key from the same IP to be allowed, got %d", code)
+	}
+	if code := serve(""); code != fasthttp.StatusOK {
+		t.Errorf("Expected requests without the header to be keyed by IP, got %d", code)
+	}
+	if code := serve("a"); code != fasthttp.StatusTooManyRequests {
+		t.Errorf("Expected the API key to be limited, got %d", code)
+	}
+}
+
+// failingLimiter fails every check with err.
+type failingLimiter struct{ err error }
+
+func (l failingLimiter) Allow(key string) (bool, error)         { return false, l.err }
+func (l failingLimiter) AllowN(key string, n int) (bool, error) { return false, l.err }
+func (l failingLimiter) Reset(key string) error                 { return nil }
+
+func TestNew_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{store.ErrStoreFull, fasthttp.StatusServiceUnavailable},
+		{store.ErrKeyTooLong, fasthttp.StatusRequestHeaderFieldsTooLarge},
+		{errors.New("store unreachable"), fasthttp.StatusOK}, // Fail open
+	} {
+		handler := New(failingLimiter{tc.err})(func(ctx *fasthttp.RequestCtx) {})
+		ctx := newCtx("192.0.2.1")
+		handler(ctx)
+		if got := ctx.Response.StatusCode(); got != tc.want {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.want, got)
+		}
+	}
+
+	handler := New(newLimiter(t, 1), WithMaxKeySize(4))(func(ctx *fasthttp.RequestCtx) {})
+	ctx := newCtx("192.0.2.1")
+	handler(ctx)
+	if got := ctx.Response.StatusCode(); got != fasthttp.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected long keys to be rejected, got %d", got)
+	}
+}
+
+func TestNew_ZeroAllocs(t *testing.T) {
+	handler := New(newLimiter(t, 1_000_000))(func(ctx *fasthttp.RequestCtx) {})
+	ctx := newCtx("2001:db8::1")
+	handler(ctx) // Interns the key and creates its state
+
+	allocs := testing.AllocsPerRun(100, func() {
+		ctx.Response.Reset()
+		handler(ctx)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocation per request of a known client, got %v", allocs)
+	}
+}
+
+func TestInterner(t *testing.T) {
+	in := newInterner(internShards) // One key per shard
+	a := in.intern([]byte("a"))
+	if a != "a" {
+		t.Fatalf("Unexpected key %q", a)
+	}
+	for i := 0; i < 100; i++ {
+		in.intern([]byte{byte(i)})
+	}
+	for i := range in.shards {
+		if n := len(in.shards[i].keys); n > 1 {
+			t.Errorf("Expected shards bounded to 1 key, got %d", n)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package fasthttpmw
+
+import (
+	"hash/maphash"
+	"net/netip"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// RemoteIPKey appends the IP of the client connection, without port, to
+// dst. It does not allocate.
+func RemoteIPKey(ctx *fasthttp.RequestCtx, dst []byte) []byte {
+	addr, ok := netip.AddrFromSlice(ctx.RemoteIP())
+	if !ok {
+		return dst
+	}
+	return addr.Unmap().AppendTo(dst)
+}
+
+// HeaderKey returns a KeyFunc appending the value of the named request
+// header, e.g. an API key, prefixed by "header:" so that it cannot collide
+// with client IPs. Requests without the header fall back to RemoteIPKey.
+func HeaderKey(name string) KeyFunc {
+	header := []byte(name)
+	return func(ctx *fasthttp.RequestCtx, dst []byte) []byte {
+		v := ctx.Request.Header.PeekBytes(header)
+		if len(v) == 0 {
+			return dst
+		}
+		return append(append(dst, "header:"...), v...)
+	}
+}
+
+// internShards is the number of independently locked interner shards.
+const internShards = 16
+
+// interner maps key bytes to strings allocated once, so that limiters,
+// which take string keys, can be called without allocating per request.
+type interner struct {
+	seed   maphash.Seed
+	max    int // Keys per shard
+	shards [internShards]internShard
+}
+
+// internShard is a locked part of an interner.
+type internShard struct {
+	mu   sync.RWMutex
+	keys map[string]string
+}
+
+func newInterner(maxKeys int) *interner {
+	in := &interner{seed: maphash.MakeSeed(), max: max(maxKeys/internShards, 1)}
+	for i := range in.shards {
+		in.shards[i].keys = make(map[string]string)
+	}
+	return in
+}
+
+// intern returns the string of b. Lookups of known keys do not allocate;
+// a full shard is cleared before a new key is added.
+func (in *interner) intern(b []byte) string {
+	shard := &in.shards[maphash.Bytes(in.seed, b)%internShards]
+
+	shard.mu.RLock()
+	s, ok := shard.keys[string(b)] // No allocation: the conversion is only used for the lookup
+	shard.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	s = string(b)
+	shard.mu.Lock()
+	if len(shard.keys) >= in.max {
+		clear(shard.keys)
+	}
+	shard.keys[s] = s
+	shard.mu.Unlock()
+	return s
+}
@@ -0,0 +1,113 @@
+// Package traefik is a Traefik middleware plugin applying per-endpoint rate
+// limits with the middleware Router, configured with the same endpoint
+// schema as EndpointSpec.
+//
+// The plugin is interpreted by Yaegi, so it only imports the standard library
+// and this module. Its manifest is .traefik.yml at the repository root.
+// Example dynamic configuration:
+//
+//	http:
+//	  middlewares:
+//	    ratelimit:
+//	      plugin:
+//	        ratelimiter:
+//	          trustedProxies: ["10.0.0.0/8"]
+//	          endpoints:
+//	            - path: /api/auth/*
+//	              rate: 5
+//	              window: 1m
+//	              algorithm: sliding_window
+//	            - path: /api/*
+//	              rate: 100
+//	              window: 1m
+//
+// Limits are kept in memory, per Traefik instance. Each plugin instance
+// keeps its store across configuration reloads, so that reloads do not
+// reset the limits nor leak the store of the replaced handler.
+package traefik
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Morditux/ratelimiter/middleware"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// Config is the plugin configuration.
+type Config struct {
+	// Endpoints are the rate limited endpoints. Requests matching none of
+	// them are not limited.
+	Endpoints []middleware.EndpointSpec `json:"endpoints,omitempty"`
+
+	// TrustedProxies are the IPs or CIDR blocks whose X-Forwarded-For
+	// entries are trusted to find the client IP (see TrustedIPKeyFunc).
+	// Default: clients are keyed by their connection's IP.
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+
+	// MaxEntries bounds the number of keys kept in memory.
+	// Default: the MemoryStore default.
+	MaxEntries int `json:"maxEntries,omitempty"`
+}
+
+// CreateConfig returns the default plugin configuration.
+func CreateConfig() *Config {
+	return &Config{}
+}
+
+// New creates the rate limiting middleware in front of next.
+func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+	endpoints, err := middleware.EndpointConfigs(config.Endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	var opts []middleware.Option
+	if len(config.TrustedProxies) > 0 {
+		keyFunc, err := middleware.TrustedIPKeyFunc(config.TrustedProxies)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		opts = append(opts, middleware.WithKeyFunc(keyFunc))
+	}
+
+	router, err := middleware.NewRouter(next, storeFor(name, config.MaxEntries), endpoints, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return router, nil
+}
+
+// instanceStore is the store of a plugin instance.
+type instanceStore struct {
+	store      *store.MemoryStore
+	maxEntries int
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]instanceStore) // By plugin instance name
+)
+
+// storeFor returns the store of the plugin instance name. Traefik calls New
+// again on every configuration reload without closing the replaced handler,
+// so the store is shared by the handlers of an instance; it is replaced, and
+// the previous one closed, only when its MaxEntries changes.
+func storeFor(name string, maxEntries int) *store.MemoryStore {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	if s, ok := stores[name]; ok {
+		if s.maxEntries == maxEntries {
+			return s.store
+		}
+		// The replaced handler may still serve requests: a closed
+		// MemoryStore remains usable, it only stops its cleanup.
+		s.store.Close()
+	}
+	s := store.NewMemoryStoreWithConfig(store.MemoryStoreConfig{MaxEntries: maxEntries})
+	stores[name] = instanceStore{store: s, maxEntries: maxEntries}
+	return s
+}
@@ -0,0 +1,135 @@
+package traefik
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Morditux/ratelimiter/middleware"
+)
+
+func TestNew(t *testing.T) {
+	config := CreateConfig()
+	err := json.Unmarshal([]byte(`{
+		"trustedProxies": ["10.0.0.0/8"],
+		"endpoints": [
+			{"path": "/api/auth/*", "rate": 1, "window": "1m", "algorithm": "sliding_window"},
+			{"path": "/api/*", "rate": 100, "window": "1m"}
+		]
+	}`), config)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler, err := New(context.Background(), next, config, "ratelimit")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	serve := func(path, clientIP string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", clientIP)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve("/api/auth/login", "203.0.113.1"); code != http.StatusOK {
+		t.Fatalf("Expected the first request to be allowed, got %d", code)
+	}
+	if code := serve("/api/auth/login", "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second request to be limited, got %d", code)
+	}
+	// Clients behind the trusted proxy are limited separately
+	if code := serve("/api/auth/login", "203.0.113.2"); code != http.StatusOK {
+		t.Errorf("Expected another client to be allowed, got %d", code)
+	}
+}
+
+func TestNew_Reload(t *testing.T) {
+	config := &Config{Endpoints: []middleware.EndpointSpec{{Path: "/*", Rate: 1, Window: "1m"}}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(handler http.Handler) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Code
+	}
+
+	first, err := New(context.Background(), next, config, "reload")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if code := serve(first); code != http.StatusOK {
+		t.Fatalf("Expected the first request to be allowed, got %d", code)
+	}
+	s := stores["reload"].store
+
+	// Reloads share the store of the instance
+	second, err := New(context.Background(), next, config, "reload")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if code := serve(second); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the limit to survive the reload, got %d", code)
+	}
+	if stores["reload"].store != s {
+		t.Error("Expected the store to be reused")
+	}
+	other, err := New(context.Background(), next, config, "other")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if code := serve(other); code != http.StatusOK {
+		t.Errorf("Expected instances to have their own store, got %d", code)
+	}
+
+	// A new store size replaces the store
+	config.MaxEntries = 10
+	if _, err := New(context.Background(), next, config, "reload"); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if stores["reload"].store == s {
+		t.Error("Expected the store to be replaced")
+	}
+	if code := serve(second); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the replaced handler to keep working, got %d", code)
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, config := range []*Config{
+		{TrustedProxies: []string{"not an ip"}},
+		{Endpoints: []middleware.EndpointSpec{{Path: "/api/*", Rate: 10}}},
+	} {
+		if _, err := New(context.Background(), next, config, "ratelimit"); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
+
+// TestNoUnsafe checks that the packages interpreted by Traefik, those of the
+// plugin and of the module, do not import unsafe, which Yaegi rejects.
+func TestNoUnsafe(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	out, err := exec.Command("go", "list", "-deps", "-f", `{{if not .Standard}}{{.ImportPath}}: {{join .Imports " "}}{{end}}`, ".").Output()
+	if err != nil {
+		t.Fatalf("go list failed: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		pkg, imports, _ := strings.Cut(line, ": ")
+		for _, imp := range strings.Fields(imports) {
+			if imp == "unsafe" {
+				t.Errorf("%s imports unsafe", pkg)
+			}
+		}
+	}
+}
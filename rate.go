@@ -0,0 +1,146 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRateScale bounds the factor FloatRate scales a fractional rate and its
+// window by to make the rate whole. Rates that need more are rounded.
+const maxRateScale = 1000
+
+// Every returns a config allowing one request every interval, without
+// bursting, e.g. Every(10*time.Minute) or Every(2*time.Second) for 0.5
+// requests per second.
+func Every(interval time.Duration) Config {
+	return Config{
+		Rate:      1,
+		Window:    interval,
+		BurstSize: 1,
+	}
+}
+
+// FloatRate returns a config allowing rate requests per window, where rate
+// may be fractional, e.g. FloatRate(0.5, time.Second) or FloatRate(2.5,
+// time.Second). Config.Rate is whole, so the rate and the window are scaled
+// by the smallest factor making the rate whole (0.5/s is 1 per 2s, 2.5/s is 5
+// per 2s), which both algorithms and the rate limit headers then use as is.
+// BurstSize is the rate rounded up, so that the bucket holds at most one
+// window's worth of requests.
+//
+// It returns ErrInvalidRate if rate is not positive and finite, and
+// ErrInvalidWindow if window is not positive or too long to be scaled.
+func FloatRate(rate float64, window time.Duration) (Config, error) {
+	if !(rate > 0) || math.IsInf(rate, 1) || rate > math.MaxInt32 {
+		return Config{}, ErrInvalidRate
+	}
+	if window <= 0 {
+		return Config{}, ErrInvalidWindow
+	}
+
+	scale := int64(maxRateScale)
+	for m := int64(1); m < maxRateScale; m++ {
+		scaled := rate * float64(m)
+		if math.Abs(scaled-math.Round(scaled)) <= 1e-9*scaled {
+			scale = m
+			break
+		}
+	}
+	if rate*float64(scale) < 1 {
+		// Very low rates, e.g. one request per day with a one-second window
+		scale = int64(math.Round(1 / rate))
+	}
+	if int64(window) > math.MaxInt64/scale {
+		return Config{}, ErrInvalidWindow
+	}
+
+	return Config{
+		Rate:      max(int(math.Round(rate*float64(scale))), 1),
+		Window:    window * time.Duration(scale),
+		BurstSize: int(math.Ceil(rate)),
+	}, nil
+}
+
+// rateUnits are the time units accepted by ParseRate.
+var rateUnits = map[string]time.Duration{
+	"ms": time.Millisecond, "millisecond": time.Millisecond,
+	"s": time.Second, "sec": time.Second, "second": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hour": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour,
+}
+
+// ParseRate parses a human-readable rate into a validated config, for
+// configuration files and environment variables. A rate is a number of
+// requests, possibly fractional, per a time unit or a duration:
+//
+//	100/m, 100/min, 10/s, 0.5/s, 1000/h, 5/10m, 100/1m30s
+//	10 per second, 100 per minute, 5 per 10 minutes, 1 per day
+//
+// Units are ms, s, m, h and d, or their names (sec, second, min, minute,
+// hr, hour, day), optionally plural. The config is built with FloatRate.
+func ParseRate(s string) (Config, error) {
+	count, per, ok := strings.Cut(s, "/")
+	if !ok {
+		count, per, ok = strings.Cut(s, " per ")
+	}
+	if !ok {
+		return Config{}, fmt.Errorf("%w: %q: expected \"<requests>/<unit>\" or \"<requests> per <unit>\"", ErrInvalidRateFormat, s)
+	}
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: %q: invalid number of requests", ErrInvalidRateFormat, s)
+	}
+	window, err := parseRateWindow(strings.ToLower(strings.TrimSpace(per)))
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: %q: %v", ErrInvalidRateFormat, s, err)
+	}
+
+	config, err := FloatRate(rate, window)
+	if err != nil {
+		return Config{}, fmt.Errorf("%w: %q: %w", ErrInvalidRateFormat, s, err)
+	}
+	return config, nil
+}
+
+// parseRateWindow parses the window of a rate: a unit, a number of units
+// ("10 minutes", "10m") or a duration ("1m30s").
+func parseRateWindow(s string) (time.Duration, error) {
+	if d, ok := rateUnit(s); ok {
+		return d, nil
+	}
+
+	// A number of units, with or without a space
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i > 0 {
+		n, err := strconv.ParseFloat(s[:i], 64)
+		if d, ok := rateUnit(strings.TrimSpace(s[i:])); ok && err == nil {
+			if n <= 0 || n*float64(d) > math.MaxInt64 {
+				return 0, fmt.Errorf("invalid window %q", s)
+			}
+			return time.Duration(n * float64(d)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown unit %q", s)
+	}
+	return d, nil
+}
+
+// rateUnit returns the duration of a unit name, which may be plural.
+func rateUnit(s string) (time.Duration, bool) {
+	if d, ok := rateUnits[s]; ok {
+		return d, true
+	}
+	if trimmed, ok := strings.CutSuffix(s, "s"); ok && len(trimmed) > 1 {
+		d, ok := rateUnits[trimmed]
+		return d, ok
+	}
+	return 0, false
+}
@@ -0,0 +1,107 @@
+package ratelimiter
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEvery(t *testing.T) {
+	c := Every(10 * time.Minute)
+	if c.Rate != 1 || c.Window != 10*time.Minute || c.BurstSize != 1 {
+		t.Errorf("Unexpected config: %+v", c)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestFloatRate(t *testing.T) {
+	for _, tc := range []struct {
+		rate   float64
+		window time.Duration
+		want   Config
+	}{
+		{10, time.Second, Config{Rate: 10, Window: time.Second, BurstSize: 10}},
+		{0.5, time.Second, Config{Rate: 1, Window: 2 * time.Second, BurstSize: 1}},
+		{2.5, time.Second, Config{Rate: 5, Window: 2 * time.Second, BurstSize: 3}},
+		{0.1, time.Minute, Config{Rate: 1, Window: 10 * time.Minute, BurstSize: 1}},
+		{1.0 / 3, time.Second, Config{Rate: 1, Window: 3 * time.Second, BurstSize: 1}},
+		{1.0 / 86400, time.Second, Config{Rate: 1, Window: 24 * time.Hour, BurstSize: 1}},
+	} {
+		got, err := FloatRate(tc.rate, tc.window)
+		if err != nil {
+			t.Errorf("FloatRate(%v, %v): %v", tc.rate, tc.window, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FloatRate(%v, %v) = %+v, want %+v", tc.rate, tc.window, got, tc.want)
+		}
+		if err := got.Validate(); err != nil {
+			t.Errorf("FloatRate(%v, %v): Validate: %v", tc.rate, tc.window, err)
+		}
+	}
+}
+
+func TestFloatRate_Invalid(t *testing.T) {
+	for _, rate := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if _, err := FloatRate(rate, time.Second); !errors.Is(err, ErrInvalidRate) {
+			t.Errorf("FloatRate(%v): expected ErrInvalidRate, got %v", rate, err)
+		}
+	}
+	if _, err := FloatRate(1, 0); !errors.Is(err, ErrInvalidWindow) {
+		t.Errorf("Expected ErrInvalidWindow for a zero window, got %v", err)
+	}
+	if _, err := FloatRate(0.5, math.MaxInt64/2+1); !errors.Is(err, ErrInvalidWindow) {
+		t.Errorf("Expected ErrInvalidWindow for an overflowing window, got %v", err)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want Config
+	}{
+		{"100/m", Config{Rate: 100, Window: time.Minute, BurstSize: 100}},
+		{"100/min", Config{Rate: 100, Window: time.Minute, BurstSize: 100}},
+		{"10/s", Config{Rate: 10, Window: time.Second, BurstSize: 10}},
+		{"1000/h", Config{Rate: 1000, Window: time.Hour, BurstSize: 1000}},
+		{"5/10m", Config{Rate: 5, Window: 10 * time.Minute, BurstSize: 5}},
+		{"100/1m30s", Config{Rate: 100, Window: 90 * time.Second, BurstSize: 100}},
+		{"0.5/s", Config{Rate: 1, Window: 2 * time.Second, BurstSize: 1}},
+		{"10 per second", Config{Rate: 10, Window: time.Second, BurstSize: 10}},
+		{"100 per Minute", Config{Rate: 100, Window: time.Minute, BurstSize: 100}},
+		{"5 per 10 minutes", Config{Rate: 5, Window: 10 * time.Minute, BurstSize: 5}},
+		{" 1 per day ", Config{Rate: 1, Window: 24 * time.Hour, BurstSize: 1}},
+		{"20 / 2 hrs", Config{Rate: 20, Window: 2 * time.Hour, BurstSize: 20}},
+	} {
+		got, err := ParseRate(tc.s)
+		if err != nil {
+			t.Errorf("ParseRate(%q): %v", tc.s, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseRate(%q) = %+v, want %+v", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestParseRate_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"100",
+		"100 every minute",
+		"x/m",
+		"-1/m",
+		"0/m",
+		"100/",
+		"100/fortnight",
+		"100/0s",
+		"100/-1m",
+	} {
+		if _, err := ParseRate(s); !errors.Is(err, ErrInvalidRateFormat) {
+			t.Errorf("ParseRate(%q): expected ErrInvalidRateFormat, got %v", s, err)
+		}
+	}
+}
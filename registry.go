@@ -0,0 +1,147 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// Registry keeps limiters by name, so that admin APIs, metrics exporters and
+// configuration reloads can enumerate and address them instead of every
+// limiter being an anonymous local:
+//
+//	registry := ratelimiter.NewRegistry()
+//	registry.Register("search", searchLimiter)
+//	registry.Register("login", loginLimiter)
+//
+//	// Later, e.g. on configuration reload
+//	registry.Replace("search", newSearchLimiter)
+//
+// A Registry is safe for concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	limiters map[string]Limiter
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{limiters: make(map[string]Limiter)}
+}
+
+// Register adds l under name. It returns ErrDuplicateLimiter if name is
+// already registered.
+func (r *Registry) Register(name string, l Limiter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.limiters[name]; ok {
+		return ErrDuplicateLimiter
+	}
+	r.limiters[name] = l
+	return nil
+}
+
+// Replace registers l under name, replacing and returning the limiter
+// registered before, if any.
+func (r *Registry) Replace(name string, l Limiter) Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous := r.limiters[name]
+	r.limiters[name] = l
+	return previous
+}
+
+// Unregister removes the limiter registered under name and reports whether
+// there was one.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.limiters[name]
+	delete(r.limiters, name)
+	return ok
+}
+
+// Get returns the limiter registered under name.
+func (r *Registry) Get(name string) (Limiter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	l, ok := r.limiters[name]
+	return l, ok
+}
+
+// Names returns the registered names, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.limiters))
+	for name := range r.limiters {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	slices.Sort(names)
+	return names
+}
+
+// Each calls fn for every registered limiter, sorted by name. The registry
+// is not locked while fn runs, so fn may register or replace limiters.
+func (r *Registry) Each(fn func(name string, l Limiter)) {
+	for _, name := range r.Names() {
+		if l, ok := r.Get(name); ok {
+			fn(name, l)
+		}
+	}
+}
+
+// registryEntry is the JSON representation of a registered limiter. The
+// policy is only known for limiters implementing DescribableLimiter.
+type registryEntry struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Rate      int    `json:"rate,omitempty"`
+	Window    string `json:"window,omitempty"`
+	Burst     int    `json:"burst,omitempty"`
+}
+
+// Handler returns an HTTP handler for admin APIs: GET lists the registered
+// limiters as JSON ([{"name": "search", "algorithm": "token_bucket",
+// "rate": 100, "window": "1m0s", "burst": 100}]); POST resets the
+// key given by the "key" query or form parameter in the limiter named by
+// "name" (e.g. POST /ratelimit/limiters?name=search&key=acme). Mount it on
+// an internal listener or behind authentication.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			l, ok := r.Get(req.FormValue("name"))
+			if !ok {
+				http.Error(w, "Unknown limiter", http.StatusNotFound)
+				return
+			}
+			if err := l.Reset(req.FormValue("key")); err != nil {
+				http.Error(w, "Reset failed", http.StatusInternalServerError)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		entries := []registryEntry{}
+		r.Each(func(name string, l Limiter) {
+			entry := registryEntry{Name: name}
+			if d, ok := l.(DescribableLimiter); ok {
+				config := d.Config()
+				entry.Algorithm = d.Algorithm()
+				entry.Rate = config.Rate
+				entry.Window = config.Window.String()
+				entry.Burst = config.BurstSize
+			}
+			entries = append(entries, entry)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(entries)
+	})
+}
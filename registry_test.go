@@ -0,0 +1,86 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	search, login := &quotaLimiter{limit: 1, counts: map[string]int{}}, &quotaLimiter{limit: 2, counts: map[string]int{}}
+
+	if err := r.Register("search", search); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("login", login); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("search", login); !errors.Is(err, ErrDuplicateLimiter) {
+		t.Errorf("Expected ErrDuplicateLimiter, got %v", err)
+	}
+
+	if l, ok := r.Get("search"); !ok || l != search {
+		t.Errorf("Get(search) = %v, %v", l, ok)
+	}
+	if got := r.Names(); !slices.Equal(got, []string{"login", "search"}) {
+		t.Errorf("Names = %v", got)
+	}
+
+	replacement := &quotaLimiter{limit: 3, counts: map[string]int{}}
+	if previous := r.Replace("search", replacement); previous != search {
+		t.Errorf("Replace returned %v, want the previous limiter", previous)
+	}
+	if l, _ := r.Get("search"); l != replacement {
+		t.Error("Expected the replacement to be registered")
+	}
+
+	if !r.Unregister("login") || r.Unregister("login") {
+		t.Error("Expected Unregister to report the removal once")
+	}
+	if _, ok := r.Get("login"); ok {
+		t.Error("Expected login to be unregistered")
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	limiter := &quotaLimiter{limit: 1, counts: map[string]int{}}
+	r.Register("search", limiter)
+	handler := r.Handler()
+
+	if ok, _ := limiter.Allow("acme"); !ok {
+		t.Fatal("First request should be allowed")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/?name=search&key=acme", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if ok, _ := limiter.Allow("acme"); !ok {
+		t.Error("Expected the key to be reset")
+	}
+
+	var entries []registryEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "search" {
+		t.Errorf("Unexpected listing %+v", entries)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/?name=unknown&key=acme", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown limiter, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
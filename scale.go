@@ -0,0 +1,77 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Scale is a multiplier of limits that can be changed at runtime, e.g. 0.5
+// to halve every limit during an incident or 1.5 to roll out new capacity
+// gradually, without touching any Config. Limiters following a Scale read it
+// on every check, so a change applies at once to all of them. The zero value
+// is 1.
+type Scale struct {
+	bits atomic.Uint64 // math.Float64bits of the factor, 0 for 1
+}
+
+// globalScale is the process-wide scale, see SetGlobalScale.
+var globalScale Scale
+
+// NewScale returns a scale with the given factor.
+func NewScale(factor float64) *Scale {
+	s := &Scale{}
+	s.Set(factor)
+	return s
+}
+
+// Set changes the factor. Factors that are not positive finite numbers
+// reset it to 1.
+func (s *Scale) Set(factor float64) {
+	if !(factor > 0) || math.IsInf(factor, 0) || factor == 1 {
+		s.bits.Store(0)
+		return
+	}
+	s.bits.Store(math.Float64bits(factor))
+}
+
+// Factor returns the factor. A nil Scale is 1.
+func (s *Scale) Factor() float64 {
+	if s == nil {
+		return 1
+	}
+	bits := s.bits.Load()
+	if bits == 0 {
+		return 1
+	}
+	return math.Float64frombits(bits)
+}
+
+// SetGlobalScale sets the process-wide factor applied to the limits of the
+// built-in algorithms, unless they follow another Scale:
+//
+//	ratelimiter.SetGlobalScale(0.5) // every limit is halved
+//	ratelimiter.SetGlobalScale(1)   // back to the configured limits
+//
+// Scaled limits are rounded down but never below 1 request. Factors that are
+// not positive finite numbers reset it to 1.
+func SetGlobalScale(factor float64) {
+	globalScale.Set(factor)
+}
+
+// GlobalScale returns the process-wide scale set by SetGlobalScale.
+func GlobalScale() *Scale {
+	return &globalScale
+}
+
+// ScaleLimit returns n requests scaled by factor, rounded down but never
+// below 1 for positive n.
+func ScaleLimit(n int, factor float64) int {
+	if factor == 1 || n <= 0 {
+		return n
+	}
+	scaled := float64(n) * factor
+	if scaled >= math.MaxInt {
+		return math.MaxInt
+	}
+	return max(1, int(scaled))
+}
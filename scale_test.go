@@ -0,0 +1,59 @@
+package ratelimiter
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScale_Factor(t *testing.T) {
+	var zero Scale
+	if got := zero.Factor(); got != 1 {
+		t.Errorf("zero Scale: Factor = %v, want 1", got)
+	}
+	var nilScale *Scale
+	if got := nilScale.Factor(); got != 1 {
+		t.Errorf("nil Scale: Factor = %v, want 1", got)
+	}
+
+	s := NewScale(0.5)
+	if got := s.Factor(); got != 0.5 {
+		t.Errorf("Factor = %v, want 0.5", got)
+	}
+	for _, invalid := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		s.Set(0.5)
+		s.Set(invalid)
+		if got := s.Factor(); got != 1 {
+			t.Errorf("Set(%v): Factor = %v, want 1", invalid, got)
+		}
+	}
+}
+
+func TestSetGlobalScale(t *testing.T) {
+	defer SetGlobalScale(1)
+
+	SetGlobalScale(2)
+	if got := GlobalScale().Factor(); got != 2 {
+		t.Errorf("Factor = %v, want 2", got)
+	}
+}
+
+func TestScaleLimit(t *testing.T) {
+	tests := []struct {
+		n      int
+		factor float64
+		want   int
+	}{
+		{10, 1, 10},
+		{10, 0.5, 5},
+		{10, 0.25, 2},
+		{10, 1.5, 15},
+		{10, 0.01, 1},
+		{0, 0.5, 0},
+		{math.MaxInt, 2, math.MaxInt},
+	}
+	for _, tt := range tests {
+		if got := ScaleLimit(tt.n, tt.factor); got != tt.want {
+			t.Errorf("ScaleLimit(%d, %v) = %d, want %d", tt.n, tt.factor, got, tt.want)
+		}
+	}
+}
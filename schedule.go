@@ -0,0 +1,182 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the times of scheduled refills (see Config.RefillSchedule).
+type Schedule interface {
+	// Next returns the first refill time strictly after t, or the zero time
+	// if there is none.
+	Next(t time.Time) time.Time
+}
+
+// cronSchedule is a Schedule parsed from a cron expression. Fields are
+// bitsets of the values they match.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// anyDay is true when the day of month or day of week field is "*": a
+	// day then has to match both fields, otherwise either one.
+	anyDay bool
+}
+
+// cronField describes the range of a cron expression field.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronDescriptors are the shorthands accepted by ParseCron.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSearchYears bounds the search of Next for expressions that match
+// rarely or never (e.g. February 30).
+const cronSearchYears = 5
+
+// ParseCron parses a standard five-field cron expression (minute, hour,
+// day of month, month, day of week) into a Schedule. Fields accept *, values,
+// ranges (1-5), lists (1,15) and steps (*/15, 0-30/10); day of week 0 and 7
+// are Sunday. The shorthands @hourly, @daily, @weekly, @monthly and @yearly
+// are also accepted. Times are evaluated in the location of the time passed
+// to Next.
+//
+//	schedule, err := ratelimiter.ParseCron("0 * * * *") // Top of each hour
+func ParseCron(expr string) (Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if d, ok := cronDescriptors[spec]; ok {
+		spec = d
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("%w: %q: expected 5 fields", ErrInvalidCronExpression, expr)
+	}
+
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidCronExpression, expr, err)
+		}
+		sets[i] = set
+	}
+
+	dow := sets[4]
+	if dow&(1<<7) != 0 {
+		dow = dow&^(1<<7) | 1
+	}
+	return &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    dow,
+		anyDay: strings.HasPrefix(parts[2], "*") || strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseCronField parses a comma-separated list of cron ranges.
+func parseCronField(s string, f cronField) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepStr)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseCronValue(first, f); err != nil {
+				return 0, err
+			}
+			switch {
+			case isRange:
+				if hi, err = parseCronValue(last, f); err != nil {
+					return 0, err
+				}
+				if hi < lo {
+					return 0, fmt.Errorf("%s: invalid range %q", f.name, rng)
+				}
+			case !hasStep:
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func parseCronValue(s string, f cronField) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: %q is not in [%d, %d]", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time strictly after t matching the expression.
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + cronSearchYears
+
+	for t.Year() <= limit {
+		y, mo, d := t.Date()
+		switch {
+		case c.month&(1<<uint(mo)) == 0:
+			t = time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, mo, d, t.Hour()+1, 0, 0, 0, loc)
+		default:
+			// Jump to the next matching minute of the hour, if any
+			next := c.minute >> uint(t.Minute())
+			if next == 0 {
+				t = time.Date(y, mo, d, t.Hour()+1, 0, 0, 0, loc)
+				continue
+			}
+			return t.Add(time.Duration(bits.TrailingZeros64(next)) * time.Minute)
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the day fields.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,75 @@
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	// Wednesday
+	from := time.Date(2025, 1, 1, 12, 30, 15, 0, time.UTC)
+
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 1, 12, 31, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 1, 12, 45, 0, 0, time.UTC)},
+		{"10,40 * * * *", time.Date(2025, 1, 1, 12, 40, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1", time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted
+		{"0 0 15 * 5", time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)},
+		// Never matches
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		schedule, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tc.expr, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: Next = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestParseCron_Location(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	schedule, err := ParseCron("0 0 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := schedule.Next(time.Date(2025, 1, 1, 12, 0, 0, 0, loc))
+	if want := time.Date(2025, 1, 2, 0, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Next = %v, want midnight in the location of t (%v)", got, want)
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every",
+	} {
+		if _, err := ParseCron(expr); !errors.Is(err, ErrInvalidCronExpression) {
+			t.Errorf("ParseCron(%q): expected ErrInvalidCronExpression, got %v", expr, err)
+		}
+	}
+}
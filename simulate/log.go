@@ -0,0 +1,71 @@
+package simulate
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidLog is returned by ReadLog for a malformed request log.
+var ErrInvalidLog = errors.New("ratelimiter: invalid request log")
+
+// ReadLog reads a request log in CSV, one request per line:
+//
+//	time,key[,cost]
+//
+// The time is RFC 3339 (2025-01-01T14:03:00.123Z) or Unix seconds, with an
+// optional fraction (1735740180.123). Keys containing commas must be quoted.
+// Empty lines and lines starting with '#' are skipped.
+func ReadLog(r io.Reader) ([]Request, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var requests []Request
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return requests, nil
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidLog, err)
+		}
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("%w: line %d: expected time,key[,cost]", ErrInvalidLog, line)
+		}
+
+		t, err := parseTime(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: invalid time %q", ErrInvalidLog, line, record[0])
+		}
+		req := Request{Time: t, Key: record[1]}
+		if len(record) == 3 {
+			req.Cost, err = strconv.Atoi(strings.TrimSpace(record[2]))
+			if err != nil || req.Cost < 0 {
+				return nil, fmt.Errorf("%w: line %d: invalid cost %q", ErrInvalidLog, line, record[2])
+			}
+		}
+		requests = append(requests, req)
+	}
+}
+
+// parseTime parses an RFC 3339 time or Unix seconds.
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || secs < 0 || math.IsInf(secs, 0) || math.IsNaN(secs) {
+		return time.Time{}, ErrInvalidLog
+	}
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(math.Round(frac*1e6))*1e3), nil
+}
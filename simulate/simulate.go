@@ -0,0 +1,185 @@
+// Package simulate replays recorded traffic against a candidate rate limit
+// to report how many requests it would have limited, per key and per minute,
+// so limits can be chosen from real traffic before they are enforced.
+//
+// Requests are replayed on a virtual clock set to their timestamps, so a day
+// of traffic replays in seconds and the results are deterministic:
+//
+//	requests, _ := simulate.ReadLog(logFile)
+//	report, _ := simulate.Run(requests, simulate.Candidate{
+//		Config:    ratelimiter.Config{Rate: 100, Window: time.Minute},
+//		Algorithm: algorithms.SlidingWindowName,
+//	})
+//	fmt.Printf("%d of %d requests limited\n", report.Limited, report.Total)
+package simulate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// ErrUnknownAlgorithm is returned by Run for an unknown candidate algorithm.
+var ErrUnknownAlgorithm = errors.New("ratelimiter: unknown algorithm")
+
+// Request is a recorded request.
+type Request struct {
+	Time time.Time
+	Key  string
+
+	// Cost is the number of requests it counts for. Default: 1
+	Cost int
+}
+
+// Candidate is a rate limit to evaluate.
+type Candidate struct {
+	// Config is the limit.
+	Config ratelimiter.Config
+
+	// Algorithm is algorithms.TokenBucketName, algorithms.SlidingWindowName
+	// or algorithms.CountMinName. Default: algorithms.TokenBucketName
+	Algorithm string
+
+	// New, when set, creates the limiter instead of Config and Algorithm,
+	// e.g. to evaluate a wrapped limiter. It must use now as its clock and
+	// should keep its state in s.
+	New func(s store.Store, now func() time.Time) (ratelimiter.Limiter, error)
+}
+
+// Report is the outcome of a simulation.
+type Report struct {
+	Total   int `json:"total"`
+	Limited int `json:"limited"`
+	Errors  int `json:"errors"` // Requests the limiter failed to check
+
+	Keys    map[string]*Stats `json:"keys"`
+	Minutes []MinuteStats     `json:"minutes"` // Minutes with requests, in order
+}
+
+// Stats counts the requests of a key.
+type Stats struct {
+	Total   int `json:"total"`
+	Limited int `json:"limited"`
+}
+
+// MinuteStats counts the requests of a minute.
+type MinuteStats struct {
+	Start time.Time `json:"start"`
+	Stats
+}
+
+// KeyStats are the stats of a key.
+type KeyStats struct {
+	Key string `json:"key"`
+	Stats
+}
+
+// LimitedRate returns the fraction of requests that were limited.
+func (r *Report) LimitedRate() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(r.Limited) / float64(r.Total)
+}
+
+// TopLimited returns the n keys with the most limited requests, most limited
+// first. Keys never limited are omitted.
+func (r *Report) TopLimited(n int) []KeyStats {
+	var keys []KeyStats
+	for key, stats := range r.Keys {
+		if stats.Limited > 0 {
+			keys = append(keys, KeyStats{Key: key, Stats: *stats})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Limited != keys[j].Limited {
+			return keys[i].Limited > keys[j].Limited
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// Run replays requests against a candidate limit. Requests are replayed in
+// time order; requests is not modified.
+func Run(requests []Request, candidate Candidate) (*Report, error) {
+	// The cleanup routine runs on the wall clock and would drop the state
+	// of past requests: keep it from running during the replay.
+	s := store.NewMemoryStoreWithConfig(store.MemoryStoreConfig{
+		CleanupInterval: 24 * time.Hour,
+		MaxEntries:      math.MaxInt,
+	})
+	defer s.Close()
+
+	var now time.Time
+	clock := func() time.Time { return now }
+	limiter, err := newLimiter(candidate, s, clock)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]Request, len(requests))
+	copy(sorted, requests)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	report := &Report{Keys: make(map[string]*Stats)}
+	for _, req := range sorted {
+		now = req.Time
+		cost := req.Cost
+		if cost <= 0 {
+			cost = 1
+		}
+
+		allowed, err := limiter.AllowN(req.Key, cost)
+		if err != nil && !errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+			report.Errors++
+			continue
+		}
+
+		key := report.Keys[req.Key]
+		if key == nil {
+			key = &Stats{}
+			report.Keys[req.Key] = key
+		}
+		minute := req.Time.Truncate(time.Minute)
+		if n := len(report.Minutes); n == 0 || !report.Minutes[n-1].Start.Equal(minute) {
+			report.Minutes = append(report.Minutes, MinuteStats{Start: minute})
+		}
+		m := &report.Minutes[len(report.Minutes)-1]
+
+		report.Total++
+		key.Total++
+		m.Total++
+		if !allowed {
+			report.Limited++
+			key.Limited++
+			m.Limited++
+		}
+	}
+	return report, nil
+}
+
+// newLimiter creates the limiter of a candidate on the virtual clock.
+func newLimiter(c Candidate, s store.Store, now func() time.Time) (ratelimiter.Limiter, error) {
+	if c.New != nil {
+		return c.New(s, now)
+	}
+	switch c.Algorithm {
+	case "", algorithms.TokenBucketName:
+		return algorithms.NewTokenBucket(c.Config, s, algorithms.WithClock(now))
+	case algorithms.SlidingWindowName:
+		return algorithms.NewSlidingWindow(c.Config, s, algorithms.WithClock(now))
+	case algorithms.CountMinName:
+		return algorithms.NewCountMin(c.Config, algorithms.WithClock(now))
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownAlgorithm, c.Algorithm)
+}
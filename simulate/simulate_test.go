@@ -0,0 +1,135 @@
+package simulate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// burst returns n requests of key spread evenly over d from start.
+func burst(key string, start time.Time, n int, d time.Duration) []Request {
+	requests := make([]Request, n)
+	for i := range requests {
+		requests[i] = Request{Time: start.Add(d * time.Duration(i) / time.Duration(n)), Key: key}
+	}
+	return requests
+}
+
+func TestRun(t *testing.T) {
+	start := time.Date(2025, 1, 1, 14, 0, 0, 0, time.UTC)
+	var requests []Request
+	requests = append(requests, burst("heavy", start, 30, time.Minute)...)
+	requests = append(requests, burst("light", start, 5, 2*time.Minute)...)
+
+	for _, algorithm := range []string{algorithms.TokenBucketName, algorithms.SlidingWindowName, algorithms.CountMinName} {
+		t.Run(algorithm, func(t *testing.T) {
+			report, err := Run(requests, Candidate{
+				Config:    ratelimiter.Config{Rate: 10, Window: time.Minute},
+				Algorithm: algorithm,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Total != 35 {
+				t.Errorf("Total = %d, want 35", report.Total)
+			}
+			if report.Keys["light"].Limited != 0 {
+				t.Errorf("light key limited %d times, want 0", report.Keys["light"].Limited)
+			}
+			// A few requests refill within the minute, depending on the algorithm.
+			if got := report.Keys["heavy"].Limited; got < 10 || got > 20 {
+				t.Errorf("heavy key limited %d times, want 10 to 20", got)
+			}
+			if report.Limited != report.Keys["heavy"].Limited {
+				t.Errorf("Limited = %d, want %d", report.Limited, report.Keys["heavy"].Limited)
+			}
+			if len(report.Minutes) != 2 || !report.Minutes[0].Start.Equal(start) {
+				t.Fatalf("unexpected minutes %+v", report.Minutes)
+			}
+			if report.Minutes[0].Total != 33 || report.Minutes[1].Limited != 0 {
+				t.Errorf("unexpected minutes %+v", report.Minutes)
+			}
+			if top := report.TopLimited(5); len(top) != 1 || top[0].Key != "heavy" {
+				t.Errorf("TopLimited = %+v", top)
+			}
+		})
+	}
+}
+
+func TestRun_Unsorted(t *testing.T) {
+	start := time.Date(2025, 1, 1, 14, 0, 0, 0, time.UTC)
+	requests := []Request{
+		{Time: start.Add(2 * time.Minute), Key: "k"},
+		{Time: start, Key: "k"},
+		{Time: start.Add(time.Second), Key: "k"},
+	}
+	report, err := Run(requests, Candidate{Config: ratelimiter.Config{Rate: 1, Window: time.Minute, BurstSize: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Limited != 1 {
+		t.Errorf("Limited = %d, want 1", report.Limited)
+	}
+	if !requests[0].Time.Equal(start.Add(2 * time.Minute)) {
+		t.Error("Run should not reorder the caller's requests")
+	}
+}
+
+func TestRun_Custom(t *testing.T) {
+	start := time.Date(2025, 1, 1, 14, 0, 0, 0, time.UTC)
+	report, err := Run(burst("k", start, 10, time.Second), Candidate{
+		New: func(s store.Store, now func() time.Time) (ratelimiter.Limiter, error) {
+			return algorithms.NewTokenBucket(ratelimiter.Config{Rate: 4, Window: time.Minute, BurstSize: 4}, s, algorithms.WithClock(now))
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Limited != 6 {
+		t.Errorf("Limited = %d, want 6", report.Limited)
+	}
+}
+
+func TestRun_UnknownAlgorithm(t *testing.T) {
+	_, err := Run(nil, Candidate{Config: ratelimiter.Config{Rate: 1, Window: time.Minute}, Algorithm: "leaky_bucket"})
+	if !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("err = %v, want ErrUnknownAlgorithm", err)
+	}
+}
+
+func TestReadLog(t *testing.T) {
+	requests, err := ReadLog(strings.NewReader(`# time,key,cost
+2025-01-01T14:03:00.5Z,192.0.2.1
+1735740180.25, "key,with,commas", 3
+
+1735740181,api-key-1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("read %d requests, want 3", len(requests))
+	}
+	if want := time.Date(2025, 1, 1, 14, 3, 0, 5e8, time.UTC); !requests[0].Time.Equal(want) || requests[0].Key != "192.0.2.1" {
+		t.Errorf("request 0 = %+v", requests[0])
+	}
+	if want := time.Unix(1735740180, 25e7); !requests[1].Time.Equal(want) || requests[1].Key != "key,with,commas" || requests[1].Cost != 3 {
+		t.Errorf("request 1 = %+v", requests[1])
+	}
+
+	for _, log := range []string{
+		"yesterday,k\n",
+		"1735740180\n",
+		"1735740180,k,-1\n",
+		"1735740180,k,1,extra\n",
+	} {
+		if _, err := ReadLog(strings.NewReader(log)); !errors.Is(err, ErrInvalidLog) {
+			t.Errorf("%q: err = %v, want ErrInvalidLog", log, err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func BenchmarkMemoryStore_ConcurrentGet(b *testing.B) {
@@ -50,3 +51,77 @@ func BenchmarkMemoryStore_ConcurrentSet(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkMemoryStore_Shards(b *testing.B) {
+	numKeys := 1000
+	keys := make([]string, numKeys)
+	for i := 0; i < numKeys; i++ {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+
+	for _, shards := range []int{1, 16, 256, 4096} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			s := NewMemoryStoreWithConfig(MemoryStoreConfig{Shards: shards})
+			defer s.Close()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%numKeys]
+					s.Set(key, i, 0)
+					i++
+				}
+			})
+			b.ReportMetric(float64(s.ContentionStats().Contended)/float64(b.N), "contended/op")
+		})
+	}
+}
+
+// BenchmarkMemoryStore_Cleanup measures a cleanup pass over a large store in
+// which few entries have expired; its cost should follow the expired count.
+func BenchmarkMemoryStore_Cleanup(b *testing.B) {
+	const live, expired = 200_000, 1000
+
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{CleanupInterval: time.Hour, MaxEntries: 2 * live})
+	defer s.Close()
+	for i := 0; i < live; i++ {
+		s.Set(fmt.Sprintf("live-%d", i), i, 2*time.Hour)
+	}
+	past := time.Now().Add(-3 * time.Hour)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := 0; j < expired; j++ {
+			s.SetAt(fmt.Sprintf("expired-%d", j), j, time.Minute, past)
+		}
+		b.StartTimer()
+
+		s.cleanup()
+	}
+}
+
+// BenchmarkMemoryStore_ValueSet stores a struct by value, which MemoryStore
+// boxes into an interface{} and TypedMemoryStore does not.
+func BenchmarkMemoryStore_ValueSet(b *testing.B) {
+	now := time.Now()
+
+	b.Run("MemoryStore", func(b *testing.B) {
+		s := NewMemoryStore()
+		defer s.Close()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.SetWithNamespaceAt("tb", "key", counters{Count: i}, time.Minute, now)
+		}
+	})
+
+	b.Run("TypedMemoryStore", func(b *testing.B) {
+		s := NewTypedMemoryStore[counters](DefaultMemoryStoreConfig())
+		defer s.Close()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.Set("tb", "key", counters{Count: i}, time.Minute, now)
+		}
+	})
+}
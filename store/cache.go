@@ -0,0 +1,128 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// CacheConfig holds configuration for CachingStore.
+type CacheConfig struct {
+	// TTL is how long a value read from or written to the store is served
+	// from the cache. Default: 100ms.
+	TTL time.Duration
+
+	// MaxEntries bounds the number of cached keys. When it is reached, the
+	// cache is cleared. Default: 10000.
+	MaxEntries int
+
+	// Now returns the current time, e.g. a fake clock in tests.
+	// Default: time.Now.
+	Now func() time.Time
+}
+
+// cacheEntry is a cached value.
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// CachingStore serves reads of a (typically remote) Store from a local cache
+// for a short TTL, to save round trips for read-heavy keys. Writes go
+// through to the store and update the cache, deletes invalidate it.
+//
+// Cached values are not refreshed by writes of other instances sharing the
+// store: each instance may admit up to the requests counted elsewhere during
+// TTL. Keep TTL short compared to the windows of the limits.
+type CachingStore struct {
+	decorated
+	config CacheConfig
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewCachingStore wraps s with a read cache.
+func NewCachingStore(s Store, config CacheConfig) *CachingStore {
+	if config.TTL <= 0 {
+		config.TTL = 100 * time.Millisecond
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 10000
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &CachingStore{
+		decorated: decorated{s},
+		config:    config,
+		entries:   make(map[string]cacheEntry),
+	}
+}
+
+// WithCache returns a Decorator wrapping stores in a CachingStore.
+func WithCache(config CacheConfig) Decorator {
+	return func(s Store) Store {
+		return NewCachingStore(s, config)
+	}
+}
+
+// Get retrieves a value from the cache, or from the store on a miss.
+// Missing keys are not cached.
+func (c *CachingStore) Get(key string) (interface{}, bool) {
+	now := c.config.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.value, true
+	}
+
+	val, ok := c.Store.Get(key)
+	if ok {
+		c.put(key, val, now)
+	} else {
+		c.invalidate(key)
+	}
+	return val, ok
+}
+
+// Set stores a value in the store and, if it succeeds, in the cache.
+func (c *CachingStore) Set(key string, value interface{}, ttl time.Duration) error {
+	if err := c.Store.Set(key, value, ttl); err != nil {
+		c.invalidate(key)
+		return err
+	}
+	c.put(key, value, c.config.Now())
+	return nil
+}
+
+// Delete removes a value from the store and the cache.
+func (c *CachingStore) Delete(key string) error {
+	c.invalidate(key)
+	return c.Store.Delete(key)
+}
+
+// Close clears the cache and closes the store.
+func (c *CachingStore) Close() error {
+	c.mu.Lock()
+	clear(c.entries)
+	c.mu.Unlock()
+	return c.Store.Close()
+}
+
+// put caches value for key.
+func (c *CachingStore) put(key string, value interface{}, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.config.MaxEntries {
+		clear(c.entries)
+	}
+	c.entries[key] = cacheEntry{value: value, expiresAt: now.Add(c.config.TTL)}
+}
+
+// invalidate removes key from the cache.
+func (c *CachingStore) invalidate(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
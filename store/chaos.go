@@ -0,0 +1,80 @@
+package store
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrChaos is the error injected by ChaosStore unless ChaosConfig.Err is set.
+var ErrChaos = errors.New("ratelimiter: injected store failure")
+
+// ChaosConfig holds configuration for ChaosStore.
+type ChaosConfig struct {
+	// FailureRate is the fraction of calls that fail, between 0 and 1:
+	// Set and Delete return Err and Get reports a miss, without reaching
+	// the store.
+	FailureRate float64
+
+	// Latency is added to every call, e.g. to test timeouts.
+	// Default: 0.
+	Latency time.Duration
+
+	// Err is the error returned by failed calls. Default: ErrChaos.
+	Err error
+}
+
+// ChaosStore injects failures and latency into the calls of a Store, for
+// resilience testing: checking that fail-open or fail-closed modes, circuit
+// breakers and fallbacks behave as intended when the backend misbehaves.
+type ChaosStore struct {
+	decorated
+	config ChaosConfig
+}
+
+// NewChaosStore wraps s to inject failures.
+func NewChaosStore(s Store, config ChaosConfig) *ChaosStore {
+	if config.Err == nil {
+		config.Err = ErrChaos
+	}
+	return &ChaosStore{decorated: decorated{s}, config: config}
+}
+
+// WithChaos returns a Decorator wrapping stores in a ChaosStore.
+func WithChaos(config ChaosConfig) Decorator {
+	return func(s Store) Store {
+		return NewChaosStore(s, config)
+	}
+}
+
+// Get retrieves a value from the store, or reports a miss if the call fails.
+func (c *ChaosStore) Get(key string) (interface{}, bool) {
+	if c.fail() {
+		return nil, false
+	}
+	return c.Store.Get(key)
+}
+
+// Set stores a value with an optional TTL, or fails.
+func (c *ChaosStore) Set(key string, value interface{}, ttl time.Duration) error {
+	if c.fail() {
+		return c.config.Err
+	}
+	return c.Store.Set(key, value, ttl)
+}
+
+// Delete removes a value from the store, or fails.
+func (c *ChaosStore) Delete(key string) error {
+	if c.fail() {
+		return c.config.Err
+	}
+	return c.Store.Delete(key)
+}
+
+// fail waits for the injected latency and reports whether the call fails.
+func (c *ChaosStore) fail() bool {
+	if c.config.Latency > 0 {
+		time.Sleep(c.config.Latency)
+	}
+	return c.config.FailureRate > 0 && rand.Float64() < c.config.FailureRate
+}
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreakerStore while the circuit is open.
+var ErrCircuitOpen = errors.New("ratelimiter: store circuit breaker open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int32
+
+const (
+	// CircuitClosed lets all calls through to the store.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects all calls without reaching the store.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a limited number of trial calls through.
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerConfig holds configuration for CircuitBreakerStore.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit.
+	// Default is 5.
+	FailureThreshold int
+	// SlowCallThreshold counts calls slower than this as failures, so that a
+	// store that times out (and reports misses) also opens the circuit.
+	// Default is 0 (latency is ignored).
+	SlowCallThreshold time.Duration
+	// OpenTimeout is how long the circuit stays open before trial calls.
+	// Default is 5 seconds.
+	OpenTimeout time.Duration
+	// HalfOpenMaxCalls is the number of concurrent trial calls in half-open state.
+	// Default is 1.
+	HalfOpenMaxCalls int
+	// OnStateChange is called on every state transition. It must not block.
+	OnStateChange func(from, to CircuitState)
+}
+
+// CircuitBreakerStats holds circuit breaker counters.
+type CircuitBreakerStats struct {
+	State    CircuitState
+	Failures uint64 // Failed or slow calls
+	Rejected uint64 // Calls rejected while open
+	Opened   uint64 // Number of times the circuit opened
+}
+
+// CircuitBreakerStore wraps a (typically remote) Store with a circuit
+// breaker. Once the store fails FailureThreshold times in a row, calls are
+// short-circuited for OpenTimeout: Get reports a miss and Set and Delete
+// return ErrCircuitOpen immediately, so requests stop paying the latency of a
+// failing backend and the caller's failure mode (e.g. middleware fail-open or
+// a FallbackLimiter) applies right away.
+//
+// Get failures are only visible through SlowCallThreshold, since Get does not
+// return errors.
+type CircuitBreakerStore struct {
+	store  Store
+	config CircuitBreakerConfig
+
+	state       atomic.Int32
+	consecutive atomic.Int64
+	openedAt    atomic.Int64 // Unix nanoseconds
+	trials      atomic.Int64 // In-flight calls in half-open state
+
+	failures atomic.Uint64
+	rejected atomic.Uint64
+	opened   atomic.Uint64
+
+	mu sync.Mutex // Serializes state transitions
+}
+
+// NewCircuitBreakerStore wraps s with a circuit breaker.
+func NewCircuitBreakerStore(s Store, config CircuitBreakerConfig) *CircuitBreakerStore {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 5 * time.Second
+	}
+	if config.HalfOpenMaxCalls <= 0 {
+		config.HalfOpenMaxCalls = 1
+	}
+
+	return &CircuitBreakerStore{store: s, config: config}
+}
+
+// Get retrieves a value from the store. It reports a miss while the circuit is open.
+func (c *CircuitBreakerStore) Get(key string) (interface{}, bool) {
+	trial, ok := c.acquire()
+	if !ok {
+		return nil, false
+	}
+
+	start := time.Now()
+	val, found := c.store.Get(key)
+	c.record(trial, nil, time.Since(start))
+	return val, found
+}
+
+// Set stores a value with an optional TTL.
+func (c *CircuitBreakerStore) Set(key string, value interface{}, ttl time.Duration) error {
+	return c.call(func() error {
+		return c.store.Set(key, value, ttl)
+	})
+}
+
+// Delete removes a value from the store.
+func (c *CircuitBreakerStore) Delete(key string) error {
+	return c.call(func() error {
+		return c.store.Delete(key)
+	})
+}
+
+// Close closes the underlying store.
+func (c *CircuitBreakerStore) Close() error {
+	return c.store.Close()
+}
+
+// Ping checks the underlying store, bypassing the circuit breaker.
+func (c *CircuitBreakerStore) Ping(ctx context.Context) error {
+	return Ping(ctx, c.store)
+}
+
+// State returns the current circuit state.
+func (c *CircuitBreakerStore) State() CircuitState {
+	return CircuitState(c.state.Load())
+}
+
+// Stats returns the circuit breaker counters.
+func (c *CircuitBreakerStore) Stats() CircuitBreakerStats {
+	return CircuitBreakerStats{
+		State:    c.State(),
+		Failures: c.failures.Load(),
+		Rejected: c.rejected.Load(),
+		Opened:   c.opened.Load(),
+	}
+}
+
+// call runs fn through the circuit breaker.
+func (c *CircuitBreakerStore) call(fn func() error) error {
+	trial, ok := c.acquire()
+	if !ok {
+		return ErrCircuitOpen
+	}
+
+	start := time.Now()
+	err := fn()
+	c.record(trial, err, time.Since(start))
+	return err
+}
+
+// acquire reports whether a call may proceed and whether it is a half-open trial.
+func (c *CircuitBreakerStore) acquire() (trial bool, ok bool) {
+	switch CircuitState(c.state.Load()) {
+	case CircuitClosed:
+		return false, true
+	case CircuitOpen:
+		if time.Since(time.Unix(0, c.openedAt.Load())) < c.config.OpenTimeout {
+			c.rejected.Add(1)
+			return false, false
+		}
+		c.transition(CircuitOpen, CircuitHalfOpen)
+	}
+
+	// Half-open: let a bounded number of trial calls through
+	if c.trials.Add(1) > int64(c.config.HalfOpenMaxCalls) {
+		c.trials.Add(-1)
+		c.rejected.Add(1)
+		return false, false
+	}
+	return true, true
+}
+
+// record updates the breaker with the outcome of a call.
+func (c *CircuitBreakerStore) record(trial bool, err error, elapsed time.Duration) {
+	if trial {
+		defer c.trials.Add(-1)
+	}
+
+	failed := err != nil || (c.config.SlowCallThreshold > 0 && elapsed > c.config.SlowCallThreshold)
+	if !failed {
+		if c.consecutive.Load() != 0 {
+			c.consecutive.Store(0)
+		}
+		if trial {
+			c.transition(CircuitHalfOpen, CircuitClosed)
+		}
+		return
+	}
+
+	c.failures.Add(1)
+	if trial {
+		c.transition(CircuitHalfOpen, CircuitOpen)
+		return
+	}
+	if c.consecutive.Add(1) >= int64(c.config.FailureThreshold) {
+		c.transition(CircuitClosed, CircuitOpen)
+	}
+}
+
+// transition moves the breaker from one state to another if it is still in from.
+func (c *CircuitBreakerStore) transition(from, to CircuitState) {
+	c.mu.Lock()
+	if CircuitState(c.state.Load()) != from {
+		c.mu.Unlock()
+		return
+	}
+	if to == CircuitOpen {
+		c.openedAt.Store(time.Now().UnixNano())
+		c.opened.Add(1)
+	}
+	c.consecutive.Store(0)
+	c.state.Store(int32(to))
+	c.mu.Unlock()
+
+	if c.config.OnStateChange != nil {
+		c.config.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingStore is a Store whose Set fails while err is set.
+type failingStore struct {
+	mu    sync.Mutex
+	err   error
+	delay time.Duration
+	calls int
+}
+
+func (f *failingStore) Get(key string) (interface{}, bool) {
+	f.mu.Lock()
+	f.calls++
+	delay := f.delay
+	f.mu.Unlock()
+	time.Sleep(delay)
+	return nil, false
+}
+
+func (f *failingStore) Set(key string, value interface{}, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return f.err
+}
+
+func (f *failingStore) Delete(key string) error { return nil }
+func (f *failingStore) Close() error            { return nil }
+
+func TestCircuitBreakerStore(t *testing.T) {
+	backend := &failingStore{err: errors.New("timeout")}
+
+	var transitions []string
+	cb := NewCircuitBreakerStore(backend, CircuitBreakerConfig{
+		FailureThreshold: 3,
+		OpenTimeout:      20 * time.Millisecond,
+		OnStateChange: func(from, to CircuitState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := cb.Set("key", 1, 0); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Call %d: expected backend error, got %v", i+1, err)
+		}
+	}
+	if cb.State() != CircuitOpen {
+		t.Fatalf("Expected open circuit, got %v", cb.State())
+	}
+
+	// Open: calls are short-circuited
+	if err := cb.Set("key", 1, 0); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if _, ok := cb.Get("key"); ok {
+		t.Error("Expected miss while open")
+	}
+	if backend.calls != 3 {
+		t.Errorf("Expected the backend not to be called while open, got %d calls", backend.calls)
+	}
+
+	// Half-open trial fails: open again
+	time.Sleep(25 * time.Millisecond)
+	if err := cb.Set("key", 1, 0); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected trial call to reach the backend, got %v", err)
+	}
+	if cb.State() != CircuitOpen {
+		t.Errorf("Expected circuit to reopen after failed trial, got %v", cb.State())
+	}
+
+	// Half-open trial succeeds: closed
+	backend.mu.Lock()
+	backend.err = nil
+	backend.mu.Unlock()
+	time.Sleep(25 * time.Millisecond)
+	if err := cb.Set("key", 1, 0); err != nil {
+		t.Errorf("Expected trial call to succeed, got %v", err)
+	}
+	if cb.State() != CircuitClosed {
+		t.Errorf("Expected closed circuit, got %v", cb.State())
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("Expected transitions %v, got %v", want, transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("Transition %d: expected %s, got %s", i, want[i], transitions[i])
+		}
+	}
+
+	stats := cb.Stats()
+	if stats.Opened != 2 || stats.Failures != 4 || stats.Rejected != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCircuitBreakerStore_SlowCalls(t *testing.T) {
+	backend := &failingStore{delay: 5 * time.Millisecond}
+	cb := NewCircuitBreakerStore(backend, CircuitBreakerConfig{
+		FailureThreshold:  2,
+		SlowCallThreshold: time.Millisecond,
+	})
+
+	cb.Get("a")
+	cb.Get("b")
+	if cb.State() != CircuitOpen {
+		t.Errorf("Expected slow Gets to open the circuit, got %v", cb.State())
+	}
+}
+
+func TestCircuitBreakerStore_SuccessResetsFailures(t *testing.T) {
+	backend := &failingStore{err: errors.New("timeout")}
+	cb := NewCircuitBreakerStore(backend, CircuitBreakerConfig{FailureThreshold: 2})
+
+	cb.Set("key", 1, 0)
+	cb.Get("key")
+	cb.Set("key", 1, 0)
+	if cb.State() != CircuitClosed {
+		t.Errorf("Expected non-consecutive failures to keep the circuit closed, got %v", cb.State())
+	}
+}
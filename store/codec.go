@@ -0,0 +1,517 @@
+package store
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// ErrInvalidEncoding is returned when a codec cannot decode its input.
+var ErrInvalidEncoding = errors.New("ratelimiter: invalid encoding")
+
+// Codec converts limiter state to and from bytes for remote stores.
+//
+// Marshal is called with the value passed to Store.Set. Unmarshal is called
+// with the stored bytes and returns the value to hand back from Store.Get.
+// The algorithms accept the versioned binary and JSON state encodings, so
+// codecs that use another wire format translate back to one of those.
+type Codec interface {
+	// Name returns a short identifier for the codec (e.g. "json").
+	Name() string
+
+	// Marshal encodes a limiter state value.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes data into a value the algorithms understand.
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// Built-in codecs.
+var (
+	// BinaryCodec uses the compact versioned binary state encoding.
+	BinaryCodec Codec = binaryCodec{}
+
+	// JSONCodec uses the versioned JSON state encoding. It is the easiest to
+	// inspect and to consume from other languages.
+	JSONCodec Codec = jsonCodec{}
+
+	// MsgpackCodec encodes the JSON state fields as a MessagePack map.
+	MsgpackCodec Codec = msgpackCodec{}
+
+	// ProtobufCodec encodes the JSON state fields as a LimiterState protobuf
+	// message. Its fields 1 (uint32 v) and 2 (string type) are the version
+	// and type of the state; the other fields are registered by the
+	// algorithms with RegisterProtobufFields, which document the message.
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string { return "binary" }
+
+func (binaryCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("ratelimiter: %T does not implement encoding.BinaryMarshaler", v)
+	}
+	return m.MarshalBinary()
+}
+
+func (binaryCodec) Unmarshal(data []byte) (interface{}, error) {
+	return data, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (interface{}, error) {
+	return data, nil
+}
+
+// stateFields returns the JSON fields of a limiter state value.
+func stateFields(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	fields, err := stateFields(v)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := msgpackAppendMapHeader(nil, len(names))
+	for _, name := range names {
+		b = msgpackAppendString(b, name)
+		switch val := fields[name].(type) {
+		case json.Number:
+			if i, err := val.Int64(); err == nil {
+				b = msgpackAppendInt(b, i)
+			} else if f, err := val.Float64(); err == nil {
+				b = msgpackAppendFloat(b, f)
+			} else {
+				return nil, err
+			}
+		case string:
+			b = msgpackAppendString(b, val)
+		case bool:
+			if val {
+				b = append(b, 0xc3)
+			} else {
+				b = append(b, 0xc2)
+			}
+		case nil:
+			b = append(b, 0xc0)
+		default:
+			return nil, fmt.Errorf("ratelimiter: unsupported msgpack field %q of type %T", name, val)
+		}
+	}
+	return b, nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte) (interface{}, error) {
+	r := msgpackReader{b: data}
+	n, err := r.mapHeader()
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, ErrInvalidEncoding
+		}
+		val, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = val
+	}
+	if len(r.b) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return json.Marshal(fields)
+}
+
+func msgpackAppendMapHeader(b []byte, n int) []byte {
+	if n < 16 {
+		return append(b, 0x80|byte(n))
+	}
+	return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+}
+
+func msgpackAppendString(b []byte, s string) []byte {
+	switch {
+	case len(s) < 32:
+		b = append(b, 0xa0|byte(len(s)))
+	case len(s) <= math.MaxUint8:
+		b = append(b, 0xd9, byte(len(s)))
+	case len(s) <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(len(s)))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(len(s)))
+	}
+	return append(b, s...)
+}
+
+func msgpackAppendInt(b []byte, i int64) []byte {
+	if i >= 0 && i < 128 {
+		return append(b, byte(i))
+	}
+	if i < 0 && i >= -32 {
+		return append(b, byte(i))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+}
+
+func msgpackAppendFloat(b []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f))
+}
+
+// msgpackReader decodes the subset of MessagePack produced by flat state maps.
+type msgpackReader struct {
+	b []byte
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if len(r.b) < n {
+		return nil, ErrInvalidEncoding
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p, nil
+}
+
+func (r *msgpackReader) mapHeader() (int, error) {
+	p, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	switch c := p[0]; {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), nil
+	case c == 0xde:
+		p, err := r.next(2)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint16(p)), nil
+	}
+	return 0, ErrInvalidEncoding
+}
+
+func (r *msgpackReader) str(n int) (interface{}, error) {
+	p, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(p), nil
+}
+
+func (r *msgpackReader) uint(size int) (uint64, error) {
+	p, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(p[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(p)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(p)), nil
+	}
+	return binary.BigEndian.Uint64(p), nil
+}
+
+func (r *msgpackReader) value() (interface{}, error) {
+	p, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := p[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return r.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		u, err := r.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := r.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := r.uint(1 << (c - 0xcc))
+		return u, err
+	case 0xd0:
+		u, err := r.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := r.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := r.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := r.uint(8)
+		return int64(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return r.str(int(n))
+	}
+	return nil, ErrInvalidEncoding
+}
+
+type protobufCodec struct{}
+
+// ProtobufKind is the protobuf type of a LimiterState message field.
+type ProtobufKind byte
+
+// Protobuf field types.
+const (
+	ProtobufUint32 ProtobufKind = iota + 1
+	ProtobufString
+	ProtobufDouble
+	ProtobufSint64 // Zigzag encoded, e.g. Unix nanoseconds
+)
+
+// ProtobufField maps a field of the JSON state encoding to a field of the
+// LimiterState message of ProtobufCodec.
+type ProtobufField struct {
+	Name   string // Name of the JSON field
+	Number uint64
+	Kind   ProtobufKind
+}
+
+var (
+	protobufMu     sync.RWMutex
+	protobufByName = map[string]ProtobufField{
+		"v":    {"v", 1, ProtobufUint32},
+		"type": {"type", 2, ProtobufString},
+	}
+	protobufByNumber = map[uint64]ProtobufField{
+		1: protobufByName["v"],
+		2: protobufByName["type"],
+	}
+)
+
+// RegisterProtobufFields adds fields of limiter states to the LimiterState
+// message of ProtobufCodec. Registering a field again is a no-op; it panics
+// if a field name or number is already registered differently, as the
+// encoded states would not be decodable.
+func RegisterProtobufFields(fields ...ProtobufField) {
+	protobufMu.Lock()
+	defer protobufMu.Unlock()
+
+	for _, f := range fields {
+		if f.Name == "" || f.Number == 0 || f.Kind < ProtobufUint32 || f.Kind > ProtobufSint64 {
+			panic(fmt.Sprintf("ratelimiter: invalid protobuf field %+v", f))
+		}
+		byName, nameOK := protobufByName[f.Name]
+		byNumber, numberOK := protobufByNumber[f.Number]
+		if (nameOK && byName != f) || (numberOK && byNumber != f) {
+			panic(fmt.Sprintf("ratelimiter: protobuf field %+v conflicts with a registered field", f))
+		}
+		protobufByName[f.Name] = f
+		protobufByNumber[f.Number] = f
+	}
+}
+
+// Protobuf wire types.
+const (
+	protobufVarint  = 0
+	protobufFixed64 = 1
+	protobufBytes   = 2
+	protobufFixed32 = 5
+)
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	fields, err := stateFields(v)
+	if err != nil {
+		return nil, err
+	}
+
+	protobufMu.RLock()
+	message := make([]ProtobufField, 0, len(fields))
+	for name := range fields {
+		f, ok := protobufByName[name]
+		if !ok {
+			protobufMu.RUnlock()
+			return nil, fmt.Errorf("ratelimiter: no protobuf field for %q", name)
+		}
+		message = append(message, f)
+	}
+	protobufMu.RUnlock()
+	sort.Slice(message, func(i, j int) bool { return message[i].Number < message[j].Number })
+
+	var b []byte
+	for _, f := range message {
+		val := fields[f.Name]
+		if f.Kind == ProtobufString {
+			s, ok := val.(string)
+			if !ok {
+				return nil, fmt.Errorf("ratelimiter: protobuf field %q must be a string", f.Name)
+			}
+			if s == "" {
+				continue
+			}
+			b = binary.AppendUvarint(b, f.Number<<3|protobufBytes)
+			b = binary.AppendUvarint(b, uint64(len(s)))
+			b = append(b, s...)
+			continue
+		}
+
+		num, ok := val.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("ratelimiter: protobuf field %q must be a number", f.Name)
+		}
+		switch f.Kind {
+		case ProtobufDouble:
+			d, err := num.Float64()
+			if err != nil {
+				return nil, err
+			}
+			if d == 0 {
+				continue
+			}
+			b = binary.AppendUvarint(b, f.Number<<3|protobufFixed64)
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(d))
+		default:
+			i, err := num.Int64()
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				continue
+			}
+			b = binary.AppendUvarint(b, f.Number<<3|protobufVarint)
+			if f.Kind == ProtobufSint64 {
+				b = binary.AppendUvarint(b, uint64(i<<1)^uint64(i>>63))
+			} else {
+				b = binary.AppendUvarint(b, uint64(i))
+			}
+		}
+	}
+	return b, nil
+}
+
+func (protobufCodec) Unmarshal(data []byte) (interface{}, error) {
+	fields := make(map[string]interface{})
+	// Proto3 omits zero values, but the algorithms require v and type
+	fields["v"] = 0
+	fields["type"] = ""
+
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, ErrInvalidEncoding
+		}
+		data = data[n:]
+		num, wire := tag>>3, tag&7
+
+		protobufMu.RLock()
+		field, known := protobufByNumber[num]
+		protobufMu.RUnlock()
+
+		var raw uint64
+		var payload []byte
+		switch wire {
+		case protobufVarint:
+			raw, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, ErrInvalidEncoding
+			}
+			data = data[n:]
+		case protobufFixed64:
+			if len(data) < 8 {
+				return nil, ErrInvalidEncoding
+			}
+			raw = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protobufFixed32:
+			if len(data) < 4 {
+				return nil, ErrInvalidEncoding
+			}
+			data = data[4:]
+		case protobufBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return nil, ErrInvalidEncoding
+			}
+			payload = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			return nil, ErrInvalidEncoding
+		}
+
+		if !known {
+			continue // Unknown fields are skipped for forward compatibility
+		}
+
+		switch {
+		case field.Kind == ProtobufString && wire == protobufBytes:
+			fields[field.Name] = string(payload)
+		case field.Kind == ProtobufDouble && wire == protobufFixed64:
+			fields[field.Name] = math.Float64frombits(raw)
+		case field.Kind == ProtobufUint32 && wire == protobufVarint:
+			fields[field.Name] = uint32(raw)
+		case field.Kind == ProtobufSint64 && wire == protobufVarint:
+			fields[field.Name] = int64(raw>>1) ^ -int64(raw&1)
+		default:
+			return nil, ErrInvalidEncoding
+		}
+	}
+
+	return json.Marshal(fields)
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testState mirrors the JSON layout of the algorithms' token bucket state.
+type testState struct {
+	Version    int     `json:"v"`
+	Type       string  `json:"type"`
+	Tokens     float64 `json:"tokens"`
+	LastRefill int64   `json:"last_refill"`
+	Created    int64   `json:"created,omitempty"`
+}
+
+func init() {
+	RegisterProtobufFields(
+		ProtobufField{Name: "tokens", Number: 3, Kind: ProtobufDouble},
+		ProtobufField{Name: "last_refill", Number: 4, Kind: ProtobufSint64},
+		ProtobufField{Name: "created", Number: 6, Kind: ProtobufSint64},
+	)
+}
+
+func (s *testState) MarshalBinary() ([]byte, error) {
+	return []byte("binary"), nil
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	states := []testState{
+		{Version: 1, Type: "token_bucket", Tokens: 2.5, LastRefill: 1700000000123456789, Created: -42},
+		{Version: 1, Type: "token_bucket", Tokens: -3, LastRefill: 1},
+		{Version: 1, Type: "token_bucket"},
+	}
+
+	for _, codec := range []Codec{JSONCodec, MsgpackCodec, ProtobufCodec} {
+		for _, state := range states {
+			data, err := codec.Marshal(&state)
+			if err != nil {
+				t.Fatalf("%s: Marshal failed: %v", codec.Name(), err)
+			}
+
+			v, err := codec.Unmarshal(data)
+			if err != nil {
+				t.Fatalf("%s: Unmarshal failed: %v", codec.Name(), err)
+			}
+			b, ok := v.([]byte)
+			if !ok {
+				t.Fatalf("%s: expected []byte, got %T", codec.Name(), v)
+			}
+
+			var got testState
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("%s: decoded value is not valid JSON: %v", codec.Name(), err)
+			}
+			if !reflect.DeepEqual(got, state) {
+				t.Errorf("%s: round trip = %+v, want %+v", codec.Name(), got, state)
+			}
+		}
+	}
+}
+
+func TestCodec_Binary(t *testing.T) {
+	data, err := BinaryCodec.Marshal(&testState{})
+	if err != nil || string(data) != "binary" {
+		t.Fatalf("Expected MarshalBinary output, got %q, %v", data, err)
+	}
+	if _, err := BinaryCodec.Marshal(42); err == nil {
+		t.Error("Expected error for value without MarshalBinary")
+	}
+}
+
+func TestCodec_InvalidInput(t *testing.T) {
+	tests := []struct {
+		codec Codec
+		data  []byte
+	}{
+		{MsgpackCodec, nil},
+		{MsgpackCodec, []byte{0x81, 0xa1}},
+		{MsgpackCodec, []byte{0x81, 0x01, 0x01}},
+		{MsgpackCodec, []byte{0x80, 0x00}},
+		{ProtobufCodec, []byte{0x08}},
+		{ProtobufCodec, []byte{0x12, 0x05, 'a'}},
+		{ProtobufCodec, []byte{0x10, 0x01}}, // type with varint wire type
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.codec.Unmarshal(tt.data); !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("%s: Unmarshal(%x) expected ErrInvalidEncoding, got %v", tt.codec.Name(), tt.data, err)
+		}
+	}
+}
+
+func TestProtobufCodec_UnknownFields(t *testing.T) {
+	if _, err := ProtobufCodec.Marshal(map[string]int{"unknown": 1}); err == nil {
+		t.Error("Expected error for field without protobuf mapping")
+	}
+
+	// Field 15 (varint) is skipped on decode
+	data := []byte{0x08, 0x01, 0x78, 0x05}
+	v, err := ProtobufCodec.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	var got testState
+	if err := json.Unmarshal(v.([]byte), &got); err != nil || got.Version != 1 {
+		t.Errorf("Expected version 1, got %+v, %v", got, err)
+	}
+}
+
+func TestRegisterProtobufFields(t *testing.T) {
+	// Registering a field again is allowed
+	RegisterProtobufFields(ProtobufField{Name: "tokens", Number: 3, Kind: ProtobufDouble})
+
+	for _, f := range []ProtobufField{
+		{Name: "tokens", Number: 30, Kind: ProtobufDouble}, // Name taken
+		{Name: "other", Number: 3, Kind: ProtobufDouble},   // Number taken
+		{Name: "tokens", Number: 3, Kind: ProtobufSint64},  // Other kind
+		{Name: "unset", Number: 31},                        // No kind
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected %+v to panic", f)
+				}
+			}()
+			RegisterProtobufFields(f)
+		}()
+	}
+	if _, err := ProtobufCodec.Marshal(map[string]int{"unset": 1}); err == nil {
+		t.Error("Expected fields that failed to register to stay unknown")
+	}
+}
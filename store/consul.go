@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCASConflict is returned when a check-and-set write loses to a
+// concurrent update of the same key.
+var ErrCASConflict = errors.New("ratelimiter: concurrent update conflict")
+
+// Consul session TTL bounds.
+const (
+	consulMinSessionTTL = 10 * time.Second
+	consulMaxSessionTTL = 24 * time.Hour
+)
+
+// maxTrackedIndexes bounds the number of ModifyIndex values remembered
+// between Get and Set.
+const maxTrackedIndexes = 100_000
+
+// ConsulClient is the subset of Consul operations used by ConsulStore.
+// It keeps this module free of the Consul API dependency; an adapter around
+// github.com/hashicorp/consul/api maps the methods to KV().Get, KV().Put,
+// KV().CAS, KV().Delete and Session().Create.
+type ConsulClient interface {
+	// Get returns the value and ModifyIndex of key and whether it exists.
+	Get(ctx context.Context, key string) (value []byte, modifyIndex uint64, found bool, err error)
+
+	// Put unconditionally stores value under key, attached to session if non-empty.
+	Put(ctx context.Context, key string, value []byte, session string) error
+
+	// CAS stores value under key only if its ModifyIndex still equals
+	// modifyIndex. It reports whether the write succeeded.
+	CAS(ctx context.Context, key string, value []byte, modifyIndex uint64, session string) (bool, error)
+
+	// Delete removes key.
+	Delete(ctx context.Context, key string) error
+
+	// CreateSession creates a session with the given TTL whose invalidation
+	// deletes the keys attached to it (Behavior "delete").
+	CreateSession(ctx context.Context, ttl time.Duration) (string, error)
+}
+
+// ConsulStoreConfig holds configuration for ConsulStore.
+type ConsulStoreConfig struct {
+	// Prefix is prepended to every key.
+	// Default is "ratelimiter/".
+	Prefix string
+	// Codec encodes limiter state. Default is BinaryCodec.
+	Codec Codec
+	// Timeout bounds each Consul operation.
+	// Default is 1 second.
+	Timeout time.Duration
+	// MaxKeySize is the maximum length of a key in bytes.
+	// Default is 4096.
+	MaxKeySize int
+}
+
+// consulSession is a session shared by all writes with the same TTL until it rotates.
+type consulSession struct {
+	id       string
+	rotateAt time.Time
+}
+
+// ConsulStore is a Store backed by the Consul KV store.
+//
+// Writes use check-and-set against the ModifyIndex observed by the preceding
+// Get, so concurrent updates from other nodes fail with ErrCASConflict
+// instead of being silently overwritten.
+//
+// Consul has no per-key TTL. Keys are attached to sessions with twice the
+// requested TTL that are rotated every TTL, so a key expires between one and
+// two TTLs (plus Consul's grace period) after its last write. Session TTLs
+// are clamped to Consul's 10s to 24h range.
+type ConsulStore struct {
+	client     ConsulClient
+	prefix     string
+	codec      Codec
+	timeout    time.Duration
+	maxKeySize int
+
+	indexMu sync.Mutex
+	indexes map[string]uint64
+
+	sessionMu sync.Mutex
+	sessions  map[time.Duration]consulSession
+}
+
+// NewConsulStore creates a new Consul-backed store.
+// The client is owned by the caller; Close does not close it.
+func NewConsulStore(client ConsulClient, config ConsulStoreConfig) *ConsulStore {
+	if config.Prefix == "" {
+		config.Prefix = "ratelimiter/"
+	}
+	if config.Codec == nil {
+		config.Codec = BinaryCodec
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+	if config.MaxKeySize <= 0 {
+		config.MaxKeySize = 4096
+	}
+
+	return &ConsulStore{
+		client:     client,
+		prefix:     config.Prefix,
+		codec:      config.Codec,
+		timeout:    config.Timeout,
+		maxKeySize: config.MaxKeySize,
+		indexes:    make(map[string]uint64),
+		sessions:   make(map[time.Duration]consulSession),
+	}
+}
+
+// Get retrieves a value from the store and remembers its ModifyIndex for
+// the next Set of the same key.
+// Errors from Consul or the codec are reported as a missing key.
+func (s *ConsulStore) Get(key string) (interface{}, bool) {
+	val, ok, _ := s.GetContext(context.Background(), key)
+	return val, ok
+}
+
+// GetContext is like Get, bounded by ctx and the configured timeout, and
+// returns Consul errors. Values that cannot be decoded are reported as missing.
+func (s *ConsulStore) GetContext(ctx context.Context, key string) (interface{}, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	data, index, ok, err := s.client.Get(ctx, s.prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	// A zero index makes the next CAS create-only
+	s.trackIndex(key, index)
+	if !ok {
+		return nil, false, nil
+	}
+
+	val, err := s.codec.Unmarshal(data)
+	if err != nil {
+		return nil, false, nil
+	}
+	return val, true, nil
+}
+
+// Set stores a value with an optional TTL. If the key was read by Get, the
+// write is a check-and-set and returns ErrCASConflict if the key changed.
+func (s *ConsulStore) Set(key string, value interface{}, ttl time.Duration) error {
+	return s.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext is like Set, bounded by ctx and the configured timeout.
+func (s *ConsulStore) SetContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if len(key) > s.maxKeySize {
+		return ErrKeyTooLong
+	}
+
+	data, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var session string
+	if ttl > 0 {
+		session, err = s.session(ctx, ttl, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	index, tracked := s.takeIndex(key)
+	if !tracked {
+		return s.client.Put(ctx, s.prefix+key, data, session)
+	}
+
+	ok, err := s.client.CAS(ctx, s.prefix+key, data, index, session)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrCASConflict
+	}
+	return nil
+}
+
+// Delete removes a value from the store.
+func (s *ConsulStore) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext is like Delete, bounded by ctx and the configured timeout.
+func (s *ConsulStore) DeleteContext(ctx context.Context, key string) error {
+	s.takeIndex(key)
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.client.Delete(ctx, s.prefix+key)
+}
+
+// Ping checks that Consul is reachable by reading a key under the prefix.
+func (s *ConsulStore) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, _, _, err := s.client.Get(ctx, s.prefix+"ping")
+	return err
+}
+
+// Close is a no-op; the Consul client is owned by the caller.
+// Sessions expire on their own.
+func (s *ConsulStore) Close() error {
+	return nil
+}
+
+// trackIndex remembers the ModifyIndex of key.
+func (s *ConsulStore) trackIndex(key string, index uint64) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	// Keys that are read but never written must not grow the map forever
+	if len(s.indexes) >= maxTrackedIndexes {
+		clear(s.indexes)
+	}
+	s.indexes[key] = index
+}
+
+// takeIndex returns and forgets the ModifyIndex of key.
+func (s *ConsulStore) takeIndex(key string) (uint64, bool) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	index, ok := s.indexes[key]
+	delete(s.indexes, key)
+	return index, ok
+}
+
+// session returns the current session for ttl, creating a new one every ttl.
+func (s *ConsulStore) session(ctx context.Context, ttl time.Duration, now time.Time) (string, error) {
+	ttl = time.Duration(leaseSeconds(ttl)) * time.Second
+	ttl = min(max(ttl, consulMinSessionTTL/2), consulMaxSessionTTL/2)
+
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+
+	if sess, ok := s.sessions[ttl]; ok && now.Before(sess.rotateAt) {
+		return sess.id, nil
+	}
+
+	id, err := s.client.CreateSession(ctx, 2*ttl)
+	if err != nil {
+		return "", err
+	}
+	s.sessions[ttl] = consulSession{id: id, rotateAt: now.Add(ttl)}
+	return id, nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type consulEntry struct {
+	value   []byte
+	index   uint64
+	session string
+}
+
+// fakeConsul is an in-memory ConsulClient with ModifyIndex semantics.
+type fakeConsul struct {
+	mu       sync.Mutex
+	data     map[string]consulEntry
+	index    uint64
+	sessions []time.Duration
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{data: make(map[string]consulEntry)}
+}
+
+func (f *fakeConsul) Get(ctx context.Context, key string) ([]byte, uint64, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.data[key]
+	return e.value, e.index, ok, nil
+}
+
+func (f *fakeConsul) Put(ctx context.Context, key string, value []byte, session string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.index++
+	f.data[key] = consulEntry{value: value, index: f.index, session: session}
+	return nil
+}
+
+func (f *fakeConsul) CAS(ctx context.Context, key string, value []byte, modifyIndex uint64, session string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data[key].index != modifyIndex {
+		return false, nil
+	}
+	f.index++
+	f.data[key] = consulEntry{value: value, index: f.index, session: session}
+	return true, nil
+}
+
+func (f *fakeConsul) Delete(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.data, key)
+	return nil
+}
+
+func (f *fakeConsul) CreateSession(ctx context.Context, ttl time.Duration) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions = append(f.sessions, ttl)
+	return fmt.Sprintf("session-%d", len(f.sessions)), nil
+}
+
+func TestConsulStore_CheckAndSet(t *testing.T) {
+	client := newFakeConsul()
+	a := NewConsulStore(client, ConsulStoreConfig{Codec: JSONCodec})
+	b := NewConsulStore(client, ConsulStoreConfig{Codec: JSONCodec})
+
+	// Create-only write after reading a missing key
+	if _, ok := a.Get("key"); ok {
+		t.Fatal("Expected missing key")
+	}
+	if err := a.Set("key", 1, 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// Both nodes read the same version, the second write conflicts
+	a.Get("key")
+	b.Get("key")
+	if err := a.Set("key", 2, 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := b.Set("key", 3, 0); !errors.Is(err, ErrCASConflict) {
+		t.Fatalf("Expected ErrCASConflict, got %v", err)
+	}
+
+	val, ok := b.Get("key")
+	if !ok || string(val.([]byte)) != "2" {
+		t.Errorf("Expected value 2, got %v, %v", val, ok)
+	}
+
+	// Blind writes without a preceding Get are unconditional
+	if err := b.Set("other", 4, 0); err != nil {
+		t.Errorf("Set without Get failed: %v", err)
+	}
+
+	if err := a.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok := a.Get("key"); ok {
+		t.Error("Expected key to be deleted")
+	}
+}
+
+func TestConsulStore_Sessions(t *testing.T) {
+	client := newFakeConsul()
+	s := NewConsulStore(client, ConsulStoreConfig{Codec: JSONCodec})
+	now := time.Now()
+	ctx := context.Background()
+
+	id1, _ := s.session(ctx, time.Minute, now)
+	id2, _ := s.session(ctx, time.Minute, now.Add(30*time.Second))
+	if id1 != id2 {
+		t.Error("Expected session to be reused within its rotation interval")
+	}
+
+	id3, _ := s.session(ctx, time.Minute, now.Add(time.Minute))
+	if id3 == id1 {
+		t.Error("Expected session to rotate after the TTL")
+	}
+
+	s.session(ctx, time.Second, now)
+	want := []time.Duration{2 * time.Minute, 2 * time.Minute, consulMinSessionTTL}
+	if fmt.Sprint(client.sessions) != fmt.Sprint(want) {
+		t.Errorf("Expected session TTLs %v, got %v", want, client.sessions)
+	}
+
+	if err := s.Set("key", 1, time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if client.data["ratelimiter/key"].session == "" {
+		t.Error("Expected key with TTL to be attached to a session")
+	}
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// EtcdClient is the subset of etcd operations used by EtcdStore.
+// It keeps this module free of the etcd client dependency; a typical
+// adapter around go.etcd.io/etcd/client/v3 looks like:
+//
+//	func (a adapter) Get(ctx context.Context, key string) ([]byte, bool, error) {
+//		resp, err := a.cli.Get(ctx, key)
+//		if err != nil || len(resp.Kvs) == 0 {
+//			return nil, false, err
+//		}
+//		return resp.Kvs[0].Value, true, nil
+//	}
+//
+//	func (a adapter) PutWithLease(ctx context.Context, key string, value []byte, ttlSeconds int64) error {
+//		var opts []clientv3.OpOption
+//		if ttlSeconds > 0 {
+//			lease, err := a.cli.Grant(ctx, ttlSeconds)
+//			if err != nil {
+//				return err
+//			}
+//			opts = append(opts, clientv3.WithLease(lease.ID))
+//		}
+//		_, err := a.cli.Txn(ctx).Then(clientv3.OpPut(key, string(value), opts...)).Commit()
+//		return err
+//	}
+//
+//	func (a adapter) Delete(ctx context.Context, key string) error {
+//		_, err := a.cli.Delete(ctx, key)
+//		return err
+//	}
+type EtcdClient interface {
+	// Get returns the value of key and whether it exists.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// PutWithLease stores value under key in a transaction. If ttlSeconds is
+	// positive, the key is attached to a lease with that TTL.
+	PutWithLease(ctx context.Context, key string, value []byte, ttlSeconds int64) error
+
+	// Delete removes key.
+	Delete(ctx context.Context, key string) error
+}
+
+// EtcdStoreConfig holds configuration for EtcdStore.
+type EtcdStoreConfig struct {
+	// Prefix is prepended to every key (e.g. "/ratelimiter/").
+	// Default is "ratelimiter/".
+	Prefix string
+	// Codec encodes limiter state. Default is BinaryCodec.
+	Codec Codec
+	// Timeout bounds each etcd operation.
+	// Default is 1 second.
+	Timeout time.Duration
+	// MaxKeySize is the maximum length of a key in bytes.
+	// Default is 4096.
+	MaxKeySize int
+}
+
+// EtcdStore is a Store backed by etcd. Expiration uses etcd leases, which
+// have a granularity of one second, so TTLs are rounded up.
+//
+// etcd favors consistency over throughput; it suits clusters that already
+// run etcd or low-QPS endpoints that need strongly consistent limits.
+type EtcdStore struct {
+	client     EtcdClient
+	prefix     string
+	codec      Codec
+	timeout    time.Duration
+	maxKeySize int
+}
+
+// NewEtcdStore creates a new etcd-backed store.
+// The client is owned by the caller; Close does not close it.
+func NewEtcdStore(client EtcdClient, config EtcdStoreConfig) *EtcdStore {
+	if config.Prefix == "" {
+		config.Prefix = "ratelimiter/"
+	}
+	if config.Codec == nil {
+		config.Codec = BinaryCodec
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+	if config.MaxKeySize <= 0 {
+		config.MaxKeySize = 4096
+	}
+
+	return &EtcdStore{
+		client:     client,
+		prefix:     config.Prefix,
+		codec:      config.Codec,
+		timeout:    config.Timeout,
+		maxKeySize: config.MaxKeySize,
+	}
+}
+
+// Get retrieves a value from the store.
+// Errors from etcd or the codec are reported as a missing key.
+func (s *EtcdStore) Get(key string) (interface{}, bool) {
+	val, ok, _ := s.GetContext(context.Background(), key)
+	return val, ok
+}
+
+// GetContext retrieves a value from the store, bounded by ctx and the
+// configured timeout. Values that cannot be decoded are reported as missing.
+func (s *EtcdStore) GetContext(ctx context.Context, key string) (interface{}, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	data, ok, err := s.client.Get(ctx, s.prefix+key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	val, err := s.codec.Unmarshal(data)
+	if err != nil {
+		return nil, false, nil
+	}
+	return val, true, nil
+}
+
+// Set stores a value with an optional TTL.
+func (s *EtcdStore) Set(key string, value interface{}, ttl time.Duration) error {
+	return s.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext stores a value with an optional TTL, bounded by ctx and the
+// configured timeout.
+func (s *EtcdStore) SetContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if len(key) > s.maxKeySize {
+		return ErrKeyTooLong
+	}
+
+	data, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.client.PutWithLease(ctx, s.prefix+key, data, leaseSeconds(ttl))
+}
+
+// Delete removes a value from the store.
+func (s *EtcdStore) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext removes a value from the store, bounded by ctx and the
+// configured timeout.
+func (s *EtcdStore) DeleteContext(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.client.Delete(ctx, s.prefix+key)
+}
+
+// Ping checks that etcd is reachable by reading a key under the prefix.
+func (s *EtcdStore) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, _, err := s.client.Get(ctx, s.prefix+"ping")
+	return err
+}
+
+// Close is a no-op; the etcd client is owned by the caller.
+func (s *EtcdStore) Close() error {
+	return nil
+}
+
+// leaseSeconds rounds ttl up to whole seconds. A zero TTL means no lease.
+func leaseSeconds(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return int64((ttl + time.Second - 1) / time.Second)
+}
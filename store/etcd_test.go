@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEtcd is an in-memory EtcdClient recording lease TTLs.
+type fakeEtcd struct {
+	mu     sync.Mutex
+	data   map[string][]byte
+	leases map[string]int64
+	err    error
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{data: make(map[string][]byte), leases: make(map[string]int64)}
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, false, f.err
+	}
+	v, ok := f.data[key]
+	return v, ok, nil
+}
+
+func (f *fakeEtcd) PutWithLease(ctx context.Context, key string, value []byte, ttlSeconds int64) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("missing deadline")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.data[key] = value
+	f.leases[key] = ttlSeconds
+	return nil
+}
+
+func (f *fakeEtcd) Delete(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.data, key)
+	return nil
+}
+
+func TestEtcdStore_Basic(t *testing.T) {
+	client := newFakeEtcd()
+	s := NewEtcdStore(client, EtcdStoreConfig{Codec: JSONCodec})
+	defer s.Close()
+
+	if _, ok := s.Get("key"); ok {
+		t.Error("Expected missing key")
+	}
+
+	if err := s.Set("key", map[string]int{"v": 1}, 1500*time.Millisecond); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, ok := client.data["ratelimiter/key"]; !ok {
+		t.Error("Expected default prefix on stored key")
+	}
+	if got := client.leases["ratelimiter/key"]; got != 2 {
+		t.Errorf("Expected lease TTL rounded up to 2s, got %d", got)
+	}
+
+	val, ok := s.Get("key")
+	if !ok {
+		t.Fatal("Expected key to exist")
+	}
+	if string(val.([]byte)) != `{"v":1}` {
+		t.Errorf("Unexpected value %s", val)
+	}
+
+	if err := s.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok := s.Get("key"); ok {
+		t.Error("Expected key to be deleted")
+	}
+}
+
+func TestEtcdStore_Errors(t *testing.T) {
+	client := newFakeEtcd()
+	s := NewEtcdStore(client, EtcdStoreConfig{Prefix: "/rl/", Codec: JSONCodec, MaxKeySize: 8})
+
+	if err := s.Set(strings.Repeat("k", 9), 1, 0); !errors.Is(err, ErrKeyTooLong) {
+		t.Errorf("Expected ErrKeyTooLong, got %v", err)
+	}
+
+	if err := s.Set("key", 1, 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := client.leases["/rl/key"]; got != 0 {
+		t.Errorf("Expected no lease for zero TTL, got %d", got)
+	}
+
+	client.err = errors.New("etcd unavailable")
+	if _, ok := s.Get("key"); ok {
+		t.Error("Expected Get to report missing key on error")
+	}
+	if err := s.Set("key", 1, 0); err == nil {
+		t.Error("Expected Set to return client error")
+	}
+}
+
+func TestEtcdStore_Ping(t *testing.T) {
+	client := newFakeEtcd()
+	s := NewEtcdStore(client, EtcdStoreConfig{})
+
+	if err := Ping(context.Background(), s); err != nil {
+		t.Errorf("Expected reachable store, got %v", err)
+	}
+	client.err = errors.New("etcd unavailable")
+	if err := Ping(context.Background(), s); err == nil {
+		t.Error("Expected Ping to report the client error")
+	}
+	if err := Ping(context.Background(), &MemoryStore{}); err != nil {
+		t.Errorf("Expected MemoryStore to be reachable, got %v", err)
+	}
+}
+
+func TestEtcdStore_GetContextReportsErrors(t *testing.T) {
+	client := newFakeEtcd()
+	var s ContextStore = NewEtcdStore(client, EtcdStoreConfig{Codec: JSONCodec})
+
+	if _, ok, err := s.GetContext(context.Background(), "key"); ok || err != nil {
+		t.Errorf("Expected a plain miss, got %v, %v", ok, err)
+	}
+	client.err = errors.New("etcd unavailable")
+	if _, _, err := s.GetContext(context.Background(), "key"); err == nil {
+		t.Error("Expected GetContext to return the client error")
+	}
+}
@@ -1,35 +1,111 @@
 package store
 
 import (
+	"context"
 	"hash/maphash"
 	"math/bits"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const shardCount = 256
+const (
+	// mapSlotOverhead approximates the per-entry overhead of a Go map
+	// (control bytes and load factor slack) for memory accounting.
+	mapSlotOverhead = 16
+
+	// keySlotBytes and entrySlotBytes are the sizes of an internalKey (two
+	// strings) and of an entry holding an interface or a pointer, on 64-bit
+	// platforms. They are constants rather than unsafe.Sizeof, so that the
+	// package can be interpreted (e.g. by Yaegi in Traefik plugins).
+	keySlotBytes   = 32
+	entrySlotBytes = 40
+
+	// defaultShardCount is the default number of MemoryStore shards.
+	defaultShardCount = 256
+
+	// maxShardCount bounds MemoryStoreConfig.Shards.
+	maxShardCount = 1 << 16
+)
 
 type internalKey struct {
 	ns  string
 	key string
 }
 
-type shard struct {
-	mu      sync.RWMutex
-	entries map[internalKey]Entry
-	// Pad to 64 bytes to avoid false sharing
-	_ [32]byte
+// shard is an independently locked part of a memoryCore.
+type shard[V any] struct {
+	mu        sync.RWMutex
+	entries   map[internalKey]typedEntry[V]
+	wheel     map[int64][]internalKey // Keys by expiry bucket, see memoryCore.put
+	contended atomic.Uint64           // Lock acquisitions that had to wait
+	mem       shardMemory
+	// Pad to 128 bytes to avoid false sharing
+	_ [24]byte
+}
+
+// typedEntry is an Entry holding a value of type V.
+type typedEntry[V any] struct {
+	Value     V
+	ExpiresAt time.Time
+}
+
+// IsExpiredAt reports whether the entry has expired at the given time.
+func (e typedEntry[V]) IsExpiredAt(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// shardMemory holds the memory counters of a shard. The byte counts are
+// only maintained when memory is tracked.
+type shardMemory struct {
+	bytes         int64 // Approximate size of the entries, as bounded by MaxMemoryBytes
+	keyBytes      int64
+	valueBytes    int64
+	inserted      uint64
+	insertedBytes uint64
+	expired       uint64
+	evicted       uint64
+}
+
+// lock acquires the write lock, counting contention.
+func (sh *shard[V]) lock() {
+	if !sh.mu.TryLock() {
+		sh.contended.Add(1)
+		sh.mu.Lock()
+	}
+}
+
+// rlock acquires the read lock, counting contention.
+func (sh *shard[V]) rlock() {
+	if !sh.mu.TryRLock() {
+		sh.contended.Add(1)
+		sh.mu.RLock()
+	}
+}
+
+// memoryCore is the sharded, expiring map behind MemoryStore and
+// TypedMemoryStore, holding values of type V.
+type memoryCore[V any] struct {
+	shards        []*shard[V]
+	shardMask     uint64
+	stopChan      chan struct{}
+	doneChan      chan struct{} // Closed when the cleanup routine has exited
+	closeOnce     sync.Once
+	maxShardSize  int
+	trackMemory   bool
+	maxShardBytes int64 // 0 disables eviction
+	slotBytes     int64 // Fixed size of an entry in the map
+	refBytes      int64 // Size of an expiry index reference
+	maxKeySize    int
+	bucketWidth   int64 // Expiry bucket width in nanoseconds (the cleanup interval)
+	seed          maphash.Seed
 }
 
 // MemoryStore is an in-memory implementation of the Store interface.
 // It provides automatic cleanup of expired entries.
 type MemoryStore struct {
-	shards       [shardCount]*shard
-	stopChan     chan struct{}
-	closeOnce    sync.Once
-	maxShardSize int
-	maxKeySize   int
-	seed         maphash.Seed
+	memoryCore[interface{}]
 }
 
 // MemoryStoreConfig holds configuration for MemoryStore.
@@ -43,6 +119,31 @@ type MemoryStoreConfig struct {
 	// MaxKeySize is the maximum length of a key in bytes.
 	// Default is 4096.
 	MaxKeySize int
+	// Shards is the number of independently locked shards, rounded up to a
+	// power of two (at most 65536). Fewer shards save memory on small
+	// devices; more shards reduce lock contention on many-core servers.
+	// MaxEntries is split evenly between shards.
+	// Default is 256.
+	Shards int
+	// MaxMemoryBytes is an approximate bound on the memory used by entries:
+	// keys, bookkeeping and values that are []byte, strings or implement
+	// Sizer (as limiter state does). When it is exceeded, the entries
+	// closest to expiration are evicted first, then entries without a TTL.
+	// Like MaxEntries, it is split evenly between shards.
+	// An evicted key starts over with a fresh limit.
+	// Default is 0 (no bound; only MaxEntries applies).
+	MaxMemoryBytes int64
+	// TrackMemory maintains the byte estimates reported by MemoryStats, at
+	// the cost of a type switch on every write. It is implied by
+	// MaxMemoryBytes.
+	// Default is false.
+	TrackMemory bool
+}
+
+// Sizer is implemented by values that report their approximate size in
+// bytes, including memory they reference, for MaxMemoryBytes accounting.
+type Sizer interface {
+	Size() int
 }
 
 // DefaultMemoryStoreConfig returns sensible defaults for MemoryStore.
@@ -51,6 +152,7 @@ func DefaultMemoryStoreConfig() MemoryStoreConfig {
 		CleanupInterval: time.Minute,
 		MaxEntries:      1_000_000,
 		MaxKeySize:      4096,
+		Shards:          defaultShardCount,
 	}
 }
 
@@ -61,6 +163,14 @@ func NewMemoryStore() *MemoryStore {
 
 // NewMemoryStoreWithConfig creates a new in-memory store with custom configuration.
 func NewMemoryStoreWithConfig(config MemoryStoreConfig) *MemoryStore {
+	s := &MemoryStore{}
+	s.init(config)
+	return s
+}
+
+// init applies the config defaults, allocates the shards and starts the
+// cleanup routine.
+func (s *memoryCore[V]) init(config MemoryStoreConfig) {
 	if config.CleanupInterval <= 0 {
 		config.CleanupInterval = time.Minute
 	}
@@ -70,195 +180,149 @@ func NewMemoryStoreWithConfig(config MemoryStoreConfig) *MemoryStore {
 	if config.MaxKeySize <= 0 {
 		config.MaxKeySize = 4096
 	}
-
-	s := &MemoryStore{
-		stopChan:   make(chan struct{}),
-		maxKeySize: config.MaxKeySize,
-		seed:       maphash.MakeSeed(),
+	shards := defaultShardCount
+	if config.Shards > 0 {
+		// Round up to a power of two so shards are selected by masking
+		shards = 1 << bits.Len(uint(min(config.Shards, maxShardCount)-1))
 	}
 
+	s.shards = make([]*shard[V], shards)
+	s.shardMask = uint64(shards - 1)
+	s.stopChan = make(chan struct{})
+	s.doneChan = make(chan struct{})
+	s.maxKeySize = config.MaxKeySize
+	s.bucketWidth = int64(config.CleanupInterval)
+	s.seed = maphash.MakeSeed()
+
 	// Calculate approximate per-shard limit
 	// Ensure at least 1 entry per shard if MaxEntries is very small
-	s.maxShardSize = config.MaxEntries / shardCount
+	s.maxShardSize = config.MaxEntries / shards
 	if s.maxShardSize < 1 {
 		s.maxShardSize = 1
 	}
+	if config.MaxMemoryBytes > 0 {
+		s.maxShardBytes = max(config.MaxMemoryBytes/int64(shards), 1)
+	}
+	s.trackMemory = config.TrackMemory || config.MaxMemoryBytes > 0
+	s.slotBytes = keySlotBytes + entrySlotBytes + mapSlotOverhead
+	s.refBytes = keySlotBytes
 
-	for i := 0; i < shardCount; i++ {
-		s.shards[i] = &shard{
-			entries: make(map[internalKey]Entry),
+	for i := range s.shards {
+		s.shards[i] = &shard[V]{
+			entries: make(map[internalKey]typedEntry[V]),
+			wheel:   make(map[int64][]internalKey),
 		}
 	}
 
 	go s.cleanupLoop(config.CleanupInterval)
-
-	return s
 }
 
 // Get retrieves a value from the store.
 func (s *MemoryStore) Get(key string) (interface{}, bool) {
-	return s.GetWithNamespace("", key)
+	return s.get("", key, time.Now())
 }
 
 // GetWithNamespace retrieves a value from the store using a namespace and key.
 func (s *MemoryStore) GetWithNamespace(namespace, key string) (interface{}, bool) {
-	if len(namespace)+len(key) > s.maxKeySize {
-		return nil, false
-	}
-
-	k := internalKey{ns: namespace, key: key}
-	shard := s.getShard(k)
-	shard.mu.RLock()
-	defer shard.mu.RUnlock()
-
-	entry, exists := shard.entries[k]
-	if !exists {
-		return nil, false
-	}
-
-	if entry.IsExpired() {
-		return nil, false
-	}
-
-	return entry.Value, true
+	return s.get(namespace, key, time.Now())
 }
 
 // Set stores a value with an optional TTL.
 func (s *MemoryStore) Set(key string, value interface{}, ttl time.Duration) error {
-	return s.SetWithNamespace("", key, value, ttl)
+	return s.set("", key, value, ttl, time.Now())
 }
 
 // SetWithNamespace stores a value with namespace using an optional TTL.
 func (s *MemoryStore) SetWithNamespace(namespace, key string, value interface{}, ttl time.Duration) error {
-	if len(namespace)+len(key) > s.maxKeySize {
-		return ErrKeyTooLong
-	}
-
-	k := internalKey{ns: namespace, key: key}
-	shard := s.getShard(k)
-	shard.mu.Lock()
-	defer shard.mu.Unlock()
-
-	entry := Entry{
-		Value: value,
-	}
-
-	if ttl > 0 {
-		entry.ExpiresAt = time.Now().Add(ttl)
-	}
-
-	// Optimization: avoid double lookup if shard is not full
-	if len(shard.entries) < s.maxShardSize {
-		shard.entries[k] = entry
-		return nil
-	}
-
-	// Check if key already exists to allow updates even if full
-	if _, exists := shard.entries[k]; exists {
-		shard.entries[k] = entry
-		return nil
-	}
-
-	// New key and shard is full
-	return ErrStoreFull
+	return s.set(namespace, key, value, ttl, time.Now())
 }
 
 // Delete removes a value from the store.
 func (s *MemoryStore) Delete(key string) error {
-	return s.DeleteWithNamespace("", key)
+	return s.delete("", key)
 }
 
 // DeleteWithNamespace removes a value from the store using a namespace and key.
 func (s *MemoryStore) DeleteWithNamespace(namespace, key string) error {
-	if len(namespace)+len(key) > s.maxKeySize {
-		return ErrKeyTooLong
-	}
-
-	k := internalKey{ns: namespace, key: key}
-	shard := s.getShard(k)
-	shard.mu.Lock()
-	defer shard.mu.Unlock()
-
-	delete(shard.entries, k)
-	return nil
+	return s.delete(namespace, key)
 }
 
 // UpdateTTL updates the expiration of a key without changing its value.
 func (s *MemoryStore) UpdateTTL(key string, ttl time.Duration) error {
-	return s.UpdateTTLWithNamespace("", key, ttl)
+	return s.updateTTL("", key, ttl, time.Now())
 }
 
 // UpdateTTLWithNamespace updates the expiration of a namespaced key without changing its value.
 func (s *MemoryStore) UpdateTTLWithNamespace(namespace, key string, ttl time.Duration) error {
-	if len(namespace)+len(key) > s.maxKeySize {
-		return ErrKeyTooLong
-	}
-
-	k := internalKey{ns: namespace, key: key}
-	shard := s.getShard(k)
-	shard.mu.Lock()
-	defer shard.mu.Unlock()
-
-	entry, exists := shard.entries[k]
-	if !exists {
-		// Key doesn't exist, cannot update TTL
-		return nil
-	}
-
-	if ttl > 0 {
-		entry.ExpiresAt = time.Now().Add(ttl)
-	} else {
-		entry.ExpiresAt = time.Time{}
-	}
-	shard.entries[k] = entry
-	return nil
+	return s.updateTTL(namespace, key, ttl, time.Now())
 }
 
 // GetAt retrieves a value from the store relative to the given time.
 func (s *MemoryStore) GetAt(key string, now time.Time) (interface{}, bool) {
-	return s.GetWithNamespaceAt("", key, now)
+	return s.get("", key, now)
 }
 
 // GetWithNamespaceAt retrieves a value from the store using a namespace and key relative to the given time.
 func (s *MemoryStore) GetWithNamespaceAt(namespace, key string, now time.Time) (interface{}, bool) {
+	return s.get(namespace, key, now)
+}
+
+// SetAt stores a value with an optional TTL relative to the given time.
+func (s *MemoryStore) SetAt(key string, value interface{}, ttl time.Duration, now time.Time) error {
+	return s.set("", key, value, ttl, now)
+}
+
+// SetWithNamespaceAt stores a value with namespace using an optional TTL relative to the given time.
+func (s *MemoryStore) SetWithNamespaceAt(namespace, key string, value interface{}, ttl time.Duration, now time.Time) error {
+	return s.set(namespace, key, value, ttl, now)
+}
+
+// UpdateTTLAt updates the expiration of a key relative to the given time.
+func (s *MemoryStore) UpdateTTLAt(key string, ttl time.Duration, now time.Time) error {
+	return s.updateTTL("", key, ttl, now)
+}
+
+// UpdateTTLWithNamespaceAt updates the expiration of a namespaced key relative to the given time.
+func (s *MemoryStore) UpdateTTLWithNamespaceAt(namespace, key string, ttl time.Duration, now time.Time) error {
+	return s.updateTTL(namespace, key, ttl, now)
+}
+
+// get returns the value of a namespaced key unless it has expired at now.
+func (s *memoryCore[V]) get(namespace, key string, now time.Time) (V, bool) {
+	var zero V
 	if len(namespace)+len(key) > s.maxKeySize {
-		return nil, false
+		return zero, false
 	}
 
 	k := internalKey{ns: namespace, key: key}
 	shard := s.getShard(k)
-	shard.mu.RLock()
+	shard.rlock()
 	defer shard.mu.RUnlock()
 
 	entry, exists := shard.entries[k]
 	if !exists {
-		return nil, false
+		return zero, false
 	}
 
 	if entry.IsExpiredAt(now) {
-		return nil, false
+		return zero, false
 	}
 
 	return entry.Value, true
 }
 
-// SetAt stores a value with an optional TTL relative to the given time.
-func (s *MemoryStore) SetAt(key string, value interface{}, ttl time.Duration, now time.Time) error {
-	return s.SetWithNamespaceAt("", key, value, ttl, now)
-}
-
-// SetWithNamespaceAt stores a value with namespace using an optional TTL relative to the given time.
-func (s *MemoryStore) SetWithNamespaceAt(namespace, key string, value interface{}, ttl time.Duration, now time.Time) error {
+// set stores the value of a namespaced key, expiring ttl after now.
+func (s *memoryCore[V]) set(namespace, key string, value V, ttl time.Duration, now time.Time) error {
 	if len(namespace)+len(key) > s.maxKeySize {
 		return ErrKeyTooLong
 	}
 
 	k := internalKey{ns: namespace, key: key}
 	shard := s.getShard(k)
-	shard.mu.Lock()
+	shard.lock()
 	defer shard.mu.Unlock()
 
-	entry := Entry{
+	entry := typedEntry[V]{
 		Value: value,
 	}
 
@@ -266,36 +330,35 @@ func (s *MemoryStore) SetWithNamespaceAt(namespace, key string, value interface{
 		entry.ExpiresAt = now.Add(ttl)
 	}
 
-	// Optimization: avoid double lookup if shard is not full
-	if len(shard.entries) < s.maxShardSize {
-		shard.entries[k] = entry
-		return nil
-	}
+	return s.put(shard, k, entry)
+}
 
-	// Check if key already exists to allow updates even if full
-	if _, exists := shard.entries[k]; exists {
-		shard.entries[k] = entry
-		return nil
+// delete removes a namespaced key.
+func (s *memoryCore[V]) delete(namespace, key string) error {
+	if len(namespace)+len(key) > s.maxKeySize {
+		return ErrKeyTooLong
 	}
 
-	// New key and shard is full
-	return ErrStoreFull
-}
+	k := internalKey{ns: namespace, key: key}
+	shard := s.getShard(k)
+	shard.lock()
+	defer shard.mu.Unlock()
 
-// UpdateTTLAt updates the expiration of a key relative to the given time.
-func (s *MemoryStore) UpdateTTLAt(key string, ttl time.Duration, now time.Time) error {
-	return s.UpdateTTLWithNamespaceAt("", key, ttl, now)
+	if entry, ok := shard.entries[k]; ok {
+		s.remove(shard, k, entry)
+	}
+	return nil
 }
 
-// UpdateTTLWithNamespaceAt updates the expiration of a namespaced key relative to the given time.
-func (s *MemoryStore) UpdateTTLWithNamespaceAt(namespace, key string, ttl time.Duration, now time.Time) error {
+// updateTTL makes a namespaced key expire ttl after now, or never if ttl is 0.
+func (s *memoryCore[V]) updateTTL(namespace, key string, ttl time.Duration, now time.Time) error {
 	if len(namespace)+len(key) > s.maxKeySize {
 		return ErrKeyTooLong
 	}
 
 	k := internalKey{ns: namespace, key: key}
 	shard := s.getShard(k)
-	shard.mu.Lock()
+	shard.lock()
 	defer shard.mu.Unlock()
 
 	entry, exists := shard.entries[k]
@@ -309,23 +372,42 @@ func (s *MemoryStore) UpdateTTLWithNamespaceAt(namespace, key string, ttl time.D
 	} else {
 		entry.ExpiresAt = time.Time{}
 	}
-	shard.entries[k] = entry
-	return nil
+	return s.put(shard, k, entry)
 }
 
 // Close stops the cleanup routine and releases resources.
-func (s *MemoryStore) Close() error {
+// It does not wait for the routine to exit; use Shutdown for that.
+func (s *memoryCore[V]) Close() error {
 	s.closeOnce.Do(func() {
 		close(s.stopChan)
 	})
 	return nil
 }
 
+// Shutdown stops the cleanup routine and waits until it has exited or ctx is done.
+// The store remains usable for reads and writes afterwards, so it is safe to
+// call while requests are in flight.
+func (s *memoryCore[V]) Shutdown(ctx context.Context) error {
+	s.Close()
+
+	select {
+	case <-s.doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ping always succeeds; an in-memory store is always reachable.
+func (s *memoryCore[V]) Ping(ctx context.Context) error {
+	return nil
+}
+
 // Len returns the number of entries in the store (including expired ones).
-func (s *MemoryStore) Len() int {
+func (s *memoryCore[V]) Len() int {
 	count := 0
 	for _, shard := range s.shards {
-		shard.mu.RLock()
+		shard.rlock()
 		count += len(shard.entries)
 		shard.mu.RUnlock()
 	}
@@ -333,7 +415,9 @@ func (s *MemoryStore) Len() int {
 }
 
 // cleanupLoop periodically removes expired entries.
-func (s *MemoryStore) cleanupLoop(interval time.Duration) {
+func (s *memoryCore[V]) cleanupLoop(interval time.Duration) {
+	defer close(s.doneChan)
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -348,9 +432,9 @@ func (s *MemoryStore) cleanupLoop(interval time.Duration) {
 }
 
 // cleanup removes all expired entries.
-func (s *MemoryStore) cleanup() {
+func (s *memoryCore[V]) cleanup() {
 	for _, shard := range s.shards {
-		shard.mu.Lock()
+		shard.lock()
 		s.cleanupShard(shard)
 		shard.mu.Unlock()
 	}
@@ -358,17 +442,165 @@ func (s *MemoryStore) cleanup() {
 
 // cleanupShard removes expired entries from a specific shard.
 // It assumes the caller holds the lock.
-func (s *MemoryStore) cleanupShard(shard *shard) {
+//
+// Only the expiry buckets that are entirely in the past are visited, so the
+// work is proportional to the number of expired entries rather than to the
+// size of the shard.
+func (s *memoryCore[V]) cleanupShard(shard *shard[V]) {
 	now := time.Now()
-	for key, entry := range shard.entries {
-		if !entry.ExpiresAt.IsZero() && now.After(entry.ExpiresAt) {
-			delete(shard.entries, key)
+	current := now.UnixNano() / s.bucketWidth
+	for b, keys := range shard.wheel {
+		if b >= current {
+			continue
+		}
+		for _, k := range keys {
+			// Keys whose TTL moved to another bucket since are still live
+			if entry, ok := shard.entries[k]; ok && entry.IsExpiredAt(now) {
+				s.remove(shard, k, entry)
+				shard.mem.expired++
+			}
+		}
+		delete(shard.wheel, b)
+	}
+}
+
+// put stores entry under k, unless k is new and the shard is full.
+// It assumes the caller holds the write lock.
+//
+// Entries with a TTL are indexed in the expiry bucket of their expiration
+// time. A key is only appended to a bucket when its expiration moves to a
+// different bucket, so refreshing the TTL of an entry on every Set (as the
+// limiters do) does not grow the index; references left in older buckets
+// are skipped by cleanupShard.
+//
+// With MaxMemoryBytes set, entries are evicted to make room for entry.
+func (s *memoryCore[V]) put(shard *shard[V], k internalKey, entry typedEntry[V]) error {
+	old, exists := shard.entries[k]
+	if !exists && len(shard.entries) >= s.maxShardSize {
+		return ErrStoreFull
+	}
+	shard.entries[k] = entry
+
+	if !entry.ExpiresAt.IsZero() {
+		b := s.bucket(entry)
+		if !exists || old.ExpiresAt.IsZero() || s.bucket(old) != b {
+			shard.wheel[b] = append(shard.wheel[b], k)
 		}
 	}
+
+	if !exists {
+		shard.mem.inserted++
+	}
+	if s.trackMemory {
+		if exists {
+			s.account(shard, k, old.Value, -1)
+		} else {
+			shard.mem.insertedBytes += uint64(s.entrySize(k, entry.Value))
+		}
+		s.account(shard, k, entry.Value, 1)
+		if s.maxShardBytes > 0 && shard.mem.bytes > s.maxShardBytes {
+			s.evict(shard, k)
+		}
+	}
+	return nil
+}
+
+// remove deletes the entry of k.
+// It assumes the caller holds the write lock.
+func (s *memoryCore[V]) remove(shard *shard[V], k internalKey, entry typedEntry[V]) {
+	delete(shard.entries, k)
+	if s.trackMemory {
+		s.account(shard, k, entry.Value, -1)
+	}
+}
+
+// account adds (sign 1) or subtracts (sign -1) the size of an entry to the
+// byte counters of shard.
+func (s *memoryCore[V]) account(shard *shard[V], k internalKey, value V, sign int64) {
+	keyBytes := int64(len(k.ns) + len(k.key))
+	valueBytes := valueSize(value)
+	shard.mem.keyBytes += sign * keyBytes
+	shard.mem.valueBytes += sign * valueBytes
+	shard.mem.bytes += sign * (s.slotBytes + s.refBytes + keyBytes + valueBytes)
+}
+
+// evict removes entries until shard fits in its byte budget, sparing keep.
+// It assumes the caller holds the write lock.
+//
+// Entries closest to expiration go first: their limiter state is about to be
+// dropped anyway. Entries without a TTL are only evicted once no entry with
+// a TTL is left, in no particular order.
+func (s *memoryCore[V]) evict(shard *shard[V], keep internalKey) {
+	buckets := make([]int64, 0, len(shard.wheel))
+	for b := range shard.wheel {
+		buckets = append(buckets, b)
+	}
+	slices.Sort(buckets)
+
+	for _, b := range buckets {
+		if shard.mem.bytes <= s.maxShardBytes {
+			return
+		}
+		keys := shard.wheel[b]
+		n := 0
+		for _, k := range keys {
+			entry, ok := shard.entries[k]
+			if !ok || entry.ExpiresAt.IsZero() || s.bucket(entry) != b {
+				// Stale reference, the key is indexed elsewhere if at all
+				continue
+			}
+			if k == keep || shard.mem.bytes <= s.maxShardBytes {
+				keys[n] = k
+				n++
+				continue
+			}
+			s.remove(shard, k, entry)
+			shard.mem.evicted++
+		}
+		if n == 0 {
+			delete(shard.wheel, b)
+		} else {
+			shard.wheel[b] = keys[:n]
+		}
+	}
+
+	for k, entry := range shard.entries {
+		if shard.mem.bytes <= s.maxShardBytes {
+			return
+		}
+		if k != keep && entry.ExpiresAt.IsZero() {
+			s.remove(shard, k, entry)
+			shard.mem.evicted++
+		}
+	}
+}
+
+// bucket returns the expiry bucket of an entry with a TTL.
+func (s *memoryCore[V]) bucket(entry typedEntry[V]) int64 {
+	return entry.ExpiresAt.UnixNano() / s.bucketWidth
+}
+
+// entrySize returns the approximate memory held by an entry, counting its
+// key once in the map and once in the expiry index.
+func (s *memoryCore[V]) entrySize(k internalKey, value V) int64 {
+	return s.slotBytes + s.refBytes + int64(len(k.ns)+len(k.key)) + valueSize(value)
+}
+
+// valueSize returns the memory referenced by value, beyond the entry itself.
+func valueSize[V any](value V) int64 {
+	switch v := any(value).(type) {
+	case []byte:
+		return int64(cap(v))
+	case string:
+		return int64(len(v))
+	case Sizer:
+		return int64(v.Size())
+	}
+	return 0
 }
 
 // getShard returns the shard for the given key.
-func (s *MemoryStore) getShard(k internalKey) *shard {
+func (s *memoryCore[V]) getShard(k internalKey) *shard[V] {
 	var idx uint64
 	if k.ns == "" {
 		// Fast path for no namespace: avoid extra hashing and rotation
@@ -380,5 +612,84 @@ func (s *MemoryStore) getShard(k internalKey) *shard {
 		h2 := maphash.String(s.seed, k.key)
 		idx = bits.RotateLeft64(h1, 32) ^ h2
 	}
-	return s.shards[idx%shardCount]
+	return s.shards[idx&s.shardMask]
+}
+
+// ContentionStats reports lock contention of a MemoryStore.
+type ContentionStats struct {
+	// Shards is the number of shards.
+	Shards int
+	// Contended is the number of lock acquisitions that had to wait.
+	Contended uint64
+	// PerShard is Contended broken down by shard. A few hot shards point
+	// to skewed keys rather than too few shards.
+	PerShard []uint64
+}
+
+// ContentionStats returns the lock contention counters since the store
+// was created. Only contended acquisitions are counted, so the counters are
+// cheap enough to stay enabled.
+func (s *memoryCore[V]) ContentionStats() ContentionStats {
+	stats := ContentionStats{
+		Shards:   len(s.shards),
+		PerShard: make([]uint64, len(s.shards)),
+	}
+	for i, shard := range s.shards {
+		n := shard.contended.Load()
+		stats.PerShard[i] = n
+		stats.Contended += n
+	}
+	return stats
+}
+
+// MemoryStats reports the memory used by a MemoryStore, for capacity
+// planning.
+type MemoryStats struct {
+	// Entries is the number of entries, including expired entries that have
+	// not been cleaned up yet.
+	Entries int `json:"entries"`
+	// IndexRefs is the number of expiry index references, including stale
+	// references left by TTL changes until the next cleanup.
+	IndexRefs int `json:"index_refs"`
+
+	// Byte estimates, only reported when TrackMemory or MaxMemoryBytes is
+	// set. Values count as the memory they reference: the length of []byte
+	// and string values and the Size of Sizer values (limiter state).
+	KeyBytes      int64 `json:"key_bytes"`
+	ValueBytes    int64 `json:"value_bytes"`
+	OverheadBytes int64 `json:"overhead_bytes"` // Map slots, entry headers and expiry index
+	TotalBytes    int64 `json:"total_bytes"`
+
+	// Counters since the store was created. Every inserted entry is an
+	// allocation that expired and evicted entries hand back to the garbage
+	// collector, so their rates show the GC pressure caused by the store.
+	Inserted      uint64 `json:"inserted"`
+	InsertedBytes uint64 `json:"inserted_bytes"` // Only counted when memory is tracked
+	Expired       uint64 `json:"expired"`
+	Evicted       uint64 `json:"evicted"` // Evictions to stay under MaxMemoryBytes
+}
+
+// MemoryStats returns the memory usage of the store. It locks every shard
+// in turn, so avoid calling it on every request.
+func (s *memoryCore[V]) MemoryStats() MemoryStats {
+	var stats MemoryStats
+	for _, shard := range s.shards {
+		shard.rlock()
+		stats.Entries += len(shard.entries)
+		for _, keys := range shard.wheel {
+			stats.IndexRefs += len(keys)
+		}
+		stats.KeyBytes += shard.mem.keyBytes
+		stats.ValueBytes += shard.mem.valueBytes
+		stats.Inserted += shard.mem.inserted
+		stats.InsertedBytes += shard.mem.insertedBytes
+		stats.Expired += shard.mem.expired
+		stats.Evicted += shard.mem.evicted
+		shard.mu.RUnlock()
+	}
+	if s.trackMemory {
+		stats.OverheadBytes = int64(stats.Entries)*s.slotBytes + int64(stats.IndexRefs)*s.refBytes
+		stats.TotalBytes = stats.KeyBytes + stats.ValueBytes + stats.OverheadBytes
+	}
+	return stats
 }
@@ -1,9 +1,12 @@
 package store
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 func TestMemoryStore_SetAndGet(t *testing.T) {
@@ -289,3 +292,283 @@ func TestEntry_IsExpired(t *testing.T) {
 		t.Error("Entry with past ExpiresAt should be expired")
 	}
 }
+
+func TestMemoryStore_Shutdown(t *testing.T) {
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{CleanupInterval: time.Millisecond})
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	select {
+	case <-s.doneChan:
+	default:
+		t.Error("Expected cleanup routine to have exited")
+	}
+
+	// Still usable and idempotent
+	if err := s.Set("key", 1, 0); err != nil {
+		t.Errorf("Set after Shutdown failed: %v", err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Second Shutdown failed: %v", err)
+	}
+}
+
+func TestMemoryStore_ShardCount(t *testing.T) {
+	tests := []struct {
+		shards int
+		want   int
+	}{
+		{0, defaultShardCount},
+		{1, 1},
+		{3, 4},
+		{64, 64},
+		{1000, 1024},
+		{1 << 30, maxShardCount},
+	}
+
+	for _, tt := range tests {
+		s := NewMemoryStoreWithConfig(MemoryStoreConfig{Shards: tt.shards})
+		if got := len(s.shards); got != tt.want {
+			t.Errorf("Shards %d: expected %d shards, got %d", tt.shards, tt.want, got)
+		}
+		if got := s.ContentionStats().Shards; got != tt.want {
+			t.Errorf("Shards %d: ContentionStats reports %d shards", tt.shards, got)
+		}
+		s.Close()
+	}
+}
+
+func TestMemoryStore_SingleShard(t *testing.T) {
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{Shards: 1, MaxEntries: 2})
+	defer s.Close()
+
+	s.Set("a", 1, 0)
+	s.SetWithNamespace("ns", "b", 2, 0)
+	if err := s.Set("c", 3, 0); err != ErrStoreFull {
+		t.Errorf("Expected ErrStoreFull with MaxEntries 2, got %v", err)
+	}
+	if v, ok := s.GetWithNamespace("ns", "b"); !ok || v != 2 {
+		t.Errorf("Expected 2, got %v, %v", v, ok)
+	}
+}
+
+func TestMemoryStore_ContentionStats(t *testing.T) {
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{Shards: 1})
+	defer s.Close()
+
+	if got := s.ContentionStats().Contended; got != 0 {
+		t.Fatalf("Expected no contention on a fresh store, got %d", got)
+	}
+
+	// Hold the only shard so that Set has to wait
+	s.shards[0].mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		s.Set("k", 1, 0)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for s.ContentionStats().Contended == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected contention to be counted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.shards[0].mu.Unlock()
+	<-done
+
+	stats := s.ContentionStats()
+	if stats.Contended != 1 || stats.PerShard[0] != 1 {
+		t.Errorf("Expected 1 contended acquisition, got %+v", stats)
+	}
+}
+
+func TestMemoryStore_CleanupExpiryBuckets(t *testing.T) {
+	// A long interval keeps the background cleanup out of the way
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{CleanupInterval: time.Hour, Shards: 1})
+	defer s.Close()
+
+	past := time.Now().Add(-3 * time.Hour)
+	s.SetAt("expired", 1, time.Minute, past)
+	s.SetAt("refreshed", 2, time.Minute, past)
+	s.Set("refreshed", 3, 2*time.Hour) // Moves to a future bucket
+	s.Set("forever", 4, 0)
+
+	s.cleanup()
+
+	if _, ok := s.shards[0].entries[internalKey{key: "expired"}]; ok {
+		t.Error("Expected expired entry to be removed")
+	}
+	if v, ok := s.Get("refreshed"); !ok || v != 3 {
+		t.Errorf("Expected refreshed entry to survive, got %v, %v", v, ok)
+	}
+	if _, ok := s.Get("forever"); !ok {
+		t.Error("Expected entry without TTL to survive")
+	}
+	if n := len(s.shards[0].wheel); n != 1 {
+		t.Errorf("Expected only the future bucket to remain, got %d buckets", n)
+	}
+}
+
+func TestMemoryStore_ExpiryIndexDoesNotGrowOnRefresh(t *testing.T) {
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{CleanupInterval: time.Hour, Shards: 1})
+	defer s.Close()
+
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 100; i++ {
+		// Same bucket every time, as with a limiter refreshing its TTL
+		s.SetAt("k", i, time.Minute, now.Add(time.Duration(i)*time.Second))
+	}
+
+	refs := 0
+	for _, keys := range s.shards[0].wheel {
+		refs += len(keys)
+	}
+	if refs != 1 {
+		t.Errorf("Expected 1 index reference, got %d", refs)
+	}
+}
+
+func TestMemoryStore_RestoreSnapshotIndexesExpiry(t *testing.T) {
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{CleanupInterval: time.Hour, Shards: 1})
+	defer s.Close()
+
+	if err := s.restoreEntry(internalKey{key: "k"}, Entry{Value: []byte{1}, ExpiresAt: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatalf("restoreEntry failed: %v", err)
+	}
+	s.cleanup()
+	if s.Len() != 0 {
+		t.Errorf("Expected restored expired entry to be cleaned up, got %d entries", s.Len())
+	}
+}
+
+func TestMemoryStore_MaxMemoryBytes(t *testing.T) {
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{CleanupInterval: time.Hour, Shards: 1, MaxMemoryBytes: 4096})
+	defer s.Close()
+
+	now := time.Now()
+	value := make([]byte, 100)
+	for i := 0; i < 100; i++ {
+		// Later keys expire later
+		if err := s.SetAt(fmt.Sprintf("key-%d", i), value, time.Duration(i+1)*time.Hour, now); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	if b := s.shards[0].mem.bytes; b > 4096 {
+		t.Errorf("Expected at most 4096 bytes, got %d", b)
+	}
+	n := s.Len()
+	if n == 0 || n == 100 {
+		t.Fatalf("Expected some entries to be evicted, got %d entries", n)
+	}
+	// The entries closest to expiration were evicted
+	if _, ok := s.Get("key-0"); ok {
+		t.Error("Expected earliest expiring entry to be evicted")
+	}
+	if _, ok := s.Get("key-99"); !ok {
+		t.Error("Expected latest entry to be kept")
+	}
+}
+
+func TestMemoryStore_MaxMemoryBytesAccounting(t *testing.T) {
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{Shards: 1, MaxMemoryBytes: 1 << 20})
+	defer s.Close()
+
+	s.Set("k", make([]byte, 1000), time.Minute)
+	withLarge := s.shards[0].mem.bytes
+	s.Set("k", make([]byte, 10), time.Minute)
+	if b := s.shards[0].mem.bytes; b != withLarge-990 {
+		t.Errorf("Expected overwrite to release 990 bytes, got %d then %d", withLarge, b)
+	}
+
+	s.Delete("k")
+	if b := s.shards[0].mem.bytes; b != 0 {
+		t.Errorf("Expected 0 bytes after delete, got %d", b)
+	}
+
+	s.SetAt("k", "value", time.Minute, time.Now().Add(-time.Hour))
+	s.cleanup()
+	if b := s.shards[0].mem.bytes; b != 0 {
+		t.Errorf("Expected 0 bytes after cleanup, got %d", b)
+	}
+}
+
+func TestMemoryStore_MaxMemoryBytesEvictsEntriesWithoutTTLLast(t *testing.T) {
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{Shards: 1, MaxMemoryBytes: 1000})
+	defer s.Close()
+
+	s.Set("forever", make([]byte, 300), 0)
+	s.Set("ttl", make([]byte, 300), time.Hour)
+	s.Set("new", make([]byte, 300), time.Hour)
+
+	if _, ok := s.Get("forever"); !ok {
+		t.Error("Expected entry without TTL to be kept")
+	}
+	if _, ok := s.Get("ttl"); ok {
+		t.Error("Expected entry with TTL to be evicted first")
+	}
+
+	// A value larger than the budget evicts everything else but is stored
+	if err := s.Set("huge", make([]byte, 2000), 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if s.Len() != 1 {
+		t.Errorf("Expected only the new entry, got %d entries", s.Len())
+	}
+}
+
+func TestMemoryStore_MemoryStats(t *testing.T) {
+	s := NewMemoryStoreWithConfig(MemoryStoreConfig{CleanupInterval: time.Hour, TrackMemory: true})
+	defer s.Close()
+
+	s.SetWithNamespace("ns", "key", make([]byte, 100), time.Minute)
+	s.Set("other", "value", 0)
+	s.SetAt("old", []byte{1}, time.Minute, time.Now().Add(-time.Hour))
+	s.cleanup()
+
+	stats := s.MemoryStats()
+	if stats.Entries != 2 || stats.IndexRefs != 1 {
+		t.Errorf("Expected 2 entries and 1 index reference, got %+v", stats)
+	}
+	if stats.KeyBytes != int64(len("nskey")+len("other")) {
+		t.Errorf("Expected %d key bytes, got %d", len("nskey")+len("other"), stats.KeyBytes)
+	}
+	if stats.ValueBytes != 100+int64(len("value")) {
+		t.Errorf("Expected %d value bytes, got %d", 100+len("value"), stats.ValueBytes)
+	}
+	if stats.OverheadBytes <= 0 || stats.TotalBytes != stats.KeyBytes+stats.ValueBytes+stats.OverheadBytes {
+		t.Errorf("Inconsistent byte estimates: %+v", stats)
+	}
+	if stats.Inserted != 3 || stats.Expired != 1 || stats.InsertedBytes == 0 {
+		t.Errorf("Unexpected counters: %+v", stats)
+	}
+}
+
+func TestMemoryStore_SlotSizes(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("Slot sizes are those of 64-bit platforms")
+	}
+	if got := unsafe.Sizeof(internalKey{}); got != keySlotBytes {
+		t.Errorf("Expected keySlotBytes to be %d", got)
+	}
+	if got := unsafe.Sizeof(typedEntry[interface{}]{}); got != entrySlotBytes {
+		t.Errorf("Expected entrySlotBytes to be %d", got)
+	}
+}
+
+func TestMemoryStore_MemoryStatsUntracked(t *testing.T) {
+	s := NewMemoryStore()
+	defer s.Close()
+
+	s.Set("k", make([]byte, 100), time.Minute)
+	stats := s.MemoryStats()
+	if stats.Entries != 1 || stats.Inserted != 1 {
+		t.Errorf("Expected counts without tracking, got %+v", stats)
+	}
+	if stats.TotalBytes != 0 || stats.ValueBytes != 0 {
+		t.Errorf("Expected no byte estimates without tracking, got %+v", stats)
+	}
+}
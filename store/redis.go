@@ -0,0 +1,379 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// RedisClient is the subset of Redis commands used by RedisStore.
+// It keeps this module free of a Redis client dependency, and lets the
+// client handle the deployment: a single node, a Cluster (with go-redis, a
+// ClusterClient, and RedisStoreConfig.HashTag) or Sentinel failover (a
+// FailoverClient, which follows the promoted primary; retry the errors of a
+// failover with ratelimiter.Config.StoreRetries). A typical adapter around
+// github.com/redis/go-redis/v9, whose UniversalClient covers all three,
+// looks like:
+//
+//	func (a adapter) Get(ctx context.Context, key string) ([]byte, bool, error) {
+//		b, err := a.rdb.Get(ctx, key).Bytes()
+//		if errors.Is(err, redis.Nil) {
+//			return nil, false, nil
+//		}
+//		return b, err == nil, err
+//	}
+//
+//	func (a adapter) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+//		return a.rdb.Set(ctx, key, value, ttl).Err()
+//	}
+//
+//	func (a adapter) Del(ctx context.Context, key string) error {
+//		return a.rdb.Del(ctx, key).Err()
+//	}
+//
+//	func (a adapter) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return redis.NewScript(script).Run(ctx, a.rdb, keys, args...).Result()
+//	}
+//
+//	func (a adapter) EvalPipeline(ctx context.Context, calls []store.ScriptCall) []store.ScriptResult {
+//		pipe := a.rdb.Pipeline()
+//		cmds := make([]*redis.Cmd, len(calls))
+//		for i, c := range calls {
+//			cmds[i] = pipe.Eval(ctx, c.Script, c.Keys, c.Args...)
+//		}
+//		_, _ = pipe.Exec(ctx)
+//		results := make([]store.ScriptResult, len(calls))
+//		for i, cmd := range cmds {
+//			results[i].Reply, results[i].Err = cmd.Result()
+//		}
+//		return results
+//	}
+type RedisClient interface {
+	// Get returns the value of key and whether it exists.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set stores value under key. If ttl is positive, the key expires after
+	// it (SET key value PX ttl).
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Del removes key.
+	Del(ctx context.Context, key string) error
+
+	// Eval runs a Lua script atomically (EVALSHA, falling back to EVAL) and
+	// returns its reply: integer replies as int64, arrays as []interface{}.
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// RedisPipeliner is implemented by Redis clients that can send several
+// scripts in one round trip, e.g. with a go-redis Pipeline (which a
+// ClusterClient splits by node). RedisStore.EvalBatch uses it if available.
+type RedisPipeliner interface {
+	// EvalPipeline runs calls in one round trip and returns their results
+	// in the same order.
+	EvalPipeline(ctx context.Context, calls []ScriptCall) []ScriptResult
+}
+
+// RedisStoreConfig holds configuration for RedisStore.
+type RedisStoreConfig struct {
+	// Prefix is prepended to every key.
+	// Default is "ratelimiter:".
+	Prefix string
+	// Codec encodes limiter state. Default is BinaryCodec.
+	Codec Codec
+	// Timeout bounds each Redis command.
+	// Default is 1 second.
+	Timeout time.Duration
+	// MaxKeySize is the maximum length of a key in bytes.
+	// Default is 4096.
+	MaxKeySize int
+	// Replica serves the reads of the store returned by Replica, e.g. a
+	// client of the replicas of a Redis primary or cluster (with go-redis,
+	// a ClusterClient with ReadOnly set). Its Eval only runs read-only
+	// scripts; adapters may use EVAL_RO.
+	// Default is none: Replica reads from the primary.
+	Replica RedisClient
+	// HashTag wraps keys in a Redis Cluster hash tag, "<prefix>{<key>}",
+	// so that the state of a key and the auxiliary keys of its scripts
+	// (Eval keys extending the first one, "<prefix>{<key>}<suffix>") map
+	// to one slot. Required with Cluster for scripts using several keys.
+	// Default is false.
+	HashTag bool
+	// Schema is the layout of the state of the limiters running scripts,
+	// e.g. RedisSchemaSortedSetMillis to share limits with limiters written
+	// in other languages.
+	// Default is RedisSchemaNative.
+	Schema RedisSchema
+}
+
+// RedisSchema is the key and field layout of the state that limiters keep in
+// Redis with scripts, see RedisStoreConfig.Schema.
+type RedisSchema string
+
+const (
+	// RedisSchemaNative keeps a sliding window log in a sorted set under
+	// "<prefix><namespace>:<key>" (namespace "swl" by default), scored by
+	// request time in Unix microseconds.
+	RedisSchemaNative RedisSchema = "native"
+
+	// RedisSchemaSortedSetMillis keeps a sliding window log in a sorted set
+	// under "<prefix><key>", scored by request time in Unix milliseconds,
+	// with members starting with the score ("<ms>-<unique id>") and
+	// expiring a window after the last request. It is the layout of the
+	// sorted set sliding logs of other languages (ZREMRANGEBYSCORE, ZCARD,
+	// ZADD and PEXPIRE on milliseconds, as in most Python and Node.js
+	// implementations): with the same prefix and keys, they enforce one
+	// shared limit. Keys have no namespace, so limiters with different
+	// limits need stores with different prefixes.
+	RedisSchemaSortedSetMillis RedisSchema = "sorted_set_ms"
+)
+
+// SchemaStore is implemented by script stores whose state layout is
+// configurable, such as RedisStore.
+type SchemaStore interface {
+	// Schema returns the layout of the state of limiters running scripts.
+	Schema() RedisSchema
+}
+
+// RedisStore is a Store backed by Redis. Values are encoded with the
+// configured codec and expire with Redis TTLs, with millisecond precision.
+//
+// Get and Set are separate round trips, so instances sharing the store may
+// both admit a request between them. Limiters needing exact limits across
+// instances run scripts with Eval instead (see algorithms.SlidingWindowLog).
+type RedisStore struct {
+	client     RedisClient
+	replica    RedisClient
+	prefix     string
+	hashTag    bool
+	schema     RedisSchema
+	codec      Codec
+	timeout    time.Duration
+	maxKeySize int
+}
+
+// NewRedisStore creates a new Redis-backed store.
+// The client is owned by the caller; Close does not close it.
+func NewRedisStore(client RedisClient, config RedisStoreConfig) *RedisStore {
+	if config.Prefix == "" {
+		config.Prefix = "ratelimiter:"
+	}
+	if config.Codec == nil {
+		config.Codec = BinaryCodec
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+	if config.MaxKeySize <= 0 {
+		config.MaxKeySize = 4096
+	}
+	if config.Schema == "" {
+		config.Schema = RedisSchemaNative
+	}
+
+	return &RedisStore{
+		client:     client,
+		replica:    config.Replica,
+		prefix:     config.Prefix,
+		hashTag:    config.HashTag,
+		schema:     config.Schema,
+		codec:      config.Codec,
+		timeout:    config.Timeout,
+		maxKeySize: config.MaxKeySize,
+	}
+}
+
+// Get retrieves a value from the store.
+// Errors from Redis or the codec are reported as a missing key.
+func (s *RedisStore) Get(key string) (interface{}, bool) {
+	val, ok, _ := s.GetContext(context.Background(), key)
+	return val, ok
+}
+
+// GetContext retrieves a value from the store, bounded by ctx and the
+// configured timeout. Values that cannot be decoded are reported as missing.
+func (s *RedisStore) GetContext(ctx context.Context, key string) (interface{}, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	data, ok, err := s.client.Get(ctx, s.redisKey(key))
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	val, err := s.codec.Unmarshal(data)
+	if err != nil {
+		return nil, false, nil
+	}
+	return val, true, nil
+}
+
+// Set stores a value with an optional TTL.
+func (s *RedisStore) Set(key string, value interface{}, ttl time.Duration) error {
+	return s.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext stores a value with an optional TTL, bounded by ctx and the
+// configured timeout.
+func (s *RedisStore) SetContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if len(key) > s.maxKeySize {
+		return ErrKeyTooLong
+	}
+
+	data, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.client.Set(ctx, s.redisKey(key), data, ttl)
+}
+
+// Delete removes a value from the store.
+func (s *RedisStore) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext removes a value from the store, bounded by ctx and the
+// configured timeout.
+func (s *RedisStore) DeleteContext(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.client.Del(ctx, s.redisKey(key))
+}
+
+// Eval runs a Lua script on the given store keys, mapped like those of Get
+// and Set, bounded by ctx and the configured timeout.
+func (s *RedisStore) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	redisKeys, err := s.scriptKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.client.Eval(ctx, script, redisKeys, args...)
+}
+
+// EvalBatch runs Lua scripts in one round trip if the client implements
+// RedisPipeliner, and one after the other otherwise, bounded by ctx and the
+// configured timeout.
+func (s *RedisStore) EvalBatch(ctx context.Context, calls []ScriptCall) []ScriptResult {
+	results := make([]ScriptResult, len(calls))
+	mapped := make([]ScriptCall, 0, len(calls))
+	index := make([]int, 0, len(calls)) // Index of each mapped call in calls
+	for i, call := range calls {
+		keys, err := s.scriptKeys(call.Keys)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		mapped = append(mapped, ScriptCall{Script: call.Script, Keys: keys, Args: call.Args})
+		index = append(index, i)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if p, ok := s.client.(RedisPipeliner); ok && len(mapped) > 0 {
+		for i, result := range p.EvalPipeline(ctx, mapped) {
+			results[index[i]] = result
+		}
+		return results
+	}
+	for i, call := range mapped {
+		r := &results[index[i]]
+		r.Reply, r.Err = s.client.Eval(ctx, call.Script, call.Keys, call.Args...)
+	}
+	return results
+}
+
+// Schema returns the layout of the state of limiters running scripts.
+func (s *RedisStore) Schema() RedisSchema {
+	return s.schema
+}
+
+// redisKey returns the Redis key of a store key.
+func (s *RedisStore) redisKey(key string) string {
+	if s.hashTag {
+		return s.prefix + "{" + key + "}"
+	}
+	return s.prefix + key
+}
+
+// scriptKeys returns the Redis keys of the keys of a script. With HashTag,
+// keys extending the first one share its hash tag.
+func (s *RedisStore) scriptKeys(keys []string) ([]string, error) {
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		if len(key) > s.maxKeySize {
+			return nil, ErrKeyTooLong
+		}
+		if s.hashTag && i > 0 && strings.HasPrefix(key, keys[0]) {
+			redisKeys[i] = redisKeys[0] + key[len(keys[0]):]
+			continue
+		}
+		redisKeys[i] = s.redisKey(key)
+	}
+	return redisKeys, nil
+}
+
+// Replica returns a store reading keys and running scripts on the Replica
+// client and writing to the primary, or s if no Replica client is set.
+// Replication is asynchronous: reads may miss the latest writes, so limiters
+// checking requests on the replica would admit more than their limit (see
+// algorithms.WithReplicaReads).
+func (s *RedisStore) Replica() Store {
+	if s.replica == nil {
+		return s
+	}
+	r := *s
+	r.client = replicaClient{RedisClient: s.client, replica: s.replica}
+	return &r
+}
+
+// replicaClient sends reads to a replica and writes to the primary.
+type replicaClient struct {
+	RedisClient // Primary
+	replica     RedisClient
+}
+
+// Get reads key from the replica.
+func (c replicaClient) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return c.replica.Get(ctx, key)
+}
+
+// Eval runs a read-only script on the replica.
+func (c replicaClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.replica.Eval(ctx, script, keys, args...)
+}
+
+// EvalPipeline runs read-only scripts on the replica, in a single round trip
+// if the replica implements RedisPipeliner.
+func (c replicaClient) EvalPipeline(ctx context.Context, calls []ScriptCall) []ScriptResult {
+	if p, ok := c.replica.(RedisPipeliner); ok {
+		return p.EvalPipeline(ctx, calls)
+	}
+	results := make([]ScriptResult, len(calls))
+	for i, call := range calls {
+		results[i].Reply, results[i].Err = c.replica.Eval(ctx, call.Script, call.Keys, call.Args...)
+	}
+	return results
+}
+
+// Ping checks that Redis is reachable by reading a key under the prefix.
+func (s *RedisStore) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, _, err := s.client.Get(ctx, s.prefix+"ping")
+	return err
+}
+
+// Close is a no-op; the Redis client is owned by the caller.
+func (s *RedisStore) Close() error {
+	return nil
+}
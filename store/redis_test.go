@@ -0,0 +1,289 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-memory RedisClient recording TTLs and script calls.
+type fakeRedis struct {
+	mu       sync.Mutex
+	data     map[string][]byte
+	ttls     map[string]time.Duration
+	evalKeys []string
+	err      error
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{data: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, false, f.err
+	}
+	v, ok := f.data[key]
+	return v, ok, nil
+}
+
+func (f *fakeRedis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return errors.New("missing deadline")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.data[key] = value
+	f.ttls[key] = ttl
+	return nil
+}
+
+func (f *fakeRedis) Del(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.data, key)
+	return nil
+}
+
+func (f *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.evalKeys = keys
+	return int64(len(args)), nil
+}
+
+func TestRedisStore_Basic(t *testing.T) {
+	client := newFakeRedis()
+	s := NewRedisStore(client, RedisStoreConfig{Codec: JSONCodec})
+	defer s.Close()
+
+	if _, ok := s.Get("key"); ok {
+		t.Error("Expected missing key")
+	}
+
+	if err := s.Set("key", map[string]int{"v": 1}, 1500*time.Millisecond); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, ok := client.data["ratelimiter:key"]; !ok {
+		t.Error("Expected default prefix on stored key")
+	}
+	if got := client.ttls["ratelimiter:key"]; got != 1500*time.Millisecond {
+		t.Errorf("Expected TTL 1.5s, got %v", got)
+	}
+
+	val, ok := s.Get("key")
+	if !ok {
+		t.Fatal("Expected key to exist")
+	}
+	if string(val.([]byte)) != `{"v":1}` {
+		t.Errorf("Unexpected value %s", val)
+	}
+
+	if err := s.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok := s.Get("key"); ok {
+		t.Error("Expected key to be deleted")
+	}
+}
+
+func TestRedisStore_Errors(t *testing.T) {
+	client := newFakeRedis()
+	s := NewRedisStore(client, RedisStoreConfig{Prefix: "rl:", Codec: JSONCodec, MaxKeySize: 8})
+
+	if err := s.Set(strings.Repeat("k", 9), 1, 0); !errors.Is(err, ErrKeyTooLong) {
+		t.Errorf("Expected ErrKeyTooLong, got %v", err)
+	}
+	if _, err := s.Eval(context.Background(), "", []string{strings.Repeat("k", 9)}); !errors.Is(err, ErrKeyTooLong) {
+		t.Errorf("Expected ErrKeyTooLong from Eval, got %v", err)
+	}
+
+	client.err = errors.New("redis unavailable")
+	if _, ok := s.Get("key"); ok {
+		t.Error("Expected Get to report missing key on error")
+	}
+	if err := s.Set("key", 1, 0); err == nil {
+		t.Error("Expected Set to return client error")
+	}
+	if _, err := s.Eval(context.Background(), "", []string{"key"}); err == nil {
+		t.Error("Expected Eval to return client error")
+	}
+}
+
+func TestRedisStore_Eval(t *testing.T) {
+	client := newFakeRedis()
+	var s ScriptStore = NewRedisStore(client, RedisStoreConfig{Prefix: "rl:"})
+
+	reply, err := s.Eval(context.Background(), "return #ARGV", []string{"a", "b"}, 1, "x")
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if reply != int64(2) {
+		t.Errorf("Expected the client reply, got %v", reply)
+	}
+	if len(client.evalKeys) != 2 || client.evalKeys[0] != "rl:a" || client.evalKeys[1] != "rl:b" {
+		t.Errorf("Expected prefixed keys, got %v", client.evalKeys)
+	}
+}
+
+func TestRedisStore_Ping(t *testing.T) {
+	client := newFakeRedis()
+	s := NewRedisStore(client, RedisStoreConfig{})
+
+	if err := Ping(context.Background(), s); err != nil {
+		t.Errorf("Expected reachable store, got %v", err)
+	}
+	client.err = errors.New("redis unavailable")
+	if err := Ping(context.Background(), s); err == nil {
+		t.Error("Expected Ping to report the client error")
+	}
+}
+
+func TestRedisStore_GetContextReportsErrors(t *testing.T) {
+	client := newFakeRedis()
+	var s ContextStore = NewRedisStore(client, RedisStoreConfig{Codec: JSONCodec})
+
+	if _, ok, err := s.GetContext(context.Background(), "key"); ok || err != nil {
+		t.Errorf("Expected a plain miss, got %v, %v", ok, err)
+	}
+	client.err = errors.New("redis unavailable")
+	if _, _, err := s.GetContext(context.Background(), "key"); err == nil {
+		t.Error("Expected GetContext to return the client error")
+	}
+}
+
+func TestRedisStore_Replica(t *testing.T) {
+	primary, replica := newFakeRedis(), newFakeRedis()
+	s := NewRedisStore(primary, RedisStoreConfig{Codec: JSONCodec, Replica: replica})
+
+	var rr ReplicaReader = s
+	r := rr.Replica()
+	if err := r.Set("key", 1, 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, ok := primary.data["ratelimiter:key"]; !ok {
+		t.Error("Expected writes to go to the primary")
+	}
+	if _, ok := r.Get("key"); ok {
+		t.Error("Expected reads from the replica, which has not received the write")
+	}
+	if _, err := r.(ScriptStore).Eval(context.Background(), "", []string{"key"}); err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if len(replica.evalKeys) != 1 || len(primary.evalKeys) != 0 {
+		t.Errorf("Expected scripts to run on the replica, got %v and %v", replica.evalKeys, primary.evalKeys)
+	}
+	if _, ok := s.Get("key"); !ok {
+		t.Error("Expected the store itself to read from the primary")
+	}
+
+	if got := NewRedisStore(primary, RedisStoreConfig{}); got.Replica() != Store(got) {
+		t.Error("Expected a store without Replica client to be its own replica")
+	}
+}
+
+func TestRedisStore_Schema(t *testing.T) {
+	var s SchemaStore = NewRedisStore(newFakeRedis(), RedisStoreConfig{})
+	if got := s.Schema(); got != RedisSchemaNative {
+		t.Errorf("Expected the native schema by default, got %q", got)
+	}
+
+	r := NewRedisStore(newFakeRedis(), RedisStoreConfig{Schema: RedisSchemaSortedSetMillis, Replica: newFakeRedis()}).Replica()
+	if got := r.(SchemaStore).Schema(); got != RedisSchemaSortedSetMillis {
+		t.Errorf("Expected the replica to keep the schema, got %q", got)
+	}
+}
+
+// pipeliningRedis is a fakeRedis counting the round trips of pipelines.
+type pipeliningRedis struct {
+	*fakeRedis
+	pipelines int
+}
+
+func (p *pipeliningRedis) EvalPipeline(ctx context.Context, calls []ScriptCall) []ScriptResult {
+	p.pipelines++
+	results := make([]ScriptResult, len(calls))
+	for i, c := range calls {
+		results[i].Reply, results[i].Err = p.Eval(ctx, c.Script, c.Keys, c.Args...)
+	}
+	return results
+}
+
+func TestRedisStore_HashTag(t *testing.T) {
+	client := newFakeRedis()
+	s := NewRedisStore(client, RedisStoreConfig{Codec: JSONCodec, HashTag: true})
+
+	if err := s.Set("tb:user", 1, 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, ok := client.data["ratelimiter:{tb:user}"]; !ok {
+		t.Errorf("Expected a hash tagged key, got %v", client.data)
+	}
+	if _, ok := s.Get("tb:user"); !ok {
+		t.Error("Expected Get to read the hash tagged key")
+	}
+
+	if _, err := s.Eval(context.Background(), "", []string{"swl:user", "swl:user:seq", "other"}); err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	want := []string{"ratelimiter:{swl:user}", "ratelimiter:{swl:user}:seq", "ratelimiter:{other}"}
+	for i, key := range want {
+		if client.evalKeys[i] != key {
+			t.Errorf("Expected key %d to be %q, got %q", i, key, client.evalKeys[i])
+		}
+	}
+}
+
+func TestRedisStore_EvalBatch(t *testing.T) {
+	calls := []ScriptCall{
+		{Keys: []string{"a"}, Args: []interface{}{1}},
+		{Keys: []string{strings.Repeat("k", 9)}},
+		{Keys: []string{"b"}, Args: []interface{}{1, 2}},
+	}
+	check := func(t *testing.T, results []ScriptResult) {
+		t.Helper()
+		if len(results) != 3 {
+			t.Fatalf("Expected 3 results, got %d", len(results))
+		}
+		if results[0].Reply != int64(1) || results[2].Reply != int64(2) {
+			t.Errorf("Expected the replies in order, got %v and %v", results[0].Reply, results[2].Reply)
+		}
+		if !errors.Is(results[1].Err, ErrKeyTooLong) {
+			t.Errorf("Expected ErrKeyTooLong for the long key, got %v", results[1].Err)
+		}
+	}
+
+	client := &pipeliningRedis{fakeRedis: newFakeRedis()}
+	var s BatchScriptStore = NewRedisStore(client, RedisStoreConfig{MaxKeySize: 8})
+	check(t, s.EvalBatch(context.Background(), calls))
+	if client.pipelines != 1 {
+		t.Errorf("Expected one pipeline, got %d", client.pipelines)
+	}
+
+	// Clients without pipelines run the scripts one after the other
+	s = NewRedisStore(newFakeRedis(), RedisStoreConfig{MaxKeySize: 8})
+	check(t, s.EvalBatch(context.Background(), calls))
+
+	// Batches on the replica are pipelined to the replica
+	primary, replica := newFakeRedis(), &pipeliningRedis{fakeRedis: newFakeRedis()}
+	r := NewRedisStore(primary, RedisStoreConfig{MaxKeySize: 8, Replica: replica}).Replica()
+	check(t, r.(BatchScriptStore).EvalBatch(context.Background(), calls))
+	if replica.pipelines != 1 || len(primary.evalKeys) != 0 {
+		t.Errorf("Expected one pipeline on the replica, got %d and primary keys %v", replica.pipelines, primary.evalKeys)
+	}
+
+	// Replicas without pipelines run the scripts one after the other
+	r = NewRedisStore(primary, RedisStoreConfig{MaxKeySize: 8, Replica: newFakeRedis()}).Replica()
+	check(t, r.(BatchScriptStore).EvalBatch(context.Background(), calls))
+}
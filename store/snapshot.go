@@ -0,0 +1,174 @@
+package store
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// snapshotMagic identifies MemoryStore snapshots; the last byte is the format version.
+var snapshotMagic = []byte{'R', 'L', 'S', 'N', 'A', 'P', 1}
+
+// maxSnapshotField bounds the length of a key or value read from a snapshot.
+const maxSnapshotField = 1 << 20
+
+// ErrInvalidSnapshot is returned when a snapshot is corrupted or has an unknown format.
+var ErrInvalidSnapshot = errors.New("ratelimiter: invalid snapshot")
+
+// Snapshotter is implemented by stores that can dump and reload their content.
+type Snapshotter interface {
+	// Snapshot writes the content of the store to w.
+	Snapshot(w io.Writer) error
+
+	// RestoreSnapshot loads entries previously written by Snapshot.
+	RestoreSnapshot(r io.Reader) error
+}
+
+// Snapshot writes all unexpired entries to w so that they can be reloaded
+// with RestoreSnapshot, for example across a restart.
+//
+// Values are written with their encoding.BinaryMarshaler encoding (limiter
+// state implements it); []byte values are written as is and other values are
+// skipped. Limiter state is mutated in place, so take the snapshot once
+// traffic has stopped, or through the limiter's Snapshot method which holds
+// its locks.
+func (s *MemoryStore) Snapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(snapshotMagic); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var buf []byte
+	for _, shard := range s.shards {
+		shard.rlock()
+		for k, entry := range shard.entries {
+			if entry.IsExpiredAt(now) {
+				continue
+			}
+
+			var value []byte
+			switch v := entry.Value.(type) {
+			case []byte:
+				value = v
+			case encoding.BinaryMarshaler:
+				var err error
+				if value, err = v.MarshalBinary(); err != nil {
+					shard.mu.RUnlock()
+					return err
+				}
+			default:
+				continue
+			}
+
+			var expiresAt int64
+			if !entry.ExpiresAt.IsZero() {
+				expiresAt = entry.ExpiresAt.UnixNano()
+			}
+
+			buf = buf[:0]
+			buf = binary.AppendUvarint(buf, uint64(len(k.ns)))
+			buf = append(buf, k.ns...)
+			buf = binary.AppendUvarint(buf, uint64(len(k.key)))
+			buf = append(buf, k.key...)
+			buf = binary.AppendVarint(buf, expiresAt)
+			buf = binary.AppendUvarint(buf, uint64(len(value)))
+			buf = append(buf, value...)
+			if _, err := bw.Write(buf); err != nil {
+				shard.mu.RUnlock()
+				return err
+			}
+		}
+		shard.mu.RUnlock()
+	}
+
+	return bw.Flush()
+}
+
+// RestoreSnapshot loads the entries written by Snapshot. Entries that have
+// expired since are skipped and existing keys are overwritten. Restored
+// values are kept as []byte and decoded by the algorithms on first use.
+// Entries that exceed MaxKeySize are skipped; ErrStoreFull is returned if the
+// store runs out of capacity.
+func (s *MemoryStore) RestoreSnapshot(r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != string(snapshotMagic) {
+		return ErrInvalidSnapshot
+	}
+
+	now := time.Now()
+	for {
+		ns, err := readSnapshotField(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		key, err := readSnapshotField(br)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		expiresAt, err := binary.ReadVarint(br)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		value, err := readSnapshotField(br)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+
+		entry := Entry{Value: value}
+		if expiresAt != 0 {
+			entry.ExpiresAt = time.Unix(0, expiresAt)
+			if entry.IsExpiredAt(now) {
+				continue
+			}
+		}
+		if len(ns)+len(key) > s.maxKeySize {
+			continue
+		}
+
+		if err := s.restoreEntry(internalKey{ns: string(ns), key: string(key)}, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// restoreEntry stores entry under k, respecting the shard capacity.
+func (s *MemoryStore) restoreEntry(k internalKey, entry Entry) error {
+	shard := s.getShard(k)
+	shard.lock()
+	defer shard.mu.Unlock()
+
+	return s.put(shard, k, typedEntry[interface{}](entry))
+}
+
+// readSnapshotField reads a length-prefixed byte string.
+func readSnapshotField(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSnapshotField {
+		return nil, ErrInvalidSnapshot
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// unexpectedEOF reports a truncated snapshot as ErrInvalidSnapshot.
+func unexpectedEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrInvalidSnapshot
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+type binaryValue string
+
+func (v binaryValue) MarshalBinary() ([]byte, error) {
+	return []byte(v), nil
+}
+
+func TestMemoryStore_Snapshot(t *testing.T) {
+	s := NewMemoryStore()
+	defer s.Close()
+
+	s.SetWithNamespace("tb", "a", binaryValue("state-a"), time.Minute)
+	s.Set("b", []byte("raw"), 0)
+	s.Set("skipped", 42, 0)
+	s.SetAt("expired", []byte("old"), time.Second, time.Now().Add(-time.Hour))
+
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	restored := NewMemoryStore()
+	defer restored.Close()
+	if err := restored.RestoreSnapshot(&buf); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+
+	if restored.Len() != 2 {
+		t.Errorf("Expected 2 restored entries, got %d", restored.Len())
+	}
+	if v, ok := restored.GetWithNamespace("tb", "a"); !ok || string(v.([]byte)) != "state-a" {
+		t.Errorf("Expected marshaled value, got %v, %v", v, ok)
+	}
+	if v, ok := restored.Get("b"); !ok || string(v.([]byte)) != "raw" {
+		t.Errorf("Expected raw value, got %v, %v", v, ok)
+	}
+
+	// TTL is preserved
+	k := internalKey{ns: "tb", key: "a"}
+	entry := restored.getShard(k).entries[k]
+	if entry.ExpiresAt.IsZero() || time.Until(entry.ExpiresAt) > time.Minute {
+		t.Errorf("Expected expiration within a minute, got %v", entry.ExpiresAt)
+	}
+}
+
+func TestMemoryStore_RestoreSnapshotInvalid(t *testing.T) {
+	s := NewMemoryStore()
+	defer s.Close()
+
+	var buf bytes.Buffer
+	src := NewMemoryStore()
+	defer src.Close()
+	src.Set("key", []byte("value"), 0)
+	src.Snapshot(&buf)
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", []byte("NOTASNAPSHOT")},
+		{"truncated", valid[:len(valid)-2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.RestoreSnapshot(bytes.NewReader(tt.data)); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Errorf("Expected ErrInvalidSnapshot, got %v", err)
+			}
+		})
+	}
+}
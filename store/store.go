@@ -2,6 +2,7 @@
 package store
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -14,6 +15,12 @@ var ErrKeyTooLong = errors.New("ratelimiter: key too long")
 
 // Store defines the storage interface for rate limiting data.
 // Implementations must be safe for concurrent use.
+//
+// The limiter state values passed to Set implement encoding.BinaryMarshaler
+// and json.Marshaler with a stable, versioned format. Stores that cannot keep
+// Go values in memory (e.g. Redis) should persist the encoded bytes and return
+// them as a []byte from Get; the algorithms decode them transparently.
+// See Codec for the available wire formats.
 type Store interface {
 	// Get retrieves a value from the store.
 	// Returns the value and true if found, nil and false otherwise.
@@ -30,6 +37,99 @@ type Store interface {
 	Close() error
 }
 
+// ContextStore is implemented by stores whose operations can be bounded by a
+// context, typically remote stores. Unlike Get, GetContext reports backend
+// errors, so that callers can tell a missing key from a failed lookup and
+// retry. The algorithms use it when Config.StoreTimeout or Config.StoreRetries
+// is set.
+type ContextStore interface {
+	Store
+
+	// GetContext retrieves a value from the store.
+	// A missing key is reported as nil, false and a nil error.
+	GetContext(ctx context.Context, key string) (interface{}, bool, error)
+
+	// SetContext stores a value with an optional TTL.
+	SetContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+
+	// DeleteContext removes a value from the store.
+	DeleteContext(ctx context.Context, key string) error
+}
+
+// ScriptStore is implemented by stores that run Lua scripts next to the
+// data, such as RedisStore, so that limiters can check and update the state
+// of a key atomically in one round trip (see algorithms.SlidingWindowLog).
+type ScriptStore interface {
+	Store
+
+	// Eval runs script on keys, mapped to backend keys like those of Get
+	// and Set, and returns its reply: integers as int64, arrays as
+	// []interface{}.
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// ScriptCall is one script run of a batch, see BatchScriptStore.
+type ScriptCall struct {
+	Script string
+	Keys   []string
+	Args   []interface{}
+}
+
+// ScriptResult is the reply of a ScriptCall, or the error that prevented it.
+type ScriptResult struct {
+	Reply interface{}
+	Err   error
+}
+
+// BatchScriptStore is implemented by script stores that can run several
+// scripts in one round trip, such as RedisStore with a pipelining client.
+// The scripts run independently: one failing does not undo the others.
+type BatchScriptStore interface {
+	ScriptStore
+
+	// EvalBatch runs calls and returns their results in the same order.
+	EvalBatch(ctx context.Context, calls []ScriptCall) []ScriptResult
+}
+
+// ReplicaReader is implemented by stores that can serve reads from replicas,
+// such as a RedisStore with a Replica client. Limiters read from the replica
+// only with algorithms.WithReplicaReads.
+type ReplicaReader interface {
+	// Replica returns a store reading keys from replicas and writing them to
+	// the primary. Its reads may lag behind the writes to the primary.
+	Replica() Store
+}
+
+// Shutdowner is implemented by stores that can shut down gracefully.
+type Shutdowner interface {
+	// Shutdown flushes pending writes and stops background goroutines,
+	// waiting until they have exited or ctx is done.
+	Shutdown(ctx context.Context) error
+}
+
+// Pinger is implemented by stores that can check that their backend is reachable.
+type Pinger interface {
+	// Ping returns an error if the store cannot serve requests.
+	Ping(ctx context.Context) error
+}
+
+// Ping checks s if it implements Pinger. Other stores are assumed reachable.
+func Ping(ctx context.Context, s Store) error {
+	if p, ok := s.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts s down if it implements Shutdowner,
+// and closes it otherwise.
+func Shutdown(ctx context.Context, s Store) error {
+	if sd, ok := s.(Shutdowner); ok {
+		return sd.Shutdown(ctx)
+	}
+	return s.Close()
+}
+
 // NamespacedStore extends Store with namespace support to avoid string concatenation allocations.
 type NamespacedStore interface {
 	Store
@@ -0,0 +1,486 @@
+// Package storetest implements a conformance suite for store.Store
+// implementations, in the spirit of testing/fstest.
+//
+// A third-party store (Redis, DynamoDB, ...) can verify that it behaves like
+// the built-in stores with a single test:
+//
+//	func TestRedisStore(t *testing.T) {
+//		storetest.TestStore(t, func() store.Store {
+//			return newTestRedisStore(t)
+//		})
+//	}
+//
+// Optional interfaces (store.NamespacedStore, store.TimeAwareStore,
+// store.TTLStore, ...) are exercised when the store implements them.
+package storetest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+// Config describes the properties of the store under test.
+type Config struct {
+	// TTLResolution is the granularity of expirations in the store, e.g. one
+	// second for stores built on etcd leases. TTL tests wait a few multiples
+	// of it. Default is 10 milliseconds.
+	TTLResolution time.Duration
+
+	// MaxKeySize is the key length limit enforced by the store. When positive,
+	// longer keys must be rejected with store.ErrKeyTooLong. When zero, a
+	// very long key must either be stored or rejected with store.ErrKeyTooLong.
+	MaxKeySize int
+
+	// Capacity is the maximum number of keys of a store returned by the
+	// factory. When positive, the suite fills the store and expects
+	// store.ErrStoreFull. Stores that shard their capacity may accept fewer
+	// keys, but never more than Capacity.
+	Capacity int
+}
+
+// TestStore runs the conformance suite against stores created by newStore.
+// Every subtest uses a fresh store, which is closed when the subtest ends.
+func TestStore(t *testing.T, newStore func() store.Store) {
+	TestStoreWithConfig(t, newStore, Config{})
+}
+
+// TestStoreWithConfig runs the conformance suite with a custom configuration.
+func TestStoreWithConfig(t *testing.T, newStore func() store.Store, config Config) {
+	t.Helper()
+	if config.TTLResolution <= 0 {
+		config.TTLResolution = 10 * time.Millisecond
+	}
+
+	open := func(t *testing.T) store.Store {
+		s := newStore()
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+
+	t.Run("GetSetDelete", func(t *testing.T) { testGetSetDelete(t, open(t)) })
+	t.Run("TTL", func(t *testing.T) { testTTL(t, open(t), config) })
+	t.Run("KeyTooLong", func(t *testing.T) { testKeyTooLong(t, open(t), config) })
+	t.Run("StoreFull", func(t *testing.T) {
+		if config.Capacity <= 0 {
+			t.Skip("Config.Capacity not set")
+		}
+		testStoreFull(t, open(t), config)
+	})
+	t.Run("Namespaces", func(t *testing.T) {
+		s, ok := open(t).(store.NamespacedStore)
+		if !ok {
+			t.Skip("store does not implement store.NamespacedStore")
+		}
+		testNamespaces(t, s)
+	})
+	t.Run("UpdateTTL", func(t *testing.T) {
+		s, ok := open(t).(store.TTLStore)
+		if !ok {
+			t.Skip("store does not implement store.TTLStore")
+		}
+		testUpdateTTL(t, s, config)
+	})
+	t.Run("TimeAware", func(t *testing.T) {
+		s, ok := open(t).(store.TimeAwareStore)
+		if !ok {
+			t.Skip("store does not implement store.TimeAwareStore")
+		}
+		testTimeAware(t, s)
+	})
+	t.Run("NamespacedTimeAware", func(t *testing.T) {
+		s, ok := open(t).(store.NamespacedTimeAwareStore)
+		if !ok {
+			t.Skip("store does not implement store.NamespacedTimeAwareStore")
+		}
+		testNamespacedTimeAware(t, s)
+	})
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, open(t)) })
+	t.Run("Limiters", func(t *testing.T) { testLimiters(t, open) })
+}
+
+// value is the value type written by the suite. It encodes like a token
+// bucket state whose token count is the value, so that it can be stored
+// through any store.Codec.
+type value float64
+
+// MarshalBinary encodes v in the versioned binary state format.
+func (v value) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 2+4*8)
+	b[0] = 'T'
+	b[1] = 1
+	binary.BigEndian.PutUint64(b[2:], math.Float64bits(float64(v)))
+	return b, nil
+}
+
+// MarshalJSON encodes v in the versioned JSON state format.
+func (v value) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"v":1,"type":"token_bucket","tokens":%v,"last_refill":0}`, float64(v))), nil
+}
+
+// decode returns the value of a Get result: either a value stored as is,
+// or its binary or JSON encoding returned by a remote store.
+func decode(got interface{}) (value, bool) {
+	switch v := got.(type) {
+	case value:
+		return v, true
+	case *value:
+		return *v, true
+	case []byte:
+		if len(v) == 2+4*8 && v[0] == 'T' {
+			return value(math.Float64frombits(binary.BigEndian.Uint64(v[2:]))), true
+		}
+		var state struct {
+			Tokens float64 `json:"tokens"`
+		}
+		if err := json.Unmarshal(v, &state); err == nil {
+			return value(state.Tokens), true
+		}
+	}
+	return 0, false
+}
+
+// expect checks that key holds want.
+func expect(t *testing.T, got interface{}, found bool, key string, want value) {
+	t.Helper()
+	if !found {
+		t.Errorf("Get(%q): expected %v, key not found", key, want)
+		return
+	}
+	v, ok := decode(got)
+	if !ok {
+		t.Errorf("Get(%q): unexpected value %#v", key, got)
+		return
+	}
+	if v != want {
+		t.Errorf("Get(%q) = %v, want %v", key, v, want)
+	}
+}
+
+// expectMissing checks that key is absent.
+func expectMissing(t *testing.T, got interface{}, found bool, key string) {
+	t.Helper()
+	if found {
+		t.Errorf("Get(%q): expected missing key, got %#v", key, got)
+	}
+}
+
+func testGetSetDelete(t *testing.T, s store.Store) {
+	val, ok := s.Get("missing")
+	expectMissing(t, val, ok, "missing")
+
+	if err := s.Set("key", value(1), 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	val, ok = s.Get("key")
+	expect(t, val, ok, "key", 1)
+
+	// Overwrite
+	if err := s.Set("key", value(2), time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	val, ok = s.Get("key")
+	expect(t, val, ok, "key", 2)
+
+	// Keys are independent
+	if err := s.Set("other", value(3), 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := s.Delete("key"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	val, ok = s.Get("key")
+	expectMissing(t, val, ok, "key")
+	val, ok = s.Get("other")
+	expect(t, val, ok, "other", 3)
+
+	// Deleting a missing key is not an error
+	if err := s.Delete("missing"); err != nil {
+		t.Errorf("Delete of a missing key failed: %v", err)
+	}
+}
+
+func testTTL(t *testing.T, s store.Store, config Config) {
+	res := config.TTLResolution
+
+	if err := s.Set("short", value(1), 2*res); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := s.Set("long", value(2), time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := s.Set("forever", value(3), 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	val, ok := s.Get("short")
+	expect(t, val, ok, "short", 1)
+
+	time.Sleep(4 * res)
+
+	val, ok = s.Get("short")
+	expectMissing(t, val, ok, "short")
+	val, ok = s.Get("long")
+	expect(t, val, ok, "long", 2)
+	val, ok = s.Get("forever")
+	expect(t, val, ok, "forever", 3)
+
+	// An expired key can be written again
+	if err := s.Set("short", value(4), time.Hour); err != nil {
+		t.Fatalf("Set after expiry failed: %v", err)
+	}
+	val, ok = s.Get("short")
+	expect(t, val, ok, "short", 4)
+}
+
+func testKeyTooLong(t *testing.T, s store.Store, config Config) {
+	if config.MaxKeySize <= 0 {
+		key := strings.Repeat("k", 64<<10)
+		if err := s.Set(key, value(1), 0); err != nil && !errors.Is(err, store.ErrKeyTooLong) {
+			t.Errorf("Set of a long key: expected nil or ErrKeyTooLong, got %v", err)
+		}
+		return
+	}
+
+	key := strings.Repeat("k", config.MaxKeySize)
+	if err := s.Set(key, value(1), 0); err != nil {
+		t.Errorf("Set of a key of MaxKeySize bytes failed: %v", err)
+	}
+
+	key += "k"
+	if err := s.Set(key, value(1), 0); !errors.Is(err, store.ErrKeyTooLong) {
+		t.Errorf("Set: expected ErrKeyTooLong, got %v", err)
+	}
+	val, ok := s.Get(key)
+	expectMissing(t, val, ok, "<too long>")
+}
+
+func testStoreFull(t *testing.T, s store.Store, config Config) {
+	full := -1
+	for i := 0; i <= config.Capacity; i++ {
+		err := s.Set(fmt.Sprintf("key-%d", i), value(i), 0)
+		if errors.Is(err, store.ErrStoreFull) {
+			full = i
+			break
+		}
+		if err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if full < 0 {
+		t.Fatalf("Expected ErrStoreFull after at most %d keys", config.Capacity)
+	}
+	if full == 0 {
+		t.Fatal("Expected an empty store to accept a key")
+	}
+
+	// Existing keys can still be updated while the store is full
+	if err := s.Set("key-0", value(-1), 0); err != nil {
+		t.Errorf("Update of an existing key in a full store failed: %v", err)
+	}
+	val, ok := s.Get("key-0")
+	expect(t, val, ok, "key-0", -1)
+
+	// Deleting frees capacity
+	if err := s.Delete("key-0"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := s.Set("key-0", value(0), 0); err != nil {
+		t.Errorf("Set after Delete in a full store failed: %v", err)
+	}
+}
+
+func testNamespaces(t *testing.T, s store.NamespacedStore) {
+	if err := s.SetWithNamespace("a", "key", value(1), 0); err != nil {
+		t.Fatalf("SetWithNamespace failed: %v", err)
+	}
+	if err := s.SetWithNamespace("b", "key", value(2), 0); err != nil {
+		t.Fatalf("SetWithNamespace failed: %v", err)
+	}
+
+	val, ok := s.GetWithNamespace("a", "key")
+	expect(t, val, ok, "a/key", 1)
+	val, ok = s.GetWithNamespace("b", "key")
+	expect(t, val, ok, "b/key", 2)
+	val, ok = s.GetWithNamespace("c", "key")
+	expectMissing(t, val, ok, "c/key")
+
+	if err := s.DeleteWithNamespace("a", "key"); err != nil {
+		t.Fatalf("DeleteWithNamespace failed: %v", err)
+	}
+	val, ok = s.GetWithNamespace("a", "key")
+	expectMissing(t, val, ok, "a/key")
+	val, ok = s.GetWithNamespace("b", "key")
+	expect(t, val, ok, "b/key", 2)
+}
+
+func testUpdateTTL(t *testing.T, s store.TTLStore, config Config) {
+	res := config.TTLResolution
+
+	if err := s.Set("key", value(1), 2*res); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := s.UpdateTTL("key", time.Hour); err != nil {
+		t.Fatalf("UpdateTTL failed: %v", err)
+	}
+
+	// Updating a missing key is not an error and does not create it
+	if err := s.UpdateTTL("missing", time.Hour); err != nil {
+		t.Errorf("UpdateTTL of a missing key failed: %v", err)
+	}
+
+	time.Sleep(4 * res)
+
+	val, ok := s.Get("key")
+	expect(t, val, ok, "key", 1)
+	val, ok = s.Get("missing")
+	expectMissing(t, val, ok, "missing")
+}
+
+func testTimeAware(t *testing.T, s store.TimeAwareStore) {
+	now := time.Now()
+
+	if err := s.SetAt("key", value(1), time.Minute, now); err != nil {
+		t.Fatalf("SetAt failed: %v", err)
+	}
+	val, ok := s.GetAt("key", now.Add(59*time.Second))
+	expect(t, val, ok, "key", 1)
+	val, ok = s.GetAt("key", now.Add(61*time.Second))
+	expectMissing(t, val, ok, "key")
+
+	if err := s.UpdateTTLAt("key", time.Hour, now.Add(30*time.Second)); err != nil {
+		t.Fatalf("UpdateTTLAt failed: %v", err)
+	}
+	val, ok = s.GetAt("key", now.Add(time.Hour))
+	expect(t, val, ok, "key", 1)
+	val, ok = s.GetAt("key", now.Add(time.Hour+time.Minute))
+	expectMissing(t, val, ok, "key")
+
+	// A zero TTL never expires
+	if err := s.SetAt("forever", value(2), 0, now); err != nil {
+		t.Fatalf("SetAt failed: %v", err)
+	}
+	val, ok = s.GetAt("forever", now.Add(24*365*time.Hour))
+	expect(t, val, ok, "forever", 2)
+}
+
+func testNamespacedTimeAware(t *testing.T, s store.NamespacedTimeAwareStore) {
+	now := time.Now()
+
+	if err := s.SetWithNamespaceAt("a", "key", value(1), time.Minute, now); err != nil {
+		t.Fatalf("SetWithNamespaceAt failed: %v", err)
+	}
+	val, ok := s.GetWithNamespaceAt("a", "key", now.Add(59*time.Second))
+	expect(t, val, ok, "a/key", 1)
+	val, ok = s.GetWithNamespaceAt("b", "key", now)
+	expectMissing(t, val, ok, "b/key")
+
+	if err := s.UpdateTTLWithNamespaceAt("a", "key", time.Hour, now.Add(30*time.Second)); err != nil {
+		t.Fatalf("UpdateTTLWithNamespaceAt failed: %v", err)
+	}
+	val, ok = s.GetWithNamespaceAt("a", "key", now.Add(time.Hour))
+	expect(t, val, ok, "a/key", 1)
+	val, ok = s.GetWithNamespaceAt("a", "key", now.Add(time.Hour+time.Minute))
+	expectMissing(t, val, ok, "a/key")
+}
+
+func testConcurrency(t *testing.T, s store.Store) {
+	const (
+		workers = 8
+		ops     = 200
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				own := fmt.Sprintf("worker-%d", w)
+				if err := s.Set(own, value(i), time.Hour); err != nil {
+					errs <- err
+					return
+				}
+				if err := s.Set("shared", value(w), time.Hour); err != nil {
+					errs <- err
+					return
+				}
+				s.Get("shared")
+				if i%10 == 0 {
+					if err := s.Delete("shared"); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Concurrent operation failed: %v", err)
+	}
+	for w := 0; w < workers; w++ {
+		key := fmt.Sprintf("worker-%d", w)
+		val, ok := s.Get(key)
+		expect(t, val, ok, key, ops-1)
+	}
+}
+
+// testLimiters checks that both algorithms enforce exact limits on the store.
+func testLimiters(t *testing.T, open func(t *testing.T) store.Store) {
+	config := ratelimiter.Config{Rate: 5, Window: time.Hour}
+
+	limiters := map[string]func(s store.Store) (ratelimiter.Limiter, error){
+		algorithms.TokenBucketName: func(s store.Store) (ratelimiter.Limiter, error) {
+			return algorithms.NewTokenBucket(config, s)
+		},
+		algorithms.SlidingWindowName: func(s store.Store) (ratelimiter.Limiter, error) {
+			return algorithms.NewSlidingWindow(config, s)
+		},
+	}
+
+	for name, newLimiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			l, err := newLimiter(open(t))
+			if err != nil {
+				t.Fatalf("Creating limiter failed: %v", err)
+			}
+
+			for i := 0; i < config.Rate; i++ {
+				allowed, err := l.Allow("key")
+				if err != nil {
+					t.Fatalf("Allow failed: %v", err)
+				}
+				if !allowed {
+					t.Fatalf("Request %d: expected allowed", i+1)
+				}
+			}
+			if allowed, err := l.Allow("key"); err != nil || allowed {
+				t.Errorf("Request %d: expected denied, got %v, %v", config.Rate+1, allowed, err)
+			}
+			if allowed, err := l.Allow("other"); err != nil || !allowed {
+				t.Errorf("Expected other key to be allowed, got %v, %v", allowed, err)
+			}
+
+			if err := l.Reset("key"); err != nil {
+				t.Fatalf("Reset failed: %v", err)
+			}
+			if allowed, err := l.Allow("key"); err != nil || !allowed {
+				t.Errorf("Expected key to be allowed after Reset, got %v, %v", allowed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package storetest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter/store"
+)
+
+func TestMemoryStore(t *testing.T) {
+	TestStoreWithConfig(t, func() store.Store {
+		return store.NewMemoryStoreWithConfig(store.MemoryStoreConfig{
+			MaxEntries: 1024,
+			MaxKeySize: 128,
+		})
+	}, Config{MaxKeySize: 128, Capacity: 1024})
+}
+
+// codecStore is a minimal remote-like store that keeps encoded values.
+type codecStore struct {
+	mu    sync.Mutex
+	codec store.Codec
+	data  map[string][]byte
+	exp   map[string]time.Time
+}
+
+func newCodecStore(codec store.Codec) *codecStore {
+	return &codecStore{codec: codec, data: make(map[string][]byte), exp: make(map[string]time.Time)}
+}
+
+func (s *codecStore) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+	if exp, ok := s.exp[key]; ok && time.Now().After(exp) {
+		return nil, false
+	}
+	val, err := s.codec.Unmarshal(data)
+	return val, err == nil
+}
+
+func (s *codecStore) Set(key string, value interface{}, ttl time.Duration) error {
+	data, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = data
+	delete(s.exp, key)
+	if ttl > 0 {
+		s.exp[key] = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+func (s *codecStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	delete(s.exp, key)
+	return nil
+}
+
+func (s *codecStore) Close() error { return nil }
+
+func TestCodecStores(t *testing.T) {
+	for _, codec := range []store.Codec{store.BinaryCodec, store.JSONCodec, store.MsgpackCodec, store.ProtobufCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			TestStore(t, func() store.Store { return newCodecStore(codec) })
+		})
+	}
+}
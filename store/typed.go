@@ -0,0 +1,65 @@
+package store
+
+import "time"
+
+// TypedStore is a store holding values of a single type T. Unlike Store,
+// values are neither boxed into an interface{} on Set nor type-asserted on
+// Get, so value types (e.g. a struct of counters) are stored without an
+// allocation per write.
+//
+// Keys are namespaced like NamespacedStore keys, and every operation takes
+// the current time like TimeAwareStore operations, so callers that already
+// read the clock do not read it twice.
+type TypedStore[T any] interface {
+	// Get retrieves a value from the store.
+	// Returns the value and true if found, the zero value and false otherwise.
+	Get(namespace, key string, now time.Time) (T, bool)
+
+	// Set stores a value with an optional TTL relative to now.
+	// If ttl is 0, the value never expires.
+	Set(namespace, key string, value T, ttl time.Duration, now time.Time) error
+
+	// UpdateTTL updates the expiration of a key without changing its value.
+	UpdateTTL(namespace, key string, ttl time.Duration, now time.Time) error
+
+	// Delete removes a value from the store.
+	Delete(namespace, key string) error
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// TypedMemoryStore is an in-memory TypedStore. It shares its implementation
+// with MemoryStore: sharding, capacity limits, key size limits and
+// background cleanup of expired entries behave the same.
+type TypedMemoryStore[T any] struct {
+	memoryCore[T]
+}
+
+// NewTypedMemoryStore creates an in-memory store of T values. Zero fields of
+// config take the MemoryStore defaults.
+func NewTypedMemoryStore[T any](config MemoryStoreConfig) *TypedMemoryStore[T] {
+	s := &TypedMemoryStore[T]{}
+	s.init(config)
+	return s
+}
+
+// Get retrieves a value from the store relative to the given time.
+func (s *TypedMemoryStore[T]) Get(namespace, key string, now time.Time) (T, bool) {
+	return s.get(namespace, key, now)
+}
+
+// Set stores a value with an optional TTL relative to the given time.
+func (s *TypedMemoryStore[T]) Set(namespace, key string, value T, ttl time.Duration, now time.Time) error {
+	return s.set(namespace, key, value, ttl, now)
+}
+
+// UpdateTTL updates the expiration of a key relative to the given time.
+func (s *TypedMemoryStore[T]) UpdateTTL(namespace, key string, ttl time.Duration, now time.Time) error {
+	return s.updateTTL(namespace, key, ttl, now)
+}
+
+// Delete removes a value from the store.
+func (s *TypedMemoryStore[T]) Delete(namespace, key string) error {
+	return s.delete(namespace, key)
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+type counters struct {
+	Count int
+	Since int64
+}
+
+func TestTypedMemoryStore_Basic(t *testing.T) {
+	s := NewTypedMemoryStore[counters](MemoryStoreConfig{})
+	defer s.Close()
+	now := time.Now()
+
+	if _, ok := s.Get("ns", "k", now); ok {
+		t.Fatal("Expected missing key")
+	}
+	if err := s.Set("ns", "k", counters{Count: 3}, time.Minute, now); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, ok := s.Get("ns", "k", now); !ok || v.Count != 3 {
+		t.Errorf("Expected count 3, got %+v, %v", v, ok)
+	}
+	if _, ok := s.Get("other", "k", now); ok {
+		t.Error("Expected namespaces to be separate")
+	}
+
+	// Expiry is relative to the given time
+	if _, ok := s.Get("ns", "k", now.Add(2*time.Minute)); ok {
+		t.Error("Expected key to be expired")
+	}
+	if err := s.UpdateTTL("ns", "k", time.Hour, now); err != nil {
+		t.Fatalf("UpdateTTL failed: %v", err)
+	}
+	if _, ok := s.Get("ns", "k", now.Add(2*time.Minute)); !ok {
+		t.Error("Expected UpdateTTL to extend the expiration")
+	}
+
+	if err := s.Delete("ns", "k"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok := s.Get("ns", "k", now); ok {
+		t.Error("Expected key to be deleted")
+	}
+}
+
+func TestTypedMemoryStore_Limits(t *testing.T) {
+	s := NewTypedMemoryStore[int](MemoryStoreConfig{MaxEntries: 1, Shards: 1, MaxKeySize: 4})
+	defer s.Close()
+	now := time.Now()
+
+	if err := s.Set("", "long-key", 1, 0, now); err != ErrKeyTooLong {
+		t.Errorf("Expected ErrKeyTooLong, got %v", err)
+	}
+	if err := s.Set("", "a", 1, 0, now); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := s.Set("", "b", 2, 0, now); err != ErrStoreFull {
+		t.Errorf("Expected ErrStoreFull, got %v", err)
+	}
+	if s.Len() != 1 {
+		t.Errorf("Expected 1 entry, got %d", s.Len())
+	}
+}
+
+func TestTypedMemoryStore_NoAllocs(t *testing.T) {
+	s := NewTypedMemoryStore[counters](MemoryStoreConfig{})
+	defer s.Close()
+	now := time.Now()
+	s.Set("tb", "k", counters{}, time.Minute, now)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		v, _ := s.Get("tb", "k", now)
+		v.Count++
+		s.Set("tb", "k", v, time.Minute, now)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
+
+var _ TypedStore[int] = (*TypedMemoryStore[int])(nil)
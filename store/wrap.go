@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Decorator wraps a Store to add behavior around its calls, e.g. logging or
+// metrics, without modifying the backend.
+type Decorator func(Store) Store
+
+// Wrap returns s wrapped by decorators, the first being the outermost:
+//
+//	s := store.Wrap(backend,
+//		store.WithLogging(logger),
+//		store.WithMetrics(observe),
+//		store.WithCache(store.CacheConfig{TTL: 50 * time.Millisecond}),
+//	)
+//
+// Wrapped stores only expose the Store interface, plus Ping and Shutdown
+// of the wrapped store: the algorithms do not see optional interfaces such
+// as NamespacedStore, and do not update the state of a *MemoryStore in
+// place.
+func Wrap(s Store, decorators ...Decorator) Store {
+	for i := len(decorators) - 1; i >= 0; i-- {
+		s = decorators[i](s)
+	}
+	return s
+}
+
+// decorated forwards the calls a decorator does not intercept to the wrapped
+// store.
+type decorated struct {
+	Store
+}
+
+// Ping checks the wrapped store.
+func (d decorated) Ping(ctx context.Context) error {
+	return Ping(ctx, d.Store)
+}
+
+// Shutdown shuts the wrapped store down.
+func (d decorated) Shutdown(ctx context.Context) error {
+	return Shutdown(ctx, d.Store)
+}
+
+// LoggingStore logs the calls of a Store: failed calls at warning level,
+// others at debug level, with their key and latency. Keys may contain
+// client identifiers such as IP addresses.
+type LoggingStore struct {
+	decorated
+	logger *slog.Logger
+}
+
+// NewLoggingStore wraps s to log its calls to logger (slog.Default() if nil).
+func NewLoggingStore(s Store, logger *slog.Logger) *LoggingStore {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &LoggingStore{decorated: decorated{s}, logger: logger}
+}
+
+// WithLogging returns a Decorator wrapping stores in a LoggingStore.
+func WithLogging(logger *slog.Logger) Decorator {
+	return func(s Store) Store {
+		return NewLoggingStore(s, logger)
+	}
+}
+
+// Get retrieves a value from the store.
+func (l *LoggingStore) Get(key string) (interface{}, bool) {
+	start := time.Now()
+	val, ok := l.Store.Get(key)
+	l.logger.Debug("ratelimiter: store get", "key", key, "found", ok, "latency", time.Since(start))
+	return val, ok
+}
+
+// Set stores a value with an optional TTL.
+func (l *LoggingStore) Set(key string, value interface{}, ttl time.Duration) error {
+	start := time.Now()
+	err := l.Store.Set(key, value, ttl)
+	l.log("set", key, start, err)
+	return err
+}
+
+// Delete removes a value from the store.
+func (l *LoggingStore) Delete(key string) error {
+	start := time.Now()
+	err := l.Store.Delete(key)
+	l.log("delete", key, start, err)
+	return err
+}
+
+// log logs a call that can fail.
+func (l *LoggingStore) log(op, key string, start time.Time, err error) {
+	if err != nil {
+		l.logger.Warn("ratelimiter: store "+op+" failed", "key", key, "latency", time.Since(start), "error", err)
+		return
+	}
+	l.logger.Debug("ratelimiter: store "+op, "key", key, "latency", time.Since(start))
+}
+
+// StoreStats holds the counters of a MetricsStore.
+type StoreStats struct {
+	Gets, Sets, Deletes uint64
+	Misses              uint64        // Gets of missing keys
+	Errors              uint64        // Failed sets and deletes
+	Latency             time.Duration // Total latency of all calls
+}
+
+// MetricsStore counts the calls of a Store, their misses, errors and
+// latency, and reports each call to an optional observer, e.g. to export
+// histograms.
+type MetricsStore struct {
+	decorated
+	observe func(op string, latency time.Duration, err error)
+
+	gets, sets, deletes, misses, errors atomic.Uint64
+	latency                             atomic.Int64
+}
+
+// NewMetricsStore wraps s to count its calls. observe, if not nil, is called
+// synchronously after every call with the operation ("get", "set" or
+// "delete"), its latency and its error, and must not block.
+func NewMetricsStore(s Store, observe func(op string, latency time.Duration, err error)) *MetricsStore {
+	return &MetricsStore{decorated: decorated{s}, observe: observe}
+}
+
+// WithMetrics returns a Decorator wrapping stores in a MetricsStore reporting
+// to observe.
+func WithMetrics(observe func(op string, latency time.Duration, err error)) Decorator {
+	return func(s Store) Store {
+		return NewMetricsStore(s, observe)
+	}
+}
+
+// Get retrieves a value from the store.
+func (m *MetricsStore) Get(key string) (interface{}, bool) {
+	start := time.Now()
+	val, ok := m.Store.Get(key)
+	m.gets.Add(1)
+	if !ok {
+		m.misses.Add(1)
+	}
+	m.record("get", start, nil)
+	return val, ok
+}
+
+// Set stores a value with an optional TTL.
+func (m *MetricsStore) Set(key string, value interface{}, ttl time.Duration) error {
+	start := time.Now()
+	err := m.Store.Set(key, value, ttl)
+	m.sets.Add(1)
+	m.record("set", start, err)
+	return err
+}
+
+// Delete removes a value from the store.
+func (m *MetricsStore) Delete(key string) error {
+	start := time.Now()
+	err := m.Store.Delete(key)
+	m.deletes.Add(1)
+	m.record("delete", start, err)
+	return err
+}
+
+// Stats returns the counters.
+func (m *MetricsStore) Stats() StoreStats {
+	return StoreStats{
+		Gets:    m.gets.Load(),
+		Sets:    m.sets.Load(),
+		Deletes: m.deletes.Load(),
+		Misses:  m.misses.Load(),
+		Errors:  m.errors.Load(),
+		Latency: time.Duration(m.latency.Load()),
+	}
+}
+
+// record counts the latency and error of a call and reports it.
+func (m *MetricsStore) record(op string, start time.Time, err error) {
+	latency := time.Since(start)
+	m.latency.Add(int64(latency))
+	if err != nil {
+		m.errors.Add(1)
+	}
+	if m.observe != nil {
+		m.observe(op, latency, err)
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrap_Order(t *testing.T) {
+	var order []string
+	trace := func(name string) Decorator {
+		return WithMetrics(func(op string, latency time.Duration, err error) {
+			order = append(order, name)
+		})
+	}
+
+	s := Wrap(NewMemoryStore(), trace("outer"), trace("inner"))
+	defer s.Close()
+	s.Get("key")
+
+	// The inner decorator returns first
+	if strings.Join(order, ",") != "inner,outer" {
+		t.Errorf("Calls observed in order %v", order)
+	}
+}
+
+func TestLoggingStore(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := NewLoggingStore(&failingStore{err: errors.New("timeout")}, logger)
+
+	s.Get("k1")
+	s.Set("k2", 1, 0)
+	out := buf.String()
+	if !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, "key=k1") {
+		t.Errorf("Expected the get at debug level:\n%s", out)
+	}
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, "error=timeout") {
+		t.Errorf("Expected the failed set at warning level:\n%s", out)
+	}
+}
+
+func TestMetricsStore(t *testing.T) {
+	backend := &failingStore{}
+	var observed []string
+	s := NewMetricsStore(backend, func(op string, latency time.Duration, err error) {
+		observed = append(observed, op)
+	})
+
+	s.Get("k")
+	s.Set("k", 1, 0)
+	backend.err = errors.New("timeout")
+	s.Set("k", 1, 0)
+	s.Delete("k")
+
+	stats := s.Stats()
+	if stats.Gets != 1 || stats.Misses != 1 || stats.Sets != 2 || stats.Deletes != 1 || stats.Errors != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if strings.Join(observed, ",") != "get,set,set,delete" {
+		t.Errorf("Observed %v", observed)
+	}
+}
+
+func TestCachingStore(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	backend := NewMetricsStore(NewMemoryStore(), nil)
+	s := NewCachingStore(backend, CacheConfig{TTL: time.Second, MaxEntries: 2, Now: func() time.Time { return now }})
+	defer s.Close()
+
+	s.Set("k", 1, 0)
+	if val, ok := s.Get("k"); !ok || val != 1 {
+		t.Fatalf("Get = %v, %v", val, ok)
+	}
+	if gets := backend.Stats().Gets; gets != 0 {
+		t.Errorf("Expected the value written to be cached, got %d store gets", gets)
+	}
+
+	// Expired entries are read from the store again
+	now = now.Add(time.Second)
+	s.Get("k")
+	if gets := backend.Stats().Gets; gets != 1 {
+		t.Errorf("Expected a store get after the TTL, got %d", gets)
+	}
+
+	s.Delete("k")
+	if _, ok := s.Get("k"); ok {
+		t.Error("Expected the deleted key to be missing")
+	}
+
+	// The cache is bounded
+	for _, key := range []string{"a", "b", "c"} {
+		s.Set(key, key, 0)
+	}
+	s.mu.Lock()
+	n := len(s.entries)
+	s.mu.Unlock()
+	if n > 2 {
+		t.Errorf("Expected at most 2 cached keys, got %d", n)
+	}
+}
+
+func TestChaosStore(t *testing.T) {
+	s := NewChaosStore(NewMemoryStore(), ChaosConfig{FailureRate: 1})
+	defer s.Close()
+	if err := s.Set("k", 1, 0); !errors.Is(err, ErrChaos) {
+		t.Errorf("Expected ErrChaos, got %v", err)
+	}
+
+	backend := NewMemoryStore()
+	defer backend.Close()
+	s = NewChaosStore(backend, ChaosConfig{Latency: time.Millisecond})
+	start := time.Now()
+	if err := s.Set("k", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < time.Millisecond {
+		t.Error("Expected the injected latency")
+	}
+	if _, ok := s.Get("k"); !ok {
+		t.Error("Expected calls to succeed without a failure rate")
+	}
+}
@@ -0,0 +1,128 @@
+// Package worker throttles message consumers (Kafka, SQS, NATS, ...) to a
+// rate per key, waiting for the limit instead of rejecting messages:
+//
+//	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 100, Window: time.Second}, s)
+//	for msg := range worker.Channel(ctx, messages, limiter, func(m Message) string { return m.Tenant }) {
+//		process(msg)
+//	}
+//
+// Store errors fail open, like the middleware: messages are delivered
+// rather than stalled while the store is unavailable.
+package worker
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+)
+
+// pollInterval is the wait between checks of limiters that do not report a
+// retry delay.
+const pollInterval = 10 * time.Millisecond
+
+// Throttle blocks until one message of key is allowed by limiter.
+func Throttle(ctx context.Context, limiter ratelimiter.Limiter, key string) error {
+	return ThrottleN(ctx, limiter, key, 1)
+}
+
+// ThrottleN blocks until n messages of key are allowed by limiter, e.g. for
+// a batch. It returns the context error if ctx is done first, or
+// context.DeadlineExceeded at once if the messages cannot be allowed before
+// the context deadline. A cost the limiter can never allow is reported with
+// ratelimiter.ErrCostExceedsCapacity.
+func ThrottleN(ctx context.Context, limiter ratelimiter.Limiter, key string, n int) error {
+	l := ratelimiter.WithDetails(limiter)
+	deadline, hasDeadline := ctx.Deadline()
+
+	for {
+		result, err := l.AllowNWithDetails(key, n)
+		if err != nil {
+			if errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+				return err
+			}
+			return nil
+		}
+		if result.Allowed {
+			return nil
+		}
+
+		wait := result.RetryAfter
+		if wait <= 0 {
+			wait = pollInterval
+		}
+		if hasDeadline && time.Now().Add(wait).After(deadline) {
+			return context.DeadlineExceeded
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// throttle waits for one message of key and reports whether to deliver it:
+// false if ctx is done, or its deadline comes, before the message is
+// allowed. Costs the limiter can never allow fail open.
+func throttle(ctx context.Context, limiter ratelimiter.Limiter, key string) bool {
+	err := Throttle(ctx, limiter, key)
+	return err == nil || errors.Is(err, ratelimiter.ErrCostExceedsCapacity)
+}
+
+// Channel returns a channel delivering the messages of in at the rate
+// allowed by limiter for their key. Messages are delivered in order, so a
+// throttled key holds back the messages behind it; use one Channel per key
+// or partition to throttle keys independently. The returned channel is
+// closed when in is closed, or ctx is done (or its deadline comes) before
+// the next message is allowed.
+func Channel[T any](ctx context.Context, in <-chan T, limiter ratelimiter.Limiter, key func(T) string) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			var msg T
+			var ok bool
+			select {
+			case msg, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			if !throttle(ctx, limiter, key(msg)) {
+				return
+			}
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Seq returns an iterator over the messages of seq at the rate allowed by
+// limiter for their key, e.g. over the records of a polled batch. The
+// iteration stops when ctx is done (or its deadline comes) before the next
+// message is allowed.
+func Seq[T any](ctx context.Context, seq iter.Seq[T], limiter ratelimiter.Limiter, key func(T) string) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for msg := range seq {
+			if !throttle(ctx, limiter, key(msg)) {
+				return
+			}
+			if !yield(msg) {
+				return
+			}
+		}
+	}
+}
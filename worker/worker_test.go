@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Morditux/ratelimiter"
+	"github.com/Morditux/ratelimiter/algorithms"
+	"github.com/Morditux/ratelimiter/store"
+)
+
+type message struct {
+	tenant string
+	id     int
+}
+
+func tenant(m message) string { return m.tenant }
+
+// newLimiter returns a limiter allowing one message per key every 20ms.
+func newLimiter(t *testing.T) ratelimiter.Limiter {
+	t.Helper()
+	s := store.NewMemoryStore()
+	t.Cleanup(func() { s.Close() })
+	limiter, err := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 50, Window: time.Second, BurstSize: 1}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return limiter
+}
+
+func TestThrottle(t *testing.T) {
+	limiter := newLimiter(t)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := Throttle(ctx, limiter, "k"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("4 messages took %v, want about 60ms", elapsed)
+	}
+
+	// A deadline that cannot be met fails at once
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	if err := Throttle(ctx, limiter, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+
+	if err := ThrottleN(context.Background(), limiter, "k", 2); !errors.Is(err, ratelimiter.ErrCostExceedsCapacity) {
+		t.Errorf("err = %v, want ErrCostExceedsCapacity", err)
+	}
+}
+
+func TestChannel(t *testing.T) {
+	limiter := newLimiter(t)
+	in := make(chan message, 6)
+	for i := 0; i < 3; i++ {
+		in <- message{"a", i}
+		in <- message{"b", i}
+	}
+	close(in)
+
+	start := time.Now()
+	var got []message
+	for m := range Channel(context.Background(), in, limiter, tenant) {
+		got = append(got, m)
+	}
+	if len(got) != 6 || got[0] != (message{"a", 0}) || got[5] != (message{"b", 2}) {
+		t.Errorf("Expected the messages in order, got %v", got)
+	}
+	// Each tenant waits twice for its limit
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Messages took %v, want about 40ms", elapsed)
+	}
+}
+
+func TestChannel_Cancel(t *testing.T) {
+	s := store.NewMemoryStore()
+	defer s.Close()
+	limiter, _ := algorithms.NewTokenBucket(ratelimiter.Config{Rate: 1, Window: time.Hour}, s)
+
+	in := make(chan message, 2)
+	in <- message{"a", 0}
+	in <- message{"a", 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	out := Channel(ctx, in, limiter, tenant)
+
+	if m := <-out; m.id != 0 {
+		t.Errorf("Expected message 0, got %v", m)
+	}
+	cancel()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Error("Expected no message after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Channel not closed after cancel")
+	}
+}
+
+func TestSeq(t *testing.T) {
+	limiter := newLimiter(t)
+	batch := []message{{"a", 0}, {"b", 0}, {"a", 1}}
+
+	var got []message
+	for m := range Seq(context.Background(), slices.Values(batch), limiter, tenant) {
+		got = append(got, m)
+	}
+	if !slices.Equal(got, batch) {
+		t.Errorf("got %v, want %v", got, batch)
+	}
+
+	// A deadline that cannot be met stops the iteration
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	got = got[:0]
+	for m := range Seq(ctx, slices.Values(batch), limiter, tenant) {
+		got = append(got, m)
+	}
+	if len(got) != 0 {
+		t.Errorf("Expected no message once the limit is exhausted, got %v", got)
+	}
+}